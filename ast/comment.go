@@ -0,0 +1,56 @@
+package ast
+
+import (
+	"strings"
+
+	"github.com/expr-lang/expr/file"
+)
+
+// Comments attaches comments to the nodes of a tree. A comment which
+// follows a node on its line is a trailing comment of the outermost node
+// ending there. Other comments are leading comments of the outermost node
+// starting after them, or trailing comments of the root if there is none.
+type Comments struct {
+	Leading  map[Node][]file.Comment
+	Trailing map[Node][]file.Comment
+}
+
+// AddLeading attaches the comment before the node.
+func (c *Comments) AddLeading(node Node, comment file.Comment) {
+	if c.Leading == nil {
+		c.Leading = make(map[Node][]file.Comment)
+	}
+	c.Leading[node] = append(c.Leading[node], comment)
+}
+
+// AddTrailing attaches the comment after the node.
+func (c *Comments) AddTrailing(node Node, comment file.Comment) {
+	if c.Trailing == nil {
+		c.Trailing = make(map[Node][]file.Comment)
+	}
+	c.Trailing[node] = append(c.Trailing[node], comment)
+}
+
+// Len returns the number of attached comments.
+func (c *Comments) Len() int {
+	if c == nil {
+		return 0
+	}
+	n := 0
+	for _, comments := range c.Leading {
+		n += len(comments)
+	}
+	for _, comments := range c.Trailing {
+		n += len(comments)
+	}
+	return n
+}
+
+// inline returns the comment as a /* */ comment, which can be followed by
+// code on the same line.
+func inline(c file.Comment) string {
+	if strings.HasPrefix(c.Text, "//") {
+		return "/*" + strings.TrimRight(c.Text[2:], " ") + " */"
+	}
+	return c.Text
+}
@@ -0,0 +1,44 @@
+package ast
+
+import "reflect"
+
+var (
+	nodeType  = reflect.TypeOf((*Node)(nil)).Elem()
+	nodesType = reflect.TypeOf([]Node{})
+)
+
+// Copy returns a deep copy of the tree of the node. The copy can be patched
+// and checked without changing the original tree.
+func Copy(node Node) Node {
+	if node == nil {
+		return nil
+	}
+	v := reflect.ValueOf(node)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return node
+	}
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	fields := c.Elem()
+	for i := 0; i < fields.NumField(); i++ {
+		f := fields.Field(i)
+		if !f.CanSet() {
+			continue
+		}
+		switch f.Type() {
+		case nodeType:
+			if !f.IsNil() {
+				f.Set(reflect.ValueOf(Copy(f.Interface().(Node))))
+			}
+		case nodesType:
+			if !f.IsNil() {
+				nodes := make([]Node, f.Len())
+				for j := range nodes {
+					nodes[j] = Copy(f.Index(j).Interface().(Node))
+				}
+				f.Set(reflect.ValueOf(nodes))
+			}
+		}
+	}
+	return c.Interface().(Node)
+}
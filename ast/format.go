@@ -0,0 +1,238 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/expr-lang/expr/file"
+
+	"github.com/expr-lang/expr/parser/utils"
+)
+
+// DefaultFormatWidth is the line width used by Format if width is not positive.
+const DefaultFormatWidth = 80
+
+const formatIndent = "    "
+
+// Format returns canonical source text of the node. Nodes which fit into the
+// line width are printed on a single line, like String does; longer ones are
+// split at boolean and arithmetic operators, call arguments, array and map
+// elements, and ternary branches. Variable declarations and sequences are
+// always printed one per line.
+//
+// Parsing the output results in the same tree as the one being formatted.
+func Format(node Node, width int) string {
+	return FormatWithComments(node, nil, width)
+}
+
+// FormatWithComments is like Format, but also prints the comments attached
+// to the nodes, like those of parser.Tree. Leading comments are printed on
+// the lines before their node and trailing ones after it. Trailing // comments
+// which are not at the end of a line, like those of a call argument, are
+// printed as /* */ comments.
+func FormatWithComments(node Node, comments *Comments, width int) string {
+	if width <= 0 {
+		width = DefaultFormatWidth
+	}
+	f := &formatter{width: width, comments: comments}
+	return f.statement(node, "", 0, true)
+}
+
+type formatter struct {
+	width    int
+	comments *Comments
+}
+
+func (f *formatter) fits(s string, depth int) bool {
+	return !strings.Contains(s, "\n") &&
+		depth*len(formatIndent)+utf8.RuneCountInString(s) <= f.width
+}
+
+func newline(depth int) string {
+	return "\n" + strings.Repeat(formatIndent, depth)
+}
+
+func (f *formatter) format(node Node, depth int) string {
+	return f.statement(node, "", depth, false)
+}
+
+// statement formats the node followed by the separator, like ";", and the
+// comments of the node. Trailing // comments are kept if eol is true, when
+// the node ends a line.
+func (f *formatter) statement(node Node, sep string, depth int, eol bool) string {
+	if f.comments == nil {
+		return f.node(node, depth, eol) + sep
+	}
+	var sb strings.Builder
+	for _, c := range f.comments.Leading[node] {
+		sb.WriteString(c.Text)
+		sb.WriteString(newline(depth))
+	}
+	sb.WriteString(f.node(node, depth, eol))
+	sb.WriteString(sep)
+	trailing := f.comments.Trailing[node]
+	for i, c := range trailing {
+		sb.WriteString(" ")
+		if eol && i == len(trailing)-1 {
+			sb.WriteString(c.Text)
+		} else {
+			sb.WriteString(inline(c))
+		}
+	}
+	return sb.String()
+}
+
+func (f *formatter) node(node Node, depth int, eol bool) string {
+	switch n := node.(type) {
+	case *VariableDeclaratorNode:
+		return fmt.Sprintf("let %s = %s%s%s",
+			n.Name, f.statement(n.Value, ";", depth, true), newline(depth), f.statement(n.Expr, "", depth, eol))
+
+	case *SequenceNode:
+		var sb strings.Builder
+		for i, node := range n.Nodes {
+			if i < len(n.Nodes)-1 {
+				sb.WriteString(f.statement(node, ";", depth, true))
+				sb.WriteString(newline(depth))
+			} else {
+				sb.WriteString(f.statement(node, "", depth, eol))
+			}
+		}
+		return sb.String()
+	}
+
+	flat := node.String()
+	if f.fits(flat, depth) && !f.commented(node) {
+		return flat
+	}
+
+	switch n := node.(type) {
+	case *BinaryNode:
+		if n.Operator == ".." {
+			return f.flat(node, flat, depth)
+		}
+		lwrap, rwrap := n.wrap()
+		return fmt.Sprintf("%s%s%s %s",
+			f.wrapped(n.Left, lwrap, depth),
+			newline(depth+1), n.Operator,
+			f.wrapped(n.Right, rwrap, depth+1))
+
+	case *UnaryNode:
+		op := n.Operator
+		if op == "not" {
+			op += " "
+		}
+		return op + f.wrapped(n.Node, n.wrap(), depth)
+
+	case *ConditionalNode:
+		condWrap := isConditional(n.Cond)
+		exp1Wrap := isConditional(n.Exp1)
+		exp2Wrap := isConditional(n.Exp2)
+		return fmt.Sprintf("%s%s? %s%s: %s",
+			f.wrapped(n.Cond, condWrap, depth),
+			newline(depth+1), f.wrapped(n.Exp1, exp1Wrap, depth+1),
+			newline(depth+1), f.wrapped(n.Exp2, exp2Wrap, depth+1))
+
+	case *SwitchNode:
+		return f.format(n.conditional(), depth)
+
+	case *CallNode:
+		return n.Callee.String() + f.list("(", n.Arguments, ")", depth)
+
+	case *BuiltinNode:
+		return n.Name + f.list("(", n.Arguments, ")", depth)
+
+	case *OpcodeNode:
+		return n.Name + f.list("(", n.operands(), ")", depth)
+
+	case *PredicateNode:
+		return f.format(n.Node, depth)
+
+	case *ChainNode:
+		return f.format(n.Node, depth)
+
+	case *ArrayNode:
+		return f.list("[", n.Nodes, "]", depth)
+
+	case *MapNode:
+		return f.list("{", n.Pairs, "}", depth)
+
+	case *PairNode:
+		var key string
+		if str, ok := n.Key.(*StringNode); ok {
+			if utils.IsValidIdentifier(str.Value) {
+				key = str.Value
+			} else {
+				key = str.String()
+			}
+		} else {
+			key = fmt.Sprintf("(%s)", n.Key.String())
+		}
+		return fmt.Sprintf("%s: %s", key, f.format(n.Value, depth))
+	}
+
+	return f.flat(node, flat, depth)
+}
+
+// commented reports whether comments are attached to nodes inside the node.
+func (f *formatter) commented(node Node) bool {
+	if f.comments == nil {
+		return false
+	}
+	return Find(node, func(n Node) bool {
+		return n != node && (len(f.comments.Leading[n]) > 0 || len(f.comments.Trailing[n]) > 0)
+	}) != nil
+}
+
+// flat returns the node printed on a single line, with the comments of the
+// nodes inside it moved before and after it.
+func (f *formatter) flat(node Node, flat string, depth int) string {
+	if !f.commented(node) {
+		return flat
+	}
+	var leading, trailing []file.Comment
+	Find(node, func(n Node) bool {
+		if n != node {
+			leading = append(leading, f.comments.Leading[n]...)
+			trailing = append(trailing, f.comments.Trailing[n]...)
+		}
+		return false
+	})
+	var sb strings.Builder
+	for _, c := range leading {
+		sb.WriteString(c.Text)
+		sb.WriteString(newline(depth))
+	}
+	sb.WriteString(flat)
+	for _, c := range trailing {
+		sb.WriteString(" ")
+		sb.WriteString(inline(c))
+	}
+	return sb.String()
+}
+
+func (f *formatter) wrapped(node Node, wrap bool, depth int) string {
+	if wrap {
+		return "(" + f.format(node, depth+1) + ")"
+	}
+	return f.format(node, depth)
+}
+
+func (f *formatter) list(open string, nodes []Node, close string, depth int) string {
+	if len(nodes) == 0 {
+		return open + close
+	}
+	var sb strings.Builder
+	sb.WriteString(open)
+	for i, node := range nodes {
+		sb.WriteString(newline(depth + 1))
+		sb.WriteString(f.format(node, depth+1))
+		if i < len(nodes)-1 {
+			sb.WriteString(",")
+		}
+	}
+	sb.WriteString(newline(depth))
+	sb.WriteString(close)
+	return sb.String()
+}
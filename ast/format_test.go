@@ -0,0 +1,120 @@
+package ast_test
+
+import (
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`a  +   b`, `a + b`},
+		{`let x = 1; x + 1`, "let x = 1;\nx + 1"},
+		{`1; 2`, "1;\n2"},
+		{
+			`user.Age >= 18 and user.Country in ["US", "CA"] and not user.Banned`,
+			"user.Age >= 18 and user.Country in [\"US\", \"CA\"]\n    and not user.Banned",
+		},
+		{
+			`filter(users, .Age > 18 && .Name startsWith "A" && .Email endsWith "@example.com")`,
+			"filter(\n    users,\n    .Age > 18 && .Name startsWith \"A\"\n        && .Email endsWith \"@example.com\"\n)",
+		},
+		{
+			`user?.Profile?.Name ?? "anonymous" ?? "this is a rather long default value"`,
+			"(user?.Profile?.Name ?? \"anonymous\")\n    ?? \"this is a rather long default value\"",
+		},
+		{
+			`{"first": first_value_of_map, "second": [1, 2, 3], "third": {a: b}}`,
+			"{\n    first: first_value_of_map,\n    second: [1, 2, 3],\n    third: {a: b}\n}",
+		},
+		{
+			`user.Age >= 18 ? "this is an adult person" : "this is a child person"`,
+			"user.Age >= 18\n    ? \"this is an adult person\"\n    : \"this is a child person\"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tree, err := parser.Parse(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ast.Format(tree.Node, 60))
+		})
+	}
+}
+
+func TestFormat_round_trip(t *testing.T) {
+	tests := []string{
+		`nil ?? 1 ?? (a ? b : c)`,
+		`-(a + b) * c ** 2 / (d - e) % f`,
+		`not (a in b) and (c or d) and e matches "^x+$"`,
+		`map(filter(users, {.Age > 18 and .Active}), {.Name + " " + .Surname})`,
+		`users | filter(.Age > 18) | map(.Name) | join(", ")`,
+		`a?.b?.[c]?.d() ?? e.f[1:2][g:] ?? h[:i]`,
+		`let x = a; let y = x * 2; [x, y, {x: x, "y y": y, (x): 1}]`,
+		`a ? (b ? c : d) : (e ? f : g)`,
+		`reduce(1..10, #acc + # * #index, 0) > 100 ? "lots of them" : "only a few"`,
+		`sortBy(items, .Price, "desc")[0].Name contains "x" || len(items) == 0`,
+		`if a > b { "first value" } else { "second value" }`,
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			tree, err := parser.Parse(input)
+			require.NoError(t, err)
+
+			for _, width := range []int{1, 20, 40, 0} {
+				formatted := ast.Format(tree.Node, width)
+				again, err := parser.Parse(formatted)
+				require.NoError(t, err, formatted)
+				assert.Equal(t, tree.Node.String(), again.Node.String(), formatted)
+				assert.Equal(t, formatted, ast.Format(again.Node, width))
+			}
+		})
+	}
+}
+
+func TestFormatWithComments(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{
+			"// is adult\nuser.Age >= 18 && // old enough\n  user.Country in [\"FR\", \"DE\"] // eu",
+			"// is adult\nuser.Age >= 18\n    && // old enough\n    user.Country in [\"FR\", \"DE\"] // eu",
+		},
+		{
+			"let limit = 100; // euros\n/* check */ amount < limit",
+			"let limit = 100; // euros\n/* check */\namount < limit",
+		},
+		{
+			"foo(a, // first\n b)",
+			"foo(\n    a /* first */,\n    b\n)",
+		},
+		{
+			"[/* empty */]",
+			"[] /* empty */",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tree, err := parser.Parse(tt.input)
+			require.NoError(t, err)
+			formatted := ast.FormatWithComments(tree.Node, tree.Comments, 40)
+			assert.Equal(t, tt.want, formatted)
+
+			again, err := parser.Parse(formatted)
+			require.NoError(t, err)
+			assert.Equal(t, tree.Node.String(), again.Node.String())
+			assert.Equal(t, tree.Comments.Len(), again.Comments.Len())
+			assert.Equal(t, formatted, ast.FormatWithComments(again.Node, again.Comments, 40))
+		})
+	}
+}
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"reflect"
+	"strconv"
 
 	"github.com/expr-lang/expr/checker/nature"
 	"github.com/expr-lang/expr/file"
@@ -106,11 +107,13 @@ type StringNode struct {
 
 // ConstantNode represents a constant.
 // Constants are predefined values like nil, true, false, array, map, etc.
-// The parser.Parse will never generate ConstantNode, it is only generated
+// The parser.Parse generates ConstantNode only for prefixed literals
+// registered in the config, like re"^a+$"; otherwise it is only generated
 // by the optimizer.
 type ConstantNode struct {
 	base
-	Value any // Value of the constant.
+	Value   any    // Value of the constant.
+	Literal string // Source of the prefixed literal, if any. Like `re"^a+$"`.
 }
 
 // UnaryNode represents a unary operator.
@@ -194,12 +197,42 @@ type PredicateNode struct {
 	Node Node // Node of the predicate body.
 }
 
+// FunctionNode represents a function defined in the expression, which can
+// be assigned to a variable and called later.
+// Example:
+//
+//	let double = (x) => x * 2; map(xs, double)
+//
+// The function is "(x) => x * 2".
+type FunctionNode struct {
+	base
+	Params []string // Names of the parameters. Like "x" in "(x) => x * 2".
+	Node   Node     // Node of the function body.
+}
+
 // PointerNode represents a pointer to a current value in predicate.
 type PointerNode struct {
 	base
 	Name string // Name of the pointer. Like "index" in "#index".
 }
 
+// Level returns the nesting level of a numbered pointer, like 1 in "#1",
+// which refers to the element of the outermost predicate.
+func (n *PointerNode) Level() (int, bool) {
+	level, err := strconv.Atoi(n.Name)
+	if err != nil || level < 1 {
+		return 0, false
+	}
+	return level, true
+}
+
+// PlaceholderNode represents a placeholder of a template, which is replaced
+// with a constant when the template is bound.
+type PlaceholderNode struct {
+	base
+	Name string // Name of the placeholder. Like "threshold" in "amount > :threshold".
+}
+
 // ConditionalNode represents a ternary operator.
 type ConditionalNode struct {
 	base
@@ -208,6 +241,29 @@ type ConditionalNode struct {
 	Exp2 Node // Expression 2 of the ternary operator. Like "baz" in "foo ? bar : baz".
 }
 
+// SwitchNode represents a chain of conditionals which compare a value with
+// constants, like x == "a" ? 1 : x == "b" ? 2 : 3. It is not parsed, the
+// optimizer replaces such chains with it, so they are compiled to a single
+// jump.
+type SwitchNode struct {
+	base
+	Node     Node   // Compared value. Like "x" in x == "a" ? 1 : x == "b" ? 2 : 3.
+	Cases    []any  // Constants compared with Node, all int or all string. Like "a" and "b".
+	Branches []Node // Result of every case. Like "1" and "2".
+	Default  Node   // Result if no case matches. Like "3".
+}
+
+// OpcodeNode represents a custom opcode of the VM, registered with
+// vm.RegisterOpcode. It is not parsed, patchers insert it to compile parts of
+// an expression to specialized instructions. Its type is the one set by the
+// patcher, or unknown.
+type OpcodeNode struct {
+	base
+	Name      string // Name of the opcode. Like "fetch".
+	Argument  any    // Value passed to the handler of the opcode. Like "score".
+	Arguments []Node // Nodes evaluated and pushed on the stack before the opcode runs.
+}
+
 // VariableDeclaratorNode represents a variable declaration.
 type VariableDeclaratorNode struct {
 	base
@@ -34,6 +34,9 @@ func (n *StringNode) String() string {
 }
 
 func (n *ConstantNode) String() string {
+	if n.Literal != "" {
+		return n.Literal
+	}
 	if n.Value == nil {
 		return "nil"
 	}
@@ -49,30 +52,50 @@ func (n *UnaryNode) String() string {
 	if n.Operator == "not" {
 		op = fmt.Sprintf("%s ", n.Operator)
 	}
-	wrap := false
-	switch b := n.Node.(type) {
-	case *BinaryNode:
-		if operator.Binary[b.Operator].Precedence <
-			operator.Unary[n.Operator].Precedence {
-			wrap = true
-		}
-	case *ConditionalNode:
-		wrap = true
-	}
-	if wrap {
+	if n.wrap() {
 		return fmt.Sprintf("%s(%s)", op, n.Node.String())
 	}
 	return fmt.Sprintf("%s%s", op, n.Node.String())
 }
 
+// wrap reports whether the operand must be wrapped in parentheses.
+func (n *UnaryNode) wrap() bool {
+	switch b := n.Node.(type) {
+	case *BinaryNode:
+		return operator.Binary[b.Operator].Precedence <
+			operator.Unary[n.Operator].Precedence
+	case *ConditionalNode, *SwitchNode:
+		return true
+	}
+	return false
+}
+
 func (n *BinaryNode) String() string {
 	if n.Operator == ".." {
 		return fmt.Sprintf("%s..%s", n.Left, n.Right)
 	}
 
 	var lhs, rhs string
-	var lwrap, rwrap bool
+	lwrap, rwrap := n.wrap()
+
+	if lwrap {
+		lhs = fmt.Sprintf("(%s)", n.Left.String())
+	} else {
+		lhs = n.Left.String()
+	}
 
+	if rwrap {
+		rhs = fmt.Sprintf("(%s)", n.Right.String())
+	} else {
+		rhs = n.Right.String()
+	}
+
+	return fmt.Sprintf("%s %s %s", lhs, n.Operator, rhs)
+}
+
+// wrap reports whether the left and the right operands must be wrapped in
+// parentheses.
+func (n *BinaryNode) wrap() (lwrap, rwrap bool) {
 	if l, ok := n.Left.(*UnaryNode); ok {
 		if operator.Unary[l.Operator].Precedence <
 			operator.Binary[n.Operator].Precedence {
@@ -109,26 +132,13 @@ func (n *BinaryNode) String() string {
 		}
 	}
 
-	if _, ok := n.Left.(*ConditionalNode); ok {
+	if isConditional(n.Left) {
 		lwrap = true
 	}
-	if _, ok := n.Right.(*ConditionalNode); ok {
+	if isConditional(n.Right) {
 		rwrap = true
 	}
-
-	if lwrap {
-		lhs = fmt.Sprintf("(%s)", n.Left.String())
-	} else {
-		lhs = n.Left.String()
-	}
-
-	if rwrap {
-		rhs = fmt.Sprintf("(%s)", n.Right.String())
-	} else {
-		rhs = n.Right.String()
-	}
-
-	return fmt.Sprintf("%s %s %s", lhs, n.Operator, rhs)
+	return lwrap, rwrap
 }
 
 func (n *ChainNode) String() string {
@@ -175,6 +185,9 @@ func (n *CallNode) String() string {
 	for i, arg := range n.Arguments {
 		arguments[i] = arg.String()
 	}
+	if _, ok := n.Callee.(*FunctionNode); ok {
+		return fmt.Sprintf("(%s)(%s)", n.Callee.String(), strings.Join(arguments, ", "))
+	}
 	return fmt.Sprintf("%s(%s)", n.Callee.String(), strings.Join(arguments, ", "))
 }
 
@@ -186,14 +199,43 @@ func (n *BuiltinNode) String() string {
 	return fmt.Sprintf("%s(%s)", n.Name, strings.Join(arguments, ", "))
 }
 
+func (n *OpcodeNode) String() string {
+	arguments := make([]string, 0, len(n.Arguments)+1)
+	for _, arg := range n.operands() {
+		arguments = append(arguments, arg.String())
+	}
+	return fmt.Sprintf("%s(%s)", n.Name, strings.Join(arguments, ", "))
+}
+
+// operands returns the nodes printed as arguments of the opcode: its
+// argument, if any, then the nodes pushed on the stack.
+func (n *OpcodeNode) operands() []Node {
+	if n.Argument == nil {
+		return n.Arguments
+	}
+	return append([]Node{&ConstantNode{Value: n.Argument}}, n.Arguments...)
+}
+
 func (n *PredicateNode) String() string {
 	return n.Node.String()
 }
 
+func (n *FunctionNode) String() string {
+	switch n.Node.(type) {
+	case *SequenceNode, *VariableDeclaratorNode:
+		return fmt.Sprintf("(%s) => { %s }", strings.Join(n.Params, ", "), n.Node.String())
+	}
+	return fmt.Sprintf("(%s) => %s", strings.Join(n.Params, ", "), n.Node.String())
+}
+
 func (n *PointerNode) String() string {
 	return fmt.Sprintf("#%s", n.Name)
 }
 
+func (n *PlaceholderNode) String() string {
+	return fmt.Sprintf(":%s", n.Name)
+}
+
 func (n *VariableDeclaratorNode) String() string {
 	return fmt.Sprintf("let %s = %s; %s", n.Name, n.Value.String(), n.Expr.String())
 }
@@ -208,17 +250,17 @@ func (n *SequenceNode) String() string {
 
 func (n *ConditionalNode) String() string {
 	var cond, exp1, exp2 string
-	if _, ok := n.Cond.(*ConditionalNode); ok {
+	if isConditional(n.Cond) {
 		cond = fmt.Sprintf("(%s)", n.Cond.String())
 	} else {
 		cond = n.Cond.String()
 	}
-	if _, ok := n.Exp1.(*ConditionalNode); ok {
+	if isConditional(n.Exp1) {
 		exp1 = fmt.Sprintf("(%s)", n.Exp1.String())
 	} else {
 		exp1 = n.Exp1.String()
 	}
-	if _, ok := n.Exp2.(*ConditionalNode); ok {
+	if isConditional(n.Exp2) {
 		exp2 = fmt.Sprintf("(%s)", n.Exp2.String())
 	} else {
 		exp2 = n.Exp2.String()
@@ -226,6 +268,41 @@ func (n *ConditionalNode) String() string {
 	return fmt.Sprintf("%s ? %s : %s", cond, exp1, exp2)
 }
 
+// isConditional reports whether the node is printed as a ternary operator.
+func isConditional(node Node) bool {
+	switch node.(type) {
+	case *ConditionalNode, *SwitchNode:
+		return true
+	}
+	return false
+}
+
+func (n *SwitchNode) String() string {
+	return n.conditional().String()
+}
+
+// conditional returns the chain of conditionals the switch stands for.
+func (n *SwitchNode) conditional() Node {
+	node := n.Default
+	for i := len(n.Cases) - 1; i >= 0; i-- {
+		var value Node
+		switch c := n.Cases[i].(type) {
+		case int:
+			value = &IntegerNode{Value: c}
+		case string:
+			value = &StringNode{Value: c}
+		default:
+			value = &ConstantNode{Value: c}
+		}
+		node = &ConditionalNode{
+			Cond: &BinaryNode{Operator: "==", Left: n.Node, Right: value},
+			Exp1: n.Branches[i],
+			Exp2: node,
+		}
+	}
+	return node
+}
+
 func (n *ArrayNode) String() string {
 	nodes := make([]string, len(n.Nodes))
 	for i, node := range n.Nodes {
@@ -60,6 +60,8 @@ func TestPrint(t *testing.T) {
 		{`{"a": b, 'c': d}`, `{a: b, c: d}`},
 		{`{"a": b, c: d}`, `{a: b, c: d}`},
 		{`{"a": b, 8: 8}`, `{a: b, "8": 8}`},
+		{`{"if": a.let, in: b}`, `{if: a.let, in: b}`},
+		{`a > :min and :tags[0] in b`, `a > :min and :tags[0] in b`},
 		{`{"9": 9, '8': 8, "foo": d}`, `{"9": 9, "8": 8, foo: d}`},
 		{`[]`, `[]`},
 		{`[a]`, `[a]`},
@@ -68,6 +70,10 @@ func TestPrint(t *testing.T) {
 		{`map(a, # > 0)`, `map(a, # > 0)`},
 		{`map(a, {# > 0})`, `map(a, # > 0)`},
 		{`map(a, .b)`, `map(a, .b)`},
+		{`let f = (x, y) => x + y; f(1, 2)`, `let f = (x, y) => x + y; f(1, 2)`},
+		{`let f = x => { let y = x; y }; f(1)`, `let f = (x) => { let y = x; y }; f(1)`},
+		{`f(1)(2)`, `f(1)(2)`},
+		{`((x) => x + 1)(2)`, `((x) => x + 1)(2)`},
 		{`a.b()`, `a.b()`},
 		{`a.b(c)`, `a.b(c)`},
 		{`a[1:-1]`, `a[1:-1]`},
@@ -130,3 +136,16 @@ func TestPrint_ConstantNode(t *testing.T) {
 		})
 	}
 }
+
+func TestPrint_SwitchNode(t *testing.T) {
+	node := &ast.SwitchNode{
+		Node:     &ast.IdentifierNode{Value: "x"},
+		Cases:    []any{"a", "b"},
+		Branches: []ast.Node{&ast.IntegerNode{Value: 1}, &ast.IntegerNode{Value: 2}},
+		Default:  &ast.IntegerNode{Value: 3},
+	}
+	require.Equal(t, `x == "a" ? 1 : (x == "b" ? 2 : 3)`, node.String())
+
+	sum := &ast.BinaryNode{Operator: "+", Left: node, Right: &ast.IntegerNode{Value: 1}}
+	require.Equal(t, `(x == "a" ? 1 : (x == "b" ? 2 : 3)) + 1`, sum.String())
+}
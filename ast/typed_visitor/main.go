@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strings"
+	"text/template"
+)
+
+// Node kinds are read from node.go, so a new node type can not be missed by
+// TypedVisitor: regenerating adds a method every implementation must define.
+func main() {
+	f, err := parser.ParseFile(token.NewFileSet(), "node.go", nil, 0)
+	if err != nil {
+		panic(err)
+	}
+
+	data := struct {
+		Interface string
+		Base      string
+		Dispatch  string
+	}{}
+
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			typ := spec.(*ast.TypeSpec)
+			if _, ok := typ.Type.(*ast.StructType); !ok || !strings.HasSuffix(typ.Name.Name, "Node") {
+				continue
+			}
+			name := typ.Name.Name
+			method := "On" + strings.TrimSuffix(name, "Node")
+			data.Interface += fmt.Sprintf("%v(node *%v)\n", method, name)
+			data.Base += fmt.Sprintf("func (BaseTypedVisitor) %v(*%v) {}\n", method, name)
+			data.Dispatch += fmt.Sprintf("case *%v:\nv.%v(n)\n", name, method)
+		}
+	}
+
+	var b bytes.Buffer
+	err = template.Must(
+		template.New("typed_visitor").
+			Parse(source),
+	).Execute(&b, data)
+	if err != nil {
+		panic(err)
+	}
+
+	formatted, err := format.Source(b.Bytes())
+	if err != nil {
+		panic(err)
+	}
+	fmt.Print(string(formatted))
+}
+
+const source = `// Code generated by ast/typed_visitor/main.go. DO NOT EDIT.
+
+package ast
+
+import "fmt"
+
+// TypedVisitor has a callback per node kind. Implementations which define
+// all callbacks fail to compile when a new node kind is added; embed
+// BaseTypedVisitor to handle only some kinds.
+type TypedVisitor interface {
+	{{ .Interface }}
+}
+
+// BaseTypedVisitor implements TypedVisitor with callbacks doing nothing.
+type BaseTypedVisitor struct{}
+
+{{ .Base }}
+
+// Dispatch calls the callback of v for the kind of node.
+func Dispatch(node Node, v TypedVisitor) {
+	switch n := node.(type) {
+	{{ .Dispatch }}
+	default:
+		panic(fmt.Sprintf("undefined node type (%T)", node))
+	}
+}
+`
@@ -0,0 +1,128 @@
+// Code generated by ast/typed_visitor/main.go. DO NOT EDIT.
+
+package ast
+
+import "fmt"
+
+// TypedVisitor has a callback per node kind. Implementations which define
+// all callbacks fail to compile when a new node kind is added; embed
+// BaseTypedVisitor to handle only some kinds.
+type TypedVisitor interface {
+	OnNil(node *NilNode)
+	OnIdentifier(node *IdentifierNode)
+	OnInteger(node *IntegerNode)
+	OnFloat(node *FloatNode)
+	OnBool(node *BoolNode)
+	OnString(node *StringNode)
+	OnConstant(node *ConstantNode)
+	OnUnary(node *UnaryNode)
+	OnBinary(node *BinaryNode)
+	OnChain(node *ChainNode)
+	OnMember(node *MemberNode)
+	OnSlice(node *SliceNode)
+	OnCall(node *CallNode)
+	OnBuiltin(node *BuiltinNode)
+	OnPredicate(node *PredicateNode)
+	OnFunction(node *FunctionNode)
+	OnPointer(node *PointerNode)
+	OnPlaceholder(node *PlaceholderNode)
+	OnConditional(node *ConditionalNode)
+	OnSwitch(node *SwitchNode)
+	OnOpcode(node *OpcodeNode)
+	OnVariableDeclarator(node *VariableDeclaratorNode)
+	OnSequence(node *SequenceNode)
+	OnArray(node *ArrayNode)
+	OnMap(node *MapNode)
+	OnPair(node *PairNode)
+}
+
+// BaseTypedVisitor implements TypedVisitor with callbacks doing nothing.
+type BaseTypedVisitor struct{}
+
+func (BaseTypedVisitor) OnNil(*NilNode)                               {}
+func (BaseTypedVisitor) OnIdentifier(*IdentifierNode)                 {}
+func (BaseTypedVisitor) OnInteger(*IntegerNode)                       {}
+func (BaseTypedVisitor) OnFloat(*FloatNode)                           {}
+func (BaseTypedVisitor) OnBool(*BoolNode)                             {}
+func (BaseTypedVisitor) OnString(*StringNode)                         {}
+func (BaseTypedVisitor) OnConstant(*ConstantNode)                     {}
+func (BaseTypedVisitor) OnUnary(*UnaryNode)                           {}
+func (BaseTypedVisitor) OnBinary(*BinaryNode)                         {}
+func (BaseTypedVisitor) OnChain(*ChainNode)                           {}
+func (BaseTypedVisitor) OnMember(*MemberNode)                         {}
+func (BaseTypedVisitor) OnSlice(*SliceNode)                           {}
+func (BaseTypedVisitor) OnCall(*CallNode)                             {}
+func (BaseTypedVisitor) OnBuiltin(*BuiltinNode)                       {}
+func (BaseTypedVisitor) OnPredicate(*PredicateNode)                   {}
+func (BaseTypedVisitor) OnFunction(*FunctionNode)                     {}
+func (BaseTypedVisitor) OnPointer(*PointerNode)                       {}
+func (BaseTypedVisitor) OnPlaceholder(*PlaceholderNode)               {}
+func (BaseTypedVisitor) OnConditional(*ConditionalNode)               {}
+func (BaseTypedVisitor) OnSwitch(*SwitchNode)                         {}
+func (BaseTypedVisitor) OnOpcode(*OpcodeNode)                         {}
+func (BaseTypedVisitor) OnVariableDeclarator(*VariableDeclaratorNode) {}
+func (BaseTypedVisitor) OnSequence(*SequenceNode)                     {}
+func (BaseTypedVisitor) OnArray(*ArrayNode)                           {}
+func (BaseTypedVisitor) OnMap(*MapNode)                               {}
+func (BaseTypedVisitor) OnPair(*PairNode)                             {}
+
+// Dispatch calls the callback of v for the kind of node.
+func Dispatch(node Node, v TypedVisitor) {
+	switch n := node.(type) {
+	case *NilNode:
+		v.OnNil(n)
+	case *IdentifierNode:
+		v.OnIdentifier(n)
+	case *IntegerNode:
+		v.OnInteger(n)
+	case *FloatNode:
+		v.OnFloat(n)
+	case *BoolNode:
+		v.OnBool(n)
+	case *StringNode:
+		v.OnString(n)
+	case *ConstantNode:
+		v.OnConstant(n)
+	case *UnaryNode:
+		v.OnUnary(n)
+	case *BinaryNode:
+		v.OnBinary(n)
+	case *ChainNode:
+		v.OnChain(n)
+	case *MemberNode:
+		v.OnMember(n)
+	case *SliceNode:
+		v.OnSlice(n)
+	case *CallNode:
+		v.OnCall(n)
+	case *BuiltinNode:
+		v.OnBuiltin(n)
+	case *PredicateNode:
+		v.OnPredicate(n)
+	case *FunctionNode:
+		v.OnFunction(n)
+	case *PointerNode:
+		v.OnPointer(n)
+	case *PlaceholderNode:
+		v.OnPlaceholder(n)
+	case *ConditionalNode:
+		v.OnConditional(n)
+	case *SwitchNode:
+		v.OnSwitch(n)
+	case *OpcodeNode:
+		v.OnOpcode(n)
+	case *VariableDeclaratorNode:
+		v.OnVariableDeclarator(n)
+	case *SequenceNode:
+		v.OnSequence(n)
+	case *ArrayNode:
+		v.OnArray(n)
+	case *MapNode:
+		v.OnMap(n)
+	case *PairNode:
+		v.OnPair(n)
+
+	default:
+		panic(fmt.Sprintf("undefined node type (%T)", node))
+	}
+}
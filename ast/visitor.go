@@ -1,5 +1,7 @@
 package ast
 
+//go:generate sh -c "go run ./typed_visitor > ./typed_visitor[generated].go"
+
 import "fmt"
 
 type Visitor interface {
@@ -47,7 +49,10 @@ func Walk(node *Node, v Visitor) {
 		}
 	case *PredicateNode:
 		Walk(&n.Node, v)
+	case *FunctionNode:
+		Walk(&n.Node, v)
 	case *PointerNode:
+	case *PlaceholderNode:
 	case *VariableDeclaratorNode:
 		Walk(&n.Value, v)
 		Walk(&n.Expr, v)
@@ -59,6 +64,16 @@ func Walk(node *Node, v Visitor) {
 		Walk(&n.Cond, v)
 		Walk(&n.Exp1, v)
 		Walk(&n.Exp2, v)
+	case *SwitchNode:
+		Walk(&n.Node, v)
+		for i := range n.Branches {
+			Walk(&n.Branches[i], v)
+		}
+		Walk(&n.Default, v)
+	case *OpcodeNode:
+		for i := range n.Arguments {
+			Walk(&n.Arguments[i], v)
+		}
 	case *ArrayNode:
 		for i := range n.Nodes {
 			Walk(&n.Nodes[i], v)
@@ -76,3 +91,17 @@ func Walk(node *Node, v Visitor) {
 
 	v.Visit(node)
 }
+
+// WalkTyped walks the tree like Walk, calling the callback of v for the kind
+// of every node, children first.
+func WalkTyped(node *Node, v TypedVisitor) {
+	Walk(node, typedVisitor{v})
+}
+
+type typedVisitor struct {
+	v TypedVisitor
+}
+
+func (t typedVisitor) Visit(node *Node) {
+	Dispatch(*node, t.v)
+}
@@ -52,3 +52,52 @@ func TestWalk_patch(t *testing.T) {
 	assert.IsType(t, &ast.NilNode{}, node.(*ast.BinaryNode).Left)
 	assert.IsType(t, &ast.NilNode{}, node.(*ast.BinaryNode).Right)
 }
+
+type callCounter struct {
+	ast.BaseTypedVisitor
+	calls    []string
+	builtins []string
+}
+
+func (c *callCounter) OnCall(node *ast.CallNode) {
+	c.calls = append(c.calls, node.Callee.String())
+}
+
+func (c *callCounter) OnBuiltin(node *ast.BuiltinNode) {
+	c.builtins = append(c.builtins, node.Name)
+}
+
+func TestWalkTyped(t *testing.T) {
+	var node ast.Node = &ast.SequenceNode{
+		Nodes: []ast.Node{
+			&ast.CallNode{
+				Callee:    &ast.IdentifierNode{Value: "foo"},
+				Arguments: []ast.Node{&ast.BuiltinNode{Name: "len", Arguments: []ast.Node{&ast.StringNode{Value: "a"}}}},
+			},
+			&ast.VariableDeclaratorNode{
+				Name:  "x",
+				Value: &ast.CallNode{Callee: &ast.IdentifierNode{Value: "bar"}},
+				Expr:  &ast.PredicateNode{Node: &ast.BuiltinNode{Name: "now"}},
+			},
+		},
+	}
+
+	c := &callCounter{}
+	ast.WalkTyped(&node, c)
+	assert.Equal(t, []string{"foo", "bar"}, c.calls)
+	assert.Equal(t, []string{"len", "now"}, c.builtins)
+}
+
+func TestDispatch_all_nodes(t *testing.T) {
+	nodes := []ast.Node{
+		&ast.NilNode{}, &ast.IdentifierNode{}, &ast.IntegerNode{}, &ast.FloatNode{},
+		&ast.BoolNode{}, &ast.StringNode{}, &ast.ConstantNode{}, &ast.UnaryNode{},
+		&ast.BinaryNode{}, &ast.ChainNode{}, &ast.MemberNode{}, &ast.SliceNode{},
+		&ast.CallNode{}, &ast.BuiltinNode{}, &ast.PredicateNode{}, &ast.PointerNode{},
+		&ast.ConditionalNode{}, &ast.VariableDeclaratorNode{}, &ast.SequenceNode{},
+		&ast.ArrayNode{}, &ast.MapNode{}, &ast.PairNode{},
+	}
+	for _, node := range nodes {
+		assert.NotPanics(t, func() { ast.Dispatch(node, ast.BaseTypedVisitor{}) })
+	}
+}
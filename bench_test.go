@@ -547,3 +547,56 @@ func Benchmark_reduce(b *testing.B) {
 
 	require.Equal(b, 5050, out.(int))
 }
+
+type benchUser struct {
+	Name  string
+	Age   int
+	Admin bool
+}
+
+func (u benchUser) Title() string    { return "Dr. " + u.Name }
+func (u benchUser) IsAdult() bool    { return u.Age >= 18 }
+func (u *benchUser) IsAdmin() bool   { return u.Admin }
+func (u benchUser) Initials() string { return u.Name[:1] }
+
+func Benchmark_fetchStructs(b *testing.B) {
+	users := make([]any, 100)
+	for i := range users {
+		users[i] = benchUser{Name: "Bob", Age: i, Admin: i%10 == 0}
+	}
+	env := map[string]any{"users": users}
+
+	// Without expr.Env the types are unknown, so fields and methods are
+	// fetched by name at runtime.
+	program, err := expr.Compile(`count(users, .Age > 20 && .IsAdult() && .IsAdmin() && .Title() != "")`)
+	require.NoError(b, err)
+
+	var out any
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		out, err = vm.Run(program, env)
+	}
+	b.StopTimer()
+
+	require.NoError(b, err)
+	require.Equal(b, 7, out)
+}
+
+func Benchmark_nestedLoops_reuseVm(b *testing.B) {
+	env := map[string]any{"Rows": [][]int{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}, {10, 11, 12}}}
+
+	program, err := expr.Compile(`count(Rows, any(#, all(1..3, # > 0) && # % 5 == 0))`, expr.Env(env))
+	require.NoError(b, err)
+
+	var out any
+	v := vm.VM{}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		out, err = v.Run(program, env)
+	}
+	b.StopTimer()
+
+	require.NoError(b, err)
+	require.Equal(b, 2, out)
+}
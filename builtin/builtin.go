@@ -1,9 +1,13 @@
 package builtin
 
 import (
-	"encoding/base64"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash/crc32"
+	"net/url"
 	"reflect"
 	"sort"
 	"strings"
@@ -18,6 +22,16 @@ var (
 	Names []string
 )
 
+// Regexps are the builtins which take a regexp pattern as the second
+// argument. Patterns given as string literals are checked and compiled
+// when the expression is compiled, and the builtins get *regexp.Regexp, or
+// *runtime.Regexp with conf.Config.Regexps, as they get all patterns then.
+var Regexps = map[string]bool{
+	"matchGroups":  true,
+	"replaceRegex": true,
+	"splitRegex":   true,
+}
+
 func init() {
 	Index = make(map[string]int)
 	Names = make([]string, len(Builtins))
@@ -103,6 +117,26 @@ var Builtins = []*Function{
 		Predicate: true,
 		Types:     types(new(func([]any, func(any, any) any, any) any)),
 	},
+	{
+		Name:      "uniqBy",
+		Predicate: true,
+		Types:     types(new(func([]any, func(any) any) []any)),
+	},
+	{
+		Name:      "partition",
+		Predicate: true,
+		Types:     types(new(func([]any, func(any) bool) []any)),
+	},
+	{
+		Name:      "takeWhile",
+		Predicate: true,
+		Types:     types(new(func([]any, func(any) bool) []any)),
+	},
+	{
+		Name:      "dropWhile",
+		Predicate: true,
+		Types:     types(new(func([]any, func(any) bool) []any)),
+	},
 	{
 		Name: "len",
 		Fast: Len,
@@ -129,6 +163,9 @@ var Builtins = []*Function{
 			if len(args) != 1 {
 				return anyType, fmt.Errorf("invalid number of arguments (expected 1, got %d)", len(args))
 			}
+			if isDecimal(args[0]) {
+				return decimalType, nil
+			}
 			switch kind(args[0]) {
 			case reflect.Float32, reflect.Float64, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Interface:
 				return args[0], nil
@@ -164,6 +201,9 @@ var Builtins = []*Function{
 			if len(args) != 1 {
 				return anyType, fmt.Errorf("invalid number of arguments (expected 1, got %d)", len(args))
 			}
+			if isDecimal(args[0]) {
+				return integerType, nil
+			}
 			switch kind(args[0]) {
 			case reflect.Interface:
 				return integerType, nil
@@ -182,6 +222,9 @@ var Builtins = []*Function{
 			if len(args) != 1 {
 				return anyType, fmt.Errorf("invalid number of arguments (expected 1, got %d)", len(args))
 			}
+			if isDecimal(args[0]) {
+				return floatType, nil
+			}
 			switch kind(args[0]) {
 			case reflect.Interface:
 				return floatType, nil
@@ -193,11 +236,33 @@ var Builtins = []*Function{
 			return anyType, fmt.Errorf("invalid argument for float (type %s)", args[0])
 		},
 	},
+	{
+		Name: "tryInt",
+		Fast: TryInt,
+		Validate: func(args []reflect.Type) (reflect.Type, error) {
+			return validateTry("tryInt", args)
+		},
+	},
+	{
+		Name: "tryFloat",
+		Fast: TryFloat,
+		Validate: func(args []reflect.Type) (reflect.Type, error) {
+			return validateTry("tryFloat", args)
+		},
+	},
 	{
 		Name:  "string",
 		Fast:  String,
 		Types: types(new(func(any any) string)),
 	},
+	{
+		Name: "bytes",
+		Safe: func(args ...any) (any, uint, error) {
+			b := []byte(args[0].(string))
+			return b, uint(len(b)), nil
+		},
+		Types: types(new(func(string) []byte)),
+	},
 	{
 		Name: "trim",
 		Func: func(args ...any) (any, error) {
@@ -209,6 +274,9 @@ var Builtins = []*Function{
 				return nil, fmt.Errorf("invalid number of arguments for trim (expected 1 or 2, got %d)", len(args))
 			}
 		},
+		Fast2: func(a, b any) any {
+			return strings.Trim(a.(string), b.(string))
+		},
 		Types: types(
 			strings.TrimSpace,
 			strings.Trim,
@@ -223,6 +291,9 @@ var Builtins = []*Function{
 			}
 			return strings.TrimPrefix(args[0].(string), s), nil
 		},
+		Fast2: func(a, b any) any {
+			return strings.TrimPrefix(a.(string), b.(string))
+		},
 		Types: types(
 			strings.TrimPrefix,
 			new(func(string) string),
@@ -237,6 +308,9 @@ var Builtins = []*Function{
 			}
 			return strings.TrimSuffix(args[0].(string), s), nil
 		},
+		Fast2: func(a, b any) any {
+			return strings.TrimSuffix(a.(string), b.(string))
+		},
 		Types: types(
 			strings.TrimSuffix,
 			new(func(string) string),
@@ -267,6 +341,12 @@ var Builtins = []*Function{
 				return nil, fmt.Errorf("invalid number of arguments for split (expected 2 or 3, got %d)", len(args))
 			}
 		},
+		Fast2: func(a, b any) any {
+			return strings.Split(a.(string), b.(string))
+		},
+		Fast3: func(a, b, c any) any {
+			return strings.SplitN(a.(string), b.(string), runtime.ToInt(c))
+		},
 		Types: types(
 			strings.Split,
 			strings.SplitN,
@@ -283,6 +363,12 @@ var Builtins = []*Function{
 				return nil, fmt.Errorf("invalid number of arguments for splitAfter (expected 2 or 3, got %d)", len(args))
 			}
 		},
+		Fast2: func(a, b any) any {
+			return strings.SplitAfter(a.(string), b.(string))
+		},
+		Fast3: func(a, b, c any) any {
+			return strings.SplitAfterN(a.(string), b.(string), runtime.ToInt(c))
+		},
 		Types: types(
 			strings.SplitAfter,
 			strings.SplitAfterN,
@@ -299,6 +385,9 @@ var Builtins = []*Function{
 				return nil, fmt.Errorf("invalid number of arguments for replace (expected 3 or 4, got %d)", len(args))
 			}
 		},
+		Fast3: func(a, b, c any) any {
+			return strings.ReplaceAll(a.(string), b.(string), c.(string))
+		},
 		Types: types(
 			strings.Replace,
 			strings.ReplaceAll,
@@ -319,6 +408,151 @@ var Builtins = []*Function{
 		},
 		Types: types(strings.Repeat),
 	},
+	{
+		Name: "truncate",
+		Func: func(args ...any) (any, error) {
+			if len(args) < 2 || len(args) > 4 {
+				return nil, fmt.Errorf("invalid number of arguments for truncate (expected 2 to 4, got %d)", len(args))
+			}
+			n, err := toInt(args[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid argument for truncate (%v)", err)
+			}
+			if n < 0 {
+				return nil, fmt.Errorf("invalid argument for truncate (expected positive integer, got %d)", n)
+			}
+			suffix := "…"
+			if len(args) >= 3 {
+				suffix = args[2].(string)
+			}
+			words := len(args) == 4 && args[3].(bool)
+			return truncate(args[0].(string), n, suffix, words), nil
+		},
+		Types: types(
+			new(func(string, int) string),
+			new(func(string, int, string) string),
+			new(func(string, int, string, bool) string),
+		),
+	},
+	{
+		Name:  "padStart",
+		Safe:  padding("padStart", true),
+		Types: types(new(func(string, int) string), new(func(string, int, string) string)),
+	},
+	{
+		Name:  "padEnd",
+		Safe:  padding("padEnd", false),
+		Types: types(new(func(string, int) string), new(func(string, int, string) string)),
+	},
+	{
+		Name: "title",
+		Fast: func(arg any) any {
+			return title(arg.(string))
+		},
+		Types: types(new(func(string) string)),
+	},
+	{
+		Name: "slugify",
+		Fast: func(arg any) any {
+			return slugify(arg.(string))
+		},
+		Types: types(new(func(string) string)),
+	},
+	{
+		Name: "format",
+		Safe: func(args ...any) (any, uint, error) {
+			s := fmt.Sprintf(args[0].(string), args[1:]...)
+			return s, uint(len(s)), nil
+		},
+		Validate: func(args []reflect.Type) (reflect.Type, error) {
+			if len(args) == 0 {
+				return anyType, fmt.Errorf("invalid number of arguments (expected at least 1, got 0)")
+			}
+			switch kind(args[0]) {
+			case reflect.String, reflect.Interface:
+				return stringType, nil
+			default:
+				return anyType, fmt.Errorf("invalid format for format (expected string, got %s)", args[0])
+			}
+		},
+	},
+	{
+		Name: "weightedChoice",
+		Func: func(args ...any) (any, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("invalid number of arguments for weightedChoice (expected 2, got %d)", len(args))
+			}
+			seed, ok := args[1].(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid argument for weightedChoice (expected string seed, got %T)", args[1])
+			}
+			return weightedChoice(args[0], seed)
+		},
+		Validate: func(args []reflect.Type) (reflect.Type, error) {
+			if len(args) != 2 {
+				return anyType, fmt.Errorf("invalid number of arguments (expected 2, got %d)", len(args))
+			}
+			switch kind(args[0]) {
+			case reflect.Interface:
+			case reflect.Map:
+				switch kind(args[0].Key()) {
+				case reflect.String, reflect.Interface:
+				default:
+					return anyType, fmt.Errorf("invalid weights for weightedChoice (expected map with string keys, got %s)", args[0])
+				}
+				switch kind(args[0].Elem()) {
+				case reflect.Interface, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+				default:
+					return anyType, fmt.Errorf("invalid weights for weightedChoice (expected map with number values, got %s)", args[0])
+				}
+			default:
+				return anyType, fmt.Errorf("invalid weights for weightedChoice (expected map, got %s)", args[0])
+			}
+			switch kind(args[1]) {
+			case reflect.String, reflect.Interface:
+			default:
+				return anyType, fmt.Errorf("invalid seed for weightedChoice (expected string, got %s)", args[1])
+			}
+			return stringType, nil
+		},
+	},
+	{
+		Name: "isEmail",
+		Func: func(args ...any) (any, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("invalid number of arguments for isEmail (expected 1, got %d)", len(args))
+			}
+			return isEmail(args[0].(string)), nil
+		},
+		Types: types(new(func(string) bool)),
+	},
+	{
+		Name: "isURL",
+		Func: func(args ...any) (any, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("invalid number of arguments for isURL (expected 1, got %d)", len(args))
+			}
+			return isURL(args[0].(string)), nil
+		},
+		Types: types(new(func(string) bool)),
+	},
+	{
+		Name: "isPhone",
+		Func: func(args ...any) (any, error) {
+			if len(args) < 1 || len(args) > 2 {
+				return nil, fmt.Errorf("invalid number of arguments for isPhone (expected 1 or 2, got %d)", len(args))
+			}
+			region := ""
+			if len(args) == 2 {
+				region = args[1].(string)
+			}
+			return isPhone(args[0].(string), region)
+		},
+		Types: types(
+			new(func(string) bool),
+			new(func(string, string) bool),
+		),
+	},
 	{
 		Name: "join",
 		Func: func(args ...any) (any, error) {
@@ -351,6 +585,9 @@ var Builtins = []*Function{
 		Func: func(args ...any) (any, error) {
 			return strings.Index(args[0].(string), args[1].(string)), nil
 		},
+		Fast2: func(a, b any) any {
+			return strings.Index(a.(string), b.(string))
+		},
 		Types: types(strings.Index),
 	},
 	{
@@ -358,6 +595,9 @@ var Builtins = []*Function{
 		Func: func(args ...any) (any, error) {
 			return strings.LastIndex(args[0].(string), args[1].(string)), nil
 		},
+		Fast2: func(a, b any) any {
+			return strings.LastIndex(a.(string), b.(string))
+		},
 		Types: types(strings.LastIndex),
 	},
 	{
@@ -365,6 +605,9 @@ var Builtins = []*Function{
 		Func: func(args ...any) (any, error) {
 			return strings.HasPrefix(args[0].(string), args[1].(string)), nil
 		},
+		Fast2: func(a, b any) any {
+			return strings.HasPrefix(a.(string), b.(string))
+		},
 		Types: types(strings.HasPrefix),
 	},
 	{
@@ -372,8 +615,53 @@ var Builtins = []*Function{
 		Func: func(args ...any) (any, error) {
 			return strings.HasSuffix(args[0].(string), args[1].(string)), nil
 		},
+		Fast2: func(a, b any) any {
+			return strings.HasSuffix(a.(string), b.(string))
+		},
 		Types: types(strings.HasSuffix),
 	},
+	{
+		Name: "matchGroups",
+		Func: func(args ...any) (any, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("invalid number of arguments for matchGroups (expected 2, got %d)", len(args))
+			}
+			re, err := regexpOf(args[1], args[0].(string))
+			if err != nil {
+				return nil, err
+			}
+			return matchGroups(args[0].(string), re), nil
+		},
+		Types: types(new(func(string, string) map[string]any)),
+	},
+	{
+		Name: "replaceRegex",
+		Func: func(args ...any) (any, error) {
+			if len(args) != 3 {
+				return nil, fmt.Errorf("invalid number of arguments for replaceRegex (expected 3, got %d)", len(args))
+			}
+			re, err := regexpOf(args[1], args[0].(string))
+			if err != nil {
+				return nil, err
+			}
+			return re.ReplaceAllString(args[0].(string), args[2].(string)), nil
+		},
+		Types: types(new(func(string, string, string) string)),
+	},
+	{
+		Name: "splitRegex",
+		Func: func(args ...any) (any, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("invalid number of arguments for splitRegex (expected 2, got %d)", len(args))
+			}
+			re, err := regexpOf(args[1], args[0].(string))
+			if err != nil {
+				return nil, err
+			}
+			return re.Split(args[0].(string), -1), nil
+		},
+		Types: types(new(func(string, string) []string)),
+	},
 	{
 		Name: "max",
 		Func: func(args ...any) (any, error) {
@@ -430,42 +718,108 @@ var Builtins = []*Function{
 	},
 	{
 		Name: "toJSON",
-		Func: func(args ...any) (any, error) {
+		Safe: func(args ...any) (any, uint, error) {
 			b, err := json.MarshalIndent(args[0], "", "  ")
 			if err != nil {
-				return nil, err
+				return nil, 0, err
 			}
-			return string(b), nil
+			return string(b), uint(len(b)), nil
 		},
 		Types: types(new(func(any) string)),
 	},
 	{
 		Name: "fromJSON",
-		Func: func(args ...any) (any, error) {
+		Safe: func(args ...any) (any, uint, error) {
 			var v any
 			err := json.Unmarshal([]byte(args[0].(string)), &v)
 			if err != nil {
-				return nil, err
+				return nil, 0, err
 			}
-			return v, nil
+			return v, jsonSize(v), nil
 		},
 		Types: types(new(func(string) any)),
 	},
 	{
-		Name: "toBase64",
-		Func: func(args ...any) (any, error) {
-			return base64.StdEncoding.EncodeToString([]byte(args[0].(string))), nil
+		Name:  "toBase64",
+		Func:  toBase64,
+		Types: types(new(func(string) string), new(func([]byte) string)),
+	},
+	{
+		Name:  "fromBase64",
+		Func:  fromBase64,
+		Types: types(new(func(string) string)),
+	},
+	{
+		Name: "toHex",
+		Fast: func(arg any) any {
+			if b, ok := arg.([]byte); ok {
+				return hex.EncodeToString(b)
+			}
+			return hex.EncodeToString([]byte(arg.(string)))
+		},
+		Types: types(new(func(string) string), new(func([]byte) string)),
+	},
+	{
+		Name: "fromHex",
+		Fast: func(arg any) any {
+			b, err := hex.DecodeString(arg.(string))
+			if err != nil {
+				panic(fmt.Sprintf("invalid argument for fromHex (%v)", err))
+			}
+			return b
+		},
+		Types: types(new(func(string) []byte)),
+	},
+	{
+		Name: "sha256",
+		Fast: func(arg any) any {
+			sum := sha256.Sum256([]byte(arg.(string)))
+			return hex.EncodeToString(sum[:])
 		},
 		Types: types(new(func(string) string)),
 	},
 	{
-		Name: "fromBase64",
-		Func: func(args ...any) (any, error) {
-			b, err := base64.StdEncoding.DecodeString(args[0].(string))
+		Name: "md5",
+		Fast: func(arg any) any {
+			sum := md5.Sum([]byte(arg.(string)))
+			return hex.EncodeToString(sum[:])
+		},
+		Types: types(new(func(string) string)),
+	},
+	{
+		Name: "crc32",
+		Fast: func(arg any) any {
+			return int(crc32.ChecksumIEEE([]byte(arg.(string))))
+		},
+		Types: types(new(func(string) int)),
+	},
+	{
+		// Alias of toBase64.
+		Name:  "base64",
+		Func:  toBase64,
+		Types: types(new(func(string) string), new(func([]byte) string)),
+	},
+	{
+		// Alias of fromBase64.
+		Name:  "base64decode",
+		Func:  fromBase64,
+		Types: types(new(func(string) string)),
+	},
+	{
+		Name: "urlEncode",
+		Fast: func(arg any) any {
+			return url.QueryEscape(arg.(string))
+		},
+		Types: types(url.QueryEscape),
+	},
+	{
+		Name: "urlDecode",
+		Fast: func(arg any) any {
+			s, err := url.QueryUnescape(arg.(string))
 			if err != nil {
-				return nil, err
+				panic(fmt.Sprintf("invalid argument for urlDecode (%v)", err))
 			}
-			return string(b), nil
+			return s
 		},
 		Types: types(new(func(string) string)),
 	},
@@ -515,77 +869,32 @@ var Builtins = []*Function{
 		Types: types(time.ParseDuration),
 	},
 	{
-		Name: "date",
-		Func: func(args ...any) (any, error) {
-			tz, ok := args[0].(*time.Location)
-			if ok {
-				args = args[1:]
-			}
-
-			date := args[0].(string)
-			if len(args) == 2 {
-				layout := args[1].(string)
-				if tz != nil {
-					return time.ParseInLocation(layout, date, tz)
-				}
-				return time.Parse(layout, date)
-			}
-			if len(args) == 3 {
-				layout := args[1].(string)
-				timeZone := args[2].(string)
-				tz, err := time.LoadLocation(timeZone)
-				if err != nil {
-					return nil, err
-				}
-				t, err := time.ParseInLocation(layout, date, tz)
-				if err != nil {
-					return nil, err
-				}
-				return t, nil
-			}
-
-			layouts := []string{
-				"2006-01-02",
-				"15:04:05",
-				"2006-01-02 15:04:05",
-				time.RFC3339,
-				time.RFC822,
-				time.RFC850,
-				time.RFC1123,
-			}
-			for _, layout := range layouts {
-				if tz == nil {
-					t, err := time.Parse(layout, date)
-					if err == nil {
-						return t, nil
-					}
-				} else {
-					t, err := time.ParseInLocation(layout, date, tz)
-					if err == nil {
-						return t, nil
-					}
+		Name:     "date",
+		Func:     Date,
+		Validate: validateDate,
+		Deref:    derefDate,
+	},
+	{
+		Name: "tryDate",
+		Func: func(args ...any) (out any, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					out, err = nil, nil
 				}
+			}()
+			t, err := Date(args...)
+			if err != nil {
+				return nil, nil
 			}
-			return nil, fmt.Errorf("invalid date %s", date)
+			return t, nil
 		},
 		Validate: func(args []reflect.Type) (reflect.Type, error) {
-			if len(args) < 1 {
-				return anyType, fmt.Errorf("invalid number of arguments (expected at least 1, got %d)", len(args))
-			}
-			if args[0] != nil && args[0].AssignableTo(locationType) {
-				args = args[1:]
+			if _, err := validateDate(args); err != nil {
+				return anyType, err
 			}
-			if len(args) > 3 {
-				return anyType, fmt.Errorf("invalid number of arguments (expected at most 3, got %d)", len(args))
-			}
-			return timeType, nil
-		},
-		Deref: func(i int, arg reflect.Type) bool {
-			if arg.AssignableTo(locationType) {
-				return false
-			}
-			return true
+			return anyType, nil
 		},
+		Deref: derefDate,
 	},
 	{
 		Name: "timezone",
@@ -648,6 +957,32 @@ var Builtins = []*Function{
 		Name: "get",
 		Func: get,
 	},
+	{
+		Name: "equalDeep",
+		Func: func(args ...any) (any, error) {
+			return runtime.EqualDeep(args[0], args[1]), nil
+		},
+		Fast2: func(a, b any) any {
+			return runtime.EqualDeep(a, b)
+		},
+		Types: types(new(func(any, any) bool)),
+	},
+	{
+		// The compiler passes the env as a hidden first argument.
+		Name: "envKeys",
+		Func: func(args ...any) (any, error) {
+			return EnvKeys(args[0]), nil
+		},
+		Types: types(new(func() []string)),
+	},
+	{
+		Name: "envHas",
+		Func: func(args ...any) (any, error) {
+			name, _ := args[1].(string)
+			return EnvHas(args[0], name), nil
+		},
+		Types: types(new(func(string) bool)),
+	},
 	{
 		Name: "take",
 		Func: func(args ...any) (any, error) {
@@ -687,6 +1022,45 @@ var Builtins = []*Function{
 			return args[0], nil
 		},
 	},
+	{
+		Name: "drop",
+		Func: func(args ...any) (any, error) {
+			if len(args) != 2 {
+				return nil, fmt.Errorf("invalid number of arguments (expected 2, got %d)", len(args))
+			}
+			v := reflect.ValueOf(args[0])
+			if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+				return nil, fmt.Errorf("cannot drop from %s", v.Kind())
+			}
+			n := reflect.ValueOf(args[1])
+			if !n.CanInt() {
+				return nil, fmt.Errorf("cannot drop %s elements", n.Kind())
+			}
+			from := 0
+			if n.Int() > int64(v.Len()) {
+				from = v.Len()
+			} else if n.Int() > 0 {
+				from = int(n.Int())
+			}
+			return v.Slice(from, v.Len()).Interface(), nil
+		},
+		Validate: func(args []reflect.Type) (reflect.Type, error) {
+			if len(args) != 2 {
+				return anyType, fmt.Errorf("invalid number of arguments (expected 2, got %d)", len(args))
+			}
+			switch kind(args[0]) {
+			case reflect.Interface, reflect.Slice, reflect.Array:
+			default:
+				return anyType, fmt.Errorf("cannot drop from %s", args[0])
+			}
+			switch kind(args[1]) {
+			case reflect.Interface, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			default:
+				return anyType, fmt.Errorf("cannot drop %s elements", args[1])
+			}
+			return args[0], nil
+		},
+	},
 	{
 		Name: "keys",
 		Func: func(args ...any) (any, error) {
@@ -818,6 +1192,10 @@ var Builtins = []*Function{
 				return nil, 0, fmt.Errorf("invalid number of arguments (expected 1, got %d)", len(args))
 			}
 
+			if s, ok := args[0].(string); ok {
+				return reverseString(s), uint(len(s)), nil
+			}
+
 			v := reflect.ValueOf(args[0])
 			if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
 				return nil, 0, fmt.Errorf("cannot reverse %s", v.Kind())
@@ -838,6 +1216,8 @@ var Builtins = []*Function{
 				return anyType, fmt.Errorf("invalid number of arguments (expected 1, got %d)", len(args))
 			}
 			switch kind(args[0]) {
+			case reflect.String:
+				return stringType, nil
 			case reflect.Interface, reflect.Slice, reflect.Array:
 				return arrayType, nil
 			default:
@@ -943,30 +1323,112 @@ var Builtins = []*Function{
 		Name: "flatten",
 		Safe: func(args ...any) (any, uint, error) {
 			var size uint
-			if len(args) != 1 {
-				return nil, 0, fmt.Errorf("invalid number of arguments (expected 1, got %d)", len(args))
+			if len(args) != 1 && len(args) != 2 {
+				return nil, 0, fmt.Errorf("invalid number of arguments (expected 1 or 2, got %d)", len(args))
 			}
 			v := reflect.ValueOf(args[0])
 			if v.Kind() != reflect.Array && v.Kind() != reflect.Slice {
 				return nil, size, fmt.Errorf("cannot flatten %s", v.Kind())
 			}
-			ret := flatten(v)
+			depth := -1
+			if len(args) == 2 {
+				d := reflect.ValueOf(args[1])
+				if !d.CanInt() {
+					return nil, size, fmt.Errorf("cannot use %s as depth", d.Kind())
+				}
+				if d.Int() < 0 {
+					return nil, size, fmt.Errorf("depth must not be negative (got %d)", d.Int())
+				}
+				depth = int(d.Int())
+			}
+			ret := flatten(v, depth)
 			size = uint(len(ret))
 			return ret, size, nil
 		},
 		Validate: func(args []reflect.Type) (reflect.Type, error) {
-			if len(args) != 1 {
-				return anyType, fmt.Errorf("invalid number of arguments (expected 1, got %d)", len(args))
+			if len(args) != 1 && len(args) != 2 {
+				return anyType, fmt.Errorf("invalid number of arguments (expected 1 or 2, got %d)", len(args))
 			}
 
+			switch kind(args[0]) {
+			case reflect.Interface, reflect.Slice, reflect.Array:
+			default:
+				return anyType, fmt.Errorf("cannot flatten %s", args[0])
+			}
+			if len(args) == 2 {
+				switch kind(args[1]) {
+				case reflect.Interface, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				default:
+					return anyType, fmt.Errorf("cannot use %s as depth", args[1])
+				}
+			}
+
+			return arrayType, nil
+		},
+	},
+	{
+		Name: "zip",
+		Safe: func(args ...any) (any, uint, error) {
+			if len(args) != 2 {
+				return nil, 0, fmt.Errorf("invalid number of arguments (expected 2, got %d)", len(args))
+			}
+			a, b := reflect.ValueOf(args[0]), reflect.ValueOf(args[1])
+			for _, v := range []reflect.Value{a, b} {
+				if v.Kind() != reflect.Array && v.Kind() != reflect.Slice {
+					return nil, 0, fmt.Errorf("cannot zip %s", v.Kind())
+				}
+			}
+			ret := zip(a, b)
+			return ret, uint(3 * len(ret)), nil
+		},
+		Validate: func(args []reflect.Type) (reflect.Type, error) {
+			if len(args) != 2 {
+				return anyType, fmt.Errorf("invalid number of arguments (expected 2, got %d)", len(args))
+			}
 			for _, arg := range args {
 				switch kind(arg) {
 				case reflect.Interface, reflect.Slice, reflect.Array:
 				default:
-					return anyType, fmt.Errorf("cannot flatten %s", arg)
+					return anyType, fmt.Errorf("cannot zip %s", arg)
 				}
 			}
-
+			return arrayType, nil
+		},
+	},
+	{
+		Name: "chunk",
+		Safe: func(args ...any) (any, uint, error) {
+			if len(args) != 2 {
+				return nil, 0, fmt.Errorf("invalid number of arguments (expected 2, got %d)", len(args))
+			}
+			v := reflect.ValueOf(args[0])
+			if v.Kind() != reflect.Array && v.Kind() != reflect.Slice {
+				return nil, 0, fmt.Errorf("cannot chunk %s", v.Kind())
+			}
+			n := reflect.ValueOf(args[1])
+			if !n.CanInt() {
+				return nil, 0, fmt.Errorf("cannot use %s as chunk size", n.Kind())
+			}
+			if n.Int() <= 0 {
+				return nil, 0, fmt.Errorf("chunk size must be positive (got %d)", n.Int())
+			}
+			ret := chunk(v, int(n.Int()))
+			return ret, uint(len(ret) + v.Len()), nil
+		},
+		Validate: func(args []reflect.Type) (reflect.Type, error) {
+			if len(args) != 2 {
+				return anyType, fmt.Errorf("invalid number of arguments (expected 2, got %d)", len(args))
+			}
+			switch kind(args[0]) {
+			case reflect.Interface, reflect.Slice, reflect.Array:
+			default:
+				return anyType, fmt.Errorf("cannot chunk %s", args[0])
+			}
+			switch kind(args[1]) {
+			case reflect.Interface, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			default:
+				return anyType, fmt.Errorf("cannot use %s as chunk size", args[1])
+			}
 			return arrayType, nil
 		},
 	},
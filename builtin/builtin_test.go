@@ -3,6 +3,7 @@ package builtin_test
 import (
 	"fmt"
 	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -51,6 +52,13 @@ func TestBuiltin(t *testing.T) {
 		{`float(5)`, 5.0},
 		{`float(5.5)`, 5.5},
 		{`float("5.5")`, 5.5},
+		{`tryInt("5")`, 5},
+		{`tryInt(5.5)`, 5},
+		{`tryInt("abc")`, nil},
+		{`tryInt(nil) ?? -1`, -1},
+		{`tryInt(ArrayOfAny[1]) ?? 0`, 2},
+		{`tryFloat("5.5")`, 5.5},
+		{`tryFloat("5,5") ?? 0.0`, 0.0},
 		{`string(5)`, "5"},
 		{`string(5.5)`, "5.5"},
 		{`string("5.5")`, "5.5"},
@@ -67,6 +75,35 @@ func TestBuiltin(t *testing.T) {
 		{`replace("foo,bar,baz", ",", ";")`, "foo;bar;baz"},
 		{`replace("foo,bar,baz,goo", ",", ";", 2)`, "foo;bar;baz,goo"},
 		{`repeat("foo", 3)`, "foofoofoo"},
+		{`truncate("hello", 10)`, "hello"},
+		{`truncate("hello world", 8)`, "hello w…"},
+		{`truncate("hello world", 8, "...")`, "hello..."},
+		{`truncate("héllo wörld", 7, "")`, "héllo w"},
+		{`truncate("hello brave world", 14, "…", true)`, "hello brave…"},
+		{`truncate("hello brave world", 12, "…", true)`, "hello brave…"},
+		{`truncate("supercalifragilistic", 6, "…", true)`, "super…"},
+		{`truncate("hello", 2, "...")`, ".."},
+		{`weightedChoice({"a": 1}, "user-1")`, "a"},
+		{`weightedChoice({"a": 0, "b": 0.5}, "user-1")`, "b"},
+		{`weightedChoice({"a": 7, "b": 3}, "user-1") == weightedChoice({"b": 3, "a": 7}, "user-1")`, true},
+		{`isEmail("user.name+tag@example.co.uk")`, true},
+		{`isEmail("user@localhost")`, false},
+		{`isEmail("John <john@example.com>")`, false},
+		{`isEmail("user@-example.com")`, false},
+		{`isEmail("not an email")`, false},
+		{`isURL("https://example.com/path?q=1")`, true},
+		{`isURL("ftp://files.example.com")`, true},
+		{`isURL("example.com")`, false},
+		{`isURL("https://exa mple.com")`, false},
+		{`isPhone("+44 20 7946 0958")`, true},
+		{`isPhone("020 7946 0958")`, false},
+		{`isPhone("020 7946 0958", "GB")`, true},
+		{`isPhone("+44 20 7946 0958", "gb")`, true},
+		{`isPhone("+1 (415) 555-2671", "US")`, true},
+		{`isPhone("(415) 555-2671", "US")`, true},
+		{`isPhone("415-555-267", "US")`, false},
+		{`isPhone("+33 1 23 45 67 89", "US")`, false},
+		{`isPhone("+1 415 555 2671 ext 1", "US")`, false},
 		{`join(ArrayOfString, ",")`, "foo,bar,baz"},
 		{`join(ArrayOfString)`, "foobarbaz"},
 		{`join(["foo", "bar", "baz"], ",")`, "foo,bar,baz"},
@@ -107,8 +144,35 @@ func TestBuiltin(t *testing.T) {
 		{`median(1..5, 4.9)`, 3.5},
 		{`toJSON({foo: 1, bar: 2})`, "{\n  \"bar\": 2,\n  \"foo\": 1\n}"},
 		{`fromJSON("[1, 2, 3]")`, []any{1.0, 2.0, 3.0}},
+		{`fromJSON('{"a": [1, 2]}').a[1]`, 2.0},
+		{`fromJSON(toJSON(ArrayOfString))[2]`, "baz"},
 		{`toBase64("hello")`, "aGVsbG8="},
 		{`fromBase64("aGVsbG8=")`, "hello"},
+		{`padStart("5", 3, "0")`, "005"},
+		{`padStart("ab", 5)`, "   ab"},
+		{`padEnd("ab", 5, "xy")`, "abxyx"},
+		{`padEnd("héllo", 3)`, "héllo"},
+		{`reverse("héllo")`, "olléh"},
+		{`title("hello wORLD, it's 3d")`, "Hello WORLD, It's 3d"},
+		{`slugify("  Hello, World! Ça va? ")`, "hello-world-ça-va"},
+		{`format("%s-%03d", "a", 7)`, "a-007"},
+		{`format("%5.*f%%", 2, 3.14159)`, " 3.14%"},
+		{`format("%[1]s %[1]s", "a")`, "a a"},
+		{`bytes("hi")`, []byte("hi")},
+		{`string(b"hi")`, "hi"},
+		{`toHex(b"\xff\x00")`, "ff00"},
+		{`toHex("hi")`, "6869"},
+		{`fromHex("ff00")`, []byte{0xff, 0x00}},
+		{`toBase64(hex"ff00")`, "/wA="},
+		{`type(b"")`, "bytes"},
+		{`sha256("hello")`, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{`md5("hello")`, "5d41402abc4b2a76b9719d911017c592"},
+		{`crc32("hello")`, 907060870},
+		{`crc32(ArrayOfString[0]) % 100 < 100`, true},
+		{`base64("hello")`, "aGVsbG8="},
+		{`base64decode("aGVsbG8=")`, "hello"},
+		{`urlEncode("a b&c=d/é")`, "a+b%26c%3Dd%2F%C3%A9"},
+		{`urlDecode("a+b%26c%3Dd%2F%C3%A9")`, "a b&c=d/é"},
 		{`now().Format("2006-01-02T15:04Z")`, time.Now().Format("2006-01-02T15:04Z")},
 		{`duration("1h")`, time.Hour},
 		{`date("2006-01-02T15:04:05Z")`, time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
@@ -116,6 +180,10 @@ func TestBuiltin(t *testing.T) {
 		{`date("2023-04-23T00:30:00.000+0100", "2006-01-02T15:04:05-0700", "America/Chicago").Format("2006-01-02")`, "2023-04-23"},
 		{`date("2023-04-23T00:30:00", "2006-01-02T15:04:05", "America/Chicago").Format("2006-01-02")`, "2023-04-23"},
 		{`date("2023-04-23", "2006-01-02", "America/Chicago").Format("2006-01-02")`, "2023-04-23"},
+		{`tryDate("2006-01-02T15:04:05Z")`, time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)},
+		{`tryDate("error")`, nil},
+		{`tryDate(ArrayOfAny[0]) ?? "none"`, "none"},
+		{`tryDate("2023-04-23", "2006-01-02", "Nowhere/City")`, nil},
 		{`timezone("UTC").String()`, "UTC"},
 		{`timezone("Europe/Moscow").String()`, "Europe/Moscow"},
 		{`first(ArrayOfString)`, "foo"},
@@ -155,8 +223,48 @@ func TestBuiltin(t *testing.T) {
 		{`flatten([["a", "b"], [1, 2]])`, []any{"a", "b", 1, 2}},
 		{`flatten([["a", "b"], [1, 2, [3, 4]]])`, []any{"a", "b", 1, 2, 3, 4}},
 		{`flatten([["a", "b"], [1, 2, [3, [[[["c", "d"], "e"]]], 4]]])`, []any{"a", "b", 1, 2, 3, "c", "d", "e", 4}},
+		{`flatten([1, [2, [3, [4]]]], 1)`, []any{1, 2, []any{3, []any{4}}}},
+		{`flatten([1, [2, [3, [4]]]], 2)`, []any{1, 2, 3, []any{4}}},
+		{`flatten([1, [2]], 0)`, []any{1, []any{2}}},
+		{`zip([1, 2, 3], ["a", "b"])`, []any{[]any{1, "a"}, []any{2, "b"}}},
+		{`zip([], [1])`, []any{}},
+		{`chunk([1, 2, 3, 4, 5], 2)`, []any{[]any{1, 2}, []any{3, 4}, []any{5}}},
+		{`chunk([1, 2], 5)`, []any{[]any{1, 2}}},
+		{`chunk([], 2)`, []any{}},
+		{`uniqBy([1, 2, 3, 4, 5], # % 3)`, []any{1, 2, 3}},
+		{`uniqBy(["a", "B", "A", "b"], lower(#))`, []any{"a", "B"}},
+		{`partition([1, 2, 3, 4, 5], # % 2 == 0)`, []any{[]any{2, 4}, []any{1, 3, 5}}},
+		{`partition([], # > 0)`, []any{[]any{}, []any{}}},
+		{`drop(ArrayOfString, 2)`, []string{"baz"}},
+		{`drop(ArrayOfString, 99)`, []string{}},
+		{`takeWhile([1, 2, 3, 1], # < 3)`, []any{1, 2}},
+		{`takeWhile([2, "a"], # < 2)`, []any{}},
+		{`dropWhile([1, 2, 3, 1], # < 3)`, []any{3, 1}},
+		{`dropWhile([0, 2, "a"], # < 1)`, []any{2, "a"}},
+		{`dropWhile([], # < 1)`, []any{}},
+		{`min(ArrayOfFoo, len(.Value))`, 1},
+		{`max(ArrayOfInt, # * 2)`, 6},
+		{`ArrayOfInt | max(-#)`, -1},
+		{`mean(ArrayOfInt, # * 2)`, 4.0},
+		{`mean([], #)`, 0.0},
+		{`median(ArrayOfInt, (x) => x * 2)`, 4.0},
+		{`min([], #)`, nil},
+		{`map(ArrayOfInt, max(2, #))`, []any{2, 2, 3}},
+		{`matchGroups("2024-05", "(?P<year>\\d+)-(\\d+)")`, map[string]any{"0": "2024-05", "1": "2024", "year": "2024", "2": "05"}},
+		{`matchGroups("x", "\\d")`, map[string]any(nil)},
+		{`replaceRegex("a1b22", "[0-9]+", "<$0>")`, "a<1>b<22>"},
+		{`replaceRegex("John Smith", "(\\w+) (\\w+)", "$2 $1")`, "Smith John"},
+		{`splitRegex("a, b;c", "[,;] *")`, []string{"a", "b", "c"}},
+		{`splitRegex(ArrayOfString[0], ArrayOfString[1])`, []string{"foo"}},
 		{`uniq([1, 15, "a", 2, 3, 5, 2, "a", 2, "b"])`, []any{1, 15, "a", 2, 3, 5, "b"}},
 		{`uniq([[1, 2], "a", 2, 3, [1, 2], [1, 3]])`, []any{[]any{1, 2}, "a", 2, 3, []any{1, 3}}},
+		{`equalDeep(ArrayOfInt, [1, 2, 3])`, true},
+		{`equalDeep(ArrayOfInt, [1.0, 2.0, 3.0])`, true},
+		{`equalDeep(ArrayOfInt, "123")`, false},
+		{`equalDeep({"a": [1, {"b": 2}]}, {"a": [1, {"b": 2.0}]})`, true},
+		{`equalDeep({"a": 1}, {"b": 1})`, false},
+		{`equalDeep(ArrayOfFoo[0], ArrayOfFoo[0])`, true},
+		{`equalDeep(ArrayOfFoo[0], ArrayOfFoo[1])`, false},
 	}
 
 	for _, test := range tests {
@@ -175,10 +283,14 @@ func TestBuiltin_works_with_any(t *testing.T) {
 	config := map[string]struct {
 		arity int
 	}{
-		"now":    {0},
-		"get":    {2},
-		"take":   {2},
-		"sortBy": {2},
+		"now":            {0},
+		"get":            {2},
+		"take":           {2},
+		"drop":           {2},
+		"sortBy":         {2},
+		"weightedChoice": {2},
+		"zip":            {2},
+		"chunk":          {2},
 	}
 
 	for _, b := range builtin.Builtins {
@@ -229,6 +341,13 @@ func TestBuiltin_errors(t *testing.T) {
 		{`mean("s", 1..9)`, "invalid argument for mean (type string)"},
 		{`duration("error")`, `invalid duration`},
 		{`date("error")`, `invalid date`},
+		{`base64decode("a!")`, `illegal base64 data at input byte 1`},
+		{`urlDecode("%zz")`, `invalid argument for urlDecode (invalid URL escape "%zz")`},
+		{`padStart("a", 2000000)`, `memory budget exceeded`},
+		{`format("%s-%d", "a")`, `invalid number of arguments for format "%s-%d" (expected 2, got 1) (1:1)`},
+		{`format(1)`, `invalid format for format (expected string, got int) (1:1)`},
+		{`fromHex("zz")`, `invalid argument for fromHex (encoding/hex: invalid byte: U+007A 'z')`},
+		{`crc32(42)`, `cannot use int as argument (type string) to call crc32  (1:7)`},
 		{`get()`, `invalid number of arguments (expected 2, got 0)`},
 		{`get(1, 2)`, `type int does not support indexing`},
 		{`bitnot("1")`, "cannot use string as argument (type int) to call bitnot  (1:8)"},
@@ -241,8 +360,32 @@ func TestBuiltin_errors(t *testing.T) {
 		{`now(nil)`, "invalid number of arguments (expected 0, got 1)"},
 		{`date(nil)`, "interface {} is nil, not string (1:1)"},
 		{`timezone(nil)`, "cannot use nil as argument (type string) to call timezone (1:10)"},
-		{`flatten([1, 2], [3, 4])`, "invalid number of arguments (expected 1, got 2)"},
+		{`flatten([1, 2], 1, 2)`, "invalid number of arguments (expected 1 or 2, got 3)"},
+		{`flatten([1, 2], [3, 4])`, "cannot use []interface {} as depth"},
+		{`flatten([1, 2], -1)`, "depth must not be negative (got -1)"},
+		{`zip([1], 2)`, "cannot zip int"},
+		{`chunk([1], 0)`, "chunk size must be positive (got 0)"},
+		{`chunk(1, 2)`, "cannot chunk int"},
+		{`partition([1, 2], #)`, "predicate should return boolean (got int)"},
+		{`takeWhile([1, 2], #)`, "predicate should return boolean (got int)"},
+		{`min(["a"], #)`, "predicate should return number (got string)"},
+		{`mean(1, #)`, "builtin mean takes only array (got int)"},
+		{`drop(1, 2)`, "cannot drop from int"},
 		{`flatten(1)`, "cannot flatten int"},
+		{`truncate("foo", -1)`, "invalid argument for truncate (expected positive integer, got -1)"},
+		{`truncate("foo")`, "not enough arguments to call truncate"},
+		{`isPhone("020 7946 0958", "XX")`, `unknown phone region "XX"`},
+		{`fromJSON("{")`, "invalid JSON: unexpected end of JSON input (1:10)"},
+		{`fromJSON("[" + "1")`, "unexpected end of JSON input"},
+		{`toJSON(1, 2)`, "too many arguments to call toJSON"},
+		{`matchGroups("a", "(")`, "error parsing regexp: missing closing ): `(` (1:18)"},
+		{`replaceRegex("a", "[", "")`, "error parsing regexp: missing closing ]: `[` (1:19)"},
+		{`splitRegex("a", "a" + "(")`, "error parsing regexp: missing closing ): `a(`"},
+		{`weightedChoice([1, 2], "seed")`, "invalid weights for weightedChoice (expected map, got []interface {})"},
+		{`weightedChoice({"a": 1}, 42)`, "invalid seed for weightedChoice (expected string, got int)"},
+		{`weightedChoice({"a": -1, "b": 2}, "seed")`, `invalid weight of "a" for weightedChoice (-1)`},
+		{`weightedChoice({"a": "x"}, "seed")`, `invalid weight of "a" for weightedChoice (expected number, got string)`},
+		{`weightedChoice({"a": 0}, "seed")`, "invalid weights for weightedChoice (total weight must be positive)"},
 	}
 	for _, test := range errorTests {
 		t.Run(test.input, func(t *testing.T) {
@@ -259,6 +402,90 @@ func TestBuiltin_errors(t *testing.T) {
 	}
 }
 
+func TestBuiltin_regexp_constants(t *testing.T) {
+	program, err := expr.Compile(`matchGroups(s, "a+") != nil && s matches "a+" && replaceRegex(s, "a+", "") + splitRegex(s, "b")[0] == "baa"`, expr.Env(map[string]any{"s": ""}))
+	require.NoError(t, err)
+
+	var patterns []string
+	for _, c := range program.Constants {
+		if re, ok := c.(*regexp.Regexp); ok {
+			patterns = append(patterns, re.String())
+		}
+	}
+	assert.Equal(t, []string{"a+", "b"}, patterns)
+
+	out, err := expr.Run(program, map[string]any{"s": "aab"})
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+}
+
+func TestBuiltin_env(t *testing.T) {
+	t.Run("map", func(t *testing.T) {
+		program, err := expr.Compile(`envHas("Tax") ? Tax : 0`, expr.Env(map[string]any{"Tax": 0}))
+		require.NoError(t, err)
+
+		out, err := expr.Run(program, map[string]any{"Tax": 5})
+		require.NoError(t, err)
+		assert.Equal(t, 5, out)
+
+		out, err = expr.Run(program, map[string]any{})
+		require.NoError(t, err)
+		assert.Equal(t, 0, out)
+
+		out, err = expr.Eval(`envKeys()`, map[string]any{"b": 1, "a": 2})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, out)
+	})
+
+	t.Run("struct", func(t *testing.T) {
+		type Base struct {
+			ID string
+		}
+		type Env struct {
+			Base
+			Name   string `expr:"name"`
+			hidden int
+		}
+		for _, optimize := range []bool{true, false} {
+			program, err := expr.Compile(`[envKeys(), envHas("name"), envHas("Name"), envHas("hidden")]`,
+				expr.Env(Env{}), expr.Optimize(optimize))
+			require.NoError(t, err)
+
+			out, err := expr.Run(program, Env{})
+			require.NoError(t, err)
+			assert.Equal(t, []any{[]string{"Base", "ID", "name"}, true, false, false}, out)
+		}
+	})
+
+	t.Run("types", func(t *testing.T) {
+		tree, err := checker.ParseCheck(`envKeys()`, conf.New(map[string]any{}))
+		require.NoError(t, err)
+		assert.Equal(t, reflect.TypeOf([]string{}), tree.Node.Type())
+
+		_, err = expr.Compile(`envHas(1)`)
+		require.Error(t, err)
+	})
+}
+
+func TestBuiltin_weightedChoice(t *testing.T) {
+	program, err := expr.Compile(`weightedChoice(weights, user)`, expr.Env(map[string]any{
+		"weights": map[string]float64{},
+		"user":    "",
+	}))
+	require.NoError(t, err)
+
+	weights := map[string]float64{"a": 0.7, "b": 0.2, "c": 0.1}
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		out, err := expr.Run(program, map[string]any{"weights": weights, "user": fmt.Sprintf("user-%d", i)})
+		require.NoError(t, err)
+		counts[out.(string)]++
+	}
+	assert.InDelta(t, 7000, counts["a"], 300)
+	assert.InDelta(t, 2000, counts["b"], 300)
+	assert.InDelta(t, 1000, counts["c"], 300)
+}
+
 func TestBuiltin_types(t *testing.T) {
 	env := map[string]any{
 		"num":           42,
@@ -280,6 +507,10 @@ func TestBuiltin_types(t *testing.T) {
 		{`get($env, 'str')`, reflect.String},
 		{`get($env, 'num')`, reflect.Int},
 		{`get($env, 'ArrayOfString')`, reflect.Slice},
+		{`fromJSON('{"a": 1}')`, reflect.Map},
+		{`fromJSON("[1, 2]")`, reflect.Slice},
+		{`fromJSON("1.5")`, reflect.Float64},
+		{`fromJSON(str)`, reflect.Interface},
 	}
 
 	for _, test := range tests {
@@ -486,6 +717,45 @@ func TestBuiltin_EnableBuiltin(t *testing.T) {
 	})
 }
 
+func TestBuiltin_BuiltinProfile(t *testing.T) {
+	for name, names := range builtin.Profiles {
+		for _, b := range names {
+			_, ok := builtin.Index[b]
+			assert.True(t, ok, "builtin %v of profile %v does not exist", b, name)
+		}
+	}
+
+	tests := []struct {
+		input   string
+		options []expr.Option
+		err     string
+	}{
+		{`sum(filter([1, 2, 3], # > 1))`, []expr.Option{expr.BuiltinProfile("minimal")}, ""},
+		{`upper("a")`, []expr.Option{expr.BuiltinProfile("minimal")}, "builtin upper is not allowed"},
+		{`upper("a")`, []expr.Option{expr.BuiltinProfile("strings")}, ""},
+		{`type(1)`, []expr.Option{expr.BuiltinProfile("strings")}, "builtin type is not allowed"},
+		{`get({a: 1}, "a")`, []expr.Option{expr.BuiltinProfile("strings")}, "builtin get is not allowed"},
+		{`now()`, []expr.Option{expr.BuiltinProfile("minimal"), expr.EnableBuiltin("now")}, ""},
+		{`all([1], # > 0)`, []expr.Option{expr.BuiltinProfile("minimal"), expr.DisableBuiltin("all")}, "builtin all is not allowed"},
+		{`type(get({a: 1}, "a"))`, []expr.Option{expr.BuiltinProfile("minimal"), expr.BuiltinProfile("full")}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := expr.Compile(tt.input, tt.options...)
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+
+	assert.Panics(t, func() {
+		_, _ = expr.Compile(`1`, expr.BuiltinProfile("unknown"))
+	})
+}
+
 func TestBuiltin_type(t *testing.T) {
 	type Foo struct{}
 	var b any = 1
@@ -559,11 +829,16 @@ func TestBuiltin_reverse(t *testing.T) {
 }
 
 func TestBuiltin_sort(t *testing.T) {
+	type User struct {
+		First, Last string
+	}
 	env := map[string]any{
 		"ArrayOfString": []string{"foo", "bar", "baz"},
 		"ArrayOfInt":    []int{3, 2, 1},
 		"ArrayOfFloat":  []float64{3.0, 2.0, 1.0},
 		"ArrayOfFoo":    []mock.Foo{{Value: "c"}, {Value: "a"}, {Value: "b"}},
+		"Users":         []User{{"Bob", "Bell"}, {"Cid", "Ames"}, {"Ann", "Bell"}},
+		"Compare":       strings.Compare,
 	}
 	tests := []struct {
 		input string
@@ -575,6 +850,17 @@ func TestBuiltin_sort(t *testing.T) {
 		{`sort(ArrayOfInt, 'desc')`, []any{3, 2, 1}},
 		{`sortBy(ArrayOfFoo, .Value)`, []any{mock.Foo{Value: "a"}, mock.Foo{Value: "b"}, mock.Foo{Value: "c"}}},
 		{`sortBy([{id: "a"}, {id: "b"}], .id, "desc")`, []any{map[string]any{"id": "b"}, map[string]any{"id": "a"}}},
+		{`sortBy(Users, [.Last, .First])`, []any{User{"Cid", "Ames"}, User{"Ann", "Bell"}, User{"Bob", "Bell"}}},
+		{`sortBy(Users, [.Last, .First], "desc")`, []any{User{"Bob", "Bell"}, User{"Ann", "Bell"}, User{"Cid", "Ames"}}},
+		{`sortBy(Users, [.Last, .First], ["asc", "desc"])`, []any{User{"Cid", "Ames"}, User{"Bob", "Bell"}, User{"Ann", "Bell"}}},
+		{`sort(ArrayOfInt, (a, b) => a - b)`, []any{1, 2, 3}},
+		{`sort(ArrayOfFloat, (a, b) => b - a)`, []any{3.0, 2.0, 1.0}},
+		{`sort(Users, (a, b) => len(a.First) - len(b.First))`, []any{User{"Bob", "Bell"}, User{"Cid", "Ames"}, User{"Ann", "Bell"}}},
+		{`sort(Users, (a, b) => a.Last > b.Last ? 1 : a.Last < b.Last ? -1 : 0)`, []any{User{"Cid", "Ames"}, User{"Bob", "Bell"}, User{"Ann", "Bell"}}},
+		{`sort([5, 3, 9, 1, 7, 2, 8], (a, b) => a - b)`, []any{1, 2, 3, 5, 7, 8, 9}},
+		{`sort([], (a, b) => a - b)`, []any{}},
+		{`let desc = (a, b) => b - a; sort([1, 3, 2], desc)`, []any{3, 2, 1}},
+		{`sort(ArrayOfString, Compare)`, []any{"bar", "baz", "foo"}},
 	}
 
 	for _, test := range tests {
@@ -589,6 +875,38 @@ func TestBuiltin_sort(t *testing.T) {
 	}
 }
 
+func TestBuiltin_sort_errors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{`sort([1, 2], (a, b) => a < b)`, "comparator should return number (got bool)"},
+		{`sort([1, 2], (a) => a)`, "comparator should have two params (got 1)"},
+		{`sort(1, (a, b) => a - b)`, "builtin sort takes only array (got int)"},
+		{`sortBy([1, 2], [#, -#], ["asc"])`, "invalid number of orders (expected 2, got 1)"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			_, err := expr.Compile(test.input)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.err)
+		})
+	}
+
+	_, err := expr.Eval(`sortBy([1, 2], [#, -#], orders)`, map[string]any{"orders": []any{"asc"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid number of orders (expected 2, got 1)")
+
+	env := map[string]any{"cmp": func(a, b any) int { return 0 }}
+	program, err := expr.Compile(`sort([1, 2], cmp)`, expr.Env(env))
+	require.NoError(t, err)
+	_, err = expr.Run(program, map[string]any{"cmp": func(a, b any) float64 { return 0 }})
+	require.NoError(t, err)
+	_, err = expr.Run(program, map[string]any{"cmp": func(a, b any) string { return "" }})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "comparator should return number (got string)")
+}
+
 func TestBuiltin_sort_i64(t *testing.T) {
 	env := map[string]any{
 		"array": []int{1, 2, 3},
@@ -690,6 +1008,7 @@ func TestBuiltin_with_deref(t *testing.T) {
 		{`last(arr)`, 3},
 		{`take(arr, 1)`, []int{1}},
 		{`take(arr, x)`, []int{1, 2, 3}},
+		{`drop(arr, 1)`, []int{2, 3}},
 		{`'a' in keys(m)`, true},
 		{`1 in values(m)`, true},
 		{`len(arr)`, 3},
@@ -722,3 +1041,32 @@ func TestBuiltin_with_deref(t *testing.T) {
 		})
 	}
 }
+
+func TestBuiltin_fast_paths(t *testing.T) {
+	env := map[string]any{"s": " a-b-c "}
+	tests := []struct {
+		input string
+		op    string
+		want  any
+	}{
+		{`hasPrefix(s, " a")`, "OpCallBuiltin2", true},
+		{`indexOf(s, "b")`, "OpCallBuiltin2", 3},
+		{`trim(s, " ")`, "OpCallBuiltin2", "a-b-c"},
+		{`split(trim(s), "-")`, "OpCallBuiltin2", []string{"a", "b", "c"}},
+		{`split(trim(s), "-", 2)`, "OpCallBuiltin3", []string{"a", "b-c"}},
+		{`replace(s, "-", "+")`, "OpCallBuiltin3", " a+b+c "},
+		{`replace(s, "-", "+", 1)`, "OpCall", " a+b-c "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			program, err := expr.Compile(test.input, expr.Env(env))
+			require.NoError(t, err)
+			assert.Contains(t, program.Disassemble(), test.op)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, out)
+		})
+	}
+}
@@ -7,12 +7,15 @@ import (
 type Function struct {
 	Name      string                                          // 函数名
 	Fast      func(arg any) any                               // 快速调用版本，假设函数只有一个参数一个返回值，没有错误返回，性能最优。
+	Fast2     func(a, b any) any                              // 两个参数的快速调用版本，仅在调用时恰好传入两个参数时使用。
+	Fast3     func(a, b, c any) any                           // 三个参数的快速调用版本，仅在调用时恰好传入三个参数时使用。
 	Func      func(args ...any) (any, error)                  // 标准调用版本，支持可变参数，返回 (any, error)
 	Safe      func(args ...any) (any, uint, error)            // 安全调用版本，多返回一个 uint（可能代表错误码或执行状态），适合需要额外元信息的场景。
 	Types     []reflect.Type                                  // 类型签名列表，支持函数重载和类型检查，存储备选函数的输入输出类型，比如 func(int, string) bool，就会存成 [int, string, bool]。
 	Validate  func(args []reflect.Type) (reflect.Type, error) // 自定义验证器，用来验证参数类型是否匹配、返回值类型是否正确；输入是参数类型列表，返回函数的返回类型或错误。
 	Deref     func(i int, arg reflect.Type) bool              // 解引用控制，指定哪些参数需要自动解引用；参数 i 是参数索引，arg 是参数类型，返回 true 表示该参数需要解引用。
 	Predicate bool                                            // 标记该函数是否为谓词函数（返回布尔值），常用于过滤/条件判断。
+	Cost      float64                                         // 调用的大致开销（比如纳秒），优化器会把开销大的调用排在 and/or 链的后面；0 表示未知。
 }
 
 func (f *Function) Type() reflect.Type {
@@ -1,13 +1,24 @@
 package builtin
 
 import (
+	"encoding/base64"
 	"fmt"
+	"hash/fnv"
 	"math"
+	"math/big"
+	"net/mail"
+	"net/url"
 	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/expr-lang/expr/internal/deref"
+	"github.com/expr-lang/expr/internal/embedded"
 	"github.com/expr-lang/expr/vm/runtime"
 )
 
@@ -27,6 +38,9 @@ func Type(arg any) any {
 	if arg == nil {
 		return "nil"
 	}
+	if _, ok := arg.([]byte); ok {
+		return "bytes"
+	}
 	v := reflect.ValueOf(arg)
 	if v.Type().Name() != "" && v.Type().PkgPath() != "" {
 		return fmt.Sprintf("%s.%s", v.Type().PkgPath(), v.Type().Name())
@@ -59,6 +73,10 @@ func Type(arg any) any {
 
 func Abs(x any) any {
 	switch x := x.(type) {
+	case *big.Rat:
+		return new(big.Rat).Abs(x)
+	case big.Rat:
+		return new(big.Rat).Abs(&x)
 	case float32:
 		if x < 0 {
 			return -x
@@ -172,6 +190,10 @@ func Round(x any) any {
 }
 
 func Int(x any) any {
+	if d, ok := decimal(x); ok {
+		// Truncated toward zero, like floats.
+		return int(new(big.Int).Quo(d.Num(), d.Denom()).Int64())
+	}
 	switch x := x.(type) {
 	case float32:
 		return int(x)
@@ -213,6 +235,10 @@ func Int(x any) any {
 }
 
 func Float(x any) any {
+	if d, ok := decimal(x); ok {
+		f, _ := d.Float64()
+		return f
+	}
 	switch x := x.(type) {
 	case float32:
 		return float64(x)
@@ -249,10 +275,51 @@ func Float(x any) any {
 	}
 }
 
+// TryInt converts a value to an int like Int, but returns nil instead of
+// failing, like for int("abc"), so a fallback can be given with ??.
+func TryInt(x any) (out any) {
+	defer func() {
+		if r := recover(); r != nil {
+			out = nil
+		}
+	}()
+	return Int(x)
+}
+
+// TryFloat converts a value to a float like Float, but returns nil instead
+// of failing.
+func TryFloat(x any) (out any) {
+	defer func() {
+		if r := recover(); r != nil {
+			out = nil
+		}
+	}()
+	return Float(x)
+}
+
+// String converts a value to a string. Bytes are converted to the string
+// of the bytes, not to the list of their values.
 func String(arg any) any {
+	if b, ok := arg.([]byte); ok {
+		return string(b)
+	}
+	if d, ok := decimal(arg); ok {
+		return runtime.FormatDecimal(d)
+	}
 	return fmt.Sprintf("%v", arg)
 }
 
+// decimal returns x if it is a decimal of the decimal mode.
+func decimal(x any) (*big.Rat, bool) {
+	switch d := x.(type) {
+	case *big.Rat:
+		return d, d != nil
+	case big.Rat:
+		return &d, true
+	}
+	return nil, false
+}
+
 func minMax(name string, fn func(any, any) bool, args ...any) (any, error) {
 	var val any
 	for _, arg := range args {
@@ -355,12 +422,14 @@ func median(args ...any) ([]float64, error) {
 	return values, nil
 }
 
-func flatten(arg reflect.Value) []any {
+// flatten flattens nested arrays up to depth levels, or all levels if
+// depth is negative.
+func flatten(arg reflect.Value, depth int) []any {
 	ret := []any{}
 	for i := 0; i < arg.Len(); i++ {
 		v := deref.Value(arg.Index(i))
-		if v.Kind() == reflect.Array || v.Kind() == reflect.Slice {
-			x := flatten(v)
+		if (v.Kind() == reflect.Array || v.Kind() == reflect.Slice) && depth != 0 {
+			x := flatten(v, depth-1)
 			ret = append(ret, x...)
 		} else {
 			ret = append(ret, v.Interface())
@@ -369,6 +438,34 @@ func flatten(arg reflect.Value) []any {
 	return ret
 }
 
+func zip(a, b reflect.Value) []any {
+	n := a.Len()
+	if b.Len() < n {
+		n = b.Len()
+	}
+	ret := make([]any, n)
+	for i := 0; i < n; i++ {
+		ret[i] = []any{a.Index(i).Interface(), b.Index(i).Interface()}
+	}
+	return ret
+}
+
+func chunk(v reflect.Value, size int) []any {
+	ret := make([]any, 0, (v.Len()+size-1)/size)
+	for i := 0; i < v.Len(); i += size {
+		end := i + size
+		if end > v.Len() {
+			end = v.Len()
+		}
+		c := make([]any, 0, end-i)
+		for j := i; j < end; j++ {
+			c = append(c, v.Index(j).Interface())
+		}
+		ret = append(ret, c)
+	}
+	return ret
+}
+
 // ### 特点
 //
 //	多类型支持：处理数组、切片、字符串、map、结构体等多种数据类型
@@ -469,3 +566,480 @@ func get(params ...any) (out any, err error) {
 	// is that we return `nil` instead of panic.
 	return nil, nil
 }
+
+// truncate shortens s to at most n runes, suffix included. With words, the
+// cut is moved back to the last space, if there is one.
+func truncate(s string, n int, suffix string, words bool) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	sfx := []rune(suffix)
+	if len(sfx) >= n {
+		return string(sfx[:n])
+	}
+	all := []rune(s)
+	r := all[:n-len(sfx)]
+	if words && !unicode.IsSpace(all[len(r)]) {
+		for i := len(r) - 1; i > 0; i-- {
+			if unicode.IsSpace(r[i]) {
+				r = r[:i]
+				break
+			}
+		}
+	}
+	return strings.TrimRightFunc(string(r), unicode.IsSpace) + suffix
+}
+
+// padding returns the Safe function of padStart or padEnd, which pad the
+// string up to n runes with repetitions of the pad string, a space by
+// default.
+func padding(name string, start bool) func(args ...any) (any, uint, error) {
+	return func(args ...any) (any, uint, error) {
+		s := args[0].(string)
+		n, err := toInt(args[1])
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid argument for %s (%v)", name, err)
+		}
+		if n > 1e6 {
+			return nil, 0, fmt.Errorf("memory budget exceeded")
+		}
+		p := " "
+		if len(args) == 3 {
+			p = args[2].(string)
+		}
+		l := utf8.RuneCountInString(s)
+		if l >= n || p == "" {
+			return s, 0, nil
+		}
+		fill := []rune(strings.Repeat(p, (n-l)/utf8.RuneCountInString(p)+1))[:n-l]
+		if start {
+			s = string(fill) + s
+		} else {
+			s = s + string(fill)
+		}
+		return s, uint(len(s)), nil
+	}
+}
+
+// reverseString reverses the runes of s.
+func toBase64(args ...any) (any, error) {
+	if b, ok := args[0].([]byte); ok {
+		return base64.StdEncoding.EncodeToString(b), nil
+	}
+	return base64.StdEncoding.EncodeToString([]byte(args[0].(string))), nil
+}
+
+func fromBase64(args ...any) (any, error) {
+	b, err := base64.StdEncoding.DecodeString(args[0].(string))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func reverseString(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+// title upper cases the first letter of every word of s.
+func title(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	start := true
+	for _, r := range s {
+		if start {
+			b.WriteRune(unicode.ToTitle(r))
+		} else {
+			b.WriteRune(r)
+		}
+		start = !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	}
+	return b.String()
+}
+
+// slugify lower cases s, and joins its runs of letters and digits with
+// dashes, like "Hello, World!" to "hello-world".
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			dash = true
+			continue
+		}
+		if dash && b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		dash = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// FormatArgs returns the number of arguments a printf-style format uses,
+// counting * widths and precisions. It is false if the format picks
+// arguments by explicit index, like %[1]d, as the count is unknown then.
+func FormatArgs(format string) (int, bool) {
+	n := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		for i++; i < len(format) && strings.IndexByte("+-# 0123456789.*[]", format[i]) >= 0; i++ {
+			switch format[i] {
+			case '*':
+				n++
+			case '[':
+				return 0, false
+			}
+		}
+		if i < len(format) && format[i] != '%' {
+			n++
+		}
+	}
+	return n, true
+}
+
+// weightedChoice picks a key of the weights map with probability
+// proportional to its weight. The pick is stable: the same seed, like a
+// user id, always gets the same key for the same weights.
+func weightedChoice(weights any, seed string) (any, error) {
+	v := reflect.ValueOf(weights)
+	if v.Kind() != reflect.Map {
+		return nil, fmt.Errorf("invalid weights for weightedChoice (expected map, got %T)", weights)
+	}
+	type choice struct {
+		key    string
+		weight float64
+	}
+	choices := make([]choice, 0, v.Len())
+	total := 0.0
+	iter := v.MapRange()
+	for iter.Next() {
+		key, ok := deref.Interface(iter.Key().Interface()).(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid weights for weightedChoice (expected string key, got %s)", iter.Key().Type())
+		}
+		value := deref.Interface(iter.Value().Interface())
+		if !isNumber(value) {
+			return nil, fmt.Errorf("invalid weight of %q for weightedChoice (expected number, got %T)", key, value)
+		}
+		weight := runtime.ToFloat64(value)
+		if weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+			return nil, fmt.Errorf("invalid weight of %q for weightedChoice (%v)", key, weight)
+		}
+		choices = append(choices, choice{key, weight})
+		total += weight
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("invalid weights for weightedChoice (total weight must be positive)")
+	}
+	// Keys are sorted, so the pick does not depend on map iteration order.
+	sort.Slice(choices, func(i, j int) bool {
+		return choices[i].key < choices[j].key
+	})
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(seed))
+	point := float64(h.Sum64()>>11) / (1 << 53) * total
+	for _, c := range choices {
+		if point < c.weight {
+			return c.key, nil
+		}
+		point -= c.weight
+	}
+	// Rounding may leave point just above the last weight.
+	for i := len(choices) - 1; i >= 0; i-- {
+		if choices[i].weight > 0 {
+			return choices[i].key, nil
+		}
+	}
+	return nil, nil
+}
+
+func isNumber(v any) bool {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	}
+	return false
+}
+
+// isEmail reports whether s is a bare email address, like user@example.com.
+// Display names, comments and domains without a dot are rejected.
+func isEmail(s string) bool {
+	if len(s) > 254 || strings.TrimSpace(s) != s {
+		return false
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Name != "" || addr.Address != s {
+		return false
+	}
+	at := strings.LastIndexByte(s, '@')
+	local, domain := s[:at], s[at+1:]
+	if len(local) > 64 || strings.HasPrefix(local, `"`) {
+		return false
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// isURL reports whether s is an absolute URL with a scheme and a host,
+// like https://example.com/path.
+func isURL(s string) bool {
+	if strings.ContainsAny(s, " \t\r\n") {
+		return false
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return u.Scheme != "" && u.Hostname() != ""
+}
+
+// phoneRegion describes numbers of a region: the country calling code and
+// the allowed lengths of the national significant number.
+type phoneRegion struct {
+	code     string
+	min, max int
+	trunk    string // national prefix, like 0 in 020 7946 0958
+}
+
+var phoneRegions = map[string]phoneRegion{
+	"US": {"1", 10, 10, "1"},
+	"CA": {"1", 10, 10, "1"},
+	"GB": {"44", 9, 10, "0"},
+	"IE": {"353", 7, 9, "0"},
+	"DE": {"49", 6, 13, "0"},
+	"FR": {"33", 9, 9, "0"},
+	"ES": {"34", 9, 9, ""},
+	"IT": {"39", 6, 11, ""},
+	"NL": {"31", 9, 9, "0"},
+	"BE": {"32", 8, 9, "0"},
+	"CH": {"41", 9, 9, "0"},
+	"AT": {"43", 4, 13, "0"},
+	"SE": {"46", 7, 9, "0"},
+	"PL": {"48", 9, 9, ""},
+	"PT": {"351", 9, 9, ""},
+	"RU": {"7", 10, 10, "8"},
+	"CN": {"86", 10, 11, "0"},
+	"JP": {"81", 9, 10, "0"},
+	"KR": {"82", 8, 10, "0"},
+	"IN": {"91", 10, 10, "0"},
+	"AU": {"61", 9, 9, "0"},
+	"NZ": {"64", 8, 10, "0"},
+	"BR": {"55", 10, 11, "0"},
+	"MX": {"52", 10, 10, ""},
+	"ZA": {"27", 9, 9, "0"},
+}
+
+// isPhone reports whether s is a phone number. Spaces, dots, dashes and
+// parentheses are allowed as separators. Without a region, s must be in
+// international format, like +44 20 7946 0958, with at most 15 digits.
+// With a region, like "GB", national format, like 020 7946 0958, is accepted
+// too, and the number of digits must match the region.
+func isPhone(s string, region string) (bool, error) {
+	var r phoneRegion
+	if region != "" {
+		var ok bool
+		r, ok = phoneRegions[strings.ToUpper(region)]
+		if !ok {
+			return false, fmt.Errorf("unknown phone region %q", region)
+		}
+	}
+
+	international := strings.HasPrefix(s, "+")
+	digits := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case '0' <= c && c <= '9':
+			digits = append(digits, c)
+		case c == '+' && i == 0:
+		case c == ' ' || c == '.' || c == '-' || c == '(' || c == ')':
+			if i == 0 && c != '(' {
+				return false, nil
+			}
+		default:
+			return false, nil
+		}
+	}
+	number := string(digits)
+
+	if region == "" {
+		return international && len(number) >= 8 && len(number) <= 15 && number[0] != '0', nil
+	}
+	if international {
+		if !strings.HasPrefix(number, r.code) {
+			return false, nil
+		}
+		number = number[len(r.code):]
+	} else if r.trunk != "" && strings.HasPrefix(number, r.trunk) && len(number)-len(r.trunk) >= r.min {
+		number = number[len(r.trunk):]
+	}
+	return len(number) >= r.min && len(number) <= r.max, nil
+}
+
+// regexpOf returns the regexp of a pattern to match s with, which is
+// precompiled when it is a string literal. Patterns compiled within the
+// limits of conf.Config.Regexps are returned only if matching s is within
+// their budget.
+func regexpOf(pattern any, s string) (*regexp.Regexp, error) {
+	switch re := pattern.(type) {
+	case *regexp.Regexp:
+		return re, nil
+	case *runtime.Regexp:
+		if err := re.Budget(s); err != nil {
+			return nil, err
+		}
+		return re.Regexp, nil
+	}
+	return regexp.Compile(pattern.(string))
+}
+
+// matchGroups returns the groups of the first match of re in s, by index
+// ("0" is the whole match) and by name for named groups. It returns nil if
+// s does not match.
+func matchGroups(s string, re *regexp.Regexp) map[string]any {
+	match := re.FindStringSubmatch(s)
+	if match == nil {
+		return nil
+	}
+	groups := make(map[string]any, len(match))
+	for i, name := range re.SubexpNames() {
+		groups[strconv.Itoa(i)] = match[i]
+		if name != "" {
+			groups[name] = match[i]
+		}
+	}
+	return groups
+}
+
+// jsonSize returns the number of values of a decoded JSON document, which is
+// charged to the memory budget by fromJSON.
+func jsonSize(v any) uint {
+	size := uint(1)
+	switch v := v.(type) {
+	case []any:
+		for _, e := range v {
+			size += jsonSize(e)
+		}
+	case map[string]any:
+		for _, e := range v {
+			size += jsonSize(e)
+		}
+	}
+	return size
+}
+
+// Date parses a date, like the date builtin: date(str[, layout[, timezone]]),
+// or date(tz, str[, layout]) with a time.Location.
+func Date(args ...any) (any, error) {
+	tz, ok := args[0].(*time.Location)
+	if ok {
+		args = args[1:]
+	}
+
+	date := args[0].(string)
+	if len(args) == 2 {
+		layout := args[1].(string)
+		if tz != nil {
+			return time.ParseInLocation(layout, date, tz)
+		}
+		return time.Parse(layout, date)
+	}
+	if len(args) == 3 {
+		layout := args[1].(string)
+		timeZone := args[2].(string)
+		tz, err := time.LoadLocation(timeZone)
+		if err != nil {
+			return nil, err
+		}
+		t, err := time.ParseInLocation(layout, date, tz)
+		if err != nil {
+			return nil, err
+		}
+		return t, nil
+	}
+
+	layouts := []string{
+		"2006-01-02",
+		"15:04:05",
+		"2006-01-02 15:04:05",
+		time.RFC3339,
+		time.RFC822,
+		time.RFC850,
+		time.RFC1123,
+	}
+	for _, layout := range layouts {
+		if tz == nil {
+			t, err := time.Parse(layout, date)
+			if err == nil {
+				return t, nil
+			}
+		} else {
+			t, err := time.ParseInLocation(layout, date, tz)
+			if err == nil {
+				return t, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("invalid date %s", date)
+}
+
+// EnvKeys returns the keys of a map env, or the names of the exported fields
+// of a struct env, with the fields promoted from embedded structs, sorted.
+func EnvKeys(env any) []string {
+	v := deref.Value(reflect.ValueOf(env))
+	switch v.Kind() {
+	case reflect.Map:
+		keys := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			if key.Kind() == reflect.String || key.Kind() == reflect.Interface && key.Elem().Kind() == reflect.String {
+				keys = append(keys, fmt.Sprint(key.Interface()))
+			}
+		}
+		sort.Strings(keys)
+		return keys
+	case reflect.Struct:
+		keys := []string{}
+		for name, field := range embedded.Fields(v.Type()) {
+			if field.PkgPath == "" {
+				keys = append(keys, name)
+			}
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	return []string{}
+}
+
+// EnvHas reports whether a map env has the key, or a struct env has an
+// exported field of the name.
+func EnvHas(env any, name string) bool {
+	v := deref.Value(reflect.ValueOf(env))
+	switch v.Kind() {
+	case reflect.Map:
+		key := reflect.ValueOf(name)
+		if !key.Type().ConvertibleTo(v.Type().Key()) {
+			return false
+		}
+		return v.MapIndex(key.Convert(v.Type().Key())).IsValid()
+	case reflect.Struct:
+		field, ok := embedded.Fields(v.Type())[name]
+		return ok && field.PkgPath == ""
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package builtin
+
+// Profiles are named sets of builtins, selected with
+// conf.Config.WithBuiltinProfile, for example to restrict the builtins
+// untrusted expressions can call. A nil set, like "full", allows all the
+// builtins.
+//
+// The sets are versioned with the module: builtins added later only join
+// "full", so expressions checked with the other profiles can not start
+// calling them after an upgrade. Builtins which read the env, like get and
+// type, or the clock, like now, are in "full" only.
+var Profiles = map[string][]string{
+	"minimal": minimal,
+	"strings": append(append([]string{}, minimal...),
+		"trim", "trimPrefix", "trimSuffix", "upper", "lower", "split",
+		"splitAfter", "replace", "repeat", "truncate", "padStart", "padEnd",
+		"title", "slugify", "format", "join", "indexOf", "lastIndexOf",
+		"hasPrefix", "hasSuffix", "isEmail", "isURL", "isPhone",
+	),
+	"full": nil,
+}
+
+// minimal are the builtins over arrays and numbers.
+var minimal = []string{
+	"all", "none", "any", "one", "filter", "map", "find", "findIndex",
+	"findLast", "findLastIndex", "count", "sum", "groupBy", "sortBy", "reduce",
+	"uniqBy", "partition", "takeWhile", "dropWhile", "len", "abs", "ceil",
+	"floor", "round", "int", "float", "string", "max", "min", "mean", "median",
+	"first", "last", "take", "drop", "keys", "values", "reverse", "uniq",
+	"concat", "flatten", "sort",
+}
@@ -2,6 +2,7 @@ package builtin
 
 import (
 	"fmt"
+	"math/big"
 	"reflect"
 	"time"
 
@@ -12,12 +13,19 @@ var (
 	anyType      = reflect.TypeOf(new(any)).Elem()
 	integerType  = reflect.TypeOf(0)
 	floatType    = reflect.TypeOf(float64(0))
+	stringType   = reflect.TypeOf("")
 	arrayType    = reflect.TypeOf([]any{})
 	mapType      = reflect.TypeOf(map[any]any{})
 	timeType     = reflect.TypeOf(new(time.Time)).Elem()
 	locationType = reflect.TypeOf(new(time.Location))
+	decimalType  = reflect.TypeOf(new(big.Rat))
 )
 
+// isDecimal reports whether t is a decimal of the decimal mode.
+func isDecimal(t reflect.Type) bool {
+	return t == decimalType || t == decimalType.Elem()
+}
+
 func kind(t reflect.Type) reflect.Kind {
 	if t == nil {
 		return reflect.Invalid
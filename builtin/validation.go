@@ -36,3 +36,37 @@ func validateRoundFunc(name string, args []reflect.Type) (reflect.Type, error) {
 		return anyType, fmt.Errorf("invalid argument for %s (type %s)", name, args[0])
 	}
 }
+
+// validateTry validates the argument of tryInt and tryFloat, which return
+// nil for values which can not be converted.
+func validateTry(name string, args []reflect.Type) (reflect.Type, error) {
+	if len(args) != 1 {
+		return anyType, fmt.Errorf("invalid number of arguments (expected 1, got %d)", len(args))
+	}
+	switch kind(args[0]) {
+	case reflect.Interface, reflect.Invalid, reflect.String,
+		reflect.Float32, reflect.Float64, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return anyType, nil
+	}
+	return anyType, fmt.Errorf("invalid argument for %s (type %s)", name, args[0])
+}
+
+func validateDate(args []reflect.Type) (reflect.Type, error) {
+	if len(args) < 1 {
+		return anyType, fmt.Errorf("invalid number of arguments (expected at least 1, got %d)", len(args))
+	}
+	if args[0] != nil && args[0].AssignableTo(locationType) {
+		args = args[1:]
+	}
+	if len(args) > 3 {
+		return anyType, fmt.Errorf("invalid number of arguments (expected at most 3, got %d)", len(args))
+	}
+	return timeType, nil
+}
+
+func derefDate(i int, arg reflect.Type) bool {
+	if arg.AssignableTo(locationType) {
+		return false
+	}
+	return true
+}
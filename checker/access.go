@@ -0,0 +1,245 @@
+package checker
+
+import (
+	"sort"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/file"
+	"github.com/expr-lang/expr/parser"
+)
+
+// Kinds of accesses of an AccessReport.
+const (
+	AccessField    = "field"    // a value read from the env, like User.Name
+	AccessMethod   = "method"   // a method called, like User.Greet
+	AccessFunction = "function" // a function of the env or of expr.Function
+	AccessBuiltin  = "builtin"  // a builtin, like len
+)
+
+// Access is a use of the env, of a function or of a builtin by an
+// expression.
+type Access struct {
+	Kind string // one of the Access* kinds
+	// Path names what is accessed. Fields and methods are named by their
+	// path from the env, with constant keys of maps as names: elements read
+	// by other indexes or by predicates end with [], like Items[].Price. Methods of values which
+	// do not come from the env are named after their type, like
+	// time.Time.Format.
+	Path     string
+	Location file.Location // of the access in the source
+}
+
+// AccessReport lists everything an expression touches, so expressions of
+// untrusted users can be reviewed without reading them.
+type AccessReport struct {
+	Accesses []Access // in the order of the source
+}
+
+// Paths returns the paths of the accesses of the kind, without duplicates,
+// in the order of the source.
+func (r *AccessReport) Paths(kind string) []string {
+	var paths []string
+	seen := map[string]bool{}
+	for _, a := range r.Accesses {
+		if a.Kind == kind && !seen[a.Path] {
+			seen[a.Path] = true
+			paths = append(paths, a.Path)
+		}
+	}
+	return paths
+}
+
+// Audit reports the env fields, methods, functions and builtins the type
+// checked tree touches, with their locations. Values of the env are
+// followed through variables and predicates: with let u = User, u.Name is
+// reported as User.Name.
+func Audit(tree *parser.Tree) *AccessReport {
+	var accesses []Access
+	WalkAccesses(tree.Node, func(access Access, _ ast.Node) {
+		accesses = append(accesses, access)
+	})
+	sort.SliceStable(accesses, func(i, j int) bool {
+		return accesses[i].Location.From < accesses[j].Location.From
+	})
+	return &AccessReport{Accesses: accesses}
+}
+
+// WalkAccesses walks the type checked node like Audit, and calls visit with
+// every access and the node of the access, in the order of the walk. It
+// also walks trees optimized by the compiler, like those of programs.
+func WalkAccesses(node ast.Node, visit func(access Access, node ast.Node)) {
+	a := &auditor{locals: map[string][]string{}, visit: visit}
+	a.value(node)
+}
+
+type auditor struct {
+	visit    func(Access, ast.Node)
+	locals   map[string][]string // paths of the variables in scope, by name
+	elements []string            // paths of the elements of the predicates in scope
+}
+
+func (a *auditor) add(kind, path string, node ast.Node) {
+	a.visit(Access{Kind: kind, Path: path, Location: node.Location()}, node)
+}
+
+// value visits the node and reports the env value it reads, if any.
+func (a *auditor) value(node ast.Node) {
+	if path := a.path(node); path != "" {
+		a.add(AccessField, path, node)
+	}
+}
+
+func (a *auditor) values(nodes []ast.Node) {
+	for _, node := range nodes {
+		a.value(node)
+	}
+}
+
+// path visits the node and returns the path of the env value it is, if
+// any, for the caller to report or to extend, like the base of a member.
+func (a *auditor) path(node ast.Node) string {
+	switch n := node.(type) {
+	case nil:
+	case *ast.IdentifierNode:
+		if paths := a.locals[n.Value]; len(paths) > 0 {
+			return paths[len(paths)-1]
+		}
+		return n.Value
+	case *ast.PointerNode:
+		if n.Name == "" && len(a.elements) > 0 {
+			return a.elements[len(a.elements)-1]
+		}
+		if level, ok := n.Level(); ok && level <= len(a.elements) {
+			return a.elements[level-1]
+		}
+	case *ast.MemberNode:
+		return a.member(n)
+	case *ast.ChainNode:
+		return a.path(n.Node)
+	case *ast.SliceNode:
+		a.value(n.From)
+		a.value(n.To)
+		return a.path(n.Node)
+	case *ast.CallNode:
+		a.call(n)
+	case *ast.BuiltinNode:
+		a.add(AccessBuiltin, n.Name, n)
+		if len(n.Arguments) > 1 {
+			if _, ok := n.Arguments[1].(*ast.PredicateNode); ok {
+				path := a.path(n.Arguments[0])
+				if path != "" {
+					a.add(AccessField, path, n.Arguments[0])
+					path += "[]"
+				}
+				a.elements = append(a.elements, path)
+				a.values(n.Arguments[1:])
+				if n.Map != nil {
+					// The optimizer folds map into filter.
+					a.add(AccessBuiltin, "map", n.Map)
+					a.value(n.Map)
+				}
+				a.elements = a.elements[:len(a.elements)-1]
+				break
+			}
+		}
+		a.values(n.Arguments)
+	case *ast.PredicateNode:
+		a.value(n.Node)
+	case *ast.FunctionNode:
+		for _, name := range n.Params {
+			a.locals[name] = append(a.locals[name], "")
+		}
+		a.value(n.Node)
+		for _, name := range n.Params {
+			a.locals[name] = a.locals[name][:len(a.locals[name])-1]
+		}
+	case *ast.VariableDeclaratorNode:
+		// Uses of the variable are reported as uses of its value. The
+		// elements bound to named parameters of predicates are reported
+		// only where they are used.
+		path := a.path(n.Value)
+		if _, ok := n.Value.(*ast.PointerNode); !ok && path != "" {
+			a.add(AccessField, path, n.Value)
+		}
+		a.locals[n.Name] = append(a.locals[n.Name], path)
+		a.value(n.Expr)
+		a.locals[n.Name] = a.locals[n.Name][:len(a.locals[n.Name])-1]
+	case *ast.UnaryNode:
+		a.value(n.Node)
+	case *ast.BinaryNode:
+		a.value(n.Left)
+		a.value(n.Right)
+	case *ast.ConditionalNode:
+		a.value(n.Cond)
+		a.value(n.Exp1)
+		a.value(n.Exp2)
+	case *ast.SwitchNode:
+		a.value(n.Node)
+		a.values(n.Branches)
+		a.value(n.Default)
+	case *ast.SequenceNode:
+		a.values(n.Nodes)
+	case *ast.OpcodeNode:
+		a.values(n.Arguments)
+	case *ast.ArrayNode:
+		a.values(n.Nodes)
+	case *ast.MapNode:
+		a.values(n.Pairs)
+	case *ast.PairNode:
+		a.value(n.Key)
+		a.value(n.Value)
+	}
+	return ""
+}
+
+// member returns the path of the member, like User.Name for User.Name and
+// Items[] for Items[i], and reports the methods, with the env values they
+// are called on.
+func (a *auditor) member(n *ast.MemberNode) string {
+	base := a.path(n.Node)
+	name, isName := n.Property.(*ast.StringNode)
+	if n.Method && isName {
+		switch base {
+		case "":
+			a.add(AccessMethod, n.Node.Nature().String()+"."+name.Value, n)
+		case "$env":
+			a.add(AccessMethod, name.Value, n)
+		default:
+			a.add(AccessField, base, n.Node)
+			a.add(AccessMethod, base+"."+name.Value, n)
+		}
+		return ""
+	}
+	if !isName {
+		a.value(n.Property)
+	}
+	switch {
+	case base == "":
+		return ""
+	case base == "$env" && isName:
+		return name.Value
+	case isName:
+		return base + "." + name.Value
+	}
+	return base + "[]"
+}
+
+// call reports the function or the method called, and visits the arguments.
+func (a *auditor) call(n *ast.CallNode) {
+	switch callee := n.Callee.(type) {
+	case *ast.IdentifierNode:
+		switch {
+		case len(a.locals[callee.Value]) > 0:
+			// A function defined in the expression.
+		case callee.Nature().Method:
+			a.add(AccessMethod, callee.Value, callee)
+		default:
+			a.add(AccessFunction, callee.Value, callee)
+		}
+	case *ast.MemberNode:
+		a.member(callee)
+	default:
+		a.value(callee)
+	}
+	a.values(n.Arguments)
+}
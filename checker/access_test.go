@@ -0,0 +1,80 @@
+package checker_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/checker"
+	"github.com/expr-lang/expr/conf"
+)
+
+type auditItem struct {
+	Price int
+	Tags  []string
+}
+
+type auditUser struct {
+	Name  string
+	Items []auditItem
+	Born  time.Time
+}
+
+func (auditUser) Greet(s string) string { return s }
+
+type auditEnv struct {
+	User  auditUser
+	Limit int
+	Users map[string]auditUser
+}
+
+func (auditEnv) Log(s string) bool { return true }
+
+func TestAudit(t *testing.T) {
+	tests := []struct {
+		code     string
+		accesses []string
+	}{
+		{`User.Name`, []string{"field User.Name"}},
+		{`$env.Limit + Limit`, []string{"field Limit", "field Limit"}},
+		{`Users["bob"].Name`, []string{"field Users.bob.Name"}},
+		{`Users[User.Name].Name`, []string{"field User.Name", "field Users[].Name"}},
+		{`User.Items[0:1]`, []string{"field User.Items"}},
+		{`Log(User.Name)`, []string{"method Log", "field User.Name"}},
+		{`User.Greet("hi")`, []string{"field User", "method User.Greet"}},
+		{`User.Born.Format("2006")`, []string{"field User.Born", "method User.Born.Format"}},
+		{`now().Format("2006")`, []string{"builtin now", "method time.Time.Format"}},
+		{`upper("a")`, []string{"builtin upper"}},
+		{`all(User.Items, .Price < Limit)`, []string{"builtin all", "field User.Items", "field User.Items[].Price", "field Limit"}},
+		{`any(User.Items, i => "x" in i.Tags)`, []string{"builtin any", "field User.Items", "field User.Items[].Tags"}},
+		{`map(User.Items, map(#.Tags, #1.Price))`, []string{"builtin map", "field User.Items", "builtin map", "field User.Items[].Tags", "field User.Items[].Price"}},
+		{`let u = User; u.Name + u.Name`, []string{"field User", "field User.Name", "field User.Name"}},
+		{`let f = (x) => x.Name; f(User)`, []string{"field User"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			tree, err := checker.ParseCheck(tt.code, conf.New(auditEnv{}))
+			require.NoError(t, err)
+
+			var accesses []string
+			for _, a := range checker.Audit(tree).Accesses {
+				accesses = append(accesses, fmt.Sprintf("%v %v", a.Kind, a.Path))
+			}
+			assert.Equal(t, tt.accesses, accesses)
+		})
+	}
+}
+
+func TestAudit_report(t *testing.T) {
+	report, err := expr.Audit(`Log(User.Name) && User.Name != "" && len(User.Items) > Limit`, expr.Env(auditEnv{}))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"User.Name", "User.Items", "Limit"}, report.Paths(checker.AccessField))
+	assert.Equal(t, []string{"Log"}, report.Paths(checker.AccessMethod))
+	assert.Equal(t, []string{"len"}, report.Paths(checker.AccessBuiltin))
+	assert.Equal(t, 0, report.Accesses[0].Location.From)
+}
@@ -0,0 +1,249 @@
+package checker
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/expr-lang/expr/ast"
+	. "github.com/expr-lang/expr/checker/nature"
+	"github.com/expr-lang/expr/conf"
+	"github.com/expr-lang/expr/file"
+	"github.com/expr-lang/expr/parser"
+	"github.com/expr-lang/expr/vm/runtime"
+)
+
+// Analyze runs analysis passes over a type checked tree, and reports
+// suspicious but valid expressions, like comparisons which are always true,
+// to config.Warnings. With config.WarningsAsErrors the first warning is
+// returned as an error instead.
+func Analyze(tree *parser.Tree, config *conf.Config) error {
+	if config == nil || (config.Warnings == nil && !config.WarningsAsErrors) {
+		return nil
+	}
+	a := &analyzer{exactFloats: config.FloatEpsilon == 0 && !config.DecimalMode}
+	ast.Walk(&tree.Node, a)
+	for _, w := range a.warnings {
+		w = w.Bind(tree.Source)
+		if config.WarningsAsErrors {
+			return w
+		}
+		config.Warnings(w)
+	}
+	return nil
+}
+
+type analyzer struct {
+	warnings    []*file.Error
+	exactFloats bool // floats are compared without FloatEpsilon
+}
+
+func (a *analyzer) warn(node ast.Node, message string) {
+	a.warnings = append(a.warnings, &file.Error{
+		Location: node.Location(),
+		Message:  message,
+	})
+}
+
+func (a *analyzer) Visit(node *ast.Node) {
+	if n, ok := (*node).(*ast.MemberNode); ok && !n.Optional && n.Node.Nature().Nullable {
+		a.warn(n, fmt.Sprintf("%v may be nil, accessing its members can fail (use ?. or ??)", n.Node))
+	}
+	if n, ok := (*node).(*ast.BinaryNode); ok {
+		if result, ok := constantComparison(n); ok {
+			if result {
+				a.warn(n, "comparison is always true")
+			} else {
+				a.warn(n, "comparison is always false")
+			}
+		} else if a.exactFloats && floatEquality(n) {
+			a.warn(n, "exact comparison of floats, rounding errors can make it fail (use FloatEpsilon)")
+		}
+	}
+}
+
+// floatEquality reports whether floats are compared with == or !=. The
+// x != x check for NaN is not reported.
+func floatEquality(n *ast.BinaryNode) bool {
+	if n.Operator != "==" && n.Operator != "!=" {
+		return false
+	}
+	if n.Left.String() == n.Right.String() {
+		return false
+	}
+	return floatKind(n.Left.Nature().Deref()) && floatKind(n.Right.Nature().Deref())
+}
+
+// floatKind is like isFloat, but also true for named float types.
+func floatKind(nt Nature) bool {
+	switch nt.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// constantComparison reports whether the comparison has the same result
+// for any value of its operands, and the result.
+func constantComparison(n *ast.BinaryNode) (bool, bool) {
+	switch n.Operator {
+	case "==", "!=", "<", ">", "<=", ">=":
+	default:
+		return false, false
+	}
+
+	a, aok := literal(n.Left)
+	b, bok := literal(n.Right)
+	if aok && bok {
+		return compareLiterals(n.Operator, a, b)
+	}
+
+	// x == x is true, unless x is a float, which may be NaN.
+	if isStable(n.Left) && n.Left.String() == n.Right.String() {
+		switch kind(n.Left.Nature().Deref().Type) {
+		case reflect.Invalid, reflect.Interface, reflect.Float32, reflect.Float64:
+			return false, false
+		}
+		switch n.Operator {
+		case "==", "<=", ">=":
+			return true, true
+		default:
+			return false, true
+		}
+	}
+
+	// len(x) >= 0 is true, as lengths and unsigned integers are never negative.
+	if c, ok := b.(int); ok && isNonNegative(n.Left) {
+		return compareNonNegative(n.Operator, c)
+	}
+	if c, ok := a.(int); ok && isNonNegative(n.Right) {
+		return compareNonNegative(mirror(n.Operator), c)
+	}
+	return false, false
+}
+
+// literal returns the value of a literal, like 42, -1.5 or "foo".
+func literal(node ast.Node) (any, bool) {
+	switch n := node.(type) {
+	case *ast.IntegerNode:
+		return n.Value, true
+	case *ast.FloatNode:
+		return n.Value, true
+	case *ast.StringNode:
+		return n.Value, true
+	case *ast.BoolNode:
+		return n.Value, true
+	case *ast.NilNode:
+		return nil, true
+	case *ast.UnaryNode:
+		if n.Operator == "-" {
+			switch v := n.Node.(type) {
+			case *ast.IntegerNode:
+				return -v.Value, true
+			case *ast.FloatNode:
+				return -v.Value, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// untyped reports whether node is a literal, or an array, map or range of
+// literals, whose elements take the type of the other operand when compared
+// with a named type.
+func untyped(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.ArrayNode:
+		for _, e := range n.Nodes {
+			if !untyped(e) {
+				return false
+			}
+		}
+		return true
+	case *ast.MapNode:
+		return true
+	case *ast.BinaryNode:
+		return n.Operator == ".." && untyped(n.Left) && untyped(n.Right)
+	}
+	_, ok := literal(node)
+	return ok
+}
+
+func compareLiterals(op string, a, b any) (result bool, ok bool) {
+	defer func() {
+		// Literals of different types are reported by the checker.
+		if r := recover(); r != nil {
+			result, ok = false, false
+		}
+	}()
+	switch op {
+	case "==":
+		return runtime.Equal(a, b), true
+	case "!=":
+		return !runtime.Equal(a, b), true
+	case "<":
+		return runtime.Less(a, b), true
+	case ">":
+		return runtime.More(a, b), true
+	case "<=":
+		return runtime.LessOrEqual(a, b), true
+	case ">=":
+		return runtime.MoreOrEqual(a, b), true
+	}
+	return false, false
+}
+
+// isStable reports whether node evaluates to the same value each time
+// within an expression: a variable or a chain of fields on it.
+func isStable(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		return true
+	case *ast.MemberNode:
+		if n.Method {
+			return false
+		}
+		_, constant := literal(n.Property)
+		return isStable(n.Node) && (constant || isStable(n.Property))
+	case *ast.ChainNode:
+		return isStable(n.Node)
+	}
+	return false
+}
+
+func isNonNegative(node ast.Node) bool {
+	if b, ok := node.(*ast.BuiltinNode); ok && b.Name == "len" {
+		return true
+	}
+	switch kind(node.Nature().Deref().Type) {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// compareNonNegative reports the result of n op c, if it is the same for
+// every n >= 0.
+func compareNonNegative(op string, c int) (bool, bool) {
+	switch {
+	case op == ">=" && c <= 0, op == ">" && c < 0, op == "!=" && c < 0:
+		return true, true
+	case op == "<" && c <= 0, op == "<=" && c < 0, op == "==" && c < 0:
+		return false, true
+	}
+	return false, false
+}
+
+// mirror returns the operator for swapped operands: a < b is b > a.
+func mirror(op string) string {
+	switch op {
+	case "<":
+		return ">"
+	case ">":
+		return "<"
+	case "<=":
+		return ">="
+	case ">=":
+		return "<="
+	}
+	return op
+}
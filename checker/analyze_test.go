@@ -0,0 +1,125 @@
+package checker_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr/checker"
+	"github.com/expr-lang/expr/conf"
+	"github.com/expr-lang/expr/file"
+)
+
+func TestAnalyze_constant_comparisons(t *testing.T) {
+	env := map[string]any{
+		"items": []int{1, 2, 3},
+		"name":  "foo",
+		"count": uint(0),
+		"price": 1.5,
+		"user":  map[string]int{"age": 42},
+		"any":   any(nil),
+	}
+
+	tests := []struct {
+		code     string
+		warnings []string
+	}{
+		{`len(items) >= 0`, []string{"comparison is always true (1:12)"}},
+		{`len(items) < 0`, []string{"comparison is always false (1:12)"}},
+		{`-1 < len(items)`, []string{"comparison is always true (1:4)"}},
+		{`count >= 0`, []string{"comparison is always true (1:7)"}},
+		{`"a" == "b"`, []string{"comparison is always false (1:5)"}},
+		{`1 < 2 && 2.5 >= 2`, []string{"comparison is always true (1:3)", "comparison is always true (1:14)"}},
+		{`name == name`, []string{"comparison is always true (1:6)"}},
+		{`user.age != user.age`, []string{"comparison is always false (1:10)"}},
+		{`len(items) > 0`, nil},
+		{`count > 0`, nil},
+		{`name == "foo"`, nil},
+		{`price != price`, nil},
+		{`any == any`, nil},
+		{`filter(items, # > 1) == filter(items, # > 1)`, nil},
+		{`price == 0.3`, []string{"exact comparison of floats, rounding errors can make it fail (use FloatEpsilon) (1:7)"}},
+		{`price * 2 != price`, []string{"exact comparison of floats, rounding errors can make it fail (use FloatEpsilon) (1:11)"}},
+		{`price == 1`, nil},
+		{`price > 0.3`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			var warnings []string
+			config := conf.New(env)
+			config.Warnings = func(w *file.Error) {
+				warnings = append(warnings, fmt.Sprintf("%s (%d:%d)", w.Message, w.Line, w.Column+1))
+			}
+			_, err := checker.ParseCheck(tt.code, config)
+			require.NoError(t, err)
+			assert.Equal(t, tt.warnings, warnings)
+		})
+	}
+}
+
+func TestAnalyze_warnings_as_errors(t *testing.T) {
+	config := conf.New(nil)
+	config.WarningsAsErrors = true
+
+	_, err := checker.ParseCheck(`1 == 1 || true`, config)
+	require.Error(t, err)
+	assert.Equal(t, "comparison is always true (1:3)\n | 1 == 1 || true\n | ..^", err.Error())
+
+	_, err = checker.ParseCheck(`1 == 1`, conf.New(nil))
+	require.NoError(t, err)
+}
+
+func TestAnalyze_float_epsilon(t *testing.T) {
+	config := conf.New(map[string]any{"price": 1.5})
+	config.FloatEpsilon = 1e-9
+	config.WarningsAsErrors = true
+
+	_, err := checker.ParseCheck(`price == 0.3`, config)
+	require.NoError(t, err)
+}
+
+func TestAnalyze_nullable(t *testing.T) {
+	type User struct {
+		Name    string
+		Manager *User
+	}
+	env := map[string]any{
+		"users":  []User{{Name: "a"}},
+		"byName": map[string]*User{},
+		"user":   User{},
+		"other":  &User{},
+	}
+
+	tests := []struct {
+		code     string
+		warnings []string
+	}{
+		{`find(users, .Name == "a").Name`, []string{`find(users, .Name == "a") may be nil, accessing its members can fail (use ?. or ??) (1:27)`}},
+		{`findLast(users, true).Name`, []string{`findLast(users, true) may be nil, accessing its members can fail (use ?. or ??) (1:23)`}},
+		{`byName["a"].Name`, []string{`byName.a may be nil, accessing its members can fail (use ?. or ??) (1:13)`}},
+		{`let u = find(users, true); u.Name`, []string{`u may be nil, accessing its members can fail (use ?. or ??) (1:30)`}},
+		{`(user.Manager?.Manager).Name`, nil}, // the chain ends at .Name
+		{`(true ? other : nil).Name`, []string{`true ? other : nil may be nil, accessing its members can fail (use ?. or ??) (1:22)`}},
+		{`(byName.a ?? nil).Name`, []string{`byName.a ?? nil may be nil, accessing its members can fail (use ?. or ??) (1:19)`}},
+		{`find(users, .Name == "a")?.Name`, nil},
+		{`(find(users, .Name == "a") ?? user).Name`, nil},
+		{`(byName.a ?? other).Name`, nil},
+		{`user?.Manager.Name`, nil},
+		{`user.Manager.Name`, nil},
+		{`users[0].Name`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			var warnings []string
+			config := conf.New(env)
+			config.Warnings = func(w *file.Error) {
+				warnings = append(warnings, fmt.Sprintf("%s (%d:%d)", w.Message, w.Line, w.Column+1))
+			}
+			_, err := checker.ParseCheck(tt.code, config)
+			require.NoError(t, err)
+			assert.Equal(t, tt.warnings, warnings)
+		})
+	}
+}
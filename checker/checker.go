@@ -1,9 +1,12 @@
 package checker
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"regexp"
+	"strings"
 
 	"github.com/expr-lang/expr/ast"
 	"github.com/expr-lang/expr/builtin"
@@ -11,6 +14,8 @@ import (
 	"github.com/expr-lang/expr/conf"
 	"github.com/expr-lang/expr/file"
 	"github.com/expr-lang/expr/parser"
+	"github.com/expr-lang/expr/vm"
+	"github.com/expr-lang/expr/vm/runtime"
 )
 
 // Check 对表达式语法树进行类型检查和验证。
@@ -29,17 +34,20 @@ import (
 //   - 可重复 visitor 会多次执行，直到 ShouldRepeat() 返回 false。
 //
 // 某些语法树修改可能需要多轮才能完成（例如，先展开某个语法结构，才能继续处理展开后的新节点），因此需要支持重复执行。
-func runVisitors(tree *parser.Tree, config *conf.Config, runRepeatable bool) {
+func runVisitors(ctx context.Context, tree *parser.Tree, config *conf.Config, runRepeatable bool) error {
 	for {
 		more := false
 		for _, v := range config.Visitors {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 
 			// We need to perform types check, because some visitors may rely on
 			// types information available in the tree.
 			//
 			// 每次执行 visitor 前做一次类型检查，因为某些 visitor 可能依赖 AST 上的类型信息。
 			// 这里忽略返回值和错误，只是为了刷新类型信息。
-			_, _ = Check(tree, config)
+			_, _ = CheckContext(ctx, tree, config)
 
 			// 判断 visitor 是否实现了 repeatable 接口，若是说明它可能需要多次遍历 AST 才能完全生效。
 			r, repeatable := v.(interface {
@@ -72,7 +80,7 @@ func runVisitors(tree *parser.Tree, config *conf.Config, runRepeatable bool) {
 
 		// 如果没有 visitor 表示需要重复处理 AST (more == false)，就跳出外层循环。
 		if !more {
-			break
+			return nil
 		}
 	}
 }
@@ -80,11 +88,35 @@ func runVisitors(tree *parser.Tree, config *conf.Config, runRepeatable bool) {
 // ParseCheck parses input expression and checks its types. Also, it applies
 // all provided patchers. In case of error, it returns error with a tree.
 func ParseCheck(input string, config *conf.Config) (*parser.Tree, error) {
+	return ParseCheckContext(context.Background(), input, config)
+}
+
+// ParseCheckContext parses and checks the input like ParseCheck, aborting
+// once ctx is canceled or its deadline is exceeded. The context is checked
+// between passes of the visitors and between batches of nodes, and the
+// error of ctx is returned as is.
+func ParseCheckContext(ctx context.Context, input string, config *conf.Config) (*parser.Tree, error) {
 	// 对输入 input 进行语法解析，得到 AST 语法树。
-	tree, err := parser.ParseWithConfig(input, config)
+	tree, err := parser.ParseContext(ctx, input, config)
 	if err != nil {
 		return tree, err
 	}
+	return tree, PatchCheckContext(ctx, tree, config)
+}
+
+// PatchCheck applies all provided patchers to a parsed tree and checks its
+// types, the same way ParseCheck does after parsing.
+func PatchCheck(tree *parser.Tree, config *conf.Config) error {
+	return PatchCheckContext(context.Background(), tree, config)
+}
+
+// PatchCheckContext is PatchCheck, aborting once ctx is done. See
+// ParseCheckContext.
+func PatchCheckContext(ctx context.Context, tree *parser.Tree, config *conf.Config) error {
+	// 按配置的配额（如多租户场景下的限制）校验用户编写的原始表达式。
+	if err := CheckQuota(tree.Node, config.Quota); err != nil {
+		return err
+	}
 
 	// 对 AST 语法树执行 visitor/patcher（访问器/补丁器）。
 	// 分两步跑：
@@ -92,18 +124,28 @@ func ParseCheck(input string, config *conf.Config) (*parser.Tree, error) {
 	//	- 再运行需要多次修正的（true），比如运算符 patch（有些地方需要迭代多次调整 AST 才能确定正确结构，比如运算符优先级和结合性）。
 	if len(config.Visitors) > 0 {
 		// Run all patchers that don't support being run repeatedly first
-		runVisitors(tree, config, false)
+		if err := runVisitors(ctx, tree, config, false); err != nil {
+			return err
+		}
 		// Run patchers that require multiple passes next (currently only Operator patching)
-		runVisitors(tree, config, true)
+		if err := runVisitors(ctx, tree, config, true); err != nil {
+			return err
+		}
 	}
 
 	// 对 AST 做类型检查。
-	_, err = Check(tree, config)
-	if err != nil {
-		return tree, err
+	if _, err := CheckContext(ctx, tree, config); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := CheckSensitive(tree, config); err != nil {
+		return err
 	}
 
-	return tree, nil
+	// 对类型检查后的 AST 做静态分析，报告可疑的表达式。
+	return Analyze(tree, config)
 }
 
 // Check checks types of the expression tree. It returns type of the expression
@@ -111,12 +153,21 @@ func ParseCheck(input string, config *conf.Config) (*parser.Tree, error) {
 //
 // Check 函数是类型检查的入口点，它接收 AST 树和配置，进行全面的类型检查，并返回表达式的最终类型。
 func Check(tree *parser.Tree, config *conf.Config) (reflect.Type, error) {
+	return CheckContext(context.Background(), tree, config)
+}
+
+// CheckContext checks types like Check, aborting once ctx is done. See
+// ParseCheckContext.
+func CheckContext(ctx context.Context, tree *parser.Tree, config *conf.Config) (reflect.Type, error) {
 	if config == nil {
 		config = conf.New(nil)
 	}
 
-	v := &checker{config: config}
+	v := &checker{config: config, ctx: ctx}
 	nt := v.visit(tree.Node)
+	if v.canceled != nil {
+		return nil, v.canceled
+	}
 
 	// To keep compatibility with previous versions, we should return any, if nature is unknown.
 	// 兼容性处理：未知类型返回 interface{}
@@ -157,9 +208,16 @@ type checker struct {
 	config          *conf.Config     // 配置信息
 	predicateScopes []predicateScope // 谓词作用域栈
 	varScopes       []varScope       // 变量作用域栈
+	functions       int              // Depth of bodies of functions defined in the expression.
 	err             *file.Error      // 错误信息
+	ctx             context.Context
+	visited         int   // Number of visited nodes, to check ctx between batches of them.
+	canceled        error // Error of ctx, once it is done.
 }
 
+// contextBatch is the number of nodes visited between checks of the context.
+const contextBatch = 256
+
 type predicateScope struct {
 	collection Nature            // 集合类型
 	vars       map[string]Nature // 变量类型
@@ -183,6 +241,17 @@ type info struct {
 
 // 对所有 AST 节点类型进行检查
 func (v *checker) visit(node ast.Node) Nature {
+	if v.canceled != nil {
+		return unknown
+	}
+	v.visited++
+	if v.visited%contextBatch == 0 && v.ctx != nil {
+		if err := v.ctx.Err(); err != nil {
+			v.canceled = err
+			return unknown
+		}
+	}
+
 	var nt Nature
 	switch n := node.(type) {
 	case *ast.NilNode:
@@ -215,14 +284,22 @@ func (v *checker) visit(node ast.Node) Nature {
 		nt = v.BuiltinNode(n)
 	case *ast.PredicateNode:
 		nt = v.PredicateNode(n)
+	case *ast.FunctionNode:
+		nt = v.FunctionNode(n)
 	case *ast.PointerNode:
 		nt = v.PointerNode(n)
+	case *ast.PlaceholderNode:
+		nt = v.error(n, "placeholder :%v is not bound", n.Name)
 	case *ast.VariableDeclaratorNode:
 		nt = v.VariableDeclaratorNode(n)
 	case *ast.SequenceNode:
 		nt = v.SequenceNode(n)
 	case *ast.ConditionalNode:
 		nt = v.ConditionalNode(n)
+	case *ast.SwitchNode:
+		nt = v.SwitchNode(n)
+	case *ast.OpcodeNode:
+		nt = v.OpcodeNode(n)
 	case *ast.ArrayNode:
 		nt = v.ArrayNode(n)
 	case *ast.MapNode:
@@ -273,9 +350,18 @@ func (v *checker) IdentifierNode(node *ast.IdentifierNode) Nature {
 // ∙ strict: 是否启用严格模式（找不到时是否报错）
 // ∙ builtins: 是否查找内置函数
 func (v *checker) ident(node ast.Node, name string, strict, builtins bool) Nature {
+	// Names of a resolver env are typed by its TypeOf, if it has one.
+	if typer, ok := v.config.EnvObject.(runtime.FieldTyper); ok {
+		if _, ok := v.config.EnvObject.(runtime.FieldResolver); ok {
+			if t, ok := typer.TypeOf(name); ok {
+				return Nature{Type: t}
+			}
+		}
+	}
+
 	// 首先在环境变量中查找标识符
 	//	∙ v.config.Env 是预先配置的类型环境，通常包含全局变量和自定义函数，找到直接返回对应的 Nature 类型
-	if nt, ok := v.config.Env.Get(name); ok {
+	if nt, ok := v.config.Env.Get(name, v.config.FieldTags...); ok {
 		return nt
 	}
 
@@ -284,7 +370,7 @@ func (v *checker) ident(node ast.Node, name string, strict, builtins bool) Natur
 	//	∙ 然后在系统内置函数 (Builtins) 中查找
 	//	∙ 返回的函数类型包含函数签名和函数对象本身
 	if builtins {
-		if fn, ok := v.config.Functions[name]; ok {
+		if fn, ok := v.config.Function(name); ok {
 			return Nature{Type: fn.Type(), Func: fn}
 		}
 		if fn, ok := v.config.Builtins[name]; ok {
@@ -292,6 +378,15 @@ func (v *checker) ident(node ast.Node, name string, strict, builtins bool) Natur
 		}
 	}
 
+	// Names of the env which differ only by case, like user for User.
+	if names := v.fold(v.config.Env, name); len(names) == 1 {
+		rename(node, names[0])
+		nt, _ := v.config.Env.Get(names[0], v.config.FieldTags...)
+		return nt
+	} else if len(names) > 1 {
+		return v.error(node, "name %v is ambiguous (%v)", name, strings.Join(names, ", "))
+	}
+
 	// 标识符未找到，在严格模式下报错
 	if v.config.Strict && strict {
 		return v.error(node, "unknown name %v", name)
@@ -301,6 +396,29 @@ func (v *checker) ident(node ast.Node, name string, strict, builtins bool) Natur
 	return unknown
 }
 
+// fold returns the names of the fields of base which differ from name only
+// by case, if conf.Config.CaseInsensitiveFields is set.
+func (v *checker) fold(base Nature, name string) []string {
+	if !v.config.CaseInsensitiveFields {
+		return nil
+	}
+	return base.FoldName(name, v.config.FieldTags...)
+}
+
+// rename replaces the name of an identifier, or of the property of a member,
+// by the name it resolved to case-insensitively, so the compiler and the VM
+// fetch it exactly.
+func rename(node ast.Node, name string) {
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		n.Value = name
+	case *ast.MemberNode:
+		if prop, ok := n.Property.(*ast.StringNode); ok {
+			prop.Value = name
+		}
+	}
+}
+
 func (v *checker) IntegerNode(*ast.IntegerNode) Nature {
 	return integerNature
 }
@@ -323,6 +441,15 @@ func (v *checker) ConstantNode(node *ast.ConstantNode) Nature {
 
 func (v *checker) UnaryNode(node *ast.UnaryNode) Nature {
 	nt := v.visit(node.Node)
+	if isUnion(nt) {
+		return v.each([]Nature{nt}, func(m []Nature) Nature {
+			return v.unary(node, m[0])
+		})
+	}
+	return v.unary(node, nt)
+}
+
+func (v *checker) unary(node *ast.UnaryNode, nt Nature) Nature {
 	nt = nt.Deref()
 
 	switch node.Operator {
@@ -339,6 +466,9 @@ func (v *checker) UnaryNode(node *ast.UnaryNode) Nature {
 		if isNumber(nt) {
 			return nt
 		}
+		if isDecimal(nt) {
+			return decimalNature
+		}
 		if isUnknown(nt) {
 			return unknown
 		}
@@ -358,14 +488,33 @@ func (v *checker) BinaryNode(node *ast.BinaryNode) Nature {
 	l := v.visit(node.Left)  // 检查左操作数
 	r := v.visit(node.Right) // 检查右操作数
 
+	if isUnion(l) || isUnion(r) {
+		check := func(m []Nature) Nature {
+			return v.binary(node, m[0], m[1])
+		}
+		switch node.Operator {
+		case "==", "!=", "in":
+			// A union can be compared with a value of one of its members.
+			return v.some([]Nature{l, r}, check)
+		}
+		return v.each([]Nature{l, r}, check)
+	}
+	return v.binary(node, l, r)
+}
+
+func (v *checker) binary(node *ast.BinaryNode, l, r Nature) Nature {
 	l = l.Deref() // 解引用指针类型
 	r = r.Deref() // 解引用指针类型
 
 	switch node.Operator {
 	case "==", "!=": // bool
+		l, r := comparable(l, r, untyped(node.Left), untyped(node.Right))
 		if isComparable(l, r) { // 检查是否可比较
 			return boolNature
 		}
+		if decimals(l, r) {
+			return boolNature
+		}
 
 	case "or", "||", "and", "&&": // bool
 		if isBool(l) && isBool(r) { // 两个操作数都必须是布尔类型
@@ -376,19 +525,26 @@ func (v *checker) BinaryNode(node *ast.BinaryNode) Nature {
 		}
 
 	case "<", ">", ">=", "<=": // bool
+		l, r := comparable(l, r, untyped(node.Left), untyped(node.Right))
 		if isNumber(l) && isNumber(r) {
 			return boolNature
 		}
 		if isString(l) && isString(r) {
 			return boolNature
 		}
+		if isBytes(l) && isBytes(r) {
+			return boolNature
+		}
 		if isTime(l) && isTime(r) {
 			return boolNature
 		}
 		if isDuration(l) && isDuration(r) {
 			return boolNature
 		}
-		if or(l, r, isNumber, isString, isTime, isDuration) {
+		if decimals(l, r) {
+			return boolNature
+		}
+		if or(l, r, isNumber, isString, isBytes, isTime, isDuration, isDecimal) {
 			return boolNature
 		}
 
@@ -396,6 +552,9 @@ func (v *checker) BinaryNode(node *ast.BinaryNode) Nature {
 		if isNumber(l) && isNumber(r) {
 			return combined(l, r)
 		}
+		if decimals(l, r) {
+			return decimalNature
+		}
 		if isTime(l) && isTime(r) {
 			return durationNature
 		}
@@ -405,7 +564,7 @@ func (v *checker) BinaryNode(node *ast.BinaryNode) Nature {
 		if isDuration(l) && isDuration(r) {
 			return durationNature
 		}
-		if or(l, r, isNumber, isTime, isDuration) {
+		if or(l, r, isNumber, isTime, isDuration, isDecimal) {
 			return unknown
 		}
 
@@ -413,6 +572,9 @@ func (v *checker) BinaryNode(node *ast.BinaryNode) Nature {
 		if isNumber(l) && isNumber(r) {
 			return combined(l, r)
 		}
+		if decimals(l, r) {
+			return decimalNature
+		}
 		if isNumber(l) && isDuration(r) {
 			return durationNature
 		}
@@ -422,7 +584,7 @@ func (v *checker) BinaryNode(node *ast.BinaryNode) Nature {
 		if isDuration(l) && isDuration(r) {
 			return durationNature
 		}
-		if or(l, r, isNumber, isDuration) {
+		if or(l, r, isNumber, isDuration, isDecimal) {
 			return unknown
 		}
 
@@ -430,9 +592,15 @@ func (v *checker) BinaryNode(node *ast.BinaryNode) Nature {
 		if isNumber(l) && isNumber(r) {
 			return floatNature
 		}
+		if decimals(l, r) {
+			return decimalNature
+		}
 		if or(l, r, isNumber) {
 			return floatNature
 		}
+		if or(l, r, isDecimal) {
+			return unknown
+		}
 
 	case "**", "^":
 		if isNumber(l) && isNumber(r) {
@@ -454,9 +622,15 @@ func (v *checker) BinaryNode(node *ast.BinaryNode) Nature {
 		if isNumber(l) && isNumber(r) {
 			return combined(l, r)
 		}
+		if decimals(l, r) {
+			return decimalNature
+		}
 		if isString(l) && isString(r) {
 			return stringNature
 		}
+		if isBytes(l) && isBytes(r) {
+			return bytesNature
+		}
 		if isTime(l) && isDuration(r) {
 			return timeNature
 		}
@@ -466,7 +640,7 @@ func (v *checker) BinaryNode(node *ast.BinaryNode) Nature {
 		if isDuration(l) && isDuration(r) {
 			return durationNature
 		}
-		if or(l, r, isNumber, isString, isTime, isDuration) {
+		if or(l, r, isNumber, isString, isBytes, isTime, isDuration, isDecimal) {
 			return unknown
 		}
 
@@ -479,13 +653,13 @@ func (v *checker) BinaryNode(node *ast.BinaryNode) Nature {
 			return boolNature
 		}
 		if isMap(r) {
-			if !isUnknown(l) && !l.AssignableTo(r.Key()) {
+			if key, elem := comparable(l, r.Key(), untyped(node.Left), untyped(node.Right)); !isUnknown(l) && !key.AssignableTo(elem) {
 				return v.error(node, "cannot use %v as type %v in map key", l, r.Key())
 			}
 			return boolNature
 		}
 		if isArray(r) {
-			if !isComparable(l, r.Elem()) {
+			if !isComparable(comparable(l, r.Elem(), untyped(node.Left), untyped(node.Right))) {
 				return v.error(node, "cannot use %v as type %v in array", l, r.Elem())
 			}
 			return boolNature
@@ -504,6 +678,11 @@ func (v *checker) BinaryNode(node *ast.BinaryNode) Nature {
 			if err != nil {
 				return v.error(node, err.Error())
 			}
+			if v.config != nil && v.config.Regexps != nil {
+				if _, err := v.config.Regexps.Check(s.Value); err != nil {
+					return v.error(node.Right, "%v", err)
+				}
+			}
 		}
 		if isString(l) && isString(r) {
 			return boolNature
@@ -529,16 +708,19 @@ func (v *checker) BinaryNode(node *ast.BinaryNode) Nature {
 		}
 
 	case "??":
+		// The result may be nil only if the default may be nil.
 		if isNil(l) && !isNil(r) {
 			return r
 		}
 		if !isNil(l) && isNil(r) {
+			l.Nullable = true
 			return l
 		}
 		if isNil(l) && isNil(r) {
 			return nilNature
 		}
 		if r.AssignableTo(l) {
+			l.Nullable = r.Nullable
 			return l
 		}
 		return unknown
@@ -551,8 +733,11 @@ func (v *checker) BinaryNode(node *ast.BinaryNode) Nature {
 	return v.error(node, `invalid operation: %v (mismatched types %v and %v)`, node.Operator, l, r)
 }
 
+// ChainNode is nil if any optional member of the chain is nil.
 func (v *checker) ChainNode(node *ast.ChainNode) Nature {
-	return v.visit(node.Node)
+	nt := v.visit(node.Node)
+	nt.Nullable = true
+	return nt
 }
 
 // MemberNode 根据基节点类型（如 $env、map、数组、结构体等）和属性信息推断成员类型，返回对应字段/方法的类型 (Nature) 或者报错。
@@ -579,6 +764,16 @@ func (v *checker) MemberNode(node *ast.MemberNode) Nature {
 	base := v.visit(node.Node)     // 先推断基对象类型
 	prop := v.visit(node.Property) // 再推断属性类型
 
+	if isUnion(base) {
+		// Every member of the union must have the member.
+		return v.each([]Nature{base}, func(m []Nature) Nature {
+			return v.member(node, m[0], prop)
+		})
+	}
+	return v.member(node, base, prop)
+}
+
+func (v *checker) member(node *ast.MemberNode, base, prop Nature) Nature {
 	if isUnknown(base) { // 如果 base 是未知类型，直接返回 unknown。
 		return unknown
 	}
@@ -613,13 +808,21 @@ func (v *checker) MemberNode(node *ast.MemberNode) Nature {
 		if prop, ok := node.Property.(*ast.StringNode); ok {
 			if field, ok := base.Fields[prop.Value]; ok {
 				return field
+			} else if names := v.fold(base, prop.Value); len(names) == 1 {
+				rename(node, names[0])
+				return base.Fields[names[0]]
+			} else if len(names) > 1 {
+				return v.error(node.Property, "field %v of %v is ambiguous (%v)", prop.Value, base, strings.Join(names, ", "))
 			} else if base.Strict {
 				return v.error(node.Property, "unknown field %v", prop.Value)
 			}
 		}
 
-		// 否则，直接返回 map 的值类型，作为默认类型返回
-		return base.Elem()
+		// 否则，直接返回 map 的值类型，作为默认类型返回。
+		// Missing keys of maps of pointers are nil pointers.
+		elem := base.Elem()
+		elem.Nullable = elem.Kind() == reflect.Ptr
+		return elem
 
 	case reflect.Array, reflect.Slice:
 		// 检查：对于数组来说，prop 必须是整数或者 unknown ，因为它是作为索引下标来用的。
@@ -634,8 +837,15 @@ func (v *checker) MemberNode(node *ast.MemberNode) Nature {
 		if name, ok := node.Property.(*ast.StringNode); ok {
 			propertyName := name.Value
 			// 在结构体中查找目标字段
-			if field, ok := base.FieldByName(propertyName); ok {
+			if field, ok := base.FieldByName(propertyName, v.config.FieldTags...); ok {
+				return Nature{Type: field.Type}
+			}
+			if names := v.fold(base, propertyName); len(names) == 1 {
+				rename(node, names[0])
+				field, _ := base.FieldByName(names[0], v.config.FieldTags...)
 				return Nature{Type: field.Type}
+			} else if len(names) > 1 {
+				return v.error(node, "field %v of %v is ambiguous (%v)", propertyName, base, strings.Join(names, ", "))
 			}
 			if node.Method {
 				return v.error(node, "type %v has no method %v", base, propertyName)
@@ -693,6 +903,16 @@ func (v *checker) SliceNode(node *ast.SliceNode) Nature {
 func (v *checker) CallNode(node *ast.CallNode) Nature {
 	nt := v.functionReturnType(node)
 
+	if v.config != nil && v.config.PurePredicates && node.Callee.Nature().Closure == 0 {
+		// Functions defined in the expression can be called in predicates,
+		// so their bodies are pure as well.
+		if name, ok := v.pureCallee(node); !ok && len(v.predicateScopes) > 0 {
+			return v.error(node, "cannot call %v in predicate: function is not pure", name)
+		} else if !ok && v.functions > 0 {
+			return v.error(node, "cannot call %v in function: function is not pure", name)
+		}
+	}
+
 	// Check if type was set on node (for example, by patcher)
 	// and use node type instead of function return type.
 	//
@@ -711,6 +931,26 @@ func (v *checker) CallNode(node *ast.CallNode) Nature {
 	return nt
 }
 
+// pureCallee reports whether the callee of node is marked as pure.
+func (v *checker) pureCallee(node *ast.CallNode) (string, bool) {
+	name := node.Callee.String()
+	switch callee := node.Callee.(type) {
+	case *ast.IdentifierNode:
+		name = callee.Value
+	case *ast.MemberNode:
+		if prop, ok := callee.Property.(*ast.StringNode); ok {
+			name = prop.Value
+		}
+	default:
+		return name, false
+	}
+	if v.config.Pure[name] {
+		return name, true
+	}
+	_, ok := v.config.ConstFns[name]
+	return name, ok
+}
+
 // functionReturnType() 作用：
 // ∙ 确定被调对象的类型：函数、方法或可调用对象
 // ∙ 检查函数调用合法性：验证是否可以调用
@@ -726,6 +966,16 @@ func (v *checker) functionReturnType(node *ast.CallNode) Nature {
 	// 先检查和推导被调对象 node.Callee ，如 foo() 里的 foo，或者 obj.bar() 里的 obj.bar，得到 Nature 。
 	nt := v.visit(node.Callee)
 
+	// Disabled builtins, see conf.Config.WithBuiltinProfile, are not
+	// callable, even as unknown names of non-strict envs.
+	if id, ok := node.Callee.(*ast.IdentifierNode); ok && isUnknown(nt) && v.config.Disabled[id.Value] {
+		if _, isVariable := v.lookupVariable(id.Value); !isVariable {
+			if _, isBuiltin := builtin.Index[id.Value]; isBuiltin {
+				return v.error(node, "builtin %v is not allowed", id.Value)
+			}
+		}
+	}
+
 	// 如果 nt 中 Func 非空，说明这是个已知的、预定义的函数（内置函数、用户注册函数、特殊优化函数），直接调用 checkFunction 检查参数并返回类型。
 	// 这是对已知的、预定义的函数的简化处理，而普通的 func 走 reflect.Func 分支。
 	//
@@ -733,6 +983,9 @@ func (v *checker) functionReturnType(node *ast.CallNode) Nature {
 	if nt.Func != nil {
 		return v.checkFunction(nt.Func, node, node.Arguments)
 	}
+	if nt.Closure > 0 {
+		return v.checkClosureCall(nt, node)
+	}
 
 	// 如果 Callee 是标识符，如 foo() 中的 foo ，就取标识符名 foo 作为 fnName 。
 	// 如果 Callee 是对象成员调用，如 obj.bar() 里的 obj.bar ，就取成员名字 bar 作为 fnName 。
@@ -762,6 +1015,10 @@ func (v *checker) functionReturnType(node *ast.CallNode) Nature {
 	// 否则，报错：xxx is not callable。
 	switch nt.Kind() {
 	case reflect.Func:
+		if v.config != nil && v.config.InjectContext && ContextParam(nt.Type, nt.Method) {
+			// The VM passes the context of the run.
+			nt = withoutContext(nt)
+		}
 		outType, err := v.checkArguments(fnName, nt, node.Arguments, node)
 		if err != nil {
 			if v.err == nil {
@@ -774,6 +1031,26 @@ func (v *checker) functionReturnType(node *ast.CallNode) Nature {
 	return v.error(node, "%s is not callable", nt)
 }
 
+// checkClosureCall checks a call of a function defined in the expression.
+// Its parameters are of unknown types, so only the number of arguments is
+// checked.
+func (v *checker) checkClosureCall(nt Nature, node *ast.CallNode) Nature {
+	name := "function"
+	if identifier, ok := node.Callee.(*ast.IdentifierNode); ok {
+		name = identifier.Value
+	}
+	for _, arg := range node.Arguments {
+		v.visit(arg)
+	}
+	if len(node.Arguments) < nt.Closure {
+		return v.error(node, "not enough arguments to call %v", name)
+	}
+	if len(node.Arguments) > nt.Closure {
+		return v.error(node, "too many arguments to call %v", name)
+	}
+	return *nt.PredicateOut
+}
+
 // 为什么谓词需要作用域管理?
 //
 //
@@ -859,6 +1136,9 @@ func (v *checker) functionReturnType(node *ast.CallNode) Nature {
 
 // BuiltinNode 校验内置函数（all、map、reduce、filter 等）的参数类型，获取其返回类型。
 func (v *checker) BuiltinNode(node *ast.BuiltinNode) Nature {
+	if v.config.Disabled[node.Name] {
+		return v.error(node, "builtin %v is not allowed", node.Name)
+	}
 	switch node.Name {
 	// 功能说明：
 	// ∙ all：检查集合中所有元素是否满足谓词条件
@@ -870,7 +1150,7 @@ func (v *checker) BuiltinNode(node *ast.BuiltinNode) Nature {
 		// node.Arguments[0] 是函数调用的第一个参数，一般是数组类型。
 		// v.visit(...) 会返回这个参数的 Nature 类型信息。
 		// Deref() 会获取数组本身的类型（去掉指针/包装类型），方便做后续类型检查。
-		collection := v.visit(node.Arguments[0]).Deref()
+		collection := v.array(node, v.visit(node.Arguments[0]).Deref())
 
 		// all/any/none/one 的第一个参数必须是数组，否则报错。
 		// isUnknown(collection) 是防御性处理：如果类型未知，则先允许通过，不报错。
@@ -899,8 +1179,8 @@ func (v *checker) BuiltinNode(node *ast.BuiltinNode) Nature {
 
 			// all/any/none/one 的 predicate 必须返回布尔值。
 			// isUnknown 依然是防御性处理：如果返回类型未知也允许通过。
-			if !isBool(predicate.Out(0)) && !isUnknown(predicate.Out(0)) {
-				return v.error(node.Arguments[1], "predicate should return boolean (got %v)", predicate.Out(0).String())
+			if !v.bools(node.Arguments[1], predicateOut(predicate), "predicate should return boolean (got %v)") {
+				return unknown
 			}
 
 			// all/any/none/one 的返回类型都是布尔型。
@@ -910,8 +1190,8 @@ func (v *checker) BuiltinNode(node *ast.BuiltinNode) Nature {
 		// 如果 predicate 不符合签名，报错：predicate 必须是 1 入 1 出的函数。
 		return v.error(node.Arguments[1], "predicate should has one input and one output param")
 
-	case "filter":
-		collection := v.visit(node.Arguments[0]).Deref()
+	case "filter", "takeWhile", "dropWhile":
+		collection := v.array(node, v.visit(node.Arguments[0]).Deref())
 		if !isArray(collection) && !isUnknown(collection) {
 			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
 		}
@@ -924,8 +1204,8 @@ func (v *checker) BuiltinNode(node *ast.BuiltinNode) Nature {
 			predicate.NumOut() == 1 &&
 			predicate.NumIn() == 1 && isUnknown(predicate.In(0)) {
 
-			if !isBool(predicate.Out(0)) && !isUnknown(predicate.Out(0)) {
-				return v.error(node.Arguments[1], "predicate should return boolean (got %v)", predicate.Out(0).String())
+			if !v.bools(node.Arguments[1], predicateOut(predicate), "predicate should return boolean (got %v)") {
+				return unknown
 			}
 			if isUnknown(collection) {
 				return arrayNature
@@ -938,7 +1218,7 @@ func (v *checker) BuiltinNode(node *ast.BuiltinNode) Nature {
 		// 假设我们要对 `map([1,2,3], (item, index) => item * 2)` 做类型检查
 
 		// 1. 处理第一个参数（集合：[1,2,3]），获取其类型（整数数组）
-		collection := v.visit(node.Arguments[0]).Deref()
+		collection := v.array(node, v.visit(node.Arguments[0]).Deref())
 		if !isArray(collection) && !isUnknown(collection) {
 			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
 		}
@@ -973,7 +1253,7 @@ func (v *checker) BuiltinNode(node *ast.BuiltinNode) Nature {
 		return v.error(node.Arguments[1], "predicate should has one input and one output param")
 
 	case "count":
-		collection := v.visit(node.Arguments[0]).Deref()
+		collection := v.array(node, v.visit(node.Arguments[0]).Deref())
 		if !isArray(collection) && !isUnknown(collection) {
 			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
 		}
@@ -989,8 +1269,8 @@ func (v *checker) BuiltinNode(node *ast.BuiltinNode) Nature {
 		if isFunc(predicate) &&
 			predicate.NumOut() == 1 &&
 			predicate.NumIn() == 1 && isUnknown(predicate.In(0)) {
-			if !isBool(predicate.Out(0)) && !isUnknown(predicate.Out(0)) {
-				return v.error(node.Arguments[1], "predicate should return boolean (got %v)", predicate.Out(0).String())
+			if !v.bools(node.Arguments[1], predicateOut(predicate), "predicate should return boolean (got %v)") {
+				return unknown
 			}
 
 			return integerNature
@@ -998,7 +1278,7 @@ func (v *checker) BuiltinNode(node *ast.BuiltinNode) Nature {
 		return v.error(node.Arguments[1], "predicate should has one input and one output param")
 
 	case "sum":
-		collection := v.visit(node.Arguments[0]).Deref()
+		collection := v.array(node, v.visit(node.Arguments[0]).Deref())
 		if !isArray(collection) && !isUnknown(collection) {
 			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
 		}
@@ -1020,8 +1300,14 @@ func (v *checker) BuiltinNode(node *ast.BuiltinNode) Nature {
 			return collection.Elem()
 		}
 
-	case "find", "findLast":
-		collection := v.visit(node.Arguments[0]).Deref()
+	case "min", "max", "mean", "median":
+		if len(node.Arguments) != 2 {
+			break
+		}
+		if _, ok := node.Arguments[1].(*ast.PredicateNode); !ok {
+			break
+		}
+		collection := v.array(node, v.visit(node.Arguments[0]).Deref())
 		if !isArray(collection) && !isUnknown(collection) {
 			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
 		}
@@ -1034,18 +1320,47 @@ func (v *checker) BuiltinNode(node *ast.BuiltinNode) Nature {
 			predicate.NumOut() == 1 &&
 			predicate.NumIn() == 1 && isUnknown(predicate.In(0)) {
 
-			if !isBool(predicate.Out(0)) && !isUnknown(predicate.Out(0)) {
-				return v.error(node.Arguments[1], "predicate should return boolean (got %v)", predicate.Out(0).String())
+			out := predicate.Out(0)
+			if basic, _ := underlying(out); !isNumber(basic) && !isUnknown(out) {
+				return v.error(node.Arguments[1], "predicate should return number (got %v)", out.String())
 			}
-			if isUnknown(collection) {
+			switch node.Name {
+			case "mean", "median":
+				return floatNature
+			}
+			return out
+		}
+		return v.error(node.Arguments[1], "predicate should has one input and one output param")
+
+	case "find", "findLast":
+		collection := v.array(node, v.visit(node.Arguments[0]).Deref())
+		if !isArray(collection) && !isUnknown(collection) {
+			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
+		}
+
+		v.begin(collection)
+		predicate := v.visit(node.Arguments[1])
+		v.end()
+
+		if isFunc(predicate) &&
+			predicate.NumOut() == 1 &&
+			predicate.NumIn() == 1 && isUnknown(predicate.In(0)) {
+
+			if !v.bools(node.Arguments[1], predicateOut(predicate), "predicate should return boolean (got %v)") {
 				return unknown
 			}
-			return collection.Elem()
+			// Nothing found is nil.
+			out := unknown
+			if !isUnknown(collection) {
+				out = collection.Elem()
+			}
+			out.Nullable = true
+			return out
 		}
 		return v.error(node.Arguments[1], "predicate should has one input and one output param")
 
 	case "findIndex", "findLastIndex":
-		collection := v.visit(node.Arguments[0]).Deref()
+		collection := v.array(node, v.visit(node.Arguments[0]).Deref())
 		if !isArray(collection) && !isUnknown(collection) {
 			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
 		}
@@ -1058,15 +1373,15 @@ func (v *checker) BuiltinNode(node *ast.BuiltinNode) Nature {
 			predicate.NumOut() == 1 &&
 			predicate.NumIn() == 1 && isUnknown(predicate.In(0)) {
 
-			if !isBool(predicate.Out(0)) && !isUnknown(predicate.Out(0)) {
-				return v.error(node.Arguments[1], "predicate should return boolean (got %v)", predicate.Out(0).String())
+			if !v.bools(node.Arguments[1], predicateOut(predicate), "predicate should return boolean (got %v)") {
+				return unknown
 			}
 			return integerNature
 		}
 		return v.error(node.Arguments[1], "predicate should has one input and one output param")
 
 	case "groupBy":
-		collection := v.visit(node.Arguments[0]).Deref()
+		collection := v.array(node, v.visit(node.Arguments[0]).Deref())
 		if !isArray(collection) && !isUnknown(collection) {
 			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
 		}
@@ -1084,8 +1399,53 @@ func (v *checker) BuiltinNode(node *ast.BuiltinNode) Nature {
 		}
 		return v.error(node.Arguments[1], "predicate should has one input and one output param")
 
+	case "uniqBy":
+		collection := v.array(node, v.visit(node.Arguments[0]).Deref())
+		if !isArray(collection) && !isUnknown(collection) {
+			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
+		}
+
+		v.begin(collection)
+		predicate := v.visit(node.Arguments[1])
+		v.end()
+
+		if isFunc(predicate) &&
+			predicate.NumOut() == 1 &&
+			predicate.NumIn() == 1 && isUnknown(predicate.In(0)) {
+
+			if isUnknown(collection) {
+				return arrayNature
+			}
+			return arrayOf(collection.Elem())
+		}
+		return v.error(node.Arguments[1], "predicate should has one input and one output param")
+
+	case "partition":
+		collection := v.array(node, v.visit(node.Arguments[0]).Deref())
+		if !isArray(collection) && !isUnknown(collection) {
+			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
+		}
+
+		v.begin(collection)
+		predicate := v.visit(node.Arguments[1])
+		v.end()
+
+		if isFunc(predicate) &&
+			predicate.NumOut() == 1 &&
+			predicate.NumIn() == 1 && isUnknown(predicate.In(0)) {
+
+			if !v.bools(node.Arguments[1], predicateOut(predicate), "predicate should return boolean (got %v)") {
+				return unknown
+			}
+			if isUnknown(collection) {
+				return arrayOf(arrayNature)
+			}
+			return arrayOf(arrayOf(collection.Elem()))
+		}
+		return v.error(node.Arguments[1], "predicate should has one input and one output param")
+
 	case "sortBy":
-		collection := v.visit(node.Arguments[0]).Deref()
+		collection := v.array(node, v.visit(node.Arguments[0]).Deref())
 		if !isArray(collection) && !isUnknown(collection) {
 			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
 		}
@@ -1095,7 +1455,16 @@ func (v *checker) BuiltinNode(node *ast.BuiltinNode) Nature {
 		v.end()
 
 		if len(node.Arguments) == 3 {
+			// An order, or one order for each key of array keys.
 			_ = v.visit(node.Arguments[2])
+			keys, ok := node.Arguments[1].(*ast.PredicateNode)
+			if ok {
+				keys, ok := keys.Node.(*ast.ArrayNode)
+				orders, isArray := node.Arguments[2].(*ast.ArrayNode)
+				if ok && isArray && len(orders.Nodes) != len(keys.Nodes) {
+					return v.error(node.Arguments[2], "invalid number of orders (expected %d, got %d)", len(keys.Nodes), len(orders.Nodes))
+				}
+			}
 		}
 
 		if isFunc(predicate) &&
@@ -1107,7 +1476,7 @@ func (v *checker) BuiltinNode(node *ast.BuiltinNode) Nature {
 		return v.error(node.Arguments[1], "predicate should has one input and one output param")
 
 	case "reduce":
-		collection := v.visit(node.Arguments[0]).Deref()
+		collection := v.array(node, v.visit(node.Arguments[0]).Deref())
 		if !isArray(collection) && !isUnknown(collection) {
 			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
 		}
@@ -1131,6 +1500,28 @@ func (v *checker) BuiltinNode(node *ast.BuiltinNode) Nature {
 		switch node.Name {
 		case "get":
 			return v.checkBuiltinGet(node)
+		case "fromJSON":
+			return v.checkBuiltinFromJSON(node)
+		case "format":
+			return v.checkBuiltinFormat(node)
+		case "sort":
+			if len(node.Arguments) == 2 {
+				if compare := v.visit(node.Arguments[1]); compare.Closure > 0 || isFunc(compare) {
+					return v.checkBuiltinSortFunc(node, compare)
+				}
+			}
+		}
+		if builtin.Regexps[node.Name] && len(node.Arguments) > 1 {
+			if s, ok := node.Arguments[1].(*ast.StringNode); ok {
+				if _, err := regexp.Compile(s.Value); err != nil {
+					return v.error(node.Arguments[1], "%v", err)
+				}
+				if v.config != nil && v.config.Regexps != nil {
+					if _, err := v.config.Regexps.Check(s.Value); err != nil {
+						return v.error(node.Arguments[1], "%v", err)
+					}
+				}
+			}
 		}
 		return v.checkFunction(builtin.Builtins[id], node, node.Arguments)
 	}
@@ -1163,6 +1554,81 @@ func (v *checker) end() {
 	v.predicateScopes = v.predicateScopes[:len(v.predicateScopes)-1]
 }
 
+// checkBuiltinFromJSON checks fromJSON. A document given as a string literal
+// is decoded when the expression is compiled, so its nature is known: a map
+// or an array with elements of unknown types, or a scalar.
+func (v *checker) checkBuiltinFromJSON(node *ast.BuiltinNode) Nature {
+	nt := v.checkFunction(builtin.Builtins[builtin.Index["fromJSON"]], node, node.Arguments)
+	if v.err != nil || len(node.Arguments) != 1 {
+		return nt
+	}
+	s, ok := node.Arguments[0].(*ast.StringNode)
+	if !ok {
+		return nt
+	}
+	var doc any
+	if err := json.Unmarshal([]byte(s.Value), &doc); err != nil {
+		return v.error(node.Arguments[0], "invalid JSON: %v", err)
+	}
+	switch doc.(type) {
+	case map[string]any:
+		return mapNature
+	case []any:
+		return arrayNature
+	case nil:
+		return nilNature
+	}
+	return Nature{Type: reflect.TypeOf(doc)}
+}
+
+// checkBuiltinSortFunc checks sort with a comparator, like
+// sort(users, (a, b) => a.Age - b.Age), which returns a number.
+func (v *checker) checkBuiltinSortFunc(node *ast.BuiltinNode, compare Nature) Nature {
+	collection := v.array(node, v.visit(node.Arguments[0]).Deref())
+	if !isArray(collection) && !isUnknown(collection) {
+		return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, collection)
+	}
+
+	var out Nature
+	switch {
+	case compare.Closure > 0 && compare.Closure != 2:
+		return v.error(node.Arguments[1], "comparator should have two params (got %d)", compare.Closure)
+	case compare.Closure > 0:
+		if compare.PredicateOut != nil {
+			out = *compare.PredicateOut
+		}
+	case compare.NumIn() != 2 || compare.NumOut() != 1:
+		return v.error(node.Arguments[1], "comparator should have two input and one output param")
+	default:
+		out = compare.Out(0)
+	}
+	if basic, _ := underlying(out); !isNumber(basic) && !isUnknown(out) {
+		return v.error(node.Arguments[1], "comparator should return number (got %v)", out)
+	}
+
+	if isUnknown(collection) {
+		return arrayNature
+	}
+	return arrayOf(collection.Elem())
+}
+
+// checkBuiltinFormat checks format. The number of arguments is checked
+// against a format given as a string literal.
+func (v *checker) checkBuiltinFormat(node *ast.BuiltinNode) Nature {
+	nt := v.checkFunction(builtin.Builtins[builtin.Index["format"]], node, node.Arguments)
+	if v.err != nil || len(node.Arguments) == 0 {
+		return nt
+	}
+	s, ok := node.Arguments[0].(*ast.StringNode)
+	if !ok {
+		return nt
+	}
+	if n, ok := builtin.FormatArgs(s.Value); ok && n != len(node.Arguments)-1 {
+		return v.error(node, "invalid number of arguments for format %q (expected %d, got %d)", s.Value, n, len(node.Arguments)-1)
+	}
+	return nt
+}
+
 // checkBuiltinGet 检查 get() 内置函数调用是否合法。
 //
 // 在 expr 里，get(collection, key) 的语义和 Go 类似：
@@ -1179,7 +1645,7 @@ func (v *checker) checkBuiltinGet(node *ast.BuiltinNode) Nature {
 
 	if id, ok := node.Arguments[0].(*ast.IdentifierNode); ok && id.Value == "$env" {
 		if s, ok := node.Arguments[1].(*ast.StringNode); ok {
-			if nt, ok := v.config.Env.Get(s.Value); ok {
+			if nt, ok := v.config.Env.Get(s.Value, v.config.FieldTags...); ok {
 				return nt
 			}
 		}
@@ -1297,22 +1763,34 @@ func (v *checker) checkFunction(f *builtin.Function, node ast.Node, arguments []
 	// 如果函数定义了 Validate 回调（一个专门的验证逻辑），就用它来校验参数。
 	// 某些特殊函数（如 len(x)、append(x, y)）参数规则复杂，不好用简单的类型签名描述，就交给 Validate 来判断。
 	if f.Validate != nil {
-		// 获取每个参数的反射类型
-		args := make([]reflect.Type, len(arguments))
+		natures := make([]Nature, len(arguments))
+		unions := false
 		for i, arg := range arguments {
-			argNature := v.visit(arg)
-			if isUnknown(argNature) {
-				args[i] = anyType // 未知类型视为任意类型
-			} else {
-				args[i] = argNature.Type
+			natures[i] = v.visit(arg)
+			unions = unions || isUnion(natures[i])
+		}
+		validate := func(natures []Nature) Nature {
+			// 获取每个参数的反射类型
+			args := make([]reflect.Type, len(natures))
+			for i, argNature := range natures {
+				if isUnknown(argNature) {
+					args[i] = anyType // 未知类型视为任意类型
+				} else {
+					args[i] = argNature.Type
+				}
 			}
+			// 调用自定义验证逻辑
+			t, err := f.Validate(args)
+			if err != nil {
+				return v.error(node, "%v", err)
+			}
+			return Nature{Type: t}
 		}
-		// 调用自定义验证逻辑
-		t, err := f.Validate(args)
-		if err != nil {
-			return v.error(node, "%v", err)
+		if unions {
+			// Every member of the unions must be a valid argument.
+			return v.each(natures, validate)
 		}
-		return Nature{Type: t}
+		return validate(natures)
 	} else if len(f.Types) == 0 {
 		// f.Types 为空，表示这个函数没有重载，只有一个函数签名，直接调用 v.checkArguments 校验参数是否匹配。
 		nt, err := v.checkArguments(f.Name, Nature{Type: f.Type()}, arguments, node)
@@ -1513,11 +1991,11 @@ func (v *checker) checkArguments(
 			continue
 		}
 
-		// 情况3：nil 参数只能传给指针或接口类型
+		// 情况3：nil 参数只能传给可为 nil 的类型，和 Go 一致
 		if isNil(argNature) {
-			if in.Kind() == reflect.Ptr || // 直接赋值
-				in.Kind() == reflect.Interface { // 解引用后赋值
-				continue // nil 可以赋值给指针或接口
+			switch in.Kind() {
+			case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+				continue // nil 可以赋值给指针、接口、map、切片、函数和通道
 			}
 			return unknown, &file.Error{
 				Location: arg.Location(),
@@ -1543,7 +2021,7 @@ func (v *checker) checkArguments(
 		assignable = assignable || argNature.Deref().AssignableTo(in)
 
 		// 如果参数既不可直接赋值，也不可解引用后赋值，且类型不是未知类型，就报错，返回 unknown 类型，防止后续推导错误。
-		if !assignable && !isUnknown(argNature) {
+		if !assignable && (!isUnknown(argNature) || isUnion(argNature)) {
 			return unknown, &file.Error{
 				Location: arg.Location(),
 				Message:  fmt.Sprintf("cannot use %s as argument (type %s) to call %v ", argNature, in, name),
@@ -1673,6 +2151,9 @@ func traverseAndReplaceIntegerNodesWithIntegerNodes(node *ast.Node, newNature Na
 func (v *checker) PredicateNode(node *ast.PredicateNode) Nature {
 	// 获取子节点的类型信息
 	nt := v.visit(node.Node)
+	if _, ok := node.Node.(*ast.IdentifierNode); ok && nt.Closure > 0 {
+		nt = v.closurePredicate(node, nt)
+	}
 	// 存储谓词函数的返回类型列表
 	var out []reflect.Type
 	// 据 nt 的情况决定函数的返回类型：
@@ -1699,6 +2180,32 @@ func (v *checker) PredicateNode(node *ast.PredicateNode) Nature {
 	}
 }
 
+// closurePredicate replaces a variable of a function used as a predicate,
+// like f in map(xs, f), with a call of the function. The parameters are bound like
+// the parameters of arrow predicates: the element and its index, or for
+// reduce the accumulator and the element.
+func (v *checker) closurePredicate(node *ast.PredicateNode, nt Nature) Nature {
+	pointers := []string{"", "index"}
+	if _, ok := v.predicateScopes[len(v.predicateScopes)-1].vars["acc"]; ok && nt.Closure == 2 {
+		pointers = []string{"acc", ""}
+	}
+	if nt.Closure > len(pointers) {
+		return v.error(node, "cannot use function with %d parameters as predicate", nt.Closure)
+	}
+	arguments := make([]ast.Node, nt.Closure)
+	for i := range arguments {
+		arguments[i] = &ast.PointerNode{Name: pointers[i]}
+		arguments[i].SetLocation(node.Node.Location())
+	}
+	call := &ast.CallNode{
+		Callee:    node.Node,
+		Arguments: arguments,
+	}
+	call.SetLocation(node.Node.Location())
+	node.Node = call
+	return v.visit(node.Node)
+}
+
 // 示例 1：合法的数组元素访问（无名称指针）
 //
 //	假设我们有这样的谓词表达式：[1,2,3,4] -> # > 2（意思是 "从数组中筛选出大于 2 的元素"）
@@ -1773,6 +2280,23 @@ func (v *checker) PointerNode(node *ast.PointerNode) Nature {
 	//	- vars：当前谓词可访问的变量信息（变量名 → 变量类型）。
 	scope := v.predicateScopes[len(v.predicateScopes)-1]
 
+	// Numbered pointers, like #1, refer to the element of an enclosing
+	// predicate, counting from the outermost one.
+	if level, ok := node.Level(); ok {
+		if level > len(v.predicateScopes) {
+			return v.error(node, "cannot use #%d in predicate nested %d levels deep", level, len(v.predicateScopes))
+		}
+		scope = v.predicateScopes[level-1]
+		if isUnknown(scope.collection) {
+			return unknown
+		}
+		switch scope.collection.Kind() {
+		case reflect.Array, reflect.Slice:
+			return scope.collection.Elem()
+		}
+		return v.error(node, "cannot use %v as array", scope)
+	}
+
 	// 如果 PointerNode 没有名字（Name == ""），表示要取集合元素本身。
 	//	- 若集合类型未知 → 返回 unknown。
 	//	- 若集合是 数组/切片 类型 → 返回元素类型（Elem()）。
@@ -1802,22 +2326,8 @@ func (v *checker) PointerNode(node *ast.PointerNode) Nature {
 // 对应语法：let 变量名 = 初始值; 后续表达式
 func (v *checker) VariableDeclaratorNode(node *ast.VariableDeclaratorNode) Nature {
 	// 1. 对变量名 `node.Name` 进行重名检查
-
-	// 检查是否与环境变量重名
-	if _, ok := v.config.Env.Get(node.Name); ok {
-		return v.error(node, "cannot redeclare %v", node.Name)
-	}
-	// 检查是否与已定义函数重名
-	if _, ok := v.config.Functions[node.Name]; ok {
-		return v.error(node, "cannot redeclare function %v", node.Name)
-	}
-	// 检查是否与内置变量/函数重名
-	if _, ok := v.config.Builtins[node.Name]; ok {
-		return v.error(node, "cannot redeclare builtin %v", node.Name)
-	}
-	// 检查是否与当前作用域中已声明的变量重名
-	if _, ok := v.lookupVariable(node.Name); ok {
-		return v.error(node, "cannot redeclare variable %v", node.Name)
+	if !v.declarable(node, node.Name) {
+		return unknown
 	}
 
 	// 2. 推导变量初始值 `node.Value` 的类型信息
@@ -1836,6 +2346,33 @@ func (v *checker) VariableDeclaratorNode(node *ast.VariableDeclaratorNode) Natur
 	return exprNature
 }
 
+// declarable reports whether a variable or a parameter can be declared with
+// the name, which must not be used by the env, functions, builtins or other
+// variables.
+func (v *checker) declarable(node ast.Node, name string) bool {
+	// 检查是否与环境变量重名
+	if _, ok := v.config.Env.Get(name, v.config.FieldTags...); ok {
+		v.error(node, "cannot redeclare %v", name)
+		return false
+	}
+	// 检查是否与已定义函数重名
+	if _, ok := v.config.Functions[name]; ok {
+		v.error(node, "cannot redeclare function %v", name)
+		return false
+	}
+	// 检查是否与内置变量/函数重名
+	if _, ok := v.config.Builtins[name]; ok {
+		v.error(node, "cannot redeclare builtin %v", name)
+		return false
+	}
+	// 检查是否与当前作用域中已声明的变量重名
+	if _, ok := v.lookupVariable(name); ok {
+		v.error(node, "cannot redeclare variable %v", name)
+		return false
+	}
+	return true
+}
+
 func (v *checker) SequenceNode(node *ast.SequenceNode) Nature {
 	if len(node.Nodes) == 0 {
 		return v.error(node, "empty sequence expression")
@@ -1847,6 +2384,35 @@ func (v *checker) SequenceNode(node *ast.SequenceNode) Nature {
 	return last
 }
 
+// FunctionNode checks a function defined in the expression. The function
+// can be called with any arguments, so its parameters are of unknown types,
+// and it can be called anywhere, so its body can not use the pointers of
+// the predicates around it.
+func (v *checker) FunctionNode(node *ast.FunctionNode) Nature {
+	for _, name := range node.Params {
+		if !v.declarable(node, name) {
+			return unknown
+		}
+	}
+
+	predicateScopes := v.predicateScopes
+	v.predicateScopes = nil
+	v.functions++
+	for _, name := range node.Params {
+		v.varScopes = append(v.varScopes, varScope{name, unknown})
+	}
+	out := v.visit(node.Node)
+	v.varScopes = v.varScopes[:len(v.varScopes)-len(node.Params)]
+	v.functions--
+	v.predicateScopes = predicateScopes
+
+	return Nature{
+		Type:         closureType,
+		PredicateOut: &out,
+		Closure:      len(node.Params),
+	}
+}
+
 // lookupVariable 根据变量名查找变量作用域。
 //
 // 返回值：
@@ -1906,21 +2472,47 @@ func (v *checker) ConditionalNode(node *ast.ConditionalNode) Nature {
 
 	// 条件表达式必须是布尔类型
 	c := v.visit(node.Cond)
-	if !isBool(c) && !isUnknown(c) {
-		return v.error(node.Cond, "non-bool expression (type %v) used as condition", c)
+	if !v.bools(node.Cond, c, "non-bool expression (type %v) used as condition") {
+		return unknown
 	}
 
 	// 检查两个分支的类型
-	t1 := v.visit(node.Exp1)
-	t2 := v.visit(node.Exp2)
+	return branches(v.visit(node.Exp1), v.visit(node.Exp2))
+}
+
+// SwitchNode checks a switch like the chain of conditionals it stands for.
+func (v *checker) SwitchNode(node *ast.SwitchNode) Nature {
+	v.visit(node.Node)
+	nt := v.visit(node.Default)
+	for i := len(node.Branches) - 1; i >= 0; i-- {
+		nt = branches(v.visit(node.Branches[i]), nt)
+	}
+	return nt
+}
+
+// OpcodeNode checks that the custom opcode is registered. Its type is the
+// one set by the patcher which inserted it.
+func (v *checker) OpcodeNode(node *ast.OpcodeNode) Nature {
+	for _, arg := range node.Arguments {
+		v.visit(arg)
+	}
+	if _, ok := vm.LookupOpcode(node.Name); !ok {
+		return v.error(node, "unknown opcode %v", node.Name)
+	}
+	return node.Nature()
+}
 
+// branches returns the nature of a conditional with branches of t1 and t2.
+func branches(t1, t2 Nature) Nature {
 	// 处理 nil
 	//  - 单边 nil : 如果一边是 nil 另一边不是，返回非 nil 的类型
 	//  - 双边 nil : 如果两边都是 nil ，返回 nil 类型
 	if isNil(t1) && !isNil(t2) {
+		t2.Nullable = true
 		return t2
 	}
 	if !isNil(t1) && isNil(t2) {
+		t1.Nullable = true
 		return t1
 	}
 	if isNil(t1) && isNil(t2) {
@@ -1930,6 +2522,7 @@ func (v *checker) ConditionalNode(node *ast.ConditionalNode) Nature {
 	// 处理非 nil
 	//	- 如果类型兼容( t1 可以赋值给 t2 )，返回 t1 的类型
 	if t1.AssignableTo(t2) {
+		t1.Nullable = t1.Nullable || t2.Nullable
 		return t1
 	}
 	return unknown
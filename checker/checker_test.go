@@ -1150,3 +1150,204 @@ func TestCheck_types(t *testing.T) {
 		})
 	}
 }
+
+func TestCheck_union_types(t *testing.T) {
+	env := types.Map{
+		"id":     types.Union(types.String, types.Int),
+		"amount": types.Union(types.Int, types.Float64),
+		"item": types.Union(
+			types.Map{"name": types.String, "price": types.Int},
+			types.Map{"name": types.String, "size": types.Int},
+		),
+		"maybe": types.Union(types.String, types.Nil),
+		"flag":  types.Union(types.Bool, types.String),
+		"list":  types.Union(types.Array(types.Int), types.Array(types.String)),
+		"str":   types.String,
+	}
+
+	noerr := "no error"
+	tests := []struct {
+		code string
+		err  string
+	}{
+		{`id == 1`, noerr},
+		{`id == "a"`, noerr},
+		{`id in ["a", "b"]`, noerr},
+		{`id == true`, `invalid operation: == (mismatched types string and bool) (for string of string | int)`},
+		{`amount * 2 > 10`, noerr},
+		{`-amount`, noerr},
+		{`id + 1`, `invalid operation: + (mismatched types string and int) (for string of string | int)`},
+		{`-id`, `invalid operation: - (mismatched type string) (for string of string | int)`},
+		{`upper(id)`, `cannot use string | int as argument (type string) to call upper`},
+		{`string(id)`, noerr},
+		{`item.name + "!"`, noerr},
+		{`item.price`, `unknown field price (for map[string]interface {} of`},
+		{`maybe ?? "default"`, noerr},
+		{`maybe + "!"`, `(for nil of string | nil)`},
+		{`str + (amount > 1 ? "a" : "b")`, noerr},
+		{`len(id)`, `invalid argument for len (type int) (for int of string | int)`},
+		{`len(item) + len(list)`, noerr},
+		{`abs(amount)`, noerr},
+		{`id ? 1 : 2`, `non-bool expression (type string) used as condition (for string of string | int)`},
+		{`flag ? 1 : 2`, `non-bool expression (type string) used as condition (for string of bool | string)`},
+		{`filter([1, 2], flag)`, `predicate should return boolean (got string) (for string of bool | string)`},
+		{`all(id, # == 1)`, `builtin all takes only array (got string) (for string of string | int)`},
+		{`count(list, # != nil)`, noerr},
+	}
+
+	for _, test := range tests {
+		t.Run(test.code, func(t *testing.T) {
+			_, err := checker.ParseCheck(test.code, conf.New(env))
+			if test.err == noerr {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+			}
+		})
+	}
+
+	tree, err := parser.Parse(`id + id`)
+	require.NoError(t, err)
+	_, err = checker.Check(tree, conf.New(types.Map{"id": types.Union(types.Int, types.Float64)}))
+	require.NoError(t, err)
+	require.Equal(t, "int | float64", tree.Node.Nature().String())
+}
+
+func TestCheck_PurePredicates(t *testing.T) {
+	env := map[string]any{
+		"names":  []string{"Bob"},
+		"foos":   []mock.Foo{{}},
+		"notify": func(name string) bool { return true },
+		"valid":  func(name string) bool { return name != "" },
+	}
+
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{`all(names, valid(#))`, ``},
+		{`notify("admin") && all(names, valid(#))`, ``},
+		{`filter(names, notify(#))`, `cannot call notify in predicate: function is not pure (1:15)`},
+		{`map(names, {all(names, notify(#))})`, `cannot call notify in predicate: function is not pure (1:24)`},
+		{`any(foos, .MethodWithArgs("a") == "")`, ``},
+		{`any(foos, .Method().Baz == "")`, `cannot call Method in predicate: function is not pure (1:12)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := expr.Compile(tt.input, expr.Env(env), expr.PurePredicates(), expr.Pure("valid", "MethodWithArgs"))
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestCheck_Quota(t *testing.T) {
+	quota := &conf.Quota{
+		MaxNodes:      20,
+		MaxPredicates: 1,
+		MaxRegexes:    1,
+		Builtins:      []string{"filter", "len"},
+	}
+
+	_, err := expr.Compile(`len(filter(1..3, # > 1)) > 0 && "a" matches "b"`, expr.WithQuota(quota))
+	require.NoError(t, err)
+
+	_, err = expr.Compile(`all(1..3, # > 1) && any(1..3, # > 2) && "a" matches "b" && "c" matches "d"`, expr.WithQuota(quota))
+	require.Error(t, err)
+
+	var quotaErr *checker.QuotaError
+	require.ErrorAs(t, err, &quotaErr)
+
+	var codes []string
+	for _, v := range quotaErr.Violations {
+		codes = append(codes, v.Code)
+	}
+	assert.Equal(t, []string{
+		conf.QuotaBuiltin,
+		conf.QuotaBuiltin,
+		conf.QuotaMaxNodes,
+		conf.QuotaMaxPredicates,
+		conf.QuotaMaxRegexes,
+	}, codes)
+	assert.Equal(t, "builtin all is not allowed", quotaErr.Violations[0].Message)
+
+	_, err = expr.Compile(`"a" matches "b" && splitRegex("c", "d") != nil`, expr.WithQuota(&conf.Quota{MaxRegexes: 1}))
+	require.ErrorAs(t, err, &quotaErr)
+	require.Len(t, quotaErr.Violations, 1)
+	assert.Equal(t, conf.QuotaMaxRegexes, quotaErr.Violations[0].Code)
+	assert.Equal(t, "expression has 2 regular expressions (maximum is 1)", quotaErr.Violations[0].Message)
+}
+
+func TestCheck_named_types_with_literals(t *testing.T) {
+	type Status string
+	type Role string
+	type Level int
+	env := map[string]any{
+		"status":   Status("active"),
+		"role":     Role("admin"),
+		"level":    Level(1),
+		"str":      "active",
+		"statuses": []Status{},
+		"levels":   map[Level]string{},
+	}
+
+	valid := []string{
+		`status == "active"`,
+		`"active" != status`,
+		`status < "b"`,
+		`status in ["active", "pending"]`,
+		`"active" in statuses`,
+		`level == 3`,
+		`level >= 2.5`,
+		`level in 1..5`,
+		`level in levels`,
+		`2 in levels`,
+		`level < level`,
+	}
+	for _, code := range valid {
+		t.Run(code, func(t *testing.T) {
+			_, err := checker.ParseCheck(code, conf.New(env))
+			require.NoError(t, err)
+		})
+	}
+
+	invalid := []struct {
+		code string
+		err  string
+	}{
+		{`status == str`, "mismatched types checker_test.Status and string"},
+		{`status == role`, "mismatched types checker_test.Status and checker_test.Role"},
+		{`status in [str]`, "cannot use checker_test.Status as type string in array"},
+		{`level == "1"`, "mismatched types checker_test.Level and string"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.code, func(t *testing.T) {
+			_, err := checker.ParseCheck(tt.code, conf.New(env))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestCheckContext(t *testing.T) {
+	tree, err := parser.Parse(strings.Repeat("1 + ", 1000) + "1")
+	require.NoError(t, err)
+
+	typ, err := checker.CheckContext(context.Background(), tree, nil)
+	require.NoError(t, err)
+	assert.Equal(t, reflect.Int, typ.Kind())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = checker.CheckContext(ctx, tree, nil)
+	require.ErrorIs(t, err, context.Canceled)
+
+	_, err = checker.ParseCheckContext(ctx, `1 + 2`, conf.New(nil))
+	require.ErrorIs(t, err, context.Canceled)
+}
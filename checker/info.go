@@ -1,7 +1,7 @@
 package checker
 
 import (
-	"fmt"
+	"context"
 	"reflect"
 
 	"github.com/expr-lang/expr/ast"
@@ -9,11 +9,14 @@ import (
 	"github.com/expr-lang/expr/vm"
 )
 
-func FieldIndex(env Nature, node ast.Node) (bool, []int, string) {
+// FieldIndex returns the index of the struct field the node reads, if it is
+// one, and its name. Fields without an expr tag are named by the first of
+// the tags they have, see conf.Config.FieldTags.
+func FieldIndex(env Nature, node ast.Node, tags ...string) (bool, []int, string) {
 	switch n := node.(type) {
 	case *ast.IdentifierNode:
 		if env.Kind() == reflect.Struct {
-			if field, ok := env.Get(n.Value); ok && len(field.FieldIndex) > 0 {
+			if field, ok := env.Get(n.Value, tags...); ok && len(field.FieldIndex) > 0 {
 				return true, field.FieldIndex, n.Value
 			}
 		}
@@ -23,7 +26,7 @@ func FieldIndex(env Nature, node ast.Node) (bool, []int, string) {
 		if base.Kind() == reflect.Struct {
 			if prop, ok := n.Property.(*ast.StringNode); ok {
 				name := prop.Value
-				if field, ok := base.FieldByName(name); ok {
+				if field, ok := base.FieldByName(name, tags...); ok {
 					return true, field.FieldIndex, name
 				}
 			}
@@ -78,24 +81,74 @@ func FieldIndex(env Nature, node ast.Node) (bool, []int, string) {
 //	}
 //	found, index, name := MethodIndex(env, node) 		// (false, 0, "")
 func MethodIndex(env Nature, node ast.Node) (bool, int, string) {
+	m, name, ok := Method(env, node)
+	if !ok {
+		return false, 0, ""
+	}
+	return m.Method, m.MethodIndex, name
+}
+
+// Method is like MethodIndex, but returns the nature of the method. Its
+// PointerReceiver is set if the method is defined on *T and the value is T.
+func Method(env Nature, node ast.Node) (Nature, string, bool) {
 	switch n := node.(type) {
 	case *ast.IdentifierNode:
 		if env.Kind() == reflect.Struct {
 			if m, ok := env.Get(n.Value); ok {
-				return m.Method, m.MethodIndex, n.Value
+				return m, n.Value, true
 			}
 		}
 	case *ast.MemberNode:
 		if name, ok := n.Property.(*ast.StringNode); ok {
 			base := n.Node.Type()
 			if base != nil && base.Kind() != reflect.Interface {
-				if m, ok := base.MethodByName(name.Value); ok {
-					return true, m.Index, name.Value
+				if m, ok := (Nature{Type: base}).MethodByName(name.Value); ok {
+					return m, name.Value, true
 				}
 			}
 		}
 	}
-	return false, 0, ""
+	return Nature{}, "", false
+}
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// ContextParam reports whether the first parameter of fn, after the receiver
+// of a method, is a context.Context, which conf.Config.InjectContext hides
+// from expressions.
+func ContextParam(fn reflect.Type, method bool) bool {
+	if fn == nil || fn.Kind() != reflect.Func {
+		return false
+	}
+	first := 0
+	if method {
+		first = 1
+	}
+	if fn.IsVariadic() && fn.NumIn() == first+1 {
+		return false
+	}
+	return fn.NumIn() > first && fn.In(first) == contextType
+}
+
+// withoutContext returns the nature of the function fn without its
+// context.Context parameter, see ContextParam.
+func withoutContext(fn Nature) Nature {
+	first := 0
+	if fn.Method {
+		first = 1
+	}
+	var in []reflect.Type
+	for i := 0; i < fn.Type.NumIn(); i++ {
+		if i != first {
+			in = append(in, fn.Type.In(i))
+		}
+	}
+	out := make([]reflect.Type, fn.Type.NumOut())
+	for i := range out {
+		out[i] = fn.Type.Out(i)
+	}
+	fn.Type = reflect.FuncOf(in, out, fn.Type.IsVariadic())
+	return fn
 }
 
 // TypedFuncIndex
@@ -115,8 +168,8 @@ func MethodIndex(env Nature, node ast.Node) (bool, int, string) {
 // 检查逻辑：
 //   - fn 不能是 nil
 //   - 必须是函数类型
-//   - 不能是可变参数函数
 //   - 不能是命名函数类型
+//   - 可变参数函数只匹配同样可变参数的类型，编译器把可变参数打包成数组传入
 //
 // 遍历预定义的函数类型 (vm.FuncTypes)
 //   - 跳过 i=0（可能是占位符或无效类型）
@@ -180,10 +233,6 @@ func TypedFuncIndex(fn reflect.Type, method bool) (int, bool) {
 	if fn.Kind() != reflect.Func {
 		return 0, false
 	}
-	// OnCallTyped doesn't work for functions with variadic arguments.
-	if fn.IsVariadic() {
-		return 0, false
-	}
 	// OnCallTyped doesn't work named function, like `type MyFunc func() int`.
 	if fn.PkgPath() != "" { // If PkgPath() is not empty, it means that function is named.
 		return 0, false
@@ -206,7 +255,7 @@ funcTypes:
 		//fmt.Printf("%v\n", typed.Kind())
 		//fmt.Printf("%v\n", typed.String())
 
-		if typed.Kind() != reflect.Func {
+		if typed.Kind() != reflect.Func || typed.IsVariadic() != fn.IsVariadic() {
 			continue
 		}
 		// 返回值数量和类型完全一致
@@ -223,7 +272,6 @@ funcTypes:
 			continue
 		}
 		for j := 0; j < typed.NumIn(); j++ {
-			fmt.Printf("%v\n", typed.In(j).String())
 			if typed.In(j) != fn.In(j+fnInOffset) {
 				continue funcTypes
 			}
@@ -2,6 +2,8 @@ package nature
 
 import (
 	"reflect"
+	"sort"
+	"strings"
 
 	"github.com/expr-lang/expr/builtin"
 	"github.com/expr-lang/expr/internal/deref"
@@ -26,9 +28,13 @@ type Nature struct {
 	DefaultMapValue *Nature           // Default value of map type.
 	Strict          bool              // If map is types.StrictMap.
 	Nil             bool              // If value is nil.
+	Nullable        bool              // If value may be nil, like results of ?. chains, find or misses of maps of pointers.
 	Method          bool              // If value retrieved from method. Usually used to determine amount of in arguments.
 	MethodIndex     int               // Index of method in type.
+	PointerReceiver bool              // If method is defined on *T, but value is T.
 	FieldIndex      []int             // Index of field in type.
+	Closure         int               // Number of parameters, if value is a function defined in the expression. PredicateOut is its out nature.
+	Union           []Nature          // Members of a union type, like string | int, see UnionOf. Type is nil.
 }
 
 // Kind 获取底层反射类型的 Kind
@@ -59,9 +65,53 @@ func (n Nature) String() string {
 	if n.Type != nil {
 		return n.Type.String()
 	}
+	if len(n.Union) > 0 {
+		names := make([]string, len(n.Union))
+		for i, m := range n.Union {
+			names[i] = m.String()
+			if m.Nil {
+				names[i] = "nil"
+			}
+		}
+		return strings.Join(names, " | ")
+	}
 	return "unknown"
 }
 
+// UnionOf returns the nature of values of any of the natures. Unions are
+// flattened and duplicated members are dropped, so a single nature is
+// returned as it is. A union with an unknown member is unknown.
+func UnionOf(natures ...Nature) Nature {
+	var members []Nature
+	add := func(nt Nature) {
+		for _, m := range members {
+			if reflect.DeepEqual(m, nt) {
+				return
+			}
+		}
+		members = append(members, nt)
+	}
+	for _, nt := range natures {
+		if len(nt.Union) > 0 {
+			for _, m := range nt.Union {
+				add(m)
+			}
+			continue
+		}
+		if nt.IsUnknown() {
+			return unknown
+		}
+		add(nt)
+	}
+	switch len(members) {
+	case 0:
+		return unknown
+	case 1:
+		return members[0]
+	}
+	return Nature{Union: members}
+}
+
 // Deref 解引用，得到最底层类型
 func (n Nature) Deref() Nature {
 	if n.Type != nil {
@@ -153,6 +203,24 @@ func (n Nature) Elem() Nature {
 
 // AssignableTo 底层反射类型兼容性检查
 func (n Nature) AssignableTo(nt Nature) bool {
+	// A union is assignable if all of its members are, and a value is
+	// assignable to a union if it is to one of its members.
+	if len(n.Union) > 0 {
+		for _, m := range n.Union {
+			if !m.AssignableTo(nt) {
+				return false
+			}
+		}
+		return true
+	}
+	if len(nt.Union) > 0 {
+		for _, m := range nt.Union {
+			if n.AssignableTo(m) {
+				return true
+			}
+		}
+		return false
+	}
 	if n.Nil {
 		// Untyped nil is assignable to any interface, but implements only the empty interface.
 		if nt.IsAny() {
@@ -180,7 +248,21 @@ func (n Nature) MethodByName(name string) (Nature, bool) {
 	// 反射查找方法
 	method, ok := n.Type.MethodByName(name)
 	if !ok {
-		return unknown, false
+		// Methods with a pointer receiver are not in the method set of T.
+		// Look them up on *T, the value is copied to call them.
+		if !hasPointerMethods(n.Type) {
+			return unknown, false
+		}
+		method, ok = reflect.PtrTo(n.Type).MethodByName(name)
+		if !ok {
+			return unknown, false
+		}
+		return Nature{
+			Type:            method.Type,
+			Method:          true,
+			MethodIndex:     method.Index,
+			PointerReceiver: true,
+		}, true
 	}
 
 	// 对于接口类型，其方法没有接收者（receiver），不视为 Method ，不使用 MethodIndex 。
@@ -205,6 +287,15 @@ func (n Nature) MethodByName(name string) (Nature, bool) {
 	}
 }
 
+// hasPointerMethods reports whether *T can have methods which T does not.
+func hasPointerMethods(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return false
+	}
+	return true
+}
+
 func (n Nature) NumIn() int {
 	if n.Type == nil {
 		return 0
@@ -240,11 +331,13 @@ func (n Nature) IsVariadic() bool {
 	return n.Type.IsVariadic()
 }
 
-func (n Nature) FieldByName(name string) (Nature, bool) {
+// FieldByName returns the field of a struct by its name in expressions.
+// Fields without an expr tag are named by the first of the tags they have.
+func (n Nature) FieldByName(name string, tags ...string) (Nature, bool) {
 	if n.Type == nil {
 		return unknown, false
 	}
-	field, ok := fetchField(n.Type, name)
+	field, ok := fetchField(n.Type, name, tags)
 	return Nature{
 		Type:       field.Type,
 		FieldIndex: field.Index,
@@ -300,7 +393,9 @@ func (n Nature) IsFastMap() bool {
 // 4. 如果是 struct，查字段
 // 5. 如果是 map，查 kv pair
 // 6. 获取失败，返回 unknown
-func (n Nature) Get(name string) (Nature, bool) {
+//
+// Fields without an expr tag are named by the first of the tags they have.
+func (n Nature) Get(name string, tags ...string) (Nature, bool) {
 	if n.Type == nil {
 		return unknown, false
 	}
@@ -310,7 +405,7 @@ func (n Nature) Get(name string) (Nature, bool) {
 	t := deref.Type(n.Type)
 	switch t.Kind() {
 	case reflect.Struct:
-		if f, ok := fetchField(t, name); ok {
+		if f, ok := fetchField(t, name, tags); ok {
 			return Nature{
 				Type:       f.Type,
 				FieldIndex: f.Index,
@@ -324,6 +419,32 @@ func (n Nature) Get(name string) (Nature, bool) {
 	return unknown, false
 }
 
+// FoldName returns the names of the fields of a struct, or of the known keys
+// of a map, which are equal to name under Unicode case folding, sorted.
+func (n Nature) FoldName(name string, tags ...string) []string {
+	if n.Type == nil {
+		return nil
+	}
+	var names []string
+	t := deref.Type(n.Type)
+	switch t.Kind() {
+	case reflect.Struct:
+		for key := range StructFields(t, tags...) {
+			if strings.EqualFold(key, name) {
+				names = append(names, key)
+			}
+		}
+	case reflect.Map:
+		for key := range n.Fields {
+			if strings.EqualFold(key, name) {
+				names = append(names, key)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // All 返回该类型所有可访问的成员（方法和字段）的完整映射，包含：
 //   - 所有方法：类型定义的方法
 //   - 结构体字段：如果是结构体，包含所有字段
@@ -343,6 +464,21 @@ func (n Nature) All() map[string]Nature {
 			MethodIndex: method.Index,
 		}
 	}
+	if hasPointerMethods(n.Type) {
+		ptr := reflect.PtrTo(n.Type)
+		for i := 0; i < ptr.NumMethod(); i++ {
+			method := ptr.Method(i)
+			if _, ok := table[method.Name]; ok {
+				continue
+			}
+			table[method.Name] = Nature{
+				Type:            method.Type,
+				Method:          true,
+				MethodIndex:     method.Index,
+				PointerReceiver: true,
+			}
+		}
+	}
 
 	t := deref.Type(n.Type)
 	switch t.Kind() {
@@ -0,0 +1,98 @@
+package checker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/builtin"
+	"github.com/expr-lang/expr/conf"
+	"github.com/expr-lang/expr/file"
+)
+
+// Violation describes a single exceeded conf.Quota limit.
+type Violation struct {
+	Code     string // one of conf.Quota* codes
+	Message  string
+	Location file.Location
+}
+
+// QuotaError is returned by ParseCheck if the expression exceeds the
+// configured conf.Quota. It lists all violations, not only the first one.
+type QuotaError struct {
+	Violations []Violation
+}
+
+func (e *QuotaError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = fmt.Sprintf("%s: %s", v.Code, v.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// CheckQuota validates the tree against the quota.
+func CheckQuota(tree ast.Node, quota *conf.Quota) error {
+	if quota == nil {
+		return nil
+	}
+
+	v := &quotaVisitor{}
+	if quota.Builtins != nil {
+		v.allowed = make(map[string]bool, len(quota.Builtins))
+		for _, name := range quota.Builtins {
+			v.allowed[name] = true
+		}
+	}
+	ast.Walk(&tree, v)
+
+	if quota.MaxNodes > 0 && v.nodes > quota.MaxNodes {
+		v.add(conf.QuotaMaxNodes, tree.Location(), "expression has %d nodes (maximum is %d)", v.nodes, quota.MaxNodes)
+	}
+	if quota.MaxPredicates > 0 && len(v.predicates) > int(quota.MaxPredicates) {
+		v.add(conf.QuotaMaxPredicates, v.predicates[quota.MaxPredicates], "expression has %d predicates (maximum is %d)", len(v.predicates), quota.MaxPredicates)
+	}
+	if quota.MaxRegexes > 0 && len(v.regexes) > int(quota.MaxRegexes) {
+		v.add(conf.QuotaMaxRegexes, v.regexes[quota.MaxRegexes], "expression has %d regular expressions (maximum is %d)", len(v.regexes), quota.MaxRegexes)
+	}
+
+	if len(v.violations) > 0 {
+		return &QuotaError{Violations: v.violations}
+	}
+	return nil
+}
+
+type quotaVisitor struct {
+	allowed    map[string]bool
+	nodes      uint
+	predicates []file.Location
+	regexes    []file.Location
+	violations []Violation
+}
+
+func (v *quotaVisitor) Visit(node *ast.Node) {
+	v.nodes++
+	switch n := (*node).(type) {
+	case *ast.PredicateNode:
+		v.predicates = append(v.predicates, n.Location())
+	case *ast.BinaryNode:
+		if n.Operator == "matches" {
+			v.regexes = append(v.regexes, n.Location())
+		}
+	case *ast.BuiltinNode:
+		if builtin.Regexps[n.Name] {
+			v.regexes = append(v.regexes, n.Location())
+		}
+		if v.allowed != nil && !v.allowed[n.Name] {
+			v.add(conf.QuotaBuiltin, n.Location(), "builtin %v is not allowed", n.Name)
+		}
+	}
+}
+
+func (v *quotaVisitor) add(code string, loc file.Location, format string, args ...any) {
+	v.violations = append(v.violations, Violation{
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+		Location: loc,
+	})
+}
@@ -0,0 +1,510 @@
+package checker
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/checker/nature"
+	"github.com/expr-lang/expr/conf"
+	"github.com/expr-lang/expr/file"
+	"github.com/expr-lang/expr/internal/deref"
+	"github.com/expr-lang/expr/internal/embedded"
+	"github.com/expr-lang/expr/parser"
+)
+
+// SensitiveTag is the struct tag which marks fields holding sensitive
+// values, like `sensitive:"true"`. See conf.Config.Sensitive.
+const SensitiveTag = "sensitive"
+
+// stringBuilders are the builtins which make strings or bytes of their
+// arguments, so sensitive values can not be passed to them.
+var stringBuilders = map[string]bool{
+	"string": true, "bytes": true, "trim": true, "trimPrefix": true, "trimSuffix": true,
+	"upper": true, "lower": true, "split": true, "splitAfter": true, "replace": true,
+	"repeat": true, "truncate": true, "padStart": true, "padEnd": true, "title": true,
+	"slugify": true, "format": true, "join": true, "matchGroups": true, "replaceRegex": true,
+	"splitRegex": true, "toJSON": true, "toBase64": true, "fromBase64": true, "toHex": true,
+	"fromHex": true, "sha256": true, "md5": true, "crc32": true, "base64": true,
+	"base64decode": true, "urlEncode": true, "urlDecode": true,
+}
+
+// stringTests are the builtins which compare their arguments, like comparison
+// operators do.
+var stringTests = map[string]bool{
+	"isEmail": true, "isURL": true, "isPhone": true, "hasPrefix": true, "hasSuffix": true,
+}
+
+// CheckSensitive checks that sensitive values of the env, listed in
+// conf.Config.Sensitive or tagged with SensitiveTag, are only compared:
+// they can decide branches of an expression, but can not be its result,
+// nor be passed to builtins which build strings, like upper or join.
+// Values computed from sensitive ones, like User.Email + "!", are sensitive,
+// and so are structs, maps and arrays holding sensitive values, like User.
+// Parameters of functions defined in the expression are as sensitive as the
+// arguments they are called with.
+func CheckSensitive(tree *parser.Tree, config *conf.Config) error {
+	s := &sensitivity{config: config, locals: map[string][]taint{}, functions: map[string][]*ast.FunctionNode{}}
+	s.fieldPaths = sensitiveFields(config)
+	if t := s.visit(tree.Node); t.name != "" && s.err == nil {
+		s.error(t, "sensitive value %s can not be the result", t.name)
+	}
+	if s.err != nil {
+		return s.err.Bind(tree.Source)
+	}
+	return nil
+}
+
+// taint is the sensitive value a value is computed from. The name is empty
+// if there is none. A held taint is a sensitive value the value holds, like
+// the field Email of User: it is lost by values which can not hold it, like
+// User.Name.
+type taint struct {
+	name string
+	loc  file.Location
+	held bool
+}
+
+// structField is a field of a struct type, by its name in expressions.
+type structField struct {
+	t    reflect.Type
+	name string
+}
+
+type sensitivity struct {
+	config     *conf.Config
+	fieldPaths map[structField]string         // paths of conf.Config.Sensitive, by the fields they end at
+	locals     map[string][]taint             // taints of variables declared with let
+	functions  map[string][]*ast.FunctionNode // functions of variables declared with let
+	elements   []taint                        // taints of the elements of predicates
+	err        *file.Error
+}
+
+func (s *sensitivity) error(t taint, format string, args ...any) {
+	if s.err == nil {
+		s.err = &file.Error{Location: t.loc, Message: fmt.Sprintf(format, args...)}
+	}
+}
+
+func (s *sensitivity) visit(node ast.Node) taint {
+	t := s.walk(node)
+	if node == nil || (t.name != "" && !t.held) {
+		return t
+	}
+	name, opaque := s.holds(node)
+	switch {
+	case name != "":
+		return taint{name: name, loc: node.Location(), held: true}
+	case t.held && opaque:
+		return t
+	}
+	return taint{}
+}
+
+func (s *sensitivity) walk(node ast.Node) taint {
+	switch n := node.(type) {
+	case nil:
+	case *ast.IdentifierNode:
+		if locals := s.locals[n.Value]; len(locals) > 0 {
+			return locals[len(locals)-1]
+		}
+		if s.config.Sensitive[n.Value] || tagged(s.config.Env, n.Value, s.config.FieldTags) {
+			return taint{name: n.Value, loc: n.Location()}
+		}
+	case *ast.MemberNode:
+		base := s.visit(n.Node)
+		property := s.visit(n.Property)
+		path, ok := memberPath(n)
+		if ok && s.config.Sensitive[path] {
+			return taint{name: path, loc: n.Location()}
+		}
+		if p, isString := n.Property.(*ast.StringNode); isString {
+			// Fields are sensitive by the type they belong to as well,
+			// wherever the struct comes from, like [User][0].
+			name := s.fieldPath(n.Node.Nature(), p.Value)
+			if name == "" && tagged(n.Node.Nature(), p.Value, s.config.FieldTags) {
+				name = p.Value
+			}
+			if name != "" {
+				if ok {
+					name = path
+				}
+				return taint{name: name, loc: n.Location()}
+			}
+		}
+		return first(base, property)
+	case *ast.ChainNode:
+		return s.visit(n.Node)
+	case *ast.PointerNode:
+		if n.Name == "index" || len(s.elements) == 0 {
+			return taint{}
+		}
+		if level, ok := n.Level(); ok {
+			if level >= 1 && level <= len(s.elements) {
+				return s.elements[level-1]
+			}
+			return taint{}
+		}
+		return s.elements[len(s.elements)-1]
+	case *ast.UnaryNode:
+		return s.visit(n.Node)
+	case *ast.BinaryNode:
+		left, right := s.visit(n.Left), s.visit(n.Right)
+		switch n.Operator {
+		case "==", "!=", "<", ">", "<=", ">=", "in", "matches", "contains", "startsWith", "endsWith":
+			return taint{}
+		}
+		return first(left, right)
+	case *ast.SliceNode:
+		return first(s.visit(n.Node), s.visit(n.From), s.visit(n.To))
+	case *ast.CallNode:
+		t := s.visit(n.Callee)
+		args := make([]taint, len(n.Arguments))
+		for i, arg := range n.Arguments {
+			args[i] = s.visit(arg)
+		}
+		if fn := s.function(n.Callee); fn != nil {
+			return first(t, s.call(fn, args...))
+		}
+		// Functions of the env are opaque: values they return can hold
+		// anything their arguments hold, and functions passed to them can
+		// be called with any of these.
+		t = first(append([]taint{t}, args...)...)
+		for _, arg := range n.Arguments {
+			if fn := s.function(arg); fn != nil {
+				t = first(t, s.call(fn, t))
+			}
+		}
+		t.held = false
+		return t
+	case *ast.BuiltinNode:
+		return s.builtin(n)
+	case *ast.OpcodeNode:
+		var t taint
+		for _, arg := range n.Arguments {
+			t = first(t, s.visit(arg))
+		}
+		return t
+	case *ast.PredicateNode:
+		return s.visit(n.Node)
+	case *ast.FunctionNode:
+		return s.call(n)
+	case *ast.VariableDeclaratorNode:
+		value := s.visit(n.Value)
+		fn, _ := n.Value.(*ast.FunctionNode)
+		s.locals[n.Name] = append(s.locals[n.Name], value)
+		s.functions[n.Name] = append(s.functions[n.Name], fn)
+		t := s.visit(n.Expr)
+		s.locals[n.Name] = s.locals[n.Name][:len(s.locals[n.Name])-1]
+		s.functions[n.Name] = s.functions[n.Name][:len(s.functions[n.Name])-1]
+		return t
+	case *ast.SequenceNode:
+		var t taint
+		for _, node := range n.Nodes {
+			t = s.visit(node)
+		}
+		return t
+	case *ast.ConditionalNode:
+		s.visit(n.Cond)
+		return first(s.visit(n.Exp1), s.visit(n.Exp2))
+	case *ast.SwitchNode:
+		s.visit(n.Node)
+		t := s.visit(n.Default)
+		for _, branch := range n.Branches {
+			t = first(t, s.visit(branch))
+		}
+		return t
+	case *ast.ArrayNode:
+		var t taint
+		for _, node := range n.Nodes {
+			t = first(t, s.visit(node))
+		}
+		return t
+	case *ast.MapNode:
+		var t taint
+		for _, pair := range n.Pairs {
+			t = first(t, s.visit(pair))
+		}
+		return t
+	case *ast.PairNode:
+		return first(s.visit(n.Key), s.visit(n.Value))
+	}
+	return taint{}
+}
+
+func (s *sensitivity) builtin(n *ast.BuiltinNode) taint {
+	var t taint
+	args := make([]taint, len(n.Arguments))
+	for i, arg := range n.Arguments {
+		if _, ok := arg.(*ast.PredicateNode); ok && i > 0 {
+			// Predicates iterate over the first argument.
+			s.elements = append(s.elements, args[0])
+			args[i] = s.visit(arg)
+			s.elements = s.elements[:len(s.elements)-1]
+		} else if fn := s.function(arg); fn != nil && i > 0 {
+			// So do functions passed instead of predicates.
+			args[i] = first(s.visit(arg), s.call(fn, args[0]))
+		} else {
+			args[i] = s.visit(arg)
+		}
+		if stringBuilders[n.Name] && args[i].name != "" {
+			s.error(args[i], "sensitive value %s can not be passed to %s", args[i].name, n.Name)
+		}
+		t = first(t, args[i])
+	}
+	if n.Map != nil {
+		s.elements = append(s.elements, args[0])
+		t = first(t, s.visit(n.Map))
+		s.elements = s.elements[:len(s.elements)-1]
+	}
+
+	switch {
+	case stringTests[n.Name]:
+		return taint{}
+	case n.Name == "all" || n.Name == "any" || n.Name == "none" || n.Name == "one" || n.Name == "count":
+		// Only the predicate decides the result.
+		if len(args) > 1 {
+			return args[1]
+		}
+	}
+	return t
+}
+
+// function returns the function defined in the expression which node is, or
+// is a variable holding, if any.
+func (s *sensitivity) function(node ast.Node) *ast.FunctionNode {
+	switch n := node.(type) {
+	case *ast.FunctionNode:
+		return n
+	case *ast.IdentifierNode:
+		if functions := s.functions[n.Value]; len(functions) > 0 {
+			return functions[len(functions)-1]
+		}
+	}
+	return nil
+}
+
+// call returns the taint of the result of fn called with arguments of the
+// given taints. The last one is used for the parameters left, so a single
+// taint can be given for all of them.
+func (s *sensitivity) call(fn *ast.FunctionNode, args ...taint) taint {
+	elements := s.elements
+	s.elements = nil
+	for i, name := range fn.Params {
+		var t taint
+		if len(args) > 0 {
+			t = args[len(args)-1]
+		}
+		if i < len(args) {
+			t = args[i]
+		}
+		s.locals[name] = append(s.locals[name], t)
+		s.functions[name] = append(s.functions[name], nil)
+	}
+	t := s.visit(fn.Node)
+	for _, name := range fn.Params {
+		s.locals[name] = s.locals[name][:len(s.locals[name])-1]
+		s.functions[name] = s.functions[name][:len(s.functions[name])-1]
+	}
+	s.elements = elements
+	return t
+}
+
+// holds returns the name of a sensitive value the value of node holds, if
+// it is a struct, map or array, like "User.Email" for User. It reports
+// whether the value can hold values of any type, and so sensitive ones
+// computed before, like the elements of [User.Email].
+func (s *sensitivity) holds(node ast.Node) (name string, opaque bool) {
+	path, ok := memberPath(node)
+	if ok {
+		var paths []string
+		for p := range s.config.Sensitive {
+			if strings.HasPrefix(p, path+".") || path == "$env" {
+				paths = append(paths, p)
+			}
+		}
+		if len(paths) > 0 {
+			sort.Strings(paths)
+			return paths[0], true
+		}
+	}
+	name, opaque = s.nature(node.Nature(), map[reflect.Type]bool{})
+	if name != "" && ok && path != "$env" {
+		name = path + "." + name
+	}
+	return name, opaque
+}
+
+// nature is like fields, for values of nature nt: elements of arrays and
+// values of maps are of the natures the checker inferred, if any.
+func (s *sensitivity) nature(nt nature.Nature, seen map[reflect.Type]bool) (name string, opaque bool) {
+	switch {
+	case nt.Union != nil:
+		for _, member := range nt.Union {
+			name, o := s.nature(member, seen)
+			if name != "" {
+				return name, o
+			}
+			opaque = opaque || o
+		}
+		return "", opaque
+	case nt.ArrayOf != nil:
+		return s.nature(*nt.ArrayOf, seen)
+	case nt.Fields != nil:
+		keys := make([]string, 0, len(nt.Fields))
+		for key := range nt.Fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			name, o := s.nature(nt.Fields[key], seen)
+			if name != "" {
+				return key + "." + name, o
+			}
+			opaque = opaque || o
+		}
+		if nt.DefaultMapValue != nil {
+			name, o := s.nature(*nt.DefaultMapValue, seen)
+			return name, opaque || o
+		}
+		return "", opaque
+	case nt.Type == nil:
+		return "", true
+	}
+	return s.fields(nt.Type, seen)
+}
+
+// fields returns the path of a field tagged with SensitiveTag of values of
+// type t, or of their elements, and reports whether they can hold values of
+// any type.
+func (s *sensitivity) fields(t reflect.Type, seen map[reflect.Type]bool) (name string, opaque bool) {
+	if seen[t] {
+		return "", false
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Interface:
+		return "", true
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Chan:
+		return s.fields(t.Elem(), seen)
+	case reflect.Map:
+		name, opaque := s.fields(t.Elem(), seen)
+		_, keys := s.fields(t.Key(), seen)
+		return name, opaque || keys
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := embedded.Name(field, s.config.FieldTags...)
+			if field.Tag.Get(SensitiveTag) == "true" || s.fieldPaths[structField{t, name}] != "" {
+				return name, opaque
+			}
+			inner, o := s.fields(field.Type, seen)
+			if inner != "" {
+				if !field.Anonymous {
+					inner = embedded.Name(field, s.config.FieldTags...) + "." + inner
+				}
+				return inner, opaque
+			}
+			opaque = opaque || o
+		}
+	}
+	return "", opaque
+}
+
+// tagged reports whether the field of the struct is tagged with
+// SensitiveTag.
+func tagged(parent nature.Nature, name string, tags []string) bool {
+	if parent.Type == nil {
+		return false
+	}
+	t := deref.Type(parent.Type)
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	field, ok := parent.Deref().FieldByName(name, tags...)
+	if !ok {
+		return false
+	}
+	return t.FieldByIndex(field.FieldIndex).Tag.Get(SensitiveTag) == "true"
+}
+
+// sensitiveFields returns the paths of conf.Config.Sensitive which end at a
+// field of a struct, by that field, like User.Email by the field Email of
+// the type of User.
+func sensitiveFields(config *conf.Config) map[structField]string {
+	fields := map[structField]string{}
+	for path := range config.Sensitive {
+		parts := strings.Split(path, ".")
+		nt, ok := config.Env, true
+		for _, part := range parts[:len(parts)-1] {
+			if nt, ok = nt.Get(part, config.FieldTags...); !ok {
+				break
+			}
+		}
+		if !ok || nt.Type == nil {
+			continue
+		}
+		if t := deref.Type(nt.Type); t.Kind() == reflect.Struct {
+			f := structField{t, parts[len(parts)-1]}
+			if old, ok := fields[f]; !ok || path < old {
+				fields[f] = path
+			}
+		}
+	}
+	return fields
+}
+
+// fieldPath returns the path of conf.Config.Sensitive which ends at the
+// field of the struct, if any.
+func (s *sensitivity) fieldPath(parent nature.Nature, name string) string {
+	if parent.Type == nil {
+		return ""
+	}
+	return s.fieldPaths[structField{deref.Type(parent.Type), name}]
+}
+
+// memberPath returns the path of a chain of fields read from the env, like
+// "User.Email". Fields read through $env, like $env.User.Email or
+// $env["User"]["Email"], have the same paths.
+func memberPath(node ast.Node) (string, bool) {
+	switch n := node.(type) {
+	case *ast.IdentifierNode:
+		return n.Value, true
+	case *ast.ChainNode:
+		return memberPath(n.Node)
+	case *ast.MemberNode:
+		p, ok := n.Property.(*ast.StringNode)
+		if !ok {
+			return "", false
+		}
+		base, ok := memberPath(n.Node)
+		if !ok {
+			return "", false
+		}
+		if base == "$env" {
+			return p.Value, true
+		}
+		return base + "." + p.Value, true
+	}
+	return "", false
+}
+
+// first returns the first of taints which is not held, or else the first
+// held one.
+func first(taints ...taint) taint {
+	var held taint
+	for _, t := range taints {
+		if t.name != "" && !t.held {
+			return t
+		}
+		if held.name == "" {
+			held = t
+		}
+	}
+	return held
+}
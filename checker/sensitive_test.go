@@ -0,0 +1,89 @@
+package checker_test
+
+import (
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+)
+
+type sensitiveUser struct {
+	Name  string
+	Email string `sensitive:"true"`
+	SSN   string
+	Age   int
+}
+
+type sensitiveEnv struct {
+	User   sensitiveUser
+	Users  []sensitiveUser
+	Secret string
+}
+
+func TestCheckSensitive(t *testing.T) {
+	tests := []struct {
+		code string
+		err  string
+	}{
+		{`User.Email == "a@example.com"`, ``},
+		{`User.Email endsWith "@example.com" ? "ours" : User.Name`, ``},
+		{`User.SSN != "" && len(User.SSN) == 9`, ``},
+		{`any(Users, .Email contains "@") ? 1 : 0`, ``},
+		{`count(Users, hasSuffix(.Email, ".fr"))`, ``},
+		{`map(Users, .Name)`, ``},
+		{`let s = User.SSN; s`, `sensitive value User.SSN can not be the result`},
+		{`User.Email`, `sensitive value User.Email can not be the result`},
+		{`"mail: " + User.Email`, `sensitive value User.Email can not be the result`},
+		{`User.Age > 18 ? User.SSN : ""`, `sensitive value User.SSN can not be the result`},
+		{`let e = User.Email; [e]`, `sensitive value User.Email can not be the result`},
+		{`map(Users, .Email)`, `sensitive value Email can not be the result`},
+		{`upper(User.Email) == "X"`, `sensitive value User.Email can not be passed to upper`},
+		{`join(map(Users, .Email), ",") != ""`, `sensitive value Email can not be passed to join`},
+		{`len(Secret)`, `sensitive value Secret can not be the result`},
+		{`User.Name + Users[0].Name`, ``},
+		{`len(Users) + count(Users, .Age > 18)`, ``},
+		{`let f = (u) => u.Age > 18; f(User) ? 1 : 0`, ``},
+		{`User`, `sensitive value User.SSN can not be the result`},
+		{`filter(Users, .Age > 18)`, `sensitive value Email can not be the result`},
+		{`{"user": User}`, `sensitive value User.SSN can not be the result`},
+		{`string(User) != ""`, `sensitive value User.SSN can not be passed to string`},
+		{`toJSON(User) != ""`, `sensitive value User.SSN can not be passed to toJSON`},
+		{`fromJSON(toJSON(User))`, `sensitive value User.SSN can not be passed to toJSON`},
+		{`let f = (u) => u.Email; f(User)`, `sensitive value User.SSN can not be the result`},
+		{`((s) => s)(Secret)`, `sensitive value Secret can not be the result`},
+		{`let f = (u) => u.Email; map(Users, f)`, `sensitive value Users.Email can not be the result`},
+		{`let u = User; [u]`, `sensitive value Email can not be the result`},
+		{`$env.User.SSN`, `sensitive value User.SSN can not be the result`},
+		{`$env["User"]["SSN"]`, `sensitive value User.SSN can not be the result`},
+		{`$env.Secret`, `sensitive value Secret can not be the result`},
+		{`[User][0].SSN`, `sensitive value User.SSN can not be the result`},
+		{`Users[0].SSN`, `sensitive value User.SSN can not be the result`},
+		{`map(Users, .SSN)`, `sensitive value User.SSN can not be the result`},
+		{`upper($env.User.SSN) == "X"`, `sensitive value User.SSN can not be passed to upper`},
+		{`$env.User.SSN == "123-45" ? $env.User.Name : ""`, ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			_, err := expr.Compile(tt.code, expr.Env(sensitiveEnv{}), expr.Sensitive("User.SSN", "Secret"))
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckSensitive_map_env(t *testing.T) {
+	env := map[string]any{"user": map[string]any{"phone": "123"}}
+	_, err := expr.Compile(`user.phone`, expr.Env(env), expr.Sensitive("user.phone"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "sensitive value user.phone can not be the result")
+
+	_, err = expr.Compile(`user.phone`, expr.Env(env))
+	require.NoError(t, err)
+}
@@ -1,10 +1,12 @@
 package checker
 
 import (
+	"math/big"
 	"reflect"
 	"time"
 
 	. "github.com/expr-lang/expr/checker/nature"
+	"github.com/expr-lang/expr/vm/runtime"
 )
 
 var (
@@ -14,10 +16,12 @@ var (
 	integerNature  = Nature{Type: reflect.TypeOf(0)}
 	floatNature    = Nature{Type: reflect.TypeOf(float64(0))}
 	stringNature   = Nature{Type: reflect.TypeOf("")}
+	bytesNature    = Nature{Type: reflect.TypeOf([]byte{})}
 	arrayNature    = Nature{Type: reflect.TypeOf([]any{})}
 	mapNature      = Nature{Type: reflect.TypeOf(map[string]any{})}
 	timeNature     = Nature{Type: reflect.TypeOf(time.Time{})}
 	durationNature = Nature{Type: reflect.TypeOf(time.Duration(0))}
+	decimalNature  = Nature{Type: reflect.TypeOf(&big.Rat{})}
 )
 
 var (
@@ -25,6 +29,8 @@ var (
 	timeType     = reflect.TypeOf(time.Time{})
 	durationType = reflect.TypeOf(time.Duration(0))
 	arrayType    = reflect.TypeOf([]any{})
+	decimalType  = reflect.TypeOf(big.Rat{})
+	closureType  = reflect.TypeOf(&runtime.Closure{})
 )
 
 func arrayOf(nt Nature) Nature {
@@ -38,6 +44,76 @@ func isNil(nt Nature) bool {
 	return nt.Nil
 }
 
+// underlying returns the builtin type of a named basic type, like string
+// for type Status string. time.Duration is kept, as it has its own
+// operators.
+func underlying(nt Nature) (Nature, bool) {
+	if nt.Type == nil || nt.PkgPath() == "" || isDuration(nt) {
+		return nt, false
+	}
+	switch nt.Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return Nature{Type: basicType(nt.Kind())}, true
+	}
+	return nt, false
+}
+
+func basicType(k reflect.Kind) reflect.Type {
+	switch k {
+	case reflect.Bool:
+		return boolNature.Type
+	case reflect.String:
+		return stringNature.Type
+	case reflect.Int:
+		return reflect.TypeOf(0)
+	case reflect.Int8:
+		return reflect.TypeOf(int8(0))
+	case reflect.Int16:
+		return reflect.TypeOf(int16(0))
+	case reflect.Int32:
+		return reflect.TypeOf(int32(0))
+	case reflect.Int64:
+		return reflect.TypeOf(int64(0))
+	case reflect.Uint:
+		return reflect.TypeOf(uint(0))
+	case reflect.Uint8:
+		return reflect.TypeOf(uint8(0))
+	case reflect.Uint16:
+		return reflect.TypeOf(uint16(0))
+	case reflect.Uint32:
+		return reflect.TypeOf(uint32(0))
+	case reflect.Uint64:
+		return reflect.TypeOf(uint64(0))
+	case reflect.Float32:
+		return reflect.TypeOf(float32(0))
+	}
+	return floatNature.Type
+}
+
+// comparable returns the operands of a comparison with named basic types
+// replaced by their builtin types, if the other operand is an untyped
+// literal or of the same named type. So Status == "active" and Level > 2
+// are checked like string and int comparisons, as in Go, while Str == Status
+// is still a type mismatch.
+func comparable(l, r Nature, lUntyped, rUntyped bool) (Nature, Nature) {
+	lb, lok := underlying(l)
+	rb, rok := underlying(r)
+	switch {
+	case lok && rok:
+		if l.Type == r.Type {
+			return lb, rb
+		}
+	case lok && rUntyped && r.PkgPath() == "":
+		return lb, r
+	case rok && lUntyped && l.PkgPath() == "":
+		return l, rb
+	}
+	return l, r
+}
+
 func combined(l, r Nature) Nature {
 	if isUnknown(l) || isUnknown(r) {
 		return unknown
@@ -96,6 +172,26 @@ func isNumber(nt Nature) bool {
 	return isInteger(nt) || isFloat(nt)
 }
 
+// isDecimal reports whether nt is a decimal of the decimal mode. Decimals
+// are not numbers for builtins, only for arithmetic and comparison, and
+// they are converted with abs, int, float and string.
+func isDecimal(nt Nature) bool {
+	switch nt.Type {
+	case decimalType, decimalNature.Type:
+		return true
+	}
+	return false
+}
+
+// decimals reports whether one operand is a decimal and the other one is a
+// decimal or a number, so the operation is carried out in decimals.
+func decimals(l, r Nature) bool {
+	if isDecimal(l) {
+		return isDecimal(r) || isNumber(r)
+	}
+	return isNumber(l) && isDecimal(r)
+}
+
 func isTime(nt Nature) bool {
 	switch nt.Type {
 	case timeType:
@@ -128,6 +224,12 @@ func isString(nt Nature) bool {
 	return false
 }
 
+// isBytes reports whether nt is []byte. Bytes are arrays, but are also
+// concatenated and ordered like strings.
+func isBytes(nt Nature) bool {
+	return nt.Type == bytesNature.Type
+}
+
 func isArray(nt Nature) bool {
 	switch nt.Kind() {
 	case reflect.Slice, reflect.Array:
@@ -186,5 +288,8 @@ func isComparable(l, r Nature) bool {
 	if isArray(l) && isArray(r) {
 		return true
 	}
+	if decimals(l, r) {
+		return true
+	}
 	return l.AssignableTo(r)
 }
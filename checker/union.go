@@ -0,0 +1,151 @@
+package checker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/expr-lang/expr/ast"
+	. "github.com/expr-lang/expr/checker/nature"
+	"github.com/expr-lang/expr/file"
+)
+
+func isUnion(nt Nature) bool {
+	return len(nt.Union) > 0
+}
+
+// members returns the members of a union, or the nature itself.
+func members(nt Nature) []Nature {
+	if isUnion(nt) {
+		return nt.Union
+	}
+	return []Nature{nt}
+}
+
+// each checks an operation for every combination of the members of its
+// operands, as an operation on a union is valid only if it is valid for all
+// of its members. It returns the union of the results. The error of the
+// first invalid combination names the members it was found for.
+func (v *checker) each(operands []Nature, check func(members []Nature) Nature) Nature {
+	var results []Nature
+	ok := combinations(operands, func(combination []Nature) bool {
+		before := v.err
+		nt := check(combination)
+		if v.err != before {
+			v.err.Message += unionNote(operands, combination)
+			return false
+		}
+		results = append(results, nt)
+		return true
+	})
+	if !ok {
+		return unknown
+	}
+	return UnionOf(results...)
+}
+
+// some checks an operation like each, but it is valid if it is valid for
+// one combination of the members, like comparisons of a union with a value
+// of one of its members. Otherwise the error of the first combination is
+// reported.
+func (v *checker) some(operands []Nature, check func(members []Nature) Nature) Nature {
+	before := v.err
+	var first *file.Error
+	var results []Nature
+	combinations(operands, func(combination []Nature) bool {
+		nt := check(combination)
+		if v.err != before {
+			if first == nil {
+				first = v.err
+				first.Message += unionNote(operands, combination)
+			}
+			v.err = before
+			return true
+		}
+		results = append(results, nt)
+		return true
+	})
+	if len(results) == 0 {
+		v.err = first
+		return unknown
+	}
+	return UnionOf(results...)
+}
+
+// bools reports whether nt, or every member of it if it is a union, is a
+// bool or unknown, like conditions must be. Otherwise it reports the error
+// of the first other member.
+func (v *checker) bools(node ast.Node, nt Nature, format string) bool {
+	check := func(m []Nature) Nature {
+		if !isBool(m[0]) && !isUnknown(m[0]) {
+			return v.error(node, format, m[0])
+		}
+		return boolNature
+	}
+	before := v.err
+	if isUnion(nt) {
+		v.each([]Nature{nt}, check)
+	} else {
+		check([]Nature{nt})
+	}
+	return v.err == before
+}
+
+// predicateOut returns the nature a predicate returns, with the members if
+// it is a union.
+func predicateOut(predicate Nature) Nature {
+	if predicate.PredicateOut != nil && isUnion(*predicate.PredicateOut) {
+		return *predicate.PredicateOut
+	}
+	return predicate.Out(0)
+}
+
+// array checks that every member of a union given as the collection of a
+// builtin is an array. Other natures are checked by the builtins.
+func (v *checker) array(node *ast.BuiltinNode, collection Nature) Nature {
+	if !isUnion(collection) {
+		return collection
+	}
+	return v.each([]Nature{collection}, func(m []Nature) Nature {
+		nt := m[0].Deref()
+		if !isArray(nt) && !isUnknown(nt) {
+			return v.error(node.Arguments[0], "builtin %v takes only array (got %v)", node.Name, nt)
+		}
+		return nt
+	})
+}
+
+// combinations calls fn with every combination of the members of the
+// operands, until it returns false.
+func combinations(operands []Nature, fn func(combination []Nature) bool) bool {
+	combination := make([]Nature, len(operands))
+	var walk func(i int) bool
+	walk = func(i int) bool {
+		if i == len(operands) {
+			return fn(append([]Nature(nil), combination...))
+		}
+		for _, m := range members(operands[i]) {
+			combination[i] = m
+			if !walk(i + 1) {
+				return false
+			}
+		}
+		return true
+	}
+	return walk(0)
+}
+
+// unionNote describes the members of the unions of a combination, like
+// " (for int of string | int)".
+func unionNote(operands, combination []Nature) string {
+	var notes []string
+	for i, nt := range operands {
+		if isUnion(nt) {
+			m := combination[i].String()
+			if combination[i].Nil {
+				m = "nil"
+			}
+			notes = append(notes, fmt.Sprintf("%v of %v", m, nt))
+		}
+	}
+	return fmt.Sprintf(" (for %v)", strings.Join(notes, " and "))
+}
@@ -0,0 +1,930 @@
+// Package codegen translates expressions to Go source code, for programs
+// which embed a fixed set of expressions and want to run them without the
+// VM. Every expression becomes a function of the env:
+//
+//	func Name(env *Env) (T, error)
+//
+// where Env is the struct of expr.Env and T the type of the expression.
+// Operations on values of known types are translated to plain Go; the others,
+// on values of unknown types, use the helpers of the VM, like runtime.Equal
+// or runtime.Fetch, so the functions return what the VM returns. Expressions
+// which need the VM, like calls of functions of expr.Function, are rejected
+// with an UnsupportedError, and are meant to be run by the VM instead.
+package codegen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/token"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/checker"
+	"github.com/expr-lang/expr/checker/nature"
+	"github.com/expr-lang/expr/conf"
+	"github.com/expr-lang/expr/file"
+)
+
+// Func is an expression to translate to a Go function of the name.
+type Func struct {
+	Name       string
+	Expression string
+}
+
+// UnsupportedError is the error of an expression with a node which can not
+// be translated to Go.
+type UnsupportedError struct {
+	Func string
+	Err  *file.Error
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("func %s: %v", e.Func, e.Err)
+}
+
+// Generate returns the source of a Go file of the package with the import
+// path pkg, with a function per expression, checked with the options. The
+// options must set a struct env with expr.Env. Options which only change
+// how the VM runs, like expr.Optimize, have no effect, and the ones changing
+// the results of operations, like expr.CheckedArithmetic or
+// expr.WithNilOnMissing, are not supported.
+func Generate(pkg string, funcs []Func, ops ...expr.Option) ([]byte, error) {
+	config := conf.CreateNew()
+	for _, op := range ops {
+		op(config)
+	}
+	for name := range config.Disabled {
+		delete(config.Builtins, name)
+	}
+	config.Check()
+
+	env := config.Env.Type
+	if env != nil && env.Kind() == reflect.Ptr {
+		env = env.Elem()
+	}
+	if env == nil || env.Kind() != reflect.Struct || env.Name() == "" {
+		return nil, errors.New("codegen: the env must be a named struct, see expr.Env")
+	}
+	switch {
+	case config.CheckedArithmetic:
+		return nil, errors.New("codegen: checked arithmetic is not supported")
+	case config.DecimalMode:
+		return nil, errors.New("codegen: decimals are not supported")
+	case config.NilOnMissing, config.NilOnOutOfRange:
+		return nil, errors.New("codegen: nil on missing values is not supported")
+	case config.FloatEpsilon != 0:
+		return nil, errors.New("codegen: float epsilon is not supported")
+	case config.CaseInsensitiveFields:
+		return nil, errors.New("codegen: case-insensitive fields are not supported")
+	case config.StrictNil:
+		return nil, errors.New("codegen: strict nil equality is not supported")
+	case config.InjectContext:
+		return nil, errors.New("codegen: injected contexts are not supported")
+	}
+
+	g := &generator{
+		pkg:     pkg,
+		env:     env,
+		imports: map[string]string{"fmt": "fmt"},
+		tags:    config.FieldTags,
+	}
+	var body bytes.Buffer
+	for _, fn := range funcs {
+		if !token.IsIdentifier(fn.Name) {
+			return nil, fmt.Errorf("codegen: invalid func name %q", fn.Name)
+		}
+		tree, err := checker.ParseCheck(fn.Expression, config)
+		if err != nil {
+			return nil, fmt.Errorf("func %s: %w", fn.Name, err)
+		}
+		g.err = nil
+		g.vars = 0
+		g.used = map[string]bool{}
+		code, t := g.expr(tree.Node)
+		// The checker types some nodes more loosely than the values of the
+		// generated code, like []any for ranges, which are []int.
+		out := tree.Node.Type()
+		if out == nil || !isAny(t) && !t.AssignableTo(out) && !(isNumber(t) && isNumber(out)) {
+			out = t
+		}
+		result := g.convert(code, t, out)
+		if g.err != nil {
+			return nil, &UnsupportedError{Func: fn.Name, Err: g.err.Bind(tree.Source)}
+		}
+
+		fmt.Fprintf(&body, "\n// %s evaluates:\n//\n", fn.Name)
+		for _, line := range strings.Split(fn.Expression, "\n") {
+			fmt.Fprintf(&body, "//\t%s\n", line)
+		}
+		fmt.Fprintf(&body, "func %s(env *%s) (out %s, err error) {\n", fn.Name, g.typeName(env), g.typeName(out))
+		body.WriteString("\tdefer func() {\n\t\tif r := recover(); r != nil {\n\t\t\terr = fmt.Errorf(\"%v\", r)\n\t\t}\n\t}()\n")
+		fmt.Fprintf(&body, "\treturn %s, nil\n}\n", result)
+	}
+
+	var src bytes.Buffer
+	src.WriteString("// Code generated by codegen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&src, "package %s\n\nimport (\n", path.Base(pkg))
+	var std, others []string
+	for p := range g.imports {
+		if strings.Contains(strings.Split(p, "/")[0], ".") {
+			others = append(others, p)
+		} else {
+			std = append(std, p)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(others)
+	for _, p := range std {
+		fmt.Fprintf(&src, "\t%q\n", p)
+	}
+	if len(others) > 0 {
+		src.WriteString("\n")
+	}
+	for _, p := range others {
+		fmt.Fprintf(&src, "\t%q\n", p)
+	}
+	src.WriteString(")\n")
+	for _, global := range g.globals {
+		fmt.Fprintf(&src, "\n%s\n", global)
+	}
+	src.Write(body.Bytes())
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("codegen: invalid source: %w\n%s", err, src.Bytes())
+	}
+	return formatted, nil
+}
+
+type generator struct {
+	pkg     string
+	env     reflect.Type
+	imports map[string]string // import path -> name
+	globals []string          // package level declarations, like compiled regexps
+	regexps map[string]string // pattern -> name of its global
+	tags    []string          // tags naming fields, see conf.Config.FieldTags
+	scopes  []variable        // variables of let and elements of predicates, innermost last
+	vars    int
+	used    map[string]bool // variables of predicates used by their bodies
+	err     *file.Error     // first node which can not be translated
+}
+
+// variable is a variable of the generated code.
+type variable struct {
+	name  string // name in the expression, "" for the element of a predicate
+	code  string
+	index string // index of the element of a predicate
+	t     reflect.Type
+}
+
+var (
+	anyType     = reflect.TypeOf((*any)(nil)).Elem()
+	boolType    = reflect.TypeOf(false)
+	intType     = reflect.TypeOf(0)
+	floatType   = reflect.TypeOf(float64(0))
+	stringType  = reflect.TypeOf("")
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	intsType    = reflect.TypeOf([]int{})
+	arrayType   = reflect.TypeOf([]any{})
+	reservedIds = map[string]bool{
+		"env": true, "out": true, "err": true, "r": true,
+		"fmt": true, "runtime": true, "builtin": true, "strings": true, "regexp": true,
+		"any": true, "bool": true, "int": true, "float64": true, "string": true,
+		"len": true, "make": true, "append": true, "nil": true, "true": true, "false": true,
+	}
+)
+
+// unsupported records that the node can not be translated.
+func (g *generator) unsupported(node ast.Node, format string, args ...any) (string, reflect.Type) {
+	if g.err == nil {
+		g.err = &file.Error{
+			Location: node.Location(),
+			Message:  fmt.Sprintf(format, args...),
+		}
+	}
+	return "nil", anyType
+}
+
+func (g *generator) use(importPath string) string {
+	name := path.Base(importPath)
+	g.imports[importPath] = name
+	return name
+}
+
+func (g *generator) runtime(fn string) string {
+	return g.use("github.com/expr-lang/expr/vm/runtime") + "." + fn
+}
+
+func (g *generator) variable(prefix string) string {
+	g.vars++
+	return fmt.Sprintf("%s%d", prefix, g.vars)
+}
+
+func (g *generator) lookup(name string) (variable, bool) {
+	for i := len(g.scopes) - 1; i >= 0; i-- {
+		if g.scopes[i].name == name && name != "" {
+			return g.scopes[i], true
+		}
+	}
+	return variable{}, false
+}
+
+// element returns the element of the predicate at the level, from 1 for the
+// outermost one, or of the innermost predicate if level is 0.
+func (g *generator) element(level int) (variable, bool) {
+	var elements []variable
+	for _, v := range g.scopes {
+		if v.name == "" {
+			elements = append(elements, v)
+		}
+	}
+	switch {
+	case len(elements) == 0 || level > len(elements):
+		return variable{}, false
+	case level == 0:
+		return elements[len(elements)-1], true
+	}
+	return elements[level-1], true
+}
+
+// typeName returns the name of the type in the generated code, importing
+// its package.
+func (g *generator) typeName(t reflect.Type) string {
+	if t == nil {
+		return "any"
+	}
+	if t.Name() != "" {
+		if t.PkgPath() == "" {
+			return t.Name()
+		}
+		if t.PkgPath() == g.pkg {
+			return t.Name()
+		}
+		// The name of the package, which may differ from the last element of
+		// its path.
+		name := strings.TrimSuffix(t.String(), "."+t.Name())
+		g.imports[t.PkgPath()] = name
+		return name + "." + t.Name()
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return "any"
+		}
+	case reflect.Ptr:
+		return "*" + g.typeName(t.Elem())
+	case reflect.Slice:
+		return "[]" + g.typeName(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), g.typeName(t.Elem()))
+	case reflect.Map:
+		return "map[" + g.typeName(t.Key()) + "]" + g.typeName(t.Elem())
+	case reflect.Func:
+		in := make([]string, t.NumIn())
+		for i := range in {
+			in[i] = g.typeName(t.In(i))
+		}
+		if t.IsVariadic() {
+			in[len(in)-1] = "..." + g.typeName(t.In(len(in)-1).Elem())
+		}
+		out := make([]string, t.NumOut())
+		for i := range out {
+			out[i] = g.typeName(t.Out(i))
+		}
+		switch len(out) {
+		case 0:
+			return fmt.Sprintf("func(%s)", strings.Join(in, ", "))
+		case 1:
+			return fmt.Sprintf("func(%s) %s", strings.Join(in, ", "), out[0])
+		}
+		return fmt.Sprintf("func(%s) (%s)", strings.Join(in, ", "), strings.Join(out, ", "))
+	}
+	// Anonymous structs and interfaces, and channels.
+	return t.String()
+}
+
+func isAny(t reflect.Type) bool {
+	return t == nil || t.Kind() == reflect.Interface
+}
+
+func isInt(t reflect.Type) bool {
+	return t == intType
+}
+
+func isFloat(t reflect.Type) bool {
+	return t == floatType
+}
+
+func isNumber(t reflect.Type) bool {
+	if t == nil {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// convert returns the code of the value of code, of type from, as type to.
+func (g *generator) convert(code string, from, to reflect.Type) string {
+	switch {
+	case to == nil || from == to:
+		return code
+	case code == "nil":
+		return code
+	case to.Kind() == reflect.Interface:
+		if from != nil && from.Implements(to) {
+			return code
+		}
+		return fmt.Sprintf("%s.(%s)", code, g.typeName(to))
+	case isAny(from):
+		return fmt.Sprintf("%s.(%s)", code, g.typeName(to))
+	case from.Kind() == reflect.Ptr && from.Elem() == to:
+		return "*" + code
+	case isNumber(from) && isNumber(to):
+		return fmt.Sprintf("%s(%s)", g.typeName(to), code)
+	case from.AssignableTo(to):
+		return code
+	}
+	return fmt.Sprintf("%s(%s)", g.typeName(to), code)
+}
+
+// block returns the code of a function literal of the statements, called
+// in place, for nodes which Go has no expression for.
+func (g *generator) block(t reflect.Type, statements ...string) string {
+	return fmt.Sprintf("func() %s {\n%s\n}()", g.typeName(t), strings.Join(statements, "\n"))
+}
+
+func (g *generator) expr(node ast.Node) (string, reflect.Type) {
+	switch n := node.(type) {
+	case *ast.NilNode:
+		return "nil", nil
+	case *ast.IntegerNode:
+		if t := n.Type(); isFloat(t) {
+			return floatLiteral(float64(n.Value)), t
+		} else if t != nil && t != intType && isNumber(t) {
+			return fmt.Sprintf("%s(%d)", g.typeName(t), n.Value), t
+		}
+		return strconv.Itoa(n.Value), intType
+	case *ast.FloatNode:
+		return floatLiteral(n.Value), floatType
+	case *ast.BoolNode:
+		return strconv.FormatBool(n.Value), boolType
+	case *ast.StringNode:
+		return strconv.Quote(n.Value), stringType
+	case *ast.ConstantNode:
+		switch v := n.Value.(type) {
+		case int:
+			return strconv.Itoa(v), intType
+		case float64:
+			return floatLiteral(v), floatType
+		case bool:
+			return strconv.FormatBool(v), boolType
+		case string:
+			return strconv.Quote(v), stringType
+		}
+		return g.unsupported(n, "constant of type %T", n.Value)
+	case *ast.IdentifierNode:
+		return g.identifier(n)
+	case *ast.PointerNode:
+		return g.pointer(n)
+	case *ast.MemberNode:
+		return g.member(n)
+	case *ast.ChainNode:
+		return g.expr(n.Node)
+	case *ast.CallNode:
+		return g.call(n)
+	case *ast.BuiltinNode:
+		return g.builtin(n)
+	case *ast.UnaryNode:
+		return g.unary(n)
+	case *ast.BinaryNode:
+		return g.binary(n)
+	case *ast.ConditionalNode:
+		cond, ct := g.expr(n.Cond)
+		a, at := g.expr(n.Exp1)
+		b, bt := g.expr(n.Exp2)
+		t := n.Type()
+		if at == bt && at != nil {
+			t = at
+		}
+		return g.block(t,
+			fmt.Sprintf("if %s {\nreturn %s\n}", g.convert(cond, ct, boolType), g.convert(a, at, t)),
+			fmt.Sprintf("return %s", g.convert(b, bt, t)),
+		), t
+	case *ast.VariableDeclaratorNode:
+		value, vt := g.expr(n.Value)
+		name := n.Name
+		if !token.IsIdentifier(name) || reservedIds[name] {
+			name = g.variable("v")
+		}
+		g.scopes = append(g.scopes, variable{name: n.Name, code: name, t: vt})
+		code, t := g.expr(n.Expr)
+		g.scopes = g.scopes[:len(g.scopes)-1]
+		return g.block(t,
+			fmt.Sprintf("%s := %s", name, value),
+			fmt.Sprintf("_ = %s", name),
+			fmt.Sprintf("return %s", code),
+		), t
+	case *ast.SequenceNode:
+		statements := make([]string, len(n.Nodes))
+		var t reflect.Type
+		for i, node := range n.Nodes {
+			var code string
+			code, t = g.expr(node)
+			if i < len(n.Nodes)-1 {
+				statements[i] = "_ = " + code
+			} else {
+				statements[i] = "return " + code
+			}
+		}
+		return g.block(t, statements...), t
+	case *ast.ArrayNode:
+		elems := make([]string, len(n.Nodes))
+		for i, node := range n.Nodes {
+			code, t := g.expr(node)
+			elems[i] = g.convert(code, t, anyType)
+		}
+		return fmt.Sprintf("[]any{%s}", strings.Join(elems, ", ")), arrayType
+	case *ast.MapNode:
+		pairs := make([]string, len(n.Pairs))
+		for i, pair := range n.Pairs {
+			p := pair.(*ast.PairNode)
+			key, kt := g.expr(p.Key)
+			value, vt := g.expr(p.Value)
+			pairs[i] = fmt.Sprintf("%s: %s", g.convert(key, kt, stringType), g.convert(value, vt, anyType))
+		}
+		return fmt.Sprintf("map[string]any{%s}", strings.Join(pairs, ", ")), reflect.TypeOf(map[string]any{})
+	}
+	return g.unsupported(node, "%s is not supported", strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."))
+}
+
+// zero reports whether the node is a constant zero in the generated code.
+func zero(node ast.Node) bool {
+	v, ok := constant(node)
+	return ok && v == 0
+}
+
+// constant returns the value of a node, which is a constant in the
+// generated code, like 2 - 2.
+func constant(node ast.Node) (float64, bool) {
+	switch n := node.(type) {
+	case *ast.IntegerNode:
+		return float64(n.Value), true
+	case *ast.FloatNode:
+		return n.Value, true
+	case *ast.ConstantNode:
+		switch v := n.Value.(type) {
+		case int:
+			return float64(v), true
+		case float64:
+			return v, true
+		}
+	case *ast.UnaryNode:
+		v, ok := constant(n.Node)
+		switch n.Operator {
+		case "-":
+			return -v, ok
+		case "+":
+			return v, ok
+		}
+	case *ast.BinaryNode:
+		l, ok := constant(n.Left)
+		if !ok {
+			return 0, false
+		}
+		r, ok := constant(n.Right)
+		if !ok {
+			return 0, false
+		}
+		switch n.Operator {
+		case "+":
+			return l + r, true
+		case "-":
+			return l - r, true
+		case "*":
+			return l * r, true
+		case "/":
+			if r != 0 {
+				return l / r, true
+			}
+		case "%":
+			if int(r) != 0 {
+				return float64(int(l) % int(r)), true
+			}
+		}
+	}
+	return 0, false
+}
+
+func floatLiteral(v float64) string {
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+func (g *generator) identifier(n *ast.IdentifierNode) (string, reflect.Type) {
+	if v, ok := g.lookup(n.Value); ok {
+		return v.code, v.t
+	}
+	if n.Value == "$env" {
+		return "*env", g.env
+	}
+	env := nature.Nature{Type: g.env}
+	if ok, index, _ := checker.FieldIndex(env, n, g.tags...); ok {
+		path, t := g.fieldPath(g.env, index)
+		return "env" + path, t
+	}
+	if m, name, ok := checker.Method(env, n); ok && m.Method {
+		method, _ := reflect.PtrTo(g.env).MethodByName(name)
+		return "env." + name, withoutReceiver(method.Type)
+	}
+	return g.unsupported(n, "unknown name %v, only fields and methods of the env are supported", n.Value)
+}
+
+// fieldPath returns the selectors of the field of the struct t at the index,
+// and its type.
+func (g *generator) fieldPath(t reflect.Type, index []int) (string, reflect.Type) {
+	var path strings.Builder
+	for _, i := range index {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		field := t.Field(i)
+		path.WriteString("." + field.Name)
+		t = field.Type
+	}
+	return path.String(), t
+}
+
+func withoutReceiver(t reflect.Type) reflect.Type {
+	in := make([]reflect.Type, t.NumIn()-1)
+	for i := range in {
+		in[i] = t.In(i + 1)
+	}
+	out := make([]reflect.Type, t.NumOut())
+	for i := range out {
+		out[i] = t.Out(i)
+	}
+	return reflect.FuncOf(in, out, t.IsVariadic())
+}
+
+func (g *generator) pointer(n *ast.PointerNode) (string, reflect.Type) {
+	level := 0
+	if n.Name != "" && n.Name != "index" {
+		var ok bool
+		if level, ok = n.Level(); !ok {
+			return g.unsupported(n, "#%v is not supported", n.Name)
+		}
+	}
+	v, ok := g.element(level)
+	if !ok {
+		return g.unsupported(n, "# outside of a predicate")
+	}
+	if n.Name == "index" {
+		g.used[v.index] = true
+		return v.index, intType
+	}
+	g.used[v.code] = true
+	return v.code, v.t
+}
+
+func (g *generator) member(n *ast.MemberNode) (string, reflect.Type) {
+	if n.Optional {
+		return g.unsupported(n, "optional chaining is not supported")
+	}
+	base, bt := g.expr(n.Node)
+	if isAny(bt) {
+		prop, pt := g.expr(n.Property)
+		return fmt.Sprintf("%s(%s, %s)", g.runtime("Fetch"), base, g.convert(prop, pt, anyType)), anyType
+	}
+
+	t := bt
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if m, name, ok := checker.Method(nature.Nature{}, n); ok && m.Method {
+			if m.PointerReceiver && bt.Kind() != reflect.Ptr {
+				return g.unsupported(n, "method %v with a pointer receiver of a value", name)
+			}
+			method, _ := reflect.PtrTo(t).MethodByName(name)
+			return base + "." + name, withoutReceiver(method.Type)
+		}
+		if ok, index, _ := checker.FieldIndex(nature.Nature{}, n, g.tags...); ok {
+			path, ft := g.fieldPath(t, index)
+			return base + path, ft
+		}
+	case reflect.Map:
+		key, kt := g.expr(n.Property)
+		return fmt.Sprintf("%s[%s]", base, g.convert(key, kt, t.Key())), t.Elem()
+	case reflect.Slice, reflect.Array:
+		// Negative indexes count from the end, only constant non-negative
+		// indexes are plain Go.
+		if i, ok := n.Property.(*ast.IntegerNode); ok && i.Value >= 0 {
+			return fmt.Sprintf("%s[%d]", base, i.Value), t.Elem()
+		}
+		index, it := g.expr(n.Property)
+		return fmt.Sprintf("%s(%s, %s).(%s)", g.runtime("Fetch"), base, g.convert(index, it, anyType), g.typeName(t.Elem())), t.Elem()
+	}
+	return g.unsupported(n, "member of %v is not supported", bt)
+}
+
+func (g *generator) call(n *ast.CallNode) (string, reflect.Type) {
+	callee, ft := g.expr(n.Callee)
+	if g.err != nil {
+		return "nil", anyType
+	}
+	if ft == nil || ft.Kind() != reflect.Func {
+		return g.unsupported(n, "call of %v is not supported", ft)
+	}
+	args := make([]string, len(n.Arguments))
+	for i, arg := range n.Arguments {
+		code, t := g.expr(arg)
+		in := ft.NumIn() - 1
+		var param reflect.Type
+		if ft.IsVariadic() && i >= in {
+			param = ft.In(in).Elem()
+		} else {
+			param = ft.In(i)
+		}
+		args[i] = g.convert(code, t, param)
+	}
+	code := fmt.Sprintf("%s(%s)", callee, strings.Join(args, ", "))
+	switch {
+	case ft.NumOut() == 1:
+		return code, ft.Out(0)
+	case ft.NumOut() == 2 && ft.Out(1) == errorType:
+		out := ft.Out(0)
+		return g.block(out,
+			fmt.Sprintf("out, err := %s", code),
+			"if err != nil {\npanic(err)\n}",
+			"return out",
+		), out
+	}
+	return g.unsupported(n, "function of type %v is not supported", ft)
+}
+
+func (g *generator) builtin(n *ast.BuiltinNode) (string, reflect.Type) {
+	switch n.Name {
+	case "all", "any", "none", "one", "count", "filter", "map":
+		return g.predicate(n)
+	}
+	if len(n.Arguments) != 1 {
+		return g.unsupported(n, "builtin %v is not supported", n.Name)
+	}
+	arg, t := g.expr(n.Arguments[0])
+	switch n.Name {
+	case "len":
+		if isAny(t) {
+			return fmt.Sprintf("%s(%s)", g.runtime("Len"), arg), intType
+		}
+		if t.Kind() == reflect.String {
+			// The VM counts runes of strings, not bytes.
+			return fmt.Sprintf("%s.RuneCountInString(%s)", g.use("unicode/utf8"), g.convert(arg, t, stringType)), intType
+		}
+		return fmt.Sprintf("len(%s)", arg), intType
+	case "upper":
+		return fmt.Sprintf("%s.ToUpper(%s)", g.use("strings"), g.convert(arg, t, stringType)), stringType
+	case "lower":
+		return fmt.Sprintf("%s.ToLower(%s)", g.use("strings"), g.convert(arg, t, stringType)), stringType
+	case "trim":
+		return fmt.Sprintf("%s.TrimSpace(%s)", g.use("strings"), g.convert(arg, t, stringType)), stringType
+	case "int", "float", "string":
+		result := map[string]reflect.Type{"int": intType, "float": floatType, "string": stringType}[n.Name]
+		fn := strings.ToUpper(n.Name[:1]) + n.Name[1:]
+		return fmt.Sprintf("%s.%s(%s).(%s)", g.use("github.com/expr-lang/expr/builtin"), fn, arg, g.typeName(result)), result
+	}
+	return g.unsupported(n, "builtin %v is not supported", n.Name)
+}
+
+// predicate translates the builtins with a predicate to loops over the
+// elements of the array.
+func (g *generator) predicate(n *ast.BuiltinNode) (string, reflect.Type) {
+	if len(n.Arguments) != 2 {
+		return g.unsupported(n, "builtin %v is not supported", n.Name)
+	}
+	array, at := g.expr(n.Arguments[0])
+	predicate, ok := n.Arguments[1].(*ast.PredicateNode)
+	if isAny(at) || (at.Kind() != reflect.Slice && at.Kind() != reflect.Array) || !ok {
+		return g.unsupported(n, "%v of %v is not supported", n.Name, at)
+	}
+	index, elem := g.variable("i"), g.variable("v")
+	g.scopes = append(g.scopes, variable{code: elem, index: index, t: at.Elem()})
+	body, bt := g.expr(predicate.Node)
+	g.scopes = g.scopes[:len(g.scopes)-1]
+
+	if !g.used[index] {
+		index = "_"
+	}
+	if !g.used[elem] && n.Name != "filter" {
+		elem = "_"
+	}
+	loop := func(statements ...string) string {
+		return fmt.Sprintf("for %s, %s := range %s {\n%s\n}", index, elem, array, strings.Join(statements, "\n"))
+	}
+	cond := g.convert(body, bt, boolType)
+	switch n.Name {
+	case "all":
+		return g.block(boolType, loop(fmt.Sprintf("if !(%s) {\nreturn false\n}", cond)), "return true"), boolType
+	case "any":
+		return g.block(boolType, loop(fmt.Sprintf("if %s {\nreturn true\n}", cond)), "return false"), boolType
+	case "none":
+		return g.block(boolType, loop(fmt.Sprintf("if %s {\nreturn false\n}", cond)), "return true"), boolType
+	case "one", "count":
+		code := g.block(intType, "count := 0", loop(fmt.Sprintf("if %s {\ncount++\n}", cond)), "return count")
+		if n.Name == "one" {
+			return fmt.Sprintf("(%s == 1)", code), boolType
+		}
+		return code, intType
+	case "filter":
+		return g.block(arrayType, "out := []any{}", loop(fmt.Sprintf("if %s {\nout = append(out, %s)\n}", cond, elem)), "return out"), arrayType
+	case "map":
+		return g.block(arrayType, "out := []any{}", loop(fmt.Sprintf("out = append(out, %s)", body)), "return out"), arrayType
+	}
+	return g.unsupported(n, "builtin %v is not supported", n.Name)
+}
+
+// deref dereferences pointers to values which are not structs, like the VM
+// does for the operands of operators.
+func deref(code string, t reflect.Type) (string, reflect.Type) {
+	if t != nil && t.Kind() == reflect.Ptr && t.Elem().Kind() != reflect.Struct {
+		return "(*" + code + ")", t.Elem()
+	}
+	return code, t
+}
+
+// derefOrNil is like deref, but nil pointers are nil instead of failing, like
+// the VM does for the operands of == and !=.
+func (g *generator) derefOrNil(code string, t reflect.Type) (string, reflect.Type) {
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() == reflect.Struct {
+		return code, t
+	}
+	p := g.variable("p")
+	return g.block(anyType,
+		fmt.Sprintf("if %s := %s; %s != nil {\nreturn *%s\n}", p, code, p, p),
+		"return nil",
+	), anyType
+}
+
+func (g *generator) unary(n *ast.UnaryNode) (string, reflect.Type) {
+	code, t := g.expr(n.Node)
+	switch n.Operator {
+	case "!", "not":
+		return fmt.Sprintf("!%s", g.convert(code, t, boolType)), boolType
+	case "-":
+		if isNumber(t) {
+			return fmt.Sprintf("-%s", code), t
+		}
+		return fmt.Sprintf("%s(%s)", g.runtime("Negate"), code), anyType
+	case "+":
+		return code, t
+	}
+	return g.unsupported(n, "operator %v is not supported", n.Operator)
+}
+
+var runtimeOperators = map[string]string{
+	"==": "Equal",
+	"<":  "Less",
+	">":  "More",
+	"<=": "LessOrEqual",
+	">=": "MoreOrEqual",
+	"+":  "Add",
+	"-":  "Subtract",
+	"*":  "Multiply",
+}
+
+func (g *generator) binary(n *ast.BinaryNode) (string, reflect.Type) {
+	l, lt := g.expr(n.Left)
+	r, rt := g.expr(n.Right)
+	op := n.Operator
+	switch op {
+	case "??":
+	case "==", "!=":
+		l, lt = g.derefOrNil(l, lt)
+		r, rt = g.derefOrNil(r, rt)
+	default:
+		l, lt = deref(l, lt)
+		r, rt = deref(r, rt)
+	}
+
+	switch op {
+	case "&&", "and", "||", "or":
+		goOp := map[string]string{"and": "&&", "or": "||"}[op]
+		if goOp == "" {
+			goOp = op
+		}
+		return fmt.Sprintf("(%s %s %s)", g.convert(l, lt, boolType), goOp, g.convert(r, rt, boolType)), boolType
+
+	case "==", "!=":
+		var code string
+		if lt == rt && lt != nil && (lt.Kind() == reflect.String || lt.Kind() == reflect.Bool || isInt(lt) || isFloat(lt)) {
+			code = fmt.Sprintf("(%s == %s)", l, r)
+		} else {
+			code = fmt.Sprintf("%s(%s, %s)", g.runtime("Equal"), l, r)
+		}
+		if op == "!=" {
+			code = "!" + code
+		}
+		return code, boolType
+
+	case "<", ">", "<=", ">=", "+", "-", "*":
+		result := boolType
+		if op == "+" || op == "-" || op == "*" {
+			result = nil
+		}
+		switch {
+		case (isInt(lt) || isFloat(lt)) && (isInt(rt) || isFloat(rt)):
+			if lt != rt {
+				l, r, lt = g.convert(l, lt, floatType), g.convert(r, rt, floatType), floatType
+			}
+		case lt == stringType && rt == stringType && op != "-" && op != "*":
+		default:
+			if result == nil {
+				result = anyType
+			}
+			return fmt.Sprintf("%s(%s, %s)", g.runtime(runtimeOperators[op]), l, r), result
+		}
+		if result == nil {
+			result = lt
+		}
+		return fmt.Sprintf("(%s %s %s)", l, op, r), result
+
+	case "/":
+		// Go does not compile divisions by constant zeros, which are
+		// infinities for the VM.
+		if isNumber(lt) && isNumber(rt) && !zero(n.Right) {
+			return fmt.Sprintf("(%s / %s)", g.convert(l, lt, floatType), g.convert(r, rt, floatType)), floatType
+		}
+		return fmt.Sprintf("%s(%s, %s).(float64)", g.runtime("Divide"), l, r), floatType
+
+	case "%":
+		// The runtime panics with integer divide by zero, like the VM.
+		if isInt(lt) && isInt(rt) && !zero(n.Right) {
+			return fmt.Sprintf("(%s %% %s)", l, r), intType
+		}
+		return fmt.Sprintf("%s(%s, %s)", g.runtime("Modulo"), l, r), intType
+
+	case "**", "^":
+		return fmt.Sprintf("%s(%s, %s)", g.runtime("Exponent"), l, r), floatType
+
+	case "in":
+		return fmt.Sprintf("%s(%s, %s)", g.runtime("In"), l, r), boolType
+
+	case "..":
+		return fmt.Sprintf("%s(%s, %s)", g.runtime("MakeRange"), g.convert(l, lt, intType), g.convert(r, rt, intType)), intsType
+
+	case "contains", "startsWith", "endsWith":
+		fn := map[string]string{"contains": "Contains", "startsWith": "HasPrefix", "endsWith": "HasSuffix"}[op]
+		return fmt.Sprintf("%s.%s(%s, %s)", g.use("strings"), fn, g.convert(l, lt, stringType), g.convert(r, rt, stringType)), boolType
+
+	case "matches":
+		pattern, ok := n.Right.(*ast.StringNode)
+		if !ok {
+			return g.unsupported(n, "matches with a pattern which is not a constant string")
+		}
+		if g.regexps == nil {
+			g.regexps = map[string]string{}
+		}
+		re, ok := g.regexps[pattern.Value]
+		if !ok {
+			re = fmt.Sprintf("regexp%d", len(g.regexps))
+			g.regexps[pattern.Value] = re
+			g.globals = append(g.globals, fmt.Sprintf("var %s = %s.MustCompile(%s)", re, g.use("regexp"), r))
+		}
+		return fmt.Sprintf("%s.MatchString(%s)", re, g.convert(l, lt, stringType)), boolType
+
+	case "??":
+		t := n.Type()
+		if lt == rt && lt != nil {
+			t = lt
+		}
+		if !isAny(lt) && lt.Kind() != reflect.Ptr && lt.Kind() != reflect.Slice && lt.Kind() != reflect.Map {
+			// Never nil.
+			return l, lt
+		}
+		v := g.variable("v")
+		value, vt := v, lt
+		if lt.Kind() == reflect.Ptr {
+			value, vt = "*"+v, lt.Elem()
+		}
+		return g.block(t,
+			fmt.Sprintf("if %s := %s; !%s(%s) {\nreturn %s\n}", v, l, g.runtime("IsNil"), v, g.convert(value, vt, t)),
+			fmt.Sprintf("return %s", g.convert(r, rt, t)),
+		), t
+	}
+	return g.unsupported(n, "operator %v is not supported", op)
+}
@@ -0,0 +1,110 @@
+package codegen_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/codegen"
+	"github.com/expr-lang/expr/codegen/internal/example"
+)
+
+func TestGenerate(t *testing.T) {
+	src, err := codegen.Generate("github.com/expr-lang/expr/codegen/internal/example", example.Funcs, expr.Env(example.Env{}))
+	require.NoError(t, err)
+
+	generated, err := os.ReadFile("internal/example/funcs[generated].go")
+	require.NoError(t, err)
+	assert.Equal(t, string(generated), string(src), "run go generate ./codegen/internal/example")
+}
+
+func TestGenerate_same_as_vm(t *testing.T) {
+	funcs := map[string]func(env *example.Env) (any, error){
+		"Big":        func(env *example.Env) (any, error) { return example.Big(env) },
+		"Total":      func(env *example.Env) (any, error) { return example.Total(env) },
+		"ItemsTotal": func(env *example.Env) (any, error) { return example.ItemsTotal(env) },
+		"Cheap":      func(env *example.Env) (any, error) { return example.Cheap(env) },
+		"Names":      func(env *example.Env) (any, error) { return example.Names(env) },
+		"Count":      func(env *example.Env) (any, error) { return example.Count(env) },
+		"Discounted": func(env *example.Env) (any, error) { return example.Discounted(env) },
+		"Tagged":     func(env *example.Env) (any, error) { return example.Tagged(env) },
+		"Dynamic":    func(env *example.Env) (any, error) { return example.Dynamic(env) },
+		"Coupon":     func(env *example.Env) (any, error) { return example.Coupon(env) },
+		"Last":       func(env *example.Env) (any, error) { return example.Last(env) },
+		"Range":      func(env *example.Env) (any, error) { return example.Range(env) },
+		"Infinite":   func(env *example.Env) (any, error) { return example.Infinite(env) },
+		"Remainder":  func(env *example.Env) (any, error) { return example.Remainder(env) },
+		"NoCoupon":   func(env *example.Env) (any, error) { return example.NoCoupon(env) },
+		"Length":     func(env *example.Env) (any, error) { return example.Length(env) },
+	}
+	require.Len(t, funcs, len(example.Funcs))
+
+	coupon := "WELCOME"
+	envs := []example.Env{
+		{
+			Base:    example.Base{Currency: "EUR"},
+			Order:   example.Order{ID: 3, Amount: 250, Tags: []string{"vip", "new"}},
+			Items:   []example.Item{{Name: "pen", Price: 2, Qty: 12}, {Name: "book", Price: 4, Qty: 2}},
+			Limits:  map[string]int{"max": 5, "min": 1},
+			Extra:   map[string]any{"Level": 1, "Name": "gold"},
+			Coupon:  &coupon,
+			Country: "FR",
+		},
+		{
+			Base:    example.Base{Currency: "USD"},
+			Order:   example.Order{ID: 1, Amount: 50, Tags: []string{"new"}},
+			Items:   []example.Item{{Name: "mug", Price: 9, Qty: 1}, {Name: "cup", Price: 1, Qty: 0}},
+			Extra:   map[string]any{"Level": 2},
+			Country: "DE",
+		},
+		{
+			Base:  example.Base{Currency: "GBP"},
+			Order: example.Order{Tags: []string{"x"}},
+			Items: []example.Item{{Name: "a"}},
+		},
+	}
+
+	for _, fn := range example.Funcs {
+		program, err := expr.Compile(fn.Expression, expr.Env(example.Env{}))
+		require.NoError(t, err, fn.Name)
+		for i := range envs {
+			want, wantErr := expr.Run(program, envs[i])
+			got, err := funcs[fn.Name](&envs[i])
+			if wantErr != nil {
+				assert.Error(t, err, "%v with env %d", fn.Name, i)
+				continue
+			}
+			require.NoError(t, err, "%v with env %d", fn.Name, i)
+			assert.Equal(t, want, got, "%v with env %d", fn.Name, i)
+		}
+	}
+}
+
+func TestGenerate_unsupported(t *testing.T) {
+	double := expr.Function("double", func(params ...any) (any, error) {
+		return params[0].(int) * 2, nil
+	}, new(func(int) int))
+
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{`double(Order.ID)`, "func F: unknown name double, only fields and methods of the env are supported (1:1)"},
+		{`Order?.ID`, "func F: optional chaining is not supported (1:8)"},
+		{`reduce(Items, #acc + .Qty, 0)`, "func F: builtin reduce is not supported (1:1)"},
+	}
+	for _, tt := range tests {
+		_, err := codegen.Generate("example", []codegen.Func{{Name: "F", Expression: tt.input}}, expr.Env(example.Env{}), double)
+		var unsupported *codegen.UnsupportedError
+		require.True(t, errors.As(err, &unsupported), tt.input)
+		assert.Equal(t, "F", unsupported.Func)
+		assert.Contains(t, err.Error(), tt.err)
+	}
+
+	_, err := codegen.Generate("example", nil, expr.Env(map[string]any{}))
+	assert.EqualError(t, err, "codegen: the env must be a named struct, see expr.Env")
+}
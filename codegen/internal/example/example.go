@@ -0,0 +1,83 @@
+// Package example is an env with expressions translated to Go by codegen,
+// to test the generated code against the VM.
+package example
+
+//go:generate sh -c "go run ./gen > ./funcs[generated].go"
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/expr-lang/expr/codegen"
+)
+
+type Env struct {
+	Base
+	Order   Order
+	Items   []Item
+	Limits  map[string]int
+	Extra   any
+	Coupon  *string
+	Country string `expr:"country"`
+}
+
+type Base struct {
+	Currency string
+}
+
+type Order struct {
+	ID     int
+	Amount float64
+	Tags   []string
+}
+
+type Item struct {
+	Name  string
+	Price float64
+	Qty   int
+}
+
+func (Env) Discount(amount float64, codes ...string) float64 {
+	return amount * float64(len(codes)) / 10
+}
+
+func (env *Env) HasCoupon() bool {
+	return env.Coupon != nil
+}
+
+func (Env) Rate(currency string) (float64, error) {
+	switch currency {
+	case "EUR":
+		return 1, nil
+	case "USD":
+		return 0.9, nil
+	}
+	return 0, errors.New("unknown currency " + currency)
+}
+
+func (i Item) Total() float64 {
+	return i.Price * float64(i.Qty)
+}
+
+func (o Order) Label() string {
+	return strings.ToUpper(o.Tags[0])
+}
+
+var Funcs = []codegen.Func{
+	{Name: "Big", Expression: `Order.Amount > 100 && Currency == "EUR"`},
+	{Name: "Total", Expression: `Order.Amount * Rate(Currency)`},
+	{Name: "ItemsTotal", Expression: `let total = Items[0].Total() + Items[1].Total(); total > 10 ? total : 0`},
+	{Name: "Cheap", Expression: `all(Items, .Price < 5) or any(Items, #.Qty > 10 && # != nil)`},
+	{Name: "Names", Expression: `map(filter(Items, .Qty > 0), upper(.Name))`},
+	{Name: "Count", Expression: `count(Items, .Qty % 2 == 0) + len(Limits) - Limits["max"]`},
+	{Name: "Discounted", Expression: `Discount(Order.Amount, "a", "b") / 2`},
+	{Name: "Tagged", Expression: `"vip" in Order.Tags && Order.Label() startsWith "V" || country matches "^F"`},
+	{Name: "Dynamic", Expression: `Extra.Level + 1 == 2 ? Extra.Name ?? "none" : string(Extra)`},
+	{Name: "Coupon", Expression: `HasCoupon() ? Coupon ?? "" : trim("  none ")`},
+	{Name: "Last", Expression: `Items[-1].Name + ":" + string(Order.ID ** 2)`},
+	{Name: "Range", Expression: `let n = Order.ID; 1..n`},
+	{Name: "Infinite", Expression: `(Order.ID + 1) / 0 > Order.Amount / (1 - 1)`},
+	{Name: "Remainder", Expression: `Order.ID % (2 - 2)`},
+	{Name: "NoCoupon", Expression: `Coupon == nil || Coupon != "WELCOME"`},
+	{Name: "Length", Expression: `len(Currency + "é") + len("héllo")`},
+}
@@ -0,0 +1,292 @@
+// Code generated by codegen. DO NOT EDIT.
+
+package example
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/expr-lang/expr/builtin"
+	"github.com/expr-lang/expr/vm/runtime"
+)
+
+var regexp0 = regexp.MustCompile("^F")
+
+// Big evaluates:
+//
+//	Order.Amount > 100 && Currency == "EUR"
+func Big(env *Env) (out bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return ((env.Order.Amount > float64(100)) && (env.Base.Currency == "EUR")), nil
+}
+
+// Total evaluates:
+//
+//	Order.Amount * Rate(Currency)
+func Total(env *Env) (out float64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return (env.Order.Amount * func() float64 {
+		out, err := env.Rate(env.Base.Currency)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	}()), nil
+}
+
+// ItemsTotal evaluates:
+//
+//	let total = Items[0].Total() + Items[1].Total(); total > 10 ? total : 0
+func ItemsTotal(env *Env) (out any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return func() any {
+		total := (env.Items[0].Total() + env.Items[1].Total())
+		_ = total
+		return func() any {
+			if total > float64(10) {
+				return total
+			}
+			return 0
+		}()
+	}(), nil
+}
+
+// Cheap evaluates:
+//
+//	all(Items, .Price < 5) or any(Items, #.Qty > 10 && # != nil)
+func Cheap(env *Env) (out bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return (func() bool {
+		for _, v2 := range env.Items {
+			if !(v2.Price < float64(5)) {
+				return false
+			}
+		}
+		return true
+	}() || func() bool {
+		for _, v4 := range env.Items {
+			if (v4.Qty > 10) && !runtime.Equal(v4, nil) {
+				return true
+			}
+		}
+		return false
+	}()), nil
+}
+
+// Names evaluates:
+//
+//	map(filter(Items, .Qty > 0), upper(.Name))
+func Names(env *Env) (out []any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return func() []any {
+		out := []any{}
+		for _, v4 := range func() []any {
+			out := []any{}
+			for _, v2 := range env.Items {
+				if v2.Qty > 0 {
+					out = append(out, v2)
+				}
+			}
+			return out
+		}() {
+			out = append(out, strings.ToUpper(runtime.Fetch(v4, "Name").(string)))
+		}
+		return out
+	}(), nil
+}
+
+// Count evaluates:
+//
+//	count(Items, .Qty % 2 == 0) + len(Limits) - Limits["max"]
+func Count(env *Env) (out int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return ((func() int {
+		count := 0
+		for _, v2 := range env.Items {
+			if (v2.Qty % 2) == 0 {
+				count++
+			}
+		}
+		return count
+	}() + len(env.Limits)) - env.Limits["max"]), nil
+}
+
+// Discounted evaluates:
+//
+//	Discount(Order.Amount, "a", "b") / 2
+func Discounted(env *Env) (out float64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return (env.Discount(env.Order.Amount, "a", "b") / float64(2)), nil
+}
+
+// Tagged evaluates:
+//
+//	"vip" in Order.Tags && Order.Label() startsWith "V" || country matches "^F"
+func Tagged(env *Env) (out bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return ((runtime.In("vip", env.Order.Tags) && strings.HasPrefix(env.Order.Label(), "V")) || regexp0.MatchString(env.Country)), nil
+}
+
+// Dynamic evaluates:
+//
+//	Extra.Level + 1 == 2 ? Extra.Name ?? "none" : string(Extra)
+func Dynamic(env *Env) (out any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return func() any {
+		if runtime.Equal(runtime.Add(runtime.Fetch(env.Extra, "Level"), 1), 2) {
+			return func() any {
+				if v1 := runtime.Fetch(env.Extra, "Name"); !runtime.IsNil(v1) {
+					return v1
+				}
+				return "none"
+			}()
+		}
+		return builtin.String(env.Extra).(string)
+	}(), nil
+}
+
+// Coupon evaluates:
+//
+//	HasCoupon() ? Coupon ?? "" : trim("  none ")
+func Coupon(env *Env) (out string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return func() string {
+		if env.HasCoupon() {
+			return func() string {
+				if v1 := env.Coupon; !runtime.IsNil(v1) {
+					return *v1
+				}
+				return ""
+			}()
+		}
+		return strings.TrimSpace("  none ")
+	}(), nil
+}
+
+// Last evaluates:
+//
+//	Items[-1].Name + ":" + string(Order.ID ** 2)
+func Last(env *Env) (out string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return ((runtime.Fetch(env.Items, -1).(Item).Name + ":") + builtin.String(runtime.Exponent(env.Order.ID, 2)).(string)), nil
+}
+
+// Range evaluates:
+//
+//	let n = Order.ID; 1..n
+func Range(env *Env) (out []int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return func() []int {
+		n := env.Order.ID
+		_ = n
+		return runtime.MakeRange(1, n)
+	}(), nil
+}
+
+// Infinite evaluates:
+//
+//	(Order.ID + 1) / 0 > Order.Amount / (1 - 1)
+func Infinite(env *Env) (out bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return (runtime.Divide((env.Order.ID+1), 0).(float64) > runtime.Divide(env.Order.Amount, (1-1)).(float64)), nil
+}
+
+// Remainder evaluates:
+//
+//	Order.ID % (2 - 2)
+func Remainder(env *Env) (out int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return runtime.Modulo(env.Order.ID, (2 - 2)), nil
+}
+
+// NoCoupon evaluates:
+//
+//	Coupon == nil || Coupon != "WELCOME"
+func NoCoupon(env *Env) (out bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return (runtime.Equal(func() any {
+		if p1 := env.Coupon; p1 != nil {
+			return *p1
+		}
+		return nil
+	}(), nil) || !runtime.Equal(func() any {
+		if p2 := env.Coupon; p2 != nil {
+			return *p2
+		}
+		return nil
+	}(), "WELCOME")), nil
+}
+
+// Length evaluates:
+//
+//	len(Currency + "é") + len("héllo")
+func Length(env *Env) (out int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return (utf8.RuneCountInString((env.Base.Currency + "é")) + utf8.RuneCountInString("héllo")), nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/codegen"
+	"github.com/expr-lang/expr/codegen/internal/example"
+)
+
+func main() {
+	src, err := codegen.Generate("github.com/expr-lang/expr/codegen/internal/example", example.Funcs, expr.Env(example.Env{}))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(src)
+}
@@ -0,0 +1,51 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/parser/operator"
+)
+
+// planComparisons gives the middle operands of chained comparisons, like b
+// in a < b < c, a hidden variable. The parser rewrites the chain to
+// a < b && b < c, with the node of b shared by both comparisons: the first
+// one evaluates it and stores it, and the second one loads it, so every
+// operand is evaluated once, in order.
+func (c *compiler) planComparisons(root ast.Node) {
+	ast.Find(root, func(node ast.Node) bool {
+		and, ok := node.(*ast.BinaryNode)
+		if !ok || and.Operator != "&&" {
+			return false
+		}
+		next, ok := and.Right.(*ast.BinaryNode)
+		if !ok || !operator.IsComparison(next.Operator) {
+			return false
+		}
+		left := and.Left
+		for {
+			b, ok := left.(*ast.BinaryNode)
+			if !ok || b.Operator != "&&" {
+				break
+			}
+			left = b.Right
+		}
+		prev, ok := left.(*ast.BinaryNode)
+		if !ok || !operator.IsComparison(prev.Operator) || prev.Right != next.Left {
+			return false
+		}
+		switch next.Left.(type) {
+		case *ast.IntegerNode, *ast.FloatNode, *ast.StringNode, *ast.NilNode:
+			return false
+		}
+		if _, ok := c.temps[next.Left]; ok {
+			return false
+		}
+		if c.temps == nil {
+			c.temps = map[ast.Node]int{}
+			c.stored = map[ast.Node]bool{}
+		}
+		c.temps[next.Left] = c.addVariable(fmt.Sprintf("$cmp%d", len(c.temps)))
+		return false
+	})
+}
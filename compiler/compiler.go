@@ -1,8 +1,9 @@
 package compiler
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"io"
 	"math"
 	"reflect"
 	"regexp"
@@ -23,14 +24,29 @@ const (
 	placeholder = 12345
 )
 
+// contextBatch is the number of nodes compiled between checks of the context.
+const contextBatch = 256
+
 func Compile(tree *parser.Tree, config *conf.Config) (program *Program, err error) {
+	return CompileContext(context.Background(), tree, config)
+}
+
+// CompileContext compiles the tree like Compile, aborting once ctx is
+// canceled or its deadline is exceeded. The context is checked between
+// batches of compiled nodes, and the error of ctx is returned as is.
+func CompileContext(ctx context.Context, tree *parser.Tree, config *conf.Config) (program *Program, err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			err = fmt.Errorf("%v", r)
+			if e, ok := r.(error); ok {
+				err = fmt.Errorf("%w", e)
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
 		}
 	}()
 
 	c := &compiler{
+		ctx:            ctx,
 		config:         config,
 		locations:      make([]file.Location, 0),
 		constantsIndex: make(map[any]int),
@@ -38,8 +54,14 @@ func Compile(tree *parser.Tree, config *conf.Config) (program *Program, err erro
 		debugInfo:      make(map[string]string),
 	}
 
+	c.planComparisons(tree.Node)
+	if c.config != nil && c.config.Optimize {
+		c.planCSE(tree.Node)
+	}
 	c.compile(tree.Node)
-	c.dump()
+	if c.config != nil && c.config.DumpBytecode != nil {
+		c.dump(c.config.DumpBytecode)
+	}
 
 	if c.config != nil {
 		switch c.config.Expect {
@@ -52,6 +74,7 @@ func Compile(tree *parser.Tree, config *conf.Config) (program *Program, err erro
 		}
 		if c.config.Optimize {
 			c.optimize()
+			c.eliminateDeadStores()
 		}
 	}
 
@@ -72,10 +95,15 @@ func Compile(tree *parser.Tree, config *conf.Config) (program *Program, err erro
 		c.debugInfo,
 		span,
 	)
+	if c.config != nil {
+		program.Configure(c.config)
+	}
 	return
 }
 
 type compiler struct {
+	ctx            context.Context
+	compiled       int // number of compiled nodes, to check ctx between batches of them
 	config         *conf.Config
 	locations      []file.Location
 	bytecode       []Opcode
@@ -90,6 +118,9 @@ type compiler struct {
 	spans          []*Span
 	chains         [][]int
 	arguments      []int
+	cse            cse
+	temps          map[ast.Node]int  // variables of operands shared by chained comparisons
+	stored         map[ast.Node]bool // temps already evaluated
 
 	compileDepth int
 }
@@ -174,9 +205,17 @@ func (c *compiler) emitPush(value any) int {
 //
 // 对于可比较的对象，如果常量已存在，直接返回，避免重复插入；
 // 对不可比较的对象，不判重，直接插入到常量池中；
+// regexpKey is the key of regexp constants, which can not be mixed up with
+// string constants.
+type regexpKey string
+
 func (c *compiler) addConstant(constant any) int {
 	c.logf("[CONST] addConstant: constant=%T %v", constant, constant)
 
+	if c.config != nil && c.config.Interner != nil {
+		constant = c.config.Interner.Intern(constant)
+	}
+
 	indexable := true
 	hash := constant
 	switch reflect.TypeOf(constant).Kind() {
@@ -201,6 +240,10 @@ func (c *compiler) addConstant(constant any) int {
 		hash = fmt.Sprintf("%v", method)
 		c.logf("[CONST] Special case *runtime.Method, key=%v", hash)
 	}
+	if re, ok := constant.(*regexp.Regexp); ok {
+		// Regexps of the same pattern share one constant.
+		hash = regexpKey(re.String())
+	}
 
 	if indexable {
 		if p, ok := c.constantsIndex[hash]; ok {
@@ -271,13 +314,26 @@ func (c *compiler) calcBackwardJump(to int) int {
 }
 
 func (c *compiler) logf(format string, args ...interface{}) {
-	indent := strings.Repeat(" ", (c.compileDepth-1)*4)
-	log.Printf(indent+format, args...)
+	if c.config == nil || c.config.Logger == nil || !c.config.Logger.Enabled(conf.LogCompiler, conf.LevelDebug) {
+		return
+	}
+	var indent string
+	if c.compileDepth > 1 {
+		indent = strings.Repeat(" ", (c.compileDepth-1)*4)
+	}
+	c.config.Logger.Logf(conf.LogCompiler, conf.LevelDebug, indent+format, args...)
 }
 
 func (c *compiler) compile(node ast.Node) {
+	c.compiled++
+	if c.compiled%contextBatch == 0 {
+		if err := c.ctx.Err(); err != nil {
+			panic(err)
+		}
+	}
+
 	c.compileDepth++
-	c.logf("[COMPILE] ➜ start node=%T: %s", node, node.String())
+	c.logf("[COMPILE] ➜ start node=%T: %v", node, node)
 	defer func() {
 		c.logf("[COMPILE] ⇠ done  node=%T", node)
 		c.compileDepth--
@@ -310,6 +366,28 @@ func (c *compiler) compile(node ast.Node) {
 		}()
 	}
 
+	if index, ok := c.temps[node]; ok {
+		if c.stored[node] {
+			c.emitLocation(node.Location(), OpLoadVar, index)
+			return
+		}
+		c.stored[node] = true
+		defer func() {
+			c.emit(OpStore, index)
+			c.emit(OpLoadVar, index)
+		}()
+	}
+	if index, ok := c.cse.loads[node]; ok {
+		c.emitLocation(node.Location(), OpLoadVar, index)
+		return
+	}
+	if index, ok := c.cse.stores[node]; ok {
+		defer func() {
+			c.emit(OpStore, index)
+			c.emit(OpLoadVar, index)
+		}()
+	}
+
 	switch n := node.(type) {
 	case *ast.NilNode:
 		c.NilNode(n)
@@ -341,20 +419,28 @@ func (c *compiler) compile(node ast.Node) {
 		c.BuiltinNode(n)
 	case *ast.PredicateNode:
 		c.PredicateNode(n)
+	case *ast.FunctionNode:
+		c.FunctionNode(n)
 	case *ast.PointerNode:
 		c.PointerNode(n)
+	case *ast.PlaceholderNode:
+		panic(fmt.Sprintf("placeholder :%v is not bound", n.Name))
 	case *ast.VariableDeclaratorNode:
 		c.VariableDeclaratorNode(n)
 	case *ast.SequenceNode:
 		c.SequenceNode(n)
 	case *ast.ConditionalNode:
 		c.ConditionalNode(n)
+	case *ast.SwitchNode:
+		c.SwitchNode(n)
 	case *ast.ArrayNode:
 		c.ArrayNode(n)
 	case *ast.MapNode:
 		c.MapNode(n)
 	case *ast.PairNode:
 		c.PairNode(n)
+	case *ast.OpcodeNode:
+		c.OpcodeNode(n)
 	default:
 		panic(fmt.Sprintf("undefined node type (%T)", node))
 	}
@@ -377,7 +463,8 @@ func (c *compiler) NilNode(_ *ast.NilNode) {
 //     4.1 如果 env 是 map[string]interface{} 类型(FastMap)，先将标识符(node.Value)作为常量添加到常量池中，然后生成 OpLoadFast 操作码，并传入常量索引。
 //     4.2 如果 env 是 struct ，尝试在 env 中查找字段，若找到会返回字段名、字段的 indexes ，然后生成 OpLoadField 操作码。
 //     4.3 如果 env 是 struct ，尝试在 env 中查找方法，若找到会返回方法名、方法的 index ，然后生成 OpLoadMethod 操作码。
-//     4.4 如果 env 是其它类型，把这个标识符当成常量名处理，先添加到常量池，然后生成 OpLoadConst 操作码，并传入常量索引。
+//     4.4 如果 env 是 runtime.FieldResolver，生成 OpLoadDynamic 操作码，运行时通过 Resolve 按名解析。
+//     4.5 如果 env 是其它类型，把这个标识符当成常量名处理，先添加到常量池，然后生成 OpLoadConst 操作码，并传入常量索引。
 //
 // 表格：
 //
@@ -386,10 +473,11 @@ func (c *compiler) NilNode(_ *ast.NilNode) {
 //	| ----- | -------------------------- | -------------- | ----------------   |
 //	|   1   | 本地作用域有此变量            | `OpLoadVar`    | 从局部变量栈加载      |
 //	|   2   | 是 `$env` 特殊标识符         | `OpLoadEnv`    | 加载整个运行环境对象   |
-//	|   3   | `env` 是 map               | `OpLoadFast`   | 直接通过 key 加载     |
-//	|   4   | `env` 是 struct 且匹配字段   | `OpLoadField`  | 反射加载字段          |
-//	|   5   | `env` 是 struct 且匹配方法   | `OpLoadMethod` | 反射加载方法         |
-//	|   6   | 全都不匹配，回退为字符串常量    | `OpLoadConst`  | 当成普通字符串常量处理 |
+//	|   3   | `env` 是 FieldResolver     | `OpLoadDynamic` | 通过 Resolve 按名解析 |
+//	|   4   | `env` 是 map               | `OpLoadFast`   | 直接通过 key 加载     |
+//	|   5   | `env` 是 struct 且匹配字段   | `OpLoadField`  | 反射加载字段          |
+//	|   6   | `env` 是 struct 且匹配方法   | `OpLoadMethod` | 反射加载方法         |
+//	|   7   | 全都不匹配，回退为字符串常量    | `OpLoadConst`  | 当成普通字符串常量处理 |
 //	| ----- | -------------------------- | -------------- | ----------------   |
 func (c *compiler) IdentifierNode(node *ast.IdentifierNode) {
 	if index, ok := c.lookupVariable(node.Value); ok {
@@ -400,6 +488,12 @@ func (c *compiler) IdentifierNode(node *ast.IdentifierNode) {
 		c.emit(OpLoadEnv)
 		return
 	}
+	if c.config != nil {
+		if _, ok := c.config.EnvObject.(runtime.FieldResolver); ok {
+			c.emit(OpLoadDynamic, c.addConstant(node.Value))
+			return
+		}
+	}
 
 	var env Nature
 	if c.config != nil {
@@ -408,15 +502,16 @@ func (c *compiler) IdentifierNode(node *ast.IdentifierNode) {
 
 	if env.IsFastMap() {
 		c.emit(OpLoadFast, c.addConstant(node.Value))
-	} else if ok, index, name := checker.FieldIndex(env, node); ok {
+	} else if ok, index, name := checker.FieldIndex(env, node, c.fieldTags()...); ok {
 		c.emit(OpLoadField, c.addConstant(&runtime.Field{
 			Index: index,
 			Path:  []string{name},
 		}))
-	} else if ok, index, name := checker.MethodIndex(env, node); ok {
+	} else if m, name, ok := checker.Method(env, node); ok && m.Method {
 		c.emit(OpLoadMethod, c.addConstant(&runtime.Method{
-			Name:  name,
-			Index: index,
+			Name:    name,
+			Index:   m.MethodIndex,
+			Pointer: m.PointerReceiver,
 		}))
 	} else {
 		c.emit(OpLoadConst, c.addConstant(node.Value))
@@ -562,7 +657,7 @@ func (c *compiler) UnaryNode(node *ast.UnaryNode) {
 	case "+":
 		// Do nothing
 	case "-":
-		c.emit(OpNegate)
+		c.emitArithmetic(OpNegate)
 	default:
 		panic(fmt.Sprintf("unknown operator (%v)", node.Operator))
 	}
@@ -599,6 +694,7 @@ func (c *compiler) BinaryNode(node *ast.BinaryNode) {
 		// 编译左子式
 		c.compile(node.Left)
 		c.derefInNeeded(node.Left)
+		c.emitCover(OpCover, node.Operator, node.Left)
 		// OpJumpIfTrue：条件跳转指令
 		//	检查栈顶值：
 		//	 - 如果为 true，跳转到 end（短路求值，直接返回 true）。
@@ -615,6 +711,7 @@ func (c *compiler) BinaryNode(node *ast.BinaryNode) {
 	case "and", "&&":
 		c.compile(node.Left)
 		c.derefInNeeded(node.Left)
+		c.emitCover(OpCover, node.Operator, node.Left)
 		end := c.emit(OpJumpIfFalse, placeholder)
 		c.emit(OpPop)
 		c.compile(node.Right)
@@ -654,21 +751,21 @@ func (c *compiler) BinaryNode(node *ast.BinaryNode) {
 		c.derefInNeeded(node.Left)
 		c.compile(node.Right)
 		c.derefInNeeded(node.Right)
-		c.emit(OpAdd)
+		c.emitArithmetic(OpAdd)
 
 	case "-":
 		c.compile(node.Left)
 		c.derefInNeeded(node.Left)
 		c.compile(node.Right)
 		c.derefInNeeded(node.Right)
-		c.emit(OpSubtract)
+		c.emitArithmetic(OpSubtract)
 
 	case "*":
 		c.compile(node.Left)
 		c.derefInNeeded(node.Left)
 		c.compile(node.Right)
 		c.derefInNeeded(node.Right)
-		c.emit(OpMultiply)
+		c.emitArithmetic(OpMultiply)
 
 	case "/":
 		c.compile(node.Left)
@@ -694,15 +791,38 @@ func (c *compiler) BinaryNode(node *ast.BinaryNode) {
 	case "in":
 		c.compile(node.Left)
 		c.derefInNeeded(node.Left)
+		// The right side is not dereferenced: runtime.In follows pointers
+		// itself, and asks envs which are FieldResolvers for the name.
 		c.compile(node.Right)
-		c.derefInNeeded(node.Right)
-		c.emit(OpIn)
+		if c.strictNil(node.Left) {
+			c.emit(OpInStrict)
+		} else {
+			c.emit(OpIn)
+		}
 
 	case "matches":
 		// matches 用于判断左侧字符串是否匹配右侧的正则表达式。
 		//	- 当右侧是字符串常量时（如 s matches "^[a-z]+$"），在编译时编译正则表达式存入常量池，通过索引引用，避免重复开销。
 		//	- 当右侧是变量或表达式时（如 s matches RegexVar），在运行时计算右侧表达式得到正则字符串，将其动态编译为正则对象后，再执行匹配。
-		if str, ok := node.Right.(*ast.StringNode); ok {
+		if str, ok := node.Right.(*ast.StringNode); ok && c.config != nil && c.config.Regexps != nil {
+			// Literal patterns are checked against the limits once, and
+			// matched within the step budget.
+			re, err := c.config.Regexps.Compile(str.Value)
+			if err != nil {
+				panic(err)
+			}
+			c.compile(node.Left)
+			c.derefInNeeded(node.Left)
+			c.emit(OpMatchesConst, c.addConstant(re))
+		} else if c.config != nil && c.config.Regexps != nil {
+			// Guarded patterns are checked against the limits, and matched
+			// within the step budget, by the runtime.Regexps of the config.
+			c.compile(node.Left)
+			c.derefInNeeded(node.Left)
+			c.compile(node.Right)
+			c.derefInNeeded(node.Right)
+			c.emit(OpMatchesGuarded, c.addConstant(c.config.Regexps))
+		} else if str, ok := node.Right.(*ast.StringNode); ok {
 			re, err := regexp.Compile(str.Value)
 			if err != nil {
 				panic(err)
@@ -751,19 +871,54 @@ func (c *compiler) BinaryNode(node *ast.BinaryNode) {
 		//  - port := config.port ?? 8080
 		//  - name := user.nickname ?? user.username
 		//  - value := cachedValue ?? computeValue()
-		c.compile(node.Left)
-		c.derefInNeeded(node.Left)
-		end := c.emit(OpJumpIfNotNil, placeholder)
-		c.emit(OpPop)
-		c.compile(node.Right)
-		c.derefInNeeded(node.Right)
-		c.patchJump(end)
+		//
+		// 链式的 a ?? b ?? c 会被展平：每个操作数非 nil 时都直接跳到链的末尾，
+		// 遇到字面量这类静态可知非 nil 的操作数时，其后的操作数不会再被求值，直接丢弃。
+		operands := flattenCoalesce(node, nil)
+		var ends []int
+		for i, operand := range operands {
+			c.compile(operand)
+			c.derefInNeeded(operand)
+			if i == len(operands)-1 || isNeverNil(operand) {
+				break
+			}
+			c.emitCover(OpCoverNil, node.Operator, operand)
+			if c.strictNil(operand) {
+				ends = append(ends, c.emit(OpJumpIfNotNilStrict, placeholder))
+			} else {
+				ends = append(ends, c.emit(OpJumpIfNotNil, placeholder))
+			}
+			c.emit(OpPop)
+		}
+		for _, end := range ends {
+			c.patchJump(end)
+		}
 
 	default:
 		panic(fmt.Sprintf("unknown operator (%v)", node.Operator))
 	}
 }
 
+// flattenCoalesce collects operands of a ?? b ?? c from left to right.
+func flattenCoalesce(node ast.Node, operands []ast.Node) []ast.Node {
+	if binary, ok := node.(*ast.BinaryNode); ok && binary.Operator == "??" {
+		operands = flattenCoalesce(binary.Left, operands)
+		return flattenCoalesce(binary.Right, operands)
+	}
+	return append(operands, node)
+}
+
+// isNeverNil reports whether node is a literal which can never be nil.
+func isNeverNil(node ast.Node) bool {
+	switch n := node.(type) {
+	case *ast.IntegerNode, *ast.FloatNode, *ast.BoolNode, *ast.StringNode, *ast.ArrayNode, *ast.MapNode:
+		return true
+	case *ast.ConstantNode:
+		return !runtime.IsNil(n.Value)
+	}
+	return false
+}
+
 // 策略：语义保持一致前提下做特化指令选择，以提升性能。
 func (c *compiler) equalBinaryNode(node *ast.BinaryNode) {
 	// 编译左/右操作数
@@ -786,11 +941,66 @@ func (c *compiler) equalBinaryNode(node *ast.BinaryNode) {
 		c.emit(OpEqualInt)
 	} else if l == r && l == reflect.String && leftAndRightAreSimple {
 		c.emit(OpEqualString)
+	} else if c.config != nil && c.config.StrictNil && !typedNilComparison(node) {
+		c.emit(OpEqualStrict)
+	} else if c.config != nil && c.config.FloatEpsilon > 0 && maybeFloat(l) && maybeFloat(r) {
+		c.emit(OpEqualFloat, c.addConstant(c.config.FloatEpsilon))
 	} else {
 		c.emit(OpEqual)
 	}
 }
 
+// typedNilComparison reports whether one operand is the nil literal and the
+// other one of a pointer, slice, map, func or chan type, which equals nil if
+// it is nil, like in Go, even with conf.Config.StrictNil.
+func typedNilComparison(node *ast.BinaryNode) bool {
+	other := node.Right
+	if _, ok := node.Left.(*ast.NilNode); !ok {
+		if _, ok := node.Right.(*ast.NilNode); !ok {
+			return false
+		}
+		other = node.Left
+	}
+	return nilable(other)
+}
+
+// nilable reports whether the node is of a pointer, slice, map, func or chan
+// type, which is nil if its value is nil.
+func nilable(node ast.Node) bool {
+	switch kind(node.Type()) {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Func, reflect.Chan:
+		return true
+	}
+	return false
+}
+
+// strictNil reports whether a value of the node is nil only if it is the
+// nil interface, with conf.Config.StrictNil, for ?? and in. Like for ==,
+// values of nilable types are nil if they are nil, and so are optional
+// chains which stopped at a nil.
+func (c *compiler) strictNil(node ast.Node) bool {
+	if c.config == nil || !c.config.StrictNil || nilable(node) {
+		return false
+	}
+	_, chain := node.(*ast.ChainNode)
+	return !chain
+}
+
+// isComparator reports whether the second argument of sort is a function
+// comparing elements, like (a, b) => a.Age - b.Age, and not an order.
+func isComparator(nt Nature) bool {
+	return nt.Closure > 0 || kind(nt.Type) == reflect.Func
+}
+
+// maybeFloat reports whether a value of the kind can be a float at run time.
+func maybeFloat(k reflect.Kind) bool {
+	switch k {
+	case reflect.Float32, reflect.Float64, reflect.Interface, reflect.Invalid:
+		return true
+	}
+	return false
+}
+
 func isSimpleType(node ast.Node) bool {
 	if node == nil {
 		return false
@@ -918,11 +1128,12 @@ func (c *compiler) MemberNode(node *ast.MemberNode) {
 	// 检查 node 是否 env 的成员方法
 	//
 	// 如果这个节点表示的是方法调用（非立即调用，而是“获取方法”），就发射 OpMethod 字节码，并返回。
-	if ok, index, name := checker.MethodIndex(env, node); ok {
+	if m, name, ok := checker.Method(env, node); ok {
 		c.compile(node.Node)
 		c.emit(OpMethod, c.addConstant(&runtime.Method{
-			Name:  name,
-			Index: index,
+			Name:    name,
+			Index:   m.MethodIndex,
+			Pointer: m.PointerReceiver,
 		}))
 		return
 	}
@@ -931,10 +1142,11 @@ func (c *compiler) MemberNode(node *ast.MemberNode) {
 	// 如果能静态确定字段路径，就优化为 OpFetchField 。
 	op := OpFetch
 	base := node.Node
+	safe := c.config != nil && c.config.NilOnMissing
 
 	// 检查 node 是否是 env 的字段
 	// 尝试解析完整的字段路径（字段折叠）
-	ok, index, nodeName := checker.FieldIndex(env, node)
+	ok, index, nodeName := checker.FieldIndex(env, node, c.fieldTags()...)
 	path := []string{nodeName}
 
 	if ok {
@@ -950,8 +1162,8 @@ func (c *compiler) MemberNode(node *ast.MemberNode) {
 			// user.profile.email 会被优化为一个完整字段路径 [0,1,2]，直接生成一个 OpLoadField 指令，而不是多条逐级访问的 Fetch。
 
 			// 处理标识符（如 `field` 在 `obj.sub.field`）
-			if ident, isIdent := base.(*ast.IdentifierNode); isIdent {
-				if ok, identIndex, name := checker.FieldIndex(env, ident); ok {
+			if ident, isIdent := base.(*ast.IdentifierNode); isIdent && !safe {
+				if ok, identIndex, name := checker.FieldIndex(env, ident, c.fieldTags()...); ok {
 					index = append(identIndex, index...)   // 合并嵌套索引
 					path = append([]string{name}, path...) // 合并嵌套路径
 					c.emitLocation(ident.Location(), OpLoadField, c.addConstant(
@@ -963,7 +1175,7 @@ func (c *compiler) MemberNode(node *ast.MemberNode) {
 
 			// 处理嵌套 MemberNode（如 `obj` 和 `sub` 在 `obj.sub.field`）
 			if member, isMember := base.(*ast.MemberNode); isMember {
-				if ok, memberIndex, name := checker.FieldIndex(env, member); ok {
+				if ok, memberIndex, name := checker.FieldIndex(env, member, c.fieldTags()...); ok {
 					index = append(memberIndex, index...)
 					path = append([]string{name}, path...)
 					node = member
@@ -998,17 +1210,81 @@ func (c *compiler) MemberNode(node *ast.MemberNode) {
 		// 编译 Property 可能是一个变量（如 key）
 		// 发射 OpFetch 指令，在运行时反射查找字段
 		c.compile(node.Property)
-		c.emit(OpFetch)
+		// Only indexes can be out of range, names use a regular fetch.
+		_, name := node.Property.(*ast.StringNode)
+		if names := c.fieldNames(); name && names != nil {
+			// Fields of values not known at compile time are looked up
+			// by their tags, or case-insensitively, too.
+			if safe {
+				c.emit(OpFetchNamedSafe, c.addConstant(names))
+			} else {
+				c.emit(OpFetchNamed, c.addConstant(names))
+			}
+		} else if safe || !name && isOptionalChain(node) {
+			c.emit(OpFetchSafe)
+		} else if !name && c.config != nil && c.config.NilOnOutOfRange {
+			c.emit(OpFetchIndexSafe)
+		} else {
+			ip := c.emit(OpFetch)
+			if !name {
+				// Runtime errors of indexing quote the expression, as
+				// a[b][c] has several fetches at nearby locations.
+				c.debugInfo[fmt.Sprintf("expr_%d", ip-1)] = node.String()
+			}
+		}
 	} else {
 		// 静态字段访问
 		// 使用静态确定的字段路径生成 OpFetchField，提高执行效率
 		// runtime.Field 包含字段索引路径和路径名（用于调试）
+		if safe {
+			op = OpFetchFieldSafe
+		}
 		c.emitLocation(node.Location(), op, c.addConstant(
 			&runtime.Field{Index: index, Path: path},
 		))
 	}
 }
 
+// fieldTags are the tags naming fields of structs, see
+// conf.Config.FieldTags.
+func (c *compiler) fieldTags() []string {
+	if c.config == nil {
+		return nil
+	}
+	return c.config.FieldTags
+}
+
+// fieldNames are how fields of values not known at compile time are
+// named, or nil if by their Go names or expr tags only.
+func (c *compiler) fieldNames() *runtime.FieldNames {
+	if c.config == nil || len(c.config.FieldTags) == 0 && !c.config.CaseInsensitiveFields {
+		return nil
+	}
+	return &runtime.FieldNames{
+		Tags:            c.config.FieldTags,
+		CaseInsensitive: c.config.CaseInsensitiveFields,
+	}
+}
+
+// isOptionalChain reports whether the member access is optional, like
+// a?.[0], or follows an optional one in the same chain, like a?.b[0].
+func isOptionalChain(node *ast.MemberNode) bool {
+	for {
+		if node.Optional {
+			return true
+		}
+		base := node.Node
+		if chain, ok := base.(*ast.ChainNode); ok {
+			base = chain.Node
+		}
+		member, ok := base.(*ast.MemberNode)
+		if !ok {
+			return false
+		}
+		node = member
+	}
+}
+
 // SliceNode
 //
 // 数组语法：
@@ -1133,6 +1409,7 @@ func (c *compiler) SliceNode(node *ast.SliceNode) {
 
 func (c *compiler) CallNode(node *ast.CallNode) {
 	fn := node.Callee.Type()
+	withContext := false
 	if fn.Kind() == reflect.Func {
 		// 处理反射函数
 
@@ -1158,6 +1435,13 @@ func (c *compiler) CallNode(node *ast.CallNode) {
 			}
 		}
 
+		// The context.Context is passed by OpCallCtx, not by the expression.
+		if c.config != nil && c.config.InjectContext && checker.ContextParam(fn, fnInOffset == 1) {
+			withContext = true
+			fnInOffset++
+			fnNumIn--
+		}
+
 		// 编译每个参数并处理类型转换
 		for i, arg := range node.Arguments {
 			// 编译参数表达式，将结果压栈。
@@ -1180,19 +1464,22 @@ func (c *compiler) CallNode(node *ast.CallNode) {
 		}
 	}
 
+	if withContext {
+		c.compile(node.Callee)
+		c.emit(OpCallCtx, len(node.Arguments))
+		return
+	}
+
 	// 若调用的是用户自定义函数，直接 emitFunction 。
 	if ident, ok := node.Callee.(*ast.IdentifierNode); ok {
 		if c.config != nil {
-			if fn, ok := c.config.Functions[ident.Value]; ok {
+			if fn, ok := c.config.Function(ident.Value); ok {
 				c.emitFunction(fn, len(node.Arguments))
 				return
 			}
 		}
 	}
 
-	// 编译被调函数表达式，压入栈顶。
-	c.compile(node.Callee)
-
 	// 根据函数类型生成不同的调用指令
 	//	- OpCallTyped：匹配精确类型的预注册函数（严格参数/返回值匹配，性能最高）。
 	//	- OpCallFast：匹配宽松但高效的通用函数（可变参数 + interface{}，次优性能）。
@@ -1200,17 +1487,32 @@ func (c *compiler) CallNode(node *ast.CallNode) {
 	if c.config != nil {
 		isMethod, _, _ := checker.MethodIndex(c.config.Env, node.Callee)
 		if index1, ok1 := checker.TypedCustomFuncIndex(node.Callee.Type(), isMethod); ok1 {
+			c.compile(node.Callee)
 			c.emit(OpCallTypedCustom, index1)
 			return
 		} else if index, ok := checker.TypedFuncIndex(node.Callee.Type(), isMethod); ok {
+			if fn.IsVariadic() {
+				// Typed calls get the variadic arguments as an array.
+				fixed := fn.NumIn() - 1
+				if isMethod {
+					fixed--
+				}
+				c.emitPush(len(node.Arguments) - fixed)
+				c.emit(OpArray)
+			}
+			c.compile(node.Callee)
 			c.emit(OpCallTyped, index)
 			return
-		} else if checker.IsFastFunc(node.Callee.Type(), isMethod) {
+		}
+		// 编译被调函数表达式，压入栈顶。
+		c.compile(node.Callee)
+		if checker.IsFastFunc(node.Callee.Type(), isMethod) {
 			c.emit(OpCallFast, len(node.Arguments))
 		} else {
 			c.emit(OpCall, len(node.Arguments))
 		}
 	} else {
+		c.compile(node.Callee)
 		c.emit(OpCall, len(node.Arguments))
 	}
 }
@@ -1220,10 +1522,11 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 	case "all":
 		c.compile(node.Arguments[0])
 		c.derefInNeeded(node.Arguments[0])
-		c.emit(OpBegin)
+		c.emitBegin(node.Name)
 		var loopBreak int
 		c.emitLoop(func() {
 			c.compile(node.Arguments[1])
+			c.emitCover(OpCover, node.Name, node.Arguments[1])
 			loopBreak = c.emit(OpJumpIfFalse, placeholder)
 			c.emit(OpPop)
 		})
@@ -1235,10 +1538,11 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 	case "none":
 		c.compile(node.Arguments[0])
 		c.derefInNeeded(node.Arguments[0])
-		c.emit(OpBegin)
+		c.emitBegin(node.Name)
 		var loopBreak int
 		c.emitLoop(func() {
 			c.compile(node.Arguments[1])
+			c.emitCover(OpCover, node.Name, node.Arguments[1])
 			c.emit(OpNot)
 			loopBreak = c.emit(OpJumpIfFalse, placeholder)
 			c.emit(OpPop)
@@ -1251,10 +1555,11 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 	case "any":
 		c.compile(node.Arguments[0])
 		c.derefInNeeded(node.Arguments[0])
-		c.emit(OpBegin)
+		c.emitBegin(node.Name)
 		var loopBreak int
 		c.emitLoop(func() {
 			c.compile(node.Arguments[1])
+			c.emitCover(OpCover, node.Name, node.Arguments[1])
 			loopBreak = c.emit(OpJumpIfTrue, placeholder)
 			c.emit(OpPop)
 		})
@@ -1266,9 +1571,10 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 	case "one":
 		c.compile(node.Arguments[0])
 		c.derefInNeeded(node.Arguments[0])
-		c.emit(OpBegin)
+		c.emitBegin(node.Name)
 		c.emitLoop(func() {
 			c.compile(node.Arguments[1])
+			c.emitCover(OpCover, node.Name, node.Arguments[1])
 			c.emitCond(func() {
 				c.emit(OpIncrementCount)
 			})
@@ -1282,9 +1588,10 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 	case "filter":
 		c.compile(node.Arguments[0])
 		c.derefInNeeded(node.Arguments[0])
-		c.emit(OpBegin)
+		c.emitBegin(node.Name)
 		c.emitLoop(func() {
 			c.compile(node.Arguments[1])
+			c.emitCover(OpCover, node.Name, node.Arguments[1])
 			c.emitCond(func() {
 				c.emit(OpIncrementCount)
 				if node.Map != nil {
@@ -1299,10 +1606,58 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 		c.emit(OpArray)
 		return
 
+	case "takeWhile":
+		c.compile(node.Arguments[0])
+		c.derefInNeeded(node.Arguments[0])
+		c.emitBegin(node.Name)
+		var loopBreak int
+		c.emitLoop(func() {
+			c.compile(node.Arguments[1])
+			c.emitCover(OpCover, node.Name, node.Arguments[1])
+			loopBreak = c.emit(OpJumpIfFalse, placeholder)
+			c.emit(OpPop)
+			c.emit(OpIncrementCount)
+			c.emit(OpPointer)
+		})
+		end := c.emit(OpJump, placeholder)
+		c.patchJump(loopBreak)
+		c.emit(OpPop)
+		c.patchJump(end)
+		c.emit(OpGetCount)
+		c.emit(OpEnd)
+		c.emit(OpArray)
+		return
+
+	case "dropWhile":
+		c.compile(node.Arguments[0])
+		c.derefInNeeded(node.Arguments[0])
+		c.emitBegin(node.Name)
+		var loopBreak int
+		c.emitLoop(func() {
+			c.compile(node.Arguments[1])
+			c.emitCover(OpCover, node.Name, node.Arguments[1])
+			loopBreak = c.emit(OpJumpIfFalse, placeholder)
+			c.emit(OpPop)
+		})
+		end := c.emit(OpJump, placeholder)
+		c.patchJump(loopBreak)
+		c.emit(OpPop)
+		// The rest of the elements, starting with the first one which
+		// does not match, are kept without calling the predicate.
+		c.emitLoop(func() {
+			c.emit(OpIncrementCount)
+			c.emit(OpPointer)
+		})
+		c.patchJump(end)
+		c.emit(OpGetCount)
+		c.emit(OpEnd)
+		c.emit(OpArray)
+		return
+
 	case "map":
 		c.compile(node.Arguments[0])
 		c.derefInNeeded(node.Arguments[0])
-		c.emit(OpBegin)
+		c.emitBegin(node.Name)
 		c.emitLoop(func() {
 			c.compile(node.Arguments[1])
 		})
@@ -1314,10 +1669,11 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 	case "count":
 		c.compile(node.Arguments[0])
 		c.derefInNeeded(node.Arguments[0])
-		c.emit(OpBegin)
+		c.emitBegin(node.Name)
 		c.emitLoop(func() {
 			if len(node.Arguments) == 2 {
 				c.compile(node.Arguments[1])
+				c.emitCover(OpCover, node.Name, node.Arguments[1])
 			} else {
 				c.emit(OpPointer)
 			}
@@ -1332,7 +1688,7 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 	case "sum":
 		c.compile(node.Arguments[0])
 		c.derefInNeeded(node.Arguments[0])
-		c.emit(OpBegin)
+		c.emitBegin(node.Name)
 		c.emit(OpInt, 0)
 		c.emit(OpSetAcc)
 		c.emitLoop(func() {
@@ -1352,10 +1708,11 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 	case "find":
 		c.compile(node.Arguments[0])
 		c.derefInNeeded(node.Arguments[0])
-		c.emit(OpBegin)
+		c.emitBegin(node.Name)
 		var loopBreak int
 		c.emitLoop(func() {
 			c.compile(node.Arguments[1])
+			c.emitCover(OpCover, node.Name, node.Arguments[1])
 			noop := c.emit(OpJumpIfFalse, placeholder)
 			c.emit(OpPop)
 			if node.Map != nil {
@@ -1380,10 +1737,11 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 	case "findIndex":
 		c.compile(node.Arguments[0])
 		c.derefInNeeded(node.Arguments[0])
-		c.emit(OpBegin)
+		c.emitBegin(node.Name)
 		var loopBreak int
 		c.emitLoop(func() {
 			c.compile(node.Arguments[1])
+			c.emitCover(OpCover, node.Name, node.Arguments[1])
 			noop := c.emit(OpJumpIfFalse, placeholder)
 			c.emit(OpPop)
 			c.emit(OpGetIndex)
@@ -1399,10 +1757,11 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 	case "findLast":
 		c.compile(node.Arguments[0])
 		c.derefInNeeded(node.Arguments[0])
-		c.emit(OpBegin)
+		c.emitBegin(node.Name)
 		var loopBreak int
 		c.emitLoopBackwards(func() {
 			c.compile(node.Arguments[1])
+			c.emitCover(OpCover, node.Name, node.Arguments[1])
 			noop := c.emit(OpJumpIfFalse, placeholder)
 			c.emit(OpPop)
 			if node.Map != nil {
@@ -1427,10 +1786,11 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 	case "findLastIndex":
 		c.compile(node.Arguments[0])
 		c.derefInNeeded(node.Arguments[0])
-		c.emit(OpBegin)
+		c.emitBegin(node.Name)
 		var loopBreak int
 		c.emitLoopBackwards(func() {
 			c.compile(node.Arguments[1])
+			c.emitCover(OpCover, node.Name, node.Arguments[1])
 			noop := c.emit(OpJumpIfFalse, placeholder)
 			c.emit(OpPop)
 			c.emit(OpGetIndex)
@@ -1446,7 +1806,7 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 	case "groupBy":
 		c.compile(node.Arguments[0])
 		c.derefInNeeded(node.Arguments[0])
-		c.emit(OpBegin)
+		c.emitBegin(node.Name)
 		c.emit(OpCreate, 1)
 		c.emit(OpSetAcc)
 		c.emitLoop(func() {
@@ -1457,10 +1817,121 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 		c.emit(OpEnd)
 		return
 
+	case "uniqBy":
+		c.compile(node.Arguments[0])
+		c.derefInNeeded(node.Arguments[0])
+		c.emitBegin(node.Name)
+		c.emit(OpCreate, 3)
+		c.emit(OpSetAcc)
+		c.emitLoop(func() {
+			c.compile(node.Arguments[1])
+			c.emit(OpUniqBy)
+			c.emitCond(func() {
+				c.emit(OpIncrementCount)
+				c.emit(OpPointer)
+			})
+		})
+		c.emit(OpGetCount)
+		c.emit(OpEnd)
+		c.emit(OpArray)
+		return
+
+	case "partition":
+		c.compile(node.Arguments[0])
+		c.derefInNeeded(node.Arguments[0])
+		c.emitBegin(node.Name)
+		c.emit(OpCreate, 4)
+		c.emit(OpSetAcc)
+		c.emitLoop(func() {
+			c.compile(node.Arguments[1])
+			c.emitCover(OpCover, node.Name, node.Arguments[1])
+			c.emit(OpPartition)
+		})
+		c.emit(OpGetAcc)
+		c.emit(OpEnd)
+		return
+
+	case "min", "max", "mean", "median":
+		if len(node.Arguments) != 2 {
+			break
+		}
+		if _, ok := node.Arguments[1].(*ast.PredicateNode); !ok {
+			break
+		}
+		c.compile(node.Arguments[0])
+		c.derefInNeeded(node.Arguments[0])
+		c.emitBegin(node.Name)
+		switch node.Name {
+		case "min", "max":
+			c.emitLoop(func() {
+				c.compile(node.Arguments[1])
+				if node.Name == "min" {
+					c.emit(OpMin)
+				} else {
+					c.emit(OpMax)
+				}
+			})
+			c.emit(OpGetAcc)
+			c.emit(OpEnd)
+		case "mean":
+			c.emit(OpInt, 0)
+			c.emit(OpSetAcc)
+			c.emitLoop(func() {
+				c.compile(node.Arguments[1])
+				c.emit(OpGetAcc)
+				c.emit(OpAdd)
+				c.emit(OpSetAcc)
+				c.emit(OpIncrementCount)
+			})
+			c.emit(OpGetCount)
+			c.emit(OpInt, 0)
+			c.emit(OpEqual)
+			otherwise := c.emit(OpJumpIfFalse, placeholder)
+			c.emit(OpPop)
+			c.emit(OpPush, c.addConstant(0.0))
+			end := c.emit(OpJump, placeholder)
+			c.patchJump(otherwise)
+			c.emit(OpPop)
+			c.emit(OpGetAcc)
+			c.emit(OpGetCount)
+			c.emit(OpDivide)
+			c.patchJump(end)
+			c.emit(OpEnd)
+		case "median":
+			// The median needs all the values, but only the values are
+			// collected, not the elements.
+			c.emitLoop(func() {
+				c.compile(node.Arguments[1])
+			})
+			c.emit(OpGetLen)
+			c.emit(OpEnd)
+			c.emit(OpArray)
+			c.emitFunction(builtin.Builtins[builtin.Index["median"]], 1)
+		}
+		return
+
+	case "sort":
+		if len(node.Arguments) != 2 || !isComparator(node.Arguments[1].Nature()) {
+			break
+		}
+		// The VM merges the elements, and the comparator is called for
+		// every pair of elements it compares.
+		c.compile(node.Arguments[0])
+		c.derefInNeeded(node.Arguments[0])
+		c.compile(node.Arguments[1])
+		c.emit(OpCreate, 5)
+		begin := len(c.bytecode)
+		end := c.emit(OpSortNext, placeholder)
+		c.emit(OpCall, 2)
+		c.emit(OpSortResult)
+		c.emit(OpJumpBackward, c.calcBackwardJump(begin))
+		c.patchJump(end)
+		return
+
 	case "sortBy":
 		c.compile(node.Arguments[0])
 		c.derefInNeeded(node.Arguments[0])
-		c.emit(OpBegin)
+		c.emitBegin(node.Name)
 		if len(node.Arguments) == 3 {
 			c.compile(node.Arguments[2])
 		} else {
@@ -1476,10 +1947,20 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 		c.emit(OpEnd)
 		return
 
+	case "envKeys", "envHas":
+		// The env is passed to the builtin as a hidden first argument.
+		c.emit(OpLoadEnv)
+		for _, arg := range node.Arguments {
+			c.compile(arg)
+			c.derefInNeeded(arg)
+		}
+		c.emitFunction(builtin.Builtins[builtin.Index[node.Name]], len(node.Arguments)+1)
+		return
+
 	case "reduce":
 		c.compile(node.Arguments[0])
 		c.derefInNeeded(node.Arguments[0])
-		c.emit(OpBegin)
+		c.emitBegin(node.Name)
 		if len(node.Arguments) == 3 {
 			c.compile(node.Arguments[2])
 			c.derefInNeeded(node.Arguments[2])
@@ -1510,6 +1991,28 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 
 		f := builtin.Builtins[id]
 		for i, arg := range node.Arguments {
+			if str, ok := arg.(*ast.StringNode); ok && i == 1 && builtin.Regexps[node.Name] {
+				// Same as matches: the pattern literal is compiled once.
+				var re any
+				var err error
+				if c.config != nil && c.config.Regexps != nil {
+					re, err = c.config.Regexps.Compile(str.Value)
+				} else {
+					re, err = regexp.Compile(str.Value)
+				}
+				if err != nil {
+					panic(err)
+				}
+				c.emit(OpPush, c.addConstant(re))
+				continue
+			}
+			if i == 1 && builtin.Regexps[node.Name] && c.config != nil && c.config.Regexps != nil {
+				// Other patterns are compiled within the limits when run.
+				c.compile(arg)
+				c.derefInNeeded(arg)
+				c.emit(OpRegexp, c.addConstant(c.config.Regexps))
+				continue
+			}
 			c.compile(arg)
 			argType := arg.Type()
 			// 如果参数是指针或 Unknown （在编译期没法确认）类型，需要考虑是否要对它做 Deref（解引用）。
@@ -1527,13 +2030,21 @@ func (c *compiler) BuiltinNode(node *ast.BuiltinNode) {
 			}
 		}
 
-		if f.Fast != nil {
+		if f.Fast2 != nil && len(node.Arguments) == 2 {
+			// 两个参数、且提供了 Fast2 版本时，走双参数快速调用，避免构造参数切片。
+			c.emit(OpCallBuiltin2, id)
+		} else if f.Fast3 != nil && len(node.Arguments) == 3 {
+			// 同上，三个参数的快速调用。
+			c.emit(OpCallBuiltin3, id)
+		} else if f.Fast != nil {
 			// 1. 优先使用 Fast 快速调用（单参数、无错误处理的高效版本）
 			c.emit(OpCallBuiltin1, id) // 生成调用内置函数的快速指令，传入函数 ID
 		} else if f.Safe != nil {
 			// 2. 其次使用 Safe 安全调用（带状态返回的版本）
-			c.emit(OpPush, c.addConstant(f.Safe))   // 将 Safe 函数入栈
-			c.emit(OpCallSafe, len(node.Arguments)) // 生成安全调用指令，传入参数数量
+			index := c.addConstant(f.Safe)
+			c.debugInfo[fmt.Sprintf("const_%d", index)] = f.Name // 按名字记录，用于序列化
+			c.emit(OpPush, index)                                // 将 Safe 函数入栈
+			c.emit(OpCallSafe, len(node.Arguments))              // 生成安全调用指令，传入参数数量
 		} else if f.Func != nil {
 			// 3. 最后使用普通 Func 调用（通用版本）
 			c.emitFunction(f, len(node.Arguments)) // 生成普通调用指令
@@ -1557,6 +2068,27 @@ func (c *compiler) emitCond(body func()) {
 	c.patchJump(jmp)
 }
 
+// emitCover counts, with conf.Config.Coverage, the ways taken by the
+// condition on top of the stack: true or false for OpCover, not nil or nil
+// for OpCoverNil. The value stays on the stack.
+func (c *compiler) emitCover(op Opcode, kind string, cond ast.Node) {
+	if c.config == nil || !c.config.Coverage {
+		return
+	}
+	c.emit(op, c.addConstant(&Branch{
+		Kind:       kind,
+		Expression: cond.String(),
+		Location:   cond.Location(),
+	}))
+}
+
+// emitBegin starts a loop of the builtin over the array on the stack. The
+// name of the builtin is kept to describe nested loops in errors.
+func (c *compiler) emitBegin(name string) {
+	ip := c.emit(OpBegin)
+	c.debugInfo[fmt.Sprintf("loop_%d", ip-1)] = name
+}
+
 func (c *compiler) emitLoop(body func()) {
 	begin := len(c.bytecode)
 	end := c.emit(OpJumpIfEnd, placeholder)
@@ -1590,6 +2122,41 @@ func (c *compiler) PredicateNode(node *ast.PredicateNode) {
 	c.compile(node.Node)
 }
 
+// FunctionNode compiles a function defined in the expression. Its body is
+// compiled in place and jumped over; OpClosure then creates the function
+// value with the values of the variables it captures, which are the
+// variables declared around the function and loaded in its body.
+func (c *compiler) FunctionNode(node *ast.FunctionNode) {
+	end := c.emit(OpJump, placeholder)
+	lambda := &runtime.Lambda{
+		Start:  len(c.bytecode),
+		Params: len(node.Params),
+	}
+	from := c.variables
+	for _, name := range node.Params {
+		c.beginScope(name, c.addVariable(name))
+	}
+	c.compile(node.Node)
+	for range node.Params {
+		c.endScope()
+	}
+	c.emit(OpReturn)
+	c.patchJump(end)
+
+	for index := from; index < c.variables; index++ {
+		lambda.Locals = append(lambda.Locals, index)
+	}
+	captured := map[int]bool{}
+	for ip := lambda.Start; ip < len(c.bytecode); ip++ {
+		index := c.arguments[ip]
+		if c.bytecode[ip] == OpLoadVar && index < from && !captured[index] {
+			captured[index] = true
+			lambda.Captures = append(lambda.Captures, index)
+		}
+	}
+	c.emit(OpClosure, c.addConstant(lambda))
+}
+
 // PointerNode
 //
 // Q: 什么是 PointerNode？
@@ -1599,6 +2166,10 @@ func (c *compiler) PredicateNode(node *ast.PredicateNode) {
 //   - #acc：累加器（常用于 reduce 表达式）
 //   - #foo：其他具名引用
 func (c *compiler) PointerNode(node *ast.PointerNode) {
+	if level, ok := node.Level(); ok {
+		c.emit(OpOuterPointer, level-1)
+		return
+	}
 	switch node.Name {
 	case "index":
 		c.emit(OpGetIndex)
@@ -1712,6 +2283,7 @@ func (c *compiler) lookupVariable(name string) (int, bool) {
 //  10. ...              ; 后续指令
 func (c *compiler) ConditionalNode(node *ast.ConditionalNode) {
 	c.compile(node.Cond)
+	c.emitCover(OpCover, "?:", node.Cond)
 	otherwise := c.emit(OpJumpIfFalse, placeholder)
 
 	c.emit(OpPop)
@@ -1725,6 +2297,44 @@ func (c *compiler) ConditionalNode(node *ast.ConditionalNode) {
 	c.patchJump(end)
 }
 
+// SwitchNode compiles a chain of conditionals to a jump table: OpSwitch
+// jumps to the branch of the value, or runs the default branch right after
+// it. The value is computed once, instead of once per comparison.
+func (c *compiler) SwitchNode(node *ast.SwitchNode) {
+	c.compile(node.Node)
+	table := runtime.Switch{}
+	c.emit(OpSwitch, c.addConstant(table))
+	start := len(c.bytecode)
+
+	c.compile(node.Default)
+	var ends []int
+	for i, branch := range node.Branches {
+		ends = append(ends, c.emit(OpJump, placeholder))
+		table[node.Cases[i]] = len(c.bytecode) - start
+		c.compile(branch)
+	}
+	for _, end := range ends {
+		c.patchJump(end)
+	}
+}
+
+// OpcodeNode pushes the arguments and runs the custom opcode. The argument of
+// the opcode is the constant of node.Argument, or -1 if it is nil.
+func (c *compiler) OpcodeNode(node *ast.OpcodeNode) {
+	op, ok := LookupOpcode(node.Name)
+	if !ok {
+		panic(fmt.Sprintf("unknown opcode %v", node.Name))
+	}
+	for _, arg := range node.Arguments {
+		c.compile(arg)
+	}
+	if node.Argument == nil {
+		c.emit(op, -1)
+	} else {
+		c.emit(op, c.addConstant(node.Argument))
+	}
+}
+
 func (c *compiler) ArrayNode(node *ast.ArrayNode) {
 	for _, node := range node.Nodes {
 		c.compile(node)
@@ -1748,6 +2358,24 @@ func (c *compiler) PairNode(node *ast.PairNode) {
 	c.compile(node.Value)
 }
 
+// emitArithmetic emits op, or its overflow-checked variant if the config
+// enables checked arithmetic.
+func (c *compiler) emitArithmetic(op Opcode) {
+	if c.config != nil && c.config.CheckedArithmetic {
+		switch op {
+		case OpAdd:
+			op = OpAddChecked
+		case OpSubtract:
+			op = OpSubtractChecked
+		case OpMultiply:
+			op = OpMultiplyChecked
+		case OpNegate:
+			op = OpNegateChecked
+		}
+	}
+	c.emit(op)
+}
+
 func (c *compiler) derefInNeeded(node ast.Node) {
 	if node.Nature().Nil {
 		return
@@ -1773,7 +2401,7 @@ func (c *compiler) derefParam(in reflect.Type, param ast.Node) {
 func (c *compiler) optimize() {
 	for i, op := range c.bytecode {
 		switch op {
-		case OpJumpIfTrue, OpJumpIfFalse, OpJumpIfNil, OpJumpIfNotNil:
+		case OpJumpIfTrue, OpJumpIfFalse, OpJumpIfNil, OpJumpIfNotNil, OpJumpIfNotNilStrict:
 			target := i + c.arguments[i] + 1
 			for target < len(c.bytecode) && c.bytecode[target] == op {
 				target += c.arguments[target] + 1
@@ -1790,8 +2418,8 @@ func kind(t reflect.Type) reflect.Kind {
 	return t.Kind()
 }
 
-func (c *compiler) dump() {
-	fmt.Println("====== [COMPILER DUMP] ======")
+func (c *compiler) dump(w io.Writer) {
+	fmt.Fprintln(w, "====== [COMPILER DUMP] ======")
 
 	// 打印 Bytecode + Arguments + 源码位置信息
 	for i, op := range c.bytecode {
@@ -1803,32 +2431,32 @@ func (c *compiler) dump() {
 		if i < len(c.locations) {
 			loc = c.locations[i].String()
 		}
-		fmt.Printf("[%-3d] %-20s arg=%-5d loc=%s", i, op.String(), arg, loc)
-		fmt.Println()
+		fmt.Fprintf(w, "[%-3d] %-20s arg=%-5d loc=%s", i, op.String(), arg, loc)
+		fmt.Fprintln(w)
 	}
 
 	// 打印常量池
-	fmt.Println("\n[Constants]")
+	fmt.Fprintln(w, "\n[Constants]")
 	for i, v := range c.constants {
-		fmt.Printf("  #%d: %T = %v", i, v, v)
-		fmt.Println()
+		fmt.Fprintf(w, "  #%d: %T = %v", i, v, v)
+		fmt.Fprintln(w)
 	}
 
 	// 打印函数池
-	fmt.Println("\n[Functions]")
+	fmt.Fprintln(w, "\n[Functions]")
 	for i, fn := range c.functions {
-		fmt.Printf("  #%d: %T at %p", i, fn, fn)
-		fmt.Println()
+		fmt.Fprintf(w, "  #%d: %T at %p", i, fn, fn)
+		fmt.Fprintln(w)
 	}
 
 	// 打印链结构（用于 ChainNode）
 	if len(c.chains) > 0 {
-		fmt.Println("\n[Chains]")
+		fmt.Fprintln(w, "\n[Chains]")
 		for i, chain := range c.chains {
-			fmt.Printf("  Chain[%d]: %v", i, chain)
-			fmt.Println()
+			fmt.Fprintf(w, "  Chain[%d]: %v", i, chain)
+			fmt.Fprintln(w)
 		}
 	}
 
-	fmt.Println("====== [END DUMP] ======")
+	fmt.Fprintln(w, "====== [END DUMP] ======")
 }
@@ -1,7 +1,11 @@
 package compiler_test
 
 import (
+	"bytes"
 	"math"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/expr-lang/expr/internal/testify/assert"
@@ -445,6 +449,51 @@ func TestCompile_FuncTypes(t *testing.T) {
 	require.Equal(t, 32, program.Arguments[3])
 }
 
+func TestCompile_FuncTypes_variadic_and_errors(t *testing.T) {
+	env := map[string]any{
+		"join": func(sep string, parts ...string) string {
+			return strings.Join(parts, sep)
+		},
+		"sum": func(n ...int) int {
+			total := 0
+			for _, x := range n {
+				total += x
+			}
+			return total
+		},
+		"parse": func(s string) (int, error) {
+			return strconv.Atoi(s)
+		},
+	}
+	tests := []struct {
+		code string
+		want any
+	}{
+		{`join("-", "a", "b", "c")`, "a-b-c"},
+		{`join("-")`, ""},
+		{`sum(1, 2, 3) + sum()`, 6},
+		{`parse("42")`, 42},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(env))
+			require.NoError(t, err)
+			assert.Contains(t, program.Bytecode, vm.OpCallTyped)
+			assert.NotContains(t, program.Bytecode, vm.OpCall)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	program, err := expr.Compile(`parse("x")`, expr.Env(env))
+	require.NoError(t, err)
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid syntax`)
+}
+
 func TestCompile_FuncTypes_with_Method(t *testing.T) {
 	env := mock.Env{}
 	program, err := expr.Compile("FuncTyped('bar')", expr.Env(env))
@@ -574,8 +623,8 @@ func TestCompile_optimizes_jumps(t *testing.T) {
 `,
 		},
 		{
-			`true ?? nil ?? nil ?? nil`,
-			`0  OpTrue
+			`nil ?? nil ?? nil ?? nil`,
+			`0  OpNil
 1  OpJumpIfNotNil  <8>  (10)
 2  OpPop
 3  OpNil
@@ -585,6 +634,14 @@ func TestCompile_optimizes_jumps(t *testing.T) {
 7  OpJumpIfNotNil  <2>  (10)
 8  OpPop
 9  OpNil
+`,
+		},
+		{
+			`nil ?? true ?? nil ?? nil`,
+			`0  OpNil
+1  OpJumpIfNotNil  <2>  (4)
+2  OpPop
+3  OpTrue
 `,
 		},
 		{
@@ -632,17 +689,22 @@ func TestCompile_optimizes_jumps(t *testing.T) {
 `,
 		},
 		{
-			`true ? false : 8 not in [1, 2, 5]`,
-			`0  OpTrue
+			`a ? false : 8 not in [1, 2, 5]`,
+			`0  OpLoadFast     <0>  a
 1  OpJumpIfFalse  <3>  (5)
 2  OpPop
 3  OpFalse
 4  OpJump  <5>  (10)
 5  OpPop
-6  OpPush  <0>  8
-7  OpPush  <1>  map[1:{} 2:{} 5:{}]
+6  OpPush  <1>  8
+7  OpPush  <2>  map[1:{} 2:{} 5:{}]
 8  OpIn
 9  OpNot
+`,
+		},
+		{
+			`true ? false : 8 not in [1, 2, 5]`,
+			`0  OpFalse
 `,
 		},
 	}
@@ -686,3 +748,99 @@ func TestCompile_call_on_nil(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "foo is nil; cannot call nil as function")
 }
+
+func TestCompile_bytecode_dump(t *testing.T) {
+	var out bytes.Buffer
+	_, err := expr.Compile(`"hello" + name`, expr.WithBytecodeDump(&out))
+	require.NoError(t, err)
+
+	dump := out.String()
+	assert.Contains(t, dump, "OpPush")
+	assert.Contains(t, dump, "OpAdd")
+	assert.Contains(t, dump, `#0: string = hello`)
+}
+
+func TestCompile_common_subexpression(t *testing.T) {
+	env := map[string]any{
+		"order": map[string]any{
+			"User": map[string]any{
+				"Address": map[string]any{"City": "Y"},
+			},
+		},
+		"empty": map[string]any{"User": nil},
+	}
+
+	tests := []struct {
+		code  string
+		loads int
+		want  any
+	}{
+		{`order.User.Address.City == "X" || order.User.Address.City == "Y"`, 2, true},
+		{`order.User.Address.City + order.User.Address.City + order.User.Address.City`, 3, "YYY"},
+		{`let c = order.User.Address.City; c + order.User.Address.City`, 3, "YY"},
+		{`empty.User == nil || empty.User.Address == nil || empty.User.Address == 1`, 0, true},
+		{`true ? order.User.Address.City : order.User.Address.City`, 0, "Y"},
+		{`order.User.Address.City == "X" ? "x" : order.User.Address.City`, 2, "Y"},
+		{`any(["Y"], # == order.User.Address.City) && order.User.Address.City == "Y"`, 0, true},
+		{`order.User == order.User`, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(env))
+			require.NoError(t, err)
+			assert.Equal(t, tt.loads, strings.Count(program.Disassemble(), "OpLoadVar"), program.Disassemble())
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+
+			unoptimized, err := expr.Compile(tt.code, expr.Env(env), expr.Optimize(false))
+			require.NoError(t, err)
+			assert.NotContains(t, unoptimized.Disassemble(), "$cse")
+		})
+	}
+}
+
+func TestCompile_dead_stores(t *testing.T) {
+	calls := 0
+	env := map[string]any{
+		"x":    1,
+		"tick": func() int { calls++; return calls },
+	}
+	tests := []struct {
+		code      string
+		stores    int
+		variables int
+		want      any
+	}{
+		{`let a = 1; let b = 2; b`, 1, 1, 2},
+		{`let a = tick(); let b = x; let c = a + 1; c`, 2, 2, 2},
+		{`let a = x; let f = (y) => { let unused = y; let z = y + a; z }; f(1) + f(2)`, 3, 4, 5},
+		{`let a = x; let b = 2; let f = (u) => a; let g = (y) => b; f(0) + g(0)`, 4, 6, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			calls = 0
+			program, err := expr.Compile(tt.code, expr.Env(env))
+			require.NoError(t, err)
+			disassembled := program.Disassemble()
+			assert.Equal(t, tt.stores, strings.Count(disassembled, "OpStore"), disassembled)
+			variables := 0
+			for _, m := range regexp.MustCompile(`Op(?:Store|LoadVar)\s+<(\d+)>`).FindAllStringSubmatch(disassembled, -1) {
+				if index, _ := strconv.Atoi(m[1]); index+1 > variables {
+					variables = index + 1
+				}
+			}
+			assert.Equal(t, tt.variables, variables, disassembled)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+			if strings.Contains(tt.code, "tick") {
+				assert.Equal(t, 1, calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package compiler
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/expr-lang/expr/ast"
+)
+
+// cse plans common subexpression elimination of member chains, like
+// order.User.Address.City, evaluated more than once in an expression.
+// The first evaluation stores its result in a hidden variable, and later
+// ones load it instead of fetching the chain again.
+//
+// A later evaluation is replaced only if the first one is guaranteed to
+// run before it: the first one must not sit in a branch of a conditional,
+// on the right side of and/or/??, in an optional chain, or in a predicate,
+// relative to the closest node containing both of them.
+type cse struct {
+	stores map[ast.Node]int
+	loads  map[ast.Node]int
+}
+
+type cseStep struct {
+	node ast.Node
+	cond bool // node is not always evaluated when its parent is
+}
+
+type cseOccurrence struct {
+	node ast.Node
+	path []cseStep
+}
+
+type cseCollector struct {
+	shadowed    map[string]bool
+	visited     map[ast.Node]bool // nodes shared by chained comparisons are visited once
+	occurrences map[string][]cseOccurrence
+	order       []string
+	path        []cseStep
+}
+
+func (c *compiler) planCSE(root ast.Node) {
+	v := &cseCollector{
+		shadowed:    map[string]bool{},
+		visited:     map[ast.Node]bool{},
+		occurrences: map[string][]cseOccurrence{},
+	}
+	ast.Find(root, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.VariableDeclaratorNode:
+			v.shadowed[n.Name] = true
+		case *ast.FunctionNode:
+			for _, name := range n.Params {
+				v.shadowed[name] = true
+			}
+		}
+		return false
+	})
+	v.visit(root, false)
+
+	for _, key := range v.order {
+		occurrences := v.occurrences[key]
+		if len(occurrences) < 2 {
+			continue
+		}
+		first := occurrences[0]
+		var loads []ast.Node
+		for _, o := range occurrences[1:] {
+			if dominates(first.path, o.path) {
+				loads = append(loads, o.node)
+			}
+		}
+		if len(loads) == 0 {
+			continue
+		}
+		if c.cse.stores == nil {
+			c.cse.stores = map[ast.Node]int{}
+			c.cse.loads = map[ast.Node]int{}
+		}
+		index := c.addVariable(fmt.Sprintf("$cse%d", len(c.cse.stores)))
+		c.cse.stores[first.node] = index
+		for _, node := range loads {
+			c.cse.loads[node] = index
+		}
+	}
+}
+
+// dominates reports whether the node at path a is always evaluated before
+// the node at path b. The path a must precede b in evaluation order.
+func dominates(a, b []cseStep) bool {
+	i := 0
+	for i < len(a) && i < len(b) && a[i].node == b[i].node {
+		i++
+	}
+	for ; i < len(a); i++ {
+		if a[i].cond {
+			return false
+		}
+	}
+	return true
+}
+
+func (v *cseCollector) visit(node ast.Node, cond bool) {
+	if node == nil || v.visited[node] {
+		return
+	}
+	v.visited[node] = true
+	v.path = append(v.path, cseStep{node, cond})
+	defer func() {
+		v.path = v.path[:len(v.path)-1]
+	}()
+
+	if v.isChain(node) {
+		key := node.String()
+		if _, ok := v.occurrences[key]; !ok {
+			v.order = append(v.order, key)
+		}
+		path := make([]cseStep, len(v.path))
+		copy(path, v.path)
+		v.occurrences[key] = append(v.occurrences[key], cseOccurrence{node, path})
+		return
+	}
+
+	switch n := node.(type) {
+	case *ast.UnaryNode:
+		v.visit(n.Node, false)
+	case *ast.BinaryNode:
+		v.visit(n.Left, false)
+		switch n.Operator {
+		case "==", "!=", "<", ">", "<=", ">=", "+", "-", "*", "/", "%", "**", "^",
+			"contains", "startsWith", "endsWith":
+			v.visit(n.Right, false)
+		default:
+			v.visit(n.Right, true)
+		}
+	case *ast.ChainNode:
+		v.visit(n.Node, true)
+	case *ast.MemberNode:
+		v.visit(n.Node, true)
+		v.visit(n.Property, true)
+	case *ast.SliceNode:
+		v.visit(n.Node, true)
+		v.visit(n.From, true)
+		v.visit(n.To, true)
+	case *ast.CallNode:
+		v.visit(n.Callee, true)
+		for _, arg := range n.Arguments {
+			v.visit(arg, false)
+		}
+	case *ast.BuiltinNode:
+		for _, arg := range n.Arguments {
+			v.visit(arg, true)
+		}
+	case *ast.OpcodeNode:
+		for _, arg := range n.Arguments {
+			v.visit(arg, false)
+		}
+	case *ast.ConditionalNode:
+		v.visit(n.Cond, false)
+		v.visit(n.Exp1, true)
+		v.visit(n.Exp2, true)
+	case *ast.SwitchNode:
+		v.visit(n.Node, false)
+		v.visit(n.Default, true)
+		for _, branch := range n.Branches {
+			v.visit(branch, true)
+		}
+	case *ast.VariableDeclaratorNode:
+		v.visit(n.Value, false)
+		v.visit(n.Expr, false)
+	case *ast.SequenceNode:
+		for _, node := range n.Nodes {
+			v.visit(node, false)
+		}
+	case *ast.ArrayNode:
+		for _, node := range n.Nodes {
+			v.visit(node, false)
+		}
+	case *ast.MapNode:
+		for _, pair := range n.Pairs {
+			v.visit(pair, false)
+		}
+	case *ast.PairNode:
+		v.visit(n.Key, true)
+		v.visit(n.Value, false)
+	}
+	// Predicates are evaluated once per element, and functions once per
+	// call, so they are not visited.
+}
+
+// isChain reports whether node is a member chain of at least two constant
+// properties on an env variable, like a.b.c or a["b"][0].
+func (v *cseCollector) isChain(node ast.Node) bool {
+	member, ok := node.(*ast.MemberNode)
+	if !ok || member.Method {
+		return false
+	}
+	if t := member.Type(); t != nil && t.Kind() == reflect.Func {
+		return false
+	}
+	depth := 0
+	for {
+		if member.Optional {
+			return false
+		}
+		switch member.Property.(type) {
+		case *ast.StringNode, *ast.IntegerNode:
+		default:
+			return false
+		}
+		depth++
+		switch base := member.Node.(type) {
+		case *ast.MemberNode:
+			member = base
+		case *ast.IdentifierNode:
+			return depth >= 2 && !v.shadowed[base.Value]
+		default:
+			return false
+		}
+	}
+}
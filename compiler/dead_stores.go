@@ -0,0 +1,76 @@
+package compiler
+
+import (
+	"fmt"
+
+	. "github.com/expr-lang/expr/vm"
+	"github.com/expr-lang/expr/vm/runtime"
+)
+
+// eliminateDeadStores replaces the stores of variables which are never
+// loaded, like unused lets, with pops, and renumbers the other variables, so
+// runs allocate only the variables in use. The stored values are still
+// evaluated, as they may call functions with side effects.
+func (c *compiler) eliminateDeadStores() {
+	used := make([]bool, c.variables)
+	for ip, op := range c.bytecode {
+		if op == OpLoadVar {
+			used[c.arguments[ip]] = true
+		}
+	}
+	var lambdas []*runtime.Lambda
+	for _, constant := range c.constants {
+		lambda, ok := constant.(*runtime.Lambda)
+		if !ok {
+			continue
+		}
+		lambdas = append(lambdas, lambda)
+		// Parameters are stored by the calls, by their positions.
+		for _, index := range lambda.Locals[:lambda.Params] {
+			used[index] = true
+		}
+	}
+
+	renamed := make([]int, c.variables)
+	names := make([]string, 0, c.variables)
+	for index, ok := range used {
+		if ok {
+			renamed[index] = len(names)
+			names = append(names, c.debugInfo[fmt.Sprintf("var_%d", index)])
+		}
+	}
+	if len(names) == c.variables {
+		return
+	}
+
+	for ip, op := range c.bytecode {
+		index := c.arguments[ip]
+		switch {
+		case op == OpStore && !used[index]:
+			c.bytecode[ip] = OpPop
+			c.arguments[ip] = 0
+		case op == OpStore, op == OpLoadVar:
+			c.arguments[ip] = renamed[index]
+		}
+	}
+	for _, lambda := range lambdas {
+		var locals []int
+		for _, index := range lambda.Locals {
+			if used[index] {
+				locals = append(locals, renamed[index])
+			}
+		}
+		lambda.Locals = locals
+		for i, index := range lambda.Captures {
+			lambda.Captures[i] = renamed[index]
+		}
+	}
+
+	for index := 0; index < c.variables; index++ {
+		delete(c.debugInfo, fmt.Sprintf("var_%d", index))
+	}
+	for index, name := range names {
+		c.debugInfo[fmt.Sprintf("var_%d", index)] = name
+	}
+	c.variables = len(names)
+}
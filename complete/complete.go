@@ -0,0 +1,306 @@
+// Package complete suggests names for partial expressions, for editors of
+// expressions.
+package complete
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/builtin"
+	"github.com/expr-lang/expr/checker"
+	"github.com/expr-lang/expr/checker/nature"
+	"github.com/expr-lang/expr/conf"
+	"github.com/expr-lang/expr/file"
+	"github.com/expr-lang/expr/internal/deref"
+	"github.com/expr-lang/expr/parser/lexer"
+)
+
+// Kind is the kind of a candidate.
+type Kind string
+
+const (
+	Variable Kind = "variable" // Variable of the env, or declared with let.
+	Field    Kind = "field"    // Field of a struct.
+	Key      Kind = "key"      // Key of a map, declared in the env.
+	Method   Kind = "method"   // Method of the env or of a value.
+	Function Kind = "function" // Function added with expr.Function.
+	Builtin  Kind = "builtin"  // Builtin function, like len.
+)
+
+// Candidate is a name which can be written at the cursor.
+type Candidate struct {
+	Name string
+	Kind Kind
+	Type string // Type of the value or of the function, empty if unknown.
+}
+
+// Complete returns the candidates for the name at the offset of the input,
+// sorted by name. The offset is counted in runes, like file.Location, and
+// only the input before it is used, so the cursor can be in the middle of
+// a name.
+//
+// After a dot, like in user.Ad, the candidates are the fields, map keys and
+// methods of the value before the dot, which is checked with the config.
+// Elsewhere, they are the variables of the env, the variables declared with
+// let before the cursor, functions and builtins. Only the candidates which
+// start with the name before the cursor are returned. There are no
+// candidates inside strings.
+//
+// The value before the dot is checked where it is written, inside the
+// predicates, functions and let declarations around it, so the elements of
+// predicates, like # and .Name in map(users, .Name), parameters, like u in
+// filter(users, u => u.Name), variables declared with let and $env have
+// candidates too.
+func Complete(input string, offset int, config *conf.Config) []Candidate {
+	if config == nil {
+		config = conf.CreateNew()
+	}
+	source := file.NewSource(input)
+	if offset < 0 || offset > len(source) {
+		return nil
+	}
+	source = source[:offset]
+
+	tokens, err := lexer.Lex(source)
+	if err != nil {
+		return nil
+	}
+	tokens = tokens[:len(tokens)-1] // EOF
+
+	var prefix string
+	if n := len(tokens); n > 0 && tokens[n-1].Is(lexer.Identifier) && tokens[n-1].To == offset {
+		prefix = tokens[n-1].Value
+		tokens = tokens[:n-1]
+	}
+
+	var candidates []Candidate
+	if n := len(tokens); n > 0 && (tokens[n-1].Is(lexer.Operator, ".") || tokens[n-1].Is(lexer.Operator, "?.")) {
+		candidates = members(source, tokens, config)
+	} else {
+		candidates = names(tokens, config)
+	}
+
+	seen := map[string]bool{}
+	var result []Candidate
+	for _, c := range candidates {
+		if strings.HasPrefix(c.Name, prefix) && !seen[c.Name] {
+			seen[c.Name] = true
+			result = append(result, c)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// names returns the names which can start an expression. Earlier ones
+// shadow later ones with the same name.
+func names(tokens []lexer.Token, config *conf.Config) []Candidate {
+	var candidates []Candidate
+	for i := len(tokens) - 2; i >= 0; i-- {
+		if tokens[i].Is(lexer.Operator, "let") && tokens[i+1].Is(lexer.Identifier) {
+			candidates = append(candidates, Candidate{Name: tokens[i+1].Value, Kind: Variable})
+		}
+	}
+	candidates = append(candidates, all(config.Env, Variable)...)
+	for name, fn := range config.Functions {
+		candidates = append(candidates, Candidate{Name: name, Kind: Function, Type: fn.Type().String()})
+	}
+	for _, fn := range builtin.Builtins {
+		if !config.Disabled[fn.Name] {
+			candidates = append(candidates, Candidate{Name: fn.Name, Kind: Builtin, Type: typeOf(fn)})
+		}
+	}
+	return candidates
+}
+
+// marker is the function the value before the dot is passed to, to find it
+// in the checked tree.
+const marker = "__complete__"
+
+// members returns the members of the value before the dot which ends the
+// tokens.
+func members(source file.Source, tokens []lexer.Token, config *conf.Config) []Candidate {
+	dot := len(tokens) - 1
+	start := receiver(tokens, dot)
+	value := ""
+	if start < 0 {
+		// The element of a predicate, like .Name in map(users, .Name).
+		if dot > 0 && !beforeOperand(tokens[dot-1]) {
+			return nil
+		}
+		start, value = dot, "#"
+	} else {
+		value = string(source[tokens[start].From:tokens[dot].From])
+	}
+	if value == "$env" {
+		return all(config.Env, Variable)
+	}
+
+	c := *config
+	c.Expect = reflect.Invalid
+	c.ExpectAny = false
+	c.Warnings = nil
+	c.WarningsAsErrors = false
+	c.Functions = make(conf.FunctionsTable, len(config.Functions)+1)
+	for name, fn := range config.Functions {
+		c.Functions[name] = fn
+	}
+	c.Functions[marker] = &builtin.Function{
+		Name:  marker,
+		Func:  func(args ...any) (any, error) { return args[0], nil },
+		Types: []reflect.Type{reflect.TypeOf(new(func(any) any)).Elem()},
+	}
+
+	// The value is checked in its context, with the brackets around it
+	// closed, or else alone.
+	input := string(source[:tokens[start].From]) + marker + "(" + value + ")" + closing(tokens[:start])
+	if tree, err := checker.ParseCheck(input, &c); err == nil {
+		if call := find(tree.Node); call != nil {
+			return all(call.Arguments[0].Nature(), Field)
+		}
+	}
+	if value == "#" {
+		return nil
+	}
+	tree, err := checker.ParseCheck(value, &c)
+	if err != nil {
+		return nil
+	}
+	return all(tree.Node.Nature(), Field)
+}
+
+// beforeOperand reports whether an operand can start after the token, so a
+// dot after it is a member of the element of a predicate, like in .Name.
+func beforeOperand(token lexer.Token) bool {
+	return token.Is(lexer.Operator) || token.Is(lexer.Bracket, "(") || token.Is(lexer.Bracket, "[") || token.Is(lexer.Bracket, "{")
+}
+
+// closing returns the brackets which close those left open by the tokens.
+func closing(tokens []lexer.Token) string {
+	var closers []string
+	for _, t := range tokens {
+		switch {
+		case t.Is(lexer.Bracket, "("):
+			closers = append(closers, ")")
+		case t.Is(lexer.Bracket, "["):
+			closers = append(closers, "]")
+		case t.Is(lexer.Bracket, "{"):
+			closers = append(closers, "}")
+		case t.Is(lexer.Bracket) && len(closers) > 0:
+			closers = closers[:len(closers)-1]
+		}
+	}
+	var b strings.Builder
+	for i := len(closers) - 1; i >= 0; i-- {
+		b.WriteString(closers[i])
+	}
+	return b.String()
+}
+
+// find returns the call of the marker in the tree.
+func find(node ast.Node) *ast.CallNode {
+	found := ast.Find(node, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallNode)
+		if !ok {
+			return false
+		}
+		callee, ok := call.Callee.(*ast.IdentifierNode)
+		return ok && callee.Value == marker && len(call.Arguments) == 1
+	})
+	if found == nil {
+		return nil
+	}
+	return found.(*ast.CallNode)
+}
+
+// receiver returns the index of the first token of the value which ends
+// before the token at end, like user.Address in user.Address.City, or -1
+// if there is no such value.
+func receiver(tokens []lexer.Token, end int) int {
+	i := end - 1
+	for i >= 0 {
+		switch {
+		case tokens[i].Is(lexer.Identifier):
+			if i > 0 && (tokens[i-1].Is(lexer.Operator, ".") || tokens[i-1].Is(lexer.Operator, "?.")) {
+				if i > 1 && beforeOperand(tokens[i-2]) {
+					// A member of the element of a predicate, like .Address.
+					return i - 1
+				}
+				i -= 2
+				continue
+			}
+			return i
+		case tokens[i].Is(lexer.Operator, "#"):
+			return i
+		case tokens[i].Is(lexer.Bracket, ")"), tokens[i].Is(lexer.Bracket, "]"):
+			open := matching(tokens, i)
+			if open < 0 {
+				return -1
+			}
+			// A call or an index, like foo() or foo[0], or a value in
+			// parentheses.
+			if open > 0 && (tokens[open-1].Is(lexer.Identifier) || tokens[open-1].Is(lexer.Bracket, ")") || tokens[open-1].Is(lexer.Bracket, "]")) {
+				i = open - 1
+				continue
+			}
+			if tokens[open].Is(lexer.Bracket, "(") {
+				return open
+			}
+			return -1
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+// matching returns the index of the bracket which opens the bracket at i.
+func matching(tokens []lexer.Token, i int) int {
+	depth := 0
+	for ; i >= 0; i-- {
+		switch {
+		case tokens[i].Is(lexer.Bracket, ")"), tokens[i].Is(lexer.Bracket, "]"), tokens[i].Is(lexer.Bracket, "}"):
+			depth++
+		case tokens[i].Is(lexer.Bracket, "("), tokens[i].Is(lexer.Bracket, "["), tokens[i].Is(lexer.Bracket, "{"):
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// all returns the fields, map keys and methods of the nature. Fields have
+// the kind, or Key if the nature is a map, and methods have Method.
+func all(n nature.Nature, kind Kind) []Candidate {
+	if n.Type == nil {
+		return nil
+	}
+	if kind == Field && deref.Type(n.Type).Kind() == reflect.Map {
+		kind = Key
+	}
+	var candidates []Candidate
+	for name, nt := range n.All() {
+		c := Candidate{Name: name, Kind: kind}
+		if nt.Method {
+			c.Kind = Method
+		}
+		if nt.Type != nil {
+			c.Type = nt.Type.String()
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates
+}
+
+func typeOf(fn *builtin.Function) string {
+	if len(fn.Types) > 0 {
+		return fn.Types[0].String()
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package complete_test
+
+import (
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/complete"
+	"github.com/expr-lang/expr/conf"
+	"github.com/expr-lang/expr/types"
+)
+
+type Address struct {
+	City    string
+	Country string
+}
+
+type User struct {
+	Name    string
+	Age     int
+	Address *Address
+	Tags    map[string]string
+}
+
+func (User) Greet(name string) string { return "hi " + name }
+
+type Env struct {
+	User     User
+	Users    []User
+	Settings map[string]any
+	Count    int
+}
+
+func newConfig(ops ...expr.Option) *conf.Config {
+	config := conf.New(Env{})
+	for _, op := range ops {
+		op(config)
+	}
+	return config
+}
+
+func names(candidates []complete.Candidate) []string {
+	var list []string
+	for _, c := range candidates {
+		list = append(list, c.Name)
+	}
+	return list
+}
+
+func TestComplete(t *testing.T) {
+	config := newConfig()
+
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{`Us`, []string{"User", "Users"}},
+		{`User.`, []string{"Address", "Age", "Greet", "Name", "Tags"}},
+		{`User.A`, []string{"Address", "Age"}},
+		{`User.Address.C`, []string{"City", "Country"}},
+		{`User?.Address?.Ci`, []string{"City"}},
+		{`Users[0].N`, []string{"Name"}},
+		{`(User).Na`, []string{"Name"}},
+		{`Count > 1 && Us`, []string{"User", "Users"}},
+		{`let total = 1; tot`, []string{"total"}},
+		{`upp`, []string{"upper"}},
+		{`"Us`, nil},
+		{`Unknown.`, nil},
+		{`$env.Us`, []string{"User", "Users"}},
+		{`map(Users, .`, []string{"Address", "Age", "Greet", "Name", "Tags"}},
+		{`map(Users, #.Na`, []string{"Name"}},
+		{`map(Users, .Address.C`, []string{"City", "Country"}},
+		{`filter(Users, u => u.A`, []string{"Address", "Age"}},
+		{`map(Users, (u, i) => i > 0 && u.N`, []string{"Name"}},
+		{`let u = User; u.Na`, []string{"Name"}},
+		{`let u = Users[0]; all(Users, .Age > u.A`, []string{"Address", "Age"}},
+		{`map(Users, [1, .Na`, []string{"Name"}},
+		{`Count > 0 ? User.Na`, []string{"Name"}},
+		{`.`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got := complete.Complete(tt.input, len([]rune(tt.input)), config)
+			assert.Equal(t, tt.want, names(got))
+		})
+	}
+}
+
+func TestComplete_kinds(t *testing.T) {
+	config := newConfig(expr.Function("double", func(params ...any) (any, error) {
+		return params[0].(int) * 2, nil
+	}, new(func(int) int)))
+
+	got := complete.Complete(`dou`, 3, config)
+	require.Len(t, got, 1)
+	assert.Equal(t, complete.Candidate{Name: "double", Kind: complete.Function, Type: "func(int) int"}, got[0])
+
+	got = complete.Complete(`User.Gr`, 7, config)
+	require.Len(t, got, 1)
+	assert.Equal(t, complete.Method, got[0].Kind)
+
+	got = complete.Complete(`User.Ag`, 7, config)
+	assert.Equal(t, []complete.Candidate{{Name: "Age", Kind: complete.Field, Type: "int"}}, got)
+
+	got = complete.Complete(`len`, 3, config)
+	require.NotEmpty(t, got)
+	assert.Equal(t, complete.Builtin, got[0].Kind)
+
+	got = complete.Complete(`Cou`, 3, config)
+	assert.Equal(t, []complete.Candidate{{Name: "Count", Kind: complete.Variable, Type: "int"}}, got)
+}
+
+func TestComplete_map_keys(t *testing.T) {
+	config := conf.New(types.Map{
+		"request": types.Map{"path": types.String, "method": types.String},
+	})
+
+	got := complete.Complete(`request.`, 8, config)
+	assert.Equal(t, []complete.Candidate{
+		{Name: "method", Kind: complete.Key, Type: "string"},
+		{Name: "path", Kind: complete.Key, Type: "string"},
+	}, got)
+}
+
+func TestComplete_cursor(t *testing.T) {
+	config := newConfig()
+
+	// Only the input before the cursor is used.
+	got := complete.Complete(`User.Na + 1`, 7, config)
+	assert.Equal(t, []string{"Name"}, names(got))
+
+	got = complete.Complete(`User.Name`, 100, config)
+	assert.Nil(t, got)
+}
@@ -1,12 +1,19 @@
 package conf
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"reflect"
+	"strings"
 
 	"github.com/expr-lang/expr/ast"
 	"github.com/expr-lang/expr/builtin"
 	"github.com/expr-lang/expr/checker/nature"
+	"github.com/expr-lang/expr/file"
+	"github.com/expr-lang/expr/parser/operator"
+	"github.com/expr-lang/expr/parser/utils"
 	"github.com/expr-lang/expr/vm/runtime"
 )
 
@@ -16,10 +23,50 @@ var (
 
 	// DefaultMaxNodes represents default maximum allowed AST nodes by the compiler.
 	DefaultMaxNodes uint = 1e4
+
+	// DefaultMaxSourceLength represents default maximum allowed length of the
+	// expression source in characters.
+	DefaultMaxSourceLength uint = 1e6
+
+	// DefaultMaxTokens represents default maximum allowed tokens produced by the lexer.
+	DefaultMaxTokens uint = 1e5
 )
 
 type FunctionsTable map[string]*builtin.Function
 
+// Interner deduplicates constant values shared between compiled programs.
+// See vm.InternPool for the default implementation.
+type Interner interface {
+	Intern(v any) any
+}
+
+// LiteralFunc constructs the value of a prefixed literal, like re"^a+$",
+// from the unescaped string following the prefix.
+type LiteralFunc func(value string) (any, error)
+
+// BytesLiterals are the literals of []byte values, registered in every
+// config: b"..." with the bytes of the string, where escapes like \xff are
+// single bytes, hex"..." with hex encoded bytes and b64"..." with standard
+// base64 encoded bytes.
+var BytesLiterals = map[string]LiteralFunc{
+	"b": func(value string) (any, error) {
+		return []byte(value), nil
+	},
+	"hex": func(value string) (any, error) {
+		return hex.DecodeString(value)
+	},
+	"b64": func(value string) (any, error) {
+		return base64.StdEncoding.DecodeString(value)
+	},
+}
+
+// CustomOperator is a user defined infix operator, like <=> or within.
+// Expressions using it are rewritten to calls of Function.
+type CustomOperator struct {
+	operator.Operator
+	Function string
+}
+
 type Config struct {
 	EnvObject any
 	Env       nature.Nature
@@ -28,27 +75,114 @@ type Config struct {
 	Optimize  bool
 	Strict    bool
 	Profile   bool
+	Coverage  bool // counts the ways taken by conditions, see vm.Branch
 	MaxNodes  uint
-	ConstFns  map[string]reflect.Value
-	Visitors  []ast.Visitor
-	Functions FunctionsTable
-	Builtins  FunctionsTable
-	Disabled  map[string]bool // disabled builtins
+	// MaxSourceLength and MaxTokens are checked by the lexer, before the
+	// parser allocates any nodes.
+	MaxSourceLength uint
+	MaxTokens       uint
+	ConstFns        map[string]reflect.Value
+	Visitors        []ast.Visitor
+	Functions       FunctionsTable
+	Builtins        FunctionsTable
+	Disabled        map[string]bool // disabled builtins
+	Interner        Interner        // shared pool for program constants
+	Logger          Logger          // diagnostics of parser, compiler and vm
+	// MaxParseDepth limits the nesting of expressions, like parentheses,
+	// arrays or predicates, so the recursion of the parser can not blow the
+	// stack. Zero, the default, does not limit the nesting.
+	MaxParseDepth uint
+	// MaxScopes limits the nesting of loops of builtins, like map or
+	// filter, when programs run, unless the vm.VM running them sets its
+	// own MaxScopes. Zero, the default, does not limit the nesting.
+	MaxScopes uint
+	// BuiltinProfile is the name of the set of builtins the expressions
+	// may call, set with WithBuiltinProfile, see builtin.Profiles.
+	BuiltinProfile string
+	// PurePredicates rejects calls of functions not listed in Pure
+	// inside predicates of builtins like all, filter or map.
+	PurePredicates bool
+	Pure           map[string]bool        // functions and methods without side effects
+	Costs          map[string]float64     // approximate costs of functions and methods
+	Quota          *Quota                 // limits validated during checker.ParseCheck
+	Literals       map[string]LiteralFunc // constructors of prefixed literals
+	DumpBytecode   io.Writer              // receives the bytecode listing of compiled programs
+	// NewlineSeparators makes newlines outside of brackets separate
+	// expressions of a sequence, like semicolons do.
+	NewlineSeparators bool
+	OperatorAliases   map[string]string         // localized synonyms of operators
+	CustomOperators   map[string]CustomOperator // user defined infix operators
+	// Namespaces groups functions under a name, like geo, so expressions
+	// call them as geo.distance(a, b) and they do not collide with other
+	// functions. The functions are named after the namespace, see Function.
+	Namespaces map[string]FunctionsTable
+	// NilOnMissing makes member access, like a.b or a[0], return nil for
+	// missing fields and keys, out of range indexes and nil pointers.
+	NilOnMissing bool
+	// NilOnOutOfRange makes indexing of arrays, slices and strings, like
+	// a[-10], return nil if the index is out of range.
+	NilOnOutOfRange bool
+	// CheckedArithmetic makes integer +, - and * fail with a runtime error
+	// on overflow, instead of wrapping around.
+	CheckedArithmetic bool
+	// Warnings receives suspicious but valid expressions found by the checker,
+	// like comparisons which are always true. WarningsAsErrors makes the
+	// first warning fail the compilation instead.
+	Warnings         func(warning *file.Error)
+	WarningsAsErrors bool
+	// DecimalMode parses float literals as exact decimals (*big.Rat), and
+	// carries out arithmetic with them without rounding.
+	DecimalMode bool
+	// FloatEpsilon makes == and != treat two floats as equal if they
+	// differ by at most FloatEpsilon. Zero keeps the exact comparison.
+	FloatEpsilon float64
+	// InjectContext hides the first parameter of env functions and methods
+	// taking a context.Context first: expressions call them without it, and
+	// the VM passes the context of vm.RunContext.
+	InjectContext bool
+	// Sensitive lists paths of env values, like "User.Email", which the
+	// checker allows only to be compared. Struct fields tagged with
+	// `sensitive:"true"` are sensitive too.
+	Sensitive map[string]bool
+	// Regexps limits the patterns of the matches operator and caches the
+	// compiled patterns which are not constants, see WithRegexLimits.
+	Regexps *runtime.Regexps
+	// FieldTags name the fields of structs without an expr tag, by the
+	// first of the tags they have, like json, see WithFieldTag.
+	FieldTags []string
+	// CaseInsensitiveFields resolves names of env values, fields of structs
+	// and keys of maps, like user.name, which differ only by case from one
+	// name, like Name, see CaseInsensitiveFields.
+	CaseInsensitiveFields bool
+	// StrictNil makes == and != compare nils like Go does: a value of type
+	// any holding a nil pointer is not nil, and nils of different types are
+	// not equal. By default, all nils are equal. The in operator compares
+	// the elements of arrays, and ?? its left operand, the same way.
+	StrictNil bool
 }
 
 // CreateNew creates new config with default values.
 func CreateNew() *Config {
 	c := &Config{
-		Optimize:  true,
-		MaxNodes:  DefaultMaxNodes,
-		ConstFns:  make(map[string]reflect.Value),
-		Functions: make(map[string]*builtin.Function),
-		Builtins:  make(map[string]*builtin.Function),
-		Disabled:  make(map[string]bool),
+		Optimize:        true,
+		MaxNodes:        DefaultMaxNodes,
+		MaxSourceLength: DefaultMaxSourceLength,
+		MaxTokens:       DefaultMaxTokens,
+		ConstFns:        make(map[string]reflect.Value),
+		Functions:       make(map[string]*builtin.Function),
+		Builtins:        make(map[string]*builtin.Function),
+		Disabled:        make(map[string]bool),
+		Logger:          NopLogger,
+		Pure:            make(map[string]bool),
+		Costs:           make(map[string]float64),
+		Literals:        make(map[string]LiteralFunc),
 	}
 	for _, f := range builtin.Builtins {
 		c.Builtins[f.Name] = f
 	}
+	for prefix, fn := range BytesLiterals {
+		c.Literals[prefix] = fn
+	}
 	return c
 }
 
@@ -76,6 +210,141 @@ func (c *Config) ConstExpr(name string) {
 	c.ConstFns[name] = fn
 }
 
+// OperatorAlias registers alias as a synonym of the operator. Aliases are
+// words, like "et" for "and" or "dans" for "in", and take precedence over
+// variables with the same name.
+func (c *Config) OperatorAlias(alias, op string) {
+	if !utils.IsValidIdentifier(alias) {
+		panic(fmt.Errorf("operator alias %q must be a valid identifier", alias))
+	}
+	_, binary := operator.Binary[op]
+	_, unary := operator.Unary[op]
+	_, custom := c.CustomOperators[op]
+	if !binary && !unary && !custom && op != "let" && op != "if" && op != "else" {
+		panic(fmt.Errorf("unknown operator %q for alias %q", op, alias))
+	}
+	if c.OperatorAliases == nil {
+		c.OperatorAliases = make(map[string]string)
+	}
+	c.OperatorAliases[alias] = op
+}
+
+// CustomOperator registers a new infix operator. The name is either a valid
+// identifier, like "within", or a sequence of symbols, like "<=>" or "~=".
+// Builtin operators can not be redefined, use operator overloading instead.
+// The first call also adds the visitor which rewrites the operators to calls
+// of their functions.
+func (c *Config) CustomOperator(name string, op CustomOperator) {
+	if !utils.IsValidIdentifier(name) && !isOperatorSymbol(name) {
+		panic(fmt.Errorf("custom operator %q must be a valid identifier or consist of symbols", name))
+	}
+	_, binary := operator.Binary[name]
+	_, unary := operator.Unary[name]
+	if binary || unary || name == "let" || name == "if" || name == "else" {
+		panic(fmt.Errorf("operator %q is already defined", name))
+	}
+	if op.Associativity != operator.Left && op.Associativity != operator.Right {
+		panic(fmt.Errorf("invalid associativity of custom operator %q", name))
+	}
+	if op.Function == "" {
+		panic(fmt.Errorf("no function is specified for custom operator %q", name))
+	}
+	if c.CustomOperators == nil {
+		c.CustomOperators = make(map[string]CustomOperator)
+		c.Visitors = append(c.Visitors, customOperators(c.CustomOperators))
+	}
+	c.CustomOperators[name] = op
+}
+
+// customOperators lowers the custom operators, like a <=> b, to calls of
+// their functions, like cmp(a, b). The calls are type checked as usual.
+type customOperators map[string]CustomOperator
+
+func (ops customOperators) Visit(node *ast.Node) {
+	binaryNode, ok := (*node).(*ast.BinaryNode)
+	if !ok {
+		return
+	}
+	op, ok := ops[binaryNode.Operator]
+	if !ok {
+		return
+	}
+	ast.Patch(node, &ast.CallNode{
+		Callee:    &ast.IdentifierNode{Value: op.Function},
+		Arguments: []ast.Node{binaryNode.Left, binaryNode.Right},
+	})
+}
+
+// WithBuiltinProfile allows only the builtins of the named profile, see
+// builtin.Profiles, and disables the others. Builtins enabled or disabled
+// afterwards, with EnableBuiltin or DisableBuiltin, adjust the profile.
+func (c *Config) WithBuiltinProfile(name string) {
+	names, ok := builtin.Profiles[name]
+	if !ok {
+		panic(fmt.Errorf("unknown builtin profile %q", name))
+	}
+	c.BuiltinProfile = name
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		allowed[name] = true
+	}
+	for _, fn := range builtin.Builtins {
+		if names == nil || allowed[fn.Name] {
+			delete(c.Disabled, fn.Name)
+		} else {
+			c.Disabled[fn.Name] = true
+		}
+	}
+}
+
+// Namespace registers the functions under the namespace name. They are
+// called as name.fn(...) and named "name.fn", so their names in programs,
+// costs and registries of serialized programs do not collide with other
+// functions.
+func (c *Config) Namespace(name string, functions FunctionsTable) {
+	if !utils.IsValidIdentifier(name) {
+		panic(fmt.Errorf("namespace %q must be a valid identifier", name))
+	}
+	if c.Namespaces == nil {
+		c.Namespaces = make(map[string]FunctionsTable)
+	}
+	ns, ok := c.Namespaces[name]
+	if !ok {
+		ns = make(FunctionsTable, len(functions))
+		c.Namespaces[name] = ns
+	}
+	for short, fn := range functions {
+		fn := *fn
+		fn.Name = name + "." + short
+		ns[short] = &fn
+	}
+}
+
+// Function returns the function of the name from Functions, or from
+// Namespaces for names like "geo.distance".
+func (c *Config) Function(name string) (*builtin.Function, bool) {
+	if fn, ok := c.Functions[name]; ok {
+		return fn, true
+	}
+	if ns, short, ok := strings.Cut(name, "."); ok {
+		fn, ok := c.Namespaces[ns][short]
+		return fn, ok
+	}
+	return nil, false
+}
+
+func isOperatorSymbol(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !strings.ContainsRune("!$%&*+-/<=>@^|~", r) {
+			return false
+		}
+	}
+	return true
+}
+
 type Checker interface {
 	Check()
 }
@@ -92,8 +361,21 @@ func (c *Config) IsOverridden(name string) bool {
 	if _, ok := c.Functions[name]; ok {
 		return true
 	}
-	if _, ok := c.Env.Get(name); ok {
+	if _, ok := c.Env.Get(name, c.FieldTags...); ok {
 		return true
 	}
 	return false
 }
+
+// CostOf returns the approximate cost of calling the function or the method
+// of the name, set with Costs or with the Cost of a function. It is zero if
+// the cost is unknown.
+func (c *Config) CostOf(name string) float64 {
+	if cost, ok := c.Costs[name]; ok {
+		return cost
+	}
+	if fn, ok := c.Function(name); ok {
+		return fn.Cost
+	}
+	return 0
+}
@@ -7,6 +7,7 @@ import (
 	. "github.com/expr-lang/expr/checker/nature"
 	"github.com/expr-lang/expr/internal/deref"
 	"github.com/expr-lang/expr/types"
+	"github.com/expr-lang/expr/vm/runtime"
 )
 
 // Env 将任意类型的 env 转换为对应的 Nature 类型描述。
@@ -17,6 +18,7 @@ import (
 //	types.Map → 直接转换
 //	struct → 记录类型，延迟字段解析（用 All()）
 //	map → 遍历 key/value，把每个 value 转成 Nature
+//	runtime.FieldResolver → 无类型，名字由 checker 逐个向 TypeOf 查询
 //	其它类型 → panic
 //
 // 示例：
@@ -76,6 +78,11 @@ func Env(env any) Nature {
 	switch env := env.(type) {
 	case types.Map:
 		return env.Nature()
+	case runtime.FieldResolver:
+		// The names are resolved one by one, see checker.ident. Only
+		// resolvers which know their names are strict.
+		_, strict := env.(runtime.FieldTyper)
+		return Nature{Strict: strict}
 	}
 
 	v := reflect.ValueOf(env)
@@ -0,0 +1,91 @@
+package conf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	. "github.com/expr-lang/expr/checker/nature"
+)
+
+// Fingerprint returns a hash of the env schema: names, types, field order and
+// method sets of everything reachable from the env. Programs compiled against
+// envs with the same fingerprint are interchangeable, as compiled field and
+// method indexes stay valid.
+func Fingerprint(env any) string {
+	var sb strings.Builder
+	describeNature(&sb, Env(env), map[reflect.Type]bool{})
+	sum := sha256.Sum256([]byte(sb.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+func describeNature(sb *strings.Builder, n Nature, seen map[reflect.Type]bool) {
+	if n.Nil {
+		sb.WriteString("nil")
+		return
+	}
+	if n.Fields != nil {
+		keys := make([]string, 0, len(n.Fields))
+		for key := range n.Fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		sb.WriteString("{")
+		for _, key := range keys {
+			fmt.Fprintf(sb, "%q:", key)
+			describeNature(sb, n.Fields[key], seen)
+			sb.WriteString(";")
+		}
+		sb.WriteString("}")
+		return
+	}
+	describeType(sb, n.Type, seen)
+}
+
+func describeType(sb *strings.Builder, t reflect.Type, seen map[reflect.Type]bool) {
+	if t == nil {
+		sb.WriteString("any")
+		return
+	}
+	sb.WriteString(t.PkgPath())
+	sb.WriteString(".")
+	sb.WriteString(t.String())
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+
+	if t.NumMethod() > 0 && t.Kind() != reflect.Interface {
+		sb.WriteString("(")
+		for i := 0; i < t.NumMethod(); i++ {
+			m := t.Method(i)
+			fmt.Fprintf(sb, "%s %s;", m.Name, m.Type)
+		}
+		sb.WriteString(")")
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		sb.WriteString("{")
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			fmt.Fprintf(sb, "%s %q %v:", f.Name, f.Tag.Get("expr"), f.Anonymous)
+			describeType(sb, f.Type, seen)
+			sb.WriteString(";")
+		}
+		sb.WriteString("}")
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		sb.WriteString("<")
+		describeType(sb, t.Elem(), seen)
+		sb.WriteString(">")
+	case reflect.Map:
+		sb.WriteString("<")
+		describeType(sb, t.Key(), seen)
+		sb.WriteString(",")
+		describeType(sb, t.Elem(), seen)
+		sb.WriteString(">")
+	}
+}
@@ -0,0 +1,101 @@
+package conf
+
+import (
+	"log"
+)
+
+// Subsystem identifies the part of expr which produced a log record.
+type Subsystem uint8
+
+const (
+	LogParser Subsystem = iota
+	LogCompiler
+	LogVM
+)
+
+func (s Subsystem) String() string {
+	switch s {
+	case LogParser:
+		return "parser"
+	case LogCompiler:
+		return "compiler"
+	case LogVM:
+		return "vm"
+	}
+	return "unknown"
+}
+
+// Level is the severity of a log record.
+type Level int8
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "UNKNOWN"
+}
+
+// Logger receives diagnostic records from the parser, compiler and vm.
+//
+// Enabled is checked before a record is formatted, so a disabled subsystem
+// costs a single call per record.
+type Logger interface {
+	Enabled(subsystem Subsystem, level Level) bool
+	Logf(subsystem Subsystem, level Level, format string, args ...any)
+}
+
+// NopLogger discards all records. It is the default logger.
+var NopLogger Logger = nopLogger{}
+
+type nopLogger struct{}
+
+func (nopLogger) Enabled(Subsystem, Level) bool { return false }
+
+func (nopLogger) Logf(Subsystem, Level, string, ...any) {}
+
+// NewStdLogger returns a Logger which writes records of at least the given
+// level to l. If subsystems are given, only records of those subsystems are
+// written; otherwise all subsystems are enabled.
+func NewStdLogger(l *log.Logger, level Level, subsystems ...Subsystem) Logger {
+	s := &stdLogger{logger: l, level: level}
+	if len(subsystems) == 0 {
+		s.enabled = [LogVM + 1]bool{true, true, true}
+	}
+	for _, sub := range subsystems {
+		if sub <= LogVM {
+			s.enabled[sub] = true
+		}
+	}
+	return s
+}
+
+type stdLogger struct {
+	logger  *log.Logger
+	level   Level
+	enabled [LogVM + 1]bool
+}
+
+func (s *stdLogger) Enabled(subsystem Subsystem, level Level) bool {
+	return subsystem <= LogVM && s.enabled[subsystem] && level >= s.level
+}
+
+func (s *stdLogger) Logf(subsystem Subsystem, level Level, format string, args ...any) {
+	if !s.Enabled(subsystem, level) {
+		return
+	}
+	s.logger.Printf("[%s] %s "+format, append([]any{subsystem, level}, args...)...)
+}
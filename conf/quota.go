@@ -0,0 +1,18 @@
+package conf
+
+// Quota limits the size and the features of expressions, for example to
+// enforce per-tenant limits in a multi-tenant host. Zero values mean no limit.
+type Quota struct {
+	MaxNodes      uint     // maximum number of AST nodes
+	MaxPredicates uint     // maximum number of predicates ({...} closures)
+	MaxRegexes    uint     // maximum number of `matches` operators and regexp builtins, like splitRegex
+	Builtins      []string // allowed builtins, nil allows all of them
+}
+
+// Violation codes reported by the checker when a Quota is exceeded.
+const (
+	QuotaMaxNodes      = "max_nodes"
+	QuotaMaxPredicates = "max_predicates"
+	QuotaMaxRegexes    = "max_regexes"
+	QuotaBuiltin       = "builtin_not_allowed"
+)
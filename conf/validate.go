@@ -0,0 +1,139 @@
+package conf
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/expr-lang/expr/builtin"
+	"github.com/expr-lang/expr/parser/operator"
+)
+
+// ValidationError is returned by Validate. It lists all problems of the
+// config, not only the first one.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate reports mistakes in the config, which otherwise surface as
+// panics of Check or as errors of the first compilation, like operator
+// overloads of missing functions or custom operators calling disabled
+// builtins. It returns nil or a *ValidationError.
+func (c *Config) Validate() error {
+	v := &validator{}
+	for _, visitor := range c.Visitors {
+		if checker, ok := visitor.(Checker); ok {
+			v.check(checker)
+		}
+	}
+
+	for _, name := range sortedNames(c.Disabled) {
+		if c.Disabled[name] && !isBuiltin(name) {
+			v.add("disabled builtin %q does not exist", name)
+		}
+	}
+
+	for _, name := range sortedNames(c.CustomOperators) {
+		fn := c.CustomOperators[name].Function
+		switch {
+		case c.Disabled[fn] && !c.isFunction(fn):
+			v.add("custom operator %q calls disabled builtin %q", name, fn)
+		case c.Strict && !c.isFunction(fn) && !isBuiltin(fn):
+			v.add("function %q of custom operator %q does not exist", fn, name)
+		}
+	}
+
+	for _, alias := range sortedNames(c.OperatorAliases) {
+		op := c.OperatorAliases[alias]
+		_, binary := operator.Binary[op]
+		_, unary := operator.Unary[op]
+		_, custom := c.CustomOperators[op]
+		if !binary && !unary && !custom && op != "let" && op != "if" && op != "else" {
+			v.add("unknown operator %q for alias %q", op, alias)
+		}
+	}
+
+	if c.Quota != nil {
+		for _, name := range c.Quota.Builtins {
+			if !isBuiltin(name) {
+				v.add("builtin %q allowed by quota does not exist", name)
+			} else if c.Disabled[name] {
+				v.add("builtin %q allowed by quota is disabled", name)
+			}
+		}
+	}
+	for _, name := range sortedNames(c.Pure) {
+		if c.Disabled[name] && !c.isFunction(name) {
+			v.add("pure function %q is a disabled builtin", name)
+		}
+	}
+	for _, name := range sortedNames(c.Costs) {
+		if c.Disabled[name] && !c.isFunction(name) {
+			v.add("cost of %q is set, but it is a disabled builtin", name)
+		}
+	}
+
+	for _, name := range sortedNames(c.Namespaces) {
+		if _, ok := c.Env.Get(name, c.FieldTags...); ok {
+			v.add("namespace %q hides the env value of the same name", name)
+		}
+	}
+
+	if c.Expect == reflect.Interface && !c.ExpectAny {
+		// WarnOnAny rejects results of unknown type, which are the only
+		// ones of the interface kind.
+		v.add("expected kind %v conflicts with WarnOnAny", c.Expect)
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) add(format string, args ...any) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// check runs the Check of a patcher, which panics on errors.
+func (v *validator) check(checker Checker) {
+	defer func() {
+		if r := recover(); r != nil {
+			v.add("%v", r)
+		}
+	}()
+	checker.Check()
+}
+
+// isFunction reports whether name is a function of the functions table or
+// of the env.
+func (c *Config) isFunction(name string) bool {
+	if _, ok := c.Function(name); ok {
+		return true
+	}
+	nt, ok := c.Env.Get(name, c.FieldTags...)
+	return ok && nt.Type != nil && nt.Type.Kind() == reflect.Func
+}
+
+func isBuiltin(name string) bool {
+	_, ok := builtin.Index[name]
+	return ok
+}
+
+func sortedNames[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
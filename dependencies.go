@@ -0,0 +1,92 @@
+package expr
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/checker"
+	"github.com/expr-lang/expr/vm"
+)
+
+// DependencySet holds the values an expression reads from its env and the
+// functions it calls. Rule platforms use them to validate expressions
+// against the available data and to prefetch it.
+type DependencySet struct {
+	Identifiers []string // Variables of the env, like "user".
+	Paths       []string // Longest chains of fields read from the env, like "user.Address.City".
+	Functions   []string // Functions, methods and builtins called, like "len" or "user.Greet".
+}
+
+// Dependencies returns the dependencies of the program, sorted.
+// Variables declared with let and parameters of functions defined in the
+// expression are not dependencies, but the values of the env they hold
+// are. A chain of fields ends at an index or a field which is not a
+// constant, like user.Tags[i], and at a method. Only the longest chains
+// are kept: user is not a path if user.Name is, even if the expression
+// reads user as a whole, like let u = user; u.Name.
+//
+// Dependencies are the accesses found by checker.WalkAccesses in the tree
+// of the program, like those of Audit, so constants folded by the
+// optimizer, like those of ConstExpr functions, are not reported.
+func Dependencies(program *vm.Program) DependencySet {
+	identifiers := map[string]bool{}
+	paths := map[string]bool{}
+	functions := map[string]bool{}
+	env := func(path string) {
+		// Paths of accesses go on after indexes, like Tags[].Name.
+		path, _, _ = strings.Cut(path, "[]")
+		if path == "" || path == "$env" {
+			return
+		}
+		name, _, _ := strings.Cut(path, ".")
+		identifiers[name] = true
+		paths[path] = true
+	}
+	checker.WalkAccesses(program.Node(), func(access checker.Access, node ast.Node) {
+		switch access.Kind {
+		case checker.AccessField:
+			env(access.Path)
+		case checker.AccessFunction:
+			if node.Nature().Func != nil {
+				functions[access.Path] = true
+			} else {
+				// A function held by the env.
+				env(access.Path)
+			}
+		case checker.AccessMethod:
+			// The receiver is reported as a field, if it is a value of
+			// the env.
+			functions[access.Path] = true
+		case checker.AccessBuiltin:
+			functions[access.Path] = true
+		}
+	})
+	for path := range paths {
+		for prefix := path; ; {
+			i := strings.LastIndexByte(prefix, '.')
+			if i < 0 {
+				break
+			}
+			prefix = prefix[:i]
+			delete(paths, prefix)
+		}
+	}
+	return DependencySet{
+		Identifiers: sortedKeys(identifiers),
+		Paths:       sortedKeys(paths),
+		Functions:   sortedKeys(functions),
+	}
+}
+
+func sortedKeys(set map[string]bool) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,110 @@
+package expr_test
+
+import (
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+)
+
+type depsAddress struct {
+	City string
+}
+
+type depsUser struct {
+	Name    string
+	Address depsAddress
+	Tags    []string
+}
+
+func (depsUser) Greet(s string) string { return "hi " + s }
+
+type depsEnv struct {
+	User  depsUser
+	Users []depsUser
+	Limit int
+	Index int
+	Fn    func(int) int
+}
+
+func TestDependencies(t *testing.T) {
+	double := expr.Function("double", func(params ...any) (any, error) {
+		return params[0].(int) * 2, nil
+	}, new(func(int) int))
+
+	tests := []struct {
+		code string
+		want expr.DependencySet
+	}{
+		{
+			`User.Address.City == "Paris" && Limit > 0`,
+			expr.DependencySet{
+				Identifiers: []string{"Limit", "User"},
+				Paths:       []string{"Limit", "User.Address.City"},
+			},
+		},
+		{
+			`User.Tags[Index] + User.Greet(User.Name)`,
+			expr.DependencySet{
+				Identifiers: []string{"Index", "User"},
+				Paths:       []string{"Index", "User.Name", "User.Tags"},
+				Functions:   []string{"User.Greet"},
+			},
+		},
+		{
+			`let x = Limit; filter(Users, .Name != "" && x > 0) | map(double(len(.Tags)))`,
+			expr.DependencySet{
+				Identifiers: []string{"Limit", "Users"},
+				Paths:       []string{"Limit", "Users"},
+				Functions:   []string{"double", "filter", "len", "map"},
+			},
+		},
+		{
+			`let f = (n) => n + Limit; f(Fn(Index))`,
+			expr.DependencySet{
+				Identifiers: []string{"Fn", "Index", "Limit"},
+				Paths:       []string{"Fn", "Index", "Limit"},
+			},
+		},
+		{
+			`let u = User; u.Address.City + u.Greet(Users[Index].Name)`,
+			expr.DependencySet{
+				Identifiers: []string{"Index", "User", "Users"},
+				Paths:       []string{"Index", "User.Address.City", "Users"},
+				Functions:   []string{"User.Greet"},
+			},
+		},
+		{
+			`let u = User; u.Address.City`,
+			expr.DependencySet{
+				Identifiers: []string{"User"},
+				Paths:       []string{"User.Address.City"},
+			},
+		},
+		{
+			`User.Greet("x")`,
+			expr.DependencySet{
+				Identifiers: []string{"User"},
+				Paths:       []string{"User"},
+				Functions:   []string{"User.Greet"},
+			},
+		},
+		{
+			`$env.User?.Address.City ?? $env["Limit"]`,
+			expr.DependencySet{
+				Identifiers: []string{"Limit", "User"},
+				Paths:       []string{"Limit", "User.Address.City"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(depsEnv{}), double)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, expr.Dependencies(program))
+		})
+	}
+}
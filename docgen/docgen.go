@@ -75,6 +75,9 @@ var (
 
 		"now":      {Kind: "func", Return: &Type{Name: "time.Time", Kind: "struct"}},
 		"duration": {Kind: "func", Arguments: []*Type{{Kind: "string"}}, Return: &Type{Kind: "time.Duration"}},
+
+		"envKeys": {Kind: "func", Return: &Type{Kind: "array", Type: &Type{Kind: "string"}}},
+		"envHas":  {Kind: "func", Arguments: []*Type{{Name: "name", Kind: "string"}}, Return: &Type{Kind: "bool"}},
 	}
 )
 
@@ -1,8 +1,10 @@
 package expr
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"time"
 
@@ -14,18 +16,35 @@ import (
 	"github.com/expr-lang/expr/file"
 	"github.com/expr-lang/expr/optimizer"
 	"github.com/expr-lang/expr/parser"
+	"github.com/expr-lang/expr/parser/operator"
 	"github.com/expr-lang/expr/patcher"
 	"github.com/expr-lang/expr/vm"
+	"github.com/expr-lang/expr/vm/runtime"
 )
 
 // Option for configuring config.
 type Option func(c *conf.Config)
 
+// FieldResolver is an env which resolves its names lazily, when the
+// expression reads them, instead of materializing all the values up front.
+// Passed to Env, the names of the expression are loaded with its Resolve.
+type FieldResolver = runtime.FieldResolver
+
+// FieldTyper is implemented by a FieldResolver which knows the types of its
+// names. Without it, the names of a FieldResolver are of unknown type and
+// the checker does not report unknown names.
+type FieldTyper = runtime.FieldTyper
+
+// RegexLimits bounds the patterns of the matches operator, see
+// WithRegexLimits.
+type RegexLimits = runtime.RegexLimits
+
 // Env specifies expected input of env for type checks.
 // If struct is passed, all fields will be treated as variables,
 // as well as all fields of embedded structs and struct itself.
 // If map is passed, all items will be treated as variables.
 // Methods defined on this type will be available as functions.
+// If a FieldResolver is passed, its names are resolved lazily.
 func Env(env any) Option {
 	return func(c *conf.Config) {
 		c.WithEnv(env)
@@ -53,6 +72,32 @@ func Operator(operator string, fn ...string) Option {
 	}
 }
 
+// OperatorAlias registers a word as a synonym of an operator, for rules
+// written in other languages. For example, OperatorAlias("et", "and") and
+// OperatorAlias("dans", "in") allow `x dans [1, 2] et y`.
+func OperatorAlias(alias, operator string) Option {
+	return func(c *conf.Config) {
+		c.OperatorAlias(alias, operator)
+	}
+}
+
+// CustomOperator registers a new infix operator, like "<=>", "~=" or
+// "within", which calls fn with its operands. Precedence follows the
+// builtin operators, for example 20 for comparisons and 30 for + and -.
+//
+//	expr.CustomOperator("within", "Within", 20, operator.Left)
+func CustomOperator(name, fn string, precedence int, associativity operator.Associativity) Option {
+	return func(c *conf.Config) {
+		c.CustomOperator(name, conf.CustomOperator{
+			Operator: operator.Operator{
+				Precedence:    precedence,
+				Associativity: associativity,
+			},
+			Function: fn,
+		})
+	}
+}
+
 // ConstExpr defines func expression as constant. If all argument to this function is constants,
 // then it can be replaced by result of this func call on compile step.
 func ConstExpr(fn string) Option {
@@ -61,6 +106,54 @@ func ConstExpr(fn string) Option {
 	}
 }
 
+// PurePredicates makes the checker reject calls of non-pure functions inside
+// predicates of builtins like all, any, filter or map, so predicates can be
+// reordered and retried safely. Functions and methods are pure if they are
+// listed with Pure or defined with ConstExpr. Functions used by Operator
+// overloading inside predicates must be listed too.
+func PurePredicates() Option {
+	return func(c *conf.Config) {
+		c.PurePredicates = true
+	}
+}
+
+// Pure marks functions and methods (by method name) as free of side effects.
+func Pure(names ...string) Option {
+	return func(c *conf.Config) {
+		for _, name := range names {
+			c.Pure[name] = true
+		}
+	}
+}
+
+// Cost sets the approximate cost of calling a function, a method (by method
+// name) or a func field of the env, for example in nanoseconds. The optimizer
+// moves operands of `and`/`or` chains which call costly functions after the
+// cheaper ones, so the costly calls are skipped whenever a cheaper operand
+// decides the result. Functions with a cost must be free of side effects.
+func Cost(name string, cost float64) Option {
+	return func(c *conf.Config) {
+		c.Costs[name] = cost
+	}
+}
+
+// Sensitive marks values of the env, like "User.Email", as sensitive: the
+// expression can compare them, but can not return them, or values computed
+// from them, nor pass them to builtins which build strings, like upper.
+// Struct fields tagged with `sensitive:"true"` are sensitive too. A path
+// ending at a struct field marks that field of all values of the struct type,
+// like `sensitive:"true"` does, wherever they are read from.
+func Sensitive(paths ...string) Option {
+	return func(c *conf.Config) {
+		if c.Sensitive == nil {
+			c.Sensitive = make(map[string]bool)
+		}
+		for _, path := range paths {
+			c.Sensitive[path] = true
+		}
+	}
+}
+
 // AsAny tells the compiler to expect any result.
 func AsAny() Option {
 	return func(c *conf.Config) {
@@ -154,6 +247,24 @@ func Function(name string, fn func(params ...any) (any, error), types ...any) Op
 	}
 }
 
+// Namespace groups functions, defined with Function, under the name, so
+// expressions call them as name.fn(...) and they do not collide with other
+// functions or builtins of the same name. In costs and in registries of
+// serialized programs, the functions are named "name.fn".
+//
+//	expr.Namespace("geo",
+//		expr.Function("distance", distance, new(func(Point, Point) float64)),
+//	)
+func Namespace(name string, functions ...Option) Option {
+	return func(c *conf.Config) {
+		ns := conf.CreateNew()
+		for _, fn := range functions {
+			fn(ns)
+		}
+		c.Namespace(name, ns.Functions)
+	}
+}
+
 // DisableAllBuiltins disables all builtins.
 func DisableAllBuiltins() Option {
 	return func(c *conf.Config) {
@@ -177,6 +288,18 @@ func EnableBuiltin(name string) Option {
 	}
 }
 
+// BuiltinProfile allows expressions to call only the builtins of the named
+// profile, like "minimal", "strings" or "full", see builtin.Profiles. Calls
+// of other builtins fail to compile. Follow it with EnableBuiltin and
+// DisableBuiltin to allow or deny more builtins.
+//
+//	expr.BuiltinProfile("strings"), expr.EnableBuiltin("now")
+func BuiltinProfile(name string) Option {
+	return func(c *conf.Config) {
+		c.WithBuiltinProfile(name)
+	}
+}
+
 // WithContext passes context to all functions calls with a context.Context argument.
 func WithContext(name string) Option {
 	return Patch(patcher.WithContext{
@@ -184,6 +307,18 @@ func WithContext(name string) Option {
 	})
 }
 
+// InjectContext makes env functions and methods taking a context.Context
+// first, like func(ctx context.Context, id int) (User, error), callable
+// without the context: fetchUser(42). The context of vm.RunContext, or
+// context.Background() for Run, is passed to them. Unlike WithContext, the
+// env needs no variable holding the context, and the two should not be
+// combined.
+func InjectContext() Option {
+	return func(c *conf.Config) {
+		c.InjectContext = true
+	}
+}
+
 // Timezone sets default timezone for date() and now() builtin functions.
 func Timezone(name string) Option {
 	tz, err := time.LoadLocation(name)
@@ -204,8 +339,273 @@ func MaxNodes(n uint) Option {
 	}
 }
 
+// MaxSourceLength sets the maximum length of the expression in characters.
+// By default, the maximum length is conf.DefaultMaxSourceLength.
+// If MaxSourceLength is set to 0, the length check is disabled.
+func MaxSourceLength(n uint) Option {
+	return func(c *conf.Config) {
+		c.MaxSourceLength = n
+	}
+}
+
+// MaxTokens sets the maximum number of tokens allowed in the expression.
+// Unlike MaxNodes, it is checked while lexing, so inputs like long runs of
+// unary operators or semicolons are rejected before parsing.
+// By default, the maximum number of tokens is conf.DefaultMaxTokens.
+// If MaxTokens is set to 0, the token check is disabled.
+func MaxTokens(n uint) Option {
+	return func(c *conf.Config) {
+		c.MaxTokens = n
+	}
+}
+
+// MaxParseDepth sets the maximum nesting of expressions, like parentheses,
+// arrays, calls or predicates, so deeply nested inputs fail to compile
+// instead of exhausting the stack of the parser.
+// By default, or if MaxParseDepth is set to 0, the depth is not limited.
+func MaxParseDepth(n uint) Option {
+	return func(c *conf.Config) {
+		c.MaxParseDepth = n
+	}
+}
+
+// MaxScopes sets the maximum nesting of loops of builtins, like map or
+// filter, when the program runs, unless the vm.VM running it sets its own
+// MaxScopes. By default, or if MaxScopes is set to 0, the nesting is not
+// limited.
+func MaxScopes(n uint) Option {
+	return func(c *conf.Config) {
+		c.MaxScopes = n
+	}
+}
+
+// Literal registers a prefixed string literal, like re"^a+$" or
+// d"2024-01-01". The constructor is called at compile time with the
+// unescaped string and its result is embedded into the program as a
+// constant, typed by its Go type.
+func Literal(prefix string, fn func(value string) (any, error)) Option {
+	return func(c *conf.Config) {
+		c.Literals[prefix] = fn
+	}
+}
+
+// WithBytecodeDump writes the bytecode listing of every compiled program,
+// with constants and functions, to w. Useful for diagnostics.
+func WithBytecodeDump(w io.Writer) Option {
+	return func(c *conf.Config) {
+		c.DumpBytecode = w
+	}
+}
+
+// Warnings registers a function which receives warnings of the checker about
+// suspicious but valid expressions, like len(x) >= 0 or x == x, with their
+// location in the source.
+func Warnings(fn func(warning *file.Error)) Option {
+	return func(c *conf.Config) {
+		c.Warnings = fn
+	}
+}
+
+// WarningsAsErrors makes checker warnings, see Warnings, fail the compilation.
+func WarningsAsErrors() Option {
+	return func(c *conf.Config) {
+		c.WarningsAsErrors = true
+	}
+}
+
+// WithNilOnMissing makes member access return nil instead of an error, if a
+// field or key is missing, an index is out of range or a pointer on the way
+// is nil, like the get() builtin does.
+func WithNilOnMissing() Option {
+	return func(c *conf.Config) {
+		c.NilOnMissing = true
+	}
+}
+
+// WithNilOnOutOfRange makes an out of range index, like items[10] or
+// items[-10], return nil instead of an error, like the get() builtin does.
+// Unlike WithNilOnMissing, missing fields and keys and nil pointers are
+// still reported.
+func WithNilOnOutOfRange() Option {
+	return func(c *conf.Config) {
+		c.NilOnOutOfRange = true
+	}
+}
+
+// CheckedArithmetic makes integer addition, subtraction, multiplication and
+// negation fail with a runtime error on overflow, instead of wrapping around.
+// Overflow of constant expressions is reported at compile time.
+func CheckedArithmetic() Option {
+	return func(c *conf.Config) {
+		c.CheckedArithmetic = true
+	}
+}
+
+// Coverage makes the program count the times each way of its conditions is
+// taken: ternaries, &&, ||, ?? and predicates of builtins like filter or all.
+// The counters of all runs are returned by program.Coverage().
+func Coverage() Option {
+	return func(c *conf.Config) {
+		c.Coverage = true
+	}
+}
+
+// WithDecimal enables decimal mode: float literals, like 0.1, become exact
+// decimals (*big.Rat), and arithmetic and comparison with them is exact.
+// Numbers from the env are converted to decimals when combined with them.
+func WithDecimal() Option {
+	return func(c *conf.Config) {
+		c.DecimalMode = true
+	}
+}
+
+// FloatEpsilon makes == and != compare two floats with the given tolerance,
+// so 0.1 + 0.2 == 0.3 is true. Other values are compared exactly.
+func FloatEpsilon(epsilon float64) Option {
+	return func(c *conf.Config) {
+		c.FloatEpsilon = epsilon
+	}
+}
+
+// StrictNil makes == and != compare nils like Go does. A nil pointer, slice
+// or map of the env equals nil, but a value of type any holding one does not,
+// and nils of different types are not equal. By default, all nils are equal.
+// The in and ?? operators find nils the same way.
+func StrictNil() Option {
+	return func(c *conf.Config) {
+		c.StrictNil = true
+	}
+}
+
+// NewlineSeparators makes newlines outside of brackets act as semicolons,
+// so multi-line rules do not need explicit separators. A line which ends or
+// starts with a binary operator continues the previous expression.
+func NewlineSeparators() Option {
+	return func(c *conf.Config) {
+		c.NewlineSeparators = true
+	}
+}
+
+// InternPool makes compiled programs share string and small integer
+// constants through the given pool (usually a vm.InternPool shared by all
+// programs of a rule set).
+func InternPool(pool conf.Interner) Option {
+	return func(c *conf.Config) {
+		c.Interner = pool
+	}
+}
+
+// Logger sets the logger for diagnostics of the parser, the compiler and the
+// runs of the program, unless the vm.VM running it has its own. By default,
+// nothing is logged.
+func Logger(logger conf.Logger) Option {
+	return func(c *conf.Config) {
+		if logger == nil {
+			logger = conf.NopLogger
+		}
+		c.Logger = logger
+	}
+}
+
+// WithQuota limits the size and the features of the expression. Violations
+// are reported as *checker.QuotaError with machine-readable codes.
+func WithQuota(quota *conf.Quota) Option {
+	return func(c *conf.Config) {
+		c.Quota = quota
+	}
+}
+
+// WithRegexLimits bounds the patterns of the matches operator. Constant
+// patterns exceeding MaxLength or MaxSize fail the compilation, other
+// patterns and matches exceeding MaxSteps fail the run. Patterns which are
+// not constants are compiled once and cached, up to CacheSize of them.
+func WithRegexLimits(limits RegexLimits) Option {
+	return func(c *conf.Config) {
+		c.Regexps = runtime.NewRegexps(limits)
+	}
+}
+
+// WithFieldTag names the fields of structs without an expr tag by the first
+// of the tags they have, in order, like WithFieldTag("json"), so envs of
+// structs decoded from JSON are read by their JSON names, like
+// user.first_name. Options after a comma in the tags are ignored, and fields
+// tagged "-" keep their Go names. The expr tag takes precedence.
+func WithFieldTag(tags ...string) Option {
+	return func(c *conf.Config) {
+		c.FieldTags = tags
+	}
+}
+
+// CaseInsensitiveFields resolves names of env values, fields of structs and
+// string keys of maps case-insensitively if there is no exact match, so
+// user.name reads the field Name. Names which differ only by case from
+// several fields or keys, like Name and NAME, are ambiguous and fail the
+// compilation, or the run for values not known at compile time.
+func CaseInsensitiveFields() Option {
+	return func(c *conf.Config) {
+		c.CaseInsensitiveFields = true
+	}
+}
+
 // Compile parses and compiles given input expression to bytecode program.
 func Compile(input string, ops ...Option) (*vm.Program, error) {
+	return CompileContext(context.Background(), input, ops...)
+}
+
+// CompileContext compiles input like Compile, aborting once ctx is canceled
+// or its deadline is exceeded. Every pass checks ctx while it runs, so a
+// compilation of a large expression stops soon after ctx is done, returning
+// the error of ctx.
+func CompileContext(ctx context.Context, input string, ops ...Option) (*vm.Program, error) {
+	config := newConfig(ops)
+
+	tree, err := checker.ParseCheckContext(ctx, input, config)
+	if err != nil {
+		return nil, err
+	}
+	return compile(ctx, tree, config)
+}
+
+// Audit parses and checks the input like Compile, and reports the env
+// fields, methods, functions and builtins it touches, with their locations,
+// for reviews of expressions of untrusted users. See checker.Audit.
+func Audit(input string, ops ...Option) (*checker.AccessReport, error) {
+	config := newConfig(ops)
+	tree, err := checker.ParseCheck(input, config)
+	if err != nil {
+		return nil, err
+	}
+	return checker.Audit(tree), nil
+}
+
+// Validate reports all mistakes in the options at once, as a
+// *conf.ValidationError, instead of the panic or compilation error of the
+// first one. Options which panic, like OperatorAlias of an unknown operator,
+// are reported too.
+func Validate(ops ...Option) error {
+	config := conf.CreateNew()
+	var problems []string
+	for _, op := range ops {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					problems = append(problems, fmt.Sprint(r))
+				}
+			}()
+			op(config)
+		}()
+	}
+	err := config.Validate()
+	if err == nil && len(problems) == 0 {
+		return nil
+	}
+	if err, ok := err.(*conf.ValidationError); ok {
+		problems = append(problems, err.Problems...)
+	}
+	return &conf.ValidationError{Problems: problems}
+}
+
+func newConfig(ops []Option) *conf.Config {
 	config := conf.CreateNew()
 	for _, op := range ops {
 		op(config)
@@ -214,14 +614,13 @@ func Compile(input string, ops ...Option) (*vm.Program, error) {
 		delete(config.Builtins, name)
 	}
 	config.Check()
+	return config
+}
 
-	tree, err := checker.ParseCheck(input, config)
-	if err != nil {
-		return nil, err
-	}
-
+// compile optimizes and compiles a checked tree.
+func compile(ctx context.Context, tree *parser.Tree, config *conf.Config) (*vm.Program, error) {
 	if config.Optimize {
-		err = optimizer.Optimize(&tree.Node, config)
+		err := optimizer.OptimizeContext(ctx, &tree.Node, config)
 		if err != nil {
 			var fileError *file.Error
 			if errors.As(err, &fileError) {
@@ -231,7 +630,7 @@ func Compile(input string, ops ...Option) (*vm.Program, error) {
 		}
 	}
 
-	program, err := compiler.Compile(tree, config)
+	program, err := compiler.CompileContext(ctx, tree, config)
 	if err != nil {
 		return nil, err
 	}
@@ -244,6 +643,18 @@ func Run(program *vm.Program, env any) (any, error) {
 	return vm.Run(program, env)
 }
 
+// RunContext evaluates given bytecode program, aborting it once ctx is
+// canceled or its deadline is exceeded.
+func RunContext(ctx context.Context, program *vm.Program, env any) (any, error) {
+	return vm.RunContext(ctx, program, env)
+}
+
+// Replay runs given bytecode program with the env values recorded in a
+// snapshot. See vm.Snapshot.
+func Replay(program *vm.Program, snapshot *vm.Snapshot) (any, error) {
+	return vm.Replay(program, snapshot)
+}
+
 // Eval parses, compiles and runs given input.
 func Eval(input string, env any) (any, error) {
 	if _, ok := env.(Option); ok {
@@ -267,3 +678,35 @@ func Eval(input string, env any) (any, error) {
 
 	return output, nil
 }
+
+// Revalidation is the result of checking a bundled program against the
+// current env schema.
+type Revalidation struct {
+	Name    string
+	Program *vm.Program // program safe to run with the current env, nil if Err is set
+	Err     error       // why the program is incompatible with the current env
+}
+
+// Revalidate checks programs of the bundle against the env given with the Env
+// option. If the env schema fingerprint differs from the one of the bundle,
+// every program is recompiled from its source with the given options, so
+// stale field indexes are never used and incompatible programs are reported
+// upfront instead of failing at runtime.
+func Revalidate(bundle *vm.Bundle, ops ...Option) []Revalidation {
+	config := conf.CreateNew()
+	for _, op := range ops {
+		op(config)
+	}
+	compatible := bundle.Fingerprint == conf.Fingerprint(config.EnvObject)
+
+	results := make([]Revalidation, 0, len(bundle.Names))
+	for _, name := range bundle.Names {
+		program, _ := bundle.Program(name)
+		r := Revalidation{Name: name, Program: program}
+		if !compatible {
+			r.Program, r.Err = Compile(program.Source().String(), ops...)
+		}
+		results = append(results, r)
+	}
+	return results
+}
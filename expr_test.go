@@ -1,11 +1,16 @@
 package expr_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
+	"math"
+	"math/big"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -15,10 +20,14 @@ import (
 	"github.com/expr-lang/expr/internal/testify/require"
 	"github.com/expr-lang/expr/types"
 	"github.com/expr-lang/expr/vm"
+	"github.com/expr-lang/expr/vm/runtime"
 
 	"github.com/expr-lang/expr"
 	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/checker"
 	"github.com/expr-lang/expr/file"
+	"github.com/expr-lang/expr/parser"
+	"github.com/expr-lang/expr/parser/operator"
 	"github.com/expr-lang/expr/test/mock"
 )
 
@@ -629,6 +638,39 @@ func ExampleWithContext() {
 	// Output: 42
 }
 
+func ExampleInjectContext() {
+	env := map[string]any{
+		"fn": func(ctx context.Context, a, b int) (int, error) {
+			if err := ctx.Err(); err != nil {
+				return 0, err
+			}
+			return a + b, nil
+		},
+	}
+
+	program, err := expr.Compile(`fn(1, 2)`,
+		expr.Env(env),
+		expr.InjectContext(), // fn is called without its context.
+	)
+	if err != nil {
+		fmt.Printf("%v", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	output, err := expr.RunContext(ctx, program, env)
+	fmt.Println(output, err)
+
+	cancel()
+	_, err = expr.RunContext(ctx, program, env)
+	fmt.Println(err)
+	// Output:
+	// 3 <nil>
+	// context canceled (1:1)
+	//  | fn(1, 2)
+	//  | ^
+}
+
 func ExampleTimezone() {
 	program, err := expr.Compile(`now().Location().String()`, expr.Timezone("Asia/Kamchatka"))
 	if err != nil {
@@ -1429,7 +1471,7 @@ func TestExpr_error(t *testing.T) {
 		},
 		{
 			`ArrayOfAny[-7]`,
-			`index out of range: -3 (array length is 4) (1:11)
+			`index out of range: -7 (array length is 4) in ArrayOfAny[-7] (1:11)
  | ArrayOfAny[-7]
  | ..........^`,
 		},
@@ -1498,6 +1540,45 @@ func TestExpr_optional_chaining_array(t *testing.T) {
 	assert.Equal(t, nil, got)
 }
 
+func TestExpr_optional_chaining_out_of_range(t *testing.T) {
+	var nilMap map[string][]int
+	env := map[string]any{
+		"orders": []any{map[string]any{"items": []any{"a"}}},
+		"nilMap": nilMap,
+		"nested": map[string]any{"list": []int(nil)},
+	}
+
+	tests := []struct {
+		code string
+		want any
+	}{
+		{`orders?.[0]?.items?.[0]`, "a"},
+		{`orders?.[1]?.items?.[0]`, nil},
+		{`orders?.[0]?.items?.[5]`, nil},
+		{`orders?.[0]?.items?.[-1]`, "a"},
+		{`orders?.[-2]`, nil},
+		{`orders?.[0]?.items[5]`, nil},
+		{`nilMap?.["a"]?.[0]`, nil},
+		{`nested?.list?.[0]`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(env))
+			require.NoError(t, err)
+
+			got, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	program, err := expr.Compile(`orders[1]`, expr.Env(env))
+	require.NoError(t, err)
+	_, err = expr.Run(program, env)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "index out of range: 1 (array length is 1)")
+}
+
 func TestExpr_eval_with_env(t *testing.T) {
 	_, err := expr.Eval("true", expr.Env(map[string]any{}))
 	assert.Error(t, err)
@@ -2050,6 +2131,304 @@ func TestFunction(t *testing.T) {
 	assert.Equal(t, 20, out)
 }
 
+func TestFunction_nil_arguments(t *testing.T) {
+	describe := func(m map[string]int, s []int, f func() int, p *int) string {
+		return fmt.Sprint(m == nil, s == nil, f == nil, p == nil)
+	}
+	env := map[string]any{
+		// Called with reflection, by OpCall.
+		"describe": describe,
+		"variadic": func(prefix string, ps ...*int) string {
+			return fmt.Sprint(prefix, len(ps), ps[0] == nil)
+		},
+		// Called without reflection, by OpCallTyped.
+		"typed": func(a []any) any {
+			return a == nil
+		},
+		"error": func(err error) bool {
+			return err == nil
+		},
+		"m": map[string]int{},
+	}
+	isNil := expr.Function("isNil", func(params ...any) (any, error) {
+		return params[0] == nil, nil
+	})
+	constDescribe := expr.Function("constDescribe", func(params ...any) (any, error) {
+		return describe(nil, nil, nil, nil), nil
+	}, describe)
+
+	tests := []struct {
+		input string
+		want  any
+	}{
+		{`describe(nil, nil, nil, nil)`, "true true true true"},
+		{`describe(m, nil, nil, nil)`, "false true true true"},
+		{`variadic("x", nil, nil)`, "x2 true"},
+		{`typed(nil)`, true},
+		{`error(nil)`, true},
+		{`isNil(nil)`, true},
+		{`constDescribe(nil, nil, nil, nil)`, "true true true true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			program, err := expr.Compile(tt.input, expr.Env(env), isNil, constDescribe, expr.ConstExpr("describe"))
+			require.NoError(t, err)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	// Like in Go, nil can not be passed to parameters which can not be nil.
+	_, err := expr.Compile(`zero(nil)`, expr.Env(map[string]any{"zero": func(int) int { return 0 }}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot use nil as argument (type int) to call zero")
+}
+
+type contextKey struct{}
+
+type contextEnv struct {
+	Prefix string
+}
+
+func (e contextEnv) User(ctx context.Context, id int) (string, error) {
+	return fmt.Sprint(e.Prefix, ctx.Value(contextKey{}), id), nil
+}
+
+func TestInjectContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), contextKey{}, "tenant:")
+	env := map[string]any{
+		"join": func(ctx context.Context, parts ...string) string {
+			return fmt.Sprint(ctx.Value(contextKey{}), strings.Join(parts, ","))
+		},
+		"double": func(ctx context.Context, i int) (int, error) {
+			return i * 2, ctx.Err()
+		},
+		"plain": func(i int) int {
+			return i + 1
+		},
+		"env": contextEnv{Prefix: "user@"},
+	}
+
+	tests := []struct {
+		input string
+		want  any
+	}{
+		{`join()`, "tenant:"},
+		{`join("a", "b")`, "tenant:a,b"},
+		{`double(plain(1))`, 4},
+		{`env.User(7)`, "user@tenant:7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			program, err := expr.Compile(tt.input, expr.Env(env), expr.InjectContext())
+			require.NoError(t, err)
+
+			out, err := expr.RunContext(ctx, program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	t.Run("struct env", func(t *testing.T) {
+		program, err := expr.Compile(`User(1)`, expr.Env(contextEnv{}), expr.InjectContext())
+		require.NoError(t, err)
+		assert.Contains(t, program.Disassemble(), "OpCallCtx")
+
+		out, err := expr.RunContext(ctx, program, contextEnv{Prefix: "id="})
+		require.NoError(t, err)
+		assert.Equal(t, "id=tenant:1", out)
+
+		// Run passes context.Background().
+		out, err = expr.Run(program, contextEnv{})
+		require.NoError(t, err)
+		assert.Equal(t, "<nil> 1", out)
+	})
+
+	t.Run("hidden from arity", func(t *testing.T) {
+		_, err := expr.Compile(`double(1, 2)`, expr.Env(env), expr.InjectContext())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "too many arguments to call double")
+	})
+
+	t.Run("without the option", func(t *testing.T) {
+		env := map[string]any{"double": env["double"], "ctx": ctx}
+		program, err := expr.Compile(`double(ctx, 21)`, expr.Env(env))
+		require.NoError(t, err)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err)
+		assert.Equal(t, 42, out)
+	})
+}
+
+func TestNamespace(t *testing.T) {
+	clamp := func(params ...any) (any, error) {
+		v, lo, hi := params[0].(int), params[1].(int), params[2].(int)
+		if v < lo {
+			return lo, nil
+		}
+		if v > hi {
+			return hi, nil
+		}
+		return v, nil
+	}
+	shout := func(params ...any) (any, error) {
+		return strings.ToUpper(params[0].(string)) + "!", nil
+	}
+	options := []expr.Option{
+		expr.Env(map[string]any{"x": 15, "name": "bob"}),
+		expr.Namespace("math", expr.Function("clamp", clamp, new(func(int, int, int) int))),
+		expr.Namespace("strings", expr.Function("upper", shout, new(func(string) string))),
+		expr.Function("clamp", func(params ...any) (any, error) { return -1, nil }),
+	}
+
+	tests := []struct {
+		input string
+		want  any
+	}{
+		{`math.clamp(x, 0, 10)`, 10},
+		{`math.clamp(x, 0, 10) + clamp()`, 9},
+		{`strings.upper(name)`, "BOB!"},
+		{`upper(name)`, "BOB"},
+		{`name | strings.upper()`, "BOB!"},
+		{`map(1..3, math.clamp(#, 2, 2))`, []any{2, 2, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			program, err := expr.Compile(tt.input, options...)
+			require.NoError(t, err)
+
+			out, err := expr.Run(program, map[string]any{"x": 15, "name": "bob"})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	t.Run("unknown function", func(t *testing.T) {
+		_, err := expr.Compile(`math.round(x)`, options...)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown function round in namespace math (1:6)")
+	})
+
+	t.Run("type errors", func(t *testing.T) {
+		_, err := expr.Compile(`math.clamp(name, 0, 10)`, options...)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "cannot use string as argument (type int) to call math.clamp")
+	})
+}
+
+// lazyEnv resolves its names from a map, recording which were resolved.
+type lazyEnv struct {
+	values   map[string]any
+	resolved []string
+}
+
+func (e *lazyEnv) Resolve(name string) (any, bool) {
+	e.resolved = append(e.resolved, name)
+	value, ok := e.values[name]
+	return value, ok
+}
+
+// typedEnv is a lazyEnv which knows the types of its names.
+type typedEnv struct {
+	*lazyEnv
+}
+
+func (e typedEnv) TypeOf(name string) (reflect.Type, bool) {
+	switch name {
+	case "age":
+		return reflect.TypeOf(0), true
+	case "name":
+		return reflect.TypeOf(""), true
+	case "tags":
+		return reflect.TypeOf([]string{}), true
+	case "extra":
+		return nil, true
+	}
+	return nil, false
+}
+
+func TestFieldResolver(t *testing.T) {
+	values := map[string]any{
+		"age":   42,
+		"name":  "bob",
+		"tags":  []string{"a", "b"},
+		"extra": map[string]any{"x": 1},
+	}
+
+	t.Run("typed", func(t *testing.T) {
+		env := typedEnv{&lazyEnv{values: values}}
+		program, err := expr.Compile(`age > 18 ? upper(name) + string(len(tags)) : extra.x`, expr.Env(env))
+		require.NoError(t, err)
+		assert.Contains(t, program.Disassemble(), "OpLoadDynamic")
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err)
+		assert.Equal(t, "BOB2", out)
+		// Only the names read by the run are resolved.
+		assert.Equal(t, []string{"age", "name", "tags"}, env.resolved)
+	})
+
+	t.Run("type errors", func(t *testing.T) {
+		env := typedEnv{&lazyEnv{}}
+		_, err := expr.Compile(`age + name`, expr.Env(env))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid operation: + (mismatched types int and string)")
+
+		_, err = expr.Compile(`unknown > 0`, expr.Env(env))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown name unknown")
+	})
+
+	t.Run("untyped", func(t *testing.T) {
+		env := &lazyEnv{values: values}
+		program, err := expr.Compile(`(missing ?? len(name)) + extra.x`, expr.Env(env))
+		require.NoError(t, err)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err)
+		assert.Equal(t, 4, out)
+		assert.Equal(t, []string{"missing", "name", "extra"}, env.resolved)
+	})
+
+	t.Run("without env", func(t *testing.T) {
+		env := &lazyEnv{values: values}
+		program, err := expr.Compile(`$env.age + age`)
+		require.NoError(t, err)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err)
+		assert.Equal(t, 84, out)
+	})
+
+	t.Run("resolved once per run", func(t *testing.T) {
+		env := typedEnv{&lazyEnv{values: values}}
+		program, err := expr.Compile(`age + age + sum(map(tags, age))`, expr.Env(env))
+		require.NoError(t, err)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err)
+		assert.Equal(t, 168, out)
+		assert.Equal(t, []string{"age", "tags"}, env.resolved)
+
+		_, err = expr.Run(program, env)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"age", "tags", "age", "tags"}, env.resolved)
+	})
+
+	t.Run("in $env", func(t *testing.T) {
+		env := &lazyEnv{values: values}
+		program, err := expr.Compile(`["age" in $env, "missing" in $env]`, expr.Env(env))
+		require.NoError(t, err)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err)
+		assert.Equal(t, []any{true, false}, out)
+	})
+}
+
 // Nil coalescing operator
 func TestRun_NilCoalescingOperator(t *testing.T) {
 	env := map[string]any{
@@ -2084,6 +2463,24 @@ func TestRun_NilCoalescingOperator(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, "default", out)
 	})
+
+	t.Run("chain", func(t *testing.T) {
+		p, err := expr.Compile(`foo.baz ?? foo?.qux ?? foo.bar ?? "default"`, expr.Env(env))
+		assert.NoError(t, err)
+
+		out, err := expr.Run(p, env)
+		assert.NoError(t, err)
+		assert.Equal(t, "value", out)
+	})
+
+	t.Run("chain with literal", func(t *testing.T) {
+		p, err := expr.Compile(`foo.baz ?? "default" ?? foo.bar`, expr.Env(env))
+		assert.NoError(t, err)
+
+		out, err := expr.Run(p, env)
+		assert.NoError(t, err)
+		assert.Equal(t, "default", out)
+	})
 }
 
 func TestEval_nil_in_maps(t *testing.T) {
@@ -2439,6 +2836,86 @@ func TestIssue_embedded_pointer_struct(t *testing.T) {
 	}
 }
 
+func TestEmbedded_pointer_promotion(t *testing.T) {
+	type CommonHeader struct {
+		TraceID string
+	}
+	type Base struct {
+		*CommonHeader
+		Kind string
+	}
+	type Request struct {
+		*Base
+		Path string
+	}
+	type Shadow struct {
+		TraceID int
+	}
+	type Ambiguous struct {
+		Request
+		Shadow
+	}
+	type Env struct {
+		Req Request `expr:"req"`
+	}
+
+	req := Request{Base: &Base{CommonHeader: &CommonHeader{TraceID: "t1"}}}
+	envs := []struct {
+		name  string
+		env   any
+		roots []string
+	}{
+		{"struct", Env{Req: req}, []string{`req`, `$env["req"]`}},
+		{"map", map[string]any{"req": req}, []string{`req`, `$env["req"]`}},
+		{"pointer", map[string]any{"req": &req}, []string{`req`, `$env["req"]`}},
+		{"nested", map[string]any{"data": map[string]any{"req": req}}, []string{`data.req`, `$env["data"]["req"]`}},
+	}
+	for _, e := range envs {
+		for _, root := range e.roots {
+			for _, path := range []string{`.TraceID`, `.CommonHeader.TraceID`, `.Base.CommonHeader.TraceID`} {
+				code := root + path
+				env := e.env
+				t.Run(e.name+" "+code, func(t *testing.T) {
+					program, err := expr.Compile(code, expr.Env(env))
+					require.NoError(t, err)
+
+					out, err := expr.Run(program, env)
+					require.NoError(t, err)
+					assert.Equal(t, "t1", out)
+				})
+			}
+		}
+	}
+
+	t.Run("shallowest field", func(t *testing.T) {
+		env := map[string]any{"a": Ambiguous{Shadow: Shadow{TraceID: 7}}}
+		program, err := expr.Compile(`a.TraceID`, expr.Env(env))
+		require.NoError(t, err)
+
+		out, err := expr.Run(program, env)
+		require.NoError(t, err)
+		assert.Equal(t, 7, out)
+	})
+
+	t.Run("nil embedded pointer", func(t *testing.T) {
+		for _, env := range []map[string]any{
+			{"req": Request{Base: &Base{}}},
+			{"data": map[string]any{"req": Request{Base: &Base{}}}},
+		} {
+			code := "req.TraceID"
+			if _, ok := env["data"]; ok {
+				code = "data." + code
+			}
+			program, err := expr.Compile(code, expr.Env(env))
+			require.NoError(t, err)
+
+			_, err = expr.Run(program, env)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "cannot get TraceID from nil CommonHeader")
+		}
+	})
+}
+
 func TestIssue474(t *testing.T) {
 	testCases := []struct {
 		code string
@@ -2612,6 +3089,41 @@ func TestArrayComparison(t *testing.T) {
 	}
 }
 
+func TestChainedComparison(t *testing.T) {
+	tests := []struct {
+		code  string
+		want  bool
+		calls int
+	}{
+		{`0 < next() < 2`, true, 1},
+		{`next() < next() < next()`, true, 3},
+		{`5 < next() < 10`, false, 1},
+		{`next() >= 1 >= next() < next()`, false, 2},
+		{`1 < next() + 0.5 <= 2.5 > 1.5`, true, 1},
+		{`0 < x.y.z < 5 && x.y.z > 1`, true, 0},
+		{`all([1, 2], 0 < # * next() < 10)`, true, 2},
+	}
+
+	for _, tt := range tests {
+		for _, optimize := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%v/%v", tt.code, optimize), func(t *testing.T) {
+				calls := 0
+				env := map[string]any{
+					"next": func() int { calls++; return calls },
+					"x":    map[string]any{"y": map[string]any{"z": 3}},
+				}
+				program, err := expr.Compile(tt.code, expr.Env(env), expr.Optimize(optimize))
+				require.NoError(t, err)
+
+				out, err := expr.Run(program, env)
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, out)
+				assert.Equal(t, tt.calls, calls)
+			})
+		}
+	}
+}
+
 func TestIssue_570(t *testing.T) {
 	type Student struct {
 		Name string
@@ -2796,28 +3308,1293 @@ func TestMaxNodesDisabled(t *testing.T) {
 	require.NoError(t, err)
 }
 
-func TestMemoryBudget(t *testing.T) {
+func TestLiteral(t *testing.T) {
+	date := expr.Literal("d", func(value string) (any, error) {
+		return time.Parse("2006-01-02", value)
+	})
+	upper := expr.Literal("up", func(value string) (any, error) {
+		return strings.ToUpper(value), nil
+	})
+	env := map[string]any{"created": time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}
+
 	tests := []struct {
 		code string
-		max  int
+		want any
 	}{
-		{`map(1..100, {map(1..100, {map(1..100, {0})})})`, -1},
-		{`len(1..10000000)`, -1},
-		{`1..100`, 100},
+		{`created > d"2024-01-01"`, true},
+		{`d"2024-01-01".Year()`, 2024},
+		{`up"abc" + up'\x64'`, "ABCD"},
+		{`[d"2024-01-01", created] | map(#.Month()) | map(int(#))`, []any{1, 3}},
 	}
-
 	for _, tt := range tests {
 		t.Run(tt.code, func(t *testing.T) {
-			program, err := expr.Compile(tt.code)
-			require.NoError(t, err, "compile error")
+			program, err := expr.Compile(tt.code, expr.Env(env), date, upper)
+			require.NoError(t, err)
 
-			vm := vm.VM{}
-			if tt.max > 0 {
-				vm.MemoryBudget = uint(tt.max)
-			}
-			_, err = vm.Run(program, nil)
-			require.Error(t, err, "run error")
-			assert.Contains(t, err.Error(), "memory budget exceeded")
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	_, err := expr.Compile(`d"yesterday"`, date)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid d literal")
+
+	_, err = expr.Compile(`re"^a+$"`, date)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown literal prefix re")
+
+	config := conf.CreateNew()
+	date(config)
+	tree, err := parser.ParseWithConfig(`created > d"2024-01-01"`, config)
+	require.NoError(t, err)
+	assert.Equal(t, `created > d"2024-01-01"`, tree.Node.String())
+}
+
+func TestRun_quoted_member(t *testing.T) {
+	env := map[string]any{
+		"user-id":    42,
+		"first name": "Ann",
+		"user":       map[string]any{"home town": "Oslo"},
+	}
+
+	program, err := expr.Compile("$env.\"user-id\" + 1 == 43 && $env.`first name` == \"Ann\" && user.\"home town\" == \"Oslo\"", expr.Env(env))
+	require.NoError(t, err)
+	out, err := expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+
+	_, err = expr.Compile("$env.`first name` + 1", expr.Env(env))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "mismatched types string and int")
+}
+
+func TestRun_keyword_members(t *testing.T) {
+	env := map[string]any{
+		"config": map[string]any{"let": 1, "if": true, "else": 2},
+	}
+
+	program, err := expr.Compile(`let x = {let: config.let, else: config.else}; config.if ? x.let + x.else : 0`, expr.Env(env))
+	require.NoError(t, err)
+	out, err := expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, 3, out)
+}
+
+func TestTemplate(t *testing.T) {
+	env := map[string]any{"amount": 150, "country": "FR"}
+
+	tmpl, err := expr.CompileTemplate(`amount > :threshold && country in :countries`, expr.Env(env))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"countries", "threshold"}, tmpl.Placeholders())
+
+	tests := []struct {
+		bindings map[string]any
+		want     any
+		err      string
+	}{
+		{map[string]any{"threshold": 100, "countries": []string{"FR", "DE"}}, true, ""},
+		{map[string]any{"threshold": 200.5, "countries": []string{"FR"}}, false, ""},
+		{map[string]any{"threshold": "100", "countries": []string{"FR"}}, nil, "invalid operation: > (mismatched types int and string)"},
+		{map[string]any{"threshold": 100}, nil, "placeholder :countries is not bound (1:35)"},
+		{map[string]any{"threshold": 100, "countries": nil, "limit": 1}, nil, "unknown placeholder :limit"},
+	}
+	for _, tt := range tests {
+		program, err := tmpl.Bind(tt.bindings)
+		if tt.err != "" {
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+			continue
+		}
+		require.NoError(t, err)
+		out, err := expr.Run(program, env)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, out)
+	}
+
+	_, err = expr.Compile(`amount > :threshold`, expr.Env(env))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "placeholder :threshold is not bound")
+}
+
+func TestOperatorAlias(t *testing.T) {
+	env := map[string]any{
+		"age":     20,
+		"country": "FR",
+		"user":    map[string]any{"et": 1},
+	}
+	aliases := []expr.Option{
+		expr.Env(env),
+		expr.OperatorAlias("ET", "and"),
+		expr.OperatorAlias("OU", "or"),
+		expr.OperatorAlias("dans", "in"),
+		expr.OperatorAlias("pas", "not"),
+		expr.OperatorAlias("et", "and"),
+	}
+
+	tests := []struct {
+		code string
+		want any
+	}{
+		{`age >= 18 ET country dans ["FR", "BE"]`, true},
+		{`age < 18 OU pas (country dans ["FR"])`, false},
+		{`country pas dans ["DE"]`, true},
+		{`user.et == 1 et true`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, aliases...)
+			require.NoError(t, err)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	assert.Panics(t, func() {
+		_, _ = expr.Compile(`1`, expr.OperatorAlias("ET", "&&&"))
+	})
+	assert.Panics(t, func() {
+		_, _ = expr.Compile(`1`, expr.OperatorAlias("&", "and"))
+	})
+}
+
+func TestCustomOperator(t *testing.T) {
+	env := map[string]any{
+		"cmp": func(a, b int) int {
+			if a < b {
+				return -1
+			} else if a > b {
+				return 1
+			}
+			return 0
+		},
+		"between": func(x int, r []any) bool {
+			return r[0].(int) <= x && x <= r[1].(int)
+		},
+		"approx": func(a, b float64) bool {
+			return math.Abs(a-b) < 0.01
+		},
+		"pow": func(a, b int) int {
+			return int(math.Pow(float64(a), float64(b)))
+		},
+		"user": map[string]any{"within": 7},
+	}
+	options := []expr.Option{
+		expr.Env(env),
+		expr.CustomOperator("<=>", "cmp", 20, operator.Left),
+		expr.CustomOperator("within", "between", 20, operator.Left),
+		expr.CustomOperator("~=", "approx", 20, operator.Left),
+		expr.CustomOperator("^^", "pow", 100, operator.Right),
+	}
+
+	tests := []struct {
+		code string
+		want any
+	}{
+		{`1 <=> 2`, -1},
+		{`1 + 2 <=> 3`, 0},
+		{`1 <= 2`, true},
+		{`5 within [1, 10] && 0 within [1, 10] == false`, true},
+		{`user.within within [5, 10]`, true},
+		{`0.1 + 0.2 ~= 0.3`, true},
+		{`2 ^^ 3 ^^ 2`, 512},
+		{`"<=>"`, "<=>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, options...)
+			require.NoError(t, err)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	_, err := expr.Compile(`"a" <=> 1`, options...)
+	require.Error(t, err)
+
+	assert.Panics(t, func() {
+		_, _ = expr.Compile(`1`, expr.CustomOperator("+", "cmp", 30, operator.Left))
+	})
+	assert.Panics(t, func() {
+		_, _ = expr.Compile(`1`, expr.CustomOperator("<a>", "cmp", 20, operator.Left))
+	})
+}
+
+func TestCustomOperator_config(t *testing.T) {
+	env := map[string]any{
+		"cmp": func(a, b int) int { return a - b },
+	}
+	register := func(c *conf.Config) {
+		c.CustomOperator("<=>", conf.CustomOperator{
+			Operator: operator.Operator{Precedence: 20, Associativity: operator.Left},
+			Function: "cmp",
+		})
+	}
+
+	config := conf.New(env)
+	register(config)
+	tree, err := checker.ParseCheck(`1 + 2 <=> 1`, config)
+	require.NoError(t, err)
+	assert.Equal(t, `cmp(1 + 2, 1)`, tree.Node.String())
+
+	program, err := expr.Compile(`1 + 2 <=> 1`, expr.Env(env), register)
+	require.NoError(t, err)
+	out, err := expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, 2, out)
+}
+
+func TestWarnings(t *testing.T) {
+	env := map[string]any{"tags": []string{"a"}}
+
+	var warnings []*file.Error
+	_, err := expr.Compile(`len(tags) >= 0 && "a" in tags`, expr.Env(env), expr.Warnings(func(w *file.Error) {
+		warnings = append(warnings, w)
+	}))
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	assert.Equal(t, "comparison is always true (1:11)\n | len(tags) >= 0 && \"a\" in tags\n | ..........^", warnings[0].Error())
+
+	_, err = expr.Compile(`len(tags) >= 0`, expr.Env(env), expr.WarningsAsErrors())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "comparison is always true")
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	env := map[string]any{
+		"maxInt": math.MaxInt64,
+		"minInt": math.MinInt64,
+		"big":    uint64(math.MaxUint64),
+		"small":  int8(100),
+	}
+
+	tests := []struct {
+		code string
+		want any
+		err  string
+	}{
+		{code: `maxInt - 1 + 1`, want: math.MaxInt64},
+		{code: `small * small`, want: 10000},
+		{code: `"a" + "b"`, want: "ab"},
+		{code: `maxInt * 1.5`, want: float64(math.MaxInt64) * 1.5},
+		{code: `maxInt + 1`, err: "integer overflow: 9223372036854775807 + 1 (1:8)"},
+		{code: `minInt - 1`, err: "integer overflow: -9223372036854775808 - 1"},
+		{code: `maxInt * 2`, err: "integer overflow: 9223372036854775807 * 2"},
+		{code: `minInt * -1`, err: "integer overflow: -9223372036854775808 * -1"},
+		{code: `-minInt`, err: "integer overflow: -(-9223372036854775808)"},
+		{code: `big + 0`, err: "integer overflow: 18446744073709551615"},
+		{code: `9223372036854775807 + 1`, err: "integer overflow (1:21)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(env), expr.CheckedArithmetic())
+			if err == nil {
+				var out any
+				out, err = expr.Run(program, env)
+				if tt.err == "" {
+					require.NoError(t, err)
+					assert.Equal(t, tt.want, out)
+					return
+				}
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+
+	out, err := expr.Eval(`maxInt + 1`, env)
+	require.NoError(t, err)
+	assert.Equal(t, math.MinInt64, out)
+}
+
+func TestWithDecimal(t *testing.T) {
+	env := map[string]any{
+		"price":    19.99,
+		"quantity": 3,
+		"discount": big.NewRat(1, 10),
+		"items":    []int{1, 2, 3},
+	}
+
+	tests := []struct {
+		code string
+		want string
+	}{
+		{`0.1 + 0.2`, "3/10"},
+		{`0.1 + 0.2 == 0.3`, "true"},
+		{`1.0 * price * quantity`, "5997/100"},
+		{`price * (1.0 - discount)`, "179910/10000"},
+		{`-1.5 * 2`, "-3/1"},
+		{`1.0 / 3 * 3 == 1`, "true"},
+		{`0.3 > 0.1 + 0.1`, "true"},
+		{`items[1] + 1`, "3"},
+		{`1e-2`, "1/100"},
+		{`0x1.8p-1`, "3/4"},
+		{`0.5 in [0.5]`, "true"},
+		{`1 in [1.0, 2.0]`, "true"},
+		{`string(0.5)`, "0.5"},
+		{`string(1.0 / 3)`, "1/3"},
+		{`int(-2.5)`, "-2"},
+		{`float(0.5)`, "0.5"},
+		{`abs(-0.5)`, "1/2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(env), expr.WithDecimal())
+			require.NoError(t, err)
+
+			data, err := program.MarshalBinary()
+			require.NoError(t, err)
+			decoded := &vm.Program{}
+			require.NoError(t, decoded.UnmarshalBinary(data))
+
+			for _, program := range []*vm.Program{program, decoded} {
+				out, err := expr.Run(program, env)
+				require.NoError(t, err)
+				if r, ok := out.(*big.Rat); ok {
+					want, _ := new(big.Rat).SetString(tt.want)
+					assert.Equal(t, want.String(), r.String())
+				} else {
+					assert.Equal(t, tt.want, fmt.Sprint(out))
+				}
+			}
+		})
+	}
+
+	out, err := expr.Eval(`0.1 + 0.2 == 0.3`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, false, out)
+
+	_, err = expr.Compile(`0.1 + "a"`, expr.WithDecimal())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid operation: +")
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := conf.NewStdLogger(log.New(&buf, "", 0), conf.LevelDebug, conf.LogCompiler, conf.LogVM)
+
+	program, err := expr.Compile(`1 + 2`, expr.Logger(logger))
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "[compiler] DEBUG")
+	assert.NotContains(t, buf.String(), "[parser]")
+
+	buf.Reset()
+	v := vm.VM{Logger: logger}
+	out, err := v.Run(program, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, out)
+	assert.Contains(t, buf.String(), "[vm] DEBUG")
+
+	buf.Reset()
+	out, err = expr.Run(program, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, out)
+	assert.Contains(t, buf.String(), "[vm] DEBUG")
+
+	buf.Reset()
+	v = vm.VM{Logger: conf.NopLogger}
+	_, err = v.Run(program, nil)
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+}
+
+func TestLogger_disabled_by_default(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	_, err := expr.Compile(`a > 0 ? b : c`, expr.Env(map[string]any{"a": 1, "b": 2, "c": 3}))
+	require.NoError(t, err)
+	assert.Empty(t, buf.String())
+}
+
+func TestMemoryBudget(t *testing.T) {
+	tests := []struct {
+		code string
+		max  int
+	}{
+		{`map(1..100, {map(1..100, {map(1..100, {0})})})`, -1},
+		{`len(1..10000000)`, -1},
+		{`1..100`, 100},
+		{`fromJSON("[" + repeat("1,", 99) + "1]")`, 250},
+		{`toJSON(1..100)`, 300},
+		{`padStart("a", 500)`, 300},
+		{`format("%s%s", repeat("a", 100), repeat("b", 100))`, 300},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code)
+			require.NoError(t, err, "compile error")
+
+			vm := vm.VM{}
+			if tt.max > 0 {
+				vm.MemoryBudget = uint(tt.max)
+			}
+			_, err = vm.Run(program, nil)
+			require.Error(t, err, "run error")
+			assert.Contains(t, err.Error(), "memory budget exceeded")
+		})
+	}
+}
+
+func TestRevalidate(t *testing.T) {
+	type OldEnv struct {
+		Name string
+		Age  int
+	}
+	type NewEnv struct {
+		Email string
+		Age   int
+	}
+
+	programs := map[string]*vm.Program{}
+	for name, code := range map[string]string{"adult": `Age >= 18`, "bob": `Name == "Bob"`} {
+		program, err := expr.Compile(code, expr.Env(OldEnv{}))
+		require.NoError(t, err)
+		programs[name] = program
+	}
+	var buf bytes.Buffer
+	require.NoError(t, vm.WriteBundle(&buf, conf.Fingerprint(OldEnv{}), programs))
+	bundle, err := vm.ReadBundle(buf.Bytes(), nil)
+	require.NoError(t, err)
+
+	results := expr.Revalidate(bundle, expr.Env(OldEnv{}))
+	require.Len(t, results, 2)
+	for _, r := range results {
+		require.NoError(t, r.Err)
+		p, _ := bundle.Program(r.Name)
+		assert.Same(t, p, r.Program)
+	}
+
+	results = expr.Revalidate(bundle, expr.Env(NewEnv{}))
+	require.Len(t, results, 2)
+	assert.Equal(t, "adult", results[0].Name)
+	require.NoError(t, results[0].Err)
+	out, err := expr.Run(results[0].Program, NewEnv{Age: 30})
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+
+	assert.Equal(t, "bob", results[1].Name)
+	require.Error(t, results[1].Err)
+	assert.Contains(t, results[1].Err.Error(), "unknown name Name")
+	assert.Nil(t, results[1].Program)
+}
+
+func TestWithNilOnMissing(t *testing.T) {
+	type Profile struct {
+		Name string
+	}
+	type User struct {
+		Profile *Profile
+		Tags    []string
+	}
+	type Env struct {
+		User  User
+		Items []int
+		Map   map[string]any
+	}
+	env := Env{
+		User:  User{Tags: []string{"a"}},
+		Items: []int{1, 2, 3},
+		Map:   map[string]any{"a": map[string]any{"b": 1}},
+	}
+
+	tests := []struct {
+		code string
+		want any
+	}{
+		{`Items[10]`, nil},
+		{`Items[-10]`, nil},
+		{`Items[1]`, 2},
+		{`User.Profile.Name`, nil},
+		{`User.Tags[1]`, nil},
+		{`User.Tags[0]`, "a"},
+		{`Map.a.b`, 1},
+		{`Map.x.y`, nil},
+		{`Map.a.b.c`, nil},
+		{`Map.a["b"]`, 1},
+		{`(User.Profile.Name ?? "guest") + "!"`, "guest!"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(Env{}), expr.WithNilOnMissing())
+			require.NoError(t, err)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	t.Run("default", func(t *testing.T) {
+		for _, code := range []string{`Items[10]`, `User.Profile.Name`, `Map.x.y`} {
+			program, err := expr.Compile(code, expr.Env(Env{}))
+			require.NoError(t, err)
+
+			_, err = expr.Run(program, env)
+			require.Error(t, err, code)
+		}
+	})
+}
+
+func TestBytes(t *testing.T) {
+	env := map[string]any{
+		"sig":  []byte{0xde, 0xad},
+		"data": []byte("hi"),
+		"text": "hi",
+	}
+
+	tests := []struct {
+		code string
+		want any
+	}{
+		{`sig == hex"dead"`, true},
+		{`sig == b"\xde\xad"`, true},
+		{`sig != b64"3q0="`, false},
+		{`data + b"!"`, []byte("hi!")},
+		{`data < sig`, true},
+		{`sig >= data`, true},
+		{`len(b"\xff")`, 1},
+		{`sig[1:]`, []byte{0xad}},
+		{`string(data) == text`, true},
+		{`bytes(text) == data`, true},
+		{`data in [sig, b"hi"]`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(env))
+			require.NoError(t, err)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	t.Run("not strings", func(t *testing.T) {
+		_, err := expr.Compile(`data == text`, expr.Env(env))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "mismatched types []uint8 and string")
+
+		_, err = expr.Compile(`data + text`, expr.Env(env))
+		require.Error(t, err)
+	})
+
+	t.Run("concatenation copies", func(t *testing.T) {
+		buf := make([]byte, 2, 8)
+		copy(buf, "hi")
+		env := map[string]any{"buf": buf}
+		out, err := expr.Eval(`[buf + b"a", buf + b"b"]`, env)
+		require.NoError(t, err)
+		assert.Equal(t, []any{[]byte("hia"), []byte("hib")}, out)
+	})
+}
+
+func TestWithNilOnOutOfRange(t *testing.T) {
+	env := map[string]any{
+		"items": []int{1, 2, 3},
+		"user":  map[string]any{"tags": []any{"a"}},
+	}
+
+	tests := []struct {
+		code string
+		want any
+	}{
+		{`items[-1]`, 3},
+		{`items[-3]`, 1},
+		{`items[-10]`, nil},
+		{`items[3]`, nil},
+		{`items[5] ?? 0`, 0},
+		{`items[-10] == nil`, true},
+		{`user.tags[1] ?? "none"`, "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(env), expr.WithNilOnOutOfRange())
+			require.NoError(t, err)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	t.Run("missing keys", func(t *testing.T) {
+		program, err := expr.Compile(`user.missing[0]`, expr.Env(env), expr.WithNilOnOutOfRange())
+		require.NoError(t, err)
+
+		_, err = expr.Run(program, env)
+		require.Error(t, err)
+	})
+
+	t.Run("default", func(t *testing.T) {
+		_, err := expr.Eval(`items[1:][-10]`, env)
+		require.Error(t, err)
+		assert.Equal(t, "index out of range: -10 (array length is 2) in items[1:][-10] (1:10)\n | items[1:][-10]\n | .........^", err.Error())
+	})
+}
+
+func TestExpr_lambda(t *testing.T) {
+	type User struct {
+		Name    string
+		Age     int
+		Friends []User
+	}
+	env := map[string]any{
+		"users": []User{
+			{Name: "Alice", Age: 30, Friends: []User{{Age: 40}, {Age: 20}}},
+			{Name: "Bob", Age: 10, Friends: []User{{Age: 12}}},
+		},
+		"xs": []int{1, 2, 3},
+	}
+
+	tests := []struct {
+		code string
+		want any
+	}{
+		{`map(filter(users, u => u.Age > 18), u => u.Name)`, []any{"Alice"}},
+		{`map(users, u => count(u.Friends, f => f.Age > u.Age))`, []any{1, 1}},
+		{`reduce(xs, (acc, x) => acc + x, 10)`, 16},
+		{`map(xs, (x, i) => x * i)`, []any{0, 2, 6}},
+		{`map(xs, x => { let y = x * 2; y + 1 })`, []any{3, 5, 7}},
+		{`sortBy(users, (u) => -u.Age)[0].Name`, "Alice"},
+		{`all(xs, x => x > 0) && none(xs, x => x > # + 3)`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(env))
+			require.NoError(t, err)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	_, err := expr.Compile(`filter(xs, xs => xs > 1)`, expr.Env(env))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot redeclare xs")
+}
+
+func TestExpr_functions(t *testing.T) {
+	env := map[string]any{
+		"xs": []int{1, 2, 3},
+	}
+
+	tests := []struct {
+		code string
+		want any
+	}{
+		{`let double = (x) => x * 2; map(xs, double)`, []any{2, 4, 6}},
+		{`let double = x => x * 2; double(3) + 1`, 7},
+		{`let add = (acc, x) => acc + x; reduce(xs, add, 10)`, 16},
+		{`let weight = (x, i) => x * i; map(xs, weight)`, []any{0, 2, 6}},
+		{`let big = x => x > 1; filter(xs, big)`, []any{2, 3}},
+		{`let k = 5; let f = x => { let y = x + k; y * 2 }; [f(1), f(2), k]`, []any{12, 14, 5}},
+		{`let adders = map(xs, let n = #; (x) => x + n); map(adders, #(10))`, []any{11, 12, 13}},
+		{`let adder = (n) => (x) => x + n; let inc = adder(1); [inc(1), adder(2)(2)]`, []any{2, 4}},
+		{`let twice = (f, x) => f(f(x)); twice((x) => x * 3, 2)`, 18},
+		{`((x) => x + 1)(41)`, 42},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(env))
+			require.NoError(t, err)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	failures := []struct {
+		code string
+		err  string
+	}{
+		{`let f = (x) => x; f(1, 2)`, "too many arguments to call f"},
+		{`let f = (x, y) => x; f(1)`, "not enough arguments to call f"},
+		{`let f = (a, b, c) => a; map(xs, f)`, "cannot use function with 3 parameters as predicate"},
+		{`let f = (x) => # + x; f(1)`, `unexpected token Operator("#")`},
+		{`let f = (xs) => xs; f(1)`, "cannot redeclare xs"},
+	}
+	for _, tt := range failures {
+		t.Run(tt.code, func(t *testing.T) {
+			_, err := expr.Compile(tt.code, expr.Env(env))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+
+	t.Run("recursion", func(t *testing.T) {
+		program, err := expr.Compile(`let loop = (f) => f(f); loop(loop)`)
+		require.NoError(t, err)
+
+		_, err = expr.Run(program, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "maximum call depth exceeded")
+	})
+}
+
+func TestExpr_outer_pointer(t *testing.T) {
+	env := map[string]any{
+		"xs":     []int{1, 2, 3},
+		"groups": [][]int{{1, 5}, {2}, {3, 4}},
+		"ys":     []int{10, 20},
+	}
+
+	tests := []struct {
+		code string
+		want any
+	}{
+		{`filter(xs, any(xs, # > #1 + 1))`, []any{1}},
+		{`map(groups, count(#, # > #1[0]))`, []any{1, 0, 1}},
+		{`map(xs, map(xs, map(xs, #1 * 100 + #2 * 10 + #3)))[1][2]`, []any{231, 232, 233}},
+		{`map(xs, #1 == #)`, []any{true, true, true}},
+		{`let f = (a) => map(ys, #1 + a); map(xs, f(#))`, []any{[]any{11, 21}, []any{12, 22}, []any{13, 23}}},
+		{`let f = (a) => map(ys, map(xs, #1 + #2 + a)); map(xs, f(#))[2]`, []any{[]any{14, 15, 16}, []any{24, 25, 26}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(env))
+			require.NoError(t, err)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	_, err := expr.Compile(`map(xs, filter(xs, #3 > 1))`, expr.Env(env))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot use #3 in predicate nested 2 levels deep")
+
+	_, err = expr.Compile(`map(xs, let f = (a) => map(ys, #2 + a); f(#))`, expr.Env(env))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot use #2 in predicate nested 1 levels deep")
+}
+
+func TestExpr_named_types_with_literals(t *testing.T) {
+	type Status string
+	type Level int
+	type Ratio float64
+	type Env struct {
+		Status   Status
+		Level    Level
+		Ratio    Ratio
+		Statuses []Status
+		Levels   map[Status]Level
+	}
+	env := Env{
+		Status:   "active",
+		Level:    3,
+		Ratio:    0.5,
+		Statuses: []Status{"pending", "active"},
+		Levels:   map[Status]Level{"active": 2},
+	}
+
+	tests := []struct {
+		code string
+		want any
+	}{
+		{`Status == "active"`, true},
+		{`"active" != Status`, false},
+		{`Status < "b"`, true},
+		{`Status in ["active", "blocked"]`, true},
+		{`Status in ["pending", "blocked"]`, false},
+		{`Status in {"active": 1}`, true},
+		{`"active" in Statuses`, true},
+		{`Status contains "act"`, true},
+		{`Status startsWith "act"`, true},
+		{`Status matches "^a"`, true},
+		{`Level == 3`, true},
+		{`Level > 2`, true},
+		{`Level in [1, 3]`, true},
+		{`Level in 1..2`, false},
+		{`Level == 3.0`, true},
+		{`Ratio > 0.1`, true},
+		{`Ratio == 0.5`, true},
+		{`Levels[Status] == 2`, true},
+		{`filter(Statuses, # != "pending")`, []any{Status("active")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(Env{}))
+			require.NoError(t, err)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+}
+
+type receiverUser struct {
+	Name string
+}
+
+func (u *receiverUser) Greet(greeting string) string {
+	return greeting + ", " + u.Name
+}
+
+type receiverEnv struct {
+	User  receiverUser
+	Users []receiverUser
+	Any   any
+}
+
+func (e *receiverEnv) Count() int {
+	return len(e.Users)
+}
+
+func TestExpr_pointer_receiver_methods(t *testing.T) {
+	env := receiverEnv{
+		User:  receiverUser{Name: "Bob"},
+		Users: []receiverUser{{Name: "Ann"}, {Name: "Joe"}},
+		Any:   receiverUser{Name: "Tom"},
+	}
+
+	tests := []struct {
+		code string
+		want any
+	}{
+		{`User.Greet("hi")`, "hi, Bob"},
+		{`map(Users, #.Greet("hey"))`, []any{"hey, Ann", "hey, Joe"}},
+		{`map(Users, .Greet("hey"))`, []any{"hey, Ann", "hey, Joe"}},
+		{`Any.Greet("yo")`, "yo, Tom"},
+		{`Count()`, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			for _, e := range []any{env, &env} {
+				program, err := expr.Compile(tt.code, expr.Env(e))
+				require.NoError(t, err)
+
+				out, err := expr.Run(program, e)
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, out)
+			}
+		})
+	}
+
+	t.Run("marshal binary", func(t *testing.T) {
+		program, err := expr.Compile(`User.Greet("hi")`, expr.Env(env))
+		require.NoError(t, err)
+		data, err := program.MarshalBinary()
+		require.NoError(t, err)
+
+		loaded := &vm.Program{}
+		require.NoError(t, loaded.UnmarshalBinary(data))
+		out, err := expr.Run(loaded, env)
+		require.NoError(t, err)
+		assert.Equal(t, "hi, Bob", out)
+	})
+
+	t.Run("map env", func(t *testing.T) {
+		env := map[string]any{"user": receiverUser{Name: "Bob"}}
+		out, err := expr.Eval(`user.Greet("hi")`, env)
+		require.NoError(t, err)
+		assert.Equal(t, "hi, Bob", out)
+	})
+}
+
+func TestFloatEpsilon(t *testing.T) {
+	type Score float64
+	tenth := 0.1
+	env := map[string]any{
+		"score": tenth + 0.2,
+		"named": Score(tenth + 0.2),
+		"count": 3,
+		"any":   any(0.30000000001),
+	}
+
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{`score == 0.3`, true},
+		{`score != 0.3`, false},
+		{`0.1 + 0.2 == 0.3`, true},
+		{`score == 0.31`, false},
+		{`named == 0.3`, true},
+		{`any == 0.3`, true},
+		{`count == 3`, true},
+		{`count == 3.0000000001`, false},
+		{`"a" == "a"`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(env), expr.FloatEpsilon(1e-9))
+			require.NoError(t, err)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	out, err := expr.Eval(`score == 0.3`, env)
+	require.NoError(t, err)
+	assert.Equal(t, false, out)
+}
+
+type cancelingPatcher struct {
+	cancel context.CancelFunc
+}
+
+func (p *cancelingPatcher) Visit(*ast.Node) {
+	p.cancel()
+}
+
+func TestCompileContext(t *testing.T) {
+	program, err := expr.CompileContext(context.Background(), `1 + 2`)
+	require.NoError(t, err)
+	out, err := expr.Run(program, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, out)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = expr.CompileContext(ctx, `1 + 2`)
+	require.ErrorIs(t, err, context.Canceled)
+
+	// A patcher cancels the context, so the type check of the patched
+	// tree is aborted.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	input := strings.Repeat("1 + ", 1000) + "1"
+	_, err = expr.CompileContext(ctx, input, expr.Patch(&cancelingPatcher{cancel: cancel}))
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestWithRegexLimits(t *testing.T) {
+	env := map[string]any{
+		"name":    "expr",
+		"pattern": "^ex",
+		"long":    strings.Repeat("a", 1000),
+	}
+	limits := expr.WithRegexLimits(expr.RegexLimits{
+		MaxLength: 20,
+		MaxSize:   100,
+		MaxSteps:  1000,
+		CacheSize: 10,
+	})
+
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{`name matches "^ex"`, true},
+		{`name matches pattern`, true},
+		{`name matches pattern + "$"`, false},
+		{`name matches "^x"`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(env), limits)
+			require.NoError(t, err)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	errors := []struct {
+		code string
+		err  string
+	}{
+		{`name matches "` + strings.Repeat("a", 21) + `"`, "regexp pattern is too long (21 > 20 bytes)"},
+		{`name matches "(a{10}){10}"`, "regexp pattern is too complex"},
+		{`hasPrefix(name, "a") || name matches "[a-z]{100}"`, "regexp pattern is too complex"},
+	}
+	for _, tt := range errors {
+		t.Run(tt.code, func(t *testing.T) {
+			_, err := expr.Compile(tt.code, expr.Env(env), limits)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+
+	t.Run("runtime", func(t *testing.T) {
+		program, err := expr.Compile(`name matches pattern + "(a{10}){10}"`, expr.Env(env), limits)
+		require.NoError(t, err)
+		_, err = expr.Run(program, env)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "regexp pattern is too complex (125 > 100 instructions)")
+
+		program, err = expr.Compile(`long matches "a+b"`, expr.Env(env), limits)
+		require.NoError(t, err)
+		_, err = expr.Run(program, env)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "regexp match exceeds the budget of 1000 steps")
+	})
+
+	t.Run("builtins", func(t *testing.T) {
+		program, err := expr.Compile(`replaceRegex(name, "^e", "E") + join(splitRegex(name, pattern), "")`, expr.Env(env), limits)
+		require.NoError(t, err)
+		out, err := expr.Run(program, env)
+		require.NoError(t, err)
+		assert.Equal(t, "Exprpr", out)
+
+		_, err = expr.Compile(`splitRegex(name, "(a{10}){10}")`, expr.Env(env), limits)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "regexp pattern is too complex")
+
+		for _, code := range []string{`splitRegex(long, "a+b")`, `matchGroups(long, pattern + "|a+b")`} {
+			program, err = expr.Compile(code, expr.Env(env), limits)
+			require.NoError(t, err)
+			_, err = expr.Run(program, env)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "regexp match exceeds the budget of 1000 steps")
+		}
+
+		program, err = expr.Compile(`replaceRegex(name, pattern + "(a{10}){10}", "")`, expr.Env(env), limits)
+		require.NoError(t, err)
+		_, err = expr.Run(program, env)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "regexp pattern is too complex (125 > 100 instructions)")
+	})
+
+	t.Run("literals are compiled once", func(t *testing.T) {
+		program, err := expr.Compile(`name matches "^ex" && replaceRegex(name, "x", "") == "epr"`, expr.Env(env), expr.WithRegexLimits(expr.RegexLimits{MaxSteps: 1000}))
+		require.NoError(t, err)
+		var compiled int
+		for _, c := range program.Constants {
+			if _, ok := c.(*runtime.Regexp); ok {
+				compiled++
+			}
+			assert.NotEqual(t, "*runtime.Regexps", fmt.Sprintf("%T", c))
+		}
+		assert.Equal(t, 2, compiled)
+
+		data, err := program.MarshalBinary()
+		require.NoError(t, err)
+		decoded := &vm.Program{}
+		require.NoError(t, decoded.UnmarshalBinary(data))
+		for _, program := range []*vm.Program{program, decoded} {
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, true, out)
+
+			_, err = expr.Run(program, map[string]any{"name": env["long"]})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "regexp match exceeds the budget of 1000 steps")
+		}
+	})
+}
+
+func TestWithFieldTag(t *testing.T) {
+	type Address struct {
+		ZipCode string `json:"zip_code"`
+	}
+	type User struct {
+		FirstName string   `json:"first_name,omitempty"`
+		Nick      string   `expr:"nick" json:"nickname"`
+		Secret    string   `json:"-"`
+		Address   *Address `json:"address"`
+		Any       any      `json:"any"`
+	}
+	type Env struct {
+		User User `json:"user"`
+	}
+	env := Env{User{
+		FirstName: "Ann",
+		Nick:      "ann",
+		Secret:    "secret",
+		Address:   &Address{ZipCode: "123"},
+		Any:       User{FirstName: "Bob"},
+	}}
+
+	tests := []struct {
+		code string
+		want any
+	}{
+		{`user.first_name`, "Ann"},
+		{`user.nick`, "ann"},
+		{`user.Secret`, "secret"},
+		{`user.address.zip_code`, "123"},
+		{`user.any.first_name`, "Bob"},
+		{`user?.any?.first_name`, "Bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(Env{}), expr.WithFieldTag("json"))
+			require.NoError(t, err)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+
+			data, err := program.MarshalBinary()
+			require.NoError(t, err)
+			var loaded vm.Program
+			require.NoError(t, loaded.UnmarshalBinary(data))
+			out, err = expr.Run(&loaded, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	_, err := expr.Compile(`user.nickname`, expr.Env(Env{}), expr.WithFieldTag("json"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "type expr_test.User has no field nickname")
+
+	_, err = expr.Compile(`user.first_name`, expr.Env(Env{}))
+	require.Error(t, err)
+
+	program, err := expr.Compile(`u.first_name`, expr.WithFieldTag("json"), expr.WithNilOnMissing())
+	require.NoError(t, err)
+	out, err := expr.Run(program, map[string]any{"u": User{FirstName: "Cid"}})
+	require.NoError(t, err)
+	assert.Equal(t, "Cid", out)
+}
+
+func TestCaseInsensitiveFields(t *testing.T) {
+	type Profile struct {
+		Email string
+	}
+	type User struct {
+		Name    string
+		Profile *Profile
+		Any     any
+	}
+	type Env struct {
+		User  User
+		Attrs map[string]any
+		Tags  map[string]int
+	}
+	env := Env{
+		User: User{
+			Name:    "Ann",
+			Profile: &Profile{Email: "ann@example.com"},
+			Any:     map[string]any{"Role": "admin"},
+		},
+		Attrs: map[string]any{"Plan": "pro"},
+		Tags:  map[string]int{"Go": 1},
+	}
+
+	tests := []struct {
+		code string
+		want any
+	}{
+		{`user.name`, "Ann"},
+		{`USER.NAME`, "Ann"},
+		{`user.profile.email`, "ann@example.com"},
+		{`$env.user.name`, "Ann"},
+		{`user.any.role`, "admin"},
+		{`attrs.plan`, "pro"},
+		{`tags.go`, 1},
+		{`tags.Go`, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(Env{}), expr.CaseInsensitiveFields())
+			require.NoError(t, err)
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+
+			data, err := program.MarshalBinary()
+			require.NoError(t, err)
+			var loaded vm.Program
+			require.NoError(t, loaded.UnmarshalBinary(data))
+			out, err = expr.Run(&loaded, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, out)
+		})
+	}
+
+	_, err := expr.Compile(`user.name`, expr.Env(Env{}))
+	require.Error(t, err)
+
+	t.Run("map env", func(t *testing.T) {
+		env := map[string]any{"Name": "Ann", "user": map[string]any{"Name": "Bob"}}
+		program, err := expr.Compile(`name + user.name`, expr.Env(env), expr.CaseInsensitiveFields())
+		require.NoError(t, err)
+		out, err := expr.Run(program, env)
+		require.NoError(t, err)
+		assert.Equal(t, "AnnBob", out)
+	})
+
+	t.Run("ambiguous", func(t *testing.T) {
+		type Ambiguous struct {
+			Name string
+			NAME string
+		}
+		_, err := expr.Compile(`a.name`, expr.Env(map[string]any{"a": Ambiguous{}}), expr.CaseInsensitiveFields())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "field name of expr_test.Ambiguous is ambiguous (NAME, Name)")
+
+		program, err := expr.Compile(`a.Name`, expr.Env(map[string]any{"a": Ambiguous{}}), expr.CaseInsensitiveFields())
+		require.NoError(t, err)
+		out, err := expr.Run(program, map[string]any{"a": Ambiguous{Name: "exact"}})
+		require.NoError(t, err)
+		assert.Equal(t, "exact", out)
+
+		_, err = expr.Compile(`name`, expr.Env(map[string]any{"Name": 1, "NAME": 2}), expr.CaseInsensitiveFields())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "name name is ambiguous (NAME, Name)")
+
+		program, err = expr.Compile(`a.name`, expr.CaseInsensitiveFields())
+		require.NoError(t, err)
+		_, err = expr.Run(program, map[string]any{"a": map[string]any{"Name": 1, "NAME": 2}})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "name name is ambiguous (NAME, Name)")
+	})
+}
+
+func TestStrictNil(t *testing.T) {
+	type User struct {
+		Manager *User
+		Tags    []string
+		Any     any
+	}
+	type Env struct {
+		User  User
+		Other any
+	}
+	env := Env{User: User{Any: (*User)(nil)}, Other: (*mock.Foo)(nil)}
+
+	tests := []struct {
+		code          string
+		loose, strict bool
+	}{
+		{`User.Manager == nil`, true, true},
+		{`nil == User.Manager`, true, true},
+		{`User.Manager != nil`, false, false},
+		{`User.Tags == nil`, true, true},
+		{`User.Any == nil`, true, false},
+		{`User.Any != nil`, false, true},
+		{`User.Any == User.Manager`, true, true},
+		{`User.Manager == Other`, true, false},
+		{`[User.Any] == [nil]`, true, false},
+		{`(User.Any ?? 1) == 1`, true, false},
+		{`(User.Manager ?? 1) == 1`, true, true},
+		{`(User.Manager?.Manager ?? 1) == 1`, true, true},
+		{`User.Any in [nil]`, true, false},
+		{`nil in [User.Any]`, true, false},
+		{`User.Manager in [nil]`, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(Env{}))
+			require.NoError(t, err)
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.loose, out)
+
+			program, err = expr.Compile(tt.code, expr.Env(Env{}), expr.StrictNil())
+			require.NoError(t, err)
+			out, err = expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, tt.strict, out)
 		})
 	}
 }
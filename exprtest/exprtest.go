@@ -0,0 +1,252 @@
+// Package exprtest provides helpers for unit testing expressions: fake
+// environments built from a types.Map schema, and table-driven cases which
+// can be stored as JSON next to the rules they test.
+package exprtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/checker/nature"
+	"github.com/expr-lang/expr/types"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Case is a single test case: the env overrides for the case, and either the
+// expected result or a substring of the expected error.
+type Case struct {
+	Name  string         `json:"name"`
+	Env   map[string]any `json:"env"`
+	Want  any            `json:"want"`
+	Error string         `json:"error"`
+}
+
+// Failure describes a case whose result differs from the expected one.
+type Failure struct {
+	Case Case
+	Got  any
+	Err  error
+	Diff string
+}
+
+func (f Failure) Error() string {
+	return fmt.Sprintf("%s: %s", f.Case.Name, f.Diff)
+}
+
+// ReadCases decodes a JSON array of cases. Cases without a name are named
+// after their position.
+func ReadCases(r io.Reader) ([]Case, error) {
+	var cases []Case
+	if err := json.NewDecoder(r).Decode(&cases); err != nil {
+		return nil, fmt.Errorf("exprtest: %w", err)
+	}
+	for i := range cases {
+		if cases[i].Name == "" {
+			cases[i].Name = fmt.Sprintf("#%d", i)
+		}
+	}
+	return cases, nil
+}
+
+// Zero returns an env with a zero value for each key of the schema.
+// Nested maps are filled recursively, so an expression like user.name
+// can be evaluated without a nil map.
+func Zero(schema types.Map) map[string]any {
+	return build(schema.Nature(), false).(map[string]any)
+}
+
+// Sample returns an env with a non-zero sample value for each key of the
+// schema: 1 for numbers, "sample" for strings, true for bools and one
+// element arrays.
+func Sample(schema types.Map) map[string]any {
+	return build(schema.Nature(), true).(map[string]any)
+}
+
+func build(nt nature.Nature, sample bool) any {
+	if nt.Fields != nil && nt.ArrayOf == nil {
+		m := make(map[string]any, len(nt.Fields))
+		for k, v := range nt.Fields {
+			m[k] = build(v, sample)
+		}
+		return m
+	}
+	if nt.ArrayOf != nil {
+		if !sample {
+			return []any{}
+		}
+		return []any{build(*nt.ArrayOf, sample)}
+	}
+	if nt.Type == nil {
+		return nil
+	}
+	if sample {
+		return sampleOf(nt.Type).Interface()
+	}
+	return reflect.Zero(nt.Type).Interface()
+}
+
+func sampleOf(t reflect.Type) reflect.Value {
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1)
+	case reflect.String:
+		v.SetString("sample")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Slice:
+		v = reflect.Append(reflect.MakeSlice(t, 0, 1), sampleOf(t.Elem()))
+	case reflect.Map:
+		v = reflect.MakeMap(t)
+	case reflect.Ptr:
+		v = reflect.New(t.Elem())
+		v.Elem().Set(sampleOf(t.Elem()))
+	}
+	return v
+}
+
+// Env returns the env for a case: the zero env of the schema with the case
+// values merged in. Numbers decoded from JSON are converted to the types of
+// the schema, so 42 is an int if the schema says so.
+func Env(schema types.Map, c Case) map[string]any {
+	env := Zero(schema)
+	merge(env, c.Env, schema.Nature())
+	return env
+}
+
+func merge(dst, src map[string]any, nt nature.Nature) {
+	for k, v := range src {
+		field, ok := nt.Fields[k]
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		if m, ok := v.(map[string]any); ok && field.Fields != nil {
+			if d, ok := dst[k].(map[string]any); ok {
+				merge(d, m, field)
+				continue
+			}
+		}
+		dst[k] = convert(v, field)
+	}
+}
+
+func convert(v any, nt nature.Nature) any {
+	if v == nil {
+		return nil
+	}
+	if nt.ArrayOf != nil {
+		if a, ok := v.([]any); ok {
+			out := make([]any, len(a))
+			for i, e := range a {
+				out[i] = convert(e, *nt.ArrayOf)
+			}
+			return out
+		}
+		return v
+	}
+	if nt.Type == nil {
+		return v
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Type() != nt.Type && rv.Type().ConvertibleTo(nt.Type) && isNumber(rv.Kind()) && isNumber(nt.Type.Kind()) {
+		return rv.Convert(nt.Type).Interface()
+	}
+	return v
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// Run runs the program for each case and returns the failed ones.
+// Results are compared by their JSON representation, so 1 and 1.0, or
+// []int{1} and []any{1}, are equal.
+func Run(program *vm.Program, schema types.Map, cases []Case) []Failure {
+	var failures []Failure
+	for _, c := range cases {
+		got, err := expr.Run(program, Env(schema, c))
+		if f, ok := check(c, got, err); !ok {
+			failures = append(failures, f)
+		}
+	}
+	return failures
+}
+
+func check(c Case, got any, err error) (Failure, bool) {
+	f := Failure{Case: c, Got: got, Err: err}
+	if c.Error != "" {
+		if err == nil {
+			f.Diff = fmt.Sprintf("want error %q, got %s", c.Error, encode(got))
+			return f, false
+		}
+		if !strings.Contains(err.Error(), c.Error) {
+			f.Diff = fmt.Sprintf("want error %q, got error %q", c.Error, err.Error())
+			return f, false
+		}
+		return f, true
+	}
+	if err != nil {
+		f.Diff = fmt.Sprintf("want %s, got error %q", encode(c.Want), err.Error())
+		return f, false
+	}
+	if !reflect.DeepEqual(normalize(c.Want), normalize(got)) {
+		f.Diff = fmt.Sprintf("want %s, got %s", encode(c.Want), encode(got))
+		return f, false
+	}
+	return f, true
+}
+
+func normalize(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return v
+	}
+	return out
+}
+
+func encode(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+// Test compiles the expression against the schema and runs each case as a
+// subtest, reporting the difference for failed cases.
+func Test(t *testing.T, code string, schema types.Map, cases []Case, opts ...expr.Option) {
+	t.Helper()
+	program, err := expr.Compile(code, append([]expr.Option{expr.Env(schema)}, opts...)...)
+	if err != nil {
+		t.Fatalf("compile %q: %v", code, err)
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			got, err := expr.Run(program, Env(schema, c))
+			if f, ok := check(c, got, err); !ok {
+				t.Error(f.Diff)
+			}
+		})
+	}
+}
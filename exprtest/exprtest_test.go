@@ -0,0 +1,80 @@
+package exprtest_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/exprtest"
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+	"github.com/expr-lang/expr/types"
+)
+
+var schema = types.Map{
+	"user": types.Map{
+		"name": types.String,
+		"age":  types.Int,
+	},
+	"tags":  types.Array(types.String),
+	"limit": types.Float64,
+}
+
+func TestZero(t *testing.T) {
+	env := exprtest.Zero(schema)
+	assert.Equal(t, map[string]any{
+		"user":  map[string]any{"name": "", "age": 0},
+		"tags":  []any{},
+		"limit": 0.0,
+	}, env)
+}
+
+func TestSample(t *testing.T) {
+	env := exprtest.Sample(schema)
+	assert.Equal(t, map[string]any{
+		"user":  map[string]any{"name": "sample", "age": 1},
+		"tags":  []any{"sample"},
+		"limit": 1.0,
+	}, env)
+}
+
+func TestReadCases(t *testing.T) {
+	cases, err := exprtest.ReadCases(strings.NewReader(`[
+		{"name": "adult", "env": {"user": {"age": 30}}, "want": true},
+		{"env": {"user": {"age": 10}}, "want": false}
+	]`))
+	require.NoError(t, err)
+	require.Len(t, cases, 2)
+	assert.Equal(t, "adult", cases[0].Name)
+	assert.Equal(t, "#1", cases[1].Name)
+
+	env := exprtest.Env(schema, cases[0])
+	assert.Equal(t, map[string]any{"name": "", "age": 30}, env["user"])
+
+	_, err = exprtest.ReadCases(strings.NewReader(`{`))
+	require.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	program, err := expr.Compile(`user.age >= 18 ? tags : 12 % user.age`, expr.Env(schema))
+	require.NoError(t, err)
+
+	cases := []exprtest.Case{
+		{Name: "adult", Env: map[string]any{"user": map[string]any{"age": 30.0}, "tags": []any{"a"}}, Want: []any{"a"}},
+		{Name: "child", Env: map[string]any{"user": map[string]any{"age": 5.0}}, Want: 2.0},
+		{Name: "wrong", Env: map[string]any{"user": map[string]any{"age": 5.0}}, Want: 3},
+		{Name: "error", Want: nil, Error: "integer divide by zero"},
+		{Name: "missing error", Env: map[string]any{"user": map[string]any{"age": 20.0}}, Error: "boom"},
+	}
+	failures := exprtest.Run(program, schema, cases)
+	require.Len(t, failures, 2)
+	assert.Equal(t, "wrong: want 3, got 2", failures[0].Error())
+	assert.Equal(t, `missing error: want error "boom", got []`, failures[1].Error())
+}
+
+func TestTest(t *testing.T) {
+	exprtest.Test(t, `user.name + "!"`, schema, []exprtest.Case{
+		{Name: "empty", Want: "!"},
+		{Name: "name", Env: map[string]any{"user": map[string]any{"name": "Bob"}}, Want: "Bob!"},
+	})
+}
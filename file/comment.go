@@ -0,0 +1,7 @@
+package file
+
+// Comment is a comment of the source, like // or /* */, with its delimiters.
+type Comment struct {
+	Location Location
+	Text     string
+}
@@ -2,9 +2,14 @@ package deref
 
 import (
 	"fmt"
+	"math/big"
 	"reflect"
 )
 
+// decimalType is the type of the decimals of the decimal mode. They are
+// values, like numbers, so they are never dereferenced.
+var decimalType = reflect.TypeOf(&big.Rat{})
+
 func Interface(p any) any {
 	if p == nil {
 		return nil
@@ -23,7 +28,7 @@ func Type(t reflect.Type) reflect.Type {
 	if t == nil {
 		return nil
 	}
-	for t.Kind() == reflect.Ptr {
+	for t.Kind() == reflect.Ptr && t != decimalType {
 		t = t.Elem()
 	}
 	return t
@@ -32,7 +37,7 @@ func Type(t reflect.Type) reflect.Type {
 // Value 对 v 进行指针的循环解引用，直到拿到实际的值。
 func Value(v reflect.Value) reflect.Value {
 	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
-		if v.IsNil() {
+		if v.IsNil() || v.Type() == decimalType {
 			return v
 		}
 		v = v.Elem()
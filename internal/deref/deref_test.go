@@ -1,6 +1,7 @@
 package deref_test
 
 import (
+	"math/big"
 	"reflect"
 	"testing"
 
@@ -35,6 +36,12 @@ func TestDeref_nil(t *testing.T) {
 	assert.Nil(t, deref.Interface(nil))
 }
 
+func TestDeref_decimal(t *testing.T) {
+	d := big.NewRat(1, 2)
+	assert.Same(t, d, deref.Interface(&d))
+	assert.Equal(t, reflect.TypeOf(d), deref.Type(reflect.TypeOf(&d)))
+}
+
 func TestType(t *testing.T) {
 	a := uint(42)
 	b := &a
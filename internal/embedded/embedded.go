@@ -0,0 +1,106 @@
+// Package embedded finds the fields of structs promoted from embedded
+// structs, so the checker and the vm find the same fields.
+package embedded
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/expr-lang/expr/internal/deref"
+)
+
+// tables caches the field tables of struct types by their naming.
+var tables sync.Map // map[table]map[string]reflect.StructField
+
+// table is a struct type and how its fields are named: by their Go names,
+// or like Name with the tags, joined by NULs.
+type table struct {
+	t       reflect.Type
+	tags    string
+	goNames bool
+}
+
+// Fields returns the fields of struct t by their names, see Name, with the
+// fields of its embedded structs, and of structs embedded by pointers,
+// promoted. A name is taken from the shallowest depth, like Go does; if
+// several embedded structs at that depth have it, the first one wins. The
+// index of a promoted field goes through the embedded structs.
+//
+// The fields are cached per type and tags, and must not be modified.
+func Fields(t reflect.Type, tags ...string) map[string]reflect.StructField {
+	return cached(table{t: t, tags: strings.Join(tags, "\x00")}, func(field reflect.StructField) string {
+		return Name(field, tags...)
+	})
+}
+
+// GoFields is like Fields, with the fields named by their Go names.
+func GoFields(t reflect.Type) map[string]reflect.StructField {
+	return cached(table{t: t, goNames: true}, func(field reflect.StructField) string {
+		return field.Name
+	})
+}
+
+func cached(key table, name func(reflect.StructField) string) map[string]reflect.StructField {
+	if fields, ok := tables.Load(key); ok {
+		return fields.(map[string]reflect.StructField)
+	}
+	fields, _ := tables.LoadOrStore(key, fields(key.t, name))
+	return fields.(map[string]reflect.StructField)
+}
+
+func fields(t reflect.Type, name func(reflect.StructField) string) map[string]reflect.StructField {
+	type embedding struct {
+		t     reflect.Type
+		index []int
+	}
+
+	fields := make(map[string]reflect.StructField)
+	visited := map[reflect.Type]bool{}
+	current := []embedding{{t: t}}
+	for len(current) > 0 {
+		var next []embedding
+		level := map[string]reflect.StructField{}
+		for _, s := range current {
+			if visited[s.t] {
+				continue
+			}
+			visited[s.t] = true
+			for i := 0; i < s.t.NumField(); i++ {
+				f := s.t.Field(i)
+				f.Index = append(append([]int{}, s.index...), i)
+				if _, ok := level[name(f)]; !ok {
+					level[name(f)] = f
+				}
+				if f.Anonymous {
+					if ft := deref.Type(f.Type); ft.Kind() == reflect.Struct {
+						next = append(next, embedding{t: ft, index: f.Index})
+					}
+				}
+			}
+		}
+		for n, f := range level {
+			if _, ok := fields[n]; !ok {
+				fields[n] = f
+			}
+		}
+		current = next
+	}
+	return fields
+}
+
+// Name returns the name of the field in expressions: its expr tag, else the
+// first of the tags it has, else its Go name. The tags are read like json
+// tags: options after a comma are dropped, and "-" is no name.
+func Name(field reflect.StructField, tags ...string) string {
+	if tag := field.Tag.Get("expr"); tag != "" {
+		return tag
+	}
+	for _, key := range tags {
+		tag, _, _ := strings.Cut(field.Tag.Get(key), ",")
+		if tag != "" && tag != "-" {
+			return tag
+		}
+	}
+	return field.Name
+}
@@ -0,0 +1,74 @@
+package embedded_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/expr-lang/expr/internal/embedded"
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+)
+
+type Header struct {
+	ID   string
+	Kind string
+}
+
+type Base struct {
+	*Header
+	Kind int
+}
+
+type Other struct {
+	ID int
+}
+
+type Request struct {
+	*Base
+	Other
+	Path string `expr:"path"`
+}
+
+func TestFields(t *testing.T) {
+	fields := embedded.Fields(reflect.TypeOf(Request{}))
+
+	path, ok := fields["path"]
+	require.True(t, ok)
+	assert.Equal(t, []int{2}, path.Index)
+
+	// Kind of Base is shallower than Kind of Header.
+	kind, ok := fields["Kind"]
+	require.True(t, ok)
+	assert.Equal(t, reflect.Int, kind.Type.Kind())
+	assert.Equal(t, []int{0, 1}, kind.Index)
+
+	// ID of Other is shallower than ID of Header, which is embedded by
+	// a pointer.
+	id, ok := fields["ID"]
+	require.True(t, ok)
+	assert.Equal(t, []int{1, 0}, id.Index)
+
+	header, ok := fields["Header"]
+	require.True(t, ok)
+	assert.Equal(t, []int{0, 0}, header.Index)
+
+	_, ok = fields["Path"]
+	assert.False(t, ok)
+}
+
+type Tagged struct {
+	Name string `json:"name"`
+}
+
+func TestFields_cache(t *testing.T) {
+	typ := reflect.TypeOf(Tagged{})
+
+	fields := embedded.Fields(typ, "json")
+	assert.Equal(t, reflect.ValueOf(fields).Pointer(), reflect.ValueOf(embedded.Fields(typ, "json")).Pointer())
+	assert.Contains(t, fields, "name")
+
+	// The naming is part of the key.
+	assert.Contains(t, embedded.Fields(typ), "Name")
+	assert.NotContains(t, embedded.Fields(typ), "name")
+	assert.Contains(t, embedded.GoFields(typ), "Name")
+}
@@ -7,6 +7,7 @@ import (
 
 	. "github.com/expr-lang/expr/ast"
 	"github.com/expr-lang/expr/file"
+	"github.com/expr-lang/expr/vm/runtime"
 )
 
 var errorType = reflect.TypeOf((*error)(nil)).Elem()
@@ -57,13 +58,7 @@ func (c *constExpr) Visit(node *Node) {
 						return // Const expr optimization not applicable.
 					}
 
-					if param == nil && reflect.TypeOf(param) == nil {
-						// In case of nil value and nil type use this hack,
-						// otherwise reflect.Call will panic on zero value.
-						in[i] = reflect.ValueOf(&param).Elem()
-					} else {
-						in[i] = reflect.ValueOf(param)
-					}
+					in[i] = runtime.ParamValue(runtime.ParamType(fn.Type(), i), param)
 				}
 
 				out := fn.Call(in)
@@ -0,0 +1,131 @@
+package optimizer
+
+import (
+	"sort"
+
+	. "github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/conf"
+)
+
+// costReorder moves operands of `and`/`or` chains which call functions with
+// a declared cost after the cheaper operands, so the costly calls are skipped
+// whenever a cheaper operand decides the chain:
+//
+//	fetchScore(user) > 10 and user.Age > 18 -> user.Age > 18 and fetchScore(user) > 10
+//
+// Unlike Reorder it needs no profile, only conf.Config.CostOf. Operands which
+// call functions without a declared cost, read the clock, guard against nil or
+// can fail, like xs[0] or int(s) after nonEmpty(xs), are never moved and split
+// the chain into independently sorted segments.
+type costReorder struct {
+	config *conf.Config
+	inner  map[Node]bool
+}
+
+func (r *costReorder) Visit(node *Node) {
+	n, ok := (*node).(*BinaryNode)
+	if !ok || !isChainOperator(n.Operator) || r.inner[n] {
+		return
+	}
+
+	operands := flattenChain(n, n.Operator, nil)
+	costs := make(map[Node]float64, len(operands))
+	for _, operand := range operands {
+		costs[operand] = r.cost(operand)
+	}
+
+	ordered := make([]Node, len(operands))
+	copy(ordered, operands)
+	for start := 0; start < len(ordered); {
+		if costs[ordered[start]] < 0 {
+			start++
+			continue
+		}
+		end := start
+		for end < len(ordered) && costs[ordered[end]] >= 0 {
+			end++
+		}
+		segment := ordered[start:end]
+		sort.SliceStable(segment, func(i, j int) bool {
+			return costs[segment[i]] < costs[segment[j]]
+		})
+		start = end
+	}
+
+	changed := false
+	for i := range operands {
+		if operands[i] != ordered[i] {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return
+	}
+
+	newNode := ordered[0]
+	for _, operand := range ordered[1:] {
+		newNode = &BinaryNode{
+			Operator: n.Operator,
+			Left:     newNode,
+			Right:    operand,
+		}
+		newNode.SetType(boolType)
+	}
+	patchCopyType(node, newNode)
+}
+
+// cost sums the declared costs of the calls of the operand. It is negative
+// if the operand must not be moved.
+func (r *costReorder) cost(node Node) float64 {
+	var cost float64
+	pin := Find(node, func(n Node) bool {
+		if call, ok := n.(*CallNode); ok {
+			c := r.config.CostOf(calleeName(call))
+			if c <= 0 {
+				return true
+			}
+			cost += c
+			return false
+		}
+		return pinned(n)
+	})
+	if pin != nil {
+		return -1
+	}
+	return cost
+}
+
+// calleeName returns the name of the called function or method, or an empty
+// string for other callees, like calls of call results.
+func calleeName(call *CallNode) string {
+	switch c := call.Callee.(type) {
+	case *IdentifierNode:
+		return c.Value
+	case *MemberNode:
+		if name, ok := c.Property.(*StringNode); ok {
+			return name.Value
+		}
+	}
+	return ""
+}
+
+// hasCosts reports whether any function or method has a declared cost.
+func hasCosts(config *conf.Config) bool {
+	if len(config.Costs) > 0 {
+		return true
+	}
+	for _, fn := range config.Functions {
+		if fn.Cost > 0 {
+			return true
+		}
+	}
+	for _, ns := range config.Namespaces {
+		for _, fn := range ns {
+			if fn.Cost > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package optimizer_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/builtin"
+	"github.com/expr-lang/expr/conf"
+)
+
+type costEnv struct {
+	Age   int
+	Name  *string
+	Calls int
+}
+
+func (e *costEnv) Fetch(n int) int {
+	e.Calls++
+	return n
+}
+
+func (e *costEnv) Lookup(n int) int {
+	e.Calls++
+	return n
+}
+
+func (e *costEnv) Log(n int) bool {
+	return true
+}
+
+func TestOptimize_cost(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{`Fetch(1) > 0 and Age > 18`, `Age > 18 and Fetch(1) > 0`},
+		{`Fetch(1) > 0 || Lookup(1) > 0 || Age > 18`, `Age > 18 || Lookup(1) > 0 || Fetch(1) > 0`},
+		{`Age > 18 and Fetch(1) > 0`, `Age > 18 and Fetch(1) > 0`},
+		{`Fetch(1) > 0 and Log(1) and Age > 18`, `Fetch(1) > 0 and Log(1) and Age > 18`},
+		{`Fetch(1) > 0 and Name != nil and Age > 18`, `Fetch(1) > 0 and Name != nil and Age > 18`},
+		{`(Fetch(1) > 0 or Age > 1) and Age > 18`, `Age > 18 and (Age > 1 or Fetch(1) > 0)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(&costEnv{}), expr.Cost("Fetch", 1000), expr.Cost("Lookup", 10))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, program.Node().String())
+		})
+	}
+}
+
+func TestOptimize_cost_skips_calls(t *testing.T) {
+	program, err := expr.Compile(`Fetch(1) > 0 and Age > 18`, expr.Env(&costEnv{}), expr.Cost("Fetch", 1000))
+	require.NoError(t, err)
+
+	env := &costEnv{Age: 10}
+	out, err := expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, false, out)
+	assert.Equal(t, 0, env.Calls)
+}
+
+func TestOptimize_cost_function(t *testing.T) {
+	rpc := expr.Function("rpc", func(params ...any) (any, error) {
+		return true, nil
+	}, new(func(int) bool))
+	withCost := func(c *conf.Config) {
+		c.Functions["rpc"] = &builtin.Function{
+			Name:  c.Functions["rpc"].Name,
+			Func:  c.Functions["rpc"].Func,
+			Types: c.Functions["rpc"].Types,
+			Cost:  500,
+		}
+	}
+
+	program, err := expr.Compile(`rpc(1) or Age > 18`, expr.Env(&costEnv{}), rpc, withCost)
+	require.NoError(t, err)
+	assert.Equal(t, `Age > 18 or rpc(1)`, program.Node().String())
+
+	program, err = expr.Compile(`rpc(1) or Age > 18`, expr.Env(&costEnv{}), rpc, withCost, expr.Cost("rpc", 0))
+	require.NoError(t, err)
+	assert.Equal(t, `rpc(1) or Age > 18`, program.Node().String())
+}
+
+func TestOptimize_cost_guards(t *testing.T) {
+	nonEmpty := expr.Function("nonEmpty", func(params ...any) (any, error) {
+		return reflect.ValueOf(params[0]).Len() > 0, nil
+	}, new(func([]int) bool), new(func(string) bool))
+	env := map[string]any{"xs": []int{}, "m": map[string]int{}, "s": ""}
+
+	tests := []struct {
+		code string
+		want string
+	}{
+		{`nonEmpty(xs) and xs[0] > 1`, `nonEmpty(xs) and xs[0] > 1`},
+		{`nonEmpty(xs) and 10 % len(xs) == 1`, `nonEmpty(xs) and 10 % len(xs) == 1`},
+		{`nonEmpty(xs) and m.a > 1`, `m.a > 1 and nonEmpty(xs)`},
+		{`nonEmpty(s) and int(s) > 5`, `nonEmpty(s) and int(s) > 5`},
+		{`nonEmpty(s) and duration(s) > duration("5s")`, `nonEmpty(s) and duration(s) > duration("5s")`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, expr.Env(env), nonEmpty, expr.Cost("nonEmpty", 100))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, program.Node().String())
+
+			out, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, false, out)
+		})
+	}
+}
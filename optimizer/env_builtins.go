@@ -0,0 +1,41 @@
+package optimizer
+
+import (
+	"reflect"
+
+	. "github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/builtin"
+	"github.com/expr-lang/expr/internal/deref"
+)
+
+// envBuiltins replaces envKeys() and envHas("name") with constants when the
+// env is a struct, whose fields are known when the expression is compiled.
+type envBuiltins struct {
+	env any // zero value of the struct
+}
+
+func (e *envBuiltins) Visit(node *Node) {
+	b, ok := (*node).(*BuiltinNode)
+	if !ok {
+		return
+	}
+	switch {
+	case b.Name == "envKeys" && len(b.Arguments) == 0:
+		patchWithType(node, &ConstantNode{Value: builtin.EnvKeys(e.env)})
+	case b.Name == "envHas" && len(b.Arguments) == 1:
+		if name, ok := b.Arguments[0].(*StringNode); ok {
+			patchWithType(node, &BoolNode{Value: builtin.EnvHas(e.env, name.Value)})
+		}
+	}
+}
+
+// structEnv returns the zero value of a struct env, or nil.
+func structEnv(t reflect.Type) any {
+	if t == nil {
+		return nil
+	}
+	if t = deref.Type(t); t.Kind() == reflect.Struct {
+		return reflect.Zero(t).Interface()
+	}
+	return nil
+}
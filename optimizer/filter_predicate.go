@@ -0,0 +1,64 @@
+package optimizer
+
+import (
+	. "github.com/expr-lang/expr/ast"
+)
+
+/*
+filterPredicate fuses a filter into the predicate of the builtin consuming
+it, so no intermediate array is allocated:
+
+	count(filter(xs, p), q) -> count(xs, p && q)
+	any(filter(xs, p), q)   -> any(xs, p && q)
+	one(filter(xs, p), q)   -> one(xs, p && q)
+	none(filter(xs, p), q)  -> none(xs, p && q)
+	find(filter(xs, p), q)  -> find(xs, p && q)
+	all(filter(xs, p), q)   -> all(xs, !p || q)
+
+Predicates using #index are kept as is, as indexes of the filtered array
+differ from the original ones.
+*/
+type filterPredicate struct{}
+
+func (*filterPredicate) Visit(node *Node) {
+	builtin, ok := (*node).(*BuiltinNode)
+	if !ok || len(builtin.Arguments) != 2 {
+		return
+	}
+	switch builtin.Name {
+	case "count", "any", "one", "none", "find", "findLast", "all":
+	default:
+		return
+	}
+	outer, ok := builtin.Arguments[1].(*PredicateNode)
+	if !ok {
+		return
+	}
+	filter, ok := builtin.Arguments[0].(*BuiltinNode)
+	if !ok || filter.Name != "filter" || filter.Map != nil || len(filter.Arguments) != 2 {
+		return
+	}
+	inner, ok := filter.Arguments[1].(*PredicateNode)
+	if !ok || Find(inner, isIndexPointer) != nil || Find(outer, isIndexPointer) != nil {
+		return
+	}
+
+	var combined Node
+	if builtin.Name == "all" {
+		not := &UnaryNode{Operator: "!", Node: inner.Node}
+		not.SetType(boolType)
+		combined = &BinaryNode{Operator: "||", Left: not, Right: outer.Node}
+	} else {
+		combined = &BinaryNode{Operator: "&&", Left: inner.Node, Right: outer.Node}
+	}
+	combined.SetType(boolType)
+
+	patchCopyType(node, &BuiltinNode{
+		Name: builtin.Name,
+		Arguments: []Node{
+			filter.Arguments[0],
+			&PredicateNode{Node: combined},
+		},
+		Throws: builtin.Throws,
+	})
+}
@@ -5,13 +5,28 @@ import (
 
 	. "github.com/expr-lang/expr/ast"
 	"github.com/expr-lang/expr/file"
+	"github.com/expr-lang/expr/vm/runtime"
 )
 
 type fold struct {
 	applied bool
+	checked bool // report integer overflow, see conf.Config.CheckedArithmetic
 	err     *file.Error
 }
 
+// overflow reports an error if checked arithmetic is enabled and an integer
+// operation did not fit in int.
+func (fold *fold) overflow(node *Node, ok bool) bool {
+	if ok || !fold.checked {
+		return false
+	}
+	fold.err = &file.Error{
+		Location: (*node).Location(),
+		Message:  "integer overflow",
+	}
+	return true
+}
+
 func (fold *fold) Visit(node *Node) {
 	patch := func(newNode Node) {
 		fold.applied = true
@@ -27,7 +42,10 @@ func (fold *fold) Visit(node *Node) {
 		switch n.Operator {
 		case "-":
 			if i, ok := n.Node.(*IntegerNode); ok {
-				patch(&IntegerNode{Value: -i.Value})
+				value, ok := runtime.NegateInt(i.Value)
+				if !fold.overflow(node, ok) {
+					patch(&IntegerNode{Value: value})
+				}
 			}
 			if i, ok := n.Node.(*FloatNode); ok {
 				patch(&FloatNode{Value: -i.Value})
@@ -52,7 +70,10 @@ func (fold *fold) Visit(node *Node) {
 				a := toInteger(n.Left)
 				b := toInteger(n.Right)
 				if a != nil && b != nil {
-					patch(&IntegerNode{Value: a.Value + b.Value})
+					value, ok := runtime.AddInt(a.Value, b.Value)
+					if !fold.overflow(node, ok) {
+						patch(&IntegerNode{Value: value})
+					}
 				}
 			}
 			{
@@ -88,7 +109,10 @@ func (fold *fold) Visit(node *Node) {
 				a := toInteger(n.Left)
 				b := toInteger(n.Right)
 				if a != nil && b != nil {
-					patch(&IntegerNode{Value: a.Value - b.Value})
+					value, ok := runtime.SubtractInt(a.Value, b.Value)
+					if !fold.overflow(node, ok) {
+						patch(&IntegerNode{Value: value})
+					}
 				}
 			}
 			{
@@ -117,7 +141,10 @@ func (fold *fold) Visit(node *Node) {
 				a := toInteger(n.Left)
 				b := toInteger(n.Right)
 				if a != nil && b != nil {
-					patch(&IntegerNode{Value: a.Value * b.Value})
+					value, ok := runtime.MultiplyInt(a.Value, b.Value)
+					if !fold.overflow(node, ok) {
+						patch(&IntegerNode{Value: value})
+					}
 				}
 			}
 			{
@@ -258,6 +285,18 @@ func (fold *fold) Visit(node *Node) {
 			}
 		}
 
+	case *ConditionalNode:
+		// Only the taken branch of a constant condition is kept. The branch
+		// keeps its own type, as the other one may have a different type.
+		if c, ok := constBool(n.Cond); ok {
+			fold.applied = true
+			if c {
+				Patch(node, n.Exp1)
+			} else {
+				Patch(node, n.Exp2)
+			}
+		}
+
 	case *ArrayNode:
 		if len(n.Nodes) > 0 {
 			for _, a := range n.Nodes {
@@ -332,6 +371,17 @@ func toFloat(n Node) *FloatNode {
 	return nil
 }
 
+func constBool(n Node) (bool, bool) {
+	switch a := n.(type) {
+	case *BoolNode:
+		return a.Value, true
+	case *ConstantNode:
+		b, ok := a.Value.(bool)
+		return b, ok
+	}
+	return false, false
+}
+
 func toBool(n Node) *BoolNode {
 	switch a := n.(type) {
 	case *BoolNode:
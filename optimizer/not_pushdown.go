@@ -0,0 +1,133 @@
+package optimizer
+
+import (
+	"reflect"
+
+	. "github.com/expr-lang/expr/ast"
+)
+
+/*
+notPushdown is a visitor that pushes negation into comparisons and boolean
+operators. For example, the following expressions:
+
+	not (a > b)        -> a <= b
+	not (a == b)       -> a != b
+	not (not a)        -> a
+	not (a and b > 1)  -> (not a) or b <= 1
+
+Ordering comparisons are only flipped for integer and string operands: for
+floats `not (a > b)` and `a <= b` differ when one side is NaN. De Morgan
+rewrites are only applied to boolean operands and only when at least one side
+can be negated without a `not`, so the bytecode never grows.
+*/
+type notPushdown struct{}
+
+func (*notPushdown) Visit(node *Node) {
+	if n, ok := (*node).(*UnaryNode); ok && isNot(n.Operator) {
+		if negated, ok := negate(n.Node, n.Operator); ok {
+			patchCopyType(node, negated)
+		}
+	}
+}
+
+var negatedComparison = map[string]string{
+	"<":  ">=",
+	">":  "<=",
+	"<=": ">",
+	">=": "<",
+}
+
+// negate returns a node equivalent to `not node` without the leading `not`.
+func negate(node Node, not string) (Node, bool) {
+	switch n := node.(type) {
+	case *UnaryNode:
+		if isNot(n.Operator) && isBool(n.Node) {
+			return n.Node, true
+		}
+
+	case *BinaryNode:
+		switch n.Operator {
+		case "==":
+			return negatedBinary(n, "!="), true
+		case "!=":
+			return negatedBinary(n, "=="), true
+		case "<", ">", "<=", ">=":
+			if isTotallyOrdered(n.Left) && isTotallyOrdered(n.Right) {
+				return negatedBinary(n, negatedComparison[n.Operator]), true
+			}
+		case "and", "&&", "or", "||":
+			if !isBool(n.Left) || !isBool(n.Right) {
+				return nil, false
+			}
+			left, okLeft := negate(n.Left, not)
+			right, okRight := negate(n.Right, not)
+			if !okLeft && !okRight {
+				return nil, false
+			}
+			if !okLeft {
+				left = negatedUnary(n.Left, not)
+			}
+			if !okRight {
+				right = negatedUnary(n.Right, not)
+			}
+			return negatedBinary(&BinaryNode{
+				Operator: n.Operator,
+				Left:     left,
+				Right:    right,
+			}, deMorgan(n.Operator)), true
+		}
+	}
+	return nil, false
+}
+
+func negatedBinary(n *BinaryNode, op string) Node {
+	newNode := &BinaryNode{
+		Operator: op,
+		Left:     n.Left,
+		Right:    n.Right,
+	}
+	newNode.SetLocation(n.Location())
+	newNode.SetType(boolType)
+	return newNode
+}
+
+func negatedUnary(node Node, not string) Node {
+	newNode := &UnaryNode{
+		Operator: not,
+		Node:     node,
+	}
+	newNode.SetLocation(node.Location())
+	newNode.SetType(boolType)
+	return newNode
+}
+
+func deMorgan(op string) string {
+	switch op {
+	case "and":
+		return "or"
+	case "&&":
+		return "||"
+	case "or":
+		return "and"
+	default:
+		return "&&"
+	}
+}
+
+func isNot(op string) bool {
+	return op == "not" || op == "!"
+}
+
+func isBool(node Node) bool {
+	return node.Type().Kind() == reflect.Bool
+}
+
+func isTotallyOrdered(node Node) bool {
+	switch node.Type().Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.String:
+		return true
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package optimizer
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 
@@ -9,9 +10,19 @@ import (
 )
 
 func Optimize(node *Node, config *conf.Config) error {
+	return OptimizeContext(context.Background(), node, config)
+}
+
+// OptimizeContext optimizes the tree like Optimize, aborting once ctx is
+// canceled or its deadline is exceeded. The context is checked between
+// passes, and the error of ctx is returned as is.
+func OptimizeContext(ctx context.Context, node *Node, config *conf.Config) error {
 	Walk(node, &inArray{})
 	for limit := 1000; limit >= 0; limit-- {
-		fold := &fold{}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fold := &fold{checked: config != nil && config.CheckedArithmetic}
 		Walk(node, fold)
 		if fold.err != nil {
 			return fold.err
@@ -22,6 +33,9 @@ func Optimize(node *Node, config *conf.Config) error {
 	}
 	if config != nil && len(config.ConstFns) > 0 {
 		for limit := 100; limit >= 0; limit-- {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			constExpr := &constExpr{
 				fns: config.ConstFns,
 			}
@@ -34,14 +48,39 @@ func Optimize(node *Node, config *conf.Config) error {
 			}
 		}
 	}
-	Walk(node, &inRange{})
-	Walk(node, &filterMap{})
-	Walk(node, &filterLen{})
-	Walk(node, &filterLast{})
-	Walk(node, &filterFirst{})
-	Walk(node, &predicateCombination{})
-	Walk(node, &sumArray{})
-	Walk(node, &sumMap{})
+	passes := []Visitor{
+		&inRange{},
+		&notPushdown{},
+		&filterMap{},
+		&filterLen{},
+		&filterLast{},
+		&filterFirst{},
+		&filterPredicate{},
+		&predicateCombination{},
+		&sumArray{},
+		&sumMap{},
+	}
+	// The cases of a switch share a single jump, which coverage can't count
+	// as the branches of the conditionals.
+	if config == nil || !config.Coverage {
+		passes = append(passes, &switchJump{})
+	}
+	for _, pass := range passes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		Walk(node, pass)
+	}
+	if config != nil {
+		if env := structEnv(config.Env.Type); env != nil {
+			Walk(node, &envBuiltins{env: env})
+		}
+	}
+	if config != nil && hasCosts(config) {
+		inner := map[Node]bool{}
+		Walk(node, &chainMarker{inner: inner})
+		Walk(node, &costReorder{config: config, inner: inner})
+	}
 	return nil
 }
 
@@ -2,6 +2,7 @@ package optimizer_test
 
 import (
 	"fmt"
+	"math"
 	"strings"
 	"testing"
 
@@ -173,6 +174,113 @@ func TestOptimize_const_expr(t *testing.T) {
 	assert.Equal(t, ast.Dump(expected), ast.Dump(tree.Node))
 }
 
+func TestOptimize_not_pushdown(t *testing.T) {
+	env := map[string]any{
+		"a":  1,
+		"b":  2,
+		"f":  1.5,
+		"s":  "foo",
+		"ok": true,
+	}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`not (a > b)`, `a <= b`},
+		{`!(a <= b)`, `a > b`},
+		{`not (s < "bar")`, `s >= "bar"`},
+		{`not (a == b)`, `a != b`},
+		{`not (a != b)`, `a == b`},
+		{`not not ok`, `ok`},
+		{`not (a > 1 and b < 2)`, `a <= 1 or b >= 2`},
+		{`!(a > 1 || ok)`, `a <= 1 && !ok`},
+		{`not (ok and not ok)`, `not ok or ok`},
+		{`not (f > 1)`, `not (f > 1)`},
+		{`not (ok and ok)`, `not (ok and ok)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			tree, err := parser.Parse(tt.expr)
+			require.NoError(t, err)
+
+			_, err = checker.Check(tree, conf.New(env))
+			require.NoError(t, err)
+
+			err = optimizer.Optimize(&tree.Node, nil)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, tree.Node.String())
+		})
+	}
+}
+
+func TestOptimize_not_pushdown_nan(t *testing.T) {
+	env := map[string]any{"f": math.NaN()}
+
+	out, err := expr.Eval(`not (f > 1)`, env)
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+}
+
+func TestOptimize_dead_branch(t *testing.T) {
+	env := map[string]any{
+		"a":    1,
+		"s":    "foo",
+		"flag": false,
+	}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`true ? a : s`, `a`},
+		{`false ? a : s`, `s`},
+		{`1 == 1 && true ? a + 1 : s`, `a + 1`},
+		{`if not true { a } else { s + "bar" }`, `s + "bar"`},
+		{`false ? a : (true ? s : a)`, `s`},
+		{`flag ? a : s`, `flag ? a : s`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			tree, err := parser.Parse(tt.expr)
+			require.NoError(t, err)
+
+			_, err = checker.Check(tree, conf.New(env))
+			require.NoError(t, err)
+
+			err = optimizer.Optimize(&tree.Node, nil)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, tree.Node.String())
+		})
+	}
+}
+
+func TestOptimize_dead_branch_patched_flag(t *testing.T) {
+	env := map[string]any{"a": 1, "s": "foo"}
+
+	program, err := expr.Compile(`beta ? a : s`, expr.Env(env), expr.Patch(flagPatcher{"beta": true}))
+	require.NoError(t, err)
+	assert.NotContains(t, program.Disassemble(), "OpJumpIfFalse")
+
+	out, err := expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, out)
+}
+
+type flagPatcher map[string]bool
+
+func (p flagPatcher) Visit(node *ast.Node) {
+	if id, ok := (*node).(*ast.IdentifierNode); ok {
+		if v, ok := p[id.Value]; ok {
+			ast.Patch(node, &ast.BoolNode{Value: v})
+		}
+	}
+}
+
 func TestOptimize_filter_len(t *testing.T) {
 	tree, err := parser.Parse(`len(filter(users, .Name == "Bob"))`)
 	require.NoError(t, err)
@@ -284,6 +392,41 @@ func TestOptimize_filter_minus_1(t *testing.T) {
 	assert.Equal(t, ast.Dump(expected), ast.Dump(tree.Node))
 }
 
+func TestOptimize_filter_predicate(t *testing.T) {
+	env := map[string]any{"xs": []int{1, 2, 3, 4, 5}}
+
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`count(filter(xs, # > 1), # < 4)`, `count(xs, # > 1 && # < 4)`},
+		{`any(filter(xs, # > 1), # == 1)`, `any(xs, # > 1 && # == 1)`},
+		{`one(filter(xs, # > 1), # % 2 == 0)`, `one(xs, # > 1 && # % 2 == 0)`},
+		{`none(filter(xs, # > 1), # > 5)`, `none(xs, # > 1 && # > 5)`},
+		{`find(filter(xs, # > 1), # % 2 == 1)`, `find(xs, # > 1 && # % 2 == 1)`},
+		{`all(filter(xs, # > 1), # > 1)`, `all(xs, !(# > 1) || # > 1)`},
+		{`xs | filter(# > 2) | any(# == 2)`, `any(xs, # > 2 && # == 2)`},
+		{`any(map(filter(xs, # > 1), # * 10), # == 20)`, `any(filter(xs, # > 1), # == 20)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			program, err := expr.Compile(tt.expr, expr.Env(env))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, program.Node().String())
+
+			unoptimized, err := expr.Compile(tt.expr, expr.Env(env), expr.Optimize(false))
+			require.NoError(t, err)
+
+			want, err := expr.Run(unoptimized, env)
+			require.NoError(t, err)
+			got, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
 func TestOptimize_filter_last(t *testing.T) {
 	tree, err := parser.Parse(`last(filter(users, .Name == "Bob"))`)
 	require.NoError(t, err)
@@ -0,0 +1,300 @@
+package optimizer
+
+import (
+	"math"
+	"reflect"
+	"sort"
+
+	. "github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+)
+
+// ReorderReport describes boolean chains rewritten by Reorder.
+type ReorderReport struct {
+	Chains []ChainReport
+}
+
+// ChainReport describes a single reordered `and`/`or` chain. Costs are
+// estimated average nanoseconds per evaluation of the whole chain.
+type ChainReport struct {
+	Operator string
+	Before   []string
+	After    []string
+	Cost     float64
+	NewCost  float64
+}
+
+// Savings returns the estimated nanoseconds saved per evaluation.
+func (r *ReorderReport) Savings() float64 {
+	var saved float64
+	for _, c := range r.Chains {
+		saved += c.Cost - c.NewCost
+	}
+	return saved
+}
+
+/*
+Reorder rewrites `and`/`or` chains so that cheap and selective conditions are
+evaluated first, using the profile collected by a program compiled with
+conf.Config.Profile. The node is usually program.Node() or a tree parsed and
+optimized the same way, as spans are matched by expression text:
+
+	any(items, .Price > 100) and y == 1 -> y == 1 and any(items, .Price > 100)
+
+Operands are ranked by cost/(1-p) for `and` and cost/p for `or`, where p is
+the observed probability of the operand being true. Operands which call
+functions, read the clock, guard against nil (`x != nil`, `x?.y`) or can fail
+(`xs[0]`, `x % y`, `int(s)`) are never moved and split the chain into
+independently reordered segments, as are operands which were never evaluated
+while profiling.
+
+Reorder modifies the tree in place. It is meant to be run offline: its report
+should be reviewed before the rewritten expression replaces the original one.
+*/
+func Reorder(node *Node, profile *vm.Span) *ReorderReport {
+	r := &reorder{
+		stats:  map[string]*operandStats{},
+		inner:  map[Node]bool{},
+		keys:   map[Node]string{},
+		report: &ReorderReport{},
+	}
+	r.collect(profile)
+	Walk(node, &chainMarker{inner: r.inner, keys: r.keys})
+	Walk(node, r)
+	return r.report
+}
+
+type operandStats struct {
+	duration int64
+	count    int64
+	truths   int64
+}
+
+func (s *operandStats) cost() float64 {
+	return float64(s.duration) / float64(s.count)
+}
+
+func (s *operandStats) probability() float64 {
+	return float64(s.truths) / float64(s.count)
+}
+
+type reorder struct {
+	stats  map[string]*operandStats
+	inner  map[Node]bool
+	keys   map[Node]string // expression text of nodes before reordering
+	report *ReorderReport
+}
+
+func (r *reorder) collect(span *vm.Span) {
+	if span == nil {
+		return
+	}
+	s, ok := r.stats[span.Expression]
+	if !ok {
+		s = &operandStats{}
+		r.stats[span.Expression] = s
+	}
+	s.duration += span.Duration
+	s.count += span.Count
+	s.truths += span.True
+	for _, child := range span.Children {
+		r.collect(child)
+	}
+}
+
+// chainMarker marks `and`/`or` nodes which are operands of the same
+// operator, so only the outermost node of a chain is reordered. It also
+// remembers the original expression text of every node if keys is set, as
+// nested chains are rewritten before their parents are looked up in the
+// profile.
+type chainMarker struct {
+	inner map[Node]bool
+	keys  map[Node]string
+}
+
+func (m *chainMarker) Visit(node *Node) {
+	if m.keys != nil {
+		m.keys[*node] = (*node).String()
+	}
+	if n, ok := (*node).(*BinaryNode); ok && isChainOperator(n.Operator) {
+		if left, ok := n.Left.(*BinaryNode); ok && left.Operator == n.Operator {
+			m.inner[left] = true
+		}
+		if right, ok := n.Right.(*BinaryNode); ok && right.Operator == n.Operator {
+			m.inner[right] = true
+		}
+	}
+}
+
+func (r *reorder) Visit(node *Node) {
+	n, ok := (*node).(*BinaryNode)
+	if !ok || !isChainOperator(n.Operator) || r.inner[n] {
+		return
+	}
+
+	operands := flattenChain(n, n.Operator, nil)
+	and := n.Operator == "and" || n.Operator == "&&"
+
+	ordered := make([]Node, len(operands))
+	copy(ordered, operands)
+	for start := 0; start < len(ordered); {
+		if !r.movable(ordered[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(ordered) && r.movable(ordered[end]) {
+			end++
+		}
+		segment := ordered[start:end]
+		sort.SliceStable(segment, func(i, j int) bool {
+			return r.rank(segment[i], and) < r.rank(segment[j], and)
+		})
+		start = end
+	}
+
+	changed := false
+	for i := range operands {
+		if operands[i] != ordered[i] {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return
+	}
+
+	chain := ChainReport{
+		Operator: n.Operator,
+		Cost:     r.expectedCost(operands, and),
+		NewCost:  r.expectedCost(ordered, and),
+	}
+	for i := range operands {
+		chain.Before = append(chain.Before, operands[i].String())
+		chain.After = append(chain.After, ordered[i].String())
+	}
+	r.report.Chains = append(r.report.Chains, chain)
+
+	newNode := ordered[0]
+	for _, operand := range ordered[1:] {
+		newNode = &BinaryNode{
+			Operator: n.Operator,
+			Left:     newNode,
+			Right:    operand,
+		}
+		newNode.SetType(boolType)
+	}
+	r.keys[newNode] = r.keys[n]
+	patchCopyType(node, newNode)
+}
+
+func (r *reorder) movable(node Node) bool {
+	if s, ok := r.stats[r.keys[node]]; !ok || s.count == 0 {
+		return false
+	}
+	return Find(node, func(n Node) bool {
+		_, call := n.(*CallNode)
+		return call || pinned(n)
+	}) == nil
+}
+
+// totalBuiltins are the builtins which never fail on arguments of the types
+// the checker allows, nor read the clock.
+var totalBuiltins = map[string]bool{
+	"all": true, "none": true, "any": true, "one": true, "filter": true, "map": true,
+	"find": true, "findIndex": true, "findLast": true, "findLastIndex": true, "count": true,
+	"len": true, "type": true, "abs": true, "ceil": true, "floor": true, "round": true,
+	"tryInt": true, "tryFloat": true, "tryDate": true, "string": true, "trim": true,
+	"trimPrefix": true, "trimSuffix": true, "upper": true, "lower": true, "split": true,
+	"splitAfter": true, "replace": true, "title": true, "slugify": true, "isEmail": true,
+	"isURL": true, "isPhone": true, "indexOf": true, "lastIndexOf": true, "hasPrefix": true,
+	"hasSuffix": true, "toBase64": true, "toHex": true, "sha256": true, "md5": true,
+	"crc32": true, "urlEncode": true, "first": true, "last": true, "get": true,
+	"equalDeep": true, "envKeys": true, "envHas": true, "keys": true, "values": true,
+	"reverse": true, "bitnot": true,
+}
+
+// pinned reports whether the node reads the clock, guards against nil or can
+// fail, so the chain operand containing it must stay in place: operands
+// before it may be what keeps it from failing, like len(xs) > 0 in
+// `len(xs) > 0 and xs[0] == 1`, or s != "" in `s != "" and int(s) > 5`.
+// All builtins but the total ones are pinned.
+func pinned(node Node) bool {
+	switch n := node.(type) {
+	case *BuiltinNode:
+		return !totalBuiltins[n.Name]
+	case *MemberNode:
+		if n.Optional {
+			return true
+		}
+		// Fields of structs and values of maps can always be fetched,
+		// elements of arrays and strings, and fields of pointers or
+		// values of unknown types, can not.
+		switch n.Node.Nature().Kind() {
+		case reflect.Struct, reflect.Map:
+			return false
+		}
+		return true
+	case *BinaryNode:
+		switch n.Operator {
+		case "==", "!=":
+			_, leftNil := n.Left.(*NilNode)
+			_, rightNil := n.Right.(*NilNode)
+			return leftNil || rightNil
+		case "%":
+			divisor, ok := n.Right.(*IntegerNode)
+			return !ok || divisor.Value == 0
+		}
+	}
+	return false
+}
+
+// rank orders operands of a chain: the lower the rank, the earlier the
+// operand should be evaluated.
+func (r *reorder) rank(node Node, and bool) float64 {
+	s := r.stats[r.keys[node]]
+	stop := s.probability()
+	if and {
+		stop = 1 - stop
+	}
+	if stop == 0 {
+		return math.Inf(1)
+	}
+	return s.cost() / stop
+}
+
+// expectedCost estimates the cost of evaluating operands in the given order,
+// assuming conditions are independent. Operands never evaluated while
+// profiling are counted as free and never short-circuiting.
+func (r *reorder) expectedCost(operands []Node, and bool) float64 {
+	cost, reached := 0.0, 1.0
+	for _, operand := range operands {
+		s, ok := r.stats[r.keys[operand]]
+		if !ok || s.count == 0 {
+			continue
+		}
+		cost += reached * s.cost()
+		if and {
+			reached *= s.probability()
+		} else {
+			reached *= 1 - s.probability()
+		}
+	}
+	return cost
+}
+
+func flattenChain(node Node, op string, operands []Node) []Node {
+	if n, ok := node.(*BinaryNode); ok && n.Operator == op {
+		operands = flattenChain(n.Left, op, operands)
+		return flattenChain(n.Right, op, operands)
+	}
+	return append(operands, node)
+}
+
+func isChainOperator(op string) bool {
+	switch op {
+	case "and", "&&", "or", "||":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package optimizer_test
+
+import (
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/conf"
+	"github.com/expr-lang/expr/optimizer"
+	"github.com/expr-lang/expr/vm"
+)
+
+func profile(t *testing.T, code string, envs ...map[string]any) *vm.Program {
+	program, err := expr.Compile(code, expr.Env(envs[0]), func(c *conf.Config) {
+		c.Profile = true
+	})
+	require.NoError(t, err)
+	for _, env := range envs {
+		_, err := expr.Run(program, env)
+		require.NoError(t, err)
+	}
+	return program
+}
+
+func TestReorder(t *testing.T) {
+	envs := []map[string]any{
+		{"items": []int{1, 2, 3}, "flag": false, "user": nil},
+		{"items": []int{4, 5, 6}, "flag": false, "user": nil},
+		{"items": []int{7, 8, 9}, "flag": true, "user": nil},
+	}
+
+	tests := []struct {
+		code string
+		want string
+	}{
+		{`all(items, # > 0) and flag`, `flag and all(items, # > 0)`},
+		{`any(items, # > 0) || flag`, `any(items, # > 0) || flag`},
+		{`user == nil and all(items, # > 0) and flag`, `user == nil and flag and all(items, # > 0)`},
+		{`(all(items, # > 0) and flag) or not flag`, `not flag or (flag and all(items, # > 0))`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program := profile(t, tt.code, envs...)
+
+			node := program.Node()
+			report := optimizer.Reorder(&node, vm.GetSpan(program))
+			assert.Equal(t, tt.want, node.String())
+
+			if tt.code == tt.want {
+				assert.Empty(t, report.Chains)
+			} else {
+				require.NotEmpty(t, report.Chains)
+				assert.GreaterOrEqual(t, report.Savings(), 0.0)
+			}
+		})
+	}
+}
+
+func TestReorder_guards(t *testing.T) {
+	envs := []map[string]any{
+		{"xs": []int{2}, "n": 4, "s": "2"},
+		{"xs": []int{3}, "n": 7, "s": "3"},
+		{"xs": []int{1}, "n": 3, "s": "7"},
+	}
+
+	for _, code := range []string{
+		`len(xs) > 0 and xs[0] == 1`,
+		`n != 0 and 10 % n == 1`,
+		`s != "" and int(s) > 5`,
+		`s != "" and duration(s + "s") > duration("5s")`,
+	} {
+		t.Run(code, func(t *testing.T) {
+			program := profile(t, code, envs...)
+
+			node := program.Node()
+			report := optimizer.Reorder(&node, vm.GetSpan(program))
+			assert.Equal(t, code, node.String())
+			assert.Empty(t, report.Chains)
+
+			out, err := expr.Eval(node.String(), map[string]any{"xs": []int{}, "n": 0, "s": ""})
+			require.NoError(t, err)
+			assert.Equal(t, false, out)
+		})
+	}
+}
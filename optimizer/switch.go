@@ -0,0 +1,115 @@
+package optimizer
+
+import (
+	. "github.com/expr-lang/expr/ast"
+)
+
+// minSwitchCases is the number of comparisons from which a chain of
+// conditionals is replaced with a switch.
+const minSwitchCases = 3
+
+// switchJump replaces chains of conditionals which compare the same value
+// with int or string constants, like
+//
+//	x == "a" ? 1 : x == "b" ? 2 : x == "c" ? 3 : 4
+//
+// with a SwitchNode, which is compiled to a single jump instead of a
+// comparison per case.
+type switchJump struct{}
+
+func (*switchJump) Visit(node *Node) {
+	n, ok := (*node).(*ConditionalNode)
+	if !ok {
+		return
+	}
+	value, _, ok := switchCase(n.Cond)
+	if !ok {
+		return
+	}
+	key := value.String()
+
+	s := &SwitchNode{Node: value}
+	seen := map[any]bool{}
+	var next Node = n
+	for {
+		if c, ok := next.(*ConditionalNode); ok {
+			v, constant, ok := switchCase(c.Cond)
+			if ok && v.String() == key && v.Type() == value.Type() {
+				if !seen[constant] {
+					seen[constant] = true
+					s.Cases = append(s.Cases, constant)
+					s.Branches = append(s.Branches, c.Exp1)
+				}
+				next = c.Exp2
+				continue
+			}
+		}
+		// Walk visits children first, so the tail of the chain may be
+		// replaced already.
+		if inner, ok := next.(*SwitchNode); ok && inner.Node.String() == key && inner.Node.Type() == value.Type() {
+			for i, constant := range inner.Cases {
+				if !seen[constant] {
+					seen[constant] = true
+					s.Cases = append(s.Cases, constant)
+					s.Branches = append(s.Branches, inner.Branches[i])
+				}
+			}
+			next = inner.Default
+		}
+		break
+	}
+	if len(s.Cases) < minSwitchCases {
+		return
+	}
+	s.Default = next
+	patchCopyType(node, s)
+}
+
+// switchCase matches a comparison of a value with an int or a string
+// constant, like x == "a". The value must be of the type of the constant,
+// so the jump table finds it by its Go value, and must be a variable or a
+// chain of fields, so it can be computed once.
+func switchCase(cond Node) (Node, any, bool) {
+	b, ok := cond.(*BinaryNode)
+	if !ok || b.Operator != "==" {
+		return nil, nil, false
+	}
+	value, constant := b.Left, b.Right
+	if _, ok := value.(*IntegerNode); ok {
+		value, constant = constant, value
+	} else if _, ok := value.(*StringNode); ok {
+		value, constant = constant, value
+	}
+	if !switchable(value) || value.Type() == nil {
+		return nil, nil, false
+	}
+	switch c := constant.(type) {
+	case *IntegerNode:
+		if value.Type() == integerType {
+			return value, c.Value, true
+		}
+	case *StringNode:
+		if value.Type() == stringType {
+			return value, c.Value, true
+		}
+	}
+	return nil, nil, false
+}
+
+func switchable(node Node) bool {
+	switch n := node.(type) {
+	case *IdentifierNode:
+		return true
+	case *ChainNode:
+		return switchable(n.Node)
+	case *MemberNode:
+		if !switchable(n.Node) {
+			return false
+		}
+		switch n.Property.(type) {
+		case *StringNode, *IntegerNode:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package optimizer_test
+
+import (
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+)
+
+type switchUser struct {
+	Role  string
+	Level int
+}
+
+func TestOptimize_switch(t *testing.T) {
+	env := map[string]any{
+		"x":    "b",
+		"n":    3,
+		"f":    2.0,
+		"user": &switchUser{Role: "admin", Level: 2},
+		"any":  any(nil),
+	}
+
+	tests := []struct {
+		expr string
+		jump bool
+	}{
+		{`x == "a" ? 1 : x == "b" ? 2 : x == "c" ? 3 : 4`, true},
+		{`x == "a" ? 1 : "b" == x ? 2 : x == "c" ? 3 : 4`, true},
+		{`x == "y" ? 1 : x == "z" ? 2 : x == "w" ? 3 : 4`, true},
+		{`x == "a" ? 1 : x == "a" ? 2 : x == "b" ? 3 : x == "c" ? 4 : 5`, true},
+		{`n == 1 ? "one" : n == 2 ? "two" : n == 3 ? "three" : n == 4 ? "four" : "many"`, true},
+		{`user.Role == "guest" ? 0 : user.Role == "user" ? 1 : user.Role == "admin" ? 2 : -1`, true},
+		{`user.Level == 1 ? "a" : user.Level == 2 ? "b" : user.Level == 3 ? "c" : "d"`, true},
+		{`(x == "a" ? 1 : x == "b" ? 2 : x == "c" ? 3 : 4) * 10`, true},
+		{`x == "a" ? 1 : x == "b" ? 2 : 3`, false},
+		{`x == "a" ? 1 : n == 2 ? 2 : x == "c" ? 3 : 4`, false},
+		{`f == 1 ? 1 : f == 2 ? 2 : f == 3 ? 3 : 4`, false},
+		{`any == 1 ? 1 : any == 2 ? 2 : any == 3 ? 3 : 4`, false},
+		{`upper(x) == "A" ? 1 : upper(x) == "B" ? 2 : upper(x) == "C" ? 3 : 4`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			program, err := expr.Compile(tt.expr, expr.Env(env))
+			require.NoError(t, err)
+
+			found := ast.Find(program.Node(), func(node ast.Node) bool {
+				_, ok := node.(*ast.SwitchNode)
+				return ok
+			}) != nil
+			assert.Equal(t, tt.jump, found)
+			assert.Equal(t, tt.jump, containsOp(program, vm.OpSwitch))
+
+			unoptimized, err := expr.Compile(tt.expr, expr.Env(env), expr.Optimize(false))
+			require.NoError(t, err)
+
+			want, err := expr.Run(unoptimized, env)
+			require.NoError(t, err)
+			got, err := expr.Run(program, env)
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestOptimize_switch_string(t *testing.T) {
+	program, err := expr.Compile(`x == "a" ? 1 : x == "b" ? 2 : "c" == x ? 3 : 4`, expr.Env(map[string]any{"x": ""}))
+	require.NoError(t, err)
+	assert.Equal(t, `x == "a" ? 1 : (x == "b" ? 2 : (x == "c" ? 3 : 4))`, program.Node().String())
+}
+
+func TestOptimize_switch_binary(t *testing.T) {
+	env := map[string]any{"n": 0}
+	program, err := expr.Compile(`n == 1 ? "one" : n == 2 ? "two" : n == 3 ? "three" : "many"`, expr.Env(env))
+	require.NoError(t, err)
+
+	data, err := program.MarshalBinary()
+	require.NoError(t, err)
+	loaded, err := vm.Load(data, nil)
+	require.NoError(t, err)
+
+	for n, want := range map[int]string{1: "one", 2: "two", 3: "three", 4: "many"} {
+		got, err := expr.Run(loaded, map[string]any{"n": n})
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+}
+
+func containsOp(program *vm.Program, op vm.Opcode) bool {
+	for _, o := range program.Bytecode {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,26 @@
+package parser
+
+import (
+	"github.com/expr-lang/expr/conf"
+	. "github.com/expr-lang/expr/parser/lexer"
+)
+
+// resolveOperatorAliases replaces identifiers registered as operator aliases
+// with the operators they stand for, and marks custom word operators, like
+// within, as operators. Member names, like foo.et, are kept.
+func resolveOperatorAliases(tokens []Token, config *conf.Config) {
+	for i, token := range tokens {
+		if token.Kind != Identifier {
+			continue
+		}
+		if i > 0 && tokens[i-1].Is(Operator, ".", "?.") {
+			continue
+		}
+		if op, ok := config.OperatorAliases[token.Value]; ok {
+			tokens[i].Kind = Operator
+			tokens[i].Value = op
+		} else if _, ok := config.CustomOperators[token.Value]; ok {
+			tokens[i].Kind = Operator
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	. "github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/file"
+	. "github.com/expr-lang/expr/parser/lexer"
+)
+
+// splitComments returns the tokens without comments, and whether there
+// were any.
+func splitComments(tokens []Token) ([]Token, bool) {
+	code := tokens[:0:0]
+	for _, t := range tokens {
+		if !t.Is(Comment) {
+			code = append(code, t)
+		}
+	}
+	return code, len(code) < len(tokens)
+}
+
+// attachComments attaches the comments of the tokens to the nodes of the
+// tree, see Comments. Comments which belong to no node, like the one of
+// [/* empty */], are trailing comments of the root.
+func attachComments(root Node, tokens []Token, source file.Source) *Comments {
+	starts := map[int]Node{}
+	ends := map[int]Node{}
+	span(root, starts, ends)
+
+	comments := &Comments{}
+	for i, t := range tokens {
+		if !t.Is(Comment) {
+			continue
+		}
+		comment := file.Comment{Location: t.Location, Text: t.Value}
+
+		prev := i - 1
+		for prev >= 0 && tokens[prev].Is(Comment) {
+			prev--
+		}
+		if prev >= 0 && !hasNewline(source, tokens[prev].To, t.From) {
+			for prev > 0 && (tokens[prev].Is(Bracket, ")", "]", "}") || tokens[prev].Is(Operator, ";", ",")) {
+				prev--
+			}
+			if node, ok := ends[tokens[prev].To]; ok {
+				comments.AddTrailing(node, comment)
+				continue
+			}
+		}
+		// Leading comments, and comments after operators, like a && // b.
+		next := i + 1
+		for next < len(tokens) && (tokens[next].Is(Comment) || tokens[next].Is(Bracket, "(", "[", "{")) {
+			next++
+		}
+		if next < len(tokens) && !tokens[next].Is(EOF) {
+			if node, ok := starts[tokens[next].From]; ok {
+				comments.AddLeading(node, comment)
+				continue
+			}
+		}
+		comments.AddTrailing(root, comment)
+	}
+	return comments
+}
+
+// span records the nodes by the start and the end of the source they are
+// parsed from, keeping the outermost ones, and returns the location of the
+// source of the node.
+func span(node Node, starts, ends map[int]Node) file.Location {
+	loc := node.Location()
+	nodes := children(node)
+	if fn, ok := node.(*FunctionNode); ok {
+		nodes = []Node{fn.Node}
+	}
+	for _, child := range nodes {
+		if child == nil {
+			continue
+		}
+		l := span(child, starts, ends)
+		if l.From < loc.From {
+			loc.From = l.From
+		}
+		if l.To > loc.To {
+			loc.To = l.To
+		}
+	}
+	// Children are recorded first, so outer nodes replace them.
+	starts[loc.From] = node
+	ends[loc.To] = node
+	return loc
+}
@@ -0,0 +1,283 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/expr-lang/expr/conf"
+	"github.com/expr-lang/expr/parser/operator"
+)
+
+// Grammar describes the syntax accepted by the parser, so documentation and
+// editor tooling can be generated from the tables the parser uses instead of
+// being kept in sync by hand.
+type Grammar struct {
+	Binary     []GrammarOperator // binary operators, by precedence, then by name
+	Unary      []GrammarOperator // unary operators, by precedence, then by name
+	Aliases    map[string]string // synonyms of operators, like et for and
+	Keywords   []string          // reserved words, sorted
+	Builtins   []GrammarBuiltin  // builtins taking predicates, by name
+	Prefixes   []string          // prefixes of literals, like b or hex, sorted
+	Separators []string          // separators of the expressions of a sequence
+}
+
+// GrammarOperator is an operator of the Grammar.
+type GrammarOperator struct {
+	Name string
+	operator.Operator
+	Negatable bool // can follow not, like not in
+	Custom    bool // registered with conf.Config.CustomOperators
+}
+
+// GrammarBuiltin is a builtin which is parsed specially, because some of its
+// arguments are predicates, like filter(users, .Age > 18).
+type GrammarBuiltin struct {
+	Name      string
+	Arguments []GrammarArgument
+	Aggregate bool // takes either values, like min(a, b), or an array and a predicate
+}
+
+// GrammarArgument is an argument of a GrammarBuiltin.
+type GrammarArgument struct {
+	Predicate bool
+	Optional  bool
+}
+
+// DescribeGrammar returns the grammar accepted by Parse with the config,
+// which may be nil. Builtins which are disabled or overridden by a function
+// or a field of the env are parsed as plain calls, so they are left out.
+func DescribeGrammar(config *conf.Config) *Grammar {
+	g := &Grammar{
+		Aliases:    map[string]string{},
+		Keywords:   []string{"else", "false", "if", "let", "nil", "true"},
+		Separators: []string{";"},
+	}
+
+	for name, op := range operator.Binary {
+		g.Binary = append(g.Binary, GrammarOperator{
+			Name:      name,
+			Operator:  op,
+			Negatable: operator.AllowedNegateSuffix(name),
+		})
+	}
+	for name, op := range operator.Unary {
+		g.Unary = append(g.Unary, GrammarOperator{Name: name, Operator: op})
+	}
+
+	literals := conf.BytesLiterals
+	if config != nil {
+		for name, op := range config.CustomOperators {
+			if _, ok := operator.Binary[name]; ok {
+				continue
+			}
+			g.Binary = append(g.Binary, GrammarOperator{Name: name, Operator: op.Operator, Custom: true})
+		}
+		for alias, op := range config.OperatorAliases {
+			g.Aliases[alias] = op
+		}
+		if config.NewlineSeparators {
+			g.Separators = append(g.Separators, "newline")
+		}
+		literals = config.Literals
+	}
+	sortOperators(g.Binary)
+	sortOperators(g.Unary)
+
+	for _, op := range append(g.Binary, g.Unary...) {
+		if isWord(op.Name) {
+			g.Keywords = append(g.Keywords, op.Name)
+		}
+	}
+	for alias := range g.Aliases {
+		g.Keywords = append(g.Keywords, alias)
+	}
+	sort.Strings(g.Keywords)
+
+	accepted := func(name string) bool {
+		return config == nil || !config.Disabled[name] && !config.IsOverridden(name)
+	}
+	for name, b := range predicates {
+		if !accepted(name) {
+			continue
+		}
+		builtin := GrammarBuiltin{Name: name}
+		for _, a := range b.args {
+			builtin.Arguments = append(builtin.Arguments, GrammarArgument{
+				Predicate: a&predicate == predicate,
+				Optional:  a&optional == optional,
+			})
+		}
+		g.Builtins = append(g.Builtins, builtin)
+	}
+	for name := range aggregates {
+		if !accepted(name) {
+			continue
+		}
+		g.Builtins = append(g.Builtins, GrammarBuiltin{
+			Name:      name,
+			Arguments: []GrammarArgument{{}, {Predicate: true, Optional: true}},
+			Aggregate: true,
+		})
+	}
+	sort.Slice(g.Builtins, func(i, j int) bool { return g.Builtins[i].Name < g.Builtins[j].Name })
+
+	for prefix := range literals {
+		g.Prefixes = append(g.Prefixes, prefix)
+	}
+	sort.Strings(g.Prefixes)
+	return g
+}
+
+func sortOperators(ops []GrammarOperator) {
+	sort.Slice(ops, func(i, j int) bool {
+		if ops[i].Precedence != ops[j].Precedence {
+			return ops[i].Precedence < ops[j].Precedence
+		}
+		return ops[i].Name < ops[j].Name
+	})
+}
+
+func isWord(s string) bool {
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// EBNF returns the grammar in Extended Backus-Naur Form, with a production
+// for every precedence level of binary operators, from the lowest one.
+// Aliases of operators are not spelled out.
+func (g *Grammar) EBNF() string {
+	var b strings.Builder
+	rule := func(name string, alternatives ...string) {
+		fmt.Fprintf(&b, "%-11s = %s .\n", name, strings.Join(alternatives, "\n              | "))
+	}
+
+	var levels []int
+	for _, op := range g.Binary {
+		if len(levels) == 0 || levels[len(levels)-1] != op.Precedence {
+			levels = append(levels, op.Precedence)
+		}
+	}
+	// operand returns the production parsing operators of the precedence
+	// or higher.
+	operand := func(precedence int) string {
+		for _, level := range levels {
+			if level >= precedence {
+				return fmt.Sprintf("Binary%d", level)
+			}
+		}
+		return "Unary"
+	}
+
+	separators := make([]string, len(g.Separators))
+	for i, s := range g.Separators {
+		if s == "newline" {
+			separators[i] = s
+		} else {
+			separators[i] = fmt.Sprintf("%q", s)
+		}
+	}
+	separator := strings.Join(separators, " | ")
+	if len(separators) > 1 {
+		separator = "( " + separator + " )"
+	}
+
+	rule("Sequence", fmt.Sprintf("Expression { %s Expression } [ %s ]", separator, separator))
+	rule("Expression", `Let`, `If`, `Conditional`)
+	rule("Let", `"let" identifier "=" Expression ";" Sequence`)
+	rule("If", `"if" Expression "{" Sequence "}" "else" "{" Sequence "}"`)
+	rule("Conditional", operand(0)+` { "?" [ Expression ] ":" Expression }`)
+
+	for i, level := range levels {
+		next := "Unary"
+		if i+1 < len(levels) {
+			next = fmt.Sprintf("Binary%d", levels[i+1])
+		}
+		var alternatives []string
+		for _, op := range g.Binary {
+			if op.Precedence != level {
+				continue
+			}
+			switch {
+			case op.Name == "|":
+				alternatives = append(alternatives, `"|" identifier Arguments`)
+			case op.Associativity == operator.Right:
+				alternatives = append(alternatives, fmt.Sprintf("%q Binary%d", op.Name, level))
+			case op.Negatable:
+				alternatives = append(alternatives, fmt.Sprintf(`[ "not" ] %q %s`, op.Name, next))
+			default:
+				alternatives = append(alternatives, fmt.Sprintf("%q %s", op.Name, next))
+			}
+		}
+		rule(fmt.Sprintf("Binary%d", level), fmt.Sprintf("%s { %s }", next, strings.Join(alternatives, " | ")))
+	}
+
+	var unary []string
+	for _, op := range g.Unary {
+		unary = append(unary, fmt.Sprintf("%q %s", op.Name, operand(op.Precedence)))
+	}
+	rule("Unary", append(unary, "Postfix")...)
+	rule("Postfix", `Primary { ( "." | "?." ) identifier | [ "?." ] Index | Arguments }`)
+	rule("Index", `"[" ( Expression | [ Expression ] ":" [ Expression ] ) "]"`)
+	rule("Arguments", `"(" [ Expression { "," Expression } [ "," ] ] ")"`)
+
+	primary := []string{`Literal`, `identifier`, `identifier Arguments`, `"::" identifier Arguments`}
+	if len(g.Builtins) > 0 {
+		primary = append(primary, `Builtin`)
+	}
+	primary = append(primary, `Lambda`, `Pointer`, `":" identifier`, `"(" Sequence ")"`, `Array`, `Map`)
+	rule("Primary", primary...)
+
+	literal := []string{`number`, `string`, `"true"`, `"false"`, `"nil"`}
+	if len(g.Prefixes) > 0 {
+		prefixes := make([]string, len(g.Prefixes))
+		for i, p := range g.Prefixes {
+			prefixes[i] = fmt.Sprintf("%q", p)
+		}
+		literal = append(literal, fmt.Sprintf("( %s ) string", strings.Join(prefixes, " | ")))
+	}
+	rule("Literal", literal...)
+	rule("Array", `"[" [ Expression { "," Expression } [ "," ] ] "]"`)
+	rule("Map", `"{" [ Pair { "," Pair } [ "," ] ] "}"`)
+	rule("Pair", `( identifier | string | number | "(" Expression ")" ) ":" Expression`)
+	rule("Lambda", `Parameters "=>" ( Expression | "{" Sequence "}" )`)
+	rule("Parameters", `identifier`, `"(" [ identifier { "," identifier } ] ")"`)
+	rule("Pointer", `"#" [ identifier ]`, `"." identifier`)
+
+	if len(g.Builtins) > 0 {
+		var builtins []string
+		for _, builtin := range g.Builtins {
+			builtins = append(builtins, builtin.ebnf())
+		}
+		rule("Builtin", builtins...)
+		rule("Predicate", `[ Parameters "=>" ] ( Expression | "{" Sequence "}" )`)
+	}
+	return b.String()
+}
+
+func (b GrammarBuiltin) ebnf() string {
+	if b.Aggregate {
+		return fmt.Sprintf(`%q "(" Expression ( "," Predicate | { "," Expression } ) ")"`, b.Name)
+	}
+	var s strings.Builder
+	fmt.Fprintf(&s, `%q "("`, b.Name)
+	for i, arg := range b.Arguments {
+		kind := "Expression"
+		if arg.Predicate {
+			kind = "Predicate"
+		}
+		if i > 0 {
+			kind = `"," ` + kind
+		}
+		if arg.Optional {
+			kind = "[ " + kind + " ]"
+		}
+		s.WriteString(" " + kind)
+	}
+	s.WriteString(` ")"`)
+	return s.String()
+}
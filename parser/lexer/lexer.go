@@ -2,21 +2,70 @@ package lexer
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/expr-lang/expr/file"
 )
 
+// Limits bound the work done on untrusted input before parsing begins.
+// Zero values disable the corresponding check.
+type Limits struct {
+	MaxSourceLength uint // maximum number of runes in the source
+	MaxTokens       uint // maximum number of tokens, not counting EOF
+}
+
+// Options configure the lexer beyond the default grammar.
+type Options struct {
+	Limits
+	// Operators are additional symbolic operators, like <=> or ~=. The
+	// longest operator matching the input wins over the builtin ones.
+	Operators []string
+	// Comments keeps comments as Comment tokens instead of skipping them.
+	Comments bool
+}
+
 func Lex(source file.Source) ([]Token, error) {
+	return LexWithOptions(source, Options{})
+}
+
+// Tokenize returns all tokens of the source, including comments, ending
+// with EOF. Front-ends use it for syntax highlighting and for formatting
+// which keeps comments; the parser does not accept Comment tokens.
+func Tokenize(source file.Source) ([]Token, error) {
+	return LexWithOptions(source, Options{Comments: true})
+}
+
+// LexWithLimits is like Lex, but fails as soon as the source or the token
+// stream exceeds the limits, without scanning the rest of the input.
+func LexWithLimits(source file.Source, limits Limits) ([]Token, error) {
+	return LexWithOptions(source, Options{Limits: limits})
+}
+
+// LexWithOptions is like LexWithLimits, but also recognizes the additional
+// operators of the options.
+func LexWithOptions(source file.Source, options Options) ([]Token, error) {
+	limits := options.Limits
+	if limits.MaxSourceLength > 0 && uint(len(source)) > limits.MaxSourceLength {
+		err := &file.Error{
+			Location: file.Location{From: int(limits.MaxSourceLength), To: int(limits.MaxSourceLength) + 1},
+			Message:  fmt.Sprintf("compilation failed: expression exceeds maximum allowed length of %d characters", limits.MaxSourceLength),
+		}
+		return nil, err.Bind(source)
+	}
+
 	l := &lexer{
-		source: source,
-		tokens: make([]Token, 0),
-		start:  0,
-		end:    0,
+		source:    source,
+		tokens:    make([]Token, 0),
+		start:     0,
+		end:       0,
+		maxTokens: limits.MaxTokens,
+		operators: sortOperators(options.Operators),
+		comments:  options.Comments,
 	}
 	l.commit()
 
-	for state := root; state != nil; {
+	for state := root; state != nil && l.err == nil; {
 		state = state(l)
 	}
 
@@ -32,6 +81,38 @@ type lexer struct {
 	tokens     []Token
 	start, end int
 	err        *file.Error
+	maxTokens  uint
+	operators  [][]rune // custom operators, longest first
+	comments   bool     // emit comments instead of skipping them
+	skipped    int      // comments emitted, not counted by maxTokens
+}
+
+func sortOperators(operators []string) [][]rune {
+	if len(operators) == 0 {
+		return nil
+	}
+	sorted := make([][]rune, 0, len(operators))
+	for _, op := range operators {
+		sorted = append(sorted, []rune(op))
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i]) > len(sorted[j])
+	})
+	return sorted
+}
+
+// acceptOperator consumes the longest custom operator at the current position.
+func (l *lexer) acceptOperator() bool {
+	for _, op := range l.operators {
+		if len(l.source)-l.end < len(op) {
+			continue
+		}
+		if string(l.source[l.end:l.end+len(op)]) == string(op) {
+			l.end += len(op)
+			return true
+		}
+	}
+	return false
 }
 
 const eof rune = -1
@@ -66,6 +147,10 @@ func (l *lexer) emit(t Kind) {
 
 // 构造一个 Token 实例，并追加到 l.tokens 切片中。
 func (l *lexer) emitValue(t Kind, value string) {
+	if l.maxTokens > 0 && uint(len(l.tokens)-l.skipped) >= l.maxTokens {
+		l.error("compilation failed: expression exceeds maximum allowed tokens")
+		return
+	}
 	l.tokens = append(l.tokens, Token{
 		Location: file.Location{From: l.start, To: l.end}, // 记录 token 在源码中的位置，用于错误定位、调试
 		Kind:     t,                                       // 标识 token 类型
@@ -95,6 +180,23 @@ func (l *lexer) skip() {
 	l.commit()
 }
 
+// comment emits the comment, from // or /* up to the end of the line or
+// */, if comments are kept, and skips it otherwise. Comments do not count
+// as tokens for the limit.
+func (l *lexer) comment() {
+	if !l.comments {
+		l.skip()
+		return
+	}
+	l.skipped++
+	l.tokens = append(l.tokens, Token{
+		Location: file.Location{From: l.start, To: l.end},
+		Kind:     Comment,
+		Value:    l.word(),
+	})
+	l.commit()
+}
+
 func (l *lexer) word() string {
 	// TODO: boundary check is NOT needed here, but for some reason CI fuzz tests are failing.
 	// l.start 和 l.end 应该始终在合法范围内
@@ -154,11 +256,16 @@ func (l *lexer) acceptWord(word string) bool {
 }
 
 func (l *lexer) error(format string, args ...any) stateFn {
+	return l.errorAt(l.end-1, format, args...)
+}
+
+// errorAt reports an error at the char with the position pos.
+func (l *lexer) errorAt(pos int, format string, args ...any) stateFn {
 	if l.err == nil { // show first error
 		l.err = &file.Error{
 			Location: file.Location{
-				From: l.end - 1,
-				To:   l.end,
+				From: pos,
+				To:   pos + 1,
 			},
 			Message: fmt.Sprintf(format, args...),
 		}
@@ -24,7 +24,7 @@ func TestLex(t *testing.T) {
 			},
 		},
 		{
-			".5 0.025 1 02 1e3 0xFF 0b0101 0o600 1.2e-4 1_000_000 _42 -.5",
+			".5 0.025 1 02 1e3 0xFF 0b0101 0o600 1.2e-4 1_000_000 _42 -.5 0x1_FF.8p8 0X.8P-2 1_0.0_1E+1_0 0x_1",
 			[]Token{
 				{Kind: Number, Value: ".5"},
 				{Kind: Number, Value: "0.025"},
@@ -39,6 +39,21 @@ func TestLex(t *testing.T) {
 				{Kind: Identifier, Value: "_42"},
 				{Kind: Operator, Value: "-"},
 				{Kind: Number, Value: ".5"},
+				{Kind: Number, Value: "0x1_FF.8p8"},
+				{Kind: Number, Value: "0X.8P-2"},
+				{Kind: Number, Value: "1_0.0_1E+1_0"},
+				{Kind: Number, Value: "0x_1"},
+				{Kind: EOF},
+			},
+		},
+		{
+			"x => x == 1",
+			[]Token{
+				{Kind: Identifier, Value: "x"},
+				{Kind: Operator, Value: "=>"},
+				{Kind: Identifier, Value: "x"},
+				{Kind: Operator, Value: "=="},
+				{Kind: Number, Value: "1"},
 				{Kind: EOF},
 			},
 		},
@@ -275,6 +290,25 @@ func TestLex(t *testing.T) {
 				{Kind: EOF},
 			},
 		},
+		{
+			`b"\xff\101" "\xff"`,
+			[]Token{
+				{Kind: Literal, Value: "\xffA", Prefix: "b"},
+				{Kind: String, Value: "\u00ff"},
+				{Kind: EOF},
+			},
+		},
+		{
+			`re"^a\\d+$" matches d'2024' b64 "x"`,
+			[]Token{
+				{Kind: Literal, Value: "^a\\d+$", Prefix: "re"},
+				{Kind: Operator, Value: "matches"},
+				{Kind: Literal, Value: "2024", Prefix: "d"},
+				{Kind: Identifier, Value: "b64"},
+				{Kind: String, Value: "x"},
+				{Kind: EOF},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -302,6 +336,9 @@ func compareTokens(i1, i2 []Token) bool {
 		if i1[k].Value != i2[k].Value {
 			return false
 		}
+		if i1[k].Prefix != i2[k].Prefix {
+			return false
+		}
 	}
 	return true
 }
@@ -335,8 +372,60 @@ literal not terminated (1:10)
 früh ♥︎
 unrecognized character: U+2665 '♥' (1:6)
  | früh ♥︎
+
+0x
+hexadecimal literal has no digits (1:2)
+ | 0x
+ | .^
+
+0b1.1
+invalid radix point in binary literal (1:4)
+ | 0b1.1
+ | ...^
+
+0o19
+invalid digit '9' in octal literal (1:4)
+ | 0o19
+ | ...^
+
+1p8
+'p' exponent requires hexadecimal mantissa (1:2)
+ | 1p8
+ | .^
+
+0x1.8
+hexadecimal mantissa requires a 'p' exponent (1:5)
+ | 0x1.8
+ | ....^
+
+0x1p+
+exponent has no digits (1:5)
+ | 0x1p+
+ | ....^
+
+1__000
+'_' must separate successive digits (1:3)
+ | 1__000
+ | ..^
+
+0x1_FF_.8p8
+'_' must separate successive digits (1:7)
+ | 0x1_FF_.8p8
+ | ......^
+
+1_000_
+'_' must separate successive digits (1:6)
+ | 1_000_
+ | .....^
 `
 
+func TestLex_literal_location(t *testing.T) {
+	tokens, err := Lex(file.NewSource(`a + λ"x"`))
+	require.NoError(t, err)
+	require.Equal(t, Literal, tokens[2].Kind)
+	assert.Equal(t, file.Location{From: 4, To: 8}, tokens[2].Location)
+}
+
 func TestLex_error(t *testing.T) {
 	tests := strings.Split(strings.Trim(errorTests, "\n"), "\n\n")
 
@@ -355,3 +444,86 @@ func TestLex_error(t *testing.T) {
 		assert.Equal(t, input[1], err.Error(), input[0])
 	}
 }
+
+func TestLexWithLimits(t *testing.T) {
+	tests := []struct {
+		input  string
+		limits Limits
+		err    string
+	}{
+		{`a + b`, Limits{MaxTokens: 3}, ``},
+		{`a + b`, Limits{MaxTokens: 2}, `compilation failed: expression exceeds maximum allowed tokens`},
+		{strings.Repeat(`;`, 100), Limits{MaxTokens: 10}, `compilation failed: expression exceeds maximum allowed tokens`},
+		{strings.Repeat(`-`, 100) + `1`, Limits{MaxTokens: 50}, `compilation failed: expression exceeds maximum allowed tokens`},
+		{`"hello"`, Limits{MaxSourceLength: 7}, ``},
+		{`"hello"`, Limits{MaxSourceLength: 6}, `compilation failed: expression exceeds maximum allowed length of 6 characters`},
+		{strings.Repeat(`-`, 100) + `1`, Limits{}, ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := LexWithLimits(file.NewSource(tt.input), tt.limits)
+			if tt.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestLexWithOptions_operators(t *testing.T) {
+	options := Options{Operators: []string{"<=", "~=", "<=>"}}
+	_, err := LexWithOptions(file.NewSource(`a <=> b ~= c <= d ~ e`), options)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unrecognized character: U+007E '~'`)
+
+	tokens, err := LexWithOptions(file.NewSource(`a<=>b ~= "<=>"`), options)
+	require.NoError(t, err)
+	expected := []Token{
+		{Kind: Identifier, Value: "a"},
+		{Kind: Operator, Value: "<=>"},
+		{Kind: Identifier, Value: "b"},
+		{Kind: Operator, Value: "~="},
+		{Kind: String, Value: "<=>"},
+		{Kind: EOF},
+	}
+	if !compareTokens(tokens, expected) {
+		t.Errorf("got\n\t%+v\nexpected\n\t%v", tokens, expected)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	source := file.NewSource("// rule\nfoo /* a\nb */ + bar // end")
+	tokens, err := Tokenize(source)
+	require.NoError(t, err)
+	expected := []Token{
+		{Kind: Comment, Value: "// rule"},
+		{Kind: Identifier, Value: "foo"},
+		{Kind: Comment, Value: "/* a\nb */"},
+		{Kind: Operator, Value: "+"},
+		{Kind: Identifier, Value: "bar"},
+		{Kind: Comment, Value: "// end"},
+		{Kind: EOF},
+	}
+	if !compareTokens(tokens, expected) {
+		t.Errorf("got\n\t%+v\nexpected\n\t%v", tokens, expected)
+	}
+
+	// Tokens and the text between them give back the source.
+	var b strings.Builder
+	end := 0
+	for _, token := range tokens[:len(tokens)-1] {
+		b.WriteString(string(source[end:token.From]))
+		b.WriteString(string(source[token.From:token.To]))
+		end = token.To
+	}
+	b.WriteString(string(source[end:]))
+	assert.Equal(t, source.String(), b.String())
+	assert.Equal(t, "// end", string(source[tokens[5].From:tokens[5].To]))
+
+	_, err = Tokenize(file.NewSource("foo /* bar"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unclosed comment")
+}
@@ -11,6 +11,10 @@ type stateFn func(*lexer) stateFn
 // root 逐字符扫描源代码，并根据字符的含义进入不同状态函数或直接生成 Token 。
 // stateFn 是函数类型，表示下一个状态。可以返回自身（root）、另一个状态函数（如 number）、或 nil（表示终止扫描）。
 func root(l *lexer) stateFn {
+	if l.acceptOperator() {
+		l.emit(Operator)
+		return root
+	}
 	// 读取一个字符（rune）
 	switch r := l.next(); {
 	case r == eof:
@@ -61,7 +65,10 @@ func root(l *lexer) stateFn {
 		l.emit(Bracket)
 	case strings.ContainsRune(",;%+-^", r): // single rune operator
 		l.emit(Operator)
-	case strings.ContainsRune("&!=*<>", r): // possible double rune operator
+	case r == '=': // =, == or =>
+		l.accept("=>")
+		l.emit(Operator)
+	case strings.ContainsRune("&!*<>", r): // possible double rune operator
 		l.accept("&=*")
 		l.emit(Operator)
 	case r == '.':
@@ -90,20 +97,35 @@ func number(l *lexer) stateFn {
 	return root
 }
 
+// scanNumber scans a number literal with the same syntax as Go: decimal,
+// hex, octal and binary integers, decimal and hex floats, and underscores
+// between digits. Malformed literals are reported at the offending char.
 func (l *lexer) scanNumber() bool {
-	digits := "0123456789_"
-	// Is it hex?
-	if l.accept("0") {
-		// Note: Leading 0 does not mean octal in floats.
-		if l.accept("xX") {
-			digits = "0123456789abcdefABCDEF_"
-		} else if l.accept("oO") {
-			digits = "01234567_"
-		} else if l.accept("bB") {
-			digits = "01_"
+	base, prefix := 10, rune(0)
+	digsep := 0   // bit 0: digit present, bit 1: '_' present
+	invalid := -1 // position of the first invalid digit, or < 0
+
+	if l.peek() != '.' {
+		if l.accept("0") {
+			// Note: Leading 0 does not mean octal.
+			switch lower(l.peek()) {
+			case 'x':
+				l.next()
+				base, prefix = 16, 'x'
+			case 'o':
+				l.next()
+				base, prefix = 8, 'o'
+			case 'b':
+				l.next()
+				base, prefix = 2, 'b'
+			default:
+				digsep = 1 // leading 0
+			}
 		}
+		digsep |= l.scanMantissa(base, &invalid)
 	}
-	l.acceptRun(digits)
+
+	fraction := false
 	end := l.end
 	if l.accept(".") {
 		// Lookup for .. operator: if after dot there is another dot (1..2), it maybe a range operator.
@@ -112,14 +134,57 @@ func (l *lexer) scanNumber() bool {
 			// and backup() func supports only one for now. So, save and
 			// restore it here.
 			l.end = end
-			return true
+		} else {
+			if prefix == 'o' || prefix == 'b' {
+				l.errorAt(end, "invalid radix point in %s literal", litName(prefix))
+				return false
+			}
+			fraction = true
+			digsep |= l.scanMantissa(base, &invalid)
 		}
-		l.acceptRun(digits)
 	}
-	if l.accept("eE") {
+
+	if digsep&1 == 0 {
+		l.error("%s literal has no digits", litName(prefix))
+		return false
+	}
+
+	float := fraction
+	if e := lower(l.peek()); e == 'e' || e == 'p' {
+		pos := l.end
+		ch := l.next()
+		switch {
+		case e == 'e' && prefix != 0:
+			l.errorAt(pos, "%q exponent requires decimal mantissa", ch)
+			return false
+		case e == 'p' && prefix != 'x':
+			l.errorAt(pos, "%q exponent requires hexadecimal mantissa", ch)
+			return false
+		}
 		l.accept("+-")
-		l.acceptRun(digits)
+		ds := l.scanMantissa(10, nil)
+		digsep |= ds
+		if ds&1 == 0 {
+			l.error("exponent has no digits")
+			return false
+		}
+		float = true
+	} else if prefix == 'x' && fraction {
+		l.error("hexadecimal mantissa requires a 'p' exponent")
+		return false
 	}
+
+	if !float && invalid >= 0 {
+		l.errorAt(invalid, "invalid digit %q in %s literal", l.source[invalid], litName(prefix))
+		return false
+	}
+	if digsep&2 != 0 {
+		if i := invalidSep(l.source[l.start:l.end]); i >= 0 {
+			l.errorAt(l.start+i, "'_' must separate successive digits")
+			return false
+		}
+	}
+
 	// Next thing mustn't be alphanumeric.
 	if utils.IsAlphaNumeric(l.peek()) {
 		l.next()
@@ -128,10 +193,85 @@ func (l *lexer) scanNumber() bool {
 	return true
 }
 
+// scanMantissa accepts the digits of the base and underscores. Digits of
+// bases up to 10 are scanned as decimal, and the first one which is not
+// valid in the base is recorded in invalid.
+func (l *lexer) scanMantissa(base int, invalid *int) (digsep int) {
+	for {
+		ch := l.next()
+		ds := 1
+		switch {
+		case ch == '_':
+			ds = 2
+		case base <= 10 && '0' <= ch && ch <= '9':
+			if ch >= rune('0'+base) && *invalid < 0 {
+				*invalid = l.end - 1
+			}
+		case base == 16 && digitVal(ch) < 16:
+		default:
+			l.backup()
+			return digsep
+		}
+		digsep |= ds
+	}
+}
+
+func litName(prefix rune) string {
+	switch prefix {
+	case 'x':
+		return "hexadecimal"
+	case 'o':
+		return "octal"
+	case 'b':
+		return "binary"
+	}
+	return "decimal"
+}
+
+// invalidSep returns the index of the first invalid separator in x, or -1.
+// A separator must be between digits, or between the prefix and a digit.
+func invalidSep(x []rune) int {
+	x1 := ' ' // prefix char, we only care if it's 'x'
+	d := '.'  // digit, one of '_', '0' (a digit), or '.' (anything else)
+	i := 0
+
+	// a prefix counts as a digit
+	if len(x) >= 2 && x[0] == '0' {
+		x1 = lower(x[1])
+		if x1 == 'x' || x1 == 'o' || x1 == 'b' {
+			d = '0'
+			i = 2
+		}
+	}
+
+	// mantissa and exponent
+	for ; i < len(x); i++ {
+		p := d // previous digit
+		d = x[i]
+		switch {
+		case d == '_':
+			if p != '0' {
+				return i
+			}
+		case '0' <= d && d <= '9' || x1 == 'x' && digitVal(d) < 16:
+			d = '0'
+		default:
+			if p == '_' {
+				return i - 1
+			}
+			d = '.'
+		}
+	}
+	if d == '_' {
+		return len(x) - 1
+	}
+	return -1
+}
+
 func dot(l *lexer) stateFn {
 	l.next()
 	if l.accept("0123456789") {
-		l.backup()
+		l.end = l.start
 		return number
 	}
 	l.accept(".")
@@ -153,6 +293,9 @@ loop:
 			case "in", "or", "and", "matches", "contains", "startsWith", "endsWith", "let", "if", "else":
 				l.emit(Operator)
 			default:
+				if r := l.peek(); r == '"' || r == '\'' {
+					return prefixedLiteral
+				}
 				l.emit(Identifier)
 			}
 			break loop
@@ -161,6 +304,29 @@ loop:
 	return root
 }
 
+// prefixedLiteral scans a string immediately following an identifier, like
+// re"^a+$" or d'2024-01-01'. The parser materializes it with the constructor
+// registered for the prefix. Escapes of bytes literals, like b"\xff", are
+// unescaped to bytes.
+func prefixedLiteral(l *lexer) stateFn {
+	start, prefix := l.start, l.word()
+	l.commit()
+	quote := l.next()
+	l.scanString(quote)
+	unquote := unescape
+	if prefix == "b" {
+		unquote = unescapeBytes
+	}
+	str, err := unquote(l.word())
+	if err != nil {
+		return l.error("%v", err)
+	}
+	l.start = start
+	l.emitValue(Literal, str)
+	l.tokens[len(l.tokens)-1].Prefix = prefix
+	return root
+}
+
 func not(l *lexer) stateFn {
 	l.emit(Operator)
 
@@ -213,10 +379,11 @@ func singleLineComment(l *lexer) stateFn {
 	for {
 		r := l.next()
 		if r == eof || r == '\n' {
+			l.backup()
 			break
 		}
 	}
-	l.skip()
+	l.comment()
 	return root
 }
 
@@ -230,7 +397,7 @@ func multiLineComment(l *lexer) stateFn {
 			break
 		}
 	}
-	l.skip()
+	l.comment()
 	return root
 }
 
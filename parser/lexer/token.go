@@ -15,6 +15,8 @@ const (
 	String     Kind = "String"     // 字符串字面量
 	Operator   Kind = "Operator"   // 运算符（+、-、*等）
 	Bracket    Kind = "Bracket"    // 括号（()、[]、{}等）
+	Literal    Kind = "Literal"    // 带前缀的字面量（如 re"^a+$"），Prefix 为前缀
+	Comment    Kind = "Comment"    // 注释（// 或 /* */），仅由 Tokenize 返回
 	EOF        Kind = "EOF"        // 文件结束标记
 )
 
@@ -22,6 +24,7 @@ type Token struct {
 	file.Location        // token 在源码的位置
 	Kind          Kind   // 类型
 	Value         string // 值
+	Prefix        string // 字面量前缀，仅用于 Literal
 }
 
 // String 将 Token 格式化为可读字符串：
@@ -33,6 +36,9 @@ func (t Token) String() string {
 		return string(t.Kind)
 	}
 	// 当 Value 非空时，返回 Kind(Value)
+	if t.Prefix != "" {
+		return fmt.Sprintf("%s(%s%#v)", t.Kind, t.Prefix, t.Value)
+	}
 	return fmt.Sprintf("%s(%#v)", t.Kind, t.Value)
 }
 
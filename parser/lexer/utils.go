@@ -13,6 +13,16 @@ var (
 
 // Unescape takes a quoted string, unquotes, and unescapes it.
 func unescape(value string) (string, error) {
+	return unquote(value, false)
+}
+
+// unescapeBytes is like unescape, but hex and octal escapes, like \xff or
+// \377, are single bytes instead of code points, as in bytes literals.
+func unescapeBytes(value string) (string, error) {
+	return unquote(value, true)
+}
+
+func unquote(value string, bytes bool) (string, error) {
 	// All strings normalize newlines to the \n representation.
 	value = newlineNormalizer.Replace(value)
 	n := len(value)
@@ -38,12 +48,13 @@ func unescape(value string) (string, error) {
 	}
 	buf := make([]byte, 0, size)
 	for len(value) > 0 {
+		raw := bytes && len(value) > 1 && value[0] == '\\' && strings.IndexByte("xX0123", value[1]) >= 0
 		c, multibyte, rest, err := unescapeChar(value)
 		if err != nil {
 			return "", err
 		}
 		value = rest
-		if c < utf8.RuneSelf || !multibyte {
+		if c < utf8.RuneSelf || !multibyte || raw {
 			buf = append(buf, byte(c))
 		} else {
 			n := utf8.EncodeRune(runeTmp[:], c)
@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"github.com/expr-lang/expr/file"
+	. "github.com/expr-lang/expr/parser/lexer"
+)
+
+// insertNewlineSeparators inserts a ";" operator between two tokens separated
+// by a newline outside of brackets, if the first token can end an expression
+// and the second one can only start a new one. A line ending or starting with
+// a binary operator, like "and", "+", "??" or "|", continues the expression:
+//
+//	let total = price * qty
+//	total > 100
+//	    and user.Active
+func insertNewlineSeparators(tokens []Token, source file.Source) []Token {
+	out := make([]Token, 0, len(tokens))
+	depth := 0
+	for i, token := range tokens {
+		if i > 0 && depth == 0 &&
+			endsExpression(tokens[i-1]) &&
+			startsExpression(token, tokens[i+1:]) &&
+			hasNewline(source, tokens[i-1].To, token.From) {
+			out = append(out, Token{
+				Location: file.Location{From: tokens[i-1].To, To: tokens[i-1].To},
+				Kind:     Operator,
+				Value:    ";",
+			})
+		}
+		out = append(out, token)
+
+		switch {
+		case token.Is(Bracket, "(", "[", "{"):
+			depth++
+		case token.Is(Bracket, ")", "]", "}") && depth > 0:
+			depth--
+		}
+	}
+	return out
+}
+
+func endsExpression(t Token) bool {
+	switch t.Kind {
+	case Identifier, Number, String, Literal:
+		return true
+	case Bracket:
+		return t.Is(Bracket, ")", "]", "}")
+	}
+	return false
+}
+
+func startsExpression(t Token, rest []Token) bool {
+	switch t.Kind {
+	case Identifier, Number, String, Literal:
+		return true
+	case Bracket:
+		return t.Is(Bracket, "(", "[", "{")
+	case Operator:
+		if t.Is(Operator, "not") {
+			// "not in", "not matches" and others are binary operators.
+			return len(rest) == 0 || !rest[0].Is(Operator)
+		}
+		// Leading "+" and "-" are treated as binary to continue the expression.
+		return t.Is(Operator, "!", "#", "let", "if")
+	}
+	return false
+}
+
+func hasNewline(source file.Source, from, to int) bool {
+	if from < 0 || to > len(source) || from > to {
+		return false
+	}
+	for _, r := range source[from:to] {
+		if r == '\n' {
+			return true
+		}
+	}
+	return false
+}
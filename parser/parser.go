@@ -1,9 +1,11 @@
 package parser
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"math"
+	"math/big"
 	"strconv"
 	"strings"
 
@@ -43,22 +45,57 @@ var predicates = map[string]struct {
 	"groupBy":       {[]arg{expr, predicate}},
 	"sortBy":        {[]arg{expr, predicate, expr | optional}},
 	"reduce":        {[]arg{expr, predicate, expr | optional}},
+	"uniqBy":        {[]arg{expr, predicate}},
+	"partition":     {[]arg{expr, predicate}},
+	"takeWhile":     {[]arg{expr, predicate}},
+	"dropWhile":     {[]arg{expr, predicate}},
+}
+
+// aggregates are builtins which take either values, like min(a, b), or an
+// array and a predicate, like min(users, .Age).
+var aggregates = map[string]bool{
+	"min":    true,
+	"max":    true,
+	"mean":   true,
+	"median": true,
 }
 
 type parser struct {
-	tokens     []Token     // 输入的 token 流
-	current    Token       // 当前正在处理的 token
-	pos        int         // 当前 token 的索引
-	err        *file.Error // 解析错误，遇错停止
-	config     *conf.Config
-	depth      int  // predicate call depth
-	nodeCount  uint // tracks number of AST nodes created
-	parseDepth int  // 新增专用于解析日志缩进
+	tokens      []Token     // 输入的 token 流
+	current     Token       // 当前正在处理的 token
+	pos         int         // 当前 token 的索引
+	err         *file.Error // 解析错误，遇错停止
+	config      *conf.Config
+	depth       int    // predicate call depth
+	nodeCount   uint   // tracks number of AST nodes created
+	nesting     uint   // expressions being parsed, checked against MaxParseDepth
+	parseDepth  int    // 新增专用于解析日志缩进
+	elements    []bool // if predicates being parsed refer to their element, by depth
+	usesElement bool   // if the last parsed predicate refers to its element
+	ctx         context.Context
+	canceled    error // error of ctx, once it is done
+}
+
+// contextBatch is the number of nodes created between checks of the context.
+const contextBatch = 256
+
+// checkDepthLimit stops the parsing of expressions nested deeper than
+// MaxParseDepth, before the recursion exhausts the stack.
+func (p *parser) checkDepthLimit() {
+	if p.config == nil {
+		return
+	}
+	if limit := p.config.MaxParseDepth; limit > 0 && p.nesting > limit {
+		p.error("compilation failed: expression is nested deeper than %d levels", limit)
+	}
 }
 
 // checkNodeLimit 用于防止解析树节点过多导致的资源耗尽。
 func (p *parser) checkNodeLimit() error {
 	p.nodeCount++
+	if p.nodeCount%contextBatch == 0 {
+		p.checkContext()
+	}
 	if p.config == nil {
 		if p.nodeCount > conf.DefaultMaxNodes {
 			p.error("compilation failed: expression exceeds maximum allowed nodes")
@@ -73,6 +110,17 @@ func (p *parser) checkNodeLimit() error {
 	return nil
 }
 
+// checkContext stops parsing once the context is done.
+func (p *parser) checkContext() {
+	if p.ctx == nil || p.canceled != nil {
+		return
+	}
+	if err := p.ctx.Err(); err != nil {
+		p.canceled = err
+		p.error("%v", err)
+	}
+}
+
 func (p *parser) createNode(n Node, loc file.Location) Node {
 	if err := p.checkNodeLimit(); err != nil {
 		return nil
@@ -98,6 +146,12 @@ func (p *parser) createMemberNode(n *MemberNode, loc file.Location) *MemberNode
 type Tree struct {
 	Node   Node
 	Source file.Source
+	// Comments of the source attached to the nodes of the parsed tree,
+	// nil if there are none. Patchers and the optimizer do not move them.
+	Comments *Comments
+
+	nodes  uint // nodes created by the parser
+	tokens int  // tokens produced by the lexer, without EOF
 }
 
 func Parse(input string) (*Tree, error) {
@@ -105,19 +159,59 @@ func Parse(input string) (*Tree, error) {
 }
 
 func ParseWithConfig(input string, config *conf.Config) (*Tree, error) {
+	return ParseContext(context.Background(), input, config)
+}
+
+// ParseContext parses the input like ParseWithConfig, aborting once ctx is
+// canceled or its deadline is exceeded. The context is checked between
+// batches of parsed nodes, and the error of ctx is returned as is.
+func ParseContext(ctx context.Context, input string, config *conf.Config) (*Tree, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// 构造输入
 	source := file.NewSource(input)
 
+	options := Options{
+		Limits: Limits{
+			MaxSourceLength: conf.DefaultMaxSourceLength,
+			MaxTokens:       conf.DefaultMaxTokens,
+		},
+		Comments: true,
+	}
+	if config != nil {
+		options.MaxSourceLength = config.MaxSourceLength
+		options.MaxTokens = config.MaxTokens
+		for name := range config.CustomOperators {
+			if !utils.IsValidIdentifier(name) {
+				options.Operators = append(options.Operators, name)
+			}
+		}
+	}
+
 	// 词法分析
-	tokens, err := Lex(source)
+	all, err := LexWithOptions(source, options)
 	if err != nil {
 		return nil, err
 	}
+	tokens, commented := splitComments(all)
+	if config != nil && (len(config.OperatorAliases) > 0 || len(config.CustomOperators) > 0) {
+		resolveOperatorAliases(tokens, config)
+	}
+	if config != nil && config.NewlineSeparators {
+		tokens = insertNewlineSeparators(tokens, source)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	p := &parser{
 		tokens:  tokens,
 		current: tokens[0],
 		config:  config,
+		ctx:     ctx,
 	}
 
 	node := p.parseSequenceExpression()
@@ -129,12 +223,20 @@ func ParseWithConfig(input string, config *conf.Config) (*Tree, error) {
 	tree := &Tree{
 		Node:   node,
 		Source: source,
+		nodes:  p.nodeCount,
+		tokens: len(tokens) - 1,
 	}
 
+	if p.canceled != nil {
+		return nil, p.canceled
+	}
 	if p.err != nil {
 		return tree, p.err.Bind(source)
 	}
 
+	if commented {
+		tree.Comments = attachComments(node, all, source)
+	}
 	return tree, nil
 }
 
@@ -168,6 +270,46 @@ func (p *parser) expect(kind Kind, values ...string) {
 	p.error("unexpected token %v", p.current)
 }
 
+// binaryOperator looks up a builtin binary operator, or a custom one
+// registered in the config.
+func (p *parser) binaryOperator(name string) (operator.Operator, bool) {
+	if op, ok := operator.Binary[name]; ok {
+		return op, true
+	}
+	if p.config != nil {
+		if custom, ok := p.config.CustomOperators[name]; ok {
+			return custom.Operator, true
+		}
+	}
+	return operator.Operator{}, false
+}
+
+// namespaced joins the identifier token of a namespace and the name of one
+// of its functions, like geo and distance in geo.distance(a, b), into the
+// token of the function, "geo.distance". Other tokens are returned as is.
+func (p *parser) namespaced(token Token) Token {
+	if p.config == nil || p.pos+2 >= len(p.tokens) || !p.current.Is(Operator, ".") {
+		return token
+	}
+	ns, ok := p.config.Namespaces[token.Value]
+	if !ok {
+		return token
+	}
+	name := p.tokens[p.pos+1]
+	if !name.Is(Identifier) || !p.tokens[p.pos+2].Is(Bracket, "(") {
+		return token
+	}
+	if _, ok := ns[name.Value]; !ok {
+		p.errorAt(name, "unknown function %v in namespace %v", name.Value, token.Value)
+		return token
+	}
+	p.next()
+	p.next()
+	token.Value += "." + name.Value
+	token.To = name.To
+	return token
+}
+
 // parse functions
 
 func (p *parser) parseSequenceExpression() Node {
@@ -236,12 +378,13 @@ func (p *parser) parseExpressionOrigin(precedence int) Node {
 			}
 		}
 
-		if op, ok := operator.Binary[opToken.Value]; ok && op.Precedence >= precedence {
+		if op, ok := p.binaryOperator(opToken.Value); ok && op.Precedence >= precedence {
 			p.next()
 
 			if opToken.Value == "|" {
 				identToken := p.current
 				p.expect(Identifier)
+				identToken = p.namespaced(identToken)
 				nodeLeft = p.parseCall(identToken, []Node{nodeLeft}, true)
 				goto next
 			}
@@ -301,6 +444,9 @@ func (p *parser) parseExpressionOrigin(precedence int) Node {
 func (p *parser) parseExpression(precedence int) Node {
 	p.parseDepth++
 	defer func() { p.parseDepth-- }()
+	p.nesting++
+	defer func() { p.nesting-- }()
+	p.checkDepthLimit()
 
 	p.logf("[PARSE] ParseExpress(prec=%d) at token=%v pos=%d", precedence, p.current, p.pos)
 
@@ -360,7 +506,7 @@ func (p *parser) parseExpression(precedence int) Node {
 			}
 		}
 
-		op, ok := operator.Binary[opToken.Value]
+		op, ok := p.binaryOperator(opToken.Value)
 		if ok {
 			if op.Precedence >= precedence {
 				p.logf("[OP] Handle binary op `%s` (prec=%d, assoc=%v)", opToken.Value, op.Precedence, op.Associativity)
@@ -371,6 +517,7 @@ func (p *parser) parseExpression(precedence int) Node {
 					p.logf("[PIPE] Process pipe to %v", p.current.Value)
 					identToken := p.current
 					p.expect(Identifier)
+					identToken = p.namespaced(identToken)
 					nodeLeft = p.parseCall(identToken, []Node{nodeLeft}, true)
 					goto next
 				}
@@ -406,11 +553,10 @@ func (p *parser) parseExpression(precedence int) Node {
 					Left:     nodeLeft,
 					Right:    nodeRight,
 				}, opToken.Location)
-				p.logf("[OP] Build Binary Node %T: `%v` %s `%v`",
+				p.logf("[OP] Build Binary Node %T: %s `%v`",
 					nodeLeft,
-					nodeLeft.(*BinaryNode).Left,
-					nodeLeft.(*BinaryNode).Operator,
-					nodeLeft.(*BinaryNode).Right)
+					opToken.Value,
+					nodeRight)
 
 				// 处理否定包装
 				if negate {
@@ -423,7 +569,7 @@ func (p *parser) parseExpression(precedence int) Node {
 				p.logf("[OP] Finish binary op `%s`", opToken.Value)
 				goto next
 			} else {
-				p.logf("[OP] Stop handle op `%v` because prec %d < required %d", opToken.Value, operator.Binary[opToken.Value].Precedence, precedence)
+				p.logf("[OP] Stop handle op `%v` because prec %d < required %d", opToken.Value, op.Precedence, precedence)
 			}
 		} else {
 			p.logf("[OP] Stop handle op `%v` because it's not binary", opToken.Value)
@@ -448,8 +594,14 @@ func (p *parser) parseExpression(precedence int) Node {
 }
 
 func (p *parser) logf(format string, args ...interface{}) {
-	indent := strings.Repeat(" ", (p.parseDepth-1)*4)
-	log.Printf(indent+format, args...)
+	if p.config == nil || p.config.Logger == nil || !p.config.Logger.Enabled(conf.LogParser, conf.LevelDebug) {
+		return
+	}
+	var indent string
+	if p.parseDepth > 1 {
+		indent = strings.Repeat(" ", (p.parseDepth-1)*4)
+	}
+	p.config.Logger.Logf(conf.LogParser, conf.LevelDebug, indent+format, args...)
 }
 
 // let 变量名 = 初始值; 后续表达式
@@ -546,17 +698,17 @@ func (p *parser) parseConditional(node Node) Node {
 			p.logf("[COND] Parsed false expression for short form: %T(%v)", expr2, expr2)
 		}
 
+		p.logf("[COND] Create conditional node: cond=%T(%v), true=%T(%v), false=%T(%v)",
+			node, node,
+			expr1, expr1,
+			expr2, expr2)
+
 		node = p.createNode(&ConditionalNode{
 			Cond: node,
 			Exp1: expr1,
 			Exp2: expr2,
 		}, p.current.Location)
 
-		p.logf("[COND] Created conditional node: cond=%T(%v), true=%T(%v), false=%T(%v)",
-			node.(*ConditionalNode).Cond, node.(*ConditionalNode).Cond,
-			node.(*ConditionalNode).Exp1, node.(*ConditionalNode).Exp1,
-			node.(*ConditionalNode).Exp2, node.(*ConditionalNode).Exp2)
-
 		if node == nil {
 			p.logf("[COND-ERROR] Failed to create conditional node")
 			return nil
@@ -593,6 +745,10 @@ func (p *parser) parsePrimary() Node {
 		}
 	}
 
+	if p.isLambda() {
+		return p.parseFunction()
+	}
+
 	// 括号表达式
 	if token.Is(Bracket, "(") {
 		p.logf("[PRIMARY] Found opening bracket `(`")
@@ -627,7 +783,19 @@ func (p *parser) parsePrimary() Node {
 				p.logf("[PRIMARY] Anonymous pointer (this/self) found")
 			}
 
-			node := p.createNode(&PointerNode{Name: name}, token.Location)
+			pointer := &PointerNode{Name: name}
+			level, ok := pointer.Level()
+			if ok && level > p.depth {
+				p.errorAt(token, "cannot use #%d in predicate nested %d levels deep", level, p.depth)
+				return nil
+			}
+			if !ok {
+				level = p.depth
+			}
+			if level <= len(p.elements) {
+				p.elements[level-1] = true
+			}
+			node := p.createNode(pointer, token.Location)
 			if node == nil {
 				p.logf("[PRIMARY-ERROR] Failed to create pointer node")
 				return nil
@@ -659,6 +827,22 @@ func (p *parser) parsePrimary() Node {
 		return result
 	}
 
+	// Placeholders of templates, like :threshold. The name must follow the
+	// colon without spaces, so ternaries and map pairs are not mixed up.
+	if token.Is(Operator, ":") && p.pos+1 < len(p.tokens) {
+		name := p.tokens[p.pos+1]
+		if name.Is(Identifier) && name.From == token.To {
+			p.logf("[PRIMARY] Found placeholder :%s", name.Value)
+			p.next()
+			p.next()
+			node := p.createNode(&PlaceholderNode{Name: name.Value}, token.Location)
+			if node == nil {
+				return nil
+			}
+			return p.parsePostfixExpression(node)
+		}
+	}
+
 	p.logf("[PRIMARY] No primary matches, fall back to secondary parsing")
 	result := p.parseSecondary() // 如果以上都未匹配，则解析基础字面量
 	p.logf("[PRIMARY] Finished primary parsing, returning %T", result)
@@ -699,6 +883,7 @@ func (p *parser) parseSecondary() Node {
 			}
 			return node
 		default:
+			token = p.namespaced(token)
 			if p.current.Is(Bracket, "(") {
 				p.logf("[SECONDARY] Identifier followed by '(', parse as function call")
 				node = p.parseCall(token, []Node{}, true)
@@ -717,40 +902,37 @@ func (p *parser) parseSecondary() Node {
 		var node Node
 		valueLower := strings.ToLower(value)
 		p.logf("[SECONDARY] Process number (cleaned: %s, lower: %s)", value, valueLower)
+		hex := strings.HasPrefix(valueLower, "0x")
 		switch {
-		case strings.HasPrefix(valueLower, "0x"):
-			p.logf("[SECONDARY] Parse as hexadecimal number")
-			number, err := strconv.ParseInt(value, 0, 64)
-			if err != nil {
-				p.error("invalid hex literal: %v", err)
+		case hex && strings.Contains(valueLower, "p"), !hex && strings.ContainsAny(valueLower, ".e"):
+			if p.config != nil && p.config.DecimalMode {
+				p.logf("[SECONDARY] Parse as decimal number")
+				number, ok := new(big.Rat).SetString(value)
+				if !ok {
+					p.errorAt(token, "invalid decimal literal: %v", token.Value)
+				}
+				node = p.createNode(&ConstantNode{Value: number, Literal: token.Value}, token.Location)
+				break
 			}
-			node = p.toIntegerNode(number)
-		case strings.ContainsAny(valueLower, ".e"):
 			p.logf("[SECONDARY] Parse as floating-point number")
 			number, err := strconv.ParseFloat(value, 64)
 			if err != nil {
-				p.error("invalid float literal: %v", err)
+				p.errorAt(token, "invalid float literal: %v", err)
 			}
 			node = p.toFloatNode(number)
-		case strings.HasPrefix(valueLower, "0b"):
-			p.logf("[SECONDARY] Parse as binary number")
-			number, err := strconv.ParseInt(value, 0, 64)
-			if err != nil {
-				p.error("invalid binary literal: %v", err)
-			}
-			node = p.toIntegerNode(number)
-		case strings.HasPrefix(valueLower, "0o"):
-			p.logf("[SECONDARY] Parse as octal number")
-			number, err := strconv.ParseInt(value, 0, 64)
-			if err != nil {
-				p.error("invalid octal literal: %v", err)
-			}
-			node = p.toIntegerNode(number)
 		default:
-			p.logf("[SECONDARY] Parse as decimal integer")
-			number, err := strconv.ParseInt(value, 10, 64)
-			if err != nil {
-				p.error("invalid integer literal: %v", err)
+			p.logf("[SECONDARY] Parse as integer")
+			// Base 0 reads the 0x, 0o and 0b prefixes; without a prefix a
+			// leading 0 does not mean octal.
+			base := 10
+			if len(valueLower) > 1 && valueLower[0] == '0' && strings.ContainsRune("xob", rune(valueLower[1])) {
+				base = 0
+			}
+			number, err := strconv.ParseInt(value, base, 64)
+			if errors.Is(err, strconv.ErrRange) {
+				p.errorAt(token, "integer literal %v overflows int", token.Value)
+			} else if err != nil {
+				p.errorAt(token, "invalid integer literal: %v", err)
 			}
 			node = p.toIntegerNode(number)
 		}
@@ -768,6 +950,13 @@ func (p *parser) parseSecondary() Node {
 		if node == nil {
 			return nil
 		}
+	case Literal:
+		p.logf("[SECONDARY] Found %s literal: %s", token.Prefix, token.Value)
+		p.next()
+		node = p.parseLiteral(token)
+		if node == nil {
+			return nil
+		}
 	default:
 		// 集合字面量
 		if token.Is(Bracket, "[") {
@@ -1002,6 +1191,8 @@ func (p *parser) parseCall(token Token, arguments []Node, checkOverrides bool) N
 	p.logf("[CALL] Final override status: %v (checkOverrides=%v)", isOverridden, checkOverrides)
 
 	// 情况1：预定义谓词函数
+	// Disabled builtins taking predicates are still parsed as builtins, so
+	// the checker reports them as disabled, not their predicates.
 	if b, ok := predicates[token.Value]; ok && !isOverridden {
 		p.logf("[CALL] Found predicate function: %s", token.Value)
 		p.expect(Bracket, "(")
@@ -1046,7 +1237,7 @@ func (p *parser) parseCall(token Token, arguments []Node, checkOverrides bool) N
 				node = p.parseExpression(0)
 			case arg&predicate == predicate:
 				p.logf("[CALL] Parsing predicate argument")
-				node = p.parsePredicate()
+				node = p.parsePredicate(token.Value)
 			}
 			arguments = append(arguments, node)
 			p.logf("[CALL] Added argument %d: %T", i+1, node)
@@ -1073,7 +1264,12 @@ func (p *parser) parseCall(token Token, arguments []Node, checkOverrides bool) N
 		// 情况2：内置函数
 		p.logf("[CALL] Found builtin function: %s", token.Value)
 
-		parsedArgs := p.parseArguments(arguments)
+		var parsedArgs []Node
+		if aggregates[token.Value] {
+			parsedArgs = p.parseAggregateArguments(token.Value, arguments)
+		} else {
+			parsedArgs = p.parseArguments(arguments)
+		}
 		p.logf("[CALL] Parsed %d arguments for builtin function", len(parsedArgs))
 
 		// 如果函数名在 builtin.Index 中，并且没有被禁用或覆盖，就按普通 builtin 函数处理。
@@ -1154,6 +1350,42 @@ func (p *parser) parseArguments(arguments []Node) []Node {
 	return arguments
 }
 
+// parseAggregateArguments parses the arguments of an aggregate builtin, like
+// min. The second argument is a predicate, if it is an arrow function or
+// refers to the element with # or a dot. Inside of another predicate, where
+// # refers to the element of the outer one, only arrow functions are.
+func (p *parser) parseAggregateArguments(builtin string, arguments []Node) []Node {
+	offset := len(arguments)
+
+	p.expect(Bracket, "(")
+	for !p.current.Is(Bracket, ")") && p.err == nil {
+		if len(arguments) > offset {
+			p.expect(Operator, ",")
+		}
+		if p.current.Is(Bracket, ")") {
+			break
+		}
+		var node Node
+		if len(arguments) == 1 && (p.depth == 0 || p.isLambda()) {
+			node = p.parsePredicate(builtin)
+			if predicate, ok := node.(*PredicateNode); ok && !p.usesElement {
+				node = predicate.Node
+			}
+		} else {
+			node = p.parseExpression(0)
+		}
+		arguments = append(arguments, node)
+	}
+	p.expect(Bracket, ")")
+
+	if len(arguments) > 2 {
+		if _, ok := arguments[1].(*PredicateNode); ok {
+			p.error("builtin %v takes an array and a predicate, or values", builtin)
+		}
+	}
+	return arguments
+}
+
 // 谓词（Predicate） 在编程语言和计算机科学中，指的是一个 返回布尔值（true/false）的表达式或函数，用于表示逻辑条件或状态判断。
 // 它的核心作用是 对数据进行筛选、验证或控制流程。
 //
@@ -1224,13 +1456,16 @@ func (p *parser) parseArguments(arguments []Node) []Node {
 // 流程：
 //
 //   - 触发错误 "wrap predicate with brackets { and }"。
-func (p *parser) parsePredicate() Node {
+func (p *parser) parsePredicate(builtin string) Node {
 	p.parseDepth++
 	defer func() { p.parseDepth-- }()
 
 	startToken := p.current
 	p.logf("[PREDICATE] Enter parsePredicate at token=%v pos=%d", startToken, p.pos)
 
+	params := p.parseLambdaParameters()
+	p.elements = append(p.elements, len(params) > 0)
+
 	withBrackets := false
 	if p.current.Is(Bracket, "{") {
 		p.logf("[PREDICATE] Found `{`, start block predicate")
@@ -1256,12 +1491,16 @@ func (p *parser) parsePredicate() Node {
 		}
 	}
 	p.depth--
+	p.usesElement = p.elements[len(p.elements)-1]
+	p.elements = p.elements[:len(p.elements)-1]
 
 	if withBrackets {
 		p.logf("[PREDICATE] Expecting closing `}`")
 		p.expect(Bracket, "}")
 	}
 
+	node = p.bindLambdaParameters(builtin, params, node)
+
 	predicateNode := p.createNode(&PredicateNode{
 		Node: node,
 	}, startToken.Location)
@@ -1275,6 +1514,131 @@ func (p *parser) parsePredicate() Node {
 	return predicateNode
 }
 
+// parseLambdaParameters parses the parameters of an arrow predicate, like
+// u => u.Age > 18 or (acc, x) => acc + x. It returns nil and consumes
+// nothing if the predicate is not an arrow function.
+func (p *parser) parseLambdaParameters() []Token {
+	params, i := p.lambdaParameters()
+	if params == nil {
+		return nil
+	}
+	if len(params) > 2 {
+		p.error("arrow function can have at most 2 parameters")
+		return nil
+	}
+	for p.pos < i {
+		p.next()
+	}
+	p.next()
+	return params
+}
+
+// parseFunction parses a function defined in the expression, like
+// (x, y) => x + y. Unlike predicates, functions can be assigned to variables
+// and called anywhere, so their bodies can not refer to the elements of the
+// predicates around them.
+func (p *parser) parseFunction() Node {
+	token := p.current
+	params, i := p.lambdaParameters()
+	for p.pos < i {
+		p.next()
+	}
+	p.next()
+
+	names := make([]string, len(params))
+	for i, param := range params {
+		for _, name := range names[:i] {
+			if name == param.Value {
+				p.errorAt(param, "duplicate parameter %v", param.Value)
+				return nil
+			}
+		}
+		names[i] = param.Value
+	}
+
+	depth, elements := p.depth, p.elements
+	p.depth, p.elements = 0, nil
+	var body Node
+	if p.current.Is(Bracket, "{") {
+		p.next()
+		body = p.parseSequenceExpression()
+		p.expect(Bracket, "}")
+	} else {
+		body = p.parseExpression(0)
+	}
+	p.depth, p.elements = depth, elements
+
+	return p.createNode(&FunctionNode{
+		Params: names,
+		Node:   body,
+	}, token.Location)
+}
+
+// isLambda reports whether an arrow function starts at the current token.
+func (p *parser) isLambda() bool {
+	params, _ := p.lambdaParameters()
+	return params != nil
+}
+
+// lambdaParameters looks ahead for the parameters of an arrow function, and
+// returns them with the position of the arrow.
+func (p *parser) lambdaParameters() ([]Token, int) {
+	var params []Token
+	i := p.pos
+	if p.current.Is(Identifier) {
+		params = append(params, p.current)
+		i++
+	} else if p.current.Is(Bracket, "(") {
+		// Parameters are separated by exactly one comma, without a
+		// trailing one.
+		for i++; i < len(p.tokens) && p.tokens[i].Is(Identifier); i++ {
+			params = append(params, p.tokens[i])
+			if i+1 >= len(p.tokens) || !p.tokens[i+1].Is(Operator, ",") {
+				i++
+				break
+			}
+			if i+2 >= len(p.tokens) || !p.tokens[i+2].Is(Identifier) {
+				return nil, 0
+			}
+			i++
+		}
+		if i >= len(p.tokens) || !p.tokens[i].Is(Bracket, ")") {
+			return nil, 0
+		}
+		i++
+	}
+	if len(params) == 0 || i >= len(p.tokens) || !p.tokens[i].Is(Operator, "=>") {
+		return nil, 0
+	}
+	return params, i
+}
+
+// bindLambdaParameters binds the parameters of an arrow predicate to the
+// pointers of the predicate scope with let declarations: the element (#)
+// and its index (#index), or for reduce the accumulator (#acc) and the
+// element.
+func (p *parser) bindLambdaParameters(builtin string, params []Token, node Node) Node {
+	pointers := []string{"", "index"}
+	if builtin == "reduce" && len(params) == 2 {
+		pointers = []string{"acc", ""}
+	}
+	for i := len(params) - 1; i >= 0; i-- {
+		pointer := p.createNode(&PointerNode{Name: pointers[i]}, params[i].Location)
+		if pointer == nil {
+			return nil
+		}
+		node = p.createNode(&VariableDeclaratorNode{
+			Name:  params[i].Value,
+			Value: pointer,
+			Expr:  node,
+		}, params[i].Location)
+		if node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
 // 解析数组表达式，将类似 [1, "a", x + 2] 的代码转换为抽象语法树中的 ArrayNode 。
 //
 // 初始化一个空的节点列表，将要解析的每个表达式（如 1, 2+3, x>5）都作为子节点存在这个列表中。
@@ -1304,6 +1668,29 @@ func (p *parser) parsePredicate() Node {
 //	缺失逗号 [1 2]	expect(Operator, ",") 抛出语法错误。
 //	嵌套数组 [[1]]	parseExpression(0) 递归解析内部数组。
 
+// parseLiteral materializes a prefixed literal, like re"^a+$", with the
+// constructor registered for its prefix in the config. Bytes literals are
+// available without a config too.
+func (p *parser) parseLiteral(token Token) Node {
+	var fn conf.LiteralFunc
+	if p.config != nil {
+		fn = p.config.Literals[token.Prefix]
+	} else {
+		fn = conf.BytesLiterals[token.Prefix]
+	}
+	if fn == nil {
+		p.errorAt(token, "unknown literal prefix %v", token.Prefix)
+		return nil
+	}
+	value, err := fn(token.Value)
+	if err != nil {
+		p.errorAt(token, "invalid %v literal: %v", token.Prefix, err)
+		return nil
+	}
+	literal := fmt.Sprintf("%s%q", token.Prefix, token.Value)
+	return p.createNode(&ConstantNode{Value: value, Literal: literal}, token.Location)
+}
+
 func (p *parser) parseArrayExpression(token Token) Node {
 	nodes := make([]Node, 0)
 
@@ -1383,9 +1770,11 @@ func (p *parser) parseMapExpression(token Token) Node {
 		// Map key can be one of:
 		//  * number
 		//  * string
-		//  * identifier, which is equivalent to a string
+		//  * identifier, which is equivalent to a string; keywords like
+		//    let, if or in are identifiers here too
 		//  * expression, which must be enclosed in parentheses -- (1 + 2)
-		if p.current.Is(Number) || p.current.Is(String) || p.current.Is(Identifier) {
+		if p.current.Is(Number) || p.current.Is(String) || p.current.Is(Identifier) ||
+			p.current.Is(Operator) && utils.IsValidIdentifier(p.current.Value) {
 			key = p.createNode(&StringNode{Value: p.current.Value}, p.current.Location)
 			if key == nil {
 				return nil
@@ -1434,6 +1823,8 @@ func (p *parser) parsePostfixExpressionOrigin(node Node) Node {
 			p.next()
 
 			if propertyToken.Kind != Identifier &&
+				// Quoted names like foo."user-id" or foo.`first name` are valid properties.
+				propertyToken.Kind != String &&
 				// Operators like "not" and "matches" are valid methods or property names.
 				(propertyToken.Kind != Operator || !utils.IsValidIdentifier(propertyToken.Value)) {
 				p.error("expected name")
@@ -1751,7 +2142,10 @@ func (p *parser) parsePostfixExpression(node Node) Node {
 			//  - obj.+        // "+" 是 Operator ，但不允许作为属性名 → 报错
 			//  - obj.123      // 数字，不是合法标识符 → 报错
 			//  - obj.@name    // 非法标识符 → 报错
+			//	- obj."user-id" // 引号包裹的名称（字符串或反引号原始字符串），用于含空格、横线等的键
 			if propertyToken.Kind != Identifier &&
+				// Quoted names like foo."user-id" or foo.`first name` are valid properties.
+				propertyToken.Kind != String &&
 				// Operators like "not" and "matches" are valid methods or property names.
 				(propertyToken.Kind != Operator || !utils.IsValidIdentifier(propertyToken.Value)) {
 				p.logf("[ERROR] Invalid member name: %v", propertyToken)
@@ -1878,6 +2272,15 @@ func (p *parser) parsePostfixExpression(node Node) Node {
 					p.expect(Bracket, "]") // 期望右括号
 				}
 			}
+		} else if postfixToken.Value == "(" {
+			// Calls of values, like functions returned by functions: f(1)(2).
+			node = p.createNode(&CallNode{
+				Callee:    node,
+				Arguments: p.parseArguments([]Node{}),
+			}, postfixToken.Location)
+			if node == nil {
+				return nil
+			}
 		} else {
 			// 如果当前 token 不是成员访问 `.` 或 `?.` ，或者数组访问 `[` ，则跳出循环
 			p.logf("[POSTFIX] No more postfix tokens, breaking loop")
@@ -1,16 +1,19 @@
 package parser_test
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"testing"
 
 	"github.com/expr-lang/expr/conf"
+	"github.com/expr-lang/expr/file"
 	"github.com/expr-lang/expr/internal/testify/assert"
 	"github.com/expr-lang/expr/internal/testify/require"
 
 	. "github.com/expr-lang/expr/ast"
 	"github.com/expr-lang/expr/parser"
+	"github.com/expr-lang/expr/parser/operator"
 )
 
 func TestParse(t *testing.T) {
@@ -67,6 +70,37 @@ world`},
 			"10_000_000",
 			&IntegerNode{Value: 10_000_000},
 		},
+		{
+			"amount > :threshold ? (:low) : x[:n]",
+			&ConditionalNode{
+				Cond: &BinaryNode{
+					Operator: ">",
+					Left:     &IdentifierNode{Value: "amount"},
+					Right:    &PlaceholderNode{Name: "threshold"},
+				},
+				Exp1: &PlaceholderNode{Name: "low"},
+				Exp2: &SliceNode{
+					Node: &IdentifierNode{Value: "x"},
+					To:   &IdentifierNode{Value: "n"},
+				},
+			},
+		},
+		{
+			"0x1_FF.8p8",
+			&FloatNode{Value: 0x1_FF.8p8},
+		},
+		{
+			"0X.8P-2",
+			&FloatNode{Value: 0.125},
+		},
+		{
+			"0b_1111_0000",
+			&IntegerNode{Value: 240},
+		},
+		{
+			"0x7FFF_FFFF_FFFF_FFFF",
+			&IntegerNode{Value: 0x7FFF_FFFF_FFFF_FFFF},
+		},
 		{
 			"2.5",
 			&FloatNode{Value: 2.5},
@@ -796,6 +830,107 @@ world`},
 						Exp1: &IntegerNode{Value: 1},
 						Exp2: &IntegerNode{Value: 2}}}},
 		},
+		{
+			`filter(users, u => u.Age > 18)`,
+			&BuiltinNode{
+				Name: "filter",
+				Arguments: []Node{
+					&IdentifierNode{Value: "users"},
+					&PredicateNode{
+						Node: &VariableDeclaratorNode{
+							Name:  "u",
+							Value: &PointerNode{},
+							Expr: &BinaryNode{Operator: ">",
+								Left: &MemberNode{
+									Node:     &IdentifierNode{Value: "u"},
+									Property: &StringNode{Value: "Age"}},
+								Right: &IntegerNode{Value: 18}}}}}},
+		},
+		{
+			`reduce(xs, (acc, x) => acc + x)`,
+			&BuiltinNode{
+				Name: "reduce",
+				Arguments: []Node{
+					&IdentifierNode{Value: "xs"},
+					&PredicateNode{
+						Node: &VariableDeclaratorNode{
+							Name:  "acc",
+							Value: &PointerNode{Name: "acc"},
+							Expr: &VariableDeclaratorNode{
+								Name:  "x",
+								Value: &PointerNode{},
+								Expr: &BinaryNode{Operator: "+",
+									Left:  &IdentifierNode{Value: "acc"},
+									Right: &IdentifierNode{Value: "x"}}}}}}},
+		},
+		{
+			`map(xs, (x, i) => i)`,
+			&BuiltinNode{
+				Name: "map",
+				Arguments: []Node{
+					&IdentifierNode{Value: "xs"},
+					&PredicateNode{
+						Node: &VariableDeclaratorNode{
+							Name:  "x",
+							Value: &PointerNode{},
+							Expr: &VariableDeclaratorNode{
+								Name:  "i",
+								Value: &PointerNode{Name: "index"},
+								Expr:  &IdentifierNode{Value: "i"}}}}}},
+		},
+		{
+			`let f = (x, y) => x + y; f(1, 2)`,
+			&VariableDeclaratorNode{
+				Name: "f",
+				Value: &FunctionNode{
+					Params: []string{"x", "y"},
+					Node: &BinaryNode{Operator: "+",
+						Left:  &IdentifierNode{Value: "x"},
+						Right: &IdentifierNode{Value: "y"}}},
+				Expr: &CallNode{
+					Callee:    &IdentifierNode{Value: "f"},
+					Arguments: []Node{&IntegerNode{Value: 1}, &IntegerNode{Value: 2}}}},
+		},
+		{
+			`f(1)(2)`,
+			&CallNode{
+				Callee: &CallNode{
+					Callee:    &IdentifierNode{Value: "f"},
+					Arguments: []Node{&IntegerNode{Value: 1}}},
+				Arguments: []Node{&IntegerNode{Value: 2}}},
+		},
+		{
+			`min(users, .Age)`,
+			&BuiltinNode{
+				Name: "min",
+				Arguments: []Node{
+					&IdentifierNode{Value: "users"},
+					&PredicateNode{
+						Node: &MemberNode{
+							Node:     &PointerNode{},
+							Property: &StringNode{Value: "Age"}}}}},
+		},
+		{
+			`max(a, b)`,
+			&BuiltinNode{
+				Name: "max",
+				Arguments: []Node{
+					&IdentifierNode{Value: "a"},
+					&IdentifierNode{Value: "b"}}},
+		},
+		{
+			`map(xs, max(0, #))`,
+			&BuiltinNode{
+				Name: "map",
+				Arguments: []Node{
+					&IdentifierNode{Value: "xs"},
+					&PredicateNode{
+						Node: &BuiltinNode{
+							Name: "max",
+							Arguments: []Node{
+								&IntegerNode{Value: 0},
+								&PointerNode{}}}}}},
+		},
 		{
 			`[if true { 1 } else { 2 }]`,
 			&ArrayNode{
@@ -939,6 +1074,30 @@ func TestParse_error(t *testing.T) {
 		{`foo.`, `unexpected end of expression (1:4)
  | foo.
  | ...^`},
+		{`filter(xs, #2 > 1)`, `cannot use #2 in predicate nested 1 levels deep (1:12)
+ | filter(xs, #2 > 1)
+ | ...........^`},
+		{`filter(xs, (a, b, c) => a)`, `arrow function can have at most 2 parameters (1:12)
+ | filter(xs, (a, b, c) => a)
+ | ...........^`},
+		{`let f = (x, x) => x; f`, `duplicate parameter x (1:13)
+ | let f = (x, x) => x; f
+ | ............^`},
+		{`(a b) => a`, `unexpected token Identifier("b") (1:4)
+ | (a b) => a
+ | ...^`},
+		{`(a,) => a`, `unexpected token Operator(",") (1:3)
+ | (a,) => a
+ | ..^`},
+		{`map(xs, (x i) => x)`, `unexpected token Identifier("i") (1:12)
+ | map(xs, (x i) => x)
+ | ...........^`},
+		{`map(xs, (x,) => x)`, `unexpected token Operator(",") (1:11)
+ | map(xs, (x,) => x)
+ | ..........^`},
+		{`min(xs, #, 1)`, `builtin min takes an array and a predicate, or values (1:13)
+ | min(xs, #, 1)
+ | ............^`},
 		{`a+`, `unexpected token EOF (1:2)
  | a+
  | .^`},
@@ -969,33 +1128,42 @@ func TestParse_error(t *testing.T) {
 		{`{foo:1, bar:2, ,}`, `unexpected token Operator(",") (1:16)
  | {foo:1, bar:2, ,}
  | ...............^`},
-		{`foo ?? bar || baz`, `Operator (||) and coalesce expressions (??) cannot be mixed. Wrap either by parentheses. (1:12)
+		{`foo ?? bar || baz`, `Operator (||) and coalesce expressions (??) cannot be mixed (1:12)
  | foo ?? bar || baz
  | ...........^`},
-		{`0b15`, `bad number syntax: "0b15" (1:4)
+		{`0b15`, `invalid digit '5' in binary literal (1:4)
  | 0b15
  | ...^`},
 		{`0X10G`, `bad number syntax: "0X10G" (1:5)
  | 0X10G
  | ....^`},
-		{`0o1E`, `invalid float literal: strconv.ParseFloat: parsing "0o1E": invalid syntax (1:4)
+		{`0o1E`, `'E' exponent requires decimal mantissa (1:4)
  | 0o1E
  | ...^`},
-		{`0b1E`, `invalid float literal: strconv.ParseFloat: parsing "0b1E": invalid syntax (1:4)
+		{`0b1E`, `'E' exponent requires decimal mantissa (1:4)
  | 0b1E
  | ...^`},
-		{`0b1E+6`, `bad number syntax: "0b1E+6" (1:6)
+		{`0b1E+6`, `'E' exponent requires decimal mantissa (1:4)
  | 0b1E+6
- | .....^`},
-		{`0b1E+1`, `invalid float literal: strconv.ParseFloat: parsing "0b1E+1": invalid syntax (1:6)
+ | ...^`},
+		{`0b1E+1`, `'E' exponent requires decimal mantissa (1:4)
  | 0b1E+1
- | .....^`},
-		{`0o1E+1`, `invalid float literal: strconv.ParseFloat: parsing "0o1E+1": invalid syntax (1:6)
+ | ...^`},
+		{`0o1E+1`, `'E' exponent requires decimal mantissa (1:4)
  | 0o1E+1
- | .....^`},
-		{`1E`, `invalid float literal: strconv.ParseFloat: parsing "1E": invalid syntax (1:2)
+ | ...^`},
+		{`1E`, `exponent has no digits (1:2)
  | 1E
  | .^`},
+		{`0b1111111111111111111111111111111111111111111111111111111111111111`, `integer literal 0b1111111111111111111111111111111111111111111111111111111111111111 overflows int (1:1)
+ | 0b1111111111111111111111111111111111111111111111111111111111111111
+ | ^`},
+		{`0x8000_0000_0000_0000`, `integer literal 0x8000_0000_0000_0000 overflows int (1:1)
+ | 0x8000_0000_0000_0000
+ | ^`},
+		{`1 + 9223372036854775808`, `integer literal 9223372036854775808 overflows int (1:5)
+ | 1 + 9223372036854775808
+ | ....^`},
 		{`1 not == [1, 2, 5]`, `unexpected token Operator("==") (1:7)
  | 1 not == [1, 2, 5]
  | ......^`},
@@ -1135,6 +1303,41 @@ func TestParse_optional_chaining(t *testing.T) {
 				},
 			},
 		},
+		{
+			"foo.\"user-id\"?.`first name`",
+			&ChainNode{
+				Node: &MemberNode{
+					Node: &MemberNode{
+						Node:     &IdentifierNode{Value: "foo"},
+						Property: &StringNode{Value: "user-id"},
+					},
+					Property: &StringNode{Value: "first name"},
+					Optional: true,
+				},
+			},
+		},
+		{
+			"config.if?.let",
+			&ChainNode{
+				Node: &MemberNode{
+					Node: &MemberNode{
+						Node:     &IdentifierNode{Value: "config"},
+						Property: &StringNode{Value: "if"},
+					},
+					Property: &StringNode{Value: "let"},
+					Optional: true,
+				},
+			},
+		},
+		{
+			"{let: 1, if: 2, else: 3, in: 4}",
+			&MapNode{Pairs: []Node{
+				&PairNode{Key: &StringNode{Value: "let"}, Value: &IntegerNode{Value: 1}},
+				&PairNode{Key: &StringNode{Value: "if"}, Value: &IntegerNode{Value: 2}},
+				&PairNode{Key: &StringNode{Value: "else"}, Value: &IntegerNode{Value: 3}},
+				&PairNode{Key: &StringNode{Value: "in"}, Value: &IntegerNode{Value: 4}},
+			}},
+		},
 	}
 	for _, test := range parseTests {
 		actual, err := parser.Parse(test.input)
@@ -1232,6 +1435,81 @@ func TestNodeBudget(t *testing.T) {
 	}
 }
 
+func TestParseWithConfig_lexer_limits(t *testing.T) {
+	config := conf.CreateNew()
+	config.MaxTokens = 100
+
+	_, err := parser.ParseWithConfig(strings.Repeat("not ", 200)+"true", config)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds maximum allowed tokens")
+
+	config.MaxTokens = 0
+	config.MaxSourceLength = 10
+	_, err = parser.ParseWithConfig(`"long string literal"`, config)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds maximum allowed length")
+}
+
+func TestParseWithConfig_parse_depth(t *testing.T) {
+	config := conf.CreateNew()
+	config.MaxParseDepth = 10
+
+	_, err := parser.ParseWithConfig(strings.Repeat("(", 9)+"1"+strings.Repeat(")", 9), config)
+	require.NoError(t, err)
+
+	inputs := []string{
+		strings.Repeat("(", 20) + "1" + strings.Repeat(")", 20),
+		strings.Repeat("[", 20) + strings.Repeat("]", 20),
+		strings.Repeat("- ", 20) + "1",
+		strings.Repeat("map(a, {", 20) + "#" + strings.Repeat("})", 20),
+	}
+	for _, input := range inputs {
+		_, err = parser.ParseWithConfig(input, config)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "expression is nested deeper than 10 levels")
+	}
+
+	// The depth is not limited by default.
+	_, err = parser.Parse(strings.Repeat("(", 5000) + "1" + strings.Repeat(")", 5000))
+	require.NoError(t, err)
+
+	config.MaxParseDepth = 0
+	_, err = parser.ParseWithConfig(strings.Repeat("(", 5000)+"1"+strings.Repeat(")", 5000), config)
+	require.NoError(t, err)
+}
+
+func TestParse_newline_separators(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"a\nb\nc", "a; b; c"},
+		{"let x = 1\nx + 1", "let x = 1; x + 1"},
+		{"a +\nb", "a + b"},
+		{"a\n+ b", "a + b"},
+		{"a\nand b\n?? c", "a and b ?? c"},
+		{"a\nnot in b", "not (a in b)"},
+		{"a\nnot b", "a; not b"},
+		{"foo(\n  a,\n  b\n)\n[1, 2]", "foo(a, b); [1, 2]"},
+		{"arr\n| map(\n  .foo\n)\n| len()", "len(map(arr, .foo))"},
+		{"if a {\n  b\n} else {\n  c\n}", "a ? b : c"},
+		{"a // comment\nb", "a; b"},
+	}
+
+	config := conf.CreateNew()
+	config.NewlineSeparators = true
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			tree, err := parser.ParseWithConfig(tt.input, config)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, tree.Node.String())
+		})
+	}
+
+	_, err := parser.Parse("a\nb")
+	require.Error(t, err)
+}
+
 func TestNodeBudgetDisabled(t *testing.T) {
 	config := conf.CreateNew()
 	config.MaxNodes = 0 // Disable node budget
@@ -1243,3 +1521,114 @@ func TestNodeBudgetDisabled(t *testing.T) {
 		t.Error("Node budget check should be disabled when MaxNodes is 0")
 	}
 }
+
+func TestTree_Stats(t *testing.T) {
+	tree, err := parser.Parse(`user.Age > 18 and user.Name in ["a", "b"] ? 1.5 : nil ?? true`)
+	require.NoError(t, err)
+
+	stats := tree.Stats()
+	assert.Equal(t, 21, stats.Tokens)
+	assert.Equal(t, uint(18), stats.Nodes)
+	assert.Equal(t, 5, stats.Depth)
+	assert.Equal(t, 1, stats.Integers)
+	assert.Equal(t, 1, stats.Floats)
+	assert.Equal(t, 4, stats.Strings)
+	assert.Equal(t, 1, stats.Bools)
+	assert.Equal(t, 1, stats.Nils)
+
+	tree, err = parser.Parse(`let f = (x) => x + 1 + 2 + 3; f(2)`)
+	require.NoError(t, err)
+
+	stats = tree.Stats()
+	assert.Equal(t, 6, stats.Depth)
+	assert.Equal(t, 4, stats.Integers)
+}
+
+// countdownContext is canceled after its Err is called n times.
+type countdownContext struct {
+	context.Context
+	n int
+}
+
+func (c *countdownContext) Err() error {
+	if c.n == 0 {
+		return context.Canceled
+	}
+	c.n--
+	return nil
+}
+
+func TestParseContext(t *testing.T) {
+	input := strings.Repeat("1 + ", 1000) + "1"
+
+	tree, err := parser.ParseContext(context.Background(), input, nil)
+	require.NoError(t, err)
+	require.NotNil(t, tree)
+
+	// Checks before and after lexing pass, so parsing stops at the first
+	// batch of nodes.
+	ctx := &countdownContext{Context: context.Background(), n: 2}
+	tree, err = parser.ParseContext(ctx, input, nil)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, tree)
+}
+
+func TestParse_comments(t *testing.T) {
+	tree, err := parser.Parse("// rule\na > 1 && // big\nb /* flag */")
+	require.NoError(t, err)
+	require.NotNil(t, tree.Comments)
+	assert.Equal(t, 3, tree.Comments.Len())
+
+	text := func(comments map[Node][]file.Comment) map[string]string {
+		m := map[string]string{}
+		for node, list := range comments {
+			for _, c := range list {
+				m[c.Text] = node.String()
+			}
+		}
+		return m
+	}
+	assert.Equal(t, map[string]string{"// rule": "a > 1 && b", "// big": "b"}, text(tree.Comments.Leading))
+	assert.Equal(t, map[string]string{"/* flag */": "a > 1 && b"}, text(tree.Comments.Trailing))
+
+	tree, err = parser.Parse("a > 1")
+	require.NoError(t, err)
+	assert.Nil(t, tree.Comments)
+	assert.Equal(t, 3, tree.Stats().Tokens)
+}
+
+func TestDescribeGrammar(t *testing.T) {
+	config := conf.CreateNew()
+	config.CustomOperator("within", conf.CustomOperator{
+		Operator: operator.Operator{Precedence: 20, Associativity: operator.Left},
+		Function: "within",
+	})
+	config.OperatorAlias("et", "and")
+	config.NewlineSeparators = true
+	config.Disabled["groupBy"] = true
+
+	g := parser.DescribeGrammar(config)
+	assert.Equal(t, "|", g.Binary[0].Name)
+	assert.Equal(t, "??", g.Binary[len(g.Binary)-1].Name)
+	assert.Equal(t, "and", g.Aliases["et"])
+	assert.Contains(t, g.Keywords, "within")
+	assert.Contains(t, g.Keywords, "et")
+	assert.Contains(t, g.Prefixes, "hex")
+
+	var builtins []string
+	for _, b := range g.Builtins {
+		builtins = append(builtins, b.Name)
+	}
+	assert.Contains(t, builtins, "filter")
+	assert.Contains(t, builtins, "min")
+	assert.NotContains(t, builtins, "groupBy")
+
+	ebnf := g.EBNF()
+	assert.Contains(t, ebnf, `Sequence    = Expression { ( ";" | newline ) Expression } [ ( ";" | newline ) ] .`)
+	assert.Contains(t, ebnf, `[ "not" ] "in" Binary25`)
+	assert.Contains(t, ebnf, `"within" Binary25`)
+	assert.Contains(t, ebnf, `Binary100   = Binary500 { "**" Binary100 | "^" Binary100 } .`)
+	assert.Contains(t, ebnf, `"-" Binary100`)
+	assert.Contains(t, ebnf, `"sortBy" "(" Expression "," Predicate [ "," Expression ] ")"`)
+	assert.NotContains(t, ebnf, `"groupBy"`)
+}
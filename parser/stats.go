@@ -0,0 +1,95 @@
+package parser
+
+import (
+	. "github.com/expr-lang/expr/ast"
+)
+
+// Stats describes the complexity of a parsed expression.
+type Stats struct {
+	Nodes  uint // nodes created by the parser, see conf.Config.MaxNodes
+	Depth  int  // maximum depth of the tree, a single node has depth 1
+	Tokens int  // tokens produced by the lexer, without EOF
+
+	// Literals in the tree by kind.
+	Integers int
+	Floats   int
+	Strings  int
+	Bools    int
+	Nils     int
+}
+
+// Stats returns complexity statistics of the tree. Nodes and Tokens are
+// recorded while parsing; the rest reflects the current tree, including
+// changes made by patchers.
+func (t *Tree) Stats() Stats {
+	s := Stats{
+		Nodes:  t.nodes,
+		Tokens: t.tokens,
+	}
+	s.collect(t.Node, 1)
+	return s
+}
+
+func (s *Stats) collect(node Node, depth int) {
+	if node == nil {
+		return
+	}
+	if depth > s.Depth {
+		s.Depth = depth
+	}
+	switch node.(type) {
+	case *IntegerNode:
+		s.Integers++
+	case *FloatNode:
+		s.Floats++
+	case *StringNode:
+		s.Strings++
+	case *BoolNode:
+		s.Bools++
+	case *NilNode:
+		s.Nils++
+	}
+	for _, child := range children(node) {
+		s.collect(child, depth+1)
+	}
+}
+
+func children(node Node) []Node {
+	switch n := node.(type) {
+	case *UnaryNode:
+		return []Node{n.Node}
+	case *BinaryNode:
+		return []Node{n.Left, n.Right}
+	case *ChainNode:
+		return []Node{n.Node}
+	case *MemberNode:
+		return []Node{n.Node, n.Property}
+	case *SliceNode:
+		return []Node{n.Node, n.From, n.To}
+	case *CallNode:
+		return append([]Node{n.Callee}, n.Arguments...)
+	case *BuiltinNode:
+		return n.Arguments
+	case *PredicateNode:
+		return []Node{n.Node}
+	case *FunctionNode:
+		return []Node{n.Node}
+	case *VariableDeclaratorNode:
+		return []Node{n.Value, n.Expr}
+	case *SequenceNode:
+		return n.Nodes
+	case *ConditionalNode:
+		return []Node{n.Cond, n.Exp1, n.Exp2}
+	case *SwitchNode:
+		return append(append([]Node{n.Node}, n.Branches...), n.Default)
+	case *OpcodeNode:
+		return n.Arguments
+	case *ArrayNode:
+		return n.Nodes
+	case *MapNode:
+		return n.Pairs
+	case *PairNode:
+		return []Node{n.Key, n.Value}
+	}
+	return nil
+}
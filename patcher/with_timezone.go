@@ -6,7 +6,7 @@ import (
 	"github.com/expr-lang/expr/ast"
 )
 
-// WithTimezone passes Location to date() and now() functions.
+// WithTimezone passes Location to date(), tryDate() and now() functions.
 type WithTimezone struct {
 	Location *time.Location
 }
@@ -14,7 +14,7 @@ type WithTimezone struct {
 func (t WithTimezone) Visit(node *ast.Node) {
 	if btin, ok := (*node).(*ast.BuiltinNode); ok {
 		switch btin.Name {
-		case "date", "now":
+		case "date", "tryDate", "now":
 			loc := &ast.ConstantNode{Value: t.Location}
 			ast.Patch(node, &ast.BuiltinNode{
 				Name:      btin.Name,
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"flag"
 	"fmt"
 	"os"
 	"runtime"
@@ -11,26 +13,54 @@ import (
 	"github.com/bettercap/readline"
 
 	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
 	"github.com/expr-lang/expr/builtin"
 	"github.com/expr-lang/expr/debug"
+	"github.com/expr-lang/expr/parser"
 	"github.com/expr-lang/expr/vm"
 )
 
 var keywords = []string{
 	// Commands:
-	"exit", "opcodes", "debug", "mem",
+	"exit", "opcodes", "debug", "mem", ":type", ":ast", ":bytecode", ":help",
 
 	// Operators:
 	"and", "or", "in", "not", "not in", "contains", "matches", "startsWith", "endsWith",
 }
 
+const help = `Enter an expression to evaluate it, or a command:
+  :type <expr>      print the type of the expression
+  :ast <expr>       dump the tree of the expression
+  :bytecode [expr]  disassemble the expression, or the last one
+  debug             debug the last expression
+  mem               print the memory used by the last expression
+  exit              quit`
+
 func main() {
-	env := fuzz.NewEnv()
+	envFile := flag.String("env", "", "JSON file with the env of expressions, instead of the fuzzing env")
+	flag.Parse()
+
+	var env map[string]any
+	var options []expr.Option
+	if *envFile != "" {
+		data, err := os.ReadFile(*envFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := json.Unmarshal(data, &env); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid env %v: %v\n", *envFile, err)
+			os.Exit(1)
+		}
+		options = append(options, expr.Env(env))
+	} else {
+		env = fuzz.NewEnv()
+		options = append(options, expr.Env(env), fuzz.Func())
+		keywords = append(keywords, "fn")
+	}
 	for name := range env {
 		keywords = append(keywords, name)
 	}
-	fn := fuzz.Func()
-	keywords = append(keywords, "fn")
 	home, err := os.UserHomeDir()
 	if err != nil {
 		panic(err)
@@ -54,19 +84,56 @@ func main() {
 			break
 		}
 		line = strings.TrimSpace(line)
+		command, input := line, ""
+		if strings.HasPrefix(line, ":") {
+			if i := strings.IndexAny(line, " \t"); i > 0 {
+				command, input = line[:i], strings.TrimSpace(line[i:])
+			}
+		}
 
-		switch line {
+		switch command {
 		case "":
 			continue
 
 		case "exit":
 			return
 
+		case ":help":
+			fmt.Println(help)
+			continue
+
+		case ":type":
+			p, err := expr.Compile(input, options...)
+			if err != nil {
+				fmt.Printf("compile error: %s\n", err)
+				continue
+			}
+			fmt.Println(p.Node().Nature())
+			continue
+
+		case ":ast":
+			tree, err := parser.Parse(input)
+			if err != nil {
+				fmt.Printf("parse error: %s\n", err)
+				continue
+			}
+			fmt.Println(ast.Dump(tree.Node))
+			continue
+
 		case "mem":
 			fmt.Printf("memory usage: %s\n", humanizeBytes(memUsage))
 			continue
 
-		case "opcodes":
+		case "opcodes", ":bytecode":
+			if input != "" {
+				p, err := expr.Compile(input, options...)
+				if err != nil {
+					fmt.Printf("compile error: %s\n", err)
+					continue
+				}
+				fmt.Println(p.Disassemble())
+				continue
+			}
 			if program == nil {
 				fmt.Println("no program")
 				continue
@@ -83,7 +150,12 @@ func main() {
 			continue
 		}
 
-		program, err = expr.Compile(line, expr.Env(env), fn)
+		if strings.HasPrefix(command, ":") {
+			fmt.Printf("unknown command %s, see :help\n", command)
+			continue
+		}
+
+		program, err = expr.Compile(line, options...)
 		if err != nil {
 			fmt.Printf("compile error: %s\n", err)
 			continue
@@ -0,0 +1,214 @@
+// Package ruleset evaluates many boolean rules over the same env at once.
+//
+// Rules are split into their conjunctions, like a, b and c of a && b && c,
+// and rules which start with the same conjunctions share them in a decision
+// graph. Every distinct conjunction is evaluated at most once per env, and
+// the conjunctions after a false one are not evaluated, like with &&.
+package ruleset
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/checker"
+	"github.com/expr-lang/expr/compiler"
+	"github.com/expr-lang/expr/conf"
+	"github.com/expr-lang/expr/file"
+	"github.com/expr-lang/expr/optimizer"
+	"github.com/expr-lang/expr/parser"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Rule is a named boolean expression.
+type Rule struct {
+	Name       string
+	Expression string
+}
+
+// Verdict is the result of a rule for an env. Err is the error of the
+// first conjunction of the rule which failed, Match is false then.
+type Verdict struct {
+	Rule  string
+	Match bool
+	Err   error
+}
+
+// Set is a compiled set of rules. It is safe for concurrent use.
+type Set struct {
+	rules []string
+	terms []*vm.Program // distinct conjunctions of all rules
+	roots []*node
+}
+
+// node is a conjunction in the decision graph. Its children and rules are
+// visited only if the conjunction is true.
+type node struct {
+	term     int     // index of Set.terms
+	children []*node // next conjunctions of rules sharing this prefix
+	rules    []int   // rules which end with this conjunction
+	all      []int   // rules of this node and of all its descendants
+	key      string  // printed conjunction, to find shared prefixes
+}
+
+// Compile compiles the rules with the options, which must produce booleans.
+// Conjunctions are compared after optimization by their printed form, so
+// a > 1 && b and a>1 and b share a > 1.
+func Compile(rules []Rule, ops ...expr.Option) (*Set, error) {
+	config := conf.CreateNew()
+	for _, op := range ops {
+		op(config)
+	}
+	for name := range config.Disabled {
+		delete(config.Builtins, name)
+	}
+	config.Check()
+	config.Expect = reflect.Bool
+	config.ExpectAny = true
+
+	s := &Set{}
+	index := map[string]int{}
+	for i, rule := range rules {
+		tree, err := checker.ParseCheck(rule.Expression, config)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		if config.Optimize {
+			if err := optimizer.Optimize(&tree.Node, config); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", rule.Name, bind(err, tree))
+			}
+		}
+
+		level := &s.roots
+		var last *node
+		for _, term := range conjunctions(tree.Node, nil) {
+			key := term.String()
+			var next *node
+			for _, n := range *level {
+				if n.key == key {
+					next = n
+					break
+				}
+			}
+			if next == nil {
+				t, ok := index[key]
+				if !ok {
+					program, err := compiler.Compile(&parser.Tree{Node: term, Source: tree.Source}, config)
+					if err != nil {
+						return nil, fmt.Errorf("rule %s: %w", rule.Name, bind(err, tree))
+					}
+					t = len(s.terms)
+					index[key] = t
+					s.terms = append(s.terms, program)
+				}
+				next = &node{term: t, key: key}
+				*level = append(*level, next)
+			}
+			next.all = append(next.all, i)
+			level = &next.children
+			last = next
+		}
+		last.rules = append(last.rules, i)
+		s.rules = append(s.rules, rule.Name)
+	}
+	return s, nil
+}
+
+// conjunctions appends the operands of the && of node to list, in order.
+func conjunctions(node ast.Node, list []ast.Node) []ast.Node {
+	if b, ok := node.(*ast.BinaryNode); ok && (b.Operator == "&&" || b.Operator == "and") {
+		list = conjunctions(b.Left, list)
+		return conjunctions(b.Right, list)
+	}
+	return append(list, node)
+}
+
+func bind(err error, tree *parser.Tree) error {
+	var fileError *file.Error
+	if errors.As(err, &fileError) {
+		return fileError.Bind(tree.Source)
+	}
+	return err
+}
+
+// Len returns the number of distinct conjunctions of the rules, which is
+// the maximum number of evaluations per env.
+func (s *Set) Len() int {
+	return len(s.terms)
+}
+
+// Run evaluates the rules with the env and returns their verdicts, in the
+// order of the rules.
+func (s *Set) Run(env any) []Verdict {
+	r := &run{
+		set:     s,
+		env:     env,
+		values:  make([]int8, len(s.terms)),
+		errors:  make([]error, len(s.terms)),
+		verdict: make([]Verdict, len(s.rules)),
+	}
+	for i, name := range s.rules {
+		r.verdict[i].Rule = name
+	}
+	for _, n := range s.roots {
+		r.visit(n)
+	}
+	return r.verdict
+}
+
+// Values of run.values.
+const (
+	unknown int8 = iota
+	isTrue
+	isFalse
+	failed
+)
+
+type run struct {
+	set     *Set
+	env     any
+	vm      vm.VM
+	values  []int8
+	errors  []error
+	verdict []Verdict
+}
+
+func (r *run) visit(n *node) {
+	switch r.eval(n.term) {
+	case isFalse:
+		return
+	case failed:
+		for _, i := range n.all {
+			r.verdict[i].Err = r.errors[n.term]
+		}
+		return
+	}
+	for _, i := range n.rules {
+		r.verdict[i].Match = true
+	}
+	for _, child := range n.children {
+		r.visit(child)
+	}
+}
+
+func (r *run) eval(term int) int8 {
+	if r.values[term] != unknown {
+		return r.values[term]
+	}
+	out, err := r.vm.Run(r.set.terms[term], r.env)
+	switch {
+	case err != nil:
+		r.values[term] = failed
+		r.errors[term] = err
+	case out == true:
+		r.values[term] = isTrue
+	case out == false:
+		r.values[term] = isFalse
+	default:
+		r.values[term] = failed
+		r.errors[term] = fmt.Errorf("expected bool, but got %T", out)
+	}
+	return r.values[term]
+}
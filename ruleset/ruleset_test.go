@@ -0,0 +1,90 @@
+package ruleset_test
+
+import (
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ruleset"
+)
+
+type event struct {
+	Kind    string
+	Country string
+	Amount  int
+	Tags    []string
+}
+
+func TestSet(t *testing.T) {
+	calls := map[string]int{}
+	check := expr.Function("check", func(params ...any) (any, error) {
+		calls[params[0].(string)]++
+		return true, nil
+	}, new(func(string) bool))
+
+	rules := []ruleset.Rule{
+		{"big", `check("kind") && Kind == "payment" && Amount > 1000`},
+		{"foreign", `check("kind") and Kind == "payment" && Country != "FR"`},
+		{"big foreign", `check("kind") && Kind == "payment" && Amount > 1000 && Country != "FR"`},
+		{"tagged", `Country != "FR" && "vip" in Tags`},
+		{"refund", `Kind == "refund"`},
+	}
+	set, err := ruleset.Compile(rules, expr.Env(event{}), check)
+	require.NoError(t, err)
+	assert.Equal(t, 6, set.Len())
+
+	tests := []struct {
+		event event
+		want  []bool
+	}{
+		{event{Kind: "payment", Country: "DE", Amount: 5000, Tags: []string{"vip"}}, []bool{true, true, true, true, false}},
+		{event{Kind: "payment", Country: "FR", Amount: 5000}, []bool{true, false, false, false, false}},
+		{event{Kind: "refund", Country: "DE", Amount: 10}, []bool{false, false, false, false, true}},
+	}
+
+	for _, tt := range tests {
+		calls = map[string]int{}
+		verdicts := set.Run(tt.event)
+		require.Len(t, verdicts, len(rules))
+		for i, v := range verdicts {
+			assert.Equal(t, rules[i].Name, v.Rule)
+			assert.NoError(t, v.Err)
+			assert.Equal(t, tt.want[i], v.Match, rules[i].Name)
+
+			program, err := expr.Compile(rules[i].Expression, expr.Env(event{}), check)
+			require.NoError(t, err)
+			out, err := expr.Run(program, tt.event)
+			require.NoError(t, err)
+			assert.Equal(t, out, v.Match, rules[i].Name)
+		}
+	}
+
+	calls = map[string]int{}
+	set.Run(tests[0].event)
+	assert.Equal(t, 1, calls["kind"])
+}
+
+func TestSet_error(t *testing.T) {
+	rules := []ruleset.Rule{
+		{"a", `Tags[0] == "x"`},
+		{"b", `Tags[0] == "x" && Amount > 0`},
+		{"c", `Amount > 0`},
+	}
+	set, err := ruleset.Compile(rules, expr.Env(event{}))
+	require.NoError(t, err)
+
+	verdicts := set.Run(event{Amount: 1})
+	assert.Error(t, verdicts[0].Err)
+	assert.Error(t, verdicts[1].Err)
+	assert.False(t, verdicts[1].Match)
+	assert.NoError(t, verdicts[2].Err)
+	assert.True(t, verdicts[2].Match)
+}
+
+func TestCompile_error(t *testing.T) {
+	_, err := ruleset.Compile([]ruleset.Rule{{"amount", `Amount + 1`}}, expr.Env(event{}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rule amount: expected bool, but got int")
+}
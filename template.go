@@ -0,0 +1,105 @@
+package expr
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/checker"
+	"github.com/expr-lang/expr/file"
+	"github.com/expr-lang/expr/parser"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Template is an expression with placeholders, like amount > :threshold.
+// It is parsed once, and every set of bindings is compiled to a program of
+// its own, with the placeholders replaced by the bound values. Placeholders
+// have the types of their values, so each program is type checked as if the
+// values were written in the expression.
+type Template struct {
+	tree         *parser.Tree
+	ops          []Option
+	placeholders []string
+}
+
+// CompileTemplate parses a template. The options are used to compile the
+// programs of every Bind.
+func CompileTemplate(input string, ops ...Option) (*Template, error) {
+	tree, err := parser.ParseWithConfig(input, newConfig(ops))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var placeholders []string
+	ast.Find(tree.Node, func(node ast.Node) bool {
+		if p, ok := node.(*ast.PlaceholderNode); ok && !seen[p.Name] {
+			seen[p.Name] = true
+			placeholders = append(placeholders, p.Name)
+		}
+		return false
+	})
+	sort.Strings(placeholders)
+
+	return &Template{tree: tree, ops: ops, placeholders: placeholders}, nil
+}
+
+// Placeholders returns the names of the placeholders, sorted.
+func (t *Template) Placeholders() []string {
+	return t.placeholders
+}
+
+// Bind compiles the template with the placeholders replaced by the values of
+// the bindings. Every placeholder must be bound, and every binding must be a
+// placeholder of the template. The parsed template is not changed, so Bind
+// can be called for any number of binding sets.
+func (t *Template) Bind(bindings map[string]any) (*vm.Program, error) {
+	for name := range bindings {
+		i := sort.SearchStrings(t.placeholders, name)
+		if i == len(t.placeholders) || t.placeholders[i] != name {
+			return nil, fmt.Errorf("unknown placeholder :%v", name)
+		}
+	}
+
+	tree := *t.tree
+	tree.Node = ast.Copy(t.tree.Node)
+	b := &binder{bindings: bindings}
+	ast.Walk(&tree.Node, b)
+	if b.err != nil {
+		return nil, b.err.Bind(tree.Source)
+	}
+
+	config := newConfig(t.ops)
+	if err := checker.PatchCheck(&tree, config); err != nil {
+		return nil, err
+	}
+	return compile(context.Background(), &tree, config)
+}
+
+type binder struct {
+	bindings map[string]any
+	err      *file.Error
+}
+
+func (b *binder) Visit(node *ast.Node) {
+	p, ok := (*node).(*ast.PlaceholderNode)
+	if !ok {
+		return
+	}
+	value, ok := b.bindings[p.Name]
+	if !ok {
+		if b.err == nil {
+			b.err = &file.Error{
+				Location: p.Location(),
+				Message:  fmt.Sprintf("placeholder :%v is not bound", p.Name),
+			}
+		}
+		return
+	}
+	if value == nil {
+		ast.Patch(node, &ast.NilNode{})
+	} else {
+		ast.Patch(node, &ast.ConstantNode{Value: value})
+	}
+}
@@ -46,8 +46,8 @@ func TestIssue461(t *testing.T) {
 		},
 		{
 			input: `S == "string"`,
-			env:   Env{Str: "string"},
-			err:   "invalid operation: == (mismatched types issue_test.EnvStr and string)",
+			env:   Env{S: "string"},
+			want:  true,
 		},
 		{
 			input: "EnvField.Str == EnvField.S",
@@ -71,8 +71,8 @@ func TestIssue461(t *testing.T) {
 		},
 		{
 			input: `EnvField.S == "string"`,
-			env:   Env{EnvField: EnvField{Str: "string"}},
-			err:   "invalid operation: == (mismatched types issue_test.EnvStr and string)",
+			env:   Env{EnvField: EnvField{S: "string"}},
+			want:  true,
 		},
 	}
 
@@ -15,6 +15,7 @@ const (
 
 type Env struct {
 	Mode *ModeEnum
+	Int  int
 }
 
 func TestIssue730(t *testing.T) {
@@ -35,13 +36,27 @@ func TestIssue730(t *testing.T) {
 }
 
 func TestIssue730_warn_about_different_types(t *testing.T) {
-	code := `Mode == 1`
+	code := `Mode == Int`
 
 	_, err := expr.Compile(code, expr.Env(Env{}))
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "invalid operation: == (mismatched types issue_test.ModeEnum and int)")
 }
 
+func TestIssue730_compare_with_literal(t *testing.T) {
+	code := `Mode == 1`
+
+	tmp := ModeEnumA
+	env := Env{Mode: &tmp}
+
+	program, err := expr.Compile(code, expr.Env(Env{}))
+	require.NoError(t, err)
+
+	output, err := expr.Run(program, env)
+	require.NoError(t, err)
+	require.True(t, output.(bool))
+}
+
 func TestIssue730_eval(t *testing.T) {
 	code := `Mode == 1`
 
@@ -51,10 +66,8 @@ func TestIssue730_eval(t *testing.T) {
 		"Mode": &tmp,
 	}
 
-	// Golang also does not allow this:
-	// _ = ModeEnumA == int(1) // will not compile
-
+	// Like ModeEnumA == 1 in Go, the untyped literal takes the type of Mode.
 	out, err := expr.Eval(code, env)
 	require.NoError(t, err)
-	require.False(t, out.(bool))
+	require.True(t, out.(bool))
 }
@@ -184,3 +184,52 @@ func (a array) Equal(t Type) bool {
 func (a array) String() string {
 	return fmt.Sprintf("Array{%s}", a.of.String())
 }
+
+// Union returns a type of values which may be of any of the types, like map
+// fields which hold either a string or a number. The checker accepts
+// operations valid for all of the types, and comparisons with any of them.
+func Union(types ...Type) Type {
+	return union(types)
+}
+
+type union []Type
+
+func (u union) Nature() Nature {
+	natures := make([]Nature, len(u))
+	for i, t := range u {
+		natures[i] = t.Nature()
+	}
+	return UnionOf(natures...)
+}
+
+func (u union) Equal(t Type) bool {
+	if t == Any {
+		return true
+	}
+	ut, ok := t.(union)
+	if !ok || len(u) != len(ut) {
+		return false
+	}
+	// The order of the types does not matter.
+	for _, a := range u {
+		found := false
+		for _, b := range ut {
+			if a.Equal(b) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (u union) String() string {
+	names := make([]string, len(u))
+	for i, t := range u {
+		names[i] = t.String()
+	}
+	return fmt.Sprintf("Union{%s}", strings.Join(names, ", "))
+}
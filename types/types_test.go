@@ -36,6 +36,11 @@ func TestType_Equal(t *testing.T) {
 		{"25", Map{"foo": Int}, Any, true},
 		{"28", Any, Array(Int), true},
 		{"29", Array(Int), Any, true},
+		{"30", Union(String, Int), Union(String, Int), true},
+		{"31", Union(String, Int), Union(Int, String), true},
+		{"32", Union(String, Int), Union(String, Float), false},
+		{"33", Union(String, Int), String, false},
+		{"34", Union(String, Int), Any, true},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,233 @@
+// Package typesinfo exposes the types inferred by the checker for external
+// tools, like linters, editors and documentation generators.
+//
+// The checker works with an internal representation of types, which changes
+// between releases. The types in this package wrap it, and only add new
+// methods in later releases, so tools built on them keep working.
+package typesinfo
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/builtin"
+	"github.com/expr-lang/expr/checker"
+	"github.com/expr-lang/expr/checker/nature"
+	"github.com/expr-lang/expr/conf"
+)
+
+// Type describes the type of a value: a variable, a field or the result of
+// an expression.
+type Type struct {
+	nt nature.Nature
+}
+
+// TypeOf returns the type of a node of a checked tree.
+func TypeOf(node ast.Node) Type {
+	return Type{nt: node.Nature()}
+}
+
+// Kind returns the kind of the type, or reflect.Invalid if the type is
+// unknown.
+func (t Type) Kind() reflect.Kind {
+	return t.nt.Kind()
+}
+
+// IsUnknown reports whether the type is not known before running the
+// expression, like values of interface{} type.
+func (t Type) IsUnknown() bool {
+	return t.nt.IsUnknown()
+}
+
+// IsNil reports whether the value is always nil.
+func (t Type) IsNil() bool {
+	return t.nt.Nil
+}
+
+// Reflect returns the Go type, or nil if the type is unknown.
+func (t Type) Reflect() reflect.Type {
+	return t.nt.Type
+}
+
+func (t Type) String() string {
+	if t.nt.Nil {
+		return "nil"
+	}
+	return t.nt.String()
+}
+
+// Elem returns the element type of an array, a map or a pointer. For
+// arrays and maps with known element types, like types.Array(types.Int),
+// the known type is returned.
+func (t Type) Elem() Type {
+	return Type{nt: t.nt.Elem()}
+}
+
+// Key returns the key type of a map.
+func (t Type) Key() Type {
+	return Type{nt: t.nt.Key()}
+}
+
+// Field returns the type of a field, a method or a known map key.
+func (t Type) Field(name string) (Type, bool) {
+	nt, ok := t.nt.Get(name)
+	return Type{nt: nt}, ok
+}
+
+// Fields returns the fields, methods and known map keys, sorted by name.
+func (t Type) Fields() []Field {
+	all := t.nt.All()
+	fields := make([]Field, 0, len(all))
+	for name, nt := range all {
+		fields = append(fields, Field{
+			Name:   name,
+			Type:   Type{nt: nt},
+			Method: nt.Method,
+		})
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+	return fields
+}
+
+// Strict reports whether a map has only the known keys returned by Fields.
+// It is always true for structs.
+func (t Type) Strict() bool {
+	if t.nt.Deref().Kind() == reflect.Struct {
+		return true
+	}
+	return t.nt.Strict
+}
+
+// Signatures returns the signatures of a function or a method. Functions
+// defined with expr.Function can have several signatures.
+func (t Type) Signatures() []Signature {
+	if t.nt.Func != nil {
+		return signatures(t.nt.Func)
+	}
+	if t.Kind() != reflect.Func {
+		return nil
+	}
+	return []Signature{signatureOf(t.nt.Type, t.nt.Method)}
+}
+
+// Field is a field, a method or a known key of a map.
+type Field struct {
+	Name   string
+	Type   Type
+	Method bool
+}
+
+// Signature is a function signature. Out is the first result of the
+// function; a second error result is not included.
+type Signature struct {
+	In       []Type
+	Out      Type
+	Variadic bool
+}
+
+func signatureOf(fn reflect.Type, method bool) Signature {
+	var s Signature
+	for i := 0; i < fn.NumIn(); i++ {
+		if method && i == 0 {
+			continue
+		}
+		s.In = append(s.In, Type{nt: nature.Nature{Type: fn.In(i)}})
+	}
+	if fn.NumOut() > 0 {
+		s.Out = Type{nt: nature.Nature{Type: fn.Out(0)}}
+	}
+	s.Variadic = fn.IsVariadic()
+	return s
+}
+
+func signatures(fn *builtin.Function) []Signature {
+	s := make([]Signature, 0, len(fn.Types))
+	for _, t := range fn.Types {
+		s = append(s, signatureOf(t, false))
+	}
+	return s
+}
+
+// Function is a function available to expressions. Signatures is empty
+// for builtins which check their arguments with custom rules, like len.
+type Function struct {
+	Name       string
+	Signatures []Signature
+	Builtin    bool
+}
+
+// Info holds the types of a checked expression.
+type Info struct {
+	Node      ast.Node
+	Output    Type
+	Env       Type
+	Functions []Function
+}
+
+// TypeOf returns the type of a node of the expression.
+func (i *Info) TypeOf(node ast.Node) Type {
+	return TypeOf(node)
+}
+
+// Check parses and type checks the expression with the same options as
+// expr.Compile, and returns the types of the expression.
+func Check(input string, ops ...expr.Option) (*Info, error) {
+	config := conf.CreateNew()
+	for _, op := range ops {
+		op(config)
+	}
+	for name := range config.Disabled {
+		delete(config.Builtins, name)
+	}
+	config.Check()
+
+	tree, err := checker.ParseCheck(input, config)
+	if err != nil {
+		return nil, err
+	}
+	return &Info{
+		Node:      tree.Node,
+		Output:    TypeOf(tree.Node),
+		Env:       Type{nt: config.Env},
+		Functions: Functions(config),
+	}, nil
+}
+
+// Functions returns the functions, including those of namespaces, and the
+// builtins of the config, sorted by name. Functions override builtins of
+// the same name.
+func Functions(config *conf.Config) []Function {
+	var functions []Function
+	for name, fn := range config.Functions {
+		functions = append(functions, Function{
+			Name:       name,
+			Signatures: signatures(fn),
+		})
+	}
+	for _, ns := range config.Namespaces {
+		for _, fn := range ns {
+			functions = append(functions, Function{
+				Name:       fn.Name,
+				Signatures: signatures(fn),
+			})
+		}
+	}
+	for name, fn := range config.Builtins {
+		if _, ok := config.Functions[name]; ok {
+			continue
+		}
+		functions = append(functions, Function{
+			Name:       name,
+			Signatures: signatures(fn),
+			Builtin:    true,
+		})
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		return functions[i].Name < functions[j].Name
+	})
+	return functions
+}
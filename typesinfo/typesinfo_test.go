@@ -0,0 +1,99 @@
+package typesinfo_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+	"github.com/expr-lang/expr/types"
+	"github.com/expr-lang/expr/typesinfo"
+)
+
+type User struct {
+	Name string
+	Age  int `expr:"age"`
+}
+
+func (User) Greet(greeting string) string {
+	return greeting
+}
+
+func TestCheck(t *testing.T) {
+	env := types.Map{
+		"user":   types.TypeOf(User{}),
+		"scores": types.Array(types.Float64),
+	}
+	info, err := typesinfo.Check(`user.Greet("hi") + user.Name`, expr.Env(env))
+	require.NoError(t, err)
+	assert.Equal(t, "string", info.Output.String())
+	assert.Equal(t, reflect.String, info.Output.Kind())
+
+	var members []string
+	ast.Find(info.Node, func(node ast.Node) bool {
+		if m, ok := node.(*ast.MemberNode); ok {
+			members = append(members, m.String()+": "+info.TypeOf(m).String())
+		}
+		return false
+	})
+	assert.Equal(t, []string{`user.Greet: func(typesinfo_test.User, string) string`, `user.Name: string`}, members)
+
+	scores, ok := info.Env.Field("scores")
+	require.True(t, ok)
+	assert.Equal(t, reflect.Slice, scores.Kind())
+	assert.Equal(t, "float64", scores.Elem().String())
+
+	_, err = typesinfo.Check(`user.Unknown`, expr.Env(env))
+	require.Error(t, err)
+}
+
+func TestType_Fields(t *testing.T) {
+	info, err := typesinfo.Check(`user`, expr.Env(map[string]any{"user": User{}}))
+	require.NoError(t, err)
+
+	var names []string
+	for _, f := range info.Output.Fields() {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"Greet", "Name", "age"}, names)
+	assert.True(t, info.Output.Strict())
+
+	greet, ok := info.Output.Field("Greet")
+	require.True(t, ok)
+	sig := greet.Signatures()
+	require.Len(t, sig, 1)
+	require.Len(t, sig[0].In, 1)
+	assert.Equal(t, "string", sig[0].In[0].String())
+	assert.Equal(t, "string", sig[0].Out.String())
+}
+
+func TestFunctions(t *testing.T) {
+	info, err := typesinfo.Check(`double(2)`, expr.Function(
+		"double",
+		func(params ...any) (any, error) { return params[0].(int) * 2, nil },
+		new(func(int) int),
+		new(func(float64) float64),
+	))
+	require.NoError(t, err)
+
+	var double, upper *typesinfo.Function
+	for i, fn := range info.Functions {
+		switch fn.Name {
+		case "double":
+			double = &info.Functions[i]
+		case "upper":
+			upper = &info.Functions[i]
+		}
+	}
+	require.NotNil(t, double)
+	assert.False(t, double.Builtin)
+	require.Len(t, double.Signatures, 2)
+	assert.Equal(t, "float64", double.Signatures[1].Out.String())
+
+	require.NotNil(t, upper)
+	assert.True(t, upper.Builtin)
+	assert.True(t, strings.HasPrefix(upper.Signatures[0].Out.String(), "string"))
+}
@@ -0,0 +1,80 @@
+package expr_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/conf"
+	"github.com/expr-lang/expr/parser/operator"
+)
+
+type validateEnv struct {
+	Add     func(int, int) int
+	Compare func(int, int) int
+}
+
+func TestValidate(t *testing.T) {
+	err := expr.Validate(
+		expr.Env(validateEnv{}),
+		expr.Operator("+", "Add"),
+		expr.CustomOperator("<=>", "Compare", 20, operator.Left),
+		expr.OperatorAlias("et", "and"),
+		expr.DisableBuiltin("max"),
+		expr.AsBool(),
+	)
+	require.NoError(t, err)
+}
+
+func TestValidate_problems(t *testing.T) {
+	err := expr.Validate(
+		expr.Env(validateEnv{}),
+		expr.Operator("+", "Missing"),
+		expr.OperatorAlias("avec", "with"),
+		expr.CustomOperator("within", "max", 20, operator.Left),
+		expr.CustomOperator("<=>", "Cmp", 20, operator.Left),
+		expr.DisableBuiltin("max"),
+		expr.DisableBuiltin("maxx"),
+		expr.WithQuota(&conf.Quota{Builtins: []string{"len", "max"}}),
+		expr.Namespace("Add", expr.Function("one", func(...any) (any, error) { return 1, nil })),
+		expr.AsKind(reflect.Interface),
+		expr.WarnOnAny(),
+	)
+	require.Error(t, err)
+
+	var validationError *conf.ValidationError
+	require.ErrorAs(t, err, &validationError)
+	assert.Equal(t, []string{
+		`unknown operator "with" for alias "avec"`,
+		`函数 Missing 不存在`,
+		`disabled builtin "maxx" does not exist`,
+		`function "Cmp" of custom operator "<=>" does not exist`,
+		`custom operator "within" calls disabled builtin "max"`,
+		`builtin "max" allowed by quota is disabled`,
+		`namespace "Add" hides the env value of the same name`,
+		`expected kind interface conflicts with WarnOnAny`,
+	}, validationError.Problems)
+}
+
+func TestValidate_config(t *testing.T) {
+	config := conf.New(validateEnv{})
+	require.NoError(t, config.Validate())
+
+	config.Visitors = append(config.Visitors, &badChecker{})
+	config.Disabled["upper"] = true
+	config.Pure["upper"] = true
+	err := config.Validate()
+	require.EqualError(t, err, `invalid config: bad checker; pure function "upper" is a disabled builtin`)
+}
+
+type badChecker struct{}
+
+func (*badChecker) Visit(*ast.Node) {}
+
+func (*badChecker) Check() {
+	panic("bad checker")
+}
@@ -0,0 +1,93 @@
+package vm
+
+import (
+	"github.com/expr-lang/expr/vm/runtime"
+)
+
+// BoundProgram is a program specialized to an env by Program.Bind.
+type BoundProgram struct {
+	*Program
+	Variables []string // variables which are still loaded from the env of Run
+}
+
+// Bind returns a copy of the program where the values of the env, except
+// those of the variables, are loaded once, from the env, and become
+// constants. Binding suits envs which do not change, like configuration:
+// running the bound program only looks up the variables, which differ
+// between runs, and skips the reflection of the other fields.
+//
+// The env of Run must be of the type of the env the program was compiled
+// with and have the variables set. Methods of the env and $env are still
+// taken from it. Bound values which are not simple values, like structs,
+// can not be serialized with MarshalBinary.
+func (program *Program) Bind(env any, variables ...string) *BoundProgram {
+	dynamic := make(map[string]bool, len(variables))
+	for _, name := range variables {
+		dynamic[name] = true
+	}
+
+	p := *program
+	p.Bytecode = make([]Opcode, len(program.Bytecode))
+	copy(p.Bytecode, program.Bytecode)
+	p.Arguments = make([]int, len(program.Arguments))
+	copy(p.Arguments, program.Arguments)
+	p.Constants = make([]any, len(program.Constants))
+	copy(p.Constants, program.Constants)
+
+	for ip, op := range program.Bytecode {
+		if op != OpLoadConst && op != OpLoadField && op != OpLoadFast && op != OpLoadDynamic {
+			continue
+		}
+		value, ok := bind(env, op, program.Constants[program.Arguments[ip]], dynamic)
+		if ok {
+			p.Bytecode[ip] = OpPush
+			p.Arguments[ip] = len(p.Constants)
+			p.Constants = append(p.Constants, value)
+		}
+	}
+	return &BoundProgram{Program: &p, Variables: variables}
+}
+
+// bind loads the value of the load instruction from the env. Loads which
+// fail, like of a field of a nil pointer behind a nil check, are not bound
+// and fail when they run, if they do.
+func bind(env any, op Opcode, constant any, dynamic map[string]bool) (value any, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			value, ok = nil, false
+		}
+	}()
+	switch op {
+	case OpLoadConst:
+		if name, isString := constant.(string); !isString || dynamic[name] {
+			return nil, false
+		}
+		return runtime.Fetch(env, constant), true
+	case OpLoadField:
+		field := constant.(*runtime.Field)
+		if dynamic[field.Path[0]] {
+			return nil, false
+		}
+		return runtime.FetchField(env, field), true
+	case OpLoadDynamic:
+		if dynamic[constant.(string)] {
+			return nil, false
+		}
+		return runtime.Resolve(env, constant.(string)), true
+	case OpLoadFast:
+		if dynamic[constant.(string)] {
+			return nil, false
+		}
+		m, isMap := env.(map[string]any)
+		if !isMap {
+			return nil, false
+		}
+		return m[constant.(string)], true
+	}
+	return nil, false
+}
+
+// Run runs the bound program with the env of the variables.
+func (program *BoundProgram) Run(env any) (any, error) {
+	return Run(program.Program, env)
+}
@@ -0,0 +1,75 @@
+package vm_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/expr-lang/expr/vm/runtime"
+)
+
+type bindLimits struct {
+	Max  int
+	Tags []string
+}
+
+type bindEnv struct {
+	Limits  bindLimits
+	Owner   *bindLimits
+	Request struct {
+		Amount int
+		Tag    string
+	}
+}
+
+func TestProgram_Bind(t *testing.T) {
+	program, err := expr.Compile(
+		`Request.Amount <= Limits.Max && Request.Tag in Limits.Tags && (Owner == nil || Owner.Max > 0)`,
+		expr.Env(bindEnv{}),
+	)
+	require.NoError(t, err)
+
+	bound := program.Bind(bindEnv{Limits: bindLimits{Max: 100, Tags: []string{"a", "b"}}}, "Request")
+	assert.Equal(t, []string{"Request"}, bound.Variables)
+	var loads []string
+	for ip, op := range bound.Bytecode {
+		if op == vm.OpLoadField {
+			field := bound.Constants[bound.Arguments[ip]].(*runtime.Field)
+			loads = append(loads, strings.Join(field.Path, "."))
+		}
+	}
+	// Owner is nil, so Owner.Max is left to fail at runtime, if it runs.
+	assert.Equal(t, []string{"Request.Amount", "Request.Tag", "Owner.Max"}, loads)
+
+	var request bindEnv
+	request.Request.Amount = 50
+	request.Request.Tag = "a"
+	out, err := bound.Run(request)
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+
+	request.Request.Amount = 500
+	out, err = bound.Run(request)
+	require.NoError(t, err)
+	assert.Equal(t, false, out)
+
+	// The original program is not changed.
+	out, err = expr.Run(program, request)
+	require.NoError(t, err)
+	assert.Equal(t, false, out)
+}
+
+func TestProgram_Bind_map(t *testing.T) {
+	env := map[string]any{"rate": 2, "amount": 0}
+	program, err := expr.Compile(`amount * rate`, expr.Env(env))
+	require.NoError(t, err)
+
+	bound := program.Bind(env, "amount")
+	out, err := bound.Run(map[string]any{"amount": 21})
+	require.NoError(t, err)
+	assert.Equal(t, 42, out)
+}
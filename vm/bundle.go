@@ -0,0 +1,155 @@
+package vm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/expr-lang/expr/conf"
+)
+
+// Bundle layout, all integers are little-endian:
+//
+//	header   magic [8]byte, version uint32, count uint32,
+//	         fingerprint [64]byte, checksum [32]byte (sha256 of the rest)
+//	index    count entries of name offset, name length,
+//	         program offset, program length (uint64 each)
+//	data     names and programs, programs aligned to 8 bytes
+//
+// Offsets are relative to the start of the bundle, so a memory mapped file
+// can be passed to ReadBundle as is.
+const (
+	bundleMagic       = "exprbndl"
+	bundleVersion     = 1
+	bundleHeaderSize  = 8 + 4 + 4 + 64 + sha256.Size
+	bundleEntrySize   = 4 * 8
+	bundleFingerprint = 64
+)
+
+// Bundle is a set of named programs compiled against the same env schema.
+type Bundle struct {
+	// Fingerprint of the env schema, see conf.Fingerprint.
+	Fingerprint string
+	// Names of the programs in the bundle, sorted.
+	Names    []string
+	programs map[string]*Program
+}
+
+// Program returns the program with the given name.
+func (b *Bundle) Program(name string) (*Program, bool) {
+	p, ok := b.programs[name]
+	return p, ok
+}
+
+// Compatible reports whether the bundle was compiled against the env schema
+// of env. Programs of an incompatible bundle must not be run with env.
+func (b *Bundle) Compatible(env any) bool {
+	return b.Fingerprint == conf.Fingerprint(env)
+}
+
+// WriteBundle writes programs with the env schema fingerprint as a single
+// bundle. Programs are stored in the order of their names.
+func WriteBundle(w io.Writer, fingerprint string, programs map[string]*Program) error {
+	if len(fingerprint) > bundleFingerprint {
+		return fmt.Errorf("fingerprint is longer than %d bytes", bundleFingerprint)
+	}
+
+	names := make([]string, 0, len(programs))
+	for name := range programs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	index := make([]byte, len(names)*bundleEntrySize)
+	var data bytes.Buffer
+	offset := uint64(bundleHeaderSize + len(index))
+	for i, name := range names {
+		b, err := programs[name].MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("cannot marshal program %v: %w", name, err)
+		}
+
+		entry := index[i*bundleEntrySize:]
+		binary.LittleEndian.PutUint64(entry[0:], offset+uint64(data.Len()))
+		binary.LittleEndian.PutUint64(entry[8:], uint64(len(name)))
+		data.WriteString(name)
+		for (offset+uint64(data.Len()))%8 != 0 {
+			data.WriteByte(0)
+		}
+		binary.LittleEndian.PutUint64(entry[16:], offset+uint64(data.Len()))
+		binary.LittleEndian.PutUint64(entry[24:], uint64(len(b)))
+		data.Write(b)
+	}
+
+	h := sha256.New()
+	h.Write(index)
+	h.Write(data.Bytes())
+
+	header := make([]byte, bundleHeaderSize)
+	copy(header, bundleMagic)
+	binary.LittleEndian.PutUint32(header[8:], bundleVersion)
+	binary.LittleEndian.PutUint32(header[12:], uint32(len(names)))
+	copy(header[16:16+bundleFingerprint], fingerprint)
+	copy(header[16+bundleFingerprint:], h.Sum(nil))
+
+	for _, b := range [][]byte{header, index, data.Bytes()} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadBundle verifies the checksum of the bundle and loads all its programs,
+// resolving functions through the registry (see Load).
+func ReadBundle(data []byte, registry *Registry) (*Bundle, error) {
+	if len(data) < bundleHeaderSize || string(data[:8]) != bundleMagic {
+		return nil, fmt.Errorf("not an expr bundle")
+	}
+	if v := binary.LittleEndian.Uint32(data[8:]); v != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", v)
+	}
+	count := uint64(binary.LittleEndian.Uint32(data[12:]))
+	sum := sha256.Sum256(data[bundleHeaderSize:])
+	if !bytes.Equal(sum[:], data[16+bundleFingerprint:bundleHeaderSize]) {
+		return nil, fmt.Errorf("bundle checksum mismatch")
+	}
+	if count*bundleEntrySize > uint64(len(data)-bundleHeaderSize) {
+		return nil, fmt.Errorf("corrupted bundle: index out of range")
+	}
+
+	b := &Bundle{
+		Fingerprint: string(bytes.TrimRight(data[16:16+bundleFingerprint], "\x00")),
+		Names:       make([]string, 0, count),
+		programs:    make(map[string]*Program, count),
+	}
+	section := func(entry []byte) ([]byte, error) {
+		offset := binary.LittleEndian.Uint64(entry)
+		length := binary.LittleEndian.Uint64(entry[8:])
+		if offset > uint64(len(data)) || length > uint64(len(data))-offset {
+			return nil, fmt.Errorf("corrupted bundle: section out of range")
+		}
+		return data[offset : offset+length], nil
+	}
+	for i := uint64(0); i < count; i++ {
+		entry := data[bundleHeaderSize+i*bundleEntrySize:]
+		name, err := section(entry)
+		if err != nil {
+			return nil, err
+		}
+		program, err := section(entry[16:])
+		if err != nil {
+			return nil, err
+		}
+		p, err := Load(program, registry)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load program %s: %w", name, err)
+		}
+		b.Names = append(b.Names, string(name))
+		b.programs[string(name)] = p
+	}
+	return b, nil
+}
@@ -0,0 +1,55 @@
+package vm_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/conf"
+	"github.com/expr-lang/expr/test/mock"
+	"github.com/expr-lang/expr/vm"
+)
+
+func TestBundle(t *testing.T) {
+	env := mock.Env{Int: 7, String: "abc"}
+	programs := map[string]*vm.Program{}
+	for name, code := range map[string]string{
+		"big":    `Int > 5`,
+		"prefix": `hasPrefix(String, "ab")`,
+		"upper":  `upper(String)`,
+	} {
+		program, err := expr.Compile(code, expr.Env(mock.Env{}))
+		require.NoError(t, err)
+		programs[name] = program
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, vm.WriteBundle(&buf, conf.Fingerprint(mock.Env{}), programs))
+
+	bundle, err := vm.ReadBundle(buf.Bytes(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"big", "prefix", "upper"}, bundle.Names)
+	assert.True(t, bundle.Compatible(env))
+	assert.False(t, bundle.Compatible(map[string]any{"Int": 1}))
+
+	program, ok := bundle.Program("upper")
+	require.True(t, ok)
+	out, err := expr.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, "ABC", out)
+
+	corrupted := append([]byte{}, buf.Bytes()...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	_, err = vm.ReadBundle(corrupted, nil)
+	require.EqualError(t, err, "bundle checksum mismatch")
+}
+
+func TestFingerprint(t *testing.T) {
+	assert.Equal(t, conf.Fingerprint(mock.Env{}), conf.Fingerprint(mock.Env{Int: 1}))
+	assert.NotEqual(t, conf.Fingerprint(mock.Env{}), conf.Fingerprint(&mock.Env{}))
+	assert.Equal(t, conf.Fingerprint(map[string]any{"a": 1, "b": "x"}), conf.Fingerprint(map[string]any{"b": "y", "a": 2}))
+	assert.NotEqual(t, conf.Fingerprint(map[string]any{"a": 1}), conf.Fingerprint(map[string]any{"a": "1"}))
+}
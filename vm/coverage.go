@@ -0,0 +1,63 @@
+package vm
+
+import (
+	"sync/atomic"
+
+	"github.com/expr-lang/expr/file"
+)
+
+// Branch is a decision of an expression compiled with conf.Config.Coverage:
+// the condition of a ternary, the left side of &&, || or ??, or the predicate
+// of a builtin like filter or all. The branches stored in the program only
+// describe the decisions; their counters are filled in the copies returned by
+// Program.Coverage.
+type Branch struct {
+	// counts of true and false, updated atomically by the runs; first, so
+	// they are 64-bit aligned on 32-bit platforms.
+	counts [2]int64
+
+	Kind       string        `json:"kind"`       // ?:, the operator, or the name of the builtin
+	Expression string        `json:"expression"` // the condition
+	Location   file.Location `json:"location"`
+	// True is the number of times the condition was true, or not nil for
+	// ??, and False the number of times it was false, or nil for ??. A
+	// branch with a zero counter was never taken.
+	True  int64 `json:"true"`
+	False int64 `json:"false"`
+}
+
+// Coverage returns the branches of the program, in the order of the
+// bytecode, with the number of times each way was taken in all the runs so
+// far. It returns nil if the program was compiled without
+// conf.Config.Coverage.
+func (program *Program) Coverage() []Branch {
+	var branches []Branch
+	seen := map[*Branch]bool{}
+	for ip, op := range program.Bytecode {
+		if op != OpCover && op != OpCoverNil {
+			continue
+		}
+		b := program.Constants[program.Arguments[ip]].(*Branch)
+		if seen[b] {
+			continue
+		}
+		seen[b] = true
+		branches = append(branches, Branch{
+			Kind:       b.Kind,
+			Expression: b.Expression,
+			Location:   b.Location,
+			True:       atomic.LoadInt64(&b.counts[0]),
+			False:      atomic.LoadInt64(&b.counts[1]),
+		})
+	}
+	return branches
+}
+
+// take counts a decision of the branch.
+func (b *Branch) take(taken bool) {
+	if taken {
+		atomic.AddInt64(&b.counts[0], 1)
+	} else {
+		atomic.AddInt64(&b.counts[1], 1)
+	}
+}
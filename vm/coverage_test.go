@@ -0,0 +1,60 @@
+package vm_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+func TestProgram_Coverage(t *testing.T) {
+	type Env struct {
+		A     int
+		B     bool
+		Name  *string
+		Items []int
+	}
+	program, err := expr.Compile(
+		`(A > 0 ? "pos" : "neg") + (Name ?? "anon") + string(B && A > 1) + string(all(Items, # > 1))`,
+		expr.Env(Env{}), expr.Coverage())
+	require.NoError(t, err)
+
+	name := "bob"
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := vm.Run(program, Env{A: 2, B: false, Items: []int{2, 3}})
+			assert.NoError(t, err)
+			_, err = vm.Run(program, Env{A: -1, B: true, Name: &name, Items: []int{2, 0, 3}})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	type taken struct {
+		Kind, Expression string
+		True, False      int64
+	}
+	var got []taken
+	for _, b := range program.Coverage() {
+		got = append(got, taken{b.Kind, b.Expression, b.True, b.False})
+	}
+	assert.Equal(t, []taken{
+		{"?:", "A > 0", 4, 4},
+		{"??", "Name", 4, 4},
+		{"&&", "B", 4, 4},
+		{"all", "# > 1", 12, 4},
+	}, got)
+}
+
+func TestProgram_Coverage_disabled(t *testing.T) {
+	program, err := expr.Compile(`a > 0 ? 1 : 2`, expr.Env(map[string]any{"a": 0}))
+	require.NoError(t, err)
+	assert.Nil(t, program.Coverage())
+}
@@ -13,14 +13,18 @@ var CustomFuncTypes = []any{
 
 func (vm *VM) callCustomFuncType(fn any, kind int) (any, error) {
 	switch kind {
-	//case 3:
-	//	arg2 := vm.pop().(int)
-	//	arg1 := vm.pop()
-	//	var gctx *gcontext.GraphEngineCtx
-	//	if arg1 != nil {
-	//		gctx = arg1.(*gcontext.GraphEngineCtx)
-	//	}
-	//	return fn.(func(*gcontext.GraphEngineCtx, int) (int, error))(gctx, arg2)
+	case 1, 2:
+		arg2 := param[int](vm.pop())
+		arg1 := param[context.Context](vm.pop())
+		return fn.(func(context.Context, int) (int, error))(arg1, arg2)
+		//case 3:
+		//	arg2 := vm.pop().(int)
+		//	arg1 := vm.pop()
+		//	var gctx *gcontext.GraphEngineCtx
+		//	if arg1 != nil {
+		//		gctx = arg1.(*gcontext.GraphEngineCtx)
+		//	}
+		//	return fn.(func(*gcontext.GraphEngineCtx, int) (int, error))(gctx, arg2)
 	}
 	panic(fmt.Sprintf("unknown function kind (%v)", kind))
 }
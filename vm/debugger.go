@@ -0,0 +1,275 @@
+package vm
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/file"
+)
+
+// ErrDebuggerStopped is the error of a run aborted with Debugger.Stop.
+var ErrDebuggerStopped = errors.New("debugger stopped")
+
+type debuggerMode int
+
+const (
+	modeStep debuggerMode = iota
+	modeStepOver
+	modeContinue
+	modeStop
+)
+
+// Debugger runs a program instruction by instruction. The program runs in
+// another goroutine, which pauses before instructions: Step, StepOver and
+// Continue resume it and wait for the next pause, so the state of the VM can
+// be inspected between them, from tests or an interactive REPL.
+//
+//	d := vm.NewDebugger(program, env)
+//	d.BreakAtSource(1, 10)
+//	for d.Continue() {
+//		fmt.Println(d.Node(), d.Stack())
+//	}
+//	out, err := d.Result()
+type Debugger struct {
+	VM *VM // VM running the program, with budgets to set before the run
+
+	program     *Program
+	env         any
+	breakpoints map[int]bool
+	nodes       map[file.Location]ast.Node
+
+	started bool
+	done    bool
+	out     any
+	err     error
+	paused  chan struct{}
+	resume  chan debuggerMode
+
+	// Owned by the goroutine of the run.
+	mode    debuggerMode
+	resumed bool          // no instruction has run since the last pause
+	depth   int           // depth of calls and loops at the last pause
+	from    file.Location // location of the instruction of the last pause
+}
+
+// NewDebugger returns a debugger of the program, run with the env. The
+// program does not start before the first Step, StepOver or Continue.
+func NewDebugger(program *Program, env any) *Debugger {
+	return &Debugger{
+		VM:          &VM{},
+		program:     program,
+		env:         env,
+		breakpoints: map[int]bool{},
+		paused:      make(chan struct{}),
+		resume:      make(chan debuggerMode),
+	}
+}
+
+// Break sets a breakpoint on the instruction at ip, see Program.Disassemble.
+func (d *Debugger) Break(ip int) {
+	d.breakpoints[ip] = true
+}
+
+// BreakAtSource sets breakpoints on the instructions of the innermost node
+// at the line, from 1, and the column, from 0, of the source. It reports
+// whether there are such instructions.
+func (d *Debugger) BreakAtSource(line, column int) bool {
+	pos, l, c := -1, 1, 0
+	for i, r := range d.program.source {
+		if l == line && c == column {
+			pos = i
+			break
+		}
+		if r == '\n' {
+			l, c = l+1, 0
+		} else {
+			c++
+		}
+	}
+	if pos < 0 {
+		return false
+	}
+
+	var innermost *file.Location
+	for i, loc := range d.program.locations {
+		if loc.From <= pos && pos < loc.To && (innermost == nil || loc.To-loc.From < innermost.To-innermost.From) {
+			innermost = &d.program.locations[i]
+		}
+	}
+	if innermost == nil {
+		return false
+	}
+	for ip, loc := range d.program.locations {
+		// Only the first instruction of consecutive ones of the node.
+		if loc == *innermost && (ip == 0 || d.program.locations[ip-1] != loc) {
+			d.breakpoints[ip] = true
+		}
+	}
+	return true
+}
+
+// Clear removes the breakpoint on the instruction at ip.
+func (d *Debugger) Clear(ip int) {
+	delete(d.breakpoints, ip)
+}
+
+// Breakpoints returns the addresses of the instructions with breakpoints.
+func (d *Debugger) Breakpoints() []int {
+	ips := make([]int, 0, len(d.breakpoints))
+	for ip := range d.breakpoints {
+		ips = append(ips, ip)
+	}
+	sort.Ints(ips)
+	return ips
+}
+
+// Step runs the next instruction and pauses before the following one. At
+// the start, it pauses before the first instruction. It reports whether the
+// program is paused, false once it finished.
+func (d *Debugger) Step() bool {
+	return d.command(modeStep)
+}
+
+// StepOver runs until an instruction of another node, skipping the calls of
+// functions and the loops of builtins started meanwhile.
+func (d *Debugger) StepOver() bool {
+	return d.command(modeStepOver)
+}
+
+// Continue runs until a breakpoint.
+func (d *Debugger) Continue() bool {
+	return d.command(modeContinue)
+}
+
+// Stop aborts the run, which fails with ErrDebuggerStopped.
+func (d *Debugger) Stop() {
+	if d.started {
+		d.command(modeStop)
+	}
+}
+
+func (d *Debugger) command(mode debuggerMode) bool {
+	if d.done {
+		return false
+	}
+	if !d.started {
+		d.started = true
+		d.mode = mode
+		d.VM.debugger = d
+		go d.run()
+	} else {
+		d.resume <- mode
+	}
+	<-d.paused
+	return !d.done
+}
+
+func (d *Debugger) run() {
+	d.out, d.err = d.VM.Run(d.program, d.env)
+	d.done = true
+	d.paused <- struct{}{}
+}
+
+// before is called by the VM before every instruction, and blocks while the
+// run is paused.
+func (d *Debugger) before(vm *VM) {
+	if !d.pause(vm) {
+		d.resumed = false
+		return
+	}
+	d.paused <- struct{}{}
+	d.mode = <-d.resume
+	if d.mode == modeStop {
+		panic(ErrDebuggerStopped)
+	}
+	d.resumed = true
+	d.depth = len(vm.frames) + len(vm.Scopes)
+	d.from = d.location(vm.ip)
+}
+
+func (d *Debugger) pause(vm *VM) bool {
+	switch d.mode {
+	case modeStep:
+		return true
+	case modeStepOver:
+		return !d.resumed && len(vm.frames)+len(vm.Scopes) <= d.depth && d.location(vm.ip) != d.from
+	case modeContinue:
+		return !d.resumed && d.breakpoints[vm.ip]
+	}
+	return false
+}
+
+func (d *Debugger) location(ip int) file.Location {
+	if ip < len(d.program.locations) {
+		return d.program.locations[ip]
+	}
+	return file.Location{}
+}
+
+// Done reports whether the program finished.
+func (d *Debugger) Done() bool {
+	return d.done
+}
+
+// Result returns the result of the program, once it finished.
+func (d *Debugger) Result() (any, error) {
+	return d.out, d.err
+}
+
+// IP returns the address of the next instruction.
+func (d *Debugger) IP() int {
+	return d.VM.ip
+}
+
+// Opcode returns the next instruction.
+func (d *Debugger) Opcode() Opcode {
+	if d.VM.ip < len(d.program.Bytecode) {
+		return d.program.Bytecode[d.VM.ip]
+	}
+	return OpInvalid
+}
+
+// Location returns the location in the source of the next instruction.
+func (d *Debugger) Location() file.Location {
+	return d.location(d.VM.ip)
+}
+
+// Node returns the node the next instruction was compiled from, or nil if
+// it is unknown.
+func (d *Debugger) Node() ast.Node {
+	if d.program.node == nil {
+		return nil
+	}
+	if d.nodes == nil {
+		d.nodes = map[file.Location]ast.Node{}
+		// Children are visited first, so nodes sharing a location with
+		// their children are not kept.
+		ast.Find(d.program.node, func(node ast.Node) bool {
+			if _, ok := d.nodes[node.Location()]; !ok {
+				d.nodes[node.Location()] = node
+			}
+			return false
+		})
+	}
+	return d.nodes[d.Location()]
+}
+
+// Stack returns the stack of the VM, the top last.
+func (d *Debugger) Stack() []any {
+	return d.VM.Stack
+}
+
+// Variables returns the variables of the VM, declared with let or by the
+// compiler.
+func (d *Debugger) Variables() []any {
+	return d.VM.Variables
+}
+
+// Scope returns the scope of the innermost loop of a builtin, or nil.
+func (d *Debugger) Scope() *Scope {
+	if len(d.VM.Scopes) == 0 {
+		return nil
+	}
+	return d.VM.scope()
+}
@@ -0,0 +1,89 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+func TestDebugger_Step(t *testing.T) {
+	program, err := expr.Compile(`let x = a + 1; x * 2`, expr.Env(map[string]any{"a": 0}))
+	require.NoError(t, err)
+
+	d := vm.NewDebugger(program, map[string]any{"a": 20})
+	steps := 0
+	for d.Step() {
+		assert.Equal(t, program.Bytecode[d.IP()], d.Opcode())
+		steps++
+	}
+	assert.Equal(t, len(program.Bytecode), steps)
+	assert.True(t, d.Done())
+	assert.False(t, d.Continue())
+
+	out, err := d.Result()
+	require.NoError(t, err)
+	assert.Equal(t, 42, out)
+}
+
+func TestDebugger_Continue(t *testing.T) {
+	program, err := expr.Compile(`sum(items, # * 2) + 1`, expr.Env(map[string]any{"items": []int{}}))
+	require.NoError(t, err)
+
+	d := vm.NewDebugger(program, map[string]any{"items": []int{1, 2, 3}})
+	require.True(t, d.BreakAtSource(1, 11)) // #
+	require.Len(t, d.Breakpoints(), 1)
+
+	var elements []any
+	for d.Continue() {
+		assert.Equal(t, "#", d.Node().String())
+		require.NotNil(t, d.Scope())
+		elements = append(elements, d.Scope().Array.Index(d.Scope().Index).Interface())
+	}
+	assert.Equal(t, []any{1, 2, 3}, elements)
+
+	out, err := d.Result()
+	require.NoError(t, err)
+	assert.Equal(t, 13, out)
+}
+
+func TestDebugger_StepOver(t *testing.T) {
+	program, err := expr.Compile(`len(filter(items, # > 1)) == 2`, expr.Env(map[string]any{"items": []int{}}))
+	require.NoError(t, err)
+
+	d := vm.NewDebugger(program, map[string]any{"items": []int{1, 2, 3}})
+	var nodes []string
+	for d.StepOver() {
+		if d.Scope() != nil {
+			t.Fatalf("stepped into the loop at %v", d.Node())
+		}
+		if node := d.Node(); node != nil {
+			nodes = append(nodes, node.String())
+		}
+	}
+	assert.Contains(t, nodes, "items")
+	assert.NotContains(t, nodes, "# > 1")
+
+	out, err := d.Result()
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+}
+
+func TestDebugger_Stop(t *testing.T) {
+	program, err := expr.Compile(`a + 2`, expr.Env(map[string]any{"a": 0}))
+	require.NoError(t, err)
+
+	d := vm.NewDebugger(program, map[string]any{"a": 1})
+	d.Break(1)
+	require.True(t, d.Continue())
+	assert.Equal(t, 1, d.IP())
+	assert.Len(t, d.Stack(), 1)
+
+	d.Stop()
+	assert.True(t, d.Done())
+	_, err = d.Result()
+	require.ErrorIs(t, err, vm.ErrDebuggerStopped)
+}
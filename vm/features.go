@@ -0,0 +1,99 @@
+package vm
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/expr-lang/expr/builtin"
+	"github.com/expr-lang/expr/vm/runtime"
+)
+
+// Features describes the capabilities a program uses. It is found from the
+// bytecode, so it only reports what can be known before running the program.
+type Features struct {
+	Regexp    bool     // Matches strings with regular expressions.
+	Loops     bool     // Iterates over arrays, like map or filter do.
+	Methods   []string // Methods called on the env or on its values.
+	Functions []string // Functions added with expr.Function.
+	Builtins  []string // Builtins, including overridden ones.
+	Calls     bool     // Calls func values, like func fields of the env.
+
+	// Mutations are the methods and functions which get the env or its
+	// values, and can change them. Expressions never change the env
+	// themselves.
+	Mutations []string
+}
+
+// Features returns the capabilities used by the program.
+func (program *Program) Features() Features {
+	var f Features
+	methods := map[string]bool{}
+	functions := map[string]bool{}
+	builtins := map[string]bool{}
+
+	for ip, op := range program.Bytecode {
+		arg := program.Arguments[ip]
+		switch op {
+		case OpMatches, OpMatchesConst, OpMatchesGuarded, OpRegexp:
+			f.Regexp = true
+		case OpBegin, OpSortNext:
+			f.Loops = true
+		case OpMethod, OpLoadMethod:
+			if m, ok := program.Constants[arg].(*runtime.Method); ok {
+				methods[m.Name] = true
+			}
+		case OpCall0, OpCall1, OpCall2, OpCall3, OpLoadFunc:
+			name := program.debugInfo[fmt.Sprintf("func_%d", arg)]
+			if program.isBuiltin(name, arg) {
+				builtins[name] = true
+				f.Regexp = f.Regexp || builtin.Regexps[name]
+			} else {
+				functions[name] = true
+			}
+		case OpCallBuiltin1, OpCallBuiltin2, OpCallBuiltin3:
+			builtins[builtin.Builtins[arg].Name] = true
+		case OpCallSafe:
+			if ip > 0 && program.Bytecode[ip-1] == OpPush {
+				builtins[program.debugInfo[fmt.Sprintf("const_%d", program.Arguments[ip-1])]] = true
+			}
+		case OpCall, OpCallFast, OpCallTyped, OpCallTypedCustom, OpCallCtx:
+			// Methods are called with the same opcodes, right after
+			// they are loaded.
+			if ip == 0 || (program.Bytecode[ip-1] != OpMethod && program.Bytecode[ip-1] != OpLoadMethod) {
+				f.Calls = true
+			}
+		}
+	}
+
+	f.Methods = sorted(methods)
+	f.Functions = sorted(functions)
+	f.Builtins = sorted(builtins)
+	for name := range functions {
+		methods[name] = true
+	}
+	f.Mutations = sorted(methods)
+	return f
+}
+
+// isBuiltin reports whether the function with the index is the builtin of
+// the name, and not a function which overrides it.
+func (program *Program) isBuiltin(name string, index int) bool {
+	i, ok := builtin.Index[name]
+	if !ok || builtin.Builtins[i].Func == nil || index >= len(program.functions) {
+		return false
+	}
+	return reflect.ValueOf(program.functions[index]).Pointer() == reflect.ValueOf(builtin.Builtins[i].Func).Pointer()
+}
+
+func sorted(set map[string]bool) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	list := make([]string, 0, len(set))
+	for name := range set {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,72 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/test/mock"
+	"github.com/expr-lang/expr/vm"
+)
+
+func TestProgram_Features(t *testing.T) {
+	double := expr.Function("double", func(params ...any) (any, error) {
+		return params[0].(int) * 2, nil
+	}, new(func(int) int))
+	trim := expr.Function("trim", func(params ...any) (any, error) {
+		return params[0], nil
+	}, new(func(string) string))
+
+	tests := []struct {
+		code    string
+		options []expr.Option
+		want    vm.Features
+	}{
+		{
+			code: `Int + 1`,
+			want: vm.Features{},
+		},
+		{
+			code: `String matches "^a" || String matches String`,
+			want: vm.Features{Regexp: true},
+		},
+		{
+			code: `replaceRegex(String, "a+", "b")`,
+			want: vm.Features{Regexp: true, Builtins: []string{"replaceRegex"}},
+		},
+		{
+			code: `filter(ArrayOfInt, # > 1)`,
+			want: vm.Features{Loops: true},
+		},
+		{
+			code: `Foo.Method().Baz != "" && Func() > 0`,
+			want: vm.Features{
+				Methods:   []string{"Func", "Method"},
+				Mutations: []string{"Func", "Method"},
+			},
+		},
+		{
+			code:    `double(Int) + len(upper(String)) + len(trim(String))`,
+			options: []expr.Option{double, trim},
+			want: vm.Features{
+				Functions: []string{"double", "trim"},
+				Builtins:  []string{"len", "upper"},
+				Mutations: []string{"double", "trim"},
+			},
+		},
+		{
+			code: `FuncParamAny(Int)`,
+			want: vm.Features{Calls: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			program, err := expr.Compile(tt.code, append([]expr.Option{expr.Env(mock.Env{})}, tt.options...)...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, program.Features())
+		})
+	}
+}
@@ -11,7 +11,8 @@ import (
 	. "time"
 )
 
-// Keep sorted.
+// Keep sorted. Types added later are appended at the end, so the indexes of
+// compiled programs, which can be saved, do not change.
 var types = []any{
 	nil,
 	new(func() Duration),
@@ -105,6 +106,25 @@ var types = []any{
 	new(func(uint64) int64),
 	new(func(uint8) byte),
 	new(func(context.Context, int) int),
+	new(func() (any, error)),
+	new(func(any) (any, error)),
+	new(func(any) (bool, error)),
+	new(func(any) (string, error)),
+	new(func(int) (int, error)),
+	new(func(string) (any, error)),
+	new(func(string) (bool, error)),
+	new(func(string) (float64, error)),
+	new(func(string) (int, error)),
+	new(func(string) (string, error)),
+	new(func(string, string) (string, error)),
+	new(func(...any) (any, error)),
+	new(func(...any) string),
+	new(func(...int) int),
+	new(func(...string) string),
+	new(func(string, ...any) string),
+	new(func(string, ...any) (string, error)),
+	new(func(string, ...string) string),
+	new(func(context.Context, string) (any, error)),
 }
 
 func main() {
@@ -122,14 +142,35 @@ func main() {
 		data.Code += fmt.Sprintf("case %d:\n", i)
 		args := make([]string, fn.NumIn())
 		for j := fn.NumIn() - 1; j >= 0; j-- {
-			cast := fmt.Sprintf(".(%v)", fn.In(j))
-			if fn.In(j).Kind() == reflect.Interface {
-				cast = ""
+			arg := fmt.Sprintf("arg%v", j+1)
+			args[j] = arg
+			in := fn.In(j)
+			if fn.IsVariadic() && j == fn.NumIn()-1 {
+				// The compiler passes the variadic arguments as an array.
+				args[j] += "..."
+				if in.Elem().Kind() == reflect.Interface && in.Elem().NumMethod() == 0 {
+					data.Code += fmt.Sprintf("%v := vm.pop().([]any)\n", arg)
+					continue
+				}
+				data.Code += fmt.Sprintf("%vs := vm.pop().([]any)\n", arg)
+				data.Code += fmt.Sprintf("%v := make(%v, len(%vs))\n", arg, in, arg)
+				data.Code += fmt.Sprintf("for i, a := range %vs {\n%v[i] = param[%v](a)\n}\n", arg, arg, in.Elem())
+				continue
 			}
-			data.Code += fmt.Sprintf("arg%v := vm.pop()%v\n", j+1, cast)
-			args[j] = fmt.Sprintf("arg%v", j+1)
+			switch {
+			case in.Kind() == reflect.Interface && in.NumMethod() == 0:
+				data.Code += fmt.Sprintf("%v := vm.pop()\n", arg)
+			default:
+				data.Code += fmt.Sprintf("%v := param[%v](vm.pop())\n", arg, in)
+			}
+		}
+		call := fmt.Sprintf("fn.(%v)(%v)", fn, strings.Join(args, ", "))
+		if fn.NumOut() == 2 {
+			// The error is raised like the errors of functions called with OpCall.
+			data.Code += fmt.Sprintf("out, err := %v\nif err != nil {\npanic(err)\n}\nreturn out\n", call)
+		} else {
+			data.Code += fmt.Sprintf("return %v\n", call)
 		}
-		data.Code += fmt.Sprintf("return fn.(%v)(%v)\n", fn, strings.Join(args, ", "))
 	}
 
 	var b bytes.Buffer
@@ -153,6 +194,7 @@ const source = `// Code generated by vm/func_types/main.go. DO NOT EDIT.
 package vm
 
 import (
+	"context"
 	"fmt"
 	"time"
 )
@@ -9,97 +9,116 @@ import (
 )
 
 var FuncTypes = []any{
-	1:  new(func() time.Duration),
-	2:  new(func() time.Month),
-	3:  new(func() time.Time),
-	4:  new(func() time.Weekday),
-	5:  new(func() []interface{}),
-	6:  new(func() []uint8),
-	7:  new(func() interface{}),
-	8:  new(func() bool),
-	9:  new(func() uint8),
-	10: new(func() float32),
-	11: new(func() float64),
-	12: new(func() int),
-	13: new(func() int16),
-	14: new(func() int32),
-	15: new(func() int64),
-	16: new(func() int8),
-	17: new(func() map[string]interface{}),
-	18: new(func() int32),
-	19: new(func() string),
-	20: new(func() uint),
-	21: new(func() uint16),
-	22: new(func() uint32),
-	23: new(func() uint64),
-	24: new(func() uint8),
-	25: new(func(time.Duration) time.Duration),
-	26: new(func(time.Duration) time.Time),
-	27: new(func(time.Time) time.Duration),
-	28: new(func(time.Time) bool),
-	29: new(func([]interface{}) []interface{}),
-	30: new(func([]interface{}) interface{}),
-	31: new(func([]interface{}) map[string]interface{}),
-	32: new(func([]interface{}, string) string),
-	33: new(func([]uint8) string),
-	34: new(func([]string, string) string),
-	35: new(func(interface{}) []interface{}),
-	36: new(func(interface{}) interface{}),
-	37: new(func(interface{}) bool),
-	38: new(func(interface{}) float64),
-	39: new(func(interface{}) int),
-	40: new(func(interface{}) map[string]interface{}),
-	41: new(func(interface{}) string),
-	42: new(func(interface{}, interface{}) []interface{}),
-	43: new(func(interface{}, interface{}) interface{}),
-	44: new(func(interface{}, interface{}) bool),
-	45: new(func(interface{}, interface{}) string),
-	46: new(func(bool) bool),
-	47: new(func(bool) float64),
-	48: new(func(bool) int),
-	49: new(func(bool) string),
-	50: new(func(bool, bool) bool),
-	51: new(func(float32) float64),
-	52: new(func(float64) bool),
-	53: new(func(float64) float32),
-	54: new(func(float64) float64),
-	55: new(func(float64) int),
-	56: new(func(float64) string),
-	57: new(func(float64, float64) bool),
-	58: new(func(int) bool),
-	59: new(func(int) float64),
-	60: new(func(int) int),
-	61: new(func(int) string),
-	62: new(func(int, int) bool),
-	63: new(func(int, int) int),
-	64: new(func(int, int) string),
-	65: new(func(int16) int32),
-	66: new(func(int32) float64),
-	67: new(func(int32) int),
-	68: new(func(int32) int64),
-	69: new(func(int64) time.Time),
-	70: new(func(int8) int),
-	71: new(func(int8) int16),
-	72: new(func(string) []uint8),
-	73: new(func(string) []string),
-	74: new(func(string) bool),
-	75: new(func(string) float64),
-	76: new(func(string) int),
-	77: new(func(string) string),
-	78: new(func(string, uint8) int),
-	79: new(func(string, int) int),
-	80: new(func(string, int32) int),
-	81: new(func(string, string) bool),
-	82: new(func(string, string) string),
-	83: new(func(uint) float64),
-	84: new(func(uint) int),
-	85: new(func(uint) uint),
-	86: new(func(uint16) uint),
-	87: new(func(uint32) uint64),
-	88: new(func(uint64) float64),
-	89: new(func(uint64) int64),
-	90: new(func(uint8) uint8),
-	91: new(func(context.Context, int) int),
+	1:   new(func() time.Duration),
+	2:   new(func() time.Month),
+	3:   new(func() time.Time),
+	4:   new(func() time.Weekday),
+	5:   new(func() []interface{}),
+	6:   new(func() []uint8),
+	7:   new(func() interface{}),
+	8:   new(func() bool),
+	9:   new(func() uint8),
+	10:  new(func() float32),
+	11:  new(func() float64),
+	12:  new(func() int),
+	13:  new(func() int16),
+	14:  new(func() int32),
+	15:  new(func() int64),
+	16:  new(func() int8),
+	17:  new(func() map[string]interface{}),
+	18:  new(func() int32),
+	19:  new(func() string),
+	20:  new(func() uint),
+	21:  new(func() uint16),
+	22:  new(func() uint32),
+	23:  new(func() uint64),
+	24:  new(func() uint8),
+	25:  new(func(time.Duration) time.Duration),
+	26:  new(func(time.Duration) time.Time),
+	27:  new(func(time.Time) time.Duration),
+	28:  new(func(time.Time) bool),
+	29:  new(func([]interface{}) []interface{}),
+	30:  new(func([]interface{}) interface{}),
+	31:  new(func([]interface{}) map[string]interface{}),
+	32:  new(func([]interface{}, string) string),
+	33:  new(func([]uint8) string),
+	34:  new(func([]string, string) string),
+	35:  new(func(interface{}) []interface{}),
+	36:  new(func(interface{}) interface{}),
+	37:  new(func(interface{}) bool),
+	38:  new(func(interface{}) float64),
+	39:  new(func(interface{}) int),
+	40:  new(func(interface{}) map[string]interface{}),
+	41:  new(func(interface{}) string),
+	42:  new(func(interface{}, interface{}) []interface{}),
+	43:  new(func(interface{}, interface{}) interface{}),
+	44:  new(func(interface{}, interface{}) bool),
+	45:  new(func(interface{}, interface{}) string),
+	46:  new(func(bool) bool),
+	47:  new(func(bool) float64),
+	48:  new(func(bool) int),
+	49:  new(func(bool) string),
+	50:  new(func(bool, bool) bool),
+	51:  new(func(float32) float64),
+	52:  new(func(float64) bool),
+	53:  new(func(float64) float32),
+	54:  new(func(float64) float64),
+	55:  new(func(float64) int),
+	56:  new(func(float64) string),
+	57:  new(func(float64, float64) bool),
+	58:  new(func(int) bool),
+	59:  new(func(int) float64),
+	60:  new(func(int) int),
+	61:  new(func(int) string),
+	62:  new(func(int, int) bool),
+	63:  new(func(int, int) int),
+	64:  new(func(int, int) string),
+	65:  new(func(int16) int32),
+	66:  new(func(int32) float64),
+	67:  new(func(int32) int),
+	68:  new(func(int32) int64),
+	69:  new(func(int64) time.Time),
+	70:  new(func(int8) int),
+	71:  new(func(int8) int16),
+	72:  new(func(string) []uint8),
+	73:  new(func(string) []string),
+	74:  new(func(string) bool),
+	75:  new(func(string) float64),
+	76:  new(func(string) int),
+	77:  new(func(string) string),
+	78:  new(func(string, uint8) int),
+	79:  new(func(string, int) int),
+	80:  new(func(string, int32) int),
+	81:  new(func(string, string) bool),
+	82:  new(func(string, string) string),
+	83:  new(func(uint) float64),
+	84:  new(func(uint) int),
+	85:  new(func(uint) uint),
+	86:  new(func(uint16) uint),
+	87:  new(func(uint32) uint64),
+	88:  new(func(uint64) float64),
+	89:  new(func(uint64) int64),
+	90:  new(func(uint8) uint8),
+	91:  new(func(context.Context, int) int),
+	92:  new(func() (interface{}, error)),
+	93:  new(func(interface{}) (interface{}, error)),
+	94:  new(func(interface{}) (bool, error)),
+	95:  new(func(interface{}) (string, error)),
+	96:  new(func(int) (int, error)),
+	97:  new(func(string) (interface{}, error)),
+	98:  new(func(string) (bool, error)),
+	99:  new(func(string) (float64, error)),
+	100: new(func(string) (int, error)),
+	101: new(func(string) (string, error)),
+	102: new(func(string, string) (string, error)),
+	103: new(func(...interface{}) (interface{}, error)),
+	104: new(func(...interface{}) string),
+	105: new(func(...int) int),
+	106: new(func(...string) string),
+	107: new(func(string, ...interface{}) string),
+	108: new(func(string, ...interface{}) (string, error)),
+	109: new(func(string, ...string) string),
+	110: new(func(context.Context, string) (interface{}, error)),
 }
 
 func (vm *VM) call(fn any, kind int) any {
@@ -153,36 +172,36 @@ func (vm *VM) call(fn any, kind int) any {
 	case 24:
 		return fn.(func() uint8)()
 	case 25:
-		arg1 := vm.pop().(time.Duration)
+		arg1 := param[time.Duration](vm.pop())
 		return fn.(func(time.Duration) time.Duration)(arg1)
 	case 26:
-		arg1 := vm.pop().(time.Duration)
+		arg1 := param[time.Duration](vm.pop())
 		return fn.(func(time.Duration) time.Time)(arg1)
 	case 27:
-		arg1 := vm.pop().(time.Time)
+		arg1 := param[time.Time](vm.pop())
 		return fn.(func(time.Time) time.Duration)(arg1)
 	case 28:
-		arg1 := vm.pop().(time.Time)
+		arg1 := param[time.Time](vm.pop())
 		return fn.(func(time.Time) bool)(arg1)
 	case 29:
-		arg1 := vm.pop().([]interface{})
+		arg1 := param[[]interface{}](vm.pop())
 		return fn.(func([]interface{}) []interface{})(arg1)
 	case 30:
-		arg1 := vm.pop().([]interface{})
+		arg1 := param[[]interface{}](vm.pop())
 		return fn.(func([]interface{}) interface{})(arg1)
 	case 31:
-		arg1 := vm.pop().([]interface{})
+		arg1 := param[[]interface{}](vm.pop())
 		return fn.(func([]interface{}) map[string]interface{})(arg1)
 	case 32:
-		arg2 := vm.pop().(string)
-		arg1 := vm.pop().([]interface{})
+		arg2 := param[string](vm.pop())
+		arg1 := param[[]interface{}](vm.pop())
 		return fn.(func([]interface{}, string) string)(arg1, arg2)
 	case 33:
-		arg1 := vm.pop().([]uint8)
+		arg1 := param[[]uint8](vm.pop())
 		return fn.(func([]uint8) string)(arg1)
 	case 34:
-		arg2 := vm.pop().(string)
-		arg1 := vm.pop().([]string)
+		arg2 := param[string](vm.pop())
+		arg1 := param[[]string](vm.pop())
 		return fn.(func([]string, string) string)(arg1, arg2)
 	case 35:
 		arg1 := vm.pop()
@@ -222,154 +241,284 @@ func (vm *VM) call(fn any, kind int) any {
 		arg1 := vm.pop()
 		return fn.(func(interface{}, interface{}) string)(arg1, arg2)
 	case 46:
-		arg1 := vm.pop().(bool)
+		arg1 := param[bool](vm.pop())
 		return fn.(func(bool) bool)(arg1)
 	case 47:
-		arg1 := vm.pop().(bool)
+		arg1 := param[bool](vm.pop())
 		return fn.(func(bool) float64)(arg1)
 	case 48:
-		arg1 := vm.pop().(bool)
+		arg1 := param[bool](vm.pop())
 		return fn.(func(bool) int)(arg1)
 	case 49:
-		arg1 := vm.pop().(bool)
+		arg1 := param[bool](vm.pop())
 		return fn.(func(bool) string)(arg1)
 	case 50:
-		arg2 := vm.pop().(bool)
-		arg1 := vm.pop().(bool)
+		arg2 := param[bool](vm.pop())
+		arg1 := param[bool](vm.pop())
 		return fn.(func(bool, bool) bool)(arg1, arg2)
 	case 51:
-		arg1 := vm.pop().(float32)
+		arg1 := param[float32](vm.pop())
 		return fn.(func(float32) float64)(arg1)
 	case 52:
-		arg1 := vm.pop().(float64)
+		arg1 := param[float64](vm.pop())
 		return fn.(func(float64) bool)(arg1)
 	case 53:
-		arg1 := vm.pop().(float64)
+		arg1 := param[float64](vm.pop())
 		return fn.(func(float64) float32)(arg1)
 	case 54:
-		arg1 := vm.pop().(float64)
+		arg1 := param[float64](vm.pop())
 		return fn.(func(float64) float64)(arg1)
 	case 55:
-		arg1 := vm.pop().(float64)
+		arg1 := param[float64](vm.pop())
 		return fn.(func(float64) int)(arg1)
 	case 56:
-		arg1 := vm.pop().(float64)
+		arg1 := param[float64](vm.pop())
 		return fn.(func(float64) string)(arg1)
 	case 57:
-		arg2 := vm.pop().(float64)
-		arg1 := vm.pop().(float64)
+		arg2 := param[float64](vm.pop())
+		arg1 := param[float64](vm.pop())
 		return fn.(func(float64, float64) bool)(arg1, arg2)
 	case 58:
-		arg1 := vm.pop().(int)
+		arg1 := param[int](vm.pop())
 		return fn.(func(int) bool)(arg1)
 	case 59:
-		arg1 := vm.pop().(int)
+		arg1 := param[int](vm.pop())
 		return fn.(func(int) float64)(arg1)
 	case 60:
-		arg1 := vm.pop().(int)
+		arg1 := param[int](vm.pop())
 		return fn.(func(int) int)(arg1)
 	case 61:
-		arg1 := vm.pop().(int)
+		arg1 := param[int](vm.pop())
 		return fn.(func(int) string)(arg1)
 	case 62:
-		arg2 := vm.pop().(int)
-		arg1 := vm.pop().(int)
+		arg2 := param[int](vm.pop())
+		arg1 := param[int](vm.pop())
 		return fn.(func(int, int) bool)(arg1, arg2)
 	case 63:
-		arg2 := vm.pop().(int)
-		arg1 := vm.pop().(int)
+		arg2 := param[int](vm.pop())
+		arg1 := param[int](vm.pop())
 		return fn.(func(int, int) int)(arg1, arg2)
 	case 64:
-		arg2 := vm.pop().(int)
-		arg1 := vm.pop().(int)
+		arg2 := param[int](vm.pop())
+		arg1 := param[int](vm.pop())
 		return fn.(func(int, int) string)(arg1, arg2)
 	case 65:
-		arg1 := vm.pop().(int16)
+		arg1 := param[int16](vm.pop())
 		return fn.(func(int16) int32)(arg1)
 	case 66:
-		arg1 := vm.pop().(int32)
+		arg1 := param[int32](vm.pop())
 		return fn.(func(int32) float64)(arg1)
 	case 67:
-		arg1 := vm.pop().(int32)
+		arg1 := param[int32](vm.pop())
 		return fn.(func(int32) int)(arg1)
 	case 68:
-		arg1 := vm.pop().(int32)
+		arg1 := param[int32](vm.pop())
 		return fn.(func(int32) int64)(arg1)
 	case 69:
-		arg1 := vm.pop().(int64)
+		arg1 := param[int64](vm.pop())
 		return fn.(func(int64) time.Time)(arg1)
 	case 70:
-		arg1 := vm.pop().(int8)
+		arg1 := param[int8](vm.pop())
 		return fn.(func(int8) int)(arg1)
 	case 71:
-		arg1 := vm.pop().(int8)
+		arg1 := param[int8](vm.pop())
 		return fn.(func(int8) int16)(arg1)
 	case 72:
-		arg1 := vm.pop().(string)
+		arg1 := param[string](vm.pop())
 		return fn.(func(string) []uint8)(arg1)
 	case 73:
-		arg1 := vm.pop().(string)
+		arg1 := param[string](vm.pop())
 		return fn.(func(string) []string)(arg1)
 	case 74:
-		arg1 := vm.pop().(string)
+		arg1 := param[string](vm.pop())
 		return fn.(func(string) bool)(arg1)
 	case 75:
-		arg1 := vm.pop().(string)
+		arg1 := param[string](vm.pop())
 		return fn.(func(string) float64)(arg1)
 	case 76:
-		arg1 := vm.pop().(string)
+		arg1 := param[string](vm.pop())
 		return fn.(func(string) int)(arg1)
 	case 77:
-		arg1 := vm.pop().(string)
+		arg1 := param[string](vm.pop())
 		return fn.(func(string) string)(arg1)
 	case 78:
-		arg2 := vm.pop().(uint8)
-		arg1 := vm.pop().(string)
+		arg2 := param[uint8](vm.pop())
+		arg1 := param[string](vm.pop())
 		return fn.(func(string, uint8) int)(arg1, arg2)
 	case 79:
-		arg2 := vm.pop().(int)
-		arg1 := vm.pop().(string)
+		arg2 := param[int](vm.pop())
+		arg1 := param[string](vm.pop())
 		return fn.(func(string, int) int)(arg1, arg2)
 	case 80:
-		arg2 := vm.pop().(int32)
-		arg1 := vm.pop().(string)
+		arg2 := param[int32](vm.pop())
+		arg1 := param[string](vm.pop())
 		return fn.(func(string, int32) int)(arg1, arg2)
 	case 81:
-		arg2 := vm.pop().(string)
-		arg1 := vm.pop().(string)
+		arg2 := param[string](vm.pop())
+		arg1 := param[string](vm.pop())
 		return fn.(func(string, string) bool)(arg1, arg2)
 	case 82:
-		arg2 := vm.pop().(string)
-		arg1 := vm.pop().(string)
+		arg2 := param[string](vm.pop())
+		arg1 := param[string](vm.pop())
 		return fn.(func(string, string) string)(arg1, arg2)
 	case 83:
-		arg1 := vm.pop().(uint)
+		arg1 := param[uint](vm.pop())
 		return fn.(func(uint) float64)(arg1)
 	case 84:
-		arg1 := vm.pop().(uint)
+		arg1 := param[uint](vm.pop())
 		return fn.(func(uint) int)(arg1)
 	case 85:
-		arg1 := vm.pop().(uint)
+		arg1 := param[uint](vm.pop())
 		return fn.(func(uint) uint)(arg1)
 	case 86:
-		arg1 := vm.pop().(uint16)
+		arg1 := param[uint16](vm.pop())
 		return fn.(func(uint16) uint)(arg1)
 	case 87:
-		arg1 := vm.pop().(uint32)
+		arg1 := param[uint32](vm.pop())
 		return fn.(func(uint32) uint64)(arg1)
 	case 88:
-		arg1 := vm.pop().(uint64)
+		arg1 := param[uint64](vm.pop())
 		return fn.(func(uint64) float64)(arg1)
 	case 89:
-		arg1 := vm.pop().(uint64)
+		arg1 := param[uint64](vm.pop())
 		return fn.(func(uint64) int64)(arg1)
 	case 90:
-		arg1 := vm.pop().(uint8)
+		arg1 := param[uint8](vm.pop())
 		return fn.(func(uint8) uint8)(arg1)
 	case 91:
-		arg2 := vm.pop().(int)
-		arg1 := vm.pop().(context.Context)
+		arg2 := param[int](vm.pop())
+		arg1 := param[context.Context](vm.pop())
 		return fn.(func(context.Context, int) int)(arg1, arg2)
+	case 92:
+		out, err := fn.(func() (interface{}, error))()
+		if err != nil {
+			panic(err)
+		}
+		return out
+	case 93:
+		arg1 := vm.pop()
+		out, err := fn.(func(interface{}) (interface{}, error))(arg1)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	case 94:
+		arg1 := vm.pop()
+		out, err := fn.(func(interface{}) (bool, error))(arg1)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	case 95:
+		arg1 := vm.pop()
+		out, err := fn.(func(interface{}) (string, error))(arg1)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	case 96:
+		arg1 := param[int](vm.pop())
+		out, err := fn.(func(int) (int, error))(arg1)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	case 97:
+		arg1 := param[string](vm.pop())
+		out, err := fn.(func(string) (interface{}, error))(arg1)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	case 98:
+		arg1 := param[string](vm.pop())
+		out, err := fn.(func(string) (bool, error))(arg1)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	case 99:
+		arg1 := param[string](vm.pop())
+		out, err := fn.(func(string) (float64, error))(arg1)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	case 100:
+		arg1 := param[string](vm.pop())
+		out, err := fn.(func(string) (int, error))(arg1)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	case 101:
+		arg1 := param[string](vm.pop())
+		out, err := fn.(func(string) (string, error))(arg1)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	case 102:
+		arg2 := param[string](vm.pop())
+		arg1 := param[string](vm.pop())
+		out, err := fn.(func(string, string) (string, error))(arg1, arg2)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	case 103:
+		arg1 := vm.pop().([]any)
+		out, err := fn.(func(...interface{}) (interface{}, error))(arg1...)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	case 104:
+		arg1 := vm.pop().([]any)
+		return fn.(func(...interface{}) string)(arg1...)
+	case 105:
+		arg1s := vm.pop().([]any)
+		arg1 := make([]int, len(arg1s))
+		for i, a := range arg1s {
+			arg1[i] = param[int](a)
+		}
+		return fn.(func(...int) int)(arg1...)
+	case 106:
+		arg1s := vm.pop().([]any)
+		arg1 := make([]string, len(arg1s))
+		for i, a := range arg1s {
+			arg1[i] = param[string](a)
+		}
+		return fn.(func(...string) string)(arg1...)
+	case 107:
+		arg2 := vm.pop().([]any)
+		arg1 := param[string](vm.pop())
+		return fn.(func(string, ...interface{}) string)(arg1, arg2...)
+	case 108:
+		arg2 := vm.pop().([]any)
+		arg1 := param[string](vm.pop())
+		out, err := fn.(func(string, ...interface{}) (string, error))(arg1, arg2...)
+		if err != nil {
+			panic(err)
+		}
+		return out
+	case 109:
+		arg2s := vm.pop().([]any)
+		arg2 := make([]string, len(arg2s))
+		for i, a := range arg2s {
+			arg2[i] = param[string](a)
+		}
+		arg1 := param[string](vm.pop())
+		return fn.(func(string, ...string) string)(arg1, arg2...)
+	case 110:
+		arg2 := param[string](vm.pop())
+		arg1 := param[context.Context](vm.pop())
+		out, err := fn.(func(context.Context, string) (interface{}, error))(arg1, arg2)
+		if err != nil {
+			panic(err)
+		}
+		return out
+
 	}
 	panic(fmt.Sprintf("unknown function kind (%v)", kind))
 }
@@ -0,0 +1,81 @@
+package vm
+
+import (
+	"sync"
+)
+
+// smallIntLimit bounds the integers stored in an InternPool, so pools shared
+// by many programs do not grow with every unique id literal.
+const smallIntLimit = 1 << 16
+
+// MaxInternPoolLen bounds the number of values held by an InternPool, so a
+// pool shared by programs compiled from untrusted inputs does not grow
+// without limit. Values beyond it are returned as is, not interned.
+const MaxInternPoolLen = 1 << 16
+
+// InternPool deduplicates constant values shared between many programs.
+//
+// Large rule sets repeat the same strings ("US", "premium") and small
+// integers in thousands of programs. Compiling all of them with the same
+// pool makes their Constants refer to a single boxed copy of each value.
+// The pool is safe for concurrent use.
+//
+// Interning is a memory optimization only: serialized programs store values
+// by copy, so a loaded program owns its constants unless it is re-interned.
+type InternPool struct {
+	mu     sync.RWMutex
+	values map[any]any
+}
+
+// NewInternPool creates an empty InternPool.
+func NewInternPool() *InternPool {
+	return &InternPool{
+		values: make(map[any]any),
+	}
+}
+
+// Intern returns the canonical instance of v. Values which are not
+// internable (anything except strings and small integers), and new values
+// once the pool holds MaxInternPoolLen values, are returned as is.
+func (p *InternPool) Intern(v any) any {
+	if !internable(v) {
+		return v
+	}
+
+	p.mu.RLock()
+	canonical, ok := p.values[v]
+	p.mu.RUnlock()
+	if ok {
+		return canonical
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if canonical, ok := p.values[v]; ok {
+		return canonical
+	}
+	if len(p.values) >= MaxInternPoolLen {
+		return v
+	}
+	p.values[v] = v
+	return v
+}
+
+// Len returns the number of distinct values held by the pool.
+func (p *InternPool) Len() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.values)
+}
+
+func internable(v any) bool {
+	switch x := v.(type) {
+	case string:
+		return true
+	case int:
+		return x > -smallIntLimit && x < smallIntLimit
+	case int64:
+		return x > -smallIntLimit && x < smallIntLimit
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+//go:build go1.20
+
+package vm_test
+
+import (
+	"fmt"
+	"testing"
+	"unsafe"
+
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+func TestInternPool(t *testing.T) {
+	pool := vm.NewInternPool()
+
+	a := pool.Intern("premium")
+	b := pool.Intern(string([]byte("premium")))
+	require.Equal(t, data(a.(string)), data(b.(string)))
+	require.Equal(t, 1, pool.Len())
+
+	require.Equal(t, 42, pool.Intern(42))
+	require.Equal(t, 2, pool.Len())
+
+	// Large integers and non-comparable values are not pooled.
+	require.Equal(t, 1<<20, pool.Intern(1<<20))
+	require.Equal(t, []int{1}, pool.Intern([]int{1}))
+	require.Equal(t, 2, pool.Len())
+}
+
+func TestInternPool_max_len(t *testing.T) {
+	pool := vm.NewInternPool()
+	for i := 0; i < vm.MaxInternPoolLen; i++ {
+		pool.Intern(fmt.Sprint("value ", i))
+	}
+	require.Equal(t, vm.MaxInternPoolLen, pool.Len())
+
+	// Values already held are still interned, new values are not.
+	s := pool.Intern("value 0").(string)
+	require.Equal(t, data(s), data(pool.Intern(fmt.Sprint("value ", 0)).(string)))
+	a := pool.Intern(fmt.Sprint("extra")).(string)
+	b := pool.Intern(fmt.Sprint("extra")).(string)
+	require.Equal(t, a, b)
+	require.NotEqual(t, data(a), data(b))
+	require.Equal(t, vm.MaxInternPoolLen, pool.Len())
+}
+
+func TestInternPool_shared_between_programs(t *testing.T) {
+	pool := vm.NewInternPool()
+	env := map[string]any{"country": "US", "plan": "basic"}
+
+	p1, err := expr.Compile(`country == "US" && plan == "premium"`, expr.Env(env), expr.InternPool(pool))
+	require.NoError(t, err)
+	size := pool.Len()
+
+	p2, err := expr.Compile(`plan == "premium" || country == "US"`, expr.Env(env), expr.InternPool(pool))
+	require.NoError(t, err)
+	require.Equal(t, size, pool.Len())
+
+	premium := func(program *vm.Program) uintptr {
+		for _, c := range program.Constants {
+			if s, ok := c.(string); ok && s == "premium" {
+				return data(s)
+			}
+		}
+		t.Fatal("no premium constant")
+		return 0
+	}
+	require.Equal(t, premium(p1), premium(p2))
+
+	out, err := vm.Run(p1, env)
+	require.NoError(t, err)
+	require.Equal(t, false, out)
+
+	out, err = vm.Run(p2, env)
+	require.NoError(t, err)
+	require.Equal(t, true, out)
+}
+
+// data returns the address of the bytes of s.
+func data(s string) uintptr {
+	return uintptr(unsafe.Pointer(unsafe.StringData(s)))
+}
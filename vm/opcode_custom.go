@@ -0,0 +1,72 @@
+package vm
+
+import "fmt"
+
+// OpCustom is the first opcode reserved for embedders: opcodes from OpCustom
+// to 255 are never used by the compiler, and can be registered with
+// RegisterOpcode.
+const OpCustom Opcode = 224
+
+// OpcodeHandler runs a custom opcode. The argument is the value of
+// ast.OpcodeNode.Argument; the arguments of the node are on the stack, the
+// last one on top. The handler pops them and pushes its result with Pop and
+// Push. It reports errors by panicking, like builtins do, so they carry the
+// location of the node.
+type OpcodeHandler func(vm *VM, env any, argument any)
+
+type customOpcode struct {
+	name    string
+	handler OpcodeHandler
+}
+
+var customOpcodes [256 - int(OpCustom)]*customOpcode
+
+// RegisterOpcode registers the handler of a custom opcode, which the compiler
+// emits for ast.OpcodeNode nodes of the name, usually inserted by patchers.
+// Opcodes are meant to be registered in init functions: registering is not
+// safe while programs run.
+func RegisterOpcode(op Opcode, name string, handler OpcodeHandler) {
+	if op < OpCustom {
+		panic(fmt.Errorf("opcode %d is not reserved for custom opcodes (%d-255)", op, OpCustom))
+	}
+	if name == "" || handler == nil {
+		panic(fmt.Errorf("custom opcode %d needs a name and a handler", op))
+	}
+	if c := customOpcodes[op-OpCustom]; c != nil {
+		panic(fmt.Errorf("opcode %d is already registered as %v", op, c.name))
+	}
+	if _, ok := opcodeByName(name); ok {
+		panic(fmt.Errorf("opcode %v is already registered", name))
+	}
+	customOpcodes[op-OpCustom] = &customOpcode{name: name, handler: handler}
+}
+
+// LookupOpcode returns the custom opcode registered with the name.
+func LookupOpcode(name string) (Opcode, bool) {
+	for i, c := range customOpcodes {
+		if c != nil && c.name == name {
+			return OpCustom + Opcode(i), true
+		}
+	}
+	return 0, false
+}
+
+// custom returns the custom opcode registered for op, or nil.
+func (op Opcode) custom() *customOpcode {
+	if op < OpCustom {
+		return nil
+	}
+	return customOpcodes[op-OpCustom]
+}
+
+// Push pushes the value on the stack. It is meant for handlers of custom
+// opcodes.
+func (vm *VM) Push(value any) {
+	vm.push(value)
+}
+
+// Pop pops the value on top of the stack. It is meant for handlers of custom
+// opcodes.
+func (vm *VM) Pop() any {
+	return vm.pop()
+}
@@ -0,0 +1,88 @@
+package vm_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+)
+
+var features = map[string]map[int]float64{
+	"score": {1: 0.5, 2: 0.9},
+}
+
+func init() {
+	vm.RegisterOpcode(vm.OpCustom, "fetch", func(v *vm.VM, env any, argument any) {
+		id := v.Pop().(int)
+		v.Push(features[argument.(string)][id])
+	})
+}
+
+// fetchPatcher replaces feature("name") with the fetch opcode, which reads
+// the feature of the user id of the env.
+type fetchPatcher struct{}
+
+func (fetchPatcher) Visit(node *ast.Node) {
+	call, ok := (*node).(*ast.CallNode)
+	if !ok {
+		return
+	}
+	if callee, ok := call.Callee.(*ast.IdentifierNode); !ok || callee.Value != "feature" {
+		return
+	}
+	name := call.Arguments[0].(*ast.StringNode).Value
+	op := &ast.OpcodeNode{
+		Name:      "fetch",
+		Argument:  name,
+		Arguments: []ast.Node{&ast.IdentifierNode{Value: "id"}},
+	}
+	op.SetType(reflect.TypeOf(float64(0)))
+	ast.Patch(node, op)
+}
+
+func TestRegisterOpcode(t *testing.T) {
+	env := map[string]any{
+		"id":      0,
+		"feature": func(string) float64 { return 0 },
+	}
+	program, err := expr.Compile(`feature("score") > 0.7`, expr.Env(env), expr.Patch(fetchPatcher{}))
+	require.NoError(t, err)
+	assert.Contains(t, program.Disassemble(), "fetch       <1>  score")
+	assert.Equal(t, `fetch("score", id) > 0.7`, program.Node().String())
+
+	out, err := expr.Run(program, map[string]any{"id": 2})
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+	out, err = expr.Run(program, map[string]any{"id": 1})
+	require.NoError(t, err)
+	assert.Equal(t, false, out)
+
+	op, ok := vm.LookupOpcode("fetch")
+	require.True(t, ok)
+	assert.Equal(t, "fetch", op.String())
+
+	assert.Panics(t, func() { vm.RegisterOpcode(vm.OpPush, "push", func(*vm.VM, any, any) {}) })
+	assert.Panics(t, func() { vm.RegisterOpcode(vm.OpCustom, "other", func(*vm.VM, any, any) {}) })
+	assert.Panics(t, func() { vm.RegisterOpcode(vm.OpCustom+1, "fetch", func(*vm.VM, any, any) {}) })
+}
+
+func TestRegisterOpcode_unknown(t *testing.T) {
+	_, err := expr.Compile(`1`, expr.Patch(patcher(func(node *ast.Node) {
+		if _, ok := (*node).(*ast.IntegerNode); ok {
+			ast.Patch(node, &ast.OpcodeNode{Name: "missing"})
+		}
+	})))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown opcode missing")
+}
+
+type patcher func(node *ast.Node)
+
+func (p patcher) Visit(node *ast.Node) {
+	p(node)
+}
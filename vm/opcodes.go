@@ -19,6 +19,9 @@ const (
 	OpLoadEnv
 	OpFetch
 	OpFetchField
+	OpFetchSafe
+	OpFetchFieldSafe
+	OpFetchIndexSafe
 	OpMethod
 	OpTrue
 	OpFalse
@@ -28,6 +31,7 @@ const (
 	OpEqual
 	OpEqualInt
 	OpEqualString
+	OpEqualFloat
 	OpJump
 	OpJumpIfTrue
 	OpJumpIfFalse
@@ -35,6 +39,7 @@ const (
 	OpJumpIfNotNil
 	OpJumpIfEnd
 	OpJumpBackward
+	OpSwitch
 	OpIn
 	OpLess
 	OpMore
@@ -46,6 +51,10 @@ const (
 	OpDivide
 	OpModulo
 	OpExponent
+	OpAddChecked
+	OpSubtractChecked
+	OpMultiplyChecked
+	OpNegateChecked
 	OpRange
 	OpMatches
 	OpMatchesConst
@@ -64,6 +73,10 @@ const (
 	OpCallTyped
 	OpCallTypedCustom
 	OpCallBuiltin1
+	OpCallBuiltin2
+	OpCallBuiltin3
+	OpClosure
+	OpReturn
 	OpArray
 	OpMap
 	OpLen
@@ -79,13 +92,31 @@ const (
 	OpSetAcc
 	OpSetIndex
 	OpPointer
+	OpOuterPointer
 	OpThrow
 	OpCreate
 	OpGroupBy
 	OpSortBy
 	OpSort
+	OpUniqBy
+	OpPartition
+	OpMin
+	OpMax
 	OpProfileStart
 	OpProfileEnd
+	OpCover
+	OpCoverNil
+	OpCallCtx
+	OpLoadDynamic
+	OpMatchesGuarded
+	OpFetchNamed
+	OpFetchNamedSafe
+	OpEqualStrict
+	OpSortNext
+	OpSortResult
+	OpRegexp
+	OpInStrict
+	OpJumpIfNotNilStrict
 	OpBegin
 	OpEnd // This opcode must be at the end of this list.
 )
@@ -120,6 +151,13 @@ func (op Opcode) String() string {
 		return "OpFetch"
 	case OpFetchField:
 		return "OpFetchField"
+	case OpFetchSafe:
+		return "OpFetchSafe"
+	case OpFetchFieldSafe:
+		return "OpFetchFieldSafe"
+
+	case OpFetchIndexSafe:
+		return "OpFetchIndexSafe"
 	case OpMethod:
 		return "OpMethod"
 	case OpTrue:
@@ -138,6 +176,8 @@ func (op Opcode) String() string {
 		return "OpEqualInt"
 	case OpEqualString:
 		return "OpEqualString"
+	case OpEqualFloat:
+		return "OpEqualFloat"
 	case OpJump:
 		return "OpJump"
 	case OpJumpIfTrue:
@@ -152,6 +192,8 @@ func (op Opcode) String() string {
 		return "OpJumpIfEnd"
 	case OpJumpBackward:
 		return "OpJumpBackward"
+	case OpSwitch:
+		return "OpSwitch"
 	case OpIn:
 		return "OpIn"
 	case OpLess:
@@ -174,12 +216,38 @@ func (op Opcode) String() string {
 		return "OpModulo"
 	case OpExponent:
 		return "OpExponent"
+	case OpAddChecked:
+		return "OpAddChecked"
+	case OpSubtractChecked:
+		return "OpSubtractChecked"
+	case OpMultiplyChecked:
+		return "OpMultiplyChecked"
+	case OpNegateChecked:
+		return "OpNegateChecked"
 	case OpRange:
 		return "OpRange"
 	case OpMatches:
 		return "OpMatches"
 	case OpMatchesConst:
 		return "OpMatchesConst"
+	case OpMatchesGuarded:
+		return "OpMatchesGuarded"
+	case OpFetchNamed:
+		return "OpFetchNamed"
+	case OpFetchNamedSafe:
+		return "OpFetchNamedSafe"
+	case OpEqualStrict:
+		return "OpEqualStrict"
+	case OpSortNext:
+		return "OpSortNext"
+	case OpSortResult:
+		return "OpSortResult"
+	case OpRegexp:
+		return "OpRegexp"
+	case OpInStrict:
+		return "OpInStrict"
+	case OpJumpIfNotNilStrict:
+		return "OpJumpIfNotNilStrict"
 	case OpContains:
 		return "OpContains"
 	case OpStartsWith:
@@ -210,6 +278,14 @@ func (op Opcode) String() string {
 		return "OpCallTypedCustom"
 	case OpCallBuiltin1:
 		return "OpCallBuiltin1"
+	case OpCallBuiltin2:
+		return "OpCallBuiltin2"
+	case OpCallBuiltin3:
+		return "OpCallBuiltin3"
+	case OpClosure:
+		return "OpClosure"
+	case OpReturn:
+		return "OpReturn"
 	case OpArray:
 		return "OpArray"
 	case OpMap:
@@ -240,6 +316,8 @@ func (op Opcode) String() string {
 		return "OpSetIndex"
 	case OpPointer:
 		return "OpPointer"
+	case OpOuterPointer:
+		return "OpOuterPointer"
 	case OpThrow:
 		return "OpThrow"
 	case OpCreate:
@@ -250,15 +328,36 @@ func (op Opcode) String() string {
 		return "OpSortBy"
 	case OpSort:
 		return "OpSort"
+	case OpUniqBy:
+		return "OpUniqBy"
+	case OpPartition:
+		return "OpPartition"
+
+	case OpMin:
+		return "OpMin"
+
+	case OpMax:
+		return "OpMax"
 	case OpProfileStart:
 		return "OpProfileStart"
 	case OpProfileEnd:
 		return "OpProfileEnd"
+	case OpCover:
+		return "OpCover"
+	case OpCoverNil:
+		return "OpCoverNil"
+	case OpCallCtx:
+		return "OpCallCtx"
+	case OpLoadDynamic:
+		return "OpLoadDynamic"
 	case OpBegin:
 		return "OpBegin"
 	case OpEnd:
 		return "OpEnd"
 	default:
+		if custom := op.custom(); custom != nil {
+			return custom.name
+		}
 		return fmt.Sprintf("Opcode(%d)", byte(op))
 	}
 }
@@ -0,0 +1,69 @@
+package vm
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Pool is a pool of VMs running the same program. It is safe for concurrent
+// use: every run takes a VM from the pool and puts it back after the run,
+// so the stack, the variables and the scopes of the VM are reused.
+type Pool struct {
+	program *Program
+	vms     sync.Pool
+	stack   int64 // largest capacity of the stack seen, to size new VMs
+}
+
+// NewPool returns a pool of VMs for the program.
+func NewPool(program *Program) *Pool {
+	p := &Pool{program: program, stack: 2}
+	p.vms.New = func() any {
+		return &VM{
+			Stack:     make([]any, 0, atomic.LoadInt64(&p.stack)),
+			Scopes:    make([]*Scope, 0, program.scopes),
+			Variables: make([]any, program.variables),
+			arena:     make([]Scope, program.scopes),
+		}
+	}
+	return p
+}
+
+// Run runs the program of the pool with the env.
+func (p *Pool) Run(env any) (any, error) {
+	return p.RunContext(context.Background(), env)
+}
+
+// RunContext runs the program of the pool with the env, aborting once ctx
+// is done. See VM.RunContext.
+func (p *Pool) RunContext(ctx context.Context, env any) (any, error) {
+	vm := p.vms.Get().(*VM)
+	out, err := vm.RunContext(ctx, p.program, env)
+	p.put(vm)
+	return out, err
+}
+
+// put returns the VM to the pool, without references to values of the
+// run, so they can be garbage collected.
+func (p *Pool) put(vm *VM) {
+	if n := int64(cap(vm.Stack)); n > atomic.LoadInt64(&p.stack) {
+		atomic.StoreInt64(&p.stack, n)
+	}
+	stack := vm.Stack[:cap(vm.Stack)]
+	for i := range stack {
+		stack[i] = nil
+	}
+	vm.Stack = stack[:0]
+	for i := range vm.Variables {
+		vm.Variables[i] = nil
+	}
+	scopes := vm.Scopes[:cap(vm.Scopes)]
+	for i := range scopes {
+		scopes[i] = nil
+	}
+	vm.Scopes = scopes[:0]
+	for i := range vm.arena {
+		vm.arena[i] = Scope{}
+	}
+	p.vms.Put(vm)
+}
@@ -0,0 +1,66 @@
+package vm_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+func TestPool(t *testing.T) {
+	program, err := expr.Compile(`let n = len(items); sum(map(items, # * n)) + x`, expr.Env(map[string]any{
+		"items": []int{},
+		"x":     0,
+	}))
+	require.NoError(t, err)
+
+	pool := vm.NewPool(program)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				out, err := pool.Run(map[string]any{"items": []int{1, 2, 3}, "x": i})
+				assert.NoError(t, err)
+				assert.Equal(t, 18+i, out)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	_, err = pool.Run(map[string]any{"items": []int{1}, "x": "a"})
+	require.Error(t, err)
+	out, err := pool.Run(map[string]any{"items": []int{1}, "x": 1})
+	require.NoError(t, err)
+	assert.Equal(t, 2, out)
+}
+
+func BenchmarkPool_Run(b *testing.B) {
+	env := map[string]any{"items": []int{1, 2, 3, 4, 5}, "x": 10}
+	program, err := expr.Compile(`filter(items, # > 2) | map(# * x) | sum()`, expr.Env(env))
+	require.NoError(b, err)
+	pool := vm.NewPool(program)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = pool.Run(env)
+	}
+}
+
+func BenchmarkVM_Run_new(b *testing.B) {
+	env := map[string]any{"items": []int{1, 2, 3, 4, 5}, "x": 10}
+	program, err := expr.Compile(`filter(items, # > 2) | map(# * x) | sum()`, expr.Env(env))
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = vm.Run(program, env)
+	}
+}
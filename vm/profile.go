@@ -0,0 +1,101 @@
+package vm
+
+import (
+	"sync"
+	"time"
+)
+
+// Span is the profile of a node of an expression compiled with
+// conf.Config.Profile. The spans stored in the program only describe the
+// nodes; their counters are filled in the copies returned by VM.Profile and
+// Program.Profile, so a program can be run from many goroutines.
+type Span struct {
+	Name       string  `json:"name"`
+	Expression string  `json:"expression"`
+	Duration   int64   `json:"duration"`
+	Count      int64   `json:"count"` // number of evaluations
+	True       int64   `json:"true"`  // number of evaluations returning true
+	Children   []*Span `json:"children"`
+}
+
+// GetSpan returns the profile of all the runs of the program so far. See
+// Program.Profile.
+func GetSpan(program *Program) *Span {
+	return program.Profile()
+}
+
+// Profile returns the profile of all the runs of the program so far, or nil
+// if the program was compiled without conf.Config.Profile.
+func (program *Program) Profile() *Span {
+	if program.span == nil {
+		return nil
+	}
+	program.totals.mu.Lock()
+	defer program.totals.mu.Unlock()
+	return program.span.with(program.totals.spans)
+}
+
+// Profile returns the profile of the last run of the VM, or nil if the
+// program was compiled without conf.Config.Profile.
+func (vm *VM) Profile() *Span {
+	if vm.profiled == nil || vm.profiled.span == nil {
+		return nil
+	}
+	return vm.profiled.span.with(vm.spans)
+}
+
+// spanStats are the counters of a span.
+type spanStats struct {
+	start    time.Time // start of the current evaluation, during a run
+	duration int64
+	count    int64
+	truths   int64
+}
+
+// profile holds the counters of the spans of a program, summed over all its
+// runs.
+type profile struct {
+	mu    sync.Mutex
+	spans map[*Span]*spanStats
+}
+
+// add sums the counters of a run.
+func (p *profile) add(spans map[*Span]*spanStats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for span, s := range spans {
+		total, ok := p.spans[span]
+		if !ok {
+			total = &spanStats{}
+			p.spans[span] = total
+		}
+		total.duration += s.duration
+		total.count += s.count
+		total.truths += s.truths
+	}
+}
+
+// with returns a copy of the span and its children with the counters.
+func (s *Span) with(stats map[*Span]*spanStats) *Span {
+	c := &Span{Name: s.Name, Expression: s.Expression}
+	if st, ok := stats[s]; ok {
+		c.Duration, c.Count, c.True = st.duration, st.count, st.truths
+	}
+	for _, child := range s.Children {
+		c.Children = append(c.Children, child.with(stats))
+	}
+	return c
+}
+
+// span returns the counters of the span in the current run.
+func (vm *VM) span(span *Span) *spanStats {
+	if vm.spans == nil {
+		vm.spans = make(map[*Span]*spanStats)
+	}
+	s, ok := vm.spans[span]
+	if !ok {
+		s = &spanStats{}
+		vm.spans[span] = s
+	}
+	return s
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/expr-lang/expr/ast"
 	"github.com/expr-lang/expr/builtin"
+	"github.com/expr-lang/expr/conf"
 	"github.com/expr-lang/expr/file"
 	"github.com/expr-lang/expr/vm/runtime"
 )
@@ -28,6 +29,11 @@ type Program struct {
 	functions []Function
 	debugInfo map[string]string
 	span      *Span
+	totals    *profile // counters of the spans over all runs
+	methods   *runtime.Methods
+	scopes    int         // loops nested in the bytecode, at most
+	logger    conf.Logger // logger of VMs without one
+	maxScopes uint        // MaxScopes of VMs without one
 }
 
 // NewProgram returns a new Program. It's used by the compiler.
@@ -43,6 +49,10 @@ func NewProgram(
 	debugInfo map[string]string,
 	span *Span,
 ) *Program {
+	var totals *profile
+	if span != nil {
+		totals = &profile{spans: map[*Span]*spanStats{}}
+	}
 	return &Program{
 		source:    source,
 		node:      node,
@@ -54,9 +64,20 @@ func NewProgram(
 		functions: functions,
 		debugInfo: debugInfo,
 		span:      span,
+		totals:    totals,
+		methods:   runtime.NewMethods(),
+		scopes:    scopeDepth(bytecode),
 	}
 }
 
+// Configure sets what runs of the program use from the config it was
+// compiled with, unless the VM running it sets its own: the logger. It's
+// used by the compiler.
+func (program *Program) Configure(config *conf.Config) {
+	program.logger = config.Logger
+	program.maxScopes = config.MaxScopes
+}
+
 // Source returns origin file.Source.
 func (program *Program) Source() file.Source {
 	return program.source
@@ -72,6 +93,14 @@ func (program *Program) Locations() []file.Location {
 	return program.locations
 }
 
+// loopName returns the name of the builtin which loops from OpBegin at ip.
+func (program *Program) loopName(ip int) string {
+	if name, ok := program.debugInfo[fmt.Sprintf("loop_%d", ip)]; ok {
+		return name
+	}
+	return "loop"
+}
+
 // Disassemble returns opcodes as a string.
 func (program *Program) Disassemble() string {
 	var buf bytes.Buffer
@@ -121,6 +150,12 @@ func (program *Program) DisassembleWriter(w io.Writer) {
 			if method, ok := c.(*runtime.Method); ok {
 				c = fmt.Sprintf("{%v %v}", method.Name, method.Index)
 			}
+			if lambda, ok := c.(*runtime.Lambda); ok {
+				c = fmt.Sprintf("{%v %v}", lambda.Start, lambda.Params)
+			}
+			if branch, ok := c.(*Branch); ok {
+				c = fmt.Sprintf("{%v %v}", branch.Kind, branch.Expression)
+			}
 			_, _ = fmt.Fprintf(w, "%v\t%v\t<%v>\t%v\n", pp, label, arg, c)
 		}
 		builtinArg := func(label string) {
@@ -170,6 +205,15 @@ func (program *Program) DisassembleWriter(w io.Writer) {
 		case OpFetchField:
 			constant("OpFetchField")
 
+		case OpFetchSafe:
+			code("OpFetchSafe")
+
+		case OpFetchFieldSafe:
+			constant("OpFetchFieldSafe")
+
+		case OpFetchIndexSafe:
+			code("OpFetchIndexSafe")
+
 		case OpMethod:
 			constant("OpMethod")
 
@@ -197,6 +241,12 @@ func (program *Program) DisassembleWriter(w io.Writer) {
 		case OpEqualString:
 			code("OpEqualString")
 
+		case OpEqualFloat:
+			constant("OpEqualFloat")
+
+		case OpEqualStrict:
+			code("OpEqualStrict")
+
 		case OpJump:
 			jump("OpJump")
 
@@ -212,15 +262,24 @@ func (program *Program) DisassembleWriter(w io.Writer) {
 		case OpJumpIfNotNil:
 			jump("OpJumpIfNotNil")
 
+		case OpJumpIfNotNilStrict:
+			jump("OpJumpIfNotNilStrict")
+
 		case OpJumpIfEnd:
 			jump("OpJumpIfEnd")
 
 		case OpJumpBackward:
 			jumpBack("OpJumpBackward")
 
+		case OpSwitch:
+			constant("OpSwitch")
+
 		case OpIn:
 			code("OpIn")
 
+		case OpInStrict:
+			code("OpInStrict")
+
 		case OpLess:
 			code("OpLess")
 
@@ -251,6 +310,18 @@ func (program *Program) DisassembleWriter(w io.Writer) {
 		case OpExponent:
 			code("OpExponent")
 
+		case OpAddChecked:
+			code("OpAddChecked")
+
+		case OpSubtractChecked:
+			code("OpSubtractChecked")
+
+		case OpMultiplyChecked:
+			code("OpMultiplyChecked")
+
+		case OpNegateChecked:
+			code("OpNegateChecked")
+
 		case OpRange:
 			code("OpRange")
 
@@ -260,6 +331,18 @@ func (program *Program) DisassembleWriter(w io.Writer) {
 		case OpMatchesConst:
 			constant("OpMatchesConst")
 
+		case OpMatchesGuarded:
+			constant("OpMatchesGuarded")
+
+		case OpRegexp:
+			constant("OpRegexp")
+
+		case OpFetchNamed:
+			constant("OpFetchNamed")
+
+		case OpFetchNamedSafe:
+			constant("OpFetchNamedSafe")
+
 		case OpContains:
 			code("OpContains")
 
@@ -300,12 +383,24 @@ func (program *Program) DisassembleWriter(w io.Writer) {
 			signature := reflect.TypeOf(FuncTypes[arg]).Elem().String()
 			_, _ = fmt.Fprintf(w, "%v\t%v\t<%v>\t%v\n", pp, "OpCallTyped", arg, signature)
 		case OpCallTypedCustom:
-			signature := reflect.TypeOf(FuncTypes[arg]).Elem().String()
+			signature := reflect.TypeOf(CustomFuncTypes[arg]).Elem().String()
 			_, _ = fmt.Fprintf(w, "%v\t%v\t<%v>\t%v\n", pp, "OpCallTypedCustom", arg, signature)
 
 		case OpCallBuiltin1:
 			builtinArg("OpCallBuiltin1")
 
+		case OpCallBuiltin2:
+			builtinArg("OpCallBuiltin2")
+
+		case OpCallBuiltin3:
+			builtinArg("OpCallBuiltin3")
+
+		case OpClosure:
+			constant("OpClosure")
+
+		case OpReturn:
+			code("OpReturn")
+
 		case OpArray:
 			code("OpArray")
 
@@ -351,6 +446,9 @@ func (program *Program) DisassembleWriter(w io.Writer) {
 		case OpPointer:
 			code("OpPointer")
 
+		case OpOuterPointer:
+			argument("OpOuterPointer")
+
 		case OpThrow:
 			code("OpThrow")
 
@@ -366,12 +464,42 @@ func (program *Program) DisassembleWriter(w io.Writer) {
 		case OpSort:
 			code("OpSort")
 
+		case OpSortNext:
+			jump("OpSortNext")
+
+		case OpSortResult:
+			code("OpSortResult")
+
+		case OpUniqBy:
+			code("OpUniqBy")
+
+		case OpPartition:
+			code("OpPartition")
+
+		case OpMin:
+			code("OpMin")
+
+		case OpMax:
+			code("OpMax")
+
 		case OpProfileStart:
 			code("OpProfileStart")
 
 		case OpProfileEnd:
 			code("OpProfileEnd")
 
+		case OpCover:
+			constant("OpCover")
+
+		case OpCoverNil:
+			constant("OpCoverNil")
+
+		case OpCallCtx:
+			argument("OpCallCtx")
+
+		case OpLoadDynamic:
+			constant("OpLoadDynamic")
+
 		case OpBegin:
 			code("OpBegin")
 
@@ -379,7 +507,13 @@ func (program *Program) DisassembleWriter(w io.Writer) {
 			code("OpEnd")
 
 		default:
-			_, _ = fmt.Fprintf(w, "%v\t%#x (unknown)\n", ip, op)
+			if custom := op.custom(); custom == nil {
+				_, _ = fmt.Fprintf(w, "%v\t%#x (unknown)\n", ip, op)
+			} else if arg < 0 {
+				code(custom.name)
+			} else {
+				constant(custom.name)
+			}
 		}
 	}
 }
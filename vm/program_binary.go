@@ -0,0 +1,616 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/expr-lang/expr/builtin"
+	"github.com/expr-lang/expr/conf"
+	"github.com/expr-lang/expr/file"
+	"github.com/expr-lang/expr/vm/runtime"
+)
+
+const (
+	programMagic   = "expr-program"
+	programVersion = 2
+)
+
+// Registry resolves values which cannot be serialized when a program is
+// loaded. Builtin functions are always resolved by name.
+type Registry struct {
+	// Functions defined with expr.Function, by name.
+	Functions map[string]Function
+	// Interner, if set, re-interns string and small integer constants,
+	// as serialized programs store them by copy.
+	Interner conf.Interner
+}
+
+// MarshalBinary encodes the program, so it can be cached or shipped to
+// another process and run there without compiling. Opcodes and builtins are
+// stored by name; functions are stored by name and must be resolvable when
+// loading. The AST and profiling spans are not stored. Maps are stored
+// sorted, so the same program is always encoded to the same bytes.
+func (program *Program) MarshalBinary() ([]byte, error) {
+	if program.span != nil {
+		return nil, fmt.Errorf("cannot marshal program compiled with profiling")
+	}
+
+	w := wireProgram{
+		Version:   programVersion,
+		Arguments: make([]int, len(program.Arguments)),
+		Source:    program.source.String(),
+		Locations: program.locations,
+		Variables: program.variables,
+		MaxScopes: program.maxScopes,
+	}
+	keys := make([]string, 0, len(program.debugInfo))
+	for key := range program.debugInfo {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		w.Debug = append(w.Debug, key, program.debugInfo[key])
+	}
+
+	opcodes := map[Opcode]uint16{}
+	builtins := map[string]int{}
+	w.Bytecode = make([]uint16, len(program.Bytecode))
+	for ip, op := range program.Bytecode {
+		index, ok := opcodes[op]
+		if !ok {
+			index = uint16(len(w.Opcodes))
+			opcodes[op] = index
+			w.Opcodes = append(w.Opcodes, op.String())
+		}
+		w.Bytecode[ip] = index
+
+		arg := program.Arguments[ip]
+		if isBuiltinCall(op) {
+			name := builtin.Builtins[arg].Name
+			index, ok := builtins[name]
+			if !ok {
+				index = len(w.Builtins)
+				builtins[name] = index
+				w.Builtins = append(w.Builtins, name)
+			}
+			arg = index
+		}
+		w.Arguments[ip] = arg
+	}
+
+	for i := range program.functions {
+		name, ok := program.debugInfo[fmt.Sprintf("func_%d", i)]
+		if !ok {
+			return nil, fmt.Errorf("cannot marshal function %d: unknown name", i)
+		}
+		w.Functions = append(w.Functions, name)
+	}
+
+	for i, c := range program.Constants {
+		v, err := encodeValue(c, program.debugInfo[fmt.Sprintf("const_%d", i)])
+		if err != nil {
+			return nil, fmt.Errorf("cannot marshal constant %d: %w", i, err)
+		}
+		w.Constants = append(w.Constants, v)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(programMagic)
+	if err := gob.NewEncoder(&buf).Encode(&w); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a program encoded by MarshalBinary. Only builtin
+// functions are resolved; use Load for programs calling custom functions.
+func (program *Program) UnmarshalBinary(data []byte) error {
+	return program.unmarshal(data, nil)
+}
+
+// Load decodes a program encoded by MarshalBinary, resolving functions
+// through the registry first and through builtins second.
+func Load(data []byte, registry *Registry) (*Program, error) {
+	program := &Program{}
+	if err := program.unmarshal(data, registry); err != nil {
+		return nil, err
+	}
+	return program, nil
+}
+
+func (program *Program) unmarshal(data []byte, registry *Registry) error {
+	if registry == nil {
+		registry = &Registry{}
+	}
+	if !bytes.HasPrefix(data, []byte(programMagic)) {
+		return fmt.Errorf("not an expr program")
+	}
+
+	var w wireProgram
+	err := gob.NewDecoder(bytes.NewReader(data[len(programMagic):])).Decode(&w)
+	if err != nil {
+		return fmt.Errorf("cannot decode program: %w", err)
+	}
+	if w.Version != programVersion {
+		return fmt.Errorf("unsupported program version %d", w.Version)
+	}
+	if len(w.Bytecode) != len(w.Arguments) {
+		return fmt.Errorf("corrupted program: bytecode and arguments differ in length")
+	}
+	if len(w.Debug)%2 != 0 {
+		return fmt.Errorf("corrupted program: debug info is not in pairs")
+	}
+	debugInfo := make(map[string]string, len(w.Debug)/2)
+	for i := 0; i < len(w.Debug); i += 2 {
+		debugInfo[w.Debug[i]] = w.Debug[i+1]
+	}
+
+	opcodes := make([]Opcode, len(w.Opcodes))
+	for i, name := range w.Opcodes {
+		op, ok := opcodeByName(name)
+		if !ok {
+			return fmt.Errorf("unknown opcode %v", name)
+		}
+		opcodes[i] = op
+	}
+
+	bytecode := make([]Opcode, len(w.Bytecode))
+	for ip, index := range w.Bytecode {
+		if int(index) >= len(opcodes) {
+			return fmt.Errorf("corrupted program: opcode index %d out of range", index)
+		}
+		bytecode[ip] = opcodes[index]
+		if isBuiltinCall(bytecode[ip]) {
+			arg := w.Arguments[ip]
+			if arg < 0 || arg >= len(w.Builtins) {
+				return fmt.Errorf("corrupted program: builtin index %d out of range", arg)
+			}
+			id, ok := builtin.Index[w.Builtins[arg]]
+			if !ok {
+				return fmt.Errorf("unknown builtin %v", w.Builtins[arg])
+			}
+			w.Arguments[ip] = id
+		}
+	}
+
+	functions := make([]Function, len(w.Functions))
+	for i, name := range w.Functions {
+		fn, ok := registry.Functions[name]
+		if !ok {
+			if id, isBuiltin := builtin.Index[name]; isBuiltin && builtin.Builtins[id].Func != nil {
+				fn, ok = builtin.Builtins[id].Func, true
+			}
+		}
+		if !ok {
+			return fmt.Errorf("unknown function %v", name)
+		}
+		functions[i] = fn
+	}
+
+	constants := make([]any, len(w.Constants))
+	for i, v := range w.Constants {
+		c, err := decodeValue(v)
+		if err != nil {
+			return fmt.Errorf("cannot unmarshal constant %d: %w", i, err)
+		}
+		if registry.Interner != nil {
+			c = registry.Interner.Intern(c)
+		}
+		constants[i] = c
+	}
+
+	*program = Program{
+		Bytecode:  bytecode,
+		Arguments: w.Arguments,
+		Constants: constants,
+		source:    file.NewSource(w.Source),
+		locations: w.Locations,
+		variables: w.Variables,
+		functions: functions,
+		debugInfo: debugInfo,
+		methods:   runtime.NewMethods(),
+		scopes:    scopeDepth(bytecode),
+		maxScopes: w.MaxScopes,
+	}
+	return nil
+}
+
+func isBuiltinCall(op Opcode) bool {
+	return op == OpCallBuiltin1 || op == OpCallBuiltin2 || op == OpCallBuiltin3
+}
+
+func opcodeByName(name string) (Opcode, bool) {
+	for op := OpPush; op <= OpEnd; op++ {
+		if op.String() == name {
+			return op, true
+		}
+	}
+	return LookupOpcode(name)
+}
+
+type wireProgram struct {
+	Version   int
+	Opcodes   []string
+	Bytecode  []uint16
+	Arguments []int
+	Builtins  []string
+	Functions []string
+	Constants []wireValue
+	Source    string
+	Locations []file.Location
+	Variables int
+	MaxScopes uint
+	Debug     []string // Keys and values of the debug info, sorted by key.
+}
+
+type wireKind uint8
+
+const (
+	wireNil wireKind = iota
+	wireBool
+	wireInt
+	wireInt8
+	wireInt16
+	wireInt32
+	wireInt64
+	wireUint
+	wireUint8
+	wireUint16
+	wireUint32
+	wireUint64
+	wireFloat32
+	wireFloat64
+	wireString
+	wireDuration
+	wireRegexp
+	wireField
+	wireMethod
+	wireError
+	wireArray
+	wireMap
+	wireSafeFunction
+	wirePointerMethod
+	wireBytes
+	wireLambda
+	wireSwitch
+	wireRegexps
+	wireFieldNames
+	wireDecimal
+	wireGuardedRegexp
+	wireSet
+)
+
+type wireValue struct {
+	Kind  wireKind
+	Int   int64
+	Uint  uint64
+	Float float64
+	Str   string
+	Ints  []int
+	Strs  []string
+	Items []wireValue
+}
+
+func encodeValue(c any, name string) (wireValue, error) {
+	switch c := c.(type) {
+	case nil:
+		return wireValue{Kind: wireNil}, nil
+	case bool:
+		v := wireValue{Kind: wireBool}
+		if c {
+			v.Int = 1
+		}
+		return v, nil
+	case int:
+		return wireValue{Kind: wireInt, Int: int64(c)}, nil
+	case int8:
+		return wireValue{Kind: wireInt8, Int: int64(c)}, nil
+	case int16:
+		return wireValue{Kind: wireInt16, Int: int64(c)}, nil
+	case int32:
+		return wireValue{Kind: wireInt32, Int: int64(c)}, nil
+	case int64:
+		return wireValue{Kind: wireInt64, Int: c}, nil
+	case uint:
+		return wireValue{Kind: wireUint, Uint: uint64(c)}, nil
+	case uint8:
+		return wireValue{Kind: wireUint8, Uint: uint64(c)}, nil
+	case uint16:
+		return wireValue{Kind: wireUint16, Uint: uint64(c)}, nil
+	case uint32:
+		return wireValue{Kind: wireUint32, Uint: uint64(c)}, nil
+	case uint64:
+		return wireValue{Kind: wireUint64, Uint: c}, nil
+	case float32:
+		return wireValue{Kind: wireFloat32, Float: float64(c)}, nil
+	case float64:
+		return wireValue{Kind: wireFloat64, Float: c}, nil
+	case string:
+		return wireValue{Kind: wireString, Str: c}, nil
+	case []byte:
+		return wireValue{Kind: wireBytes, Str: string(c)}, nil
+	case time.Duration:
+		return wireValue{Kind: wireDuration, Int: int64(c)}, nil
+	case *regexp.Regexp:
+		return wireValue{Kind: wireRegexp, Str: c.String()}, nil
+	case *runtime.Field:
+		return wireValue{Kind: wireField, Ints: c.Index, Strs: c.Path}, nil
+	case *runtime.Method:
+		if c.Pointer {
+			return wireValue{Kind: wirePointerMethod, Int: int64(c.Index), Str: c.Name}, nil
+		}
+		return wireValue{Kind: wireMethod, Int: int64(c.Index), Str: c.Name}, nil
+	case *runtime.Lambda:
+		return wireValue{
+			Kind:  wireLambda,
+			Int:   int64(c.Start),
+			Uint:  uint64(c.Params),
+			Ints:  c.Locals,
+			Items: []wireValue{{Ints: c.Captures}},
+		}, nil
+	case runtime.Switch:
+		type entry struct {
+			key    wireValue
+			offset int
+		}
+		var entries []entry
+		for key, offset := range c {
+			e, err := encodeValue(key, "")
+			if err != nil {
+				return wireValue{Kind: wireSwitch}, err
+			}
+			entries = append(entries, entry{e, offset})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return wireLess(entries[i].key, entries[j].key)
+		})
+		v := wireValue{Kind: wireSwitch}
+		for _, e := range entries {
+			v.Items = append(v.Items, e.key)
+			v.Ints = append(v.Ints, e.offset)
+		}
+		return v, nil
+	case *runtime.Regexps:
+		// The limits are kept, the cache starts empty again.
+		l := c.RegexLimits
+		return wireValue{Kind: wireRegexps, Ints: []int{l.MaxLength, l.MaxSize, l.MaxSteps, l.CacheSize}}, nil
+	case *runtime.FieldNames:
+		v := wireValue{Kind: wireFieldNames, Strs: c.Tags}
+		if c.CaseInsensitive {
+			v.Int = 1
+		}
+		return v, nil
+	case *big.Rat:
+		return wireValue{Kind: wireDecimal, Str: c.String()}, nil
+	case *runtime.Regexp:
+		return wireValue{Kind: wireGuardedRegexp, Str: c.String(), Int: int64(c.MaxSteps())}, nil
+	case error:
+		return wireValue{Kind: wireError, Str: c.Error()}, nil
+	case []any:
+		v := wireValue{Kind: wireArray}
+		for _, item := range c {
+			e, err := encodeValue(item, "")
+			if err != nil {
+				return v, err
+			}
+			v.Items = append(v.Items, e)
+		}
+		return v, nil
+	case map[string]any:
+		v := wireValue{Kind: wireMap}
+		for key := range c {
+			v.Strs = append(v.Strs, key)
+		}
+		sort.Strings(v.Strs)
+		for _, key := range v.Strs {
+			e, err := encodeValue(c[key], "")
+			if err != nil {
+				return v, err
+			}
+			v.Items = append(v.Items, e)
+		}
+		return v, nil
+	case SafeFunction:
+		if name == "" {
+			return wireValue{}, fmt.Errorf("unknown function name")
+		}
+		return wireValue{Kind: wireSafeFunction, Str: name}, nil
+	}
+	if t := reflect.TypeOf(c); t != nil && t.Kind() == reflect.Map && t.Elem() == setElem {
+		return encodeSet(reflect.ValueOf(c))
+	}
+	return wireValue{}, fmt.Errorf("unsupported type %v", reflect.TypeOf(c))
+}
+
+var setElem = reflect.TypeOf(struct{}{})
+
+// encodeSet encodes sets of scalars, like the map[string]struct{} constants
+// of the in operator over array literals. The kind of the keys is kept in
+// Int, so empty sets are decoded to the same type as well.
+func encodeSet(set reflect.Value) (wireValue, error) {
+	switch set.Type().Key().Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return wireValue{}, fmt.Errorf("unsupported type %v", set.Type())
+	}
+	zero, err := encodeValue(reflect.Zero(set.Type().Key()).Interface(), "")
+	if err != nil {
+		return wireValue{}, fmt.Errorf("unsupported type %v", set.Type())
+	}
+	v := wireValue{Kind: wireSet, Int: int64(zero.Kind)}
+	for _, key := range set.MapKeys() {
+		e, err := encodeValue(key.Interface(), "")
+		if err != nil {
+			return v, err
+		}
+		v.Items = append(v.Items, e)
+	}
+	sort.Slice(v.Items, func(i, j int) bool {
+		return wireLess(v.Items[i], v.Items[j])
+	})
+	return v, nil
+}
+
+// wireLess orders the encoded keys of switch tables and sets, which are
+// scalars.
+func wireLess(a, b wireValue) bool {
+	switch {
+	case a.Kind != b.Kind:
+		return a.Kind < b.Kind
+	case a.Int != b.Int:
+		return a.Int < b.Int
+	case a.Uint != b.Uint:
+		return a.Uint < b.Uint
+	case a.Float != b.Float:
+		return a.Float < b.Float
+	}
+	return a.Str < b.Str
+}
+
+func decodeValue(v wireValue) (any, error) {
+	switch v.Kind {
+	case wireNil:
+		return nil, nil
+	case wireBool:
+		return v.Int == 1, nil
+	case wireInt:
+		return int(v.Int), nil
+	case wireInt8:
+		return int8(v.Int), nil
+	case wireInt16:
+		return int16(v.Int), nil
+	case wireInt32:
+		return int32(v.Int), nil
+	case wireInt64:
+		return v.Int, nil
+	case wireUint:
+		return uint(v.Uint), nil
+	case wireUint8:
+		return uint8(v.Uint), nil
+	case wireUint16:
+		return uint16(v.Uint), nil
+	case wireUint32:
+		return uint32(v.Uint), nil
+	case wireUint64:
+		return v.Uint, nil
+	case wireFloat32:
+		return float32(v.Float), nil
+	case wireFloat64:
+		return v.Float, nil
+	case wireString:
+		return v.Str, nil
+	case wireBytes:
+		return []byte(v.Str), nil
+	case wireDuration:
+		return time.Duration(v.Int), nil
+	case wireRegexp:
+		return regexp.Compile(v.Str)
+	case wireField:
+		return &runtime.Field{Index: v.Ints, Path: v.Strs}, nil
+	case wireMethod:
+		return &runtime.Method{Index: int(v.Int), Name: v.Str}, nil
+	case wirePointerMethod:
+		return &runtime.Method{Index: int(v.Int), Name: v.Str, Pointer: true}, nil
+	case wireLambda:
+		if len(v.Items) != 1 {
+			return nil, fmt.Errorf("corrupted function")
+		}
+		return &runtime.Lambda{
+			Start:    int(v.Int),
+			Params:   int(v.Uint),
+			Locals:   v.Ints,
+			Captures: v.Items[0].Ints,
+		}, nil
+	case wireSwitch:
+		if len(v.Ints) != len(v.Items) {
+			return nil, fmt.Errorf("corrupted switch")
+		}
+		table := make(runtime.Switch, len(v.Items))
+		for i, item := range v.Items {
+			key, err := decodeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			table[key] = v.Ints[i]
+		}
+		return table, nil
+	case wireRegexps:
+		if len(v.Ints) != 4 {
+			return nil, fmt.Errorf("corrupted regexp limits")
+		}
+		return runtime.NewRegexps(runtime.RegexLimits{
+			MaxLength: v.Ints[0],
+			MaxSize:   v.Ints[1],
+			MaxSteps:  v.Ints[2],
+			CacheSize: v.Ints[3],
+		}), nil
+	case wireFieldNames:
+		return &runtime.FieldNames{Tags: v.Strs, CaseInsensitive: v.Int == 1}, nil
+	case wireGuardedRegexp:
+		return runtime.NewRegexps(runtime.RegexLimits{MaxSteps: int(v.Int)}).Compile(v.Str)
+	case wireDecimal:
+		d, ok := new(big.Rat).SetString(v.Str)
+		if !ok {
+			return nil, fmt.Errorf("corrupted decimal %q", v.Str)
+		}
+		return d, nil
+	case wireError:
+		return errors.New(v.Str), nil
+	case wireArray:
+		array := make([]any, len(v.Items))
+		for i, item := range v.Items {
+			d, err := decodeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			array[i] = d
+		}
+		return array, nil
+	case wireMap:
+		if len(v.Strs) != len(v.Items) {
+			return nil, fmt.Errorf("corrupted map")
+		}
+		m := make(map[string]any, len(v.Items))
+		for i, item := range v.Items {
+			d, err := decodeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			m[v.Strs[i]] = d
+		}
+		return m, nil
+	case wireSet:
+		zero, err := decodeValue(wireValue{Kind: wireKind(v.Int)})
+		if err != nil || zero == nil {
+			return nil, fmt.Errorf("corrupted set")
+		}
+		set := reflect.MakeMapWithSize(reflect.MapOf(reflect.TypeOf(zero), setElem), len(v.Items))
+		for _, item := range v.Items {
+			key, err := decodeValue(item)
+			if err != nil {
+				return nil, err
+			}
+			k := reflect.ValueOf(key)
+			if k.Type() != set.Type().Key() {
+				return nil, fmt.Errorf("corrupted set")
+			}
+			set.SetMapIndex(k, reflect.Zero(setElem))
+		}
+		return set.Interface(), nil
+	case wireSafeFunction:
+		if id, ok := builtin.Index[v.Str]; ok && builtin.Builtins[id].Safe != nil {
+			return builtin.Builtins[id].Safe, nil
+		}
+		return nil, fmt.Errorf("unknown function %v", v.Str)
+	}
+	return nil, fmt.Errorf("unknown value kind %d", v.Kind)
+}
@@ -0,0 +1,142 @@
+package vm_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/conf"
+	"github.com/expr-lang/expr/test/mock"
+	"github.com/expr-lang/expr/vm"
+)
+
+func TestProgram_MarshalBinary(t *testing.T) {
+	env := mock.Env{
+		String:     "hello",
+		Int:        5,
+		Foo:        mock.Foo{Value: "foo"},
+		ArrayOfInt: []int{1, 2, 3},
+	}
+
+	tests := []string{
+		`1 + 2 * Int`,
+		`String matches "^h.l+o$"`,
+		`upper(String) + repeat("!", 3)`,
+		`Foo.Value + Foo.Method().Baz`,
+		`filter(ArrayOfInt, # > 1)`,
+		`{"a": [1, 2.5, true, nil]}`,
+		`let x = Int; x > 3 ? "big" : "small"`,
+		`duration("1h") > duration("1m")`,
+		`Int ?? 0`,
+		`b"\xff" + hex"00"`,
+		`let k = Int; let f = (x) => x + k; f(1) + f(2)`,
+		`String in ["hello", "world"]`,
+		`Int in [1, 5, 7] and 2 not in [1, 3]`,
+	}
+
+	for _, code := range tests {
+		t.Run(code, func(t *testing.T) {
+			program, err := expr.Compile(code, expr.Env(mock.Env{}))
+			require.NoError(t, err)
+
+			want, err := expr.Run(program, env)
+			require.NoError(t, err)
+
+			data, err := program.MarshalBinary()
+			require.NoError(t, err)
+
+			loaded := &vm.Program{}
+			require.NoError(t, loaded.UnmarshalBinary(data))
+			assert.Equal(t, program.Disassemble(), loaded.Disassemble())
+
+			got, err := expr.Run(loaded, env)
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestLoad_with_registry(t *testing.T) {
+	greet := func(params ...any) (any, error) {
+		return fmt.Sprintf("hello, %v", params[0]), nil
+	}
+
+	program, err := expr.Compile(`greet("world")`, expr.Function("greet", greet))
+	require.NoError(t, err)
+
+	data, err := program.MarshalBinary()
+	require.NoError(t, err)
+
+	_, err = vm.Load(data, nil)
+	require.EqualError(t, err, "unknown function greet")
+
+	pool := vm.NewInternPool()
+	loaded, err := vm.Load(data, &vm.Registry{
+		Functions: map[string]vm.Function{"greet": greet},
+		Interner:  pool,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, pool.Len())
+
+	out, err := expr.Run(loaded, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "hello, world", out)
+}
+
+func TestProgram_MarshalBinary_sets(t *testing.T) {
+	program, err := expr.Compile(`String in ["d", "c", "b", "a"] || Int in [4, 3, 2, 1]`, expr.Env(mock.Env{}))
+	require.NoError(t, err)
+
+	data, err := program.MarshalBinary()
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		again, err := program.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, data, again)
+	}
+
+	loaded := &vm.Program{}
+	require.NoError(t, loaded.UnmarshalBinary(data))
+	assert.Equal(t, program.Constants, loaded.Constants)
+	assert.Contains(t, loaded.Constants, map[string]struct{}{"a": {}, "b": {}, "c": {}, "d": {}})
+	assert.Contains(t, loaded.Constants, map[int]struct{}{1: {}, 2: {}, 3: {}, 4: {}})
+
+	out, err := expr.Run(loaded, mock.Env{String: "c"})
+	require.NoError(t, err)
+	assert.Equal(t, true, out)
+}
+
+func TestProgram_MarshalBinary_errors(t *testing.T) {
+	program, err := expr.Compile(`1 + 2`, func(c *conf.Config) { c.Profile = true })
+	require.NoError(t, err)
+	_, err = program.MarshalBinary()
+	require.Error(t, err)
+
+	require.Error(t, (&vm.Program{}).UnmarshalBinary([]byte("garbage")))
+}
+
+func TestProgram_MarshalBinary_deterministic(t *testing.T) {
+	code := `
+		let m = {"a": 1, "b": 2, "c": 3, "d": 4, "e": 5, "f": 6, "g": 7, "h": 8};
+		let f = (x) => x + 1;
+		String == "a" ? f(1) : String == "b" ? 2 : String == "c" ? 3 : String == "d" ? 4 : String == "e" ? 5 : m.h
+	`
+	program, err := expr.Compile(code, expr.Env(mock.Env{}))
+	require.NoError(t, err)
+	require.Contains(t, program.Disassemble(), "OpSwitch")
+
+	want, err := program.MarshalBinary()
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		data, err := program.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, want, data)
+	}
+
+	loaded := &vm.Program{}
+	require.NoError(t, loaded.UnmarshalBinary(want))
+	assert.Equal(t, program.Disassemble(), loaded.Disassemble())
+}
@@ -0,0 +1,25 @@
+package runtime
+
+import "reflect"
+
+// ParamType returns the type of the parameter of the function type fn which
+// receives the argument at index i: the element type of the variadic
+// parameter for the arguments past the fixed ones.
+func ParamType(fn reflect.Type, i int) reflect.Type {
+	if fn.IsVariadic() && i >= fn.NumIn()-1 {
+		return fn.In(fn.NumIn() - 1).Elem()
+	}
+	return fn.In(i)
+}
+
+// ParamValue returns the argument for a parameter of type t, to call a
+// function with reflect.Value.Call. A nil argument is the zero value of t,
+// like a nil passed to the parameter in Go: a nil pointer, map, slice, func,
+// channel or interface. Parameters which can not be nil, like int, receive
+// their zero value too. All the call opcodes pass nil arguments this way.
+func ParamValue(t reflect.Type, arg any) reflect.Value {
+	if arg == nil {
+		return reflect.Zero(t)
+	}
+	return reflect.ValueOf(arg)
+}
@@ -0,0 +1,132 @@
+package runtime
+
+import (
+	"fmt"
+	"math"
+)
+
+// AddInt returns x + y, and false if the sum overflows int.
+func AddInt(x, y int) (int, bool) {
+	r := x + y
+	return r, (r > x) == (y > 0)
+}
+
+// SubtractInt returns x - y, and false if the difference overflows int.
+func SubtractInt(x, y int) (int, bool) {
+	r := x - y
+	return r, (r < x) == (y > 0)
+}
+
+// MultiplyInt returns x * y, and false if the product overflows int.
+func MultiplyInt(x, y int) (int, bool) {
+	if x == 0 || y == 0 {
+		return 0, true
+	}
+	r := x * y
+	if (x == -1 && y == math.MinInt) || (y == -1 && x == math.MinInt) {
+		return r, false
+	}
+	return r, r/y == x
+}
+
+// NegateInt returns -x, and false if the negation overflows int.
+func NegateInt(x int) (int, bool) {
+	return -x, x != math.MinInt
+}
+
+// AddChecked is like Add, but panics on integer overflow.
+func AddChecked(a, b any) any {
+	if x, y, ok := checkedInts(a, b); ok {
+		if r, ok := AddInt(x, y); ok {
+			return r
+		}
+		panic(fmt.Sprintf("integer overflow: %v + %v", a, b))
+	}
+	return Add(a, b)
+}
+
+// SubtractChecked is like Subtract, but panics on integer overflow.
+func SubtractChecked(a, b any) any {
+	if x, y, ok := checkedInts(a, b); ok {
+		if r, ok := SubtractInt(x, y); ok {
+			return r
+		}
+		panic(fmt.Sprintf("integer overflow: %v - %v", a, b))
+	}
+	return Subtract(a, b)
+}
+
+// MultiplyChecked is like Multiply, but panics on integer overflow.
+func MultiplyChecked(a, b any) any {
+	if x, y, ok := checkedInts(a, b); ok {
+		if r, ok := MultiplyInt(x, y); ok {
+			return r
+		}
+		panic(fmt.Sprintf("integer overflow: %v * %v", a, b))
+	}
+	return Multiply(a, b)
+}
+
+// NegateChecked is like Negate, but panics on integer overflow.
+func NegateChecked(a any) any {
+	if x, ok := checkedInt(a); ok {
+		if r, ok := NegateInt(x); ok {
+			return r
+		}
+		panic(fmt.Sprintf("integer overflow: -(%v)", a))
+	}
+	return Negate(a)
+}
+
+// checkedInts converts both operands to int, if both are integers. As Add
+// and friends return int for integers, uint64 values above the int range
+// are an overflow too.
+func checkedInts(a, b any) (int, int, bool) {
+	x, ok := checkedInt(a)
+	if !ok {
+		return 0, 0, false
+	}
+	y, ok := checkedInt(b)
+	if !ok {
+		return 0, 0, false
+	}
+	return x, y, true
+}
+
+func checkedInt(v any) (int, bool) {
+	switch x := v.(type) {
+	case int:
+		return x, true
+	case int8:
+		return int(x), true
+	case int16:
+		return int(x), true
+	case int32:
+		return int(x), true
+	case int64:
+		if int64(int(x)) != x {
+			panic(fmt.Sprintf("integer overflow: %v", v))
+		}
+		return int(x), true
+	case uint:
+		if x > math.MaxInt {
+			panic(fmt.Sprintf("integer overflow: %v", v))
+		}
+		return int(x), true
+	case uint8:
+		return int(x), true
+	case uint16:
+		return int(x), true
+	case uint32:
+		if uint64(x) > math.MaxInt {
+			panic(fmt.Sprintf("integer overflow: %v", v))
+		}
+		return int(x), true
+	case uint64:
+		if x > math.MaxInt {
+			panic(fmt.Sprintf("integer overflow: %v", v))
+		}
+		return int(x), true
+	}
+	return 0, false
+}
@@ -0,0 +1,19 @@
+package runtime
+
+// Lambda is a function defined in an expression, like (x) => x * 2. Its
+// body is a part of the bytecode of the program, and its parameters and
+// the lets of its body are variables of the program.
+type Lambda struct {
+	Start    int   // Address of the body in the bytecode.
+	Params   int   // Number of parameters, stored in the first variables of Locals.
+	Locals   []int // Variables of the parameters and of the lets of the body.
+	Captures []int // Variables declared around the function and used in its body.
+}
+
+// Closure is the value of a function defined in an expression. It keeps
+// the values of the captured variables at the time it was created, so a
+// function created in a loop uses the values of its iteration.
+type Closure struct {
+	*Lambda
+	Values []any // Values of Captures.
+}
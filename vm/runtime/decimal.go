@@ -0,0 +1,103 @@
+package runtime
+
+import (
+	"math/big"
+	"strconv"
+)
+
+// Decimal converts a number to the exact decimal used in decimal mode.
+// Pointers to decimals are dereferenced by the vm, so both *big.Rat and
+// big.Rat are accepted.
+// Floats are converted from their shortest decimal representation, so
+// 0.1 becomes exactly 1/10.
+func Decimal(v any) (*big.Rat, bool) {
+	switch x := v.(type) {
+	case *big.Rat:
+		return x, x != nil
+	case big.Rat:
+		return &x, true
+	case int:
+		return new(big.Rat).SetInt64(int64(x)), true
+	case int8:
+		return new(big.Rat).SetInt64(int64(x)), true
+	case int16:
+		return new(big.Rat).SetInt64(int64(x)), true
+	case int32:
+		return new(big.Rat).SetInt64(int64(x)), true
+	case int64:
+		return new(big.Rat).SetInt64(x), true
+	case uint:
+		return new(big.Rat).SetUint64(uint64(x)), true
+	case uint8:
+		return new(big.Rat).SetUint64(uint64(x)), true
+	case uint16:
+		return new(big.Rat).SetUint64(uint64(x)), true
+	case uint32:
+		return new(big.Rat).SetUint64(uint64(x)), true
+	case uint64:
+		return new(big.Rat).SetUint64(x), true
+	case float32:
+		return parseDecimal(strconv.FormatFloat(float64(x), 'g', -1, 32))
+	case float64:
+		return parseDecimal(strconv.FormatFloat(x, 'g', -1, 64))
+	}
+	return nil, false
+}
+
+func parseDecimal(s string) (*big.Rat, bool) {
+	return new(big.Rat).SetString(s)
+}
+
+// decimals converts both operands to decimals if at least one of them is
+// a decimal and the other one is a number.
+func decimals(a, b any) (*big.Rat, *big.Rat, bool) {
+	if !isDecimal(a) && !isDecimal(b) {
+		return nil, nil, false
+	}
+	x, ok := Decimal(a)
+	if !ok {
+		return nil, nil, false
+	}
+	y, ok := Decimal(b)
+	if !ok {
+		return nil, nil, false
+	}
+	return x, y, true
+}
+
+func isDecimal(v any) bool {
+	switch v.(type) {
+	case *big.Rat, big.Rat:
+		return true
+	}
+	return false
+}
+
+// FormatDecimal formats a decimal exactly, like a float literal if it has
+// a finite number of digits, like 0.5, or else as a fraction, like 1/3.
+func FormatDecimal(x *big.Rat) string {
+	if x.IsInt() {
+		return x.Num().String()
+	}
+	// Fractions whose denominator has no prime factors other than 2 and 5
+	// have as many digits as the larger of their powers.
+	d := new(big.Int).Set(x.Denom())
+	digits := 0
+	for _, p := range []int64{2, 5} {
+		n, m, prime := 0, new(big.Int), big.NewInt(p)
+		for {
+			q, r := new(big.Int).QuoRem(d, prime, m)
+			if r.Sign() != 0 {
+				break
+			}
+			d, n = q, n+1
+		}
+		if n > digits {
+			digits = n
+		}
+	}
+	if d.Cmp(big.NewInt(1)) != 0 {
+		return x.String()
+	}
+	return x.FloatString(digits)
+}
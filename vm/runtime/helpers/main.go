@@ -106,9 +106,13 @@ func arrayEqualCases(xs ...[]string) string {
 	echo(`switch y := b.(type) {`)
 	for _, a := range append(types, "any") {
 		echo(`case []%v:`, a)
+		if a == "any" {
+			echo(`var cycle bool`)
+			echo(`if seen, cycle = seen.enter(a, b); cycle { return true }`)
+		}
 		echo(`if len(x) != len(y) { return false }`)
 		echo(`for i := range x {`)
-		echo(`if !Equal(x[i], y[i]) { return false }`)
+		echo(`if !equal(x[i], y[i], seen) { return false }`)
 		echo(`}`)
 		echo("return true")
 	}
@@ -117,7 +121,7 @@ func arrayEqualCases(xs ...[]string) string {
 		echo(`case []%v:`, a)
 		echo(`switch y := b.(type) {`)
 		echo(`case []any:`)
-		echo(`return Equal(y, x)`)
+		echo(`return equal(y, x, seen)`)
 		echo(`case []%v:`, a)
 		echo(`if len(x) != len(y) { return false }`)
 		echo(`for i := range x {`)
@@ -142,12 +146,18 @@ const helpers = `// Code generated by vm/runtime/helpers/main.go. DO NOT EDIT.
 package runtime
 
 import (
+	"bytes"
 	"fmt"
+	"math/big"
 	"reflect"
 	"time"
 )
 
 func Equal(a, b interface{}) bool {
+	return equal(a, b, nil)
+}
+
+func equal(a, b interface{}, seen visits) bool {
 	switch x := a.(type) {
 	{{ cases "==" }}
 	{{ array_equal_cases }}
@@ -172,9 +182,18 @@ func Equal(a, b interface{}) bool {
 			return x == y
 		}
 	}
+	if x, y, ok := underlyings(a, b); ok {
+		return equal(x, y, seen)
+	}
+	if x, y, ok := decimals(a, b); ok {
+		return x.Cmp(y) == 0
+	}
 	if IsNil(a) && IsNil(b) {
 		return true
 	}
+	if equal, ok := equalElements(a, b, seen, equal); ok {
+		return equal
+	}
 	return reflect.DeepEqual(a, b)
 }
 
@@ -186,6 +205,11 @@ func Less(a, b interface{}) bool {
 		case string:
 			return x < y
 		}
+	case []byte:
+		switch y := b.(type) {
+		case []byte:
+			return bytes.Compare(x, y) < 0
+		}
 	case time.Time:
 		switch y := b.(type) {
 		case time.Time:
@@ -197,6 +221,12 @@ func Less(a, b interface{}) bool {
 			return x < y
 		}
 	}
+	if x, y, ok := underlyings(a, b); ok {
+		return Less(x, y)
+	}
+	if x, y, ok := decimals(a, b); ok {
+		return x.Cmp(y) < 0
+	}
 	panic(fmt.Sprintf("invalid operation: %T < %T", a, b))
 }
 
@@ -208,6 +238,11 @@ func More(a, b interface{}) bool {
 		case string:
 			return x > y
 		}
+	case []byte:
+		switch y := b.(type) {
+		case []byte:
+			return bytes.Compare(x, y) > 0
+		}
 	case time.Time:
 		switch y := b.(type) {
 		case time.Time:
@@ -219,6 +254,12 @@ func More(a, b interface{}) bool {
 			return x > y
 		}
 	}
+	if x, y, ok := underlyings(a, b); ok {
+		return More(x, y)
+	}
+	if x, y, ok := decimals(a, b); ok {
+		return x.Cmp(y) > 0
+	}
 	panic(fmt.Sprintf("invalid operation: %T > %T", a, b))
 }
 
@@ -230,6 +271,11 @@ func LessOrEqual(a, b interface{}) bool {
 		case string:
 			return x <= y
 		}
+	case []byte:
+		switch y := b.(type) {
+		case []byte:
+			return bytes.Compare(x, y) <= 0
+		}
 	case time.Time:
 		switch y := b.(type) {
 		case time.Time:
@@ -241,6 +287,12 @@ func LessOrEqual(a, b interface{}) bool {
 			return x <= y
 		}
 	}
+	if x, y, ok := underlyings(a, b); ok {
+		return LessOrEqual(x, y)
+	}
+	if x, y, ok := decimals(a, b); ok {
+		return x.Cmp(y) <= 0
+	}
 	panic(fmt.Sprintf("invalid operation: %T <= %T", a, b))
 }
 
@@ -252,6 +304,11 @@ func MoreOrEqual(a, b interface{}) bool {
 		case string:
 			return x >= y
 		}
+	case []byte:
+		switch y := b.(type) {
+		case []byte:
+			return bytes.Compare(x, y) >= 0
+		}
 	case time.Time:
 		switch y := b.(type) {
 		case time.Time:
@@ -263,6 +320,12 @@ func MoreOrEqual(a, b interface{}) bool {
 			return x >= y
 		}
 	}
+	if x, y, ok := underlyings(a, b); ok {
+		return MoreOrEqual(x, y)
+	}
+	if x, y, ok := decimals(a, b); ok {
+		return x.Cmp(y) >= 0
+	}
 	panic(fmt.Sprintf("invalid operation: %T >= %T", a, b))
 }
 
@@ -274,6 +337,11 @@ func Add(a, b interface{}) interface{} {
 		case string:
 			return x + y
 		}
+	case []byte:
+		switch y := b.(type) {
+		case []byte:
+			return append(x[:len(x):len(x)], y...)
+		}
 	case time.Time:
 		switch y := b.(type) {
 		case time.Duration:
@@ -287,6 +355,9 @@ func Add(a, b interface{}) interface{} {
 			return x + y
 		}
 	}
+	if x, y, ok := decimals(a, b); ok {
+		return new(big.Rat).Add(x, y)
+	}
 	panic(fmt.Sprintf("invalid operation: %T + %T", a, b))
 }
 
@@ -306,6 +377,9 @@ func Subtract(a, b interface{}) interface{} {
 			return x - y
 		}
 	}
+	if x, y, ok := decimals(a, b); ok {
+		return new(big.Rat).Sub(x, y)
+	}
 	panic(fmt.Sprintf("invalid operation: %T - %T", a, b))
 }
 
@@ -313,13 +387,19 @@ func Multiply(a, b interface{}) interface{} {
 	switch x := a.(type) {
 	{{ cases_with_duration "*" }}
 	}
+	if x, y, ok := decimals(a, b); ok {
+		return new(big.Rat).Mul(x, y)
+	}
 	panic(fmt.Sprintf("invalid operation: %T * %T", a, b))
 }
 
-func Divide(a, b interface{}) float64 {
+func Divide(a, b interface{}) interface{} {
 	switch x := a.(type) {
 	{{ cases "/" }}
 	}
+	if x, y, ok := decimals(a, b); ok {
+		return new(big.Rat).Quo(x, y)
+	}
 	panic(fmt.Sprintf("invalid operation: %T / %T", a, b))
 }
 
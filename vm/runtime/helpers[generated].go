@@ -3,12 +3,18 @@
 package runtime
 
 import (
+	"bytes"
 	"fmt"
+	"math/big"
 	"reflect"
 	"time"
 )
 
 func Equal(a, b interface{}) bool {
+	return equal(a, b, nil)
+}
+
+func equal(a, b interface{}, seen visits) bool {
 	switch x := a.(type) {
 	case uint:
 		switch y := b.(type) {
@@ -341,7 +347,7 @@ func Equal(a, b interface{}) bool {
 				return false
 			}
 			for i := range x {
-				if !Equal(x[i], y[i]) {
+				if !equal(x[i], y[i], seen) {
 					return false
 				}
 			}
@@ -351,7 +357,7 @@ func Equal(a, b interface{}) bool {
 				return false
 			}
 			for i := range x {
-				if !Equal(x[i], y[i]) {
+				if !equal(x[i], y[i], seen) {
 					return false
 				}
 			}
@@ -361,7 +367,7 @@ func Equal(a, b interface{}) bool {
 				return false
 			}
 			for i := range x {
-				if !Equal(x[i], y[i]) {
+				if !equal(x[i], y[i], seen) {
 					return false
 				}
 			}
@@ -371,7 +377,7 @@ func Equal(a, b interface{}) bool {
 				return false
 			}
 			for i := range x {
-				if !Equal(x[i], y[i]) {
+				if !equal(x[i], y[i], seen) {
 					return false
 				}
 			}
@@ -381,7 +387,7 @@ func Equal(a, b interface{}) bool {
 				return false
 			}
 			for i := range x {
-				if !Equal(x[i], y[i]) {
+				if !equal(x[i], y[i], seen) {
 					return false
 				}
 			}
@@ -391,7 +397,7 @@ func Equal(a, b interface{}) bool {
 				return false
 			}
 			for i := range x {
-				if !Equal(x[i], y[i]) {
+				if !equal(x[i], y[i], seen) {
 					return false
 				}
 			}
@@ -401,7 +407,7 @@ func Equal(a, b interface{}) bool {
 				return false
 			}
 			for i := range x {
-				if !Equal(x[i], y[i]) {
+				if !equal(x[i], y[i], seen) {
 					return false
 				}
 			}
@@ -411,7 +417,7 @@ func Equal(a, b interface{}) bool {
 				return false
 			}
 			for i := range x {
-				if !Equal(x[i], y[i]) {
+				if !equal(x[i], y[i], seen) {
 					return false
 				}
 			}
@@ -421,7 +427,7 @@ func Equal(a, b interface{}) bool {
 				return false
 			}
 			for i := range x {
-				if !Equal(x[i], y[i]) {
+				if !equal(x[i], y[i], seen) {
 					return false
 				}
 			}
@@ -431,7 +437,7 @@ func Equal(a, b interface{}) bool {
 				return false
 			}
 			for i := range x {
-				if !Equal(x[i], y[i]) {
+				if !equal(x[i], y[i], seen) {
 					return false
 				}
 			}
@@ -441,7 +447,7 @@ func Equal(a, b interface{}) bool {
 				return false
 			}
 			for i := range x {
-				if !Equal(x[i], y[i]) {
+				if !equal(x[i], y[i], seen) {
 					return false
 				}
 			}
@@ -451,7 +457,7 @@ func Equal(a, b interface{}) bool {
 				return false
 			}
 			for i := range x {
-				if !Equal(x[i], y[i]) {
+				if !equal(x[i], y[i], seen) {
 					return false
 				}
 			}
@@ -461,17 +467,21 @@ func Equal(a, b interface{}) bool {
 				return false
 			}
 			for i := range x {
-				if !Equal(x[i], y[i]) {
+				if !equal(x[i], y[i], seen) {
 					return false
 				}
 			}
 			return true
 		case []any:
+			var cycle bool
+			if seen, cycle = seen.enter(a, b); cycle {
+				return true
+			}
 			if len(x) != len(y) {
 				return false
 			}
 			for i := range x {
-				if !Equal(x[i], y[i]) {
+				if !equal(x[i], y[i], seen) {
 					return false
 				}
 			}
@@ -480,7 +490,7 @@ func Equal(a, b interface{}) bool {
 	case []string:
 		switch y := b.(type) {
 		case []any:
-			return Equal(y, x)
+			return equal(y, x, seen)
 		case []string:
 			if len(x) != len(y) {
 				return false
@@ -495,7 +505,7 @@ func Equal(a, b interface{}) bool {
 	case []uint:
 		switch y := b.(type) {
 		case []any:
-			return Equal(y, x)
+			return equal(y, x, seen)
 		case []uint:
 			if len(x) != len(y) {
 				return false
@@ -510,7 +520,7 @@ func Equal(a, b interface{}) bool {
 	case []uint8:
 		switch y := b.(type) {
 		case []any:
-			return Equal(y, x)
+			return equal(y, x, seen)
 		case []uint8:
 			if len(x) != len(y) {
 				return false
@@ -525,7 +535,7 @@ func Equal(a, b interface{}) bool {
 	case []uint16:
 		switch y := b.(type) {
 		case []any:
-			return Equal(y, x)
+			return equal(y, x, seen)
 		case []uint16:
 			if len(x) != len(y) {
 				return false
@@ -540,7 +550,7 @@ func Equal(a, b interface{}) bool {
 	case []uint32:
 		switch y := b.(type) {
 		case []any:
-			return Equal(y, x)
+			return equal(y, x, seen)
 		case []uint32:
 			if len(x) != len(y) {
 				return false
@@ -555,7 +565,7 @@ func Equal(a, b interface{}) bool {
 	case []uint64:
 		switch y := b.(type) {
 		case []any:
-			return Equal(y, x)
+			return equal(y, x, seen)
 		case []uint64:
 			if len(x) != len(y) {
 				return false
@@ -570,7 +580,7 @@ func Equal(a, b interface{}) bool {
 	case []int:
 		switch y := b.(type) {
 		case []any:
-			return Equal(y, x)
+			return equal(y, x, seen)
 		case []int:
 			if len(x) != len(y) {
 				return false
@@ -585,7 +595,7 @@ func Equal(a, b interface{}) bool {
 	case []int8:
 		switch y := b.(type) {
 		case []any:
-			return Equal(y, x)
+			return equal(y, x, seen)
 		case []int8:
 			if len(x) != len(y) {
 				return false
@@ -600,7 +610,7 @@ func Equal(a, b interface{}) bool {
 	case []int16:
 		switch y := b.(type) {
 		case []any:
-			return Equal(y, x)
+			return equal(y, x, seen)
 		case []int16:
 			if len(x) != len(y) {
 				return false
@@ -615,7 +625,7 @@ func Equal(a, b interface{}) bool {
 	case []int32:
 		switch y := b.(type) {
 		case []any:
-			return Equal(y, x)
+			return equal(y, x, seen)
 		case []int32:
 			if len(x) != len(y) {
 				return false
@@ -630,7 +640,7 @@ func Equal(a, b interface{}) bool {
 	case []int64:
 		switch y := b.(type) {
 		case []any:
-			return Equal(y, x)
+			return equal(y, x, seen)
 		case []int64:
 			if len(x) != len(y) {
 				return false
@@ -645,7 +655,7 @@ func Equal(a, b interface{}) bool {
 	case []float32:
 		switch y := b.(type) {
 		case []any:
-			return Equal(y, x)
+			return equal(y, x, seen)
 		case []float32:
 			if len(x) != len(y) {
 				return false
@@ -660,7 +670,7 @@ func Equal(a, b interface{}) bool {
 	case []float64:
 		switch y := b.(type) {
 		case []any:
-			return Equal(y, x)
+			return equal(y, x, seen)
 		case []float64:
 			if len(x) != len(y) {
 				return false
@@ -693,9 +703,18 @@ func Equal(a, b interface{}) bool {
 			return x == y
 		}
 	}
+	if x, y, ok := underlyings(a, b); ok {
+		return equal(x, y, seen)
+	}
+	if x, y, ok := decimals(a, b); ok {
+		return x.Cmp(y) == 0
+	}
 	if IsNil(a) && IsNil(b) {
 		return true
 	}
+	if equal, ok := equalElements(a, b, seen, equal); ok {
+		return equal
+	}
 	return reflect.DeepEqual(a, b)
 }
 
@@ -1030,6 +1049,11 @@ func Less(a, b interface{}) bool {
 		case string:
 			return x < y
 		}
+	case []byte:
+		switch y := b.(type) {
+		case []byte:
+			return bytes.Compare(x, y) < 0
+		}
 	case time.Time:
 		switch y := b.(type) {
 		case time.Time:
@@ -1041,6 +1065,12 @@ func Less(a, b interface{}) bool {
 			return x < y
 		}
 	}
+	if x, y, ok := underlyings(a, b); ok {
+		return Less(x, y)
+	}
+	if x, y, ok := decimals(a, b); ok {
+		return x.Cmp(y) < 0
+	}
 	panic(fmt.Sprintf("invalid operation: %T < %T", a, b))
 }
 
@@ -1375,6 +1405,11 @@ func More(a, b interface{}) bool {
 		case string:
 			return x > y
 		}
+	case []byte:
+		switch y := b.(type) {
+		case []byte:
+			return bytes.Compare(x, y) > 0
+		}
 	case time.Time:
 		switch y := b.(type) {
 		case time.Time:
@@ -1386,6 +1421,12 @@ func More(a, b interface{}) bool {
 			return x > y
 		}
 	}
+	if x, y, ok := underlyings(a, b); ok {
+		return More(x, y)
+	}
+	if x, y, ok := decimals(a, b); ok {
+		return x.Cmp(y) > 0
+	}
 	panic(fmt.Sprintf("invalid operation: %T > %T", a, b))
 }
 
@@ -1720,6 +1761,11 @@ func LessOrEqual(a, b interface{}) bool {
 		case string:
 			return x <= y
 		}
+	case []byte:
+		switch y := b.(type) {
+		case []byte:
+			return bytes.Compare(x, y) <= 0
+		}
 	case time.Time:
 		switch y := b.(type) {
 		case time.Time:
@@ -1731,6 +1777,12 @@ func LessOrEqual(a, b interface{}) bool {
 			return x <= y
 		}
 	}
+	if x, y, ok := underlyings(a, b); ok {
+		return LessOrEqual(x, y)
+	}
+	if x, y, ok := decimals(a, b); ok {
+		return x.Cmp(y) <= 0
+	}
 	panic(fmt.Sprintf("invalid operation: %T <= %T", a, b))
 }
 
@@ -2065,6 +2117,11 @@ func MoreOrEqual(a, b interface{}) bool {
 		case string:
 			return x >= y
 		}
+	case []byte:
+		switch y := b.(type) {
+		case []byte:
+			return bytes.Compare(x, y) >= 0
+		}
 	case time.Time:
 		switch y := b.(type) {
 		case time.Time:
@@ -2076,6 +2133,12 @@ func MoreOrEqual(a, b interface{}) bool {
 			return x >= y
 		}
 	}
+	if x, y, ok := underlyings(a, b); ok {
+		return MoreOrEqual(x, y)
+	}
+	if x, y, ok := decimals(a, b); ok {
+		return x.Cmp(y) >= 0
+	}
 	panic(fmt.Sprintf("invalid operation: %T >= %T", a, b))
 }
 
@@ -2410,6 +2473,11 @@ func Add(a, b interface{}) interface{} {
 		case string:
 			return x + y
 		}
+	case []byte:
+		switch y := b.(type) {
+		case []byte:
+			return append(x[:len(x):len(x)], y...)
+		}
 	case time.Time:
 		switch y := b.(type) {
 		case time.Duration:
@@ -2423,6 +2491,9 @@ func Add(a, b interface{}) interface{} {
 			return x + y
 		}
 	}
+	if x, y, ok := decimals(a, b); ok {
+		return new(big.Rat).Add(x, y)
+	}
 	panic(fmt.Sprintf("invalid operation: %T + %T", a, b))
 }
 
@@ -2765,6 +2836,9 @@ func Subtract(a, b interface{}) interface{} {
 			return x - y
 		}
 	}
+	if x, y, ok := decimals(a, b); ok {
+		return new(big.Rat).Sub(x, y)
+	}
 	panic(fmt.Sprintf("invalid operation: %T - %T", a, b))
 }
 
@@ -3148,10 +3222,13 @@ func Multiply(a, b interface{}) interface{} {
 			return time.Duration(x) * time.Duration(y)
 		}
 	}
+	if x, y, ok := decimals(a, b); ok {
+		return new(big.Rat).Mul(x, y)
+	}
 	panic(fmt.Sprintf("invalid operation: %T * %T", a, b))
 }
 
-func Divide(a, b interface{}) float64 {
+func Divide(a, b interface{}) interface{} {
 	switch x := a.(type) {
 	case uint:
 		switch y := b.(type) {
@@ -3478,6 +3555,9 @@ func Divide(a, b interface{}) float64 {
 			return float64(x) / float64(y)
 		}
 	}
+	if x, y, ok := decimals(a, b); ok {
+		return new(big.Rat).Quo(x, y)
+	}
 	panic(fmt.Sprintf("invalid operation: %T / %T", a, b))
 }
 
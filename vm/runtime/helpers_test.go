@@ -8,6 +8,12 @@ import (
 	"github.com/expr-lang/expr/vm/runtime"
 )
 
+type (
+	status string
+	role   string
+	level  int
+)
+
 var tests = []struct {
 	name string
 	a, b any
@@ -33,6 +39,21 @@ var tests = []struct {
 	{"deep []any != []any", []any{[]int{1}, 2, []any{"3", "42"}}, []any{[]any{1}, 2, []string{"3"}}, false},
 	{"map[string]any == map[string]any", map[string]any{"a": 1}, map[string]any{"a": 1}, true},
 	{"map[string]any != map[string]any", map[string]any{"a": 1}, map[string]any{"a": 1, "b": 2}, false},
+	{"[]int == []float64", []int{1, 2}, []float64{1, 2}, true},
+	{"[]int != []float64", []int{1, 2}, []float64{1, 2.5}, false},
+	{"[2]int == []any", [2]int{1, 2}, []any{1, 2.0}, true},
+	{"map[string]any == map[string]int", map[string]any{"a": 1.0}, map[string]int{"a": 1}, true},
+	{"map[string]any != map[string]int", map[string]any{"a": 1.0}, map[string]int{"b": 1}, false},
+	{"map[any]any == map[string]any", map[any]any{"a": 1}, map[string]any{"a": 1}, true},
+	{"map[any]any != map[string]any", map[any]any{1: 1}, map[string]any{"a": 1}, false},
+	{"deep map[string]any != map[string]any", map[string]any{"a": []any{1, map[string]any{"b": 2}}}, map[string]any{"a": []int{1}}, false},
+	{"map[string]any(nil) == map[string]any{}", map[string]any(nil), map[string]any{}, true},
+	{"[]any != map[string]any", []any{}, map[string]any{}, false},
+	{"status == string", status("a"), "a", true},
+	{"status == status", status("a"), status("a"), true},
+	{"status != role", status("a"), role("a"), false},
+	{"level == float", level(1), 1.0, true},
+	{"level != int8", level(1), int8(2), false},
 }
 
 func TestEqual(t *testing.T) {
@@ -47,6 +68,124 @@ func TestEqual(t *testing.T) {
 
 }
 
+func TestLess_named_types(t *testing.T) {
+	assert.True(t, runtime.Less(status("a"), "b"))
+	assert.True(t, runtime.Less(status("a"), status("b")))
+	assert.Panics(t, func() { runtime.Less(status("a"), role("b")) })
+}
+
+func TestEqualStrict(t *testing.T) {
+	type A struct{}
+	type B struct{}
+	var (
+		nilA     *A
+		nilB     *B
+		nilSlice []int
+		nilMap   map[string]int
+		nilFunc  func()
+		nilError error
+	)
+	nilTests := []struct {
+		name          string
+		a, b          any
+		loose, strict bool
+	}{
+		{"nil == nil", nil, nil, true, true},
+		{"nil == *A(nil)", nil, nilA, true, false},
+		{"*A(nil) == *A(nil)", nilA, nilA, true, true},
+		{"*A(nil) == *B(nil)", nilA, nilB, true, false},
+		{"*A(nil) == &A{}", nilA, &A{}, false, false},
+		{"nil == []int(nil)", nil, nilSlice, true, false},
+		{"[]int(nil) == []int(nil)", nilSlice, nilSlice, true, true},
+		{"[]int(nil) == []int{}", nilSlice, []int{}, true, false},
+		{"[]int(nil) == map(nil)", nilSlice, nilMap, true, false},
+		{"nil == map(nil)", nil, nilMap, true, false},
+		{"nil == func(nil)", nil, nilFunc, true, false},
+		{"nil == error(nil)", nil, nilError, true, true},
+		{"nil == 0", nil, 0, false, false},
+		{"nil == false", nil, false, false, false},
+		{"[]any{nil} == []any{*A(nil)}", []any{nil}, []any{nilA}, true, false},
+		{"[]any{*A(nil)} == []any{*A(nil)}", []any{nilA}, []any{nilA}, true, true},
+	}
+	for _, tt := range nilTests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.loose, runtime.Equal(tt.a, tt.b), "Equal")
+			assert.Equal(t, tt.loose, runtime.Equal(tt.b, tt.a), "Equal, swapped")
+			assert.Equal(t, tt.strict, runtime.EqualStrict(tt.a, tt.b), "EqualStrict")
+			assert.Equal(t, tt.strict, runtime.EqualStrict(tt.b, tt.a), "EqualStrict, swapped")
+		})
+	}
+
+	for _, tt := range tests {
+		if runtime.IsNil(tt.a) || runtime.IsNil(tt.b) {
+			continue // nil collections equal only nils
+		}
+		assert.Equal(t, tt.want, runtime.EqualStrict(tt.a, tt.b), tt.name)
+	}
+}
+
+func TestEqualDeep(t *testing.T) {
+	type Item struct {
+		Value any
+		Tags  []any
+	}
+	type Private struct {
+		value any
+	}
+	tests := []struct {
+		name string
+		a, b any
+		want bool
+	}{
+		{"struct", Item{1, []any{"a"}}, Item{1.0, []any{"a"}}, true},
+		{"struct !=", Item{1, []any{"a"}}, Item{1, []any{"b"}}, false},
+		{"pointers", &Item{Value: 1}, &Item{Value: 1.0}, true},
+		{"pointer and value", &Item{Value: 1}, Item{Value: 1.0}, true},
+		{"nested", []any{Item{Value: 1}}, []Item{{Value: 1.0}}, true},
+		{"unexported fields", Private{1}, Private{1.0}, false},
+		{"different types", Item{}, Private{}, false},
+		{"nils", (*Item)(nil), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, runtime.EqualDeep(tt.a, tt.b))
+			assert.Equal(t, tt.want, runtime.EqualDeep(tt.b, tt.a))
+		})
+	}
+}
+
+func TestEqual_cycles(t *testing.T) {
+	type Node struct {
+		Value any
+		Next  *Node
+	}
+	list := func(value any) []any {
+		l := []any{value, nil}
+		l[1] = l
+		return l
+	}
+	dict := func(value any) map[string]any {
+		m := map[string]any{"value": value}
+		m["self"] = m
+		return m
+	}
+	ring := func(value any) *Node {
+		n := &Node{Value: value}
+		n.Next = &Node{Value: value, Next: n}
+		return n
+	}
+
+	assert.True(t, runtime.Equal(list(1), list(1.0)))
+	assert.False(t, runtime.Equal(list(1), list(2)))
+	assert.True(t, runtime.Equal(dict(1), dict(1.0)))
+	assert.False(t, runtime.Equal(dict(1), dict(2)))
+	assert.True(t, runtime.EqualStrict(list(1), list(1)))
+	assert.False(t, runtime.EqualStrict(list(1), list(2)))
+	assert.True(t, runtime.EqualDeep(list(1), list(1.0)))
+	assert.True(t, runtime.EqualDeep(ring(1), ring(1.0)))
+	assert.False(t, runtime.EqualDeep(ring(1), ring(2)))
+}
+
 func BenchmarkEqual(b *testing.B) {
 	for _, tt := range tests {
 		b.Run(tt.name, func(b *testing.B) {
@@ -56,3 +195,34 @@ func BenchmarkEqual(b *testing.B) {
 		})
 	}
 }
+
+func TestCheckedInt(t *testing.T) {
+	const maxInt, minInt = int(^uint(0) >> 1), -int(^uint(0)>>1) - 1
+
+	tests := []struct {
+		name string
+		fn   func(x, y int) (int, bool)
+		x, y int
+		ok   bool
+	}{
+		{"add", runtime.AddInt, maxInt, 0, true},
+		{"add", runtime.AddInt, maxInt, 1, false},
+		{"add", runtime.AddInt, minInt, -1, false},
+		{"add", runtime.AddInt, minInt, maxInt, true},
+		{"subtract", runtime.SubtractInt, minInt, 1, false},
+		{"subtract", runtime.SubtractInt, 0, minInt, false},
+		{"subtract", runtime.SubtractInt, -1, minInt, true},
+		{"multiply", runtime.MultiplyInt, maxInt, 1, true},
+		{"multiply", runtime.MultiplyInt, maxInt, 2, false},
+		{"multiply", runtime.MultiplyInt, minInt, -1, false},
+		{"multiply", runtime.MultiplyInt, -1, minInt, false},
+		{"multiply", runtime.MultiplyInt, 1 << 20, -1 << 10, true},
+	}
+	for _, tt := range tests {
+		_, ok := tt.fn(tt.x, tt.y)
+		assert.Equal(t, tt.ok, ok, "%s(%d, %d)", tt.name, tt.x, tt.y)
+	}
+
+	_, ok := runtime.NegateInt(minInt)
+	assert.False(t, ok)
+}
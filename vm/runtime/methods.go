@@ -0,0 +1,105 @@
+package runtime
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// maxMethods is the most entries a Methods caches. Names fetched from maps
+// are keys, not methods, so they are not bounded by the types of the env.
+const maxMethods = 1 << 12
+
+// Methods caches the methods Fetch looks up by name, per type and name, so
+// values with methods are not probed with reflect.Type.MethodByName on every
+// access. Programs hold one, filled lazily by their runs. It is safe for
+// concurrent use; a nil *Methods looks the methods up without caching.
+// Types without methods are not cached, and neither are lookups past
+// maxMethods entries.
+type Methods struct {
+	cache sync.Map // methodKey -> methodEntry
+	size  int64    // number of entries in cache
+}
+
+type methodKey struct {
+	t    reflect.Type
+	name string
+}
+
+type methodEntry struct {
+	Method
+	ok bool // false if the type has no such method
+}
+
+// NewMethods returns an empty cache of methods.
+func NewMethods() *Methods {
+	return &Methods{}
+}
+
+// Fetch is like the Fetch function, with methods looked up in the cache.
+// Names of a FieldResolver are resolved, not looked up.
+func (m *Methods) Fetch(from, i any) any {
+	if r, ok := from.(FieldResolver); ok {
+		if name, ok := i.(string); ok {
+			value, _ := r.Resolve(name)
+			return value
+		}
+	}
+	v := reflect.ValueOf(from)
+	if v.Kind() == reflect.Invalid {
+		panic(fmt.Sprintf("cannot fetch %v from %T", i, from))
+	}
+	if name, ok := i.(string); ok {
+		if method, ok := m.lookup(v.Type(), name); ok {
+			if method.Pointer {
+				v = addressable(v)
+			}
+			return v.Method(method.Index).Interface()
+		}
+	}
+	return fetch(v, from, i)
+}
+
+// lookup returns the method of t with the name, also when it is defined
+// on *T and t is T.
+func (m *Methods) lookup(t reflect.Type, name string) (Method, bool) {
+	if !hasMethods(t) {
+		return Method{}, false
+	}
+	if m == nil {
+		entry := findMethod(t, name)
+		return entry.Method, entry.ok
+	}
+	key := methodKey{t, name}
+	if entry, ok := m.cache.Load(key); ok {
+		return entry.(methodEntry).Method, entry.(methodEntry).ok
+	}
+	entry := findMethod(t, name)
+	if atomic.LoadInt64(&m.size) < maxMethods {
+		if _, loaded := m.cache.LoadOrStore(key, entry); !loaded {
+			atomic.AddInt64(&m.size, 1)
+		}
+	}
+	return entry.Method, entry.ok
+}
+
+// hasMethods reports whether t, or *T if t is T, has methods.
+func hasMethods(t reflect.Type) bool {
+	if t.NumMethod() > 0 {
+		return true
+	}
+	return t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface && reflect.PtrTo(t).NumMethod() > 0
+}
+
+func findMethod(t reflect.Type, name string) methodEntry {
+	if method, ok := t.MethodByName(name); ok {
+		return methodEntry{Method{Index: method.Index, Name: name}, true}
+	}
+	if t.Kind() != reflect.Ptr && t.Kind() != reflect.Interface {
+		if method, ok := reflect.PtrTo(t).MethodByName(name); ok {
+			return methodEntry{Method{Index: method.Index, Name: name, Pointer: true}, true}
+		}
+	}
+	return methodEntry{}
+}
@@ -0,0 +1,77 @@
+package runtime_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+
+	"github.com/expr-lang/expr/vm/runtime"
+)
+
+type user struct {
+	Name string
+}
+
+func (u user) Greet() string   { return "hi " + u.Name }
+func (u *user) Rename() string { return "renamed " + u.Name }
+
+func TestMethods_Fetch(t *testing.T) {
+	methods := runtime.NewMethods()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, from := range []any{user{"bob"}, &user{"bob"}} {
+				assert.Equal(t, "hi bob", methods.Fetch(from, "Greet").(func() string)())
+				assert.Equal(t, "renamed bob", methods.Fetch(from, "Rename").(func() string)())
+				assert.Equal(t, "bob", methods.Fetch(from, "Name"))
+				assert.Equal(t, runtime.Fetch(from, "Name"), methods.Fetch(from, "Name"))
+			}
+			assert.Equal(t, 2, methods.Fetch([]int{1, 2}, 1))
+		}()
+	}
+	wg.Wait()
+
+	assert.PanicsWithValue(t, "cannot fetch Missing from runtime_test.user", func() {
+		methods.Fetch(user{}, "Missing")
+	})
+}
+
+type scores map[string]int
+
+func (s scores) Total() int { return len(s) }
+
+func TestMethods_Fetch_map_keys(t *testing.T) {
+	methods := runtime.NewMethods()
+	from := scores{}
+	for i := 0; i < 10000; i++ {
+		from[fmt.Sprintf("key%d", i)] = i
+	}
+	for i := 0; i < 10000; i++ {
+		assert.Equal(t, i, methods.Fetch(from, fmt.Sprintf("key%d", i)))
+	}
+	assert.Equal(t, 10000, methods.Fetch(from, "Total").(func() int)())
+	assert.Equal(t, 1, methods.Fetch(map[string]any{"a": 1}, "a"))
+}
+
+func BenchmarkFetch_methods(b *testing.B) {
+	from := user{"bob"}
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			runtime.Fetch(from, "Name")
+			runtime.Fetch(from, "Greet")
+			runtime.Fetch(from, "Rename")
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		methods := runtime.NewMethods()
+		for i := 0; i < b.N; i++ {
+			methods.Fetch(from, "Name")
+			methods.Fetch(from, "Greet")
+			methods.Fetch(from, "Rename")
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package runtime
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var basicTypes = map[reflect.Kind]reflect.Type{
+	reflect.Bool:    reflect.TypeOf(false),
+	reflect.Int:     reflect.TypeOf(0),
+	reflect.Int8:    reflect.TypeOf(int8(0)),
+	reflect.Int16:   reflect.TypeOf(int16(0)),
+	reflect.Int32:   reflect.TypeOf(int32(0)),
+	reflect.Int64:   reflect.TypeOf(int64(0)),
+	reflect.Uint:    reflect.TypeOf(uint(0)),
+	reflect.Uint8:   reflect.TypeOf(uint8(0)),
+	reflect.Uint16:  reflect.TypeOf(uint16(0)),
+	reflect.Uint32:  reflect.TypeOf(uint32(0)),
+	reflect.Uint64:  reflect.TypeOf(uint64(0)),
+	reflect.Float32: reflect.TypeOf(float32(0)),
+	reflect.Float64: reflect.TypeOf(float64(0)),
+	reflect.String:  reflect.TypeOf(""),
+}
+
+// underlying converts a value of a named basic type, like type Status
+// string, to its builtin type. time.Duration is kept, as it has its own
+// operators.
+func underlying(v any) (any, bool) {
+	if _, ok := v.(time.Duration); ok {
+		return v, false
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || rv.Type().PkgPath() == "" {
+		return v, false
+	}
+	t, ok := basicTypes[rv.Kind()]
+	if !ok {
+		return v, false
+	}
+	return rv.Convert(t).Interface(), true
+}
+
+// underlyings converts the operands of a comparison to their builtin types
+// if one of them is a named basic type, so Status == "active" compares
+// strings. Values of two different named types, like Status and Role, are
+// not converted, as they are not comparable in Go.
+func underlyings(a, b any) (any, any, bool) {
+	x, xok := underlying(a)
+	y, yok := underlying(b)
+	if !xok && !yok || xok && yok && reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return a, b, false
+	}
+	return x, y, true
+}
+
+// AsString returns the value of a string, or of a named string type.
+func AsString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.String {
+		return rv.String()
+	}
+	panic(fmt.Sprintf("interface conversion: interface {} is %T, not string", v))
+}
+
+// mapKey returns the value to look up a key in a map with keys of type t,
+// converting between named basic types and their builtin types.
+func mapKey(key any, t reflect.Type) reflect.Value {
+	if key == nil {
+		return reflect.Zero(t)
+	}
+	k := reflect.ValueOf(key)
+	if !k.Type().AssignableTo(t) && k.Kind() == t.Kind() && k.Type().ConvertibleTo(t) {
+		return k.Convert(t)
+	}
+	return k
+}
@@ -0,0 +1,101 @@
+package runtime
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/expr-lang/expr/internal/deref"
+	"github.com/expr-lang/expr/internal/embedded"
+)
+
+// FieldNames are how programs compiled with conf.Config.FieldTags or
+// conf.Config.CaseInsensitiveFields name the fields of values of types
+// unknown at compile time.
+type FieldNames struct {
+	// Tags name the fields of structs without an expr tag, in order,
+	// like json.
+	Tags []string
+	// CaseInsensitive finds fields of structs and string keys of maps
+	// whose names differ only by case, if there is no exact match.
+	CaseInsensitive bool
+}
+
+// Fetch is like Fetch, with fields found by their names.
+func (n *FieldNames) Fetch(methods *Methods, from, i any) any {
+	if value, ok := n.field(from, i); ok {
+		return value
+	}
+	return methods.Fetch(from, i)
+}
+
+// FetchSafe is like FetchSafe, with fields found by their names.
+func (n *FieldNames) FetchSafe(from, i any) any {
+	if value, ok := n.field(from, i); ok {
+		return value
+	}
+	return FetchSafe(from, i)
+}
+
+// field returns the field of the struct, or the value of the map, named i,
+// or false if there is no such field or key. It panics if several fields or
+// keys differ from i only by case.
+func (n *FieldNames) field(from, i any) (any, bool) {
+	name, ok := i.(string)
+	if !ok {
+		return nil, false
+	}
+	v := deref.Value(reflect.ValueOf(from))
+	switch v.Kind() {
+	case reflect.Struct:
+		fields := embedded.Fields(v.Type(), n.Tags...)
+		field, ok := fields[name]
+		if (!ok || field.PkgPath != "") && n.CaseInsensitive {
+			var names []string
+			for key, f := range fields {
+				if f.PkgPath == "" && strings.EqualFold(key, name) {
+					names = append(names, key)
+				}
+			}
+			name, ok = n.fold(name, names)
+			field = fields[name]
+		}
+		if !ok || field.PkgPath != "" {
+			return nil, false
+		}
+		return promotedField(v, field.Index, name).Interface(), true
+
+	case reflect.Map:
+		if !n.CaseInsensitive || v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		if value := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key())); value.IsValid() {
+			return value.Interface(), true
+		}
+		var names []string
+		values := map[string]reflect.Value{}
+		for iter := v.MapRange(); iter.Next(); {
+			if key := iter.Key().String(); strings.EqualFold(key, name) {
+				names = append(names, key)
+				values[key] = iter.Value()
+			}
+		}
+		if name, ok := n.fold(name, names); ok {
+			return values[name].Interface(), true
+		}
+	}
+	return nil, false
+}
+
+// fold returns the only one of names, which differ from name only by case.
+func (n *FieldNames) fold(name string, names []string) (string, bool) {
+	switch len(names) {
+	case 0:
+		return "", false
+	case 1:
+		return names[0], true
+	}
+	sort.Strings(names)
+	panic(fmt.Sprintf("name %v is ambiguous (%v)", name, strings.Join(names, ", ")))
+}
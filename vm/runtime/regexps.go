@@ -0,0 +1,164 @@
+package runtime
+
+import (
+	"container/list"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"sync"
+)
+
+// RegexLimits bounds the regular expressions of the matches operator and of
+// the regexp builtins, like replaceRegex, for example of untrusted
+// expressions. Zero values mean no limit.
+//
+// Go regexps run in time linear in the input, so there is no catastrophic
+// backtracking to guard against: what is costly are large patterns, like
+// nested counted repetitions (a{100}){100}, which compile to large programs,
+// and every match of a large program runs through all of the input.
+type RegexLimits struct {
+	MaxLength int // maximum length of a pattern, in bytes
+	// MaxSize is the maximum number of instructions of a compiled pattern,
+	// which rejects nested repetitions and other constructs expanding to
+	// large programs.
+	MaxSize int
+	// MaxSteps is the budget of a single match: the length of the input
+	// times the size of the pattern, which bounds the work of the match.
+	MaxSteps int
+	// CacheSize is the number of compiled patterns which are not constants
+	// kept for reuse, the least recently used are dropped first. Zero
+	// compiles the patterns on every match.
+	CacheSize int
+}
+
+// Regexps compiles and matches the patterns of the matches operator and of
+// the regexp builtins within the limits. It is safe for concurrent use.
+type Regexps struct {
+	RegexLimits
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	recent  list.List // of *Regexp, the most recently used first
+}
+
+// Regexp is a pattern compiled by Regexps. Its matches are within the
+// MaxSteps of the Regexps.
+type Regexp struct {
+	*regexp.Regexp
+	size     int // instructions of the compiled pattern
+	maxSteps int
+}
+
+// Budget returns an error if matching s exceeds MaxSteps.
+func (r *Regexp) Budget(s string) error {
+	if r.maxSteps > 0 && len(s)*r.size > r.maxSteps {
+		return fmt.Errorf("regexp match exceeds the budget of %d steps (%d bytes of input, %d instructions)", r.maxSteps, len(s), r.size)
+	}
+	return nil
+}
+
+// MatchString is like regexp.Regexp.MatchString. It panics if the match
+// exceeds MaxSteps.
+func (r *Regexp) MatchString(s string) bool {
+	if err := r.Budget(s); err != nil {
+		panic(err.Error())
+	}
+	return r.Regexp.MatchString(s)
+}
+
+// MaxSteps returns the budget of the matches of r.
+func (r *Regexp) MaxSteps() int {
+	return r.maxSteps
+}
+
+// NewRegexps returns Regexps with the limits and an empty cache.
+func NewRegexps(limits RegexLimits) *Regexps {
+	return &Regexps{RegexLimits: limits, entries: map[string]*list.Element{}}
+}
+
+func (r *Regexps) String() string {
+	return fmt.Sprintf("%+v", r.RegexLimits)
+}
+
+// Check validates the pattern against MaxLength and MaxSize, and returns
+// the size of its compiled program.
+func (r *Regexps) Check(pattern string) (int, error) {
+	if r.MaxLength > 0 && len(pattern) > r.MaxLength {
+		return 0, fmt.Errorf("regexp pattern is too long (%d > %d bytes)", len(pattern), r.MaxLength)
+	}
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return 0, err
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return 0, err
+	}
+	size := len(prog.Inst)
+	if r.MaxSize > 0 && size > r.MaxSize {
+		return 0, fmt.Errorf("regexp pattern is too complex (%d > %d instructions)", size, r.MaxSize)
+	}
+	return size, nil
+}
+
+// Compile checks the pattern against the limits and compiles it, without
+// caching it. Patterns known at compile time, like string literals, are
+// compiled with it once.
+func (r *Regexps) Compile(pattern string) (*Regexp, error) {
+	size, err := r.Check(pattern)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &Regexp{Regexp: re, size: size, maxSteps: r.MaxSteps}, nil
+}
+
+// MatchString reports whether s matches the pattern. It panics if the
+// pattern exceeds the limits or is invalid, or if the match exceeds
+// MaxSteps.
+func (r *Regexps) MatchString(pattern, s string) bool {
+	return r.Regexp(pattern).MatchString(s)
+}
+
+// Regexp returns the compiled pattern, from the cache if it is there. It
+// panics if the pattern exceeds the limits or is invalid.
+func (r *Regexps) Regexp(pattern string) *Regexp {
+	r.mu.Lock()
+	if e, ok := r.entries[pattern]; ok {
+		r.recent.MoveToFront(e)
+		r.mu.Unlock()
+		return e.Value.(*Regexp)
+	}
+	r.mu.Unlock()
+
+	c, err := r.Compile(pattern)
+	if err != nil {
+		panic(err)
+	}
+	if r.CacheSize <= 0 {
+		return c
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.entries == nil {
+		r.entries = map[string]*list.Element{}
+	}
+	if _, ok := r.entries[pattern]; !ok {
+		r.entries[pattern] = r.recent.PushFront(c)
+		for r.recent.Len() > r.CacheSize {
+			oldest := r.recent.Remove(r.recent.Back()).(*Regexp)
+			delete(r.entries, oldest.String())
+		}
+	}
+	return c
+}
+
+// Cached returns the number of compiled patterns in the cache.
+func (r *Regexps) Cached() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.recent.Len()
+}
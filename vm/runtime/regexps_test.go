@@ -0,0 +1,41 @@
+package runtime_test
+
+import (
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+	"github.com/expr-lang/expr/vm/runtime"
+)
+
+func TestRegexps_cache(t *testing.T) {
+	r := runtime.NewRegexps(runtime.RegexLimits{CacheSize: 2})
+
+	assert.True(t, r.MatchString("^a", "abc"))
+	assert.True(t, r.MatchString("b", "abc"))
+	assert.Equal(t, 2, r.Cached())
+
+	// The least recently used pattern, b, is dropped.
+	assert.True(t, r.MatchString("^a", "abc"))
+	assert.False(t, r.MatchString("d", "abc"))
+	assert.Equal(t, 2, r.Cached())
+
+	uncached := runtime.NewRegexps(runtime.RegexLimits{})
+	assert.True(t, uncached.MatchString("^a", "abc"))
+	assert.Equal(t, 0, uncached.Cached())
+}
+
+func TestRegexps_Check(t *testing.T) {
+	r := runtime.NewRegexps(runtime.RegexLimits{MaxSize: 50})
+
+	size, err := r.Check("^[a-z]+$")
+	require.NoError(t, err)
+	assert.Greater(t, size, 0)
+
+	_, err = r.Check("(x{10}){10}")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "regexp pattern is too complex")
+
+	_, err = r.Check("(")
+	require.Error(t, err)
+}
@@ -0,0 +1,31 @@
+package runtime
+
+import "reflect"
+
+// FieldResolver is an env which resolves its names lazily, one at a time,
+// when the expression reads them, instead of holding all the values up
+// front like a map. The values may be computed or fetched remotely.
+type FieldResolver interface {
+	// Resolve returns the value of the name, or false if it has none.
+	Resolve(name string) (any, bool)
+}
+
+// FieldTyper is implemented by a FieldResolver which knows its names and
+// their types, so the checker can check the expression against them. It
+// returns false for a name the resolver does not have, and a nil type for a
+// name of unknown type.
+type FieldTyper interface {
+	TypeOf(name string) (reflect.Type, bool)
+}
+
+// Resolve returns the value of the name from the env. The env is usually a
+// FieldResolver; names it does not have are nil, like missing keys of
+// maps. Other envs are fetched from.
+func Resolve(env any, name string) any {
+	r, ok := env.(FieldResolver)
+	if !ok {
+		return Fetch(env, name)
+	}
+	value, _ := r.Resolve(name)
+	return value
+}
@@ -5,9 +5,11 @@ package runtime
 import (
 	"fmt"
 	"math"
+	"math/big"
 	"reflect"
 
 	"github.com/expr-lang/expr/internal/deref"
+	"github.com/expr-lang/expr/internal/embedded"
 )
 
 // Fetch 从各种数据结构中提取元素或字段，支持以下数据类型：
@@ -15,22 +17,17 @@ import (
 //   - 映射（通过 key 访问）
 //   - 结构体（通过字段名访问）
 //   - 方法（通过方法名调用）
+//   - FieldResolver（通过 Resolve 按名解析）
+//
+// Methods are looked up by name on every call, see Methods.Fetch.
 func Fetch(from, i any) any {
-	v := reflect.ValueOf(from)
-	if v.Kind() == reflect.Invalid {
-		panic(fmt.Sprintf("cannot fetch %v from %T", i, from))
-	}
-
-	// Methods can be defined on any type.
-	if v.NumMethod() > 0 {
-		if methodName, ok := i.(string); ok {
-			method := v.MethodByName(methodName)
-			if method.IsValid() {
-				return method.Interface()
-			}
-		}
-	}
+	var methods *Methods
+	return methods.Fetch(from, i)
+}
 
+// fetch is Fetch of the value v of from, once it is known that from has no
+// method named i.
+func fetch(v reflect.Value, from, i any) any {
 	// Structs, maps, and slices can be access through a pointer or through
 	// a value, when they are accessed through a pointer we don't want to
 	// copy them to a value.
@@ -41,12 +38,12 @@ func Fetch(from, i any) any {
 	case reflect.Array, reflect.Slice, reflect.String:
 		index := ToInt(i)
 		l := v.Len()
+		if index < -l || index >= l {
+			panic(fmt.Sprintf("index out of range: %v (array length is %v)", index, l))
+		}
 		if index < 0 {
 			index = l + index
 		}
-		if index < 0 || index >= l {
-			panic(fmt.Sprintf("index out of range: %v (array length is %v)", index, l))
-		}
 		value := v.Index(index)
 		if value.IsValid() {
 			return value.Interface()
@@ -68,20 +65,114 @@ func Fetch(from, i any) any {
 
 	case reflect.Struct:
 		fieldName := i.(string)
-		value := v.FieldByNameFunc(func(name string) bool {
-			field, _ := v.Type().FieldByName(name)
-			if field.Tag.Get("expr") == fieldName {
-				return true
-			}
-			return name == fieldName
-		})
-		if value.IsValid() {
-			return value.Interface()
+		field, ok := embedded.Fields(v.Type())[fieldName]
+		if !ok {
+			field, ok = embedded.GoFields(v.Type())[fieldName]
+		}
+		if ok {
+			return promotedField(v, field.Index, fieldName).Interface()
 		}
 	}
 	panic(fmt.Sprintf("cannot fetch %v from %T", i, from))
 }
 
+// FetchSafe is like Fetch, but returns nil instead of panicking if from is
+// nil, the index is out of range, or there is no such field or key. It is
+// used by optional chains, like a?.[0] or a?.b[0], and by programs compiled
+// with conf.Config.NilOnMissing.
+func FetchSafe(from, i any) any {
+	v := deref.Value(reflect.ValueOf(from))
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+	case reflect.Array, reflect.Slice, reflect.String:
+		if isInteger(i) {
+			index := ToInt(i)
+			l := v.Len()
+			if index < 0 {
+				index = l + index
+			}
+			if index < 0 || index >= l {
+				return nil
+			}
+		}
+	case reflect.Map:
+		if i != nil && !reflect.TypeOf(i).AssignableTo(v.Type().Key()) {
+			return nil
+		}
+	case reflect.Struct:
+		if !hasField(v, i) && !hasMethod(from, i) {
+			return nil
+		}
+	default:
+		if !hasMethod(from, i) {
+			return nil
+		}
+	}
+	return Fetch(from, i)
+}
+
+// FetchIndexSafe is like Fetch, but returns nil instead of panicking if the
+// index of an array, a slice or a string is out of range. It is used by
+// programs compiled with conf.Config.NilOnOutOfRange.
+func FetchIndexSafe(from, i any) any {
+	v := deref.Value(reflect.ValueOf(from))
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice, reflect.String:
+		if isInteger(i) {
+			index := ToInt(i)
+			if index < -v.Len() || index >= v.Len() {
+				return nil
+			}
+		}
+	}
+	return Fetch(from, i)
+}
+
+func hasField(v reflect.Value, i any) bool {
+	name, ok := i.(string)
+	if !ok {
+		return false
+	}
+	t := v.Type()
+	_, ok = t.FieldByNameFunc(func(fieldName string) bool {
+		field, _ := t.FieldByName(fieldName)
+		return field.Tag.Get("expr") == name || fieldName == name
+	})
+	return ok
+}
+
+func hasMethod(from, i any) bool {
+	name, ok := i.(string)
+	return ok && reflect.ValueOf(from).MethodByName(name).IsValid()
+}
+
+// FetchFieldSafe is like FetchField, but returns nil if a pointer on the
+// path to the field is nil.
+func FetchFieldSafe(from any, field *Field) any {
+	v := reflect.ValueOf(from)
+	for _, x := range field.Index {
+		for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return nil
+		}
+		v = v.Field(x)
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
 type Field struct {
 	Index []int
 	Path  []string
@@ -128,6 +219,10 @@ func fieldByIndex(v reflect.Value, field *Field) reflect.Value {
 	if len(field.Index) == 1 {
 		return v.Field(field.Index[0])
 	}
+	if len(field.Index) != len(field.Path) {
+		// The path has a field promoted from embedded structs.
+		return promotedField(v, field.Index, field.Path[len(field.Path)-1])
+	}
 	for i, x := range field.Index {
 		if i > 0 {
 			if v.Kind() == reflect.Ptr {
@@ -142,15 +237,44 @@ func fieldByIndex(v reflect.Value, field *Field) reflect.Value {
 	return v
 }
 
+// promotedField gets a field by an index which goes through structs embedded
+// by pointers, like the index of a promoted field.
+func promotedField(v reflect.Value, index []int, name string) reflect.Value {
+	var embedded string
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				panic(fmt.Sprintf("cannot get %v from nil %v", name, embedded))
+			}
+			v = v.Elem()
+		}
+		embedded = v.Type().Field(x).Name
+		v = v.Field(x)
+	}
+	return v
+}
+
 type Method struct {
-	Index int
-	Name  string
+	Index   int
+	Name    string
+	Pointer bool // Method is defined on *T, Index is in the method set of *T.
+}
+
+// addressable returns a pointer to a copy of v, so methods with a pointer
+// receiver can be called on values which are not addressable.
+func addressable(v reflect.Value) reflect.Value {
+	p := reflect.New(v.Type())
+	p.Elem().Set(v)
+	return p
 }
 
 func FetchMethod(from any, method *Method) any {
 	v := reflect.ValueOf(from)
 	kind := v.Kind()
 	if kind != reflect.Invalid {
+		if method.Pointer && kind != reflect.Ptr {
+			v = addressable(v)
+		}
 		// Methods can be defined on any type, no need to dereference.
 		method := v.Method(method.Index)
 		if method.IsValid() {
@@ -228,9 +352,25 @@ func Slice(array, from, to any) any {
 //   - In(4, []int{1, 2, 3})           		// false
 //   - In(nil, []int{1, 2, 3})        	 	// false
 func In(needle any, array any) bool {
+	return in(needle, array, Equal)
+}
+
+// InStrict is like In, but compares the needle with the elements of arrays
+// like EqualStrict.
+func InStrict(needle any, array any) bool {
+	return in(needle, array, EqualStrict)
+}
+
+func in(needle any, array any, equal func(a, b any) bool) bool {
 	if array == nil {
 		return false
 	}
+	if r, ok := array.(FieldResolver); ok {
+		if name, ok := needle.(string); ok {
+			_, has := r.Resolve(name)
+			return has
+		}
+	}
 	v := reflect.ValueOf(array)
 
 	switch v.Kind() {
@@ -238,19 +378,14 @@ func In(needle any, array any) bool {
 		for i := 0; i < v.Len(); i++ {
 			value := v.Index(i)
 			if value.IsValid() {
-				if Equal(value.Interface(), needle) {
+				if equal(value.Interface(), needle) {
 					return true
 				}
 			}
 		}
 		return false
 	case reflect.Map:
-		var value reflect.Value
-		if needle == nil {
-			value = v.MapIndex(reflect.Zero(v.Type().Key()))
-		} else {
-			value = v.MapIndex(reflect.ValueOf(needle))
-		}
+		value := v.MapIndex(mapKey(needle, v.Type().Key()))
 		if value.IsValid() {
 			return true
 		}
@@ -268,7 +403,7 @@ func In(needle any, array any) bool {
 	case reflect.Ptr:
 		value := v.Elem()
 		if value.IsValid() {
-			return In(needle, value.Interface())
+			return in(needle, value.Interface(), equal)
 		}
 		return false
 	}
@@ -311,6 +446,10 @@ func Negate(i any) any {
 		return -v
 	case uint64:
 		return -v
+	case *big.Rat:
+		return new(big.Rat).Neg(v)
+	case big.Rat:
+		return new(big.Rat).Neg(&v)
 	default:
 		panic(fmt.Sprintf("invalid operation: - %T", v))
 	}
@@ -339,6 +478,14 @@ func MakeRange(min, max int) []int {
 	return rng
 }
 
+func isInteger(a any) bool {
+	switch a.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return true
+	}
+	return false
+}
+
 func ToInt(a any) int {
 	switch x := a.(type) {
 	case float32:
@@ -432,6 +579,201 @@ func ToFloat64(a any) float64 {
 	}
 }
 
+// EqualFloat is like Equal, but two floats are equal if they differ by at
+// most epsilon.
+func EqualFloat(a, b any, epsilon float64) bool {
+	x, xok := floatValue(a)
+	y, yok := floatValue(b)
+	if !xok || !yok {
+		return Equal(a, b)
+	}
+	return x == y || math.Abs(x-y) <= epsilon
+}
+
+// EqualStrict is like Equal, but nils are equal only to nils of the same
+// type, like Go compares interfaces: nil equals only nil, and a nil pointer
+// equals only a nil pointer of the same type. Elements of []any are
+// compared the same way.
+func EqualStrict(a, b any) bool {
+	return equalStrict(a, b, nil)
+}
+
+func equalStrict(a, b any, seen visits) bool {
+	aNil, bNil := IsNil(a), IsNil(b)
+	if aNil || bNil {
+		return aNil && bNil && reflect.TypeOf(a) == reflect.TypeOf(b)
+	}
+	if x, ok := a.([]any); ok {
+		if y, ok := b.([]any); ok {
+			var cycle bool
+			if seen, cycle = seen.enter(a, b); cycle {
+				return true
+			}
+			if len(x) != len(y) {
+				return false
+			}
+			for i := range x {
+				if !equalStrict(x[i], y[i], seen) {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return equal(a, b, seen)
+}
+
+// EqualDeep is like Equal, but also compares the values pointers point to,
+// and structs of the same type field by field, so fields of type any holding
+// 1 and 1.0 are equal. Structs with unexported fields, like time.Time, are
+// compared with Equal. It is the equalDeep builtin.
+func EqualDeep(a, b any) bool {
+	return equalDeep(a, b, nil)
+}
+
+func equalDeep(a, b any, seen visits) bool {
+	if equal, ok := equalElements(a, b, seen, equalDeep); ok {
+		return equal
+	}
+	var cycle bool
+	if seen, cycle = seen.enter(a, b); cycle {
+		return true
+	}
+	x, y := deref.Value(reflect.ValueOf(a)), deref.Value(reflect.ValueOf(b))
+	if x.Kind() != reflect.Struct || y.Kind() != reflect.Struct || x.Type() != y.Type() || !exported(x.Type()) {
+		return equal(a, b, seen)
+	}
+	for i := 0; i < x.NumField(); i++ {
+		if !equalDeep(x.Field(i).Interface(), y.Field(i).Interface(), seen) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalElements compares arrays and slices, or maps, element by element with
+// eq, so [1, 2] equals [1.0, 2.0] and {"a": 1} equals {"a": 1.0} whatever
+// their Go types. The same slice or map equals itself, even if it holds
+// values which are not equal to themselves, like functions. The second result
+// is false if a and b are not both arrays or slices, or both maps.
+func equalElements(a, b any, seen visits, eq func(a, b any, seen visits) bool) (equal, ok bool) {
+	x, y := reflect.ValueOf(a), reflect.ValueOf(b)
+	if (x.Kind() == reflect.Slice || x.Kind() == reflect.Map) && y.IsValid() {
+		if x.Type() == y.Type() && x.Len() == y.Len() && x.Pointer() == y.Pointer() {
+			return true, true
+		}
+	}
+	if (isList(x) && isList(y)) || (x.Kind() == reflect.Map && y.Kind() == reflect.Map) {
+		var cycle bool
+		if seen, cycle = seen.enter(a, b); cycle {
+			return true, true
+		}
+	}
+	switch {
+	case isList(x) && isList(y):
+		if x.Len() != y.Len() {
+			return false, true
+		}
+		for i := 0; i < x.Len(); i++ {
+			if !eq(x.Index(i).Interface(), y.Index(i).Interface(), seen) {
+				return false, true
+			}
+		}
+		return true, true
+
+	case x.Kind() == reflect.Map && y.Kind() == reflect.Map:
+		if x.Len() != y.Len() {
+			return false, true
+		}
+		for iter := x.MapRange(); iter.Next(); {
+			key := iter.Key()
+			if key.Kind() == reflect.Interface {
+				key = key.Elem()
+			}
+			if !key.IsValid() || !key.Type().AssignableTo(y.Type().Key()) {
+				return false, true
+			}
+			value := y.MapIndex(key)
+			if !value.IsValid() || !eq(iter.Value().Interface(), value.Interface(), seen) {
+				return false, true
+			}
+		}
+		return true, true
+	}
+	return false, false
+}
+
+// visit is a pair of slices, maps or pointers being compared.
+type visit struct {
+	x, y   uintptr
+	xt, yt reflect.Type
+}
+
+// visits are the pairs of slices, maps and pointers being compared, so
+// comparing cyclic values stops, like reflect.DeepEqual does.
+type visits map[visit]bool
+
+// enter records a and b, if both are non-empty slices or maps, or non-nil
+// pointers, allocating seen on first use. It reports whether they were
+// already recorded: they are being compared further up, so they are
+// considered equal here.
+func (seen visits) enter(a, b any) (visits, bool) {
+	x, y := reflect.ValueOf(a), reflect.ValueOf(b)
+	if !reference(x) || !reference(y) {
+		return seen, false
+	}
+	v := visit{x.Pointer(), y.Pointer(), x.Type(), y.Type()}
+	if seen[v] {
+		return seen, true
+	}
+	if seen == nil {
+		seen = visits{}
+	}
+	seen[v] = true
+	return seen, false
+}
+
+// reference reports whether v is a non-empty slice or map, or a non-nil
+// pointer, which can refer back to itself.
+func reference(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() > 0
+	case reflect.Ptr:
+		return !v.IsNil()
+	}
+	return false
+}
+
+func isList(v reflect.Value) bool {
+	return v.Kind() == reflect.Slice || v.Kind() == reflect.Array
+}
+
+// exported reports whether all the fields of struct t are exported.
+func exported(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func floatValue(v any) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
 func IsNil(v any) bool {
 	if v == nil {
 		return true
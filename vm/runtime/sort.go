@@ -1,11 +1,49 @@
 package runtime
 
+import (
+	"fmt"
+	"reflect"
+)
+
+// SortBy sorts Array by Values, the keys of its elements. Keys which are
+// arrays, like [.LastName, .FirstName], are compared by their items in
+// order, each in the order of Orders, or of Desc if Orders is shorter.
 type SortBy struct {
 	Desc   bool
+	Orders []bool // Desc of each item of array keys
 	Array  []any
 	Values []any
 }
 
+// NewSortBy returns a SortBy for size elements in the order, "asc" or
+// "desc", or an array of them for keys which are arrays. It panics on
+// other orders.
+func NewSortBy(order any, size int) *SortBy {
+	s := &SortBy{
+		Array:  make([]any, 0, size),
+		Values: make([]any, 0, size),
+	}
+	if orders, ok := order.([]any); ok {
+		s.Orders = make([]bool, len(orders))
+		for i, order := range orders {
+			s.Orders[i] = descending(order)
+		}
+	} else {
+		s.Desc = descending(order)
+	}
+	return s
+}
+
+func descending(order any) bool {
+	switch order {
+	case "asc":
+		return false
+	case "desc":
+		return true
+	}
+	panic("unknown order, use asc or desc")
+}
+
 func (s *SortBy) Len() int {
 	return len(s.Array)
 }
@@ -17,12 +55,37 @@ func (s *SortBy) Swap(i, j int) {
 
 func (s *SortBy) Less(i, j int) bool {
 	a, b := s.Values[i], s.Values[j]
+	if x, ok := a.([]any); ok {
+		if y, ok := b.([]any); ok {
+			return s.lessKeys(x, y)
+		}
+	}
 	if s.Desc {
 		return Less(b, a)
 	}
 	return Less(a, b)
 }
 
+// lessKeys compares keys which are arrays by their first different items.
+func (s *SortBy) lessKeys(x, y []any) bool {
+	if len(s.Orders) > 0 && (len(x) != len(s.Orders) || len(y) != len(s.Orders)) {
+		panic(fmt.Sprintf("invalid number of orders (expected %d, got %d)", len(x), len(s.Orders)))
+	}
+	for i := 0; i < len(x) && i < len(y); i++ {
+		a, b := x[i], y[i]
+		if i < len(s.Orders) && s.Orders[i] || i >= len(s.Orders) && s.Desc {
+			a, b = b, a
+		}
+		if Less(a, b) {
+			return true
+		}
+		if Less(b, a) {
+			return false
+		}
+	}
+	return len(x) < len(y)
+}
+
 type Sort struct {
 	Desc  bool
 	Array []any
@@ -43,3 +106,92 @@ func (s *Sort) Less(i, j int) bool {
 	}
 	return Less(a, b)
 }
+
+// SortFunc sorts Array by a comparator, like sort(users, (a, b) => a.Age -
+// b.Age). The VM calls the comparator for every pair of elements Next
+// returns, and gives its result to Result. It is a stable bottom-up merge
+// sort, which stops at each comparison.
+type SortFunc struct {
+	Compare any   // the comparator, called with two elements
+	Array   []any // runs of width sorted elements
+	merged  []any
+	width   int
+	// The runs being merged are Array[left:mid] and Array[right:end].
+	left, mid, right, end int
+}
+
+// NewSortFunc returns a SortFunc for a copy of the array. It panics if
+// array is not an array.
+func NewSortFunc(array, compare any) *SortFunc {
+	v := reflect.ValueOf(array)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		panic(fmt.Sprintf("cannot sort %s", v.Kind()))
+	}
+	s := &SortFunc{
+		Compare: compare,
+		Array:   make([]any, v.Len()),
+		merged:  make([]any, 0, v.Len()),
+		width:   1,
+	}
+	for i := range s.Array {
+		s.Array[i] = v.Index(i).Interface()
+	}
+	s.runs(0)
+	return s
+}
+
+// Next returns the next pair of elements to compare, or false once Array
+// is sorted.
+func (s *SortFunc) Next() (a, b any, ok bool) {
+	for s.width < len(s.Array) {
+		if s.left < s.mid && s.right < s.end {
+			return s.Array[s.left], s.Array[s.right], true
+		}
+		s.merged = append(s.merged, s.Array[s.left:s.mid]...)
+		s.merged = append(s.merged, s.Array[s.right:s.end]...)
+		if s.end < len(s.Array) {
+			s.runs(s.end)
+			continue
+		}
+		s.Array, s.merged = s.merged, s.Array[:0]
+		s.width *= 2
+		s.runs(0)
+	}
+	return nil, nil, false
+}
+
+// Result takes the result of the comparator for the pair Next returned: a
+// number, which is positive if the first element sorts after the second.
+func (s *SortFunc) Result(result any) {
+	v := reflect.ValueOf(result)
+	var after bool
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		after = v.Int() > 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		after = v.Uint() > 0
+	case reflect.Float32, reflect.Float64:
+		after = v.Float() > 0
+	default:
+		panic(fmt.Sprintf("comparator should return number (got %T)", result))
+	}
+	if after {
+		s.merged = append(s.merged, s.Array[s.right])
+		s.right++
+	} else {
+		s.merged = append(s.merged, s.Array[s.left])
+		s.left++
+	}
+}
+
+// runs selects the runs of width elements from start.
+func (s *SortFunc) runs(start int) {
+	s.left, s.mid = start, start+s.width
+	if s.mid > len(s.Array) {
+		s.mid = len(s.Array)
+	}
+	s.right, s.end = s.mid, s.mid+s.width
+	if s.end > len(s.Array) {
+		s.end = len(s.Array)
+	}
+}
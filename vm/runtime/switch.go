@@ -0,0 +1,7 @@
+package runtime
+
+// Switch is the jump table of a chain of conditionals which compare a
+// value with int or string constants. It maps every constant to the offset
+// of its branch from the instruction after the jump; values which are not
+// in the table run the default branch, right after the jump.
+type Switch map[any]int
@@ -0,0 +1,116 @@
+package vm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/expr-lang/expr/vm/runtime"
+)
+
+// Snapshot is a record of a run of a program: the values it read from the
+// env and its result. A snapshot taken in production can be replayed later
+// with Replay, without the env, to find out why the program returned what
+// it did.
+//
+// Values are not copied, so a sink should encode a snapshot before the env
+// changes.
+type Snapshot struct {
+	Program string         `json:"program"`          // Hash of the program, see Program.Hash.
+	Env     map[string]any `json:"env"`              // Values read from the env, by their paths, like "user.Name".
+	Output  any            `json:"output,omitempty"` // Result of the run.
+	Error   string         `json:"error,omitempty"`  // Error of the run.
+}
+
+// Hash returns a hash of the source and the bytecode of the program, which
+// identifies the program a snapshot was taken of.
+func (program *Program) Hash() string {
+	h := sha256.New()
+	_, _ = h.Write([]byte(program.source.String()))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(program.Disassemble()))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Replay runs the program like it ran when the snapshot was taken: values
+// of the env are taken from the snapshot. Functions are called again, so
+// functions which do not always return the same result, like now, can
+// change the result. Methods of the env can not be replayed.
+func Replay(program *Program, snapshot *Snapshot) (any, error) {
+	if program == nil {
+		return nil, fmt.Errorf("program is nil")
+	}
+	vm := VM{}
+	return vm.Replay(program, snapshot)
+}
+
+// Replay runs the program with the values of the env of the snapshot. See
+// Replay.
+func (vm *VM) Replay(program *Program, snapshot *Snapshot) (any, error) {
+	if snapshot.Program != vm.hash(program) {
+		return nil, fmt.Errorf("snapshot was taken of another program")
+	}
+	vm.tape = snapshot
+	vm.replaying = true
+	defer func() {
+		vm.tape = nil
+		vm.replaying = false
+	}()
+	return vm.Run(program, nil)
+}
+
+// hash returns the hash of the program, which is kept for the next runs
+// of the same program.
+func (vm *VM) hash(program *Program) string {
+	if vm.hashed != program {
+		vm.hashed = program
+		vm.programHash = program.Hash()
+	}
+	return vm.programHash
+}
+
+// load reads a value of the env while a snapshot is taken or replayed.
+func (vm *VM) load(program *Program, env any, op Opcode, arg int) any {
+	var key string
+	switch op {
+	case OpLoadConst:
+		key = fmt.Sprint(program.Constants[arg])
+	case OpLoadFast, OpLoadDynamic:
+		key = program.Constants[arg].(string)
+	case OpLoadField:
+		key = strings.Join(program.Constants[arg].(*runtime.Field).Path, ".")
+	case OpLoadEnv:
+		key = "$env"
+	case OpLoadMethod:
+		method := program.Constants[arg].(*runtime.Method)
+		if vm.replaying {
+			panic(fmt.Sprintf("cannot replay method %v of the env", method.Name))
+		}
+		return runtime.FetchMethod(env, method)
+	}
+
+	if vm.replaying {
+		value, ok := vm.tape.Env[key]
+		if !ok {
+			panic(fmt.Sprintf("snapshot has no value of %v", key))
+		}
+		return value
+	}
+
+	var value any
+	switch op {
+	case OpLoadConst:
+		value = runtime.Fetch(env, program.Constants[arg])
+	case OpLoadFast:
+		value = env.(map[string]any)[key]
+	case OpLoadField:
+		value = runtime.FetchField(env, program.Constants[arg].(*runtime.Field))
+	case OpLoadDynamic:
+		value = vm.resolve(env, key)
+	case OpLoadEnv:
+		value = env
+	}
+	vm.tape.Env[key] = value
+	return value
+}
@@ -0,0 +1,107 @@
+package vm_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/expr-lang/expr/internal/testify/assert"
+	"github.com/expr-lang/expr/internal/testify/require"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+type snapshotUser struct {
+	Name string
+	Age  int
+}
+
+type snapshotEnv struct {
+	User  snapshotUser
+	Limit int
+}
+
+func TestVM_Snapshots(t *testing.T) {
+	env := snapshotEnv{User: snapshotUser{Name: "alice", Age: 30}, Limit: 18}
+	program, err := expr.Compile(`User.Age > Limit ? User.Name : "none"`, expr.Env(env))
+	require.NoError(t, err)
+
+	var snapshots []*vm.Snapshot
+	v := vm.VM{Snapshots: func(s *vm.Snapshot) {
+		snapshots = append(snapshots, s)
+	}}
+	out, err := v.Run(program, env)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", out)
+
+	require.Len(t, snapshots, 1)
+	s := snapshots[0]
+	assert.Equal(t, program.Hash(), s.Program)
+	assert.Equal(t, map[string]any{"User.Age": 30, "Limit": 18, "User.Name": "alice"}, s.Env)
+	assert.Equal(t, "alice", s.Output)
+	assert.Empty(t, s.Error)
+
+	out, err = expr.Replay(program, s)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", out)
+
+	delete(s.Env, "Limit")
+	out, err = expr.Replay(program, s)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "snapshot has no value of Limit")
+	assert.Nil(t, out)
+}
+
+func TestVM_Snapshots_json(t *testing.T) {
+	env := map[string]any{"items": []any{1, 2, 3}, "min": 2}
+	program, err := expr.Compile(`filter(items, # >= min)`, expr.Env(env))
+	require.NoError(t, err)
+
+	var data []byte
+	v := vm.VM{Snapshots: func(s *vm.Snapshot) {
+		data, err = json.Marshal(s)
+		require.NoError(t, err)
+	}}
+	_, err = v.Run(program, env)
+	require.NoError(t, err)
+
+	var s vm.Snapshot
+	require.NoError(t, json.Unmarshal(data, &s))
+	out, err := vm.Replay(program, &s)
+	require.NoError(t, err)
+	assert.Equal(t, []any{float64(2), float64(3)}, out)
+}
+
+func TestVM_Snapshots_error(t *testing.T) {
+	program, err := expr.Compile(`1 / n > 0`, expr.Env(map[string]any{"n": 0}))
+	require.NoError(t, err)
+
+	var s *vm.Snapshot
+	v := vm.VM{Snapshots: func(snapshot *vm.Snapshot) {
+		s = snapshot
+	}}
+	_, err = v.Run(program, map[string]any{"n": "x"})
+	require.Error(t, err)
+	require.NotNil(t, s)
+	assert.Equal(t, err.Error(), s.Error)
+	assert.Equal(t, map[string]any{"n": "x"}, s.Env)
+
+	_, err = vm.Replay(program, s)
+	require.Error(t, err)
+	assert.Equal(t, s.Error, err.Error())
+}
+
+func TestReplay_another_program(t *testing.T) {
+	program, err := expr.Compile(`a + 1`, expr.Env(map[string]any{"a": 1}))
+	require.NoError(t, err)
+	other, err := expr.Compile(`a + 2`, expr.Env(map[string]any{"a": 1}))
+	require.NoError(t, err)
+
+	s := &vm.Snapshot{Program: program.Hash(), Env: map[string]any{"a": 1}}
+	out, err := vm.Replay(program, s)
+	require.NoError(t, err)
+	assert.Equal(t, 2, out)
+
+	_, err = vm.Replay(other, s)
+	require.EqualError(t, err, "snapshot was taken of another program")
+}
@@ -2,7 +2,8 @@ package vm
 
 import (
 	"reflect"
-	"time"
+
+	"github.com/expr-lang/expr/vm/runtime"
 )
 
 type (
@@ -14,24 +15,57 @@ var (
 	errorType = reflect.TypeOf((*error)(nil)).Elem()
 )
 
+// param returns the argument of a parameter of type T of a typed function,
+// the zero value of T for nil, like runtime.ParamValue.
+func param[T any](arg any) T {
+	if arg == nil {
+		var zero T
+		return zero
+	}
+	return arg.(T)
+}
+
 type Scope struct {
 	Array reflect.Value
 	Index int
 	Len   int
 	Count int
 	Acc   any
+	begin int // address of OpBegin, which names the builtin of the loop
+}
+
+// scopeDepth returns the maximum number of loops nested in the bytecode,
+// which is the number of scopes the VM preallocates for the program.
+func scopeDepth(bytecode []Opcode) int {
+	depth, max := 0, 0
+	for _, op := range bytecode {
+		switch op {
+		case OpBegin:
+			depth++
+			if depth > max {
+				max = depth
+			}
+		case OpEnd:
+			depth--
+		}
+	}
+	return max
 }
 
 type groupBy = map[any][]any
 
-type Span struct {
-	Name       string  `json:"name"`
-	Expression string  `json:"expression"`
-	Duration   int64   `json:"duration"`
-	Children   []*Span `json:"children"`
-	start      time.Time
+// uniqBy holds the keys seen by uniqBy. Keys are compared with
+// runtime.Equal, like the elements in uniq.
+type uniqBy struct {
+	keys []any
 }
 
-func GetSpan(program *Program) *Span {
-	return program.span
+func (u *uniqBy) add(key any) bool {
+	for _, k := range u.keys {
+		if runtime.Equal(k, key) {
+			return false
+		}
+	}
+	u.keys = append(u.keys, key)
+	return true
 }
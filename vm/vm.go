@@ -3,6 +3,7 @@ package vm
 //go:generate sh -c "go run ./func_types > ./func_types[generated].go"
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"regexp"
@@ -25,6 +26,21 @@ func Run(program *Program, env any) (any, error) {
 	return vm.Run(program, env)
 }
 
+// RunContext runs the program like Run, but aborts with ctx.Err() once the
+// context is canceled or its deadline is exceeded. The context is checked
+// every ContextCheckInterval instructions.
+func RunContext(ctx context.Context, program *Program, env any) (any, error) {
+	if program == nil {
+		return nil, fmt.Errorf("program is nil")
+	}
+	vm := VM{}
+	return vm.RunContext(ctx, program, env)
+}
+
+// ContextCheckInterval is the number of instructions executed between two
+// checks of the context passed to RunContext.
+const ContextCheckInterval = 1024
+
 func Debug() *VM {
 	vm := &VM{
 		debug: true,
@@ -39,8 +55,24 @@ type VM struct {
 	Scopes       []*Scope
 	Variables    []any
 	MemoryBudget uint
+	OpsBudget    uint            // maximum number of executed opcodes, 0 means unlimited
+	MaxScopes    uint            // maximum number of nested loops of builtins, conf.Config.MaxScopes if 0
+	Logger       conf.Logger     // traces executed opcodes at conf.LevelDebug, conf.Config.Logger if nil
+	Snapshots    func(*Snapshot) // receives a snapshot of every run, see Snapshot
 	ip           int
 	memory       uint
+	ops          uint
+	frames       []frame
+	arena        []Scope        // preallocated scopes of the loops, reused by every run
+	tape         *Snapshot      // snapshot being taken or replayed
+	resolved     map[string]any // names of a FieldResolver env resolved by the run
+	replaying    bool
+	hashed       *Program             // program of programHash
+	profiled     *Program             // program of spans
+	spans        map[*Span]*spanStats // counters of the spans of the last run
+	programHash  string
+	debugger     *Debugger // pauses the run, see NewDebugger
+	ctx          context.Context
 	debug        bool
 	step         chan struct{}
 	curr         chan int
@@ -59,6 +91,27 @@ type VM struct {
 //}
 
 func (vm *VM) Run(program *Program, env any) (_ any, err error) {
+	return vm.RunContext(context.Background(), program, env)
+}
+
+// RunContext runs the program, aborting once ctx is done. See RunContext.
+func (vm *VM) RunContext(ctx context.Context, program *Program, env any) (out any, err error) {
+	if vm.Snapshots != nil && !vm.replaying {
+		tape := &Snapshot{
+			Program: vm.hash(program),
+			Env:     map[string]any{},
+		}
+		vm.tape = tape
+		defer func() {
+			vm.tape = nil
+			tape.Output = out
+			if err != nil {
+				tape.Error = err.Error()
+			}
+			vm.Snapshots(tape)
+		}()
+	}
+
 	defer func() {
 		if r := recover(); r != nil {
 			var location file.Location
@@ -69,6 +122,9 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 				Location: location,
 				Message:  fmt.Sprintf("%v", r),
 			}
+			if expr, ok := program.debugInfo[fmt.Sprintf("expr_%d", vm.ip-1)]; ok {
+				f.Message = fmt.Sprintf("%v in %v", f.Message, expr)
+			}
 			if err, ok := r.(error); ok {
 				f.Wrap(err)
 			}
@@ -81,25 +137,78 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 	} else {
 		vm.Stack = vm.Stack[0:0]
 	}
-	if vm.Scopes != nil {
+	if cap(vm.Scopes) < program.scopes {
+		vm.Scopes = make([]*Scope, 0, program.scopes)
+	} else if vm.Scopes != nil {
 		vm.Scopes = vm.Scopes[0:0]
 	}
+	if len(vm.arena) < program.scopes {
+		vm.arena = make([]Scope, program.scopes)
+	}
+	vm.frames = vm.frames[0:0]
+	for name := range vm.resolved {
+		delete(vm.resolved, name)
+	}
 	if len(vm.Variables) < program.variables {
 		vm.Variables = make([]any, program.variables)
 	}
+	maxScopes := vm.MaxScopes
+	if maxScopes == 0 {
+		maxScopes = program.maxScopes
+	}
 	if vm.MemoryBudget == 0 {
 		vm.MemoryBudget = conf.DefaultMemoryBudget
 	}
 	vm.memory = 0
+	vm.ops = 0
 	vm.ip = 0
+	vm.ctx = ctx
+	vm.profiled, vm.spans = nil, nil
+	if program.span != nil {
+		vm.profiled = program
+		vm.spans = make(map[*Span]*spanStats)
+		defer program.totals.add(vm.spans)
+	}
+
+	logger := vm.Logger
+	if logger == nil {
+		logger = program.logger
+	}
+	trace := logger != nil && logger.Enabled(conf.LogVM, conf.LevelDebug)
+	done := ctx.Done()
+	ticks := 0
 
 	for vm.ip < len(program.Bytecode) {
+		if done != nil {
+			if ticks++; ticks == ContextCheckInterval {
+				ticks = 0
+				select {
+				case <-done:
+					panic(ctx.Err())
+				default:
+				}
+			}
+		}
+
 		if debug && vm.debug {
 			<-vm.step
 		}
+		if vm.debugger != nil {
+			vm.debugger.before(vm)
+		}
+
+		if vm.OpsBudget > 0 {
+			vm.ops++
+			if vm.ops > vm.OpsBudget {
+				panic("ops budget exceeded")
+			}
+		}
 
 		op := program.Bytecode[vm.ip]
 		arg := program.Arguments[vm.ip]
+		if trace {
+			logger.Logf(conf.LogVM, conf.LevelDebug, "%d\t%v\t%d\tstack=%d", vm.ip, op, arg, len(vm.Stack))
+		}
 		vm.ip += 1
 
 		switch op {
@@ -121,17 +230,39 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 			// 把变量 vars[arg] 入栈
 			vm.push(vm.Variables[arg])
 		case OpLoadConst:
+			if vm.tape != nil {
+				vm.push(vm.load(program, env, op, arg))
+				break
+			}
 			// 从 env 中获取第 arg 个常量的值
-			vm.push(runtime.Fetch(env, program.Constants[arg]))
+			vm.push(program.methods.Fetch(env, program.Constants[arg]))
 		case OpLoadField:
+			if vm.tape != nil {
+				vm.push(vm.load(program, env, op, arg))
+				break
+			}
 			// 从 env 中获取第 arg 个常量所表示的嵌套字段的值
 			vm.push(runtime.FetchField(env, program.Constants[arg].(*runtime.Field)))
 		case OpLoadFast:
+			if vm.tape != nil {
+				vm.push(vm.load(program, env, op, arg))
+				break
+			}
 			// 从 env 中获取第 arg 个常量的值，这里常量是字符串类型
 			vm.push(env.(map[string]any)[program.Constants[arg].(string)])
 		case OpLoadMethod:
+			if vm.tape != nil {
+				vm.push(vm.load(program, env, op, arg))
+				break
+			}
 			// 从 env 中获取第 arg 个常量所表示的方法下标
 			vm.push(runtime.FetchMethod(env, program.Constants[arg].(*runtime.Method)))
+		case OpLoadDynamic:
+			if vm.tape != nil {
+				vm.push(vm.load(program, env, op, arg))
+				break
+			}
+			vm.push(vm.resolve(env, program.Constants[arg].(string)))
 		case OpLoadFunc:
 			// 把第 arg 个函数入栈
 			vm.push(program.functions[arg])
@@ -139,11 +270,34 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 			// 从 a 中获取 b 值 c ，然后入栈
 			b := vm.pop()
 			a := vm.pop()
-			vm.push(runtime.Fetch(a, b))
+			vm.push(program.methods.Fetch(a, b))
+		case OpFetchSafe:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(runtime.FetchSafe(a, b))
+		case OpFetchNamed:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(program.Constants[arg].(*runtime.FieldNames).Fetch(program.methods, a, b))
+		case OpFetchNamedSafe:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(program.Constants[arg].(*runtime.FieldNames).FetchSafe(a, b))
+		case OpFetchIndexSafe:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(runtime.FetchIndexSafe(a, b))
+		case OpFetchFieldSafe:
+			a := vm.pop()
+			vm.push(runtime.FetchFieldSafe(a, program.Constants[arg].(*runtime.Field)))
 		case OpFetchField:
 			a := vm.pop()
 			vm.push(runtime.FetchField(a, program.Constants[arg].(*runtime.Field)))
 		case OpLoadEnv:
+			if vm.tape != nil {
+				vm.push(vm.load(program, env, op, arg))
+				break
+			}
 			vm.push(env)
 		case OpMethod:
 			a := vm.pop()
@@ -172,6 +326,14 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 			b := vm.pop()
 			a := vm.pop()
 			vm.push(a.(string) == b.(string))
+		case OpEqualFloat:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(runtime.EqualFloat(a, b, program.Constants[arg].(float64)))
+		case OpEqualStrict:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(runtime.EqualStrict(a, b))
 		case OpJump: // Jmp XXX ，修改 ip 跳转到指定 op ，这里都是相对寻址，基于当前 ip 作偏移
 			vm.ip += arg
 		case OpJumpIfTrue:
@@ -190,6 +352,10 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 			if !runtime.IsNil(vm.current()) {
 				vm.ip += arg
 			}
+		case OpJumpIfNotNilStrict:
+			if vm.current() != nil {
+				vm.ip += arg
+			}
 		case OpJumpIfEnd:
 			scope := vm.scope()
 			if scope.Index >= scope.Len {
@@ -197,10 +363,18 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 			}
 		case OpJumpBackward:
 			vm.ip -= arg
+		case OpSwitch:
+			if offset, ok := program.Constants[arg].(runtime.Switch)[vm.pop()]; ok {
+				vm.ip += offset
+			}
 		case OpIn:
 			b := vm.pop()
 			a := vm.pop()
 			vm.push(runtime.In(a, b))
+		case OpInStrict:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(runtime.InStrict(a, b))
 		case OpLess:
 			b := vm.pop()
 			a := vm.pop()
@@ -241,6 +415,20 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 			b := vm.pop()
 			a := vm.pop()
 			vm.push(runtime.Exponent(a, b))
+		case OpAddChecked:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(runtime.AddChecked(a, b))
+		case OpSubtractChecked:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(runtime.SubtractChecked(a, b))
+		case OpMultiplyChecked:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(runtime.MultiplyChecked(a, b))
+		case OpNegateChecked:
+			vm.push(runtime.NegateChecked(vm.pop()))
 		case OpRange:
 			b := vm.pop()
 			a := vm.pop()
@@ -259,7 +447,7 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 				vm.push(false)
 				break
 			}
-			match, err := regexp.MatchString(b.(string), a.(string))
+			match, err := regexp.MatchString(runtime.AsString(b), runtime.AsString(a))
 			if err != nil {
 				panic(err)
 			}
@@ -270,8 +458,21 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 				vm.push(false)
 				break
 			}
-			r := program.Constants[arg].(*regexp.Regexp)
-			vm.push(r.MatchString(a.(string)))
+			switch r := program.Constants[arg].(type) {
+			case *regexp.Regexp:
+				vm.push(r.MatchString(runtime.AsString(a)))
+			case *runtime.Regexp:
+				vm.push(r.MatchString(runtime.AsString(a)))
+			}
+		case OpMatchesGuarded:
+			b := vm.pop()
+			a := vm.pop()
+			if runtime.IsNil(a) || runtime.IsNil(b) {
+				vm.push(false)
+				break
+			}
+			r := program.Constants[arg].(*runtime.Regexps)
+			vm.push(r.MatchString(runtime.AsString(b), runtime.AsString(a)))
 		case OpContains:
 			b := vm.pop()
 			a := vm.pop()
@@ -279,7 +480,7 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 				vm.push(false)
 				break
 			}
-			vm.push(strings.Contains(a.(string), b.(string)))
+			vm.push(strings.Contains(runtime.AsString(a), runtime.AsString(b)))
 		case OpStartsWith:
 			b := vm.pop()
 			a := vm.pop()
@@ -287,7 +488,7 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 				vm.push(false)
 				break
 			}
-			vm.push(strings.HasPrefix(a.(string), b.(string)))
+			vm.push(strings.HasPrefix(runtime.AsString(a), runtime.AsString(b)))
 		case OpEndsWith:
 			b := vm.pop()
 			a := vm.pop()
@@ -295,34 +496,38 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 				vm.push(false)
 				break
 			}
-			vm.push(strings.HasSuffix(a.(string), b.(string)))
+			vm.push(strings.HasSuffix(runtime.AsString(a), runtime.AsString(b)))
 		case OpSlice:
 			from := vm.pop()
 			to := vm.pop()
 			node := vm.pop()
 			vm.push(runtime.Slice(node, from, to))
 		case OpCall:
+			callee := vm.pop()
+			if closure, ok := callee.(*runtime.Closure); ok {
+				vm.callClosure(closure, arg)
+				break
+			}
 			// 获取待调用的函数，反射得到类型
-			fn := reflect.ValueOf(vm.pop())
+			fn := reflect.ValueOf(callee)
 			// 从栈中弹出指定数量（arg）的参数
 			size := arg
 			in := make([]reflect.Value, size)
 			for i := int(size) - 1; i >= 0; i-- {
-				param := vm.pop()
-				if param == nil {
-					in[i] = reflect.Zero(fn.Type().In(i)) // 根据参数类型生成反射零值
-				} else {
-					in[i] = reflect.ValueOf(param)
-				}
+				// nil 参数按参数类型生成零值，可变参数按元素类型
+				in[i] = runtime.ParamValue(runtime.ParamType(fn.Type(), i), vm.pop())
 			}
 			// 通过反射调用函数
-			out := fn.Call(in)
-			// 如果有两个返回值，且第二个是 error 类型且非 nil → 抛出异常，等价于 ```if err != nil { panic(err) }```
-			if len(out) == 2 && out[1].Type() == errorType && !out[1].IsNil() {
-				panic(out[1].Interface().(error))
+			vm.push(callValue(fn, in))
+		case OpCallCtx:
+			// Like OpCall, with the context of the run as the first argument.
+			fn := reflect.ValueOf(vm.pop())
+			in := make([]reflect.Value, arg+1)
+			for i := arg; i > 0; i-- {
+				in[i] = runtime.ParamValue(runtime.ParamType(fn.Type(), i), vm.pop())
 			}
-			// 将第一个返回值（通常是实际的结果）压入虚拟机栈中，如果有多个返回值，其余返回值被丢弃。
-			vm.push(out[0].Interface())
+			in[0] = reflect.ValueOf(&vm.ctx).Elem()
+			vm.push(callValue(fn, in))
 		case OpCall0:
 			out, err := program.functions[arg]()
 			if err != nil {
@@ -396,6 +601,34 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 			vm.push(out)
 		case OpCallBuiltin1:
 			vm.push(builtin.Builtins[arg].Fast(vm.pop()))
+		case OpCallBuiltin2:
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(builtin.Builtins[arg].Fast2(a, b))
+		case OpCallBuiltin3:
+			c := vm.pop()
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(builtin.Builtins[arg].Fast3(a, b, c))
+		case OpClosure:
+			lambda := program.Constants[arg].(*runtime.Lambda)
+			values := make([]any, len(lambda.Captures))
+			for i, index := range lambda.Captures {
+				values[i] = vm.Variables[index]
+			}
+			vm.push(&runtime.Closure{Lambda: lambda, Values: values})
+
+		case OpReturn:
+			f := vm.frames[len(vm.frames)-1]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			for i, index := range f.closure.Locals {
+				vm.Variables[index] = f.saved[i]
+			}
+			for i, index := range f.closure.Captures {
+				vm.Variables[index] = f.saved[len(f.closure.Locals)+i]
+			}
+			vm.ip = f.ip
+
 		case OpArray:
 			size := vm.pop().(int)
 			vm.memGrow(uint(size))
@@ -454,6 +687,9 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 		case OpPointer:
 			scope := vm.scope()
 			vm.push(scope.Array.Index(scope.Index).Interface())
+		case OpOuterPointer:
+			scope := vm.Scopes[vm.scopeBase()+arg]
+			vm.push(scope.Array.Index(scope.Index).Interface())
 		case OpThrow:
 			panic(vm.pop().(error))
 		case OpCreate:
@@ -461,21 +697,15 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 			case 1:
 				vm.push(make(groupBy))
 			case 2:
-				scope := vm.scope()
-				var desc bool
-				switch vm.pop().(string) {
-				case "asc":
-					desc = false
-				case "desc":
-					desc = true
-				default:
-					panic("unknown order, use asc or desc")
-				}
-				vm.push(&runtime.SortBy{
-					Desc:   desc,
-					Array:  make([]any, 0, scope.Len),
-					Values: make([]any, 0, scope.Len),
-				})
+				vm.push(runtime.NewSortBy(vm.pop(), vm.scope().Len))
+			case 3:
+				vm.push(&uniqBy{})
+			case 4:
+				vm.push([]any{[]any{}, []any{}})
+			case 5:
+				compare := vm.pop()
+				array := vm.pop()
+				vm.push(runtime.NewSortFunc(array, compare))
 			default:
 				panic(fmt.Sprintf("unknown OpCreate argument %v", arg))
 			}
@@ -491,29 +721,101 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 			sortable := scope.Acc.(*runtime.SortBy)
 			sortable.Array = append(sortable.Array, item)
 			sortable.Values = append(sortable.Values, value)
+		case OpUniqBy:
+			key := vm.pop()
+			vm.push(vm.scope().Acc.(*uniqBy).add(key))
+		case OpPartition:
+			scope := vm.scope()
+			item := scope.Array.Index(scope.Index).Interface()
+			parts := scope.Acc.([]any)
+			if vm.pop().(bool) {
+				parts[0] = append(parts[0].([]any), item)
+			} else {
+				parts[1] = append(parts[1].([]any), item)
+			}
+		case OpMin:
+			scope := vm.scope()
+			if v := vm.pop(); scope.Acc == nil || runtime.Less(v, scope.Acc) {
+				scope.Acc = v
+			}
+		case OpMax:
+			scope := vm.scope()
+			if v := vm.pop(); scope.Acc == nil || runtime.More(v, scope.Acc) {
+				scope.Acc = v
+			}
 		case OpSort:
 			scope := vm.scope()
 			sortable := scope.Acc.(*runtime.SortBy)
 			sort.Sort(sortable)
 			vm.memGrow(uint(scope.Len))
 			vm.push(sortable.Array)
+		case OpSortNext:
+			// Pushes the next pair of elements and the comparator to call
+			// with them, or the sorted array once it is done.
+			sortable := vm.current().(*runtime.SortFunc)
+			if a, b, ok := sortable.Next(); ok {
+				vm.push(a)
+				vm.push(b)
+				vm.push(sortable.Compare)
+			} else {
+				vm.pop()
+				vm.memGrow(uint(len(sortable.Array)))
+				vm.push(sortable.Array)
+				vm.ip += arg
+			}
+		case OpSortResult:
+			result := vm.pop()
+			vm.current().(*runtime.SortFunc).Result(result)
+		case OpRegexp:
+			pattern := vm.pop()
+			vm.push(program.Constants[arg].(*runtime.Regexps).Regexp(runtime.AsString(pattern)))
+		case OpCover:
+			b, _ := vm.current().(bool)
+			program.Constants[arg].(*Branch).take(b)
+		case OpCoverNil:
+			program.Constants[arg].(*Branch).take(!runtime.IsNil(vm.current()))
 		case OpProfileStart:
-			span := program.Constants[arg].(*Span)
-			span.start = time.Now()
+			vm.span(program.Constants[arg].(*Span)).start = time.Now()
 		case OpProfileEnd:
-			span := program.Constants[arg].(*Span)
-			span.Duration += time.Since(span.start).Nanoseconds()
+			span := vm.span(program.Constants[arg].(*Span))
+			span.duration += time.Since(span.start).Nanoseconds()
+			span.count++
+			if len(vm.Stack) > 0 {
+				if b, ok := vm.current().(bool); ok && b {
+					span.truths++
+				}
+			}
 		case OpBegin:
-			a := vm.pop()
-			array := reflect.ValueOf(a)
-			vm.Scopes = append(vm.Scopes, &Scope{
+			if maxScopes > 0 && uint(len(vm.Scopes)) >= maxScopes {
+				panic(vm.nestedLoops(program, maxScopes))
+			}
+			array := reflect.ValueOf(vm.pop())
+			scope := Scope{
 				Array: array,
 				Len:   array.Len(),
-			})
+				begin: vm.ip - 1,
+			}
+			// Loops nested deeper than in the bytecode, through calls of
+			// closures, get scopes of their own.
+			if n := len(vm.Scopes); n < len(vm.arena) {
+				vm.arena[n] = scope
+				vm.Scopes = append(vm.Scopes, &vm.arena[n])
+			} else {
+				deeper := scope
+				vm.Scopes = append(vm.Scopes, &deeper)
+			}
 		case OpEnd:
 			vm.Scopes = vm.Scopes[:len(vm.Scopes)-1]
 		default:
-			panic(fmt.Sprintf("unknown bytecode %#x", op))
+			custom := op.custom()
+			if custom == nil {
+				panic(fmt.Sprintf("unknown bytecode %#x", op))
+			}
+			var argument any
+			if arg >= 0 {
+				argument = program.Constants[arg]
+			}
+			custom.handler(vm, env, argument)
 		}
 		if debug && vm.debug {
 			vm.curr <- vm.ip
@@ -531,10 +833,99 @@ func (vm *VM) Run(program *Program, env any) (_ any, err error) {
 	return nil, nil
 }
 
+// nestedLoops describes the loops which exceed MaxScopes, from the
+// outermost one, like "too many nested loops (3 > 2): map > filter > any".
+func (vm *VM) nestedLoops(program *Program, maxScopes uint) string {
+	names := make([]string, 0, len(vm.Scopes)+1)
+	for _, scope := range vm.Scopes {
+		names = append(names, program.loopName(scope.begin))
+	}
+	names = append(names, program.loopName(vm.ip-1))
+	return fmt.Sprintf("too many nested loops (%d > %d): %s", len(names), maxScopes, strings.Join(names, " > "))
+}
+
+// MaxCallDepth is the maximum number of nested calls of functions defined
+// in expressions.
+const MaxCallDepth = 1000
+
+// frame is a call of a function defined in the expression.
+type frame struct {
+	ip      int // Address to return to.
+	closure *runtime.Closure
+	saved   []any // Values of the variables of the function before the call.
+	scopes  int   // Scopes of the loops around the call, not visible to #N in the body.
+}
+
+// callClosure jumps to the body of a function defined in the expression. The
+// variables of the function are saved and restored by OpReturn, so the
+// function can be called again while it runs, through its parameters.
+func (vm *VM) callClosure(closure *runtime.Closure, argc int) {
+	if argc != closure.Params {
+		panic(fmt.Sprintf("invalid number of arguments (expected %d, got %d)", closure.Params, argc))
+	}
+	if len(vm.frames) >= MaxCallDepth {
+		panic("maximum call depth exceeded")
+	}
+	f := frame{
+		ip:      vm.ip,
+		closure: closure,
+		saved:   make([]any, 0, len(closure.Locals)+len(closure.Captures)),
+		scopes:  len(vm.Scopes),
+	}
+	for _, index := range closure.Locals {
+		f.saved = append(f.saved, vm.Variables[index])
+	}
+	for _, index := range closure.Captures {
+		f.saved = append(f.saved, vm.Variables[index])
+	}
+	vm.frames = append(vm.frames, f)
+
+	for i, index := range closure.Captures {
+		vm.Variables[index] = closure.Values[i]
+	}
+	for i := argc - 1; i >= 0; i-- {
+		vm.Variables[closure.Locals[i]] = vm.pop()
+	}
+	vm.ip = closure.Start
+}
+
+// scopeBase returns the index of the outermost scope #1 refers to. Bodies of
+// functions count their loops from the call, as the checker does.
+func (vm *VM) scopeBase() int {
+	if len(vm.frames) == 0 {
+		return 0
+	}
+	return vm.frames[len(vm.frames)-1].scopes
+}
+
+// resolve returns the value of the name from the env, see runtime.Resolve.
+// Each name is resolved once per run, however many times it is read.
+func (vm *VM) resolve(env any, name string) any {
+	if value, ok := vm.resolved[name]; ok {
+		return value
+	}
+	value := runtime.Resolve(env, name)
+	if vm.resolved == nil {
+		vm.resolved = map[string]any{}
+	}
+	vm.resolved[name] = value
+	return value
+}
+
 func (vm *VM) current() any {
 	return vm.Stack[len(vm.Stack)-1]
 }
 
+// callValue calls fn with reflection and returns its first result. A non-nil
+// error as the second result is raised, like by functions called by OpCallN.
+func callValue(fn reflect.Value, in []reflect.Value) any {
+	out := fn.Call(in)
+	if len(out) == 2 && out[1].Type() == errorType && !out[1].IsNil() {
+		panic(out[1].Interface().(error))
+	}
+	return out[0].Interface()
+}
+
 func (vm *VM) push(value any) {
 	vm.Stack = append(vm.Stack, value)
 }
@@ -1,13 +1,16 @@
 package vm_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/expr-lang/expr/internal/testify/assert"
 	"github.com/expr-lang/expr/internal/testify/require"
 
 	"github.com/expr-lang/expr"
@@ -461,6 +464,126 @@ func TestVM_GroupAndSortOperations(t *testing.T) {
 	}
 }
 
+func TestRunContext(t *testing.T) {
+	program, err := expr.Compile(`len(filter(1..2000, # % 2 == 0))`)
+	require.NoError(t, err)
+
+	out, err := vm.RunContext(context.Background(), program, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1000, out)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = vm.RunContext(ctx, program, nil)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestVM_OpsBudget(t *testing.T) {
+	program, err := expr.Compile(`sum(1..100, {sum(1..100, #)})`)
+	require.NoError(t, err)
+
+	v := vm.VM{OpsBudget: 1000}
+	_, err = v.Run(program, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "ops budget exceeded")
+
+	v = vm.VM{OpsBudget: 1e6}
+	out, err := v.Run(program, nil)
+	require.NoError(t, err)
+	require.Equal(t, 505000, out)
+
+	// The budget applies to each run separately.
+	out, err = v.Run(program, nil)
+	require.NoError(t, err)
+	require.Equal(t, 505000, out)
+}
+
+func TestVM_MaxScopes(t *testing.T) {
+	program, err := expr.Compile(`map(1..2, {filter(1..2, {any(1..2, # > 0)})})`)
+	require.NoError(t, err)
+
+	v := vm.VM{MaxScopes: 2}
+	_, err = v.Run(program, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "too many nested loops (3 > 2): map > filter > any")
+
+	v = vm.VM{MaxScopes: 3}
+	out, err := v.Run(program, nil)
+	require.NoError(t, err)
+	require.Equal(t, []any{[]any{1, 2}, []any{1, 2}}, out)
+
+	// Sequential loops are not nested.
+	program, err = expr.Compile(`count(1..2, # > 0) + count(1..2, # > 1)`)
+	require.NoError(t, err)
+	v = vm.VM{MaxScopes: 1}
+	out, err = v.Run(program, nil)
+	require.NoError(t, err)
+	require.Equal(t, 3, out)
+}
+
+func TestVM_MaxScopes_config(t *testing.T) {
+	program, err := expr.Compile(`map(1..2, {filter(1..2, {any(1..2, # > 0)})})`, expr.MaxScopes(2))
+	require.NoError(t, err)
+
+	_, err = vm.Run(program, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "too many nested loops (3 > 2): map > filter > any")
+
+	data, err := program.MarshalBinary()
+	require.NoError(t, err)
+	loaded := &vm.Program{}
+	require.NoError(t, loaded.UnmarshalBinary(data))
+	_, err = vm.Run(loaded, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "too many nested loops (3 > 2)")
+
+	// The MaxScopes of the VM wins.
+	v := vm.VM{MaxScopes: 3}
+	_, err = v.Run(program, nil)
+	require.NoError(t, err)
+}
+
+func TestVM_Scopes(t *testing.T) {
+	shallow, err := expr.Compile(`count(1..3, # > 1)`)
+	require.NoError(t, err)
+	deep, err := expr.Compile(`map(1..2, {filter(1..3, {any(1..# + 1, # > 2)})})`)
+	require.NoError(t, err)
+
+	// The scopes preallocated for one program grow for a deeper one.
+	v := vm.VM{}
+	for i := 0; i < 2; i++ {
+		out, err := v.Run(shallow, nil)
+		require.NoError(t, err)
+		require.Equal(t, 2, out)
+		out, err = v.Run(deep, nil)
+		require.NoError(t, err)
+		require.Equal(t, []any{[]any{2, 3}, []any{2, 3}}, out)
+	}
+
+	// Programs built by hand have no preallocated scopes.
+	program := &vm.Program{
+		Bytecode:  []vm.Opcode{vm.OpPush, vm.OpBegin, vm.OpGetLen, vm.OpEnd},
+		Arguments: []int{0, 0, 0, 0},
+		Constants: []any{[]int{1, 2, 3}},
+	}
+	out, err := v.Run(program, nil)
+	require.NoError(t, err)
+	require.Equal(t, 3, out)
+}
+
+func TestRunContext_deadline(t *testing.T) {
+	program, err := expr.Compile(`all(1..1000, {all(1..1000, {all(1..1000, # > 0)})})`)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	v := vm.VM{MemoryBudget: 1e9}
+	_, err = v.RunContext(ctx, program, nil)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
 // TestVM_ProfileOperations tests the profiling opcodes
 func TestVM_ProfileOperations(t *testing.T) {
 	program := &vm.Program{
@@ -484,8 +607,58 @@ func TestVM_ProfileOperations(t *testing.T) {
 	_, err := testVM.Run(program, nil)
 	require.NoError(t, err)
 
+	// Counters are kept by the VM, so the program can be shared.
 	span := program.Constants[0].(*vm.Span)
-	require.Greater(t, span.Duration, time.Millisecond)
+	require.Zero(t, span.Duration)
+}
+
+func TestVM_Profile(t *testing.T) {
+	program, err := expr.Compile(`all(items, # > 0) and flag`, expr.Env(map[string]any{
+		"items": []int{},
+		"flag":  false,
+	}), func(c *conf.Config) {
+		c.Profile = true
+	})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				v := vm.VM{}
+				_, err := v.Run(program, map[string]any{"items": []int{1, 2, 3}, "flag": true})
+				assert.NoError(t, err)
+
+				span := v.Profile()
+				assert.Equal(t, int64(1), span.Count)
+				assert.Equal(t, int64(1), span.True)
+			}
+		}()
+	}
+	wg.Wait()
+
+	span := program.Profile()
+	require.NotNil(t, span)
+	assert.Equal(t, "all(items, # > 0) and flag", span.Expression)
+	assert.Equal(t, int64(40), span.Count)
+	assert.Equal(t, int64(40), span.True)
+	require.NotEmpty(t, span.Children)
+	assert.Equal(t, int64(40), span.Children[0].Count)
+
+	v := vm.VM{}
+	_, err = v.Run(program, map[string]any{"items": []int{0}, "flag": true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), v.Profile().True)
+	assert.Equal(t, int64(41), vm.GetSpan(program).Count)
+
+	plain, err := expr.Compile(`1 + 2`)
+	require.NoError(t, err)
+	_, err = v.Run(plain, nil)
+	require.NoError(t, err)
+	assert.Nil(t, v.Profile())
+	assert.Nil(t, plain.Profile())
 }
 
 // TestVM_IndexOperations tests the index manipulation opcodes
@@ -1265,12 +1438,13 @@ func createNestedMapExpr(t *testing.T, depth int) string {
 
 func TestVM_Limits(t *testing.T) {
 	tests := []struct {
-		name         string
-		expr         string
-		memoryBudget uint
-		maxNodes     uint
-		env          map[string]any
-		expectError  string
+		name          string
+		expr          string
+		memoryBudget  uint
+		maxNodes      uint
+		maxParseDepth uint
+		env           map[string]any
+		expectError   string
 	}{
 		{
 			name:         "nested arithmetic allowed with max nodes and memory budget",
@@ -1287,6 +1461,15 @@ func TestVM_Limits(t *testing.T) {
 			memoryBudget: 1, // arithmetic expressions not counted towards memory budget
 			expectError:  "compilation failed: expression exceeds maximum allowed nodes",
 		},
+		{
+			name:          "nested arithmetic blocked by max parse depth",
+			expr:          createNestedArithmeticExpr(t, 10000),
+			env:           map[string]any{"a": 1},
+			maxNodes:      100000,
+			maxParseDepth: 1000,
+			memoryBudget:  1, // arithmetic expressions not counted towards memory budget
+			expectError:   "compilation failed: expression is nested deeper than 1000 levels",
+		},
 		{
 			name:         "nested map blocked by memory budget",
 			expr:         createNestedMapExpr(t, 100),
@@ -1306,6 +1489,9 @@ func TestVM_Limits(t *testing.T) {
 					c.MaxNodes = test.maxNodes
 				})
 			}
+			if test.maxParseDepth > 0 {
+				options = append(options, expr.MaxParseDepth(test.maxParseDepth))
+			}
 
 			program, err := expr.Compile(test.expr, options...)
 			if err != nil {